@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Abuse detection scores client IPs on behavior no legitimate client shows: requests to
+// decoy endpoints that only vulnerability scanners and upload spammers try, and bursts of
+// 404s, which is what probing for file IDs looks like. Scores decay a day after the last
+// offense. Above ABUSE_THROTTLE_SCORE an IP gets a quarter of the rate limit; above
+// ABUSE_BLOCK_SCORE it is blocked for ABUSE_BLOCK_DURATION. Requests authenticated with an
+// API key are accountable to their key and never scored.
+
+const (
+	abusePrefix   = "abuse:"
+	abuseNotFound = "abuse_404:"
+	abuseScoreTTL = 24 * time.Hour
+
+	abuseHoneypotPoints = 50
+	abuseNotFoundPoints = 20
+
+	// abuseThrottledContextKey is set for clients the rate limiter should hold to a
+	// quarter of their budget
+	abuseThrottledContextKey = "abuseThrottled"
+)
+
+// Decoy paths: common targets of vulnerability scanners and of bots looking for open
+// upload scripts. Nothing the frontend or the API uses looks like them.
+var (
+	honeypotPaths = []string{
+		"/.env", "/.git/config", "/wp-login.php", "/xmlrpc.php", "/phpinfo.php",
+		"/wp-admin/*path", "/phpmyadmin/*path", "/cgi-bin/*path",
+	}
+	honeypotUploadPaths = []string{
+		"/upload.php", "/api/upload.php", "/api/v1/upload", "/api/files/upload", "/fileupload",
+	}
+)
+
+// AbuseRecord is the abuse score of a client IP and what raised it
+type AbuseRecord struct {
+	IP             string     `json:"ip"`
+	Score          int64      `json:"score"`
+	HoneypotHits   int64      `json:"honeypot_hits"`
+	NotFoundBursts int64      `json:"not_found_bursts"`
+	BlockedUntil   *time.Time `json:"blocked_until,omitempty"`
+}
+
+// parseAbuseRecord reads the Redis hash of an IP's abuse record
+func parseAbuseRecord(ip string, fields map[string]string) *AbuseRecord {
+	record := &AbuseRecord{IP: ip}
+	record.Score, _ = strconv.ParseInt(fields["score"], 10, 64)
+	record.HoneypotHits, _ = strconv.ParseInt(fields["honeypot"], 10, 64)
+	record.NotFoundBursts, _ = strconv.ParseInt(fields["not_found"], 10, 64)
+	if until, err := strconv.ParseInt(fields["blocked_until"], 10, 64); err == nil {
+		blockedUntil := time.Unix(until, 0).UTC()
+		record.BlockedUntil = &blockedUntil
+	}
+	return record
+}
+
+// abuseRecord returns the abuse record of an IP, nil when it has none
+func (s *FileService) abuseRecord(ip string) (*AbuseRecord, error) {
+	fields, err := s.redis.HGetAll(context.Background(), abusePrefix+ip).Result()
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+	return parseAbuseRecord(ip, fields), nil
+}
+
+// raiseAbuseScore adds points to an IP's score for one offense of kind, blocking the IP
+// once the score reaches ABUSE_BLOCK_SCORE
+func (s *FileService) raiseAbuseScore(ip, kind string, points int64) {
+	ctx := context.Background()
+	key := abusePrefix + ip
+	score, err := s.redis.HIncrBy(ctx, key, "score", points).Result()
+	if err != nil {
+		log.Printf("Failed to raise abuse score of %s: %v", ip, err)
+		return
+	}
+	s.redis.HIncrBy(ctx, key, kind, 1)
+
+	ttl := abuseScoreTTL
+	if score >= int64(s.config.AbuseBlockScore) {
+		blockedUntil := s.clock.Now().Add(s.config.AbuseBlockDuration)
+		s.redis.HSet(ctx, key, "blocked_until", blockedUntil.Unix())
+		ttl = max(ttl, s.config.AbuseBlockDuration)
+		log.Printf("Blocking %s until %s: abuse score %d after %s", ip, blockedUntil.Format(time.RFC3339), score, kind)
+	}
+	s.redis.Expire(ctx, key, ttl)
+}
+
+// countNotFound counts a 404 answered to an IP, scoring each minute it reaches
+// ABUSE_NOT_FOUND_LIMIT once
+func (s *FileService) countNotFound(ip string) {
+	ctx := context.Background()
+	minute := s.clock.Now().Unix() / 60
+	key := abuseNotFound + ip + ":" + strconv.FormatInt(minute, 10)
+	count, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return
+	}
+	if count == 1 {
+		s.redis.Expire(ctx, key, 2*time.Minute)
+	}
+	if count == int64(s.config.AbuseNotFoundLimit) {
+		s.raiseAbuseScore(ip, "not_found", abuseNotFoundPoints)
+	}
+}
+
+// abuseMiddleware turns away blocked IPs, marks those to throttle for rateLimitMiddleware
+// and watches responses for 404 bursts. It runs after apiKeyMiddleware.
+func (s *FileService) abuseMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKeyFromContext(c) != nil {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		throttled, apiErr := s.checkAbuse(ip)
+		if apiErr != nil {
+			apiErr.respond(c)
+			return
+		}
+		if throttled {
+			c.Set(abuseThrottledContextKey, true)
+		}
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusNotFound {
+			s.countNotFound(ip)
+		}
+	}
+}
+
+// checkAbuse refuses an IP blocked for abuse with 403, and reports whether one with a
+// high score is throttled
+func (s *FileService) checkAbuse(ip string) (bool, *apiError) {
+	record, err := s.abuseRecord(ip)
+	if err != nil {
+		// Fail open: an unreachable Redis shouldn't lock everyone out
+		log.Printf("Failed to read abuse score of %s: %v", ip, err)
+	}
+	if record == nil {
+		return false, nil
+	}
+	if record.BlockedUntil != nil && record.BlockedUntil.After(s.clock.Now()) {
+		return false, retryLaterError(http.StatusForbidden, errorCodeBlocked, record.BlockedUntil.Sub(s.clock.Now()), gin.H{
+			"error":   "Access blocked",
+			"message": "Requests from your address were blocked after repeated abuse. Please try again later.",
+		})
+	}
+	return record.Score >= int64(s.config.AbuseThrottleScore), nil
+}
+
+// honeypot answers a decoy endpoint like a missing page, scoring the caller
+func (s *FileService) honeypot(c *gin.Context) {
+	if apiKeyFromContext(c) == nil {
+		log.Printf("Honeypot %s %s hit by %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		s.raiseAbuseScore(c.ClientIP(), "honeypot", abuseHoneypotPoints)
+	}
+	c.String(http.StatusNotFound, "404 page not found")
+}
+
+// honeypotUpload answers a decoy upload endpoint like a working one, without reading the
+// body, so bots waste their upload instead of moving on to the next target
+func (s *FileService) honeypotUpload(c *gin.Context) {
+	if apiKeyFromContext(c) == nil {
+		log.Printf("Honeypot upload %s %s hit by %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		s.raiseAbuseScore(c.ClientIP(), "honeypot", abuseHoneypotPoints)
+	}
+	c.Header("Connection", "close")
+	c.JSON(http.StatusOK, gin.H{"success": true, "file_id": generateFileID(s.config)})
+}
+
+// registerHoneypots adds the decoy endpoints to the router
+func registerHoneypots(router *gin.Engine, service *FileService) {
+	for _, path := range honeypotPaths {
+		router.Any(path, service.honeypot)
+	}
+	for _, path := range honeypotUploadPaths {
+		router.POST(path, service.honeypotUpload)
+		router.PUT(path, service.honeypotUpload)
+	}
+}
+
+type AbuseRequest struct {
+	IP    string `json:"ip,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// listAbuseScores lists the scored IPs, highest score first
+//
+// @summary List abuse scores
+// @tags admin
+// @body json AbuseRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) listAbuseScores(c *gin.Context) {
+	var req AbuseRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 100
+	}
+
+	ctx := context.Background()
+	keys, err := s.redis.Keys(ctx, abusePrefix+"*").Result()
+	if err != nil {
+		log.Printf("Failed to list abuse scores: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list abuse scores"})
+		return
+	}
+
+	records := make([]*AbuseRecord, 0, len(keys))
+	for _, key := range keys {
+		fields, err := s.redis.HGetAll(ctx, key).Result()
+		if err != nil || len(fields) == 0 {
+			continue
+		}
+		records = append(records, parseAbuseRecord(strings.TrimPrefix(key, abusePrefix), fields))
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Score != records[j].Score {
+			return records[i].Score > records[j].Score
+		}
+		return records[i].IP < records[j].IP
+	})
+	total := len(records)
+	if len(records) > req.Limit {
+		records = records[:req.Limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":        s.config.AbuseDetection,
+		"throttle_score": s.config.AbuseThrottleScore,
+		"block_score":    s.config.AbuseBlockScore,
+		"total":          total,
+		"clients":        records,
+	})
+}
+
+// clearAbuseScore forgives an IP, lifting its block
+//
+// @summary Clear the abuse score of an IP
+// @tags admin
+// @body json AbuseRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) clearAbuseScore(c *gin.Context) {
+	var req AbuseRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.IP == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ip is required"})
+		return
+	}
+
+	if err := s.redis.Del(context.Background(), abusePrefix+req.IP).Err(); err != nil {
+		log.Printf("Failed to clear abuse score of %s: %v", req.IP, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear abuse score"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Abuse score cleared", "ip": req.IP})
+}
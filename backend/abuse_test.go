@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAbuseTestRouter(ts *testService) *gin.Engine {
+	ts.config.AbuseDetection = true
+	ts.config.AbuseThrottleScore = 50
+	ts.config.AbuseBlockScore = 100
+	ts.config.AbuseBlockDuration = time.Hour
+	ts.config.AbuseNotFoundLimit = 3
+
+	router := gin.New()
+	router.Use(ts.abuseMiddleware())
+	registerHoneypots(router, ts.FileService)
+	router.GET("/api/file/:id", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+	})
+	router.GET("/api/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"throttled": c.GetBool(abuseThrottledContextKey)})
+	})
+	return router
+}
+
+func abuseRequest(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHoneypotBlocksAfterRepeatedHits(t *testing.T) {
+	ts := newTestService(t)
+	router := newAbuseTestRouter(ts)
+
+	if w := abuseRequest(router, http.MethodGet, "/.env"); w.Code != http.StatusNotFound {
+		t.Fatalf("honeypot: got %d, want 404", w.Code)
+	}
+	w := abuseRequest(router, http.MethodGet, "/api/health")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"throttled":true`) {
+		t.Fatalf("after one hit: got %d %s, want throttled", w.Code, w.Body)
+	}
+
+	if w := abuseRequest(router, http.MethodPost, "/upload.php"); w.Code != http.StatusOK {
+		t.Fatalf("upload honeypot: got %d, want 200", w.Code)
+	}
+	w = abuseRequest(router, http.MethodGet, "/api/health")
+	if w.Code != http.StatusForbidden || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("after two hits: got %d, want 403 with Retry-After", w.Code)
+	}
+
+	ts.clock.Advance(time.Hour + time.Second)
+	if w := abuseRequest(router, http.MethodGet, "/api/health"); w.Code != http.StatusOK {
+		t.Errorf("after the block expired: got %d, want 200", w.Code)
+	}
+}
+
+func TestNotFoundBurstRaisesScore(t *testing.T) {
+	ts := newTestService(t)
+	router := newAbuseTestRouter(ts)
+
+	for _, id := range []string{"aaaa", "aaab", "aaac", "aaad"} {
+		abuseRequest(router, http.MethodGet, "/api/file/"+id)
+	}
+	record, err := ts.abuseRecord("192.0.2.7")
+	if err != nil || record == nil {
+		t.Fatalf("abuseRecord = %v, %v", record, err)
+	}
+	if record.Score != abuseNotFoundPoints || record.NotFoundBursts != 1 || record.BlockedUntil != nil {
+		t.Errorf("record = %+v", record)
+	}
+}
+
+func TestListAndClearAbuseScores(t *testing.T) {
+	ts := newTestService(t)
+	router := newAbuseTestRouter(ts)
+	abuseRequest(router, http.MethodGet, "/wp-login.php")
+
+	list := func() []AbuseRecord {
+		w := ts.serve(ts.listAbuseScores,
+			httptest.NewRequest(http.MethodPost, "/api/admin/abuse", strings.NewReader(`{}`)))
+		var resp struct {
+			Clients []AbuseRecord `json:"clients"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Clients
+	}
+
+	clients := list()
+	if len(clients) != 1 || clients[0].IP != "192.0.2.7" || clients[0].HoneypotHits != 1 {
+		t.Fatalf("clients = %+v", clients)
+	}
+
+	w := ts.serve(ts.clearAbuseScore,
+		httptest.NewRequest(http.MethodPost, "/api/admin/abuse/clear", strings.NewReader(`{"ip":"192.0.2.7"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("clear: got %d", w.Code)
+	}
+	if clients := list(); len(clients) != 0 {
+		t.Errorf("clients after clearing = %+v", clients)
+	}
+}
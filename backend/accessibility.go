@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Uploaders can describe a file for people who can't see or hear it: alt text for
+// images, a caption, and a longer description for audio, video and other media. The text
+// is kept with the metadata and used wherever the file is shown, like the preview, the
+// 3D viewer and the share summary.
+
+// Accessibility is the text an uploader wrote to describe a file
+type Accessibility struct {
+	AltText     string `json:"alt_text,omitempty"`    // Replaces an image for screen readers
+	Caption     string `json:"caption,omitempty"`     // Shown next to the file
+	Description string `json:"description,omitempty"` // Longer account of media content
+}
+
+// Longest accepted text, in characters. Alt text is meant to be short; screen readers
+// read it in one go.
+const (
+	maxAltTextLength     = 1000
+	maxCaptionLength     = 2000
+	maxDescriptionLength = 10000
+)
+
+// AccessibilityRequest replaces the accessibility text of a file
+type AccessibilityRequest struct {
+	AltText     string `json:"alt_text"`
+	Caption     string `json:"caption"`
+	Description string `json:"description"`
+}
+
+// accessibilityFromRequest validates the accessibility text given with an upload or an
+// update. It returns nil when every field is empty, and writes the error response and
+// returns false when a field is too long or not plain text.
+func accessibilityFromRequest(c *gin.Context, altText, caption, description string) (*Accessibility, bool) {
+	accessibility := &Accessibility{
+		AltText:     strings.TrimSpace(altText),
+		Caption:     strings.TrimSpace(caption),
+		Description: strings.TrimSpace(description),
+	}
+	for _, field := range []struct {
+		name, value string
+		max         int
+	}{
+		{"alt_text", accessibility.AltText, maxAltTextLength},
+		{"caption", accessibility.Caption, maxCaptionLength},
+		{"description", accessibility.Description, maxDescriptionLength},
+	} {
+		if !utf8.ValidString(field.value) || strings.IndexFunc(field.value, isDisallowedTextRune) >= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid " + field.name,
+				"message": "Accessibility text must be plain UTF-8 text without control characters.",
+			})
+			return nil, false
+		}
+		if utf8.RuneCountInString(field.value) > field.max {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Invalid " + field.name,
+				"message":    fmt.Sprintf("%s can be at most %d characters.", field.name, field.max),
+				"max_length": field.max,
+			})
+			return nil, false
+		}
+	}
+
+	if *accessibility == (Accessibility{}) {
+		return nil, true
+	}
+	return accessibility, true
+}
+
+// isDisallowedTextRune reports control characters other than line breaks and tabs, which
+// descriptions may use
+func isDisallowedTextRune(r rune) bool {
+	return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+}
+
+// label returns the text that best stands in for the file: the alt text, else the caption,
+// else the description
+func (a *Accessibility) label() string {
+	switch {
+	case a == nil:
+		return ""
+	case a.AltText != "":
+		return a.AltText
+	case a.Caption != "":
+		return a.Caption
+	default:
+		return a.Description
+	}
+}
+
+// updateFileAccessibility lets the uploader of a file, proven by the delete password or
+// an API key that may manage it, replace its alt text, caption and description. Fields
+// left out are cleared.
+//
+// @summary Replace the accessibility text of a file
+// @tags file
+// @path id File ID
+// @body json AccessibilityRequest
+// @success 200 json
+// @auth deletePassword apiKey
+func (s *FileService) updateFileAccessibility(c *gin.Context) {
+	fileID := c.Param("id")
+
+	var req AccessibilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"message": "Give alt_text, caption and description; fields left out are cleared.",
+		})
+		return
+	}
+	accessibility, ok := accessibilityFromRequest(c, req.AltText, req.Caption, req.Description)
+	if !ok {
+		return
+	}
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "Changing the accessibility text requires the file's delete password.",
+		})
+		return
+	}
+
+	if err := s.db.UpdateFileAccessibility(fileID, accessibility); err != nil {
+		log.Printf("Failed to update accessibility of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update accessibility"})
+		return
+	}
+	s.redis.Del(context.Background(), "file:"+fileID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Accessibility updated successfully",
+		"file_id":       fileID,
+		"accessibility": accessibility,
+	})
+}
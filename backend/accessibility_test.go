@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadWithAccessibility(t *testing.T) {
+	ts := newTestService(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("alt_text", "  A red kite over a beach  ")
+	writer.WriteField("caption", "Summer 2026")
+	part, _ := writer.CreateFormFile("file", "kite.txt")
+	part.Write([]byte("not really a photo"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := ts.serve(ts.uploadFile, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		FileID string `json:"file_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	w = ts.serve(ts.getMetadata, httptest.NewRequest(http.MethodGet, "/api/metadata/"+resp.FileID, nil), gin.Param{Key: "id", Value: resp.FileID})
+	var metadata FileMetadata
+	json.Unmarshal(w.Body.Bytes(), &metadata)
+	want := Accessibility{AltText: "A red kite over a beach", Caption: "Summer 2026"}
+	if metadata.Accessibility == nil || *metadata.Accessibility != want {
+		t.Errorf("accessibility = %+v, want %+v", metadata.Accessibility, want)
+	}
+}
+
+func TestUpdateFileAccessibility(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "talk", "recording", time.Hour)
+	param := gin.Param{Key: "id", Value: "talk"}
+	update := func(password, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/file/talk/accessibility", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Delete-Password", password)
+		return ts.serve(ts.updateFileAccessibility, req, param)
+	}
+
+	if w := update("wrong", `{"description":"A talk"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong delete password: got %d, want 401", w.Code)
+	}
+	if w := update("delete-me", `{"alt_text":"`+strings.Repeat("a", maxAltTextLength+1)+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("long alt text: got %d, want 400", w.Code)
+	}
+	if w := update("delete-me", `{"caption":"bell\u0007"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("control character: got %d, want 400", w.Code)
+	}
+
+	if w := update("delete-me", `{"caption":"Keynote","description":"Two speakers on stage.\nSlides are read aloud."}`); w.Code != http.StatusOK {
+		t.Fatalf("update: got %d: %s", w.Code, w.Body.String())
+	}
+	file, _ := ts.store.GetFileMetadata("talk")
+	if file.Accessibility == nil || file.Accessibility.Caption != "Keynote" || file.Accessibility.label() != "Keynote" {
+		t.Errorf("stored accessibility = %+v", file.Accessibility)
+	}
+
+	// The caption ends up on the share summary
+	w := ts.serve(ts.getShareSummary, httptest.NewRequest(http.MethodGet, "/api/file/talk/summary", nil), param)
+	if !strings.Contains(w.Body.String(), "Keynote") {
+		t.Error("share summary doesn't show the caption")
+	}
+
+	if w := update("delete-me", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("clear: got %d", w.Code)
+	}
+	if file, _ := ts.store.GetFileMetadata("talk"); file.Accessibility != nil {
+		t.Errorf("accessibility not cleared: %+v", file.Accessibility)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Downloads, previews and streams of a file are written to file_access_logs, which the
+// database keeps for 30 days. Uploaders see the totals in the file metadata and, with the
+// delete password, the daily breakdown and bytes served; admins also get the individual
+// accesses.
+
+// Access types of file_access_logs
+const (
+	accessDownload = "download"
+	accessPreview  = "preview"
+	accessStream   = "stream"
+)
+
+// logFileAccess records that a request was granted access to a file. Range requests that
+// continue a transfer aren't logged again, so a resumed download counts once.
+func (s *FileService) logFileAccess(c *gin.Context, fileID, accessType string) {
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" && !strings.HasPrefix(rangeHeader, "bytes=0-") {
+		return
+	}
+	s.logAccess(callerFrom(c), fileID, accessType)
+}
+
+// logAccess records an access of a file by a caller
+func (s *FileService) logAccess(who caller, fileID, accessType string) {
+	if err := s.db.LogFileAccess(fileID, accessType, who.clientIP, who.userAgent); err != nil {
+		log.Printf("Failed to log %s of %s: %v", accessType, fileID, err)
+	}
+}
+
+type FileAccessesRequest struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// getFileAccesses returns the access totals of a file, its accesses per day and the most
+// recent accesses
+//
+// @summary Get the accesses of a file
+// @tags admin
+// @path id File ID
+// @body json FileAccessesRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getFileAccesses(c *gin.Context) {
+	fileID := c.Param("id")
+
+	var req FileAccessesRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 100
+	}
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	counts, err := s.db.GetFileAccessCounts(fileID)
+	if err != nil {
+		log.Printf("Failed to count accesses of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	daily, err := s.db.GetFileAccessDaily(fileID)
+	if err != nil {
+		log.Printf("Failed to count daily accesses of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	recent, err := s.db.ListFileAccesses(fileID, req.Limit)
+	if err != nil {
+		log.Printf("Failed to list accesses of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":  fileID,
+		"filename": fileStorage.Filename,
+		"totals":   counts,
+		"daily":    daily,
+		"recent":   recent,
+	})
+}
+
+// getFileStats shows the owner of a file, proven by the delete password or an API key
+// that may manage it, how often it was accessed and how many bytes were served of it
+//
+// @summary Get the access statistics of a file
+// @tags file
+// @path id File ID
+// @success 200 json
+// @auth deletePassword apiKey
+func (s *FileService) getFileStats(c *gin.Context) {
+	fileID := c.Param("id")
+
+	fileStorage, err := s.lookupFile(fileID, false)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	adminToken := adminTokenFrom(c)
+	isAdminAccess := adminToken != "" && s.adminTokens.ValidToken(adminToken)
+	if !isAdminAccess && !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "File statistics require the file's delete password.",
+		})
+		return
+	}
+
+	counts, err := s.db.GetFileAccessCounts(fileID)
+	if err != nil {
+		log.Printf("Failed to count accesses of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	daily, err := s.db.GetFileAccessDaily(fileID)
+	if err != nil {
+		log.Printf("Failed to count daily accesses of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	bandwidth, err := s.db.GetFileBandwidth(fileID)
+	if err != nil {
+		log.Printf("Failed to get bandwidth of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var bytesServed int64
+	for _, month := range bandwidth {
+		bytesServed += month.Bytes
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":      fileID,
+		"filename":     fileStorage.Filename,
+		"uploaded_at":  fileStorage.UploadTime,
+		"expires_at":   fileStorage.ExpiresAt,
+		"accesses":     counts,
+		"daily":        daily,
+		"bytes_served": bytesServed,
+		"bandwidth":    bandwidth,
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFileAccessAnalytics(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	ts.saveTestFile(t, "report", "0123456789", 72*time.Hour)
+	param := gin.Param{Key: "id", Value: "report"}
+
+	get := func(handler gin.HandlerFunc, path, rangeHeader string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		ts.serve(handler, req, param)
+	}
+	get(ts.getFile, "/api/file/report", "")
+	get(ts.getFile, "/api/file/report", "bytes=0-4")
+	get(ts.getFile, "/api/file/report", "bytes=5-") // Resumes the download above
+	ts.clock.Advance(24 * time.Hour)
+	get(ts.previewFile, "/api/preview/report", "")
+	get(ts.fastStreamFile, "/api/stream/report", "")
+
+	w := ts.serve(ts.getMetadata, httptest.NewRequest(http.MethodGet, "/api/metadata/report", nil), param)
+	var metadata FileMetadata
+	json.Unmarshal(w.Body.Bytes(), &metadata)
+	if a := metadata.Accesses; a == nil || a.Downloads != 2 || a.Previews != 1 || a.Streams != 1 || a.UniqueIPs != 1 {
+		t.Errorf("metadata accesses = %+v", a)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/file/report/accesses", strings.NewReader(`{"limit":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = ts.serve(ts.getFileAccesses, req, param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("accesses: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Totals FileAccessCounts    `json:"totals"`
+		Daily  []DailyFileAccesses `json:"daily"`
+		Recent []FileAccess        `json:"recent"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Totals.Downloads != 2 || len(resp.Daily) != 2 || resp.Daily[0].Downloads != 2 || resp.Daily[1].Previews != 1 {
+		t.Errorf("totals = %+v, daily = %+v", resp.Totals, resp.Daily)
+	}
+	if len(resp.Recent) != 3 || resp.Recent[0].AccessType != accessStream {
+		t.Errorf("recent = %+v", resp.Recent)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/admin/file/gone/accesses", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	if w := ts.serve(ts.getFileAccesses, req, gin.Param{Key: "id", Value: "gone"}); w.Code != http.StatusNotFound {
+		t.Errorf("unknown file: got %d, want 404", w.Code)
+	}
+}
+
+func TestFileStatsForOwner(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "report", "0123456789", 72*time.Hour)
+	param := gin.Param{Key: "id", Value: "report"}
+	ts.store.LogFileAccess("report", accessDownload, "203.0.113.7", "curl")
+	ts.store.AddBandwidthUsage([]BandwidthUsage{
+		{Period: ts.clock.Now(), SubjectType: "file", SubjectID: "report", Bytes: 10},
+		{Period: ts.clock.Now(), SubjectType: "file", SubjectID: "report", Bytes: 5},
+		{Period: ts.clock.Now(), SubjectType: "file", SubjectID: "other", Bytes: 99},
+	})
+
+	w := ts.serve(ts.getFileStats, httptest.NewRequest(http.MethodGet, "/api/file/report/stats?delete_password=wrong", nil), param)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got %d, want 401", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/file/report/stats", nil)
+	req.Header.Set("X-Delete-Password", "delete-me")
+	w = ts.serve(ts.getFileStats, req, param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var stats struct {
+		Accesses    FileAccessCounts   `json:"accesses"`
+		BytesServed int64              `json:"bytes_served"`
+		Bandwidth   []MonthlyBandwidth `json:"bandwidth"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if stats.Accesses.Downloads != 1 || stats.Accesses.LastAccessAt == nil {
+		t.Errorf("accesses = %+v", stats.Accesses)
+	}
+	if stats.BytesServed != 15 || len(stats.Bandwidth) != 1 || stats.Bandwidth[0].Period != egressPeriod(ts.clock.Now()) {
+		t.Errorf("bytes served = %d, bandwidth = %+v", stats.BytesServed, stats.Bandwidth)
+	}
+}
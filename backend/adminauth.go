@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"file-storage-service/internal/admin"
+)
+
+// Admin requests authenticate with the token /api/admin/auth issues, sent as
+// Authorization: Bearer. adminMiddleware is the single authorization point of the
+// /api/admin group: a request without a valid token is rejected before any handler runs,
+// so handlers don't check credentials themselves. Scripts that don't sign in may send
+// the admin password as the X-Admin-Password header instead, checked there too.
+
+// adminPasswordHeader carries the admin password of requests without a token
+const adminPasswordHeader = "X-Admin-Password"
+
+// adminRevokedPrefix prefixes the Redis keys marking revoked admin tokens by their ID
+const adminRevokedPrefix = "admin_token_revoked:"
+
+// newAdminTokens returns the admin token issuer for ADMIN_JWT_SECRET, with its revocation
+// list kept in Redis so a token revoked on one instance is rejected by all of them
+func newAdminTokens(config *Config, redisClient RedisClient) *admin.Tokens {
+	secret := []byte(config.AdminJWTSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+		if config.AdminPassword != "" || config.AuthProvider == "ldap" {
+			log.Printf("ADMIN_JWT_SECRET is not set: admin tokens are signed with a random secret and only valid on this instance until it restarts")
+		}
+	}
+	previous := make([][]byte, 0, len(config.AdminJWTPreviousSecrets))
+	for _, old := range config.AdminJWTPreviousSecrets {
+		previous = append(previous, []byte(old))
+	}
+	return admin.NewTokens(secret, config.AdminTokenTTL, previous...).WithRevocations(redisRevocations{redisClient})
+}
+
+// redisRevocations is the admin token revocation list in Redis. Entries expire with the
+// tokens they revoke, so the list never outgrows the tokens in circulation.
+type redisRevocations struct {
+	client RedisClient
+}
+
+func (r redisRevocations) Revoke(tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.client.Set(context.Background(), adminRevokedPrefix+tokenID, 1, ttl).Err()
+}
+
+func (r redisRevocations) Revoked(tokenID string) (bool, error) {
+	err := r.client.Get(context.Background(), adminRevokedPrefix+tokenID).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// adminConfigured reports whether admins can sign in at all: with the admin password or,
+// with AUTH_PROVIDER=ldap, their directory account
+func (s *FileService) adminConfigured() bool {
+	return s.config.AdminPassword != "" || s.ldap != nil
+}
+
+// adminTokenFrom returns the admin token of a request: its Authorization: Bearer header,
+// or the admin_token query parameter for links that can't set headers
+func adminTokenFrom(c *gin.Context) string {
+	if token := bearerToken(c); token != "" {
+		return token
+	}
+	return c.Query("admin_token")
+}
+
+// adminMiddleware lets through only admin requests with a valid admin token, or the admin
+// password in X-Admin-Password
+func (s *FileService) adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var err *apiError
+		if password := c.GetHeader(adminPasswordHeader); password != "" && bearerToken(c) == "" {
+			err = s.adminPasswordError(password)
+		} else {
+			err = s.adminTokenError(bearerToken(c))
+		}
+		if err != nil {
+			err.respond(c)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminPasswordError refuses a wrong admin password, and any password when there is none
+// to sign in with
+func (s *FileService) adminPasswordError(password string) *apiError {
+	switch err := admin.CheckPassword(s.config.AdminPassword, password); err {
+	case nil:
+		return nil
+	case admin.ErrNotConfigured:
+		if s.ldap != nil {
+			return &apiError{status: http.StatusUnauthorized, body: gin.H{
+				"error":   "Admin token required",
+				"message": "Sign in at /api/admin/auth and send the token as Authorization: Bearer",
+			}}
+		}
+		return retryLaterError(http.StatusServiceUnavailable, errorCodeNotConfigured, retryAfterNotConfigured, gin.H{
+			"error":   "Admin functionality not configured",
+			"message": "ADMIN_PASSWORD environment variable not set",
+		})
+	default:
+		return &apiError{status: http.StatusUnauthorized, body: gin.H{
+			"error":   "Invalid admin password",
+			"message": "The provided admin password is incorrect",
+		}}
+	}
+}
+
+// adminTokenError refuses an admin token that is missing, invalid or expired
+func (s *FileService) adminTokenError(token string) *apiError {
+	if !s.adminConfigured() {
+		return retryLaterError(http.StatusServiceUnavailable, errorCodeNotConfigured, retryAfterNotConfigured, gin.H{
+			"error":   "Admin functionality not configured",
+			"message": "ADMIN_PASSWORD environment variable not set",
+		})
+	}
+	if token == "" {
+		return &apiError{status: http.StatusUnauthorized, body: gin.H{
+			"error":   "Admin token required",
+			"message": "Sign in at /api/admin/auth and send the token as Authorization: Bearer",
+		}}
+	}
+	if !s.adminTokens.ValidToken(token) {
+		return &apiError{status: http.StatusUnauthorized, body: gin.H{
+			"error":   "Invalid admin token",
+			"message": "The admin token is invalid or has expired. Sign in again at /api/admin/auth",
+		}}
+	}
+	return nil
+}
+
+// bindAdminRequest binds the JSON body of an admin request, writing the error response
+// and returning false when it is malformed. The body may be left out when all its fields
+// are optional.
+func bindAdminRequest(c *gin.Context, req any) bool {
+	err := c.ShouldBindJSON(req)
+	if err == nil || errors.Is(err, io.EOF) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	return false
+}
+
+// refreshAdminToken exchanges the request's admin token for a new one before it expires.
+// The old token is revoked, so each token can be refreshed only once.
+//
+// @summary Refresh the admin token
+// @tags admin
+// @success 200 AdminAuthResponse
+// @auth adminToken
+func (s *FileService) refreshAdminToken(c *gin.Context) {
+	token, expiresAt, err := s.adminTokens.Refresh(bearerToken(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Admin token required",
+			"message": "Send a valid admin token as Authorization: Bearer",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, AdminAuthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// revokeAdminToken signs the request's admin token out on every instance
+//
+// @summary Sign out
+// @tags admin
+// @success 200 json
+// @auth adminToken
+func (s *FileService) revokeAdminToken(c *gin.Context) {
+	if err := s.adminTokens.Revoke(bearerToken(c)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Admin token required",
+			"message": "Send a valid admin token as Authorization: Bearer",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Admin token revoked"})
+}
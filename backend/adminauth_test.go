@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminBearerTokens(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	ts.saveTestFile(t, "doomed", "content", time.Hour)
+
+	router := gin.New()
+	registerAdminRoutes(router.Group("/api"), ts.FileService)
+	request := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		var req *http.Request
+		if body == "" {
+			req = httptest.NewRequest(method, path, nil)
+		} else {
+			req = httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	token, _, err := ts.adminTokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := request(http.MethodPost, "/api/admin/files", "Bearer "+token, ""); w.Code != http.StatusOK {
+		t.Errorf("file list with a token and no body: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPost, "/api/admin/files", "Bearer "+token, `{"limit":1}`); w.Code != http.StatusOK {
+		t.Errorf("file list with a token and a body: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPost, "/api/admin/files", "Bearer not-a-token", `{"admin_password":"secret"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("bad token with the right password: got %d, want 401", w.Code)
+	}
+	// The middleware is the only check, so the password in the body no longer counts
+	if w := request(http.MethodPost, "/api/admin/files", "", `{"admin_password":"secret"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("admin password in the body: got %d, want 401", w.Code)
+	}
+	if w := request(http.MethodPost, "/api/admin/files", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token and no body: got %d, want 401", w.Code)
+	}
+	withPassword := func(password string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/files", nil)
+		req.Header.Set(adminPasswordHeader, password)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := withPassword("secret"); code != http.StatusOK {
+		t.Errorf("admin password header: got %d, want 200", code)
+	}
+	if code := withPassword("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("wrong admin password header: got %d, want 401", code)
+	}
+	if w := request(http.MethodPost, "/api/admin/auth", "", `{"admin_password":"secret"}`); w.Code != http.StatusOK {
+		t.Errorf("sign in without a token: got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := request(http.MethodDelete, "/api/admin/file/doomed", "Bearer "+token, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete with a token: got %d: %s", w.Code, w.Body.String())
+	}
+	if stored, _ := ts.store.GetFile("doomed"); stored != nil {
+		t.Error("file still stored after the admin deleted it")
+	}
+
+	ts.config.AdminPassword = ""
+	if w := request(http.MethodPost, "/api/admin/files", "Bearer "+token, ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("token without admin configured: got %d, want 503", w.Code)
+	}
+}
+
+func TestAdminTokenRefreshAndLogout(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	ts.config.AdminJWTSecret = "shared-secret"
+	ts.adminTokens = newAdminTokens(ts.config, ts.redis)
+	other := newAdminTokens(ts.config, ts.redis)
+
+	router := gin.New()
+	registerAdminRoutes(router.Group("/api"), ts.FileService)
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	token, _, err := ts.adminTokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := request("/api/admin/refresh", token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: got %d: %s", w.Code, w.Body.String())
+	}
+	var refreshed AdminAuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &refreshed); err != nil || refreshed.Token == "" {
+		t.Fatalf("refresh response %s: %v", w.Body.String(), err)
+	}
+	if code := request("/api/admin/files", token).Code; code != http.StatusUnauthorized {
+		t.Errorf("refreshed-away token: got %d, want 401", code)
+	}
+
+	if !other.ValidToken(refreshed.Token) {
+		t.Fatal("token rejected by another instance with the same secret")
+	}
+	if code := request("/api/admin/logout", refreshed.Token).Code; code != http.StatusOK {
+		t.Fatalf("logout: got %d", code)
+	}
+	if code := request("/api/admin/files", refreshed.Token).Code; code != http.StatusUnauthorized {
+		t.Errorf("token after logout: got %d, want 401", code)
+	}
+	// The revocation is shared through Redis, so other instances reject the token too
+	if other.ValidToken(refreshed.Token) {
+		t.Error("revoked token accepted by another issuer sharing the revocation list")
+	}
+}
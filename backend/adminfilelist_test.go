@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminFileListPagination(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	for i, name := range []string{"alpha", "beta", "gamma", "delta", "epsilon"} {
+		ts.saveTestFile(t, name, strings.Repeat("x", i+1), time.Hour)
+		ts.clock.Advance(time.Minute)
+	}
+	photo, _ := ts.store.GetFile("gamma")
+	photo.Filename = "Holiday.JPG"
+	photo.MimeType = "image/jpeg"
+	photo.StorageType = "disk"
+	ts.store.SaveFile(photo)
+
+	list := func(body string) (int, map[string]interface{}, []string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/files", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := ts.serve(ts.getAdminFileList, req)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var ids []string
+		files, _ := resp["files"].([]interface{})
+		for _, file := range files {
+			ids = append(ids, file.(map[string]interface{})["file_id"].(string))
+		}
+		return w.Code, resp, ids
+	}
+
+	code, resp, ids := list(`{"limit":2}`)
+	if code != http.StatusOK || strings.Join(ids, ",") != "epsilon,delta" || resp["total"] != 5.0 || resp["has_more"] != true {
+		t.Errorf("first page: got %d %v, total %v, has_more %v", code, ids, resp["total"], resp["has_more"])
+	}
+	_, resp, ids = list(`{"limit":2,"offset":4}`)
+	if strings.Join(ids, ",") != "alpha" || resp["has_more"] != false {
+		t.Errorf("last page: got %v, has_more %v", ids, resp["has_more"])
+	}
+	if _, resp, _ = list(`{"limit":5000}`); resp["limit"] != 1000.0 {
+		t.Errorf("oversized limit: got %v, want 1000", resp["limit"])
+	}
+
+	_, _, ids = list(`{"sort":"size","order":"asc"}`)
+	if strings.Join(ids, ",") != "alpha,beta,gamma,delta,epsilon" {
+		t.Errorf("sorted by size: got %v", ids)
+	}
+
+	for _, filter := range []string{`"search":"holiday"`, `"mime_type":"image/"`, `"mime_type":"image/jpeg"`, `"storage_type":"disk"`} {
+		_, resp, ids = list(`{` + filter + `}`)
+		if strings.Join(ids, ",") != "gamma" || resp["total"] != 1.0 {
+			t.Errorf("filter %s: got %v, total %v", filter, ids, resp["total"])
+		}
+	}
+
+	for _, body := range []string{
+		`{"sort":"password"}`,
+		`{"order":"sideways"}`,
+		`{"storage_type":"tape"}`,
+		`{"offset":-1}`,
+	} {
+		if code, _, _ := list(body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, code)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// With ADMIN_ADDR set the admin API, /metrics and the pprof endpoints are served only on
+// that address, so the public port carries no admin surface at all and the admin port
+// can be bound to a private interface or guarded with client certificates.
+
+// registerAdminRoutes adds the admin API to an /api group
+func registerAdminRoutes(api *gin.RouterGroup, service *FileService) {
+	// Signing in is the one admin request without credentials to check yet
+	api.POST("/admin/auth", service.adminAuth)
+	adminAPI := api.Group("/admin", service.adminMiddleware())
+	adminAPI.POST("/refresh", service.refreshAdminToken)
+	adminAPI.POST("/logout", service.revokeAdminToken)
+	adminAPI.PUT("/file/:id/expires", service.updateFileExpiration)
+	adminAPI.PUT("/file/password", service.updateFilePassword)
+	adminAPI.DELETE("/file/:id", service.adminDeleteFile)
+	adminAPI.POST("/file/:id/accesses", service.getFileAccesses)
+	adminAPI.POST("/files", service.getAdminFileList)
+	adminAPI.POST("/files/export", service.exportAdminFiles)
+	adminAPI.POST("/mime/stats", service.getMimeStats)
+	adminAPI.POST("/mime/check", service.checkMimeTypes)
+	adminAPI.POST("/maintenance", service.getMaintenanceStatus)
+	adminAPI.POST("/keys", service.createAPIKey)
+	adminAPI.POST("/keys/list", service.listAPIKeys)
+	adminAPI.PUT("/keys/:id", service.updateAPIKey)
+	adminAPI.DELETE("/keys/:id", service.revokeAPIKey)
+	adminAPI.POST("/orgs", service.createOrg)
+	adminAPI.POST("/orgs/list", service.listOrgs)
+	adminAPI.PUT("/orgs/:id", service.updateOrg)
+	adminAPI.DELETE("/orgs/:id", service.deleteOrg)
+	adminAPI.POST("/bandwidth", service.getBandwidthStats)
+	adminAPI.POST("/cost-report", service.getCostReport)
+	adminAPI.POST("/metering", service.getMeteringReport)
+	adminAPI.POST("/jobs/dead", service.listDeadLetterJobs)
+	adminAPI.POST("/jobs/:job_id/requeue", service.requeueDeadLetterJob)
+	adminAPI.POST("/replication", service.getReplicationStatus)
+	adminAPI.POST("/events", service.listFileEvents)
+	adminAPI.POST("/abuse", service.listAbuseScores)
+	adminAPI.POST("/abuse/clear", service.clearAbuseScore)
+	adminAPI.POST("/uploads", service.listActiveUploads)
+	adminAPI.DELETE("/uploads/:upload_id", service.cancelActiveUpload)
+}
+
+// setupAdminRouter registers the routes of the admin listener
+func setupAdminRouter(service *FileService) *gin.Engine {
+	config := service.config
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.Use(retryAfterMiddleware())
+	router.Use(requestLoggingMiddleware())
+
+	// Registered ahead of the timeout middleware, since profiles and traces run for as
+	// long as asked
+	debug := router.Group("/debug/pprof")
+	{
+		debug.GET("/", gin.WrapF(pprof.Index))
+		debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		debug.GET("/profile", gin.WrapF(pprof.Profile))
+		debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+		debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+		debug.GET("/trace", gin.WrapF(pprof.Trace))
+		debug.GET("/:profile", func(c *gin.Context) {
+			pprof.Handler(c.Param("profile")).ServeHTTP(c.Writer, c.Request)
+		})
+	}
+
+	router.Use(sliMiddleware())
+	// The admin panel is loaded from the public origin and calls this one
+	router.Use(corsMiddleware())
+	router.Use(securityMiddleware())
+	router.Use(rateLimitMiddleware(config, newIPRateLimiter()))
+	router.Use(timeoutMiddleware(config.RequestTimeout))
+	router.Use(func(c *gin.Context) {
+		c.Set("fileService", service)
+		c.Next()
+	})
+
+	registerAdminRoutes(router.Group("/api"), service)
+	router.GET("/metrics", service.serveMetrics)
+
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	})
+
+	return router
+}
+
+// adminTLSConfig builds the TLS configuration of the admin listener: nil without a
+// certificate, and requiring client certificates signed by ADMIN_CLIENT_CA when that is set
+func adminTLSConfig(config *Config) (*tls.Config, error) {
+	if config.AdminTLSCert == "" && config.AdminTLSKey == "" {
+		if config.AdminClientCA != "" {
+			return nil, fmt.Errorf("ADMIN_CLIENT_CA requires ADMIN_TLS_CERT and ADMIN_TLS_KEY")
+		}
+		return nil, nil
+	}
+	return listenerTLSConfig(config.AdminTLSCert, config.AdminTLSKey, config.AdminClientCA, tls.RequireAndVerifyClientCert)
+}
+
+// newAdminServer prepares the admin listener's server; the TLS configuration is checked
+// up front so a broken certificate stops startup instead of leaving admin unreachable
+func newAdminServer(service *FileService) (*http.Server, error) {
+	tlsConfig, err := adminTLSConfig(service.config)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:              service.config.AdminAddr,
+		Handler:           setupAdminRouter(service),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+	}, nil
+}
+
+// serveAdmin runs the admin listener until it fails
+func serveAdmin(server *http.Server) {
+	var err error
+	if server.TLSConfig != nil {
+		log.Printf("Admin listener starting on %s (TLS, client certificates: %v)", server.Addr, server.TLSConfig.ClientCAs != nil)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Admin listener starting on %s", server.Addr)
+		err = server.ListenAndServe()
+	}
+	log.Fatalf("Admin listener stopped: %v", err)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func hasRoute(router *gin.Engine, method, path string) bool {
+	for _, route := range router.Routes() {
+		if route.Method == method && route.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAdminRoutesMoveToAdminListener(t *testing.T) {
+	ts := newTestService(t)
+
+	public := setupRouter(ts.FileService)
+	if !hasRoute(public, http.MethodPost, "/api/admin/auth") || !hasRoute(public, http.MethodGet, "/metrics") {
+		t.Fatal("without ADMIN_ADDR the public router should serve admin routes and metrics")
+	}
+
+	ts.config.AdminAddr = "127.0.0.1:0"
+	public = setupRouter(ts.FileService)
+	for _, route := range public.Routes() {
+		if strings.HasPrefix(route.Path, "/api/admin/") || route.Path == "/metrics" || strings.HasPrefix(route.Path, "/debug/") {
+			t.Errorf("public router still serves %s %s", route.Method, route.Path)
+		}
+	}
+
+	admin := setupAdminRouter(ts.FileService)
+	for _, path := range []string{"/metrics", "/debug/pprof/", "/debug/pprof/:profile"} {
+		if !hasRoute(admin, http.MethodGet, path) {
+			t.Errorf("admin router lacks GET %s", path)
+		}
+	}
+	if !hasRoute(admin, http.MethodPost, "/api/admin/files") {
+		t.Error("admin router lacks the admin API")
+	}
+}
+
+func TestPublicMetricsRequireAdminToken(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	router := setupRouter(ts.FileService)
+	scrape := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := scrape("", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous scrape: got %d, want 401", w.Code)
+	}
+	if w := scrape("Authorization", "Bearer not-a-token"); w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid token: got %d, want 401", w.Code)
+	}
+	token, _, err := ts.adminTokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := scrape("Authorization", "Bearer "+token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "one_slo_objective") {
+		t.Errorf("scrape with a token: got %d", w.Code)
+	}
+	if w := scrape(adminPasswordHeader, "secret"); w.Code != http.StatusOK {
+		t.Errorf("scrape with the admin password: got %d", w.Code)
+	}
+}
+
+// testCertificate issues a certificate for 127.0.0.1, self-signed when parent is nil
+func testCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return cert, key, certPEM, keyPEM
+}
+
+func TestAdminListenerRequiresClientCertificate(t *testing.T) {
+	ts := newTestService(t)
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	ca, caKey, caPEM, _ := testCertificate(t, "admin CA", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCertificate(t, "admin server", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCertificate(t, "operator", ca, caKey)
+
+	ts.config.AdminAddr = "127.0.0.1:0"
+	ts.config.AdminClientCA = write("ca.pem", caPEM)
+	if _, err := adminTLSConfig(ts.config); err == nil {
+		t.Fatal("a client CA without a server certificate should be rejected")
+	}
+	ts.config.AdminTLSCert = write("server.pem", serverPEM)
+	ts.config.AdminTLSKey = write("server-key.pem", serverKeyPEM)
+
+	adminServer, err := newAdminServer(ts.FileService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(adminServer.Handler)
+	server.TLS = adminServer.TLSConfig
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certificates,
+		}}}
+	}
+
+	if resp, err := client().Get(server.URL + "/health"); err == nil {
+		resp.Body.Close()
+		t.Fatal("request without a client certificate succeeded")
+	}
+
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client(clientCert).Get(server.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("with a client certificate: got %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/chunks"
+)
+
+// Admins see chunked upload sessions as they are persisted in the chunk_uploads table, so
+// the list covers sessions on every instance. Progress in the table lags up to
+// uploadPersistInterval behind the chunks actually received.
+
+// cancelledUploadPrefix marks a cancelled session in Redis until it would have timed out,
+// so instances still holding it in memory stop accepting its chunks
+const cancelledUploadPrefix = "chunk_upload_cancelled:"
+
+// ActiveUpload is an in-flight chunked upload as shown to admins
+type ActiveUpload struct {
+	UploadID       string    `json:"upload_id"`
+	Filename       string    `json:"filename"`
+	TotalSize      int64     `json:"total_size"`
+	TotalChunks    int       `json:"total_chunks"`
+	ReceivedChunks int       `json:"received_chunks"`
+	ReceivedBytes  int64     `json:"received_bytes"`
+	Progress       int       `json:"progress"` // 0-100
+	ClientIP       string    `json:"client_ip,omitempty"`
+	APIKeyID       string    `json:"api_key_id,omitempty"`
+	StorageClass   string    `json:"storage_class"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActivity   time.Time `json:"last_activity"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	AgeSeconds     int64     `json:"age_seconds"`
+	IdleSeconds    int64     `json:"idle_seconds"`
+}
+
+// activeUploadFromStorage summarizes a persisted session at now
+func activeUploadFromStorage(stored *ChunkUploadStorage, now time.Time) *ActiveUpload {
+	upload := &ActiveUpload{
+		UploadID:     stored.UploadID,
+		Filename:     stored.Filename,
+		TotalSize:    stored.TotalSize,
+		TotalChunks:  stored.TotalChunks,
+		StorageClass: stored.StorageClass,
+		CreatedAt:    stored.CreatedAt,
+		LastActivity: stored.LastActivity,
+		ExpiresAt:    stored.ExpiresAt,
+		AgeSeconds:   int64(now.Sub(stored.CreatedAt).Seconds()),
+		IdleSeconds:  int64(now.Sub(stored.LastActivity).Seconds()),
+	}
+	if stored.ClientIP != nil {
+		upload.ClientIP = *stored.ClientIP
+	}
+	if stored.APIKeyID != nil {
+		upload.APIKeyID = *stored.APIKeyID
+	}
+
+	plan := chunks.Plan{TotalSize: stored.TotalSize, ChunkSize: stored.ChunkSize, TotalChunks: stored.TotalChunks}
+	for i, received := range stored.ReceivedChunks {
+		if received && plan.ValidIndex(i) {
+			upload.ReceivedChunks++
+			upload.ReceivedBytes += plan.ExpectedSize(i)
+		}
+	}
+	if stored.TotalSize > 0 {
+		upload.Progress = int(upload.ReceivedBytes * 100 / stored.TotalSize)
+	}
+	return upload
+}
+
+// cancelUpload discards a session and its chunks on behalf of an admin. It reports false
+// when the session doesn't exist.
+func (m *ChunkUploadManager) cancelUpload(uploadID string) (bool, error) {
+	stored, err := m.db.GetChunkUpload(uploadID)
+	if err != nil {
+		return false, err
+	}
+	_, inMemory := m.uploads.Load(uploadID)
+	inRedis := m.redis.Exists(context.Background(), "chunk_upload:"+uploadID).Val() > 0
+	if stored == nil && !inMemory && !inRedis {
+		return false, nil
+	}
+
+	if err := m.redis.Set(context.Background(), cancelledUploadPrefix+uploadID, "1", m.config.ChunkTimeout).Err(); err != nil {
+		return false, err
+	}
+	m.cleanupUpload(uploadID)
+	m.publishUploadEvent(UploadEvent{Type: "cancelled", UploadID: uploadID})
+	return true, nil
+}
+
+// isCancelled reports whether an admin cancelled the session on any instance
+func (m *ChunkUploadManager) isCancelled(uploadID string) bool {
+	return m.redis.Exists(context.Background(), cancelledUploadPrefix+uploadID).Val() > 0
+}
+
+type ActiveUploadsRequest struct {
+	ClientIP string `json:"client_ip,omitempty"`
+	APIKeyID string `json:"api_key_id,omitempty"`
+	MinIdle  int64  `json:"min_idle_seconds,omitempty"` // Only sessions idle at least this long
+	Sort     string `json:"sort,omitempty"`             // created_at (default), last_activity or total_size
+	Limit    int    `json:"limit,omitempty"`
+}
+
+// listActiveUploads lists the in-flight chunked uploads, oldest first by default
+//
+// @summary List chunked uploads in flight
+// @tags admin
+// @body json ActiveUploadsRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) listActiveUploads(c *gin.Context) {
+	var req ActiveUploadsRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 100
+	}
+
+	stored, err := s.db.ListActiveChunkUploads()
+	if err != nil {
+		log.Printf("Failed to list chunk uploads: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	now := s.clock.Now()
+	uploads := make([]*ActiveUpload, 0, len(stored))
+	for _, record := range stored {
+		upload := activeUploadFromStorage(record, now)
+		if req.ClientIP != "" && upload.ClientIP != req.ClientIP {
+			continue
+		}
+		if req.APIKeyID != "" && upload.APIKeyID != req.APIKeyID {
+			continue
+		}
+		if upload.IdleSeconds < req.MinIdle {
+			continue
+		}
+		uploads = append(uploads, upload)
+	}
+
+	var less func(a, b *ActiveUpload) bool
+	switch req.Sort {
+	case "", "created_at":
+		less = func(a, b *ActiveUpload) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	case "last_activity":
+		less = func(a, b *ActiveUpload) bool { return a.LastActivity.Before(b.LastActivity) }
+	case "total_size":
+		less = func(a, b *ActiveUpload) bool { return a.TotalSize > b.TotalSize }
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be created_at, last_activity or total_size"})
+		return
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].UploadID < uploads[j].UploadID })
+	sort.SliceStable(uploads, func(i, j int) bool { return less(uploads[i], uploads[j]) })
+
+	total := len(uploads)
+	var totalBytes int64
+	for _, upload := range uploads {
+		totalBytes += upload.ReceivedBytes
+	}
+	if len(uploads) > req.Limit {
+		uploads = uploads[:req.Limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":          total,
+		"received_bytes": totalBytes,
+		"count":          len(uploads),
+		"uploads":        uploads,
+	})
+}
+
+// cancelActiveUpload force-cancels a chunked upload, deleting its received chunks
+//
+// @summary Cancel a chunked upload
+// @tags admin
+// @path upload_id Upload ID
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) cancelActiveUpload(c *gin.Context) {
+	uploadID := c.Param("upload_id")
+
+	found, err := s.chunkManager.cancelUpload(uploadID)
+	if err != nil {
+		log.Printf("Failed to cancel upload %s: %v", uploadID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel upload"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+		return
+	}
+
+	log.Printf("Admin cancelled chunk upload %s", uploadID)
+	c.JSON(http.StatusOK, gin.H{"message": "Upload cancelled", "upload_id": uploadID})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminActiveUploads(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+
+	initiate := func(remoteAddr, body string) string {
+		req := httptest.NewRequest(http.MethodPost, "/api/chunk/initiate", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		w := ts.serve(ts.chunkManager.InitiateUpload, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("initiate: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			UploadID string `json:"upload_id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.UploadID
+	}
+	stuck := initiate("192.0.2.1:1234", `{"filename":"stuck.bin","total_size":2500,"chunk_size":1000}`)
+	ts.clock.Advance(10 * time.Minute)
+	busy := initiate("192.0.2.2:1234", `{"filename":"busy.bin","total_size":3000,"chunk_size":1000}`)
+
+	// Progress is read from the persisted session
+	stored, _ := ts.store.GetChunkUpload(stuck)
+	stored.ReceivedChunks = []bool{true, false, true}
+	ts.store.SaveChunkUpload(stored)
+
+	list := func(body string) (int, []ActiveUpload) {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/uploads", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := ts.serve(ts.listActiveUploads, req)
+		var resp struct {
+			Uploads []ActiveUpload `json:"uploads"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Uploads
+	}
+
+	code, uploads := list(`{}`)
+	if code != http.StatusOK || len(uploads) != 2 || uploads[0].UploadID != stuck || uploads[1].UploadID != busy {
+		t.Fatalf("list: got %d %+v", code, uploads)
+	}
+	if got := uploads[0]; got.ClientIP != "192.0.2.1" || got.ReceivedChunks != 2 || got.ReceivedBytes != 1500 ||
+		got.Progress != 60 || got.AgeSeconds != 600 {
+		t.Errorf("stuck upload = %+v", got)
+	}
+	if _, uploads := list(`{"min_idle_seconds":300}`); len(uploads) != 1 || uploads[0].UploadID != stuck {
+		t.Errorf("idle filter: %+v", uploads)
+	}
+	if _, uploads := list(`{"client_ip":"192.0.2.2"}`); len(uploads) != 1 || uploads[0].UploadID != busy {
+		t.Errorf("client_ip filter: %+v", uploads)
+	}
+
+	cancel := func(uploadID string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/admin/uploads/"+uploadID, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.cancelActiveUpload, req, gin.Param{Key: "upload_id", Value: uploadID}).Code
+	}
+	if code := cancel(stuck); code != http.StatusOK {
+		t.Fatalf("cancel: got %d", code)
+	}
+	if code := cancel(stuck); code != http.StatusNotFound {
+		t.Errorf("cancel twice: got %d, want 404", code)
+	}
+	if _, uploads := list(`{}`); len(uploads) != 1 || uploads[0].UploadID != busy {
+		t.Errorf("after cancel: %+v", uploads)
+	}
+
+	// Another instance still holding the session in memory no longer finds it
+	ts.chunkManager.uploads.Store(stuck, &ChunkUpload{UploadID: stuck})
+	if upload, _ := ts.chunkManager.loadUpload(stuck); upload != nil {
+		t.Error("cancelled session still loads")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Operations shared by the REST handlers, the gRPC server and the drop folder don't write
+// responses themselves. They return an *apiError with the status and body of the REST
+// response instead, which handlers write with respond and the other callers turn into
+// their own errors.
+
+// apiError is a refused or failed operation, as the REST API answers it
+type apiError struct {
+	status     int
+	body       gin.H
+	code       string        // Error code of a response to retry later
+	retryAfter time.Duration // Suggested backoff, or 0
+}
+
+// newAPIError returns an error answered with status and message
+func newAPIError(status int, message string) *apiError {
+	return &apiError{status: status, body: gin.H{"error": message}}
+}
+
+// retryLaterError returns an error answered like respondRetryLater
+func retryLaterError(status int, code string, delay time.Duration, body gin.H) *apiError {
+	return &apiError{status: status, body: body, code: code, retryAfter: delay}
+}
+
+// Error returns the error message of the response, with its explanation if it has one
+func (e *apiError) Error() string {
+	message, _ := e.body["error"].(string)
+	if message == "" {
+		message = http.StatusText(e.status)
+	}
+	if detail, _ := e.body["message"].(string); detail != "" {
+		message += ": " + detail
+	}
+	return message
+}
+
+// respond writes the error response
+func (e *apiError) respond(c *gin.Context) {
+	if e.retryAfter > 0 {
+		respondRetryLater(c, e.status, e.code, e.retryAfter, e.body)
+		return
+	}
+	c.JSON(e.status, e.body)
+}
+
+// caller is who a shared operation runs for: the API key that authenticated the client,
+// if any, and the address it is accounted by
+type caller struct {
+	apiKey    *APIKeyStorage
+	clientIP  string
+	userAgent string
+}
+
+// callerFrom returns the caller of a request
+func callerFrom(c *gin.Context) caller {
+	return caller{apiKey: apiKeyFromContext(c), clientIP: c.ClientIP(), userAgent: c.Request.UserAgent()}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyContextKey is the gin context key holding the authenticated *APIKeyStorage
+const apiKeyContextKey = "apiKey"
+
+// generateAPIKey returns a new random API key secret
+func generateAPIKey() string {
+	return "one_" + files.GeneratePassword() + files.GeneratePassword() + files.GeneratePassword()
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 hash stored for an API key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyFromContext returns the API key that authenticated the request, if any
+func apiKeyFromContext(c *gin.Context) *APIKeyStorage {
+	value, exists := c.Get(apiKeyContextKey)
+	if !exists {
+		return nil
+	}
+	key, _ := value.(*APIKeyStorage)
+	return key
+}
+
+// apiKeyMiddleware authenticates requests carrying an X-API-Key header, or else a verified
+// client certificate mapped to an API key, and enforces the per-key rate limit. Requests
+// with neither pass through.
+func apiKeyMiddleware(s *FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, err := s.authenticateAPIKey(c.GetHeader(apiKeyHeader), clientCertIdentities(c.Request.TLS))
+		if err != nil {
+			err.respond(c)
+			c.Abort()
+			return
+		}
+		if key == nil || s.admitAPIKey(c, key) {
+			c.Next()
+		}
+	}
+}
+
+// authenticateAPIKey returns the active API key of a raw key, or else of the identities
+// of a verified client certificate. It returns nil when the client sent neither.
+func (s *FileService) authenticateAPIKey(rawKey string, identities []string) (*APIKeyStorage, *apiError) {
+	var key *APIKeyStorage
+	var err error
+	switch {
+	case rawKey != "":
+		key, err = s.db.GetAPIKeyByHash(hashAPIKey(rawKey))
+	case len(identities) > 0:
+		key, err = s.db.GetAPIKeyByCertIdentity(identities)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Failed to look up API key: %v", err)
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to validate API key")
+	}
+
+	if rawKey == "" && (key == nil || !key.IsActive()) {
+		return nil, &apiError{status: http.StatusUnauthorized, body: gin.H{
+			"error":   "Unknown client certificate",
+			"message": "The client certificate is not mapped to an active API key",
+		}}
+	}
+	if key == nil || !key.IsActive() {
+		return nil, &apiError{status: http.StatusUnauthorized, body: gin.H{
+			"error":   "Invalid API key",
+			"message": "The provided API key is unknown, expired or revoked",
+		}}
+	}
+	return key, nil
+}
+
+// admitAPIKey counts a request against the per-key rate limit and, within the limit,
+// authenticates it as the key. Otherwise it writes the error response and returns false.
+func (s *FileService) admitAPIKey(c *gin.Context, key *APIKeyStorage) bool {
+	remaining, err := s.chargeAPIKey(key)
+	if remaining >= 0 {
+		c.Header("X-RateLimit-Limit", strconv.Itoa(key.RateLimit))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	}
+	if err != nil {
+		err.respond(c)
+		return false
+	}
+
+	c.Set(apiKeyContextKey, key)
+	return true
+}
+
+// chargeAPIKey counts a call against the per-key rate limit, returning the calls left in
+// the window, or -1 when the counter is unavailable. Calls within the limit are metered.
+func (s *FileService) chargeAPIKey(key *APIKeyStorage) (int64, *apiError) {
+	// Fixed one-minute window counter shared across instances via Redis
+	ctx := context.Background()
+	window := time.Now().Unix() / 60
+	counterKey := apiKeyRateLimitKey(key.ID, window)
+	count, err := s.redis.Incr(ctx, counterKey).Result()
+	if err != nil {
+		// Fail closed: without the counter the key's limit can't be enforced
+		log.Printf("Failed to update API key rate limit counter: %v", err)
+		return -1, retryLaterError(http.StatusServiceUnavailable, errorCodeDependencyUnavailable, retryAfterDependency, gin.H{
+			"error": "Rate limiter unavailable. Please try again later.",
+		})
+	}
+	if count == 1 {
+		s.redis.Expire(ctx, counterKey, time.Minute)
+	}
+
+	remaining := int64(key.RateLimit) - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	if key.RateLimit > 0 && count > int64(key.RateLimit) {
+		windowEnd := time.Unix((window+1)*60, 0)
+		return remaining, retryLaterError(http.StatusTooManyRequests, errorCodeRateLimited, time.Until(windowEnd), gin.H{
+			"error": "API key rate limit exceeded. Please try again later.",
+		})
+	}
+
+	go func(keyID string) {
+		if err := s.db.TouchAPIKey(keyID); err != nil {
+			log.Printf("%v", err)
+		}
+	}(key.ID)
+
+	s.meter(key.ID, meteringAPICalls, 1)
+	return remaining, nil
+}
+
+type APIKeyRequest struct {
+	Name       string `json:"name"`
+	RateLimit  *int   `json:"rate_limit,omitempty"`
+	QuotaBytes *int64 `json:"quota_bytes,omitempty"`
+	QuotaFiles *int   `json:"quota_files,omitempty"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+
+	// Bytes the key may download per month; 0 means unlimited
+	EgressQuotaBytes *int64 `json:"egress_quota_bytes,omitempty"`
+
+	// Storage classes the key may request; an empty list allows all classes
+	StorageClasses *[]string `json:"storage_classes,omitempty"`
+
+	// Client certificate identity that authenticates as the key; empty removes the mapping
+	ClientCertIdentity *string `json:"client_cert_identity,omitempty"`
+
+	// Organization the key is a member of, and its role there; an empty org_id leaves the org
+	OrgID   *string `json:"org_id,omitempty"`
+	OrgRole string  `json:"org_role,omitempty"`
+}
+
+// applyTo copies the optional settings of the request onto an API key
+func (req *APIKeyRequest) applyTo(key *APIKeyStorage) error {
+	if req.Name != "" {
+		key.Name = req.Name
+	}
+	if req.RateLimit != nil {
+		if *req.RateLimit < 0 {
+			return fmt.Errorf("rate_limit must not be negative")
+		}
+		key.RateLimit = *req.RateLimit
+	}
+	if req.QuotaBytes != nil {
+		if *req.QuotaBytes < 0 {
+			return fmt.Errorf("quota_bytes must not be negative")
+		}
+		key.QuotaBytes = *req.QuotaBytes
+	}
+	if req.QuotaFiles != nil {
+		if *req.QuotaFiles < 0 {
+			return fmt.Errorf("quota_files must not be negative")
+		}
+		key.QuotaFiles = *req.QuotaFiles
+	}
+	if req.EgressQuotaBytes != nil {
+		if *req.EgressQuotaBytes < 0 {
+			return fmt.Errorf("egress_quota_bytes must not be negative")
+		}
+		key.EgressQuotaBytes = *req.EgressQuotaBytes
+	}
+	if req.StorageClasses != nil {
+		for _, name := range *req.StorageClasses {
+			if _, ok := parseStorageClass(name); !ok {
+				return fmt.Errorf("unknown storage class %q", name)
+			}
+		}
+		key.StorageClasses = strings.Join(*req.StorageClasses, ",")
+	}
+	if req.ClientCertIdentity != nil {
+		if identity := strings.TrimSpace(*req.ClientCertIdentity); identity != "" {
+			key.ClientCertIdentity = &identity
+		} else {
+			key.ClientCertIdentity = nil
+		}
+	}
+	if req.OrgID != nil {
+		if orgID := strings.TrimSpace(*req.OrgID); orgID != "" {
+			key.OrgID = &orgID
+		} else {
+			key.OrgID = nil
+		}
+	}
+	if req.OrgRole != "" {
+		if req.OrgRole != orgRoleMember && req.OrgRole != orgRoleAdmin {
+			return fmt.Errorf("org_role must be %q or %q", orgRoleMember, orgRoleAdmin)
+		}
+		key.OrgRole = req.OrgRole
+	}
+	if req.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("expires_at must use RFC3339 format")
+		}
+		key.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// requireDownloadAccess checks the download password of a protected file, or an admin
+// token in its place, writing the error response and returning false when neither is
+// given. Files without a download password are always accessible.
+func (s *FileService) requireDownloadAccess(c *gin.Context, hasPassword bool, storedPassword *string) bool {
+	creds := files.Credentials{Password: c.Query("password"), AdminToken: adminTokenFrom(c)}
+	if err := s.downloadAccessError(hasPassword, storedPassword, creds); err != nil {
+		err.respond(c)
+		return false
+	}
+	return true
+}
+
+// downloadAccessError is requireDownloadAccess for the given credentials, returning the
+// error instead of writing it
+func (s *FileService) downloadAccessError(hasPassword bool, storedPassword *string, creds files.Credentials) *apiError {
+	if files.CanDownload(hasPassword, storedPassword, creds, s.adminTokens) {
+		return nil
+	}
+	return &apiError{status: http.StatusUnauthorized, body: gin.H{
+		"error":   "Password required",
+		"message": "This file is password protected. Please provide the correct password.",
+	}}
+}
+
+// createAPIKey issues a new API key. The key itself is only returned in this response.
+//
+// @summary Create an API key
+// @tags admin
+// @body json APIKeyRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) createAPIKey(c *gin.Context) {
+	var req APIKeyRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	rawKey := generateAPIKey()
+	key := &APIKeyStorage{
+		ID:        generateID(),
+		KeyPrefix: rawKey[:8], // "one_" plus 4 characters of the secret
+		KeyHash:   hashAPIKey(rawKey),
+		RateLimit: s.config.APIKeyDefaultRateLimit,
+		OrgRole:   orgRoleMember,
+	}
+	if err := req.applyTo(key); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkKeyOrg(c, key) {
+		return
+	}
+
+	if err := s.db.CreateAPIKey(key); err != nil {
+		log.Printf("Failed to create API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	// The raw key is only ever returned once
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key created successfully",
+		"key":     rawKey,
+		"api_key": key,
+	})
+}
+
+// listAPIKeys lists the API keys with their limits and usage, without the keys themselves
+//
+// @summary List API keys
+// @tags admin
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) listAPIKeys(c *gin.Context) {
+	keys, err := s.db.ListAPIKeys()
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":    len(keys),
+		"api_keys": keys,
+	})
+}
+
+// updateAPIKey changes the name, limits and org of an API key
+//
+// @summary Change an API key
+// @tags admin
+// @path id API key ID
+// @body json APIKeyRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) updateAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+
+	var req APIKeyRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	key, err := s.db.GetAPIKey(keyID)
+	if err != nil {
+		log.Printf("Failed to get API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if key == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	if err := req.applyTo(key); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkKeyOrg(c, key) {
+		return
+	}
+
+	if err := s.db.UpdateAPIKey(key); err != nil {
+		log.Printf("Failed to update API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key updated successfully",
+		"api_key": key,
+	})
+}
+
+// revokeAPIKey revokes an API key; requests with it are rejected from then on
+//
+// @summary Revoke an API key
+// @tags admin
+// @path id API key ID
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) revokeAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+
+	if err := s.db.RevokeAPIKey(keyID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key revoked successfully",
+		"id":      keyID,
+	})
+}
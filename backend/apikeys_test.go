@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	ts := newTestService(t)
+	// The counter window is the wall-clock minute, so don't straddle two
+	if now := time.Now(); now.Second() >= 58 {
+		time.Sleep(time.Duration(60-now.Second()) * time.Second)
+	}
+	rawKey := generateAPIKey()
+	ts.store.CreateAPIKey(&APIKeyStorage{ID: "key-1", KeyHash: hashAPIKey(rawKey), RateLimit: 2})
+	revokedKey := generateAPIKey()
+	revokedAt := ts.clock.Now()
+	ts.store.CreateAPIKey(&APIKeyStorage{ID: "key-2", KeyHash: hashAPIKey(revokedKey), RateLimit: 2, RevokedAt: &revokedAt})
+
+	router := gin.New()
+	router.Use(apiKeyMiddleware(ts.FileService))
+	router.GET("/api/limits", func(c *gin.Context) {
+		if apiKeyFromContext(c) == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.String(http.StatusOK, apiKeyFromContext(c).ID)
+	})
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/limits", nil)
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := request(rawKey)
+		if w.Code != http.StatusOK || w.Body.String() != "key-1" {
+			t.Fatalf("request %d: got %d %q", i+1, w.Code, w.Body.String())
+		}
+		if remaining := w.Header().Get("X-RateLimit-Remaining"); remaining != strconv.Itoa(1-i) || w.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q", i+1, remaining)
+		}
+	}
+	w := request(rawKey)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(errorCodeHeader) != errorCodeRateLimited {
+		t.Fatalf("over the key's limit: got %d with code %q", w.Code, w.Header().Get(errorCodeHeader))
+	}
+	if seconds, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || seconds < 1 || seconds > 60 {
+		t.Errorf("Retry-After = %q", w.Header().Get("Retry-After"))
+	}
+
+	// The counter is shared through Redis, per key and per minute
+	counter := apiKeyRateLimitKey("key-1", time.Now().Unix()/60)
+	if count, _ := ts.redis.Get(context.Background(), counter).Result(); count != "3" {
+		t.Errorf("counter = %q, want 3", count)
+	}
+
+	if w := request(""); w.Code != http.StatusNoContent {
+		t.Errorf("anonymous request: got %d", w.Code)
+	}
+	for _, key := range []string{revokedKey, "one_unknown"} {
+		if w := request(key); w.Code != http.StatusUnauthorized {
+			t.Errorf("key %.8s: got %d, want 401", key, w.Code)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"file-storage-service/internal/files"
+)
+
+const (
+	AppendStateOpen      = "open"
+	AppendStateFinalized = "finalized"
+)
+
+// releaseAppendLockScript deletes the lock only if it is still held by the same token,
+// so a lock that expired and was taken over is not released by its previous holder
+var releaseAppendLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// lockAppendFile serializes appends to the same file across all instances with a Redis
+// lock. It waits briefly for a concurrent append and returns false if the lock stays held.
+func (s *FileService) lockAppendFile(fileID string) (release func(), ok bool) {
+	ctx := context.Background()
+	lockKey := "append_lock:" + fileID
+	token := generateID()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		// The TTL frees the lock if this instance dies mid-append
+		acquired, err := s.redis.SetNX(ctx, lockKey, token, s.config.RequestTimeout).Result()
+		if err != nil {
+			log.Printf("Failed to acquire append lock for %s: %v", fileID, err)
+			return nil, false
+		}
+		if acquired {
+			return func() {
+				releaseAppendLockScript.Run(ctx, s.redis, []string{lockKey}, token)
+			}, true
+		}
+		if time.Now().After(deadline) {
+			return nil, false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// respondAppendLocked reports that another append to the file is still in progress
+func respondAppendLocked(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "File is busy",
+		"message": "Another append to this file is in progress. Retry once it completes.",
+	})
+}
+
+// isFileOwner reports whether the request proves ownership of the file, either with
+// the delete password (query parameter or X-Delete-Password header) or an API key that
+// may manage it
+func (s *FileService) isFileOwner(c *gin.Context, fileStorage *FileStorage) bool {
+	if canManageFile(apiKeyFromContext(c), fileStorage) {
+		return true
+	}
+
+	providedPassword := c.Query("delete_password")
+	if providedPassword == "" {
+		providedPassword = c.GetHeader("X-Delete-Password")
+	}
+	return providedPassword != "" && providedPassword == fileStorage.DeletePassword
+}
+
+// AppendFileRequest creates an append-mode file
+type AppendFileRequest struct {
+	Filename         string `json:"filename" binding:"required"`
+	DownloadPassword string `json:"download_password,omitempty"`
+	StorageClass     string `json:"storage_class,omitempty"`
+}
+
+// createAppendFile creates an empty disk-backed file that can grow through appendToFile
+//
+// @summary Create an append-mode file
+// @tags append
+// @body json AppendFileRequest
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) createAppendFile(c *gin.Context) {
+	var req AppendFileRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	apiKey := apiKeyFromContext(c)
+	if !s.checkUploadQuota(c, 0) {
+		return
+	}
+
+	// Append files are always stored uncompressed on disk; the class selects the directory
+	storageClass, ok := s.storageClassFromRequest(c, req.StorageClass, apiKey)
+	if !ok {
+		return
+	}
+
+	filename := files.NormalizeName(req.Filename)
+	if !checkExtensionPolicy(c, s.config, filename, 0) {
+		return
+	}
+	if !s.checkOrgPolicy(c, filename, req.DownloadPassword != "") {
+		return
+	}
+	fileID, ok := s.allocateFileID(c)
+	if !ok {
+		return
+	}
+	diskPath, err := storageClassPath(s.config, storageClass, fileID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file on disk"})
+		return
+	}
+	if err := os.WriteFile(diskPath, nil, 0644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file on disk"})
+		return
+	}
+
+	now := s.clock.Now()
+	var zero int64
+	appendState := AppendStateOpen
+	fileStorage := &FileStorage{
+		ID:                  fileID,
+		Filename:            filename,
+		OriginalSize:        0,
+		CompressedSize:      &zero,
+		MimeType:            files.MimeType(filename),
+		CompressionType:     string(CompressionNone),
+		StorageType:         "disk",
+		StoragePath:         &diskPath,
+		UploadTime:          now,
+		ExpiresAt:           now.Add(s.retentionFor(apiKey)),
+		DeletePassword:      files.GeneratePassword(),
+		HasDownloadPassword: req.DownloadPassword != "",
+		AppendState:         &appendState,
+		StorageClass:        string(storageClass),
+	}
+
+	if req.DownloadPassword != "" {
+		fileStorage.DownloadPassword = &req.DownloadPassword
+	}
+
+	if apiKey != nil {
+		fileStorage.APIKeyID = &apiKey.ID
+	}
+	clientIP := c.ClientIP()
+	fileStorage.UploaderIP = &clientIP
+
+	if err := s.db.SaveFile(fileStorage); err != nil {
+		os.Remove(diskPath)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Append file created successfully",
+		"file_id":         fileID,
+		"delete_password": fileStorage.DeletePassword,
+		"offset":          0,
+		"storage_class":   storageClass,
+		"append_url":      "/api/file/" + fileID,
+		"finalize_url":    "/api/file/" + fileID + "/finalize",
+	})
+}
+
+// appendToFile appends the request body to an open append-mode file. The offset query
+// parameter must match the current size, so retried or out-of-order writes are rejected.
+func (s *FileService) appendToFile(c *gin.Context) {
+	fileID := c.Param("id")
+
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset query parameter is required"})
+		return
+	}
+
+	release, ok := s.lockAppendFile(fileID)
+	if !ok {
+		respondAppendLocked(c)
+		return
+	}
+	defer release()
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "Appending requires the file's delete password.",
+		})
+		return
+	}
+
+	if fileStorage.AppendState == nil || *fileStorage.AppendState != AppendStateOpen || fileStorage.StoragePath == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "File is not open for appending"})
+		return
+	}
+
+	if offset != fileStorage.OriginalSize {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Offset mismatch",
+			"message":        "The offset must equal the current file size.",
+			"current_offset": fileStorage.OriginalSize,
+		})
+		return
+	}
+
+	// Appended bytes count against the storage quota like any other upload; bodies of
+	// unknown length are cut off once they would exceed it
+	remainingQuota, ok := s.checkStorageQuota(c, c.Request.ContentLength)
+	if !ok {
+		return
+	}
+	maxSize := s.config.maxFileSizeFor(fileStorage.Filename)
+	remainingSize := maxSize - fileStorage.OriginalSize
+	if remainingQuota >= 0 && remainingQuota < remainingSize {
+		remainingSize = remainingQuota
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, remainingSize)
+
+	diskFile, err := openStoredFile(s.config, *fileStorage.StoragePath, os.O_WRONLY)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file on disk"})
+		return
+	}
+	defer diskFile.Close()
+
+	// Write at the expected offset, discarding any partial write from an earlier failure
+	if err := diskFile.Truncate(offset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare file for appending"})
+		return
+	}
+	if _, err := diskFile.Seek(offset, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to seek file"})
+		return
+	}
+
+	written, err := io.Copy(diskFile, body)
+	if err != nil {
+		diskFile.Truncate(offset)
+		if isBodyTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":          "Append too large",
+				"message":        "The appended data would exceed the maximum file size or your storage quota.",
+				"current_offset": offset,
+				"max_size":       maxSize,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Append interrupted",
+			"message":        "The request body could not be read completely; retry from current_offset.",
+			"current_offset": offset,
+		})
+		return
+	}
+
+	newSize := offset + written
+	if err := s.db.UpdateAppendedFile(fileID, newSize, s.clock.Now().Add(s.fileRetention(fileStorage))); err != nil {
+		diskFile.Truncate(offset)
+		log.Printf("Failed to update appended file %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file"})
+		return
+	}
+
+	s.redis.Del(context.Background(), "file:"+fileID)
+	s.publishAppendEvent(fileID, "append", newSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Data appended successfully",
+		"file_id":  fileID,
+		"appended": written,
+		"offset":   newSize,
+	})
+}
+
+// finalizeAppendFile closes an append-mode file; after this the normal 24-hour expiry applies
+//
+// @summary Close an append-mode file
+// @tags append
+// @path id File ID
+// @success 200 json
+// @auth deletePassword apiKey
+func (s *FileService) finalizeAppendFile(c *gin.Context) {
+	fileID := c.Param("id")
+
+	release, ok := s.lockAppendFile(fileID)
+	if !ok {
+		respondAppendLocked(c)
+		return
+	}
+	defer release()
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "Finalizing requires the file's delete password.",
+		})
+		return
+	}
+
+	expiresAt := s.clock.Now().Add(s.fileRetention(fileStorage))
+	if err := s.db.FinalizeAppendedFile(fileID, expiresAt); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "File is not open for appending"})
+		return
+	}
+
+	s.redis.Del(context.Background(), "file:"+fileID)
+	s.publishAppendEvent(fileID, "finalized", fileStorage.OriginalSize)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "File finalized successfully",
+		"file_id":    fileID,
+		"size":       fileStorage.OriginalSize,
+		"expires_at": expiresAt,
+	})
+}
+
+// publishAppendEvent notifies tail listeners on any instance that an append-mode file changed
+func (s *FileService) publishAppendEvent(fileID, event string, size int64) {
+	payload, _ := json.Marshal(map[string]interface{}{"event": event, "size": size})
+	if err := s.redis.Publish(context.Background(), "append:"+fileID, payload).Err(); err != nil {
+		log.Printf("Failed to publish %s event for %s: %v", event, fileID, err)
+	}
+}
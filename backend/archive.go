@@ -0,0 +1,503 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+
+	"file-storage-service/internal/files"
+)
+
+// maxArchiveEntrySize limits how large an entry extractArchiveFile decompresses into
+// memory, since a tiny archive can declare entries of many gigabytes
+const maxArchiveEntrySize = maxRenderSize
+
+// archiveFormat is a container format the archive endpoints can list and extract from
+type archiveFormat string
+
+const (
+	archiveZip     archiveFormat = "zip"
+	archiveTar     archiveFormat = "tar"
+	archiveTarGzip archiveFormat = "tar.gz"
+	archiveTarZstd archiveFormat = "tar.zst"
+)
+
+// archiveFormats lists the supported formats, as advertised in capabilities
+var archiveFormats = []archiveFormat{archiveZip, archiveTar, archiveTarGzip, archiveTarZstd}
+
+// detectArchiveFormat tells the archive format from a filename, or "" for anything else
+func detectArchiveFormat(filename string) archiveFormat {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGzip
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return archiveTarZstd
+	}
+	return ""
+}
+
+// ArchiveEntry describes one entry of an archive. Index is its position in the listing,
+// which identifies it even when names repeat or can't be decoded. Tar entries aren't
+// compressed one by one, so their compressed size is their size and their method is 0.
+type ArchiveEntry struct {
+	Index      int       `json:"index"`
+	Name       string    `json:"name"`
+	Size       uint64    `json:"size"`
+	Compressed uint64    `json:"compressed"`
+	Modified   time.Time `json:"modified"`
+	IsDir      bool      `json:"is_dir"`
+	Method     uint16    `json:"method"`
+}
+
+var errArchiveEntryNotFound = errors.New("entry not found in archive")
+
+// archiveReader lists and opens the entries of an archive
+type archiveReader interface {
+	Entries() ([]ArchiveEntry, error)
+	// Open returns the first entry matching name and a reader of its content, or
+	// errArchiveEntryNotFound. Directories come without a reader.
+	Open(name string) (ArchiveEntry, io.ReadCloser, error)
+	// OpenIndex is Open for the entry at a position of the listing
+	OpenIndex(index int) (ArchiveEntry, io.ReadCloser, error)
+	// CopyTo adds the selected entries to a ZIP being written, in archive order
+	CopyTo(w *zip.Writer, selected func(ArchiveEntry) bool) error
+}
+
+// openArchive reads an archive of size bytes from source. Only the parts of it that are
+// needed are read, so a disk-stored archive is never loaded into memory as a whole.
+func openArchive(source io.ReaderAt, size int64, format archiveFormat) (archiveReader, error) {
+	if format == archiveZip {
+		zipReader, err := zip.NewReader(source, size)
+		if err != nil {
+			return nil, err
+		}
+		return zipArchive{zipReader}, nil
+	}
+	archive := tarArchive{source: source, size: size, format: format}
+	// Fail early on a stream that isn't in the format its name says
+	_, closer, err := archive.reader()
+	if err != nil {
+		return nil, err
+	}
+	closer()
+	return archive, nil
+}
+
+type zipArchive struct {
+	reader *zip.Reader
+}
+
+func (a zipArchive) Entries() ([]ArchiveEntry, error) {
+	return listZipEntries(a.reader), nil
+}
+
+func (a zipArchive) Open(name string) (ArchiveEntry, io.ReadCloser, error) {
+	for index, file := range a.reader.File {
+		if files.DecodeArchiveName(file.Name) == name || file.Name == name {
+			return a.OpenIndex(index)
+		}
+	}
+	return ArchiveEntry{}, nil, errArchiveEntryNotFound
+}
+
+func (a zipArchive) OpenIndex(index int) (ArchiveEntry, io.ReadCloser, error) {
+	if index < 0 || index >= len(a.reader.File) {
+		return ArchiveEntry{}, nil, errArchiveEntryNotFound
+	}
+	file := a.reader.File[index]
+	entry := zipEntry(index, file)
+	if entry.IsDir {
+		return entry, nil, nil
+	}
+	rc, err := file.Open()
+	return entry, rc, err
+}
+
+// zipEntry describes a file of a ZIP central directory, decoding legacy filename encodings
+func zipEntry(index int, file *zip.File) ArchiveEntry {
+	return ArchiveEntry{
+		Index:      index,
+		Name:       files.DecodeArchiveName(file.Name),
+		Size:       file.UncompressedSize64,
+		Compressed: file.CompressedSize64,
+		Modified:   file.Modified,
+		IsDir:      file.FileInfo().IsDir(),
+		Method:     file.Method,
+	}
+}
+
+// listZipEntries lists the entries of a ZIP archive
+func listZipEntries(zipReader *zip.Reader) []ArchiveEntry {
+	var entries []ArchiveEntry
+	for index, file := range zipReader.File {
+		entries = append(entries, zipEntry(index, file))
+	}
+	return entries
+}
+
+// tarArchive is a tar stream, optionally gzip or zstd compressed as a whole. Tar has no
+// index, so listing and extracting both read the stream from the start.
+type tarArchive struct {
+	source io.ReaderAt
+	size   int64
+	format archiveFormat
+}
+
+// reader starts a fresh pass over the archive; closer releases the decompressor
+func (a tarArchive) reader() (*tar.Reader, func(), error) {
+	var source io.Reader = io.NewSectionReader(a.source, 0, a.size)
+	closer := func() {}
+	switch a.format {
+	case archiveTarGzip:
+		gzReader, err := gzip.NewReader(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		source, closer = gzReader, func() { gzReader.Close() }
+	case archiveTarZstd:
+		decoder, err := zstd.NewReader(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		source, closer = decoder, decoder.Close
+	}
+	return tar.NewReader(source), closer, nil
+}
+
+// nextTarEntry advances to the next regular file or directory; links, devices and the like
+// can't be extracted and are skipped
+func nextTarEntry(tarReader *tar.Reader) (*tar.Header, error) {
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeDir {
+			return header, nil
+		}
+	}
+}
+
+func tarEntry(index int, header *tar.Header) ArchiveEntry {
+	size := uint64(0)
+	if header.Size > 0 {
+		size = uint64(header.Size)
+	}
+	return ArchiveEntry{
+		Index:      index,
+		Name:       files.DecodeArchiveName(header.Name),
+		Size:       size,
+		Compressed: size,
+		Modified:   header.ModTime,
+		IsDir:      header.Typeflag == tar.TypeDir,
+	}
+}
+
+func (a tarArchive) Entries() ([]ArchiveEntry, error) {
+	tarReader, closer, err := a.reader()
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+
+	var entries []ArchiveEntry
+	for {
+		header, err := nextTarEntry(tarReader)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, tarEntry(len(entries), header))
+	}
+}
+
+func (a tarArchive) Open(name string) (ArchiveEntry, io.ReadCloser, error) {
+	return a.open(func(entry ArchiveEntry, header *tar.Header) bool {
+		return entry.Name == name || header.Name == name
+	})
+}
+
+func (a tarArchive) OpenIndex(index int) (ArchiveEntry, io.ReadCloser, error) {
+	if index < 0 {
+		return ArchiveEntry{}, nil, errArchiveEntryNotFound
+	}
+	return a.open(func(entry ArchiveEntry, header *tar.Header) bool {
+		return entry.Index == index
+	})
+}
+
+// open reads up to the first entry match accepts
+func (a tarArchive) open(match func(ArchiveEntry, *tar.Header) bool) (ArchiveEntry, io.ReadCloser, error) {
+	tarReader, closer, err := a.reader()
+	if err != nil {
+		return ArchiveEntry{}, nil, err
+	}
+	for index := 0; ; index++ {
+		header, err := nextTarEntry(tarReader)
+		if err == io.EOF {
+			closer()
+			return ArchiveEntry{}, nil, errArchiveEntryNotFound
+		}
+		if err != nil {
+			closer()
+			return ArchiveEntry{}, nil, err
+		}
+		entry := tarEntry(index, header)
+		if !match(entry, header) {
+			continue
+		}
+		if entry.IsDir {
+			closer()
+			return entry, nil, nil
+		}
+		return entry, tarEntryReader{tarReader, closer}, nil
+	}
+}
+
+// tarEntryReader reads the current entry of a tar stream and releases the stream on Close
+type tarEntryReader struct {
+	*tar.Reader
+	closer func()
+}
+
+func (r tarEntryReader) Close() error {
+	r.closer()
+	return nil
+}
+
+// storedArchive is an archive file opened for browsing
+type storedArchive struct {
+	file   *FileStorage
+	format archiveFormat
+	archiveReader
+	// close releases the underlying file, if any
+	close func()
+}
+
+// archiveSource gives random access to a stored archive's uncompressed bytes. An
+// uncompressed disk-stored file is read in place; anything else has to be decompressed
+// into memory first.
+func (s *FileService) archiveSource(fileStorage *FileStorage) (io.ReaderAt, int64, func(), error) {
+	compression := CompressionType(fileStorage.CompressionType)
+	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil && (compression == CompressionNone || compression == "") {
+		file, err := openStoredFile(s.config, *fileStorage.StoragePath, os.O_RDONLY)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, 0, nil, err
+		}
+		return file, info.Size(), func() { file.Close() }, nil
+	}
+
+	content, err := s.loadFileContent(fileStorage, FileMetadata{Compression: compression})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return bytes.NewReader(content), int64(len(content)), func() {}, nil
+}
+
+// loadArchive looks up an archive file the request may download and opens it, answering
+// the request itself when that fails. The caller closes the archive when ok.
+func (s *FileService) loadArchive(c *gin.Context, fileID string) (*storedArchive, bool) {
+	fileStorage, err := s.lookupFile(fileID, true)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return nil, false
+	}
+	if fileStorage.ExpiresAt.Before(s.clock.Now()) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File has expired"})
+		return nil, false
+	}
+	// The entries are the content of the archive, so they need its download password
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return nil, false
+	}
+	if !requireScanCleared(c, fileStorage) {
+		return nil, false
+	}
+
+	format := detectArchiveFormat(fileStorage.Filename)
+	if format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "File is not a supported archive",
+			"formats": archiveFormats,
+		})
+		return nil, false
+	}
+
+	source, size, closer, err := s.archiveSource(fileStorage)
+	if err != nil {
+		log.Printf("Failed to load archive %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file content"})
+		return nil, false
+	}
+
+	reader, err := openArchive(source, size, format)
+	if err != nil {
+		closer()
+		log.Printf("Failed to open %s archive %s: %v", format, fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return nil, false
+	}
+	return &storedArchive{file: fileStorage, format: format, archiveReader: reader, close: closer}, true
+}
+
+// browseArchive lists the entries of a ZIP or tar archive
+//
+// @summary List the entries of an archive
+// @tags archive
+// @path id File ID
+// @success 200 json
+// @auth downloadPassword adminToken optional
+func (s *FileService) browseArchive(c *gin.Context) {
+	archive, ok := s.loadArchive(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	defer archive.close()
+
+	entries, err := archive.Entries()
+	if err != nil {
+		log.Printf("Failed to list %s archive %s: %v", archive.format, archive.file.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"filename": archive.file.Filename,
+		"format":   archive.format,
+		"files":    entries,
+		"total":    len(entries),
+	})
+}
+
+// extractArchiveFile previews a single entry of a ZIP or tar archive
+//
+// @summary Extract an entry of an archive
+// @tags archive
+// @path id File ID
+// @query filename string Name of the entry
+// @query index integer Index of the entry, instead of its name
+// @success 200 application/octet-stream
+// @auth downloadPassword adminToken optional
+func (s *FileService) extractArchiveFile(c *gin.Context) {
+	// Entries are picked by their position in the listing, or by name
+	fileName := c.Query("filename")
+	index := -1
+	if value := c.Query("index"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "index must be a non-negative integer"})
+			return
+		}
+		index = parsed
+	} else if fileName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filename or index parameter is required"})
+		return
+	}
+
+	archive, ok := s.loadArchive(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	defer archive.close()
+
+	var entry ArchiveEntry
+	var rc io.ReadCloser
+	var err error
+	if index >= 0 {
+		entry, rc, err = archive.OpenIndex(index)
+		if errors.Is(err, errArchiveEntryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No entry at this index", "index": index})
+			return
+		}
+		fileName = entry.Name
+	} else {
+		entry, rc, err = archive.Open(fileName)
+	}
+	if errors.Is(err, errArchiveEntryNotFound) {
+		// List what is there to help clients with mangled names
+		var availableFiles []string
+		if entries, err := archive.Entries(); err == nil {
+			for _, entry := range entries {
+				availableFiles = append(availableFiles, entry.Name)
+			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":           "File not found in archive",
+			"requested_file":  fileName,
+			"available_files": availableFiles,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to open %s in %s archive %s: %v", fileName, archive.format, archive.file.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file from archive"})
+		return
+	}
+	if entry.IsDir {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot preview directory"})
+		return
+	}
+	defer rc.Close()
+
+	if entry.Size > maxArchiveEntrySize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large to preview",
+			"max_size": maxArchiveEntrySize,
+		})
+		return
+	}
+
+	// archive/zip rejects entries that inflate past their declared size and tar entries
+	// can't exceed theirs, the limit only guards against those checks ever being bypassed
+	fileContent, err := io.ReadAll(io.LimitReader(rc, maxArchiveEntrySize))
+	if err != nil {
+		log.Printf("Failed to read %s from archive %s: %v", fileName, archive.file.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file content"})
+		return
+	}
+
+	mimeType := files.MimeType(entry.Name)
+	if !files.IsPreviewable(mimeType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":     "File type not previewable",
+			"message":   "This file type cannot be previewed in the browser.",
+			"mime_type": mimeType,
+		})
+		return
+	}
+
+	c.Header("Content-Type", mimeType)
+	c.Header("Content-Length", strconv.FormatInt(int64(len(fileContent)), 10))
+	c.Header("Content-Disposition", files.ContentDisposition("inline", entry.Name))
+
+	c.Data(http.StatusOK, mimeType, fileContent)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+func zipFixture(t testing.TB, names ...string) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, NonUTF8: !utf8.ValidString(name)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("content of " + name))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func FuzzZipEntries(f *testing.F) {
+	f.Add(zipFixture(f, "readme.txt", "docs/", "docs/guide.md"))
+	f.Add(zipFixture(f, "\x83e\x83X\x83g.txt"))
+	f.Add(zipFixture(f))
+	f.Add([]byte("PK\x05\x06"))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return
+		}
+		entries := listZipEntries(zipReader)
+		if len(entries) != len(zipReader.File) {
+			t.Fatalf("listed %d entries, archive has %d", len(entries), len(zipReader.File))
+		}
+		archive := zipArchive{zipReader}
+		for _, entry := range entries {
+			if !utf8.ValidString(entry.Name) {
+				t.Fatalf("entry name %q is not valid UTF-8", entry.Name)
+			}
+			if found, rc, err := archive.Open(entry.Name); err != nil {
+				if errors.Is(err, errArchiveEntryNotFound) {
+					t.Fatalf("listed entry %q cannot be found", entry.Name)
+				}
+			} else if found.Name != entry.Name {
+				t.Fatalf("entry %q opened as %q", entry.Name, found.Name)
+			} else if rc != nil {
+				rc.Close()
+			}
+			if entry.IsDir || entry.Size > 1<<20 {
+				continue
+			}
+			_, rc, err := archive.OpenIndex(entry.Index)
+			if err != nil {
+				continue
+			}
+			io.Copy(io.Discard, io.LimitReader(rc, maxArchiveEntrySize))
+			rc.Close()
+		}
+	})
+}
+
+// tarFixture builds a tar archive with a directory, a file inside it and a symlink
+func tarFixture(t *testing.T, format archiveFormat) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var out io.WriteCloser = nopWriteCloser{&buf}
+	switch format {
+	case archiveTarGzip:
+		out = gzip.NewWriter(&buf)
+	case archiveTarZstd:
+		encoder, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = encoder
+	}
+
+	writer := tar.NewWriter(out)
+	content := []byte("hello from the archive")
+	headers := []*tar.Header{
+		{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "docs/readme.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "docs/readme.txt"},
+	}
+	for _, header := range headers {
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			writer.Write(content)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestDetectArchiveFormat(t *testing.T) {
+	cases := map[string]archiveFormat{
+		"photos.ZIP":       archiveZip,
+		"backup.tar":       archiveTar,
+		"backup.tar.gz":    archiveTarGzip,
+		"backup.tgz":       archiveTarGzip,
+		"backup.tar.zst":   archiveTarZstd,
+		"backup.tzst":      archiveTarZstd,
+		"access.log.gz":    "",
+		"notes.txt":        "",
+		"tarball-name.txt": "",
+	}
+	for name, want := range cases {
+		if got := detectArchiveFormat(name); got != want {
+			t.Errorf("detectArchiveFormat(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestTarArchiveBrowsing(t *testing.T) {
+	ts := newTestService(t)
+	for _, format := range []archiveFormat{archiveTar, archiveTarGzip, archiveTarZstd} {
+		id := "archive-" + string(format)
+		content := tarFixture(t, format)
+		size := int64(len(content))
+		now := ts.clock.Now()
+		err := ts.store.SaveFile(&FileStorage{
+			ID:              id,
+			Filename:        "backup." + string(format),
+			OriginalSize:    size,
+			CompressedSize:  &size,
+			MimeType:        "application/octet-stream",
+			CompressionType: string(CompressionNone),
+			StorageType:     "postgresql",
+			FileContent:     content,
+			UploadTime:      now,
+			ExpiresAt:       now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		param := gin.Param{Key: "id", Value: id}
+
+		w := ts.serve(ts.browseArchive, httptest.NewRequest(http.MethodGet, "/api/archive/"+id, nil), param)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: browse got %d: %s", format, w.Code, w.Body.String())
+		}
+		var listing struct {
+			Format string         `json:"format"`
+			Files  []ArchiveEntry `json:"files"`
+			Total  int            `json:"total"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+			t.Fatal(err)
+		}
+		// The symlink can't be extracted, so it isn't listed
+		if listing.Format != string(format) || listing.Total != 2 {
+			t.Fatalf("%s: listed %+v", format, listing)
+		}
+		if !listing.Files[0].IsDir || listing.Files[1].Name != "docs/readme.txt" || listing.Files[1].Size != 22 {
+			t.Errorf("%s: unexpected entries %+v", format, listing.Files)
+		}
+
+		w = ts.serve(ts.extractArchiveFile, httptest.NewRequest(http.MethodGet, "/api/archive/"+id+"/extract?filename=docs/readme.txt", nil), param)
+		if w.Code != http.StatusOK || w.Body.String() != "hello from the archive" {
+			t.Errorf("%s: extract got %d %q", format, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/plain" {
+			t.Errorf("%s: extract Content-Type %q", format, got)
+		}
+
+		w = ts.serve(ts.extractArchiveFile, httptest.NewRequest(http.MethodGet, "/api/archive/"+id+"/extract?filename=docs/", nil), param)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: extracting a directory got %d, want 400", format, w.Code)
+		}
+		w = ts.serve(ts.extractArchiveFile, httptest.NewRequest(http.MethodGet, "/api/archive/"+id+"/extract?filename=missing.txt", nil), param)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: extracting a missing entry got %d, want 404", format, w.Code)
+		}
+	}
+}
+
+func TestDiskArchiveReadInPlace(t *testing.T) {
+	ts := newTestService(t)
+	content := zipFixture(t, "docs/readme.txt", "notes.txt")
+	stored := saveRangeTestFile(t, ts, "disk-zip", "disk", CompressionNone, content)
+	stored.Filename = "bundle.zip"
+	if err := ts.store.SaveFile(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	// An uncompressed file on disk is opened rather than read into memory
+	source, size, closer, err := ts.archiveSource(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := source.(*os.File); !ok || size != int64(len(content)) {
+		t.Errorf("archive source is %T of %d bytes, want the stored file of %d bytes", source, size, len(content))
+	}
+	closer()
+
+	param := gin.Param{Key: "id", Value: stored.ID}
+	w := ts.serve(ts.browseArchive, httptest.NewRequest(http.MethodGet, "/api/archive/disk-zip", nil), param)
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"total":2`)) {
+		t.Fatalf("browse got %d: %s", w.Code, w.Body.String())
+	}
+	w = ts.serve(ts.extractArchiveFile, httptest.NewRequest(http.MethodGet, "/api/archive/disk-zip/extract?filename=notes.txt", nil), param)
+	if w.Code != http.StatusOK || w.Body.String() != "content of notes.txt" {
+		t.Fatalf("extract got %d %q", w.Code, w.Body.String())
+	}
+
+	// Compressed storage has no random access, so it is decompressed first
+	compressed := saveRangeTestFile(t, ts, "disk-zip-gzip", "disk", CompressionGzip, content)
+	source, _, closer, err = ts.archiveSource(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer()
+	if _, ok := source.(*bytes.Reader); !ok {
+		t.Errorf("compressed archive source is %T, want an in-memory reader", source)
+	}
+}
+
+func TestTarArchivePasswordProtected(t *testing.T) {
+	ts := newTestService(t)
+	param := saveArchiveTestFile(t, ts, "locked", "locked.tar.gz", tarFixture(t, archiveTarGzip))
+	stored, _ := ts.store.GetFile("locked")
+	password := "hunter2"
+	stored.HasDownloadPassword = true
+	stored.DownloadPassword = &password
+	ts.store.SaveFile(stored)
+
+	for path, handler := range map[string]gin.HandlerFunc{
+		"/api/archive/locked": ts.browseArchive,
+		"/api/archive/locked/extract?filename=docs/readme.txt": ts.extractArchiveFile,
+	} {
+		if w := ts.serve(handler, httptest.NewRequest(http.MethodGet, path, nil), param); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without the password: got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+
+	w := ts.serve(ts.extractArchiveFile, httptest.NewRequest(http.MethodGet, "/api/archive/locked/extract?filename=docs/readme.txt&password="+password, nil), param)
+	if w.Code != http.StatusOK || w.Body.String() != "hello from the archive" {
+		t.Errorf("extract with the password: got %d %q", w.Code, w.Body.String())
+	}
+}
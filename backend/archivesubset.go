@@ -0,0 +1,215 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// maxArchiveSubsetSelectors bounds the paths and indexes one subset download may name
+const maxArchiveSubsetSelectors = 10000
+
+// ArchiveSubsetRequest selects archive entries by path, where a directory path selects
+// everything below it, or by listing index
+type ArchiveSubsetRequest struct {
+	Paths   []string `json:"paths"`
+	Indexes []int    `json:"indexes"`
+}
+
+// selector returns the predicate picking the requested entries
+func (req *ArchiveSubsetRequest) selector() func(ArchiveEntry) bool {
+	exact := make(map[string]bool)
+	var prefixes []string
+	for _, p := range req.Paths {
+		normalized := strings.Join(archivePathSegments(p), "/")
+		if normalized == "" {
+			continue
+		}
+		exact[normalized] = true
+		prefixes = append(prefixes, normalized+"/")
+	}
+	indexes := make(map[int]bool)
+	for _, index := range req.Indexes {
+		indexes[index] = true
+	}
+
+	return func(entry ArchiveEntry) bool {
+		if indexes[entry.Index] {
+			return true
+		}
+		name := strings.Join(archivePathSegments(entry.Name), "/")
+		if exact[name] {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// subsetEntryName is the name an entry gets in the new ZIP: its decoded name without
+// leading slashes or "." segments, so extracting it stays inside the target directory
+func subsetEntryName(entry ArchiveEntry) string {
+	name := strings.Join(archivePathSegments(entry.Name), "/")
+	if entry.IsDir && name != "" {
+		name += "/"
+	}
+	return name
+}
+
+// unsafeSubsetEntry reports entries that would escape the extraction directory
+func unsafeSubsetEntry(entry ArchiveEntry) bool {
+	for _, segment := range archivePathSegments(entry.Name) {
+		if segment == ".." {
+			return true
+		}
+	}
+	return subsetEntryName(entry) == ""
+}
+
+func (a zipArchive) CopyTo(w *zip.Writer, selected func(ArchiveEntry) bool) error {
+	for index, file := range a.reader.File {
+		entry := zipEntry(index, file)
+		if !selected(entry) || unsafeSubsetEntry(entry) {
+			continue
+		}
+		// Entries are copied still compressed, so nothing is inflated and deflated again
+		header := file.FileHeader
+		header.Name = subsetEntryName(entry)
+		header.NonUTF8 = false
+		header.Extra = nil
+		target, err := w.CreateRaw(&header)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir {
+			continue
+		}
+		raw, err := file.OpenRaw()
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(target, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a tarArchive) CopyTo(w *zip.Writer, selected func(ArchiveEntry) bool) error {
+	tarReader, closer, err := a.reader()
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	for index := 0; ; index++ {
+		header, err := nextTarEntry(tarReader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		entry := tarEntry(index, header)
+		if !selected(entry) || unsafeSubsetEntry(entry) {
+			continue
+		}
+		method := zip.Deflate
+		if entry.IsDir {
+			method = zip.Store
+		}
+		target, err := w.CreateHeader(&zip.FileHeader{
+			Name:     subsetEntryName(entry),
+			Method:   method,
+			Modified: entry.Modified,
+		})
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir {
+			if _, err := io.Copy(target, tarReader); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// downloadArchiveSubset streams a new ZIP holding only the selected entries of an
+// archive, so a folder can be taken out of a large archive in one request
+//
+// @summary Download selected entries of an archive as a ZIP
+// @tags archive
+// @path id File ID
+// @body json ArchiveSubsetRequest
+// @success 200 application/zip
+// @auth downloadPassword adminToken optional
+func (s *FileService) downloadArchiveSubset(c *gin.Context) {
+	var req ArchiveSubsetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if len(req.Paths) == 0 && len(req.Indexes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "paths or indexes is required"})
+		return
+	}
+	if len(req.Paths)+len(req.Indexes) > maxArchiveSubsetSelectors {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d paths and indexes may be selected", maxArchiveSubsetSelectors)})
+		return
+	}
+
+	archive, ok := s.loadArchive(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	defer archive.close()
+
+	entries, err := archive.Entries()
+	if err != nil {
+		log.Printf("Failed to list %s archive %s: %v", archive.format, archive.file.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return
+	}
+	// Check the selection before the first byte is sent, after which errors can't be reported
+	selected := req.selector()
+	matched := 0
+	for _, entry := range entries {
+		if selected(entry) && !unsafeSubsetEntry(entry) {
+			matched++
+		}
+	}
+	if matched == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No entries match the selection"})
+		return
+	}
+
+	base := strings.TrimSuffix(archive.file.Filename, path.Ext(archive.file.Filename))
+	base = strings.TrimSuffix(base, ".tar")
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", files.ContentDisposition("attachment", base+"-selection.zip"))
+	c.Status(http.StatusOK)
+
+	sw := s.newStreamWriter(c, false)
+	defer sw.Close()
+	zipWriter := zip.NewWriter(sw)
+	if err := archive.CopyTo(zipWriter, selected); err != nil {
+		// The status is already sent; a truncated ZIP fails to open on the client
+		log.Printf("Failed to write selection of %s archive %s: %v", archive.format, archive.file.ID, err)
+		return
+	}
+	if err := zipWriter.Close(); err != nil {
+		log.Printf("Failed to finish selection of archive %s: %v", archive.file.ID, err)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readZipEntries returns the names and file contents of a ZIP
+func readZipEntries(t *testing.T, content []byte) map[string]string {
+	t.Helper()
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("response is not a ZIP: %v", err)
+	}
+	entries := make(map[string]string)
+	for _, file := range zipReader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file.Name, err)
+		}
+		entries[file.Name] = string(data)
+	}
+	return entries
+}
+
+func sortedKeys(m map[string]string) string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func saveArchiveTestFile(t *testing.T, ts *testService, id, filename string, content []byte) gin.Param {
+	t.Helper()
+	size := int64(len(content))
+	now := ts.clock.Now()
+	err := ts.store.SaveFile(&FileStorage{
+		ID: id, Filename: filename, OriginalSize: size, CompressedSize: &size,
+		MimeType: "application/octet-stream", CompressionType: string(CompressionNone), StorageType: "postgresql",
+		FileContent: content, UploadTime: now, ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gin.Param{Key: "id", Value: id}
+}
+
+func TestDownloadArchiveSubset(t *testing.T) {
+	ts := newTestService(t)
+	download := func(param gin.Param, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/archive/x/download", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.downloadArchiveSubset, req, param)
+	}
+
+	zipParam := saveArchiveTestFile(t, ts, "bundle", "bundle.zip",
+		zipFixture(t, "docs/", "docs/a.txt", "docs/sub/b.txt", "docs-old.txt", "other.txt", "../evil.txt"))
+
+	w := download(zipParam, `{"paths":["docs/"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("zip folder: got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "bundle-selection.zip") {
+		t.Errorf("Content-Disposition %q", got)
+	}
+	entries := readZipEntries(t, w.Body.Bytes())
+	if got := sortedKeys(entries); got != "docs/,docs/a.txt,docs/sub/b.txt" {
+		t.Errorf("zip folder: entries %s", got)
+	}
+	if entries["docs/sub/b.txt"] != "content of docs/sub/b.txt" {
+		t.Errorf("raw-copied entry content %q", entries["docs/sub/b.txt"])
+	}
+
+	// Entries escaping the extraction directory are never included
+	w = download(zipParam, `{"paths":["other.txt"],"indexes":[5]}`)
+	if got := sortedKeys(readZipEntries(t, w.Body.Bytes())); got != "other.txt" {
+		t.Errorf("zip with unsafe entry: entries %s", got)
+	}
+
+	tarParam := saveArchiveTestFile(t, ts, "backup", "backup.tar.gz", tarFixture(t, archiveTarGzip))
+	w = download(tarParam, `{"indexes":[1]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("tar index: got %d: %s", w.Code, w.Body.String())
+	}
+	entries = readZipEntries(t, w.Body.Bytes())
+	if len(entries) != 1 || entries["docs/readme.txt"] != "hello from the archive" {
+		t.Errorf("tar index: entries %v", entries)
+	}
+
+	for body, status := range map[string]int{
+		`{"paths":["missing/"]}`: http.StatusNotFound,
+		`{}`:                     http.StatusBadRequest,
+		`not json`:               http.StatusBadRequest,
+	} {
+		if w := download(zipParam, body); w.Code != status {
+			t.Errorf("%s: got %d, want %d", body, w.Code, status)
+		}
+	}
+}
+
+func TestDownloadArchiveSubsetPasswordProtected(t *testing.T) {
+	ts := newTestService(t)
+	param := saveArchiveTestFile(t, ts, "secret", "secret.zip", zipFixture(t, "docs/a.txt"))
+	stored, _ := ts.store.GetFile("secret")
+	password := "hunter2"
+	stored.HasDownloadPassword = true
+	stored.DownloadPassword = &password
+	ts.store.SaveFile(stored)
+
+	download := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/archive/secret/download"+query, strings.NewReader(`{"paths":["docs/"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.downloadArchiveSubset, req, param)
+	}
+
+	if w := download(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without the password: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := download("?password=wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("with a wrong password: got %d", w.Code)
+	}
+	w := download("?password=" + password)
+	if w.Code != http.StatusOK {
+		t.Fatalf("with the password: got %d: %s", w.Code, w.Body.String())
+	}
+	if entries := readZipEntries(t, w.Body.Bytes()); entries["docs/a.txt"] == "" {
+		t.Errorf("entries %v", entries)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ArchiveTreeNode is a file or directory of an archive's directory tree. Entry is the
+// listed entry at this path; directories that only appear as a prefix of other
+// entries' names have none. Entries whose names repeat become separate nodes.
+type ArchiveTreeNode struct {
+	Name     string             `json:"name"`
+	Path     string             `json:"path"`
+	IsDir    bool               `json:"is_dir"`
+	Entry    *ArchiveEntry      `json:"entry,omitempty"`
+	Children []*ArchiveTreeNode `json:"children,omitempty"`
+}
+
+// archivePathSegments splits an entry name into its path components, ignoring empty and
+// "." segments and accepting the backslashes some Windows tools write
+func archivePathSegments(name string) []string {
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(name, "\\", "/"), "/") {
+		if segment != "" && segment != "." {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// buildArchiveTree nests a flat archive listing into directories, sorted with
+// directories first and then by name
+func buildArchiveTree(entries []ArchiveEntry) *ArchiveTreeNode {
+	root := &ArchiveTreeNode{IsDir: true}
+	dirs := map[string]*ArchiveTreeNode{"": root}
+
+	// dir returns the directory node at segments, creating it and its parents
+	var dir func(segments []string) *ArchiveTreeNode
+	dir = func(segments []string) *ArchiveTreeNode {
+		path := strings.Join(segments, "/")
+		if node, ok := dirs[path]; ok {
+			return node
+		}
+		parent := dir(segments[:len(segments)-1])
+		node := &ArchiveTreeNode{Name: segments[len(segments)-1], Path: path, IsDir: true}
+		parent.Children = append(parent.Children, node)
+		dirs[path] = node
+		return node
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		segments := archivePathSegments(entry.Name)
+		if len(segments) == 0 {
+			continue
+		}
+		if entry.IsDir {
+			if node := dir(segments); node.Entry == nil {
+				node.Entry = entry
+			}
+			continue
+		}
+		parent := dir(segments[:len(segments)-1])
+		parent.Children = append(parent.Children, &ArchiveTreeNode{
+			Name:  segments[len(segments)-1],
+			Path:  strings.Join(segments, "/"),
+			Entry: entry,
+		})
+	}
+
+	sortArchiveTree(root)
+	return root
+}
+
+func sortArchiveTree(node *ArchiveTreeNode) {
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		return a.Name < b.Name
+	})
+	for _, child := range node.Children {
+		if child.IsDir {
+			sortArchiveTree(child)
+		}
+	}
+}
+
+// getArchiveTree returns an archive's entries as a nested directory tree. Each file node
+// carries its entry, whose index can be passed to the extract endpoint.
+//
+// @summary List the entries of an archive as a tree
+// @tags archive
+// @path id File ID
+// @success 200 json
+// @auth downloadPassword adminToken optional
+func (s *FileService) getArchiveTree(c *gin.Context) {
+	archive, ok := s.loadArchive(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	defer archive.close()
+
+	entries, err := archive.Entries()
+	if err != nil {
+		log.Printf("Failed to list %s archive %s: %v", archive.format, archive.file.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read archive"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"filename": archive.file.Filename,
+		"format":   archive.format,
+		"total":    len(entries),
+		"tree":     buildArchiveTree(entries),
+	})
+}
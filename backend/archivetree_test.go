@@ -0,0 +1,130 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildArchiveTree(t *testing.T) {
+	entries := []ArchiveEntry{
+		{Index: 0, Name: "src/main.go"},
+		{Index: 1, Name: "README.md"},
+		{Index: 2, Name: "src/", IsDir: true},
+		{Index: 3, Name: "./docs\\guide.md"},
+		{Index: 4, Name: "README.md"},
+	}
+	root := buildArchiveTree(entries)
+
+	// Directories first, then names; the duplicate README stays a separate node
+	var names []string
+	for _, child := range root.Children {
+		names = append(names, child.Name)
+	}
+	if got := strings.Join(names, ","); got != "docs,src,README.md,README.md" {
+		t.Fatalf("root children %s", got)
+	}
+	readmes := root.Children[2:]
+	if readmes[0].Entry.Index == readmes[1].Entry.Index {
+		t.Error("duplicate names share an entry")
+	}
+
+	docs, src := root.Children[0], root.Children[1]
+	if docs.Entry != nil {
+		t.Error("implied directory has an entry")
+	}
+	if src.Entry == nil || src.Entry.Index != 2 {
+		t.Error("explicit directory entry not attached")
+	}
+	if len(docs.Children) != 1 || docs.Children[0].Path != "docs/guide.md" {
+		t.Errorf("docs children %+v", docs.Children)
+	}
+	if len(src.Children) != 1 || src.Children[0].Entry.Index != 0 {
+		t.Errorf("src children %+v", src.Children)
+	}
+}
+
+func TestExtractArchiveEntryByIndex(t *testing.T) {
+	ts := newTestService(t)
+
+	// Two entries with the same name, which a name can't tell apart
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, content := range []string{"first", "second"} {
+		w, err := writer.Create("notes.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	writer.Close()
+	content := buf.Bytes()
+	size := int64(len(content))
+	now := ts.clock.Now()
+	ts.store.SaveFile(&FileStorage{
+		ID: "dupes", Filename: "dupes.zip", OriginalSize: size, CompressedSize: &size,
+		MimeType: "application/zip", CompressionType: string(CompressionNone), StorageType: "postgresql",
+		FileContent: content, UploadTime: now, ExpiresAt: now.Add(time.Hour),
+	})
+	param := gin.Param{Key: "id", Value: "dupes"}
+
+	for query, want := range map[string]string{"index=0": "first", "index=1": "second", "filename=notes.txt": "first"} {
+		w := ts.serve(ts.extractArchiveFile, httptest.NewRequest(http.MethodGet, "/api/archive/dupes/extract?"+query, nil), param)
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want %q", query, w.Code, w.Body.String(), want)
+		}
+	}
+	for query, status := range map[string]int{"index=2": http.StatusNotFound, "index=-1": http.StatusBadRequest, "index=x": http.StatusBadRequest, "": http.StatusBadRequest} {
+		w := ts.serve(ts.extractArchiveFile, httptest.NewRequest(http.MethodGet, "/api/archive/dupes/extract?"+query, nil), param)
+		if w.Code != status {
+			t.Errorf("%q: got %d, want %d", query, w.Code, status)
+		}
+	}
+
+	w := ts.serve(ts.getArchiveTree, httptest.NewRequest(http.MethodGet, "/api/archive/dupes/tree", nil), param)
+	var resp struct {
+		Tree ArchiveTreeNode `json:"tree"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("tree: %d %s", w.Code, w.Body.String())
+	}
+	if len(resp.Tree.Children) != 2 || resp.Tree.Children[1].Entry.Index != 1 {
+		t.Errorf("tree children %+v", resp.Tree.Children)
+	}
+}
+
+func TestArchiveTreePasswordProtected(t *testing.T) {
+	ts := newTestService(t)
+	param := saveArchiveTestFile(t, ts, "private", "private.zip", zipFixture(t, "docs/a.txt", "docs/b.txt"))
+	stored, _ := ts.store.GetFile("private")
+	password := "hunter2"
+	stored.HasDownloadPassword = true
+	stored.DownloadPassword = &password
+	ts.store.SaveFile(stored)
+
+	w := ts.serve(ts.getArchiveTree, httptest.NewRequest(http.MethodGet, "/api/archive/private/tree", nil), param)
+	if w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), "a.txt") {
+		t.Errorf("without the password: got %d: %s", w.Code, w.Body.String())
+	}
+
+	token, _, err := ts.adminTokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/archive/private/tree", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if w := ts.serve(ts.getArchiveTree, req, param); w.Code != http.StatusOK {
+		t.Errorf("with an admin token: got %d: %s", w.Code, w.Body.String())
+	}
+	w = ts.serve(ts.getArchiveTree, httptest.NewRequest(http.MethodGet, "/api/archive/private/tree?password="+password, nil), param)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "a.txt") {
+		t.Errorf("with the password: got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+type Base64UploadRequest struct {
+	Filename         string `json:"filename"`
+	Content          string `json:"content" binding:"required"` // base64 or data URI
+	DownloadPassword string `json:"download_password,omitempty"`
+	FileHash         string `json:"file_hash,omitempty"`
+	StorageClass     string `json:"storage_class,omitempty"`
+	EmailTo          string `json:"email_to,omitempty"` // Comma-separated addresses to mail the link to
+	PasswordHint     string `json:"password_hint,omitempty"`
+	Slug             string `json:"slug,omitempty"` // Vanity slug for a /f/:slug link
+	CustomID         string `json:"custom_id,omitempty"`
+	AltText          string `json:"alt_text,omitempty"` // Accessibility text, see Accessibility
+	Caption          string `json:"caption,omitempty"`
+	Description      string `json:"description,omitempty"`
+}
+
+// decodeBase64Content decodes plain base64 or a data URI ("data:image/png;base64,...").
+// The MIME type is returned when the content was a data URI.
+func decodeBase64Content(content string) ([]byte, string, error) {
+	var mimeType string
+	if strings.HasPrefix(content, "data:") {
+		comma := strings.Index(content, ",")
+		if comma < 0 || !strings.HasSuffix(content[:comma], ";base64") {
+			return nil, "", base64.CorruptInputError(0)
+		}
+		mimeType = strings.TrimSuffix(strings.TrimPrefix(content[:comma], "data:"), ";base64")
+		content = content[comma+1:]
+	}
+
+	content = strings.TrimSpace(content)
+	decoded, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		// Accept unpadded and URL-safe variants as well
+		if decoded, err = base64.RawStdEncoding.DecodeString(content); err != nil {
+			if decoded, err = base64.URLEncoding.DecodeString(content); err != nil {
+				decoded, err = base64.RawURLEncoding.DecodeString(content)
+			}
+		}
+	}
+	return decoded, mimeType, err
+}
+
+// uploadBase64 accepts a JSON body with base64-encoded content for clients that cannot
+// send multipart requests. The response matches uploadFile.
+//
+// @summary Upload base64-encoded content
+// @tags upload
+// @body json Base64UploadRequest
+// @success 200 UploadResponse
+// @auth apiKey optional
+func (s *FileService) uploadBase64(c *gin.Context) {
+	release, ok := s.acquireUploadSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Base64 inflates content by 4/3; allow some room for the JSON envelope
+	maxBodySize := s.config.Base64UploadMaxSize/3*4 + 64*1024
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+
+	var req Base64UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "File too large for base64 upload",
+				"message":  "Use /api/upload or chunked upload for larger files",
+				"max_size": s.config.Base64UploadMaxSize,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	content, dataMimeType, err := decodeBase64Content(req.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content is not valid base64"})
+		return
+	}
+
+	if int64(len(content)) > s.config.Base64UploadMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large for base64 upload",
+			"message":  "Use /api/upload or chunked upload for larger files",
+			"max_size": s.config.Base64UploadMaxSize,
+		})
+		return
+	}
+
+	filename := req.Filename
+	if filename == "" {
+		filename = "upload"
+		if dataMimeType != "" {
+			if extensions, _ := mime.ExtensionsByType(dataMimeType); len(extensions) > 0 {
+				filename += extensions[0]
+			}
+		}
+	}
+	filename = files.NormalizeName(filename)
+	if !checkExtensionPolicy(c, s.config, filename, int64(len(content))) {
+		return
+	}
+	if !s.checkOrgPolicy(c, filename, req.DownloadPassword != "") {
+		return
+	}
+
+	apiKey := apiKeyFromContext(c)
+	if !s.checkUploadQuota(c, int64(len(content))) {
+		return
+	}
+
+	storageClass, ok := s.storageClassFromRequest(c, req.StorageClass, apiKey)
+	if !ok {
+		return
+	}
+	email, ok := s.linkEmailFromRequest(c, req.EmailTo, req.PasswordHint)
+	if !ok {
+		return
+	}
+	slug, ok := s.slugFromRequest(c, req.Slug, req.CustomID)
+	if !ok {
+		return
+	}
+	accessibility, ok := accessibilityFromRequest(c, req.AltText, req.Caption, req.Description)
+	if !ok {
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	contentHash := hex.EncodeToString(sum[:])
+
+	expectedHash := req.FileHash
+	if expectedHash == "" {
+		expectedHash = c.GetHeader("X-Content-SHA256")
+	}
+	if !verifyContentHash(c, filename, expectedHash, contentHash) {
+		return
+	}
+
+	s.storeUploadedContent(c, filename, content, contentHash, req.DownloadPassword, apiKey, storageClass, email, slug, accessibility)
+}
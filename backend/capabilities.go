@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+	"file-storage-service/internal/highlight"
+)
+
+// getCapabilities describes server limits and features so clients don't need to hard-code them
+//
+// @summary Describe server limits and features
+// @tags server
+// @success 200 json
+func (s *FileService) getCapabilities(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+
+	c.JSON(http.StatusOK, gin.H{
+		"limits": gin.H{
+			"max_file_size":          s.config.MaxFileSize,
+			"simple_upload_max_size": s.config.ChunkThreshold,
+			"max_concurrent_uploads": s.config.MaxConcurrentUploads,
+			"retention_seconds":      int64(s.config.FileRetention.Seconds()),
+			"allowed_extensions":     s.config.AllowedExtensions,
+			"blocked_extensions":     s.config.BlockedExtensions,
+			"extension_max_sizes":    s.config.ExtensionMaxSizes,
+		},
+		"chunked_upload": gin.H{
+			"enabled":             true,
+			"threshold":           s.config.ChunkThreshold,
+			"max_chunk_size":      s.config.ChunkSize,
+			"max_chunks_per_file": s.config.MaxChunksPerFile,
+			"session_timeout":     int64(s.config.ChunkTimeout.Seconds()),
+			"job_events":          true,
+			"status_websocket":    true,
+		},
+		"storage_classes": gin.H{
+			"classes":   storageClasses,
+			"default":   s.config.DefaultStorageClass,
+			"anonymous": parseStorageClassList(s.config.AnonymousStorageClasses),
+		},
+		"compression": []CompressionType{
+			CompressionNone, CompressionGzip, CompressionZstd, CompressionLZ4,
+		},
+		"preview": gin.H{
+			"mime_prefixes":    files.PreviewableMimePrefixes,
+			"range_requests":   true,
+			"zip_browsing":     true,
+			"archive_formats":  archiveFormats,
+			"exif_orientation": true,
+			"font_specimen":    true,
+			"model_viewer":     true,
+			"notebook_render":  true,
+			"geojson":          true,
+			"text_window":      true,
+			"text_languages":   highlight.Languages(),
+			"table_preview":    true,
+		},
+		"auth": gin.H{
+			"modes":              []string{"anonymous", "api_key", "download_password", "admin_token"},
+			"api_key_header":     apiKeyHeader,
+			"admin_enabled":      s.config.AdminPassword != "" || s.ldap != nil,
+			"provider":           s.config.AuthProvider,
+			"download_password":  true,
+			"client_certificate": s.config.ClientCA != "",
+			"scim":               s.config.SCIMToken != "",
+		},
+		"features": gin.H{
+			"speedtest":          true,
+			"collections":        true,
+			"organizations":      true,
+			"public_stats":       s.config.PublicStatsEnabled,
+			"speedtest_max_size": s.config.SpeedTestMaxSize,
+			"streaming":          s.config.EnableStreaming,
+			"processing_status":  true,
+			"virus_scanning":     s.scanner != nil || s.config.ScanWebhookSecret != "",
+			"media_processing":   mediaToolsAvailable(s.config),
+			"pdf_page_preview":   pdfToolsAvailable(s.config),
+		},
+	})
+}
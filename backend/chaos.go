@@ -0,0 +1,97 @@
+//go:build chaos
+
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Fault injection for resilience testing, compiled in only with `go build -tags chaos`.
+// CHAOS_REDIS_TIMEOUT_RATE and CHAOS_DB_ERROR_RATE are the probabilities (0-1) that a
+// command written to a Redis or PostgreSQL connection times out, which also closes the
+// connection as a network failure would. CHAOS_DISK_DELAY_RATE is the probability that a
+// disk operation on stored files or chunks stalls for CHAOS_DISK_DELAY.
+type faultInjector struct {
+	redisTimeoutRate float64
+	dbErrorRate      float64
+	diskDelayRate    float64
+	diskDelay        time.Duration
+}
+
+var faults = &faultInjector{
+	redisTimeoutRate: getEnvFloat("CHAOS_REDIS_TIMEOUT_RATE", 0),
+	dbErrorRate:      getEnvFloat("CHAOS_DB_ERROR_RATE", 0),
+	diskDelayRate:    getEnvFloat("CHAOS_DISK_DELAY_RATE", 0),
+	diskDelay:        getEnvDuration("CHAOS_DISK_DELAY", "2s"),
+}
+
+func init() {
+	log.Printf("Chaos build: injecting Redis timeouts (%.2f), database errors (%.2f) and disk delays (%.2f of %s)",
+		faults.redisTimeoutRate, faults.dbErrorRate, faults.diskDelayRate, faults.diskDelay)
+}
+
+func chaosHit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// injectedTimeout is returned for injected faults. It reports itself as a timeout, so
+// clients treat it like a real network timeout, including their retries.
+type injectedTimeout struct{}
+
+func (injectedTimeout) Error() string   { return "chaos: injected network timeout" }
+func (injectedTimeout) Timeout() bool   { return true }
+func (injectedTimeout) Temporary() bool { return true }
+
+// faultyConn fails writes with the probability *rate, read at the time of each write
+type faultyConn struct {
+	net.Conn
+	rate *float64
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	if chaosHit(*c.rate) {
+		c.Conn.Close()
+		return 0, injectedTimeout{}
+	}
+	return c.Conn.Write(b)
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func faultyDialer(dial dialFunc, rate *float64) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &faultyConn{Conn: conn, rate: rate}, nil
+	}
+}
+
+// installRedisFaults makes Redis connections time out at CHAOS_REDIS_TIMEOUT_RATE
+func installRedisFaults(options *redis.Options) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 5 * time.Minute}
+	options.Dialer = faultyDialer(dialer.DialContext, &faults.redisTimeoutRate)
+}
+
+// installDatabaseFaults makes PostgreSQL connections fail at CHAOS_DB_ERROR_RATE
+func installDatabaseFaults(config *pgxpool.Config) {
+	dial := faultyDialer(dialFunc(config.ConnConfig.DialFunc), &faults.dbErrorRate)
+	config.ConnConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dial(ctx, network, addr)
+	}
+}
+
+// injectDiskDelay stalls a disk operation at CHAOS_DISK_DELAY_RATE
+func injectDiskDelay() {
+	if chaosHit(faults.diskDelayRate) {
+		time.Sleep(faults.diskDelay)
+	}
+}
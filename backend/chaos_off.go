@@ -0,0 +1,16 @@
+//go:build !chaos
+
+package main
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Without the chaos build tag no faults are injected; see chaos.go
+
+func installRedisFaults(options *redis.Options) {}
+
+func installDatabaseFaults(config *pgxpool.Config) {}
+
+func injectDiskDelay() {}
@@ -0,0 +1,156 @@
+//go:build chaos
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// setFaultRate sets an injected fault rate for the duration of a test
+func setFaultRate(t *testing.T, rate *float64, value float64) {
+	previous := *rate
+	*rate = value
+	t.Cleanup(func() { *rate = previous })
+}
+
+func TestFaultyConnFailsWritesAsTimeouts(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	rate := 1.0
+	conn := &faultyConn{Conn: client, rate: &rate}
+	_, err := conn.Write([]byte("PING"))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Write = %v, want a timeout", err)
+	}
+	// The connection is closed like after a real network failure
+	if _, err := client.Write([]byte("PING")); err == nil {
+		t.Error("connection still usable after an injected fault")
+	}
+
+	client, server = net.Pipe()
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 4)
+		server.Read(buf)
+	}()
+	rate = 0
+	conn = &faultyConn{Conn: client, rate: &rate}
+	if _, err := conn.Write([]byte("PING")); err != nil {
+		t.Errorf("Write with no faults = %v", err)
+	}
+}
+
+func TestInjectedDiskDelay(t *testing.T) {
+	setFaultRate(t, &faults.diskDelayRate, 1)
+	previousDelay := faults.diskDelay
+	faults.diskDelay = 50 * time.Millisecond
+	t.Cleanup(func() { faults.diskDelay = previousDelay })
+
+	tempDir := t.TempDir()
+	config := &Config{TempDir: tempDir}
+	if err := os.MkdirAll(filepath.Join(tempDir, "files"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(tempDir, "files", "abc123")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	content, err := readStoredFile(config, path)
+	if err != nil {
+		t.Fatalf("readStoredFile failed under disk delay: %v", err)
+	}
+	if string(content) != "content" {
+		t.Errorf("readStoredFile = %q", content)
+	}
+	if elapsed := time.Since(started); elapsed < faults.diskDelay {
+		t.Errorf("read took %s, want at least the injected %s", elapsed, faults.diskDelay)
+	}
+}
+
+// TestRedisRecoversFromTimeouts needs a Redis server at REDIS_ADDR. Commands hit by an
+// injected timeout must be retried on a new connection until they succeed.
+func TestRedisRecoversFromTimeouts(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+
+	options := &redis.Options{Addr: addr, MaxRetries: 10, MinRetryBackoff: time.Millisecond, MaxRetryBackoff: 10 * time.Millisecond}
+	installRedisFaults(options)
+	client := redis.NewClient(options)
+	defer client.Close()
+
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Skipf("Redis unavailable: %v", err)
+	}
+
+	setFaultRate(t, &faults.redisTimeoutRate, 0.2)
+	key := "chaos_test:" + generateID()
+	defer client.Del(ctx, key)
+	for i := 0; i < 100; i++ {
+		if err := client.Incr(ctx, key).Err(); err != nil {
+			t.Fatalf("INCR %d failed despite retries: %v", i, err)
+		}
+	}
+	// An injected fault fails the write before the command reaches Redis, so retries never
+	// apply a command twice
+	setFaultRate(t, &faults.redisTimeoutRate, 0)
+	if count, err := client.Get(ctx, key).Int(); err != nil || count != 100 {
+		t.Errorf("counter = %d, %v; want 100", count, err)
+	}
+}
+
+// TestDatabasePoolRecoversFromErrors needs a PostgreSQL server at DATABASE_URL. Queries on
+// a connection broken by an injected fault fail, but the pool must discard the connection
+// so that later queries succeed once faults stop.
+func TestDatabasePoolRecoversFromErrors(t *testing.T) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolConfig.MaxConns = 4
+	installDatabaseFaults(poolConfig)
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+	if err != nil {
+		t.Skipf("PostgreSQL unavailable: %v", err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	setFaultRate(t, &faults.dbErrorRate, 0.3)
+	failed := 0
+	for i := 0; i < 50; i++ {
+		var one int
+		if err := pool.QueryRow(ctx, "SELECT 1").Scan(&one); err != nil {
+			failed++
+		}
+	}
+	t.Logf("%d of 50 queries failed under injected faults", failed)
+
+	setFaultRate(t, &faults.dbErrorRate, 0)
+	for i := 0; i < 10; i++ {
+		var one int
+		if err := pool.QueryRow(ctx, "SELECT 1").Scan(&one); err != nil {
+			t.Fatalf("query %d failed after faults stopped: %v", i, err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,38 +13,130 @@ import (
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/sys/unix"
+
+	"file-storage-service/internal/chunks"
+	"file-storage-service/internal/files"
+	"file-storage-service/internal/storage"
 )
 
 type ChunkUpload struct {
-	UploadID            string    `json:"upload_id"`
-	Filename            string    `json:"filename"`
-	TotalSize           int64     `json:"total_size"`
-	TotalChunks         int       `json:"total_chunks"`
-	ChunkSize           int64     `json:"chunk_size"`
-	ReceivedChunks      []bool    `json:"received_chunks"`
-	CreatedAt           time.Time `json:"created_at"`
-	LastActivity        time.Time `json:"last_activity"`
-	FileHash            string    `json:"file_hash,omitempty"`
-	DownloadPassword    string    `json:"download_password,omitempty"`
-	HasDownloadPassword bool      `json:"has_download_password"`
+	UploadID            string       `json:"upload_id"`
+	Filename            string       `json:"filename"`
+	TotalSize           int64        `json:"total_size"`
+	TotalChunks         int          `json:"total_chunks"`
+	ChunkSize           int64        `json:"chunk_size"`
+	ReceivedChunks      []bool       `json:"received_chunks"`
+	CreatedAt           time.Time    `json:"created_at"`
+	LastActivity        time.Time    `json:"last_activity"`
+	FileHash            string       `json:"file_hash,omitempty"`
+	DownloadPassword    string       `json:"download_password,omitempty"`
+	HasDownloadPassword bool         `json:"has_download_password"`
+	APIKeyID            string       `json:"api_key_id,omitempty"`
+	ClientIP            string       `json:"client_ip,omitempty"`
+	StorageClass        StorageClass `json:"storage_class,omitempty"`
+
+	// mu guards ReceivedChunks and LastActivity, which concurrent chunk requests update
+	mu sync.Mutex
+	// persistedAt is when the session was last written to PostgreSQL
+	persistedAt time.Time
+}
+
+// uploadPersistInterval is how often chunk progress is written to PostgreSQL. Received
+// chunks are rebuilt from disk on restore, so the database copy may lag behind.
+const uploadPersistInterval = 30 * time.Second
+
+// isReceived reports whether the chunk at index has been stored
+func (u *ChunkUpload) isReceived(index int) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.ReceivedChunks[index]
+}
+
+// markReceived records a chunk stored at now and returns how many chunks have been received
+func (u *ChunkUpload) markReceived(index int, now time.Time) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.ReceivedChunks[index] = true
+	u.LastActivity = now
+	return chunks.CountReceived(u.ReceivedChunks)
+}
+
+// receivedCount returns how many chunks have been received
+func (u *ChunkUpload) receivedCount() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return chunks.CountReceived(u.ReceivedChunks)
+}
+
+// firstMissing returns the index of the first chunk not yet received, or -1
+func (u *ChunkUpload) firstMissing() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return chunks.FirstMissing(u.ReceivedChunks)
+}
+
+// missingChunks returns the indexes of the chunks not yet received
+func (u *ChunkUpload) missingChunks() []int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return chunks.Missing(u.ReceivedChunks)
+}
+
+// resetReceived marks every chunk as missing so the client sends all of them again
+func (u *ChunkUpload) resetReceived(now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := range u.ReceivedChunks {
+		u.ReceivedChunks[i] = false
+	}
+	u.LastActivity = now
+	u.persistedAt = time.Time{} // Persist the reset right away
+}
+
+// storageClass returns the class requested for the upload; sessions created before storage
+// classes existed have none and use the standard class
+func (u *ChunkUpload) storageClass() StorageClass {
+	if u.StorageClass == "" {
+		return StorageClassStandard
+	}
+	return u.StorageClass
+}
+
+// applyOwner copies the uploader identity of the session onto the stored file
+func (u *ChunkUpload) applyOwner(fileStorage *FileStorage) {
+	if u.APIKeyID != "" {
+		apiKeyID := u.APIKeyID
+		fileStorage.APIKeyID = &apiKeyID
+	}
+	if u.ClientIP != "" {
+		clientIP := u.ClientIP
+		fileStorage.UploaderIP = &clientIP
+	}
 }
 
 type ProcessingJob struct {
 	JobID     string      `json:"job_id"`
 	UploadID  string      `json:"upload_id"`
 	FileID    string      `json:"file_id"`
-	Status    string      `json:"status"`   // pending, processing, completed, failed
+	Status    string      `json:"status"`   // pending, processing, retrying, completed, failed
 	Progress  int         `json:"progress"` // 0-100
 	Error     string      `json:"error,omitempty"`
 	Result    *FileResult `json:"result,omitempty"`
 	CreatedAt time.Time   `json:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at"`
+
+	// Failed attempts so far, when the next one is due while retrying, and whether the job
+	// failed for good after exhausting its attempts
+	Attempts      int        `json:"attempts,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeadLetter    bool       `json:"dead_letter,omitempty"`
 }
 
 type FileResult struct {
@@ -54,16 +148,19 @@ type FileResult struct {
 }
 
 type ChunkUploadManager struct {
-	redis   *redis.Client
+	redis   RedisClient
+	db      ChunkStore
 	config  *Config
+	clock   Clock
 	uploads sync.Map // map[string]*ChunkUpload
-	jobs    sync.Map // map[string]*ProcessingJob
 }
 
-func NewChunkUploadManager(redis *redis.Client, config *Config) *ChunkUploadManager {
+func NewChunkUploadManager(redis RedisClient, db ChunkStore, config *Config, clock Clock) *ChunkUploadManager {
 	manager := &ChunkUploadManager{
 		redis:  redis,
+		db:     db,
 		config: config,
+		clock:  clock,
 	}
 
 	// Create temp directory if it doesn't exist and ensure proper permissions
@@ -71,6 +168,9 @@ func NewChunkUploadManager(redis *redis.Client, config *Config) *ChunkUploadMana
 		panic(fmt.Sprintf("Failed to setup temp directory: %v", err))
 	}
 
+	// Restore sessions interrupted by a restart so clients can resume them
+	manager.restoreUploads()
+
 	// Start cleanup routine
 	go manager.startCleanupRoutine()
 
@@ -80,6 +180,11 @@ func NewChunkUploadManager(redis *redis.Client, config *Config) *ChunkUploadMana
 // ensureTempDirectory creates and ensures proper permissions for temp directory
 func (m *ChunkUploadManager) ensureTempDirectory() error {
 	tempDir := m.config.TempDir
+
+	// A symlinked temp directory would redirect every upload to wherever it points
+	if err := storage.RejectSymlinkDir(tempDir); err != nil {
+		return err
+	}
 	
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
@@ -118,9 +223,22 @@ func (m *ChunkUploadManager) ensureTempDirectory() error {
 	
 	// Create files subdirectory
 	filesDir := filepath.Join(tempDir, "files")
+	if err := storage.RejectSymlinkDir(filesDir); err != nil {
+		return err
+	}
 	if err := os.MkdirAll(filesDir, 0755); err != nil {
 		log.Printf("Failed to create files directory %s: %v", filesDir, err)
 	}
+
+	// Create storage class directories
+	for _, dir := range m.config.storageDirs() {
+		if err := storage.RejectSymlinkDir(dir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Failed to create storage directory %s: %v", dir, err)
+		}
+	}
 	
 	return nil
 }
@@ -136,7 +254,7 @@ func (m *ChunkUploadManager) startCleanupRoutine() {
 
 func (m *ChunkUploadManager) cleanupExpiredUploads() {
 	ctx := context.Background()
-	now := time.Now()
+	now := m.clock.Now()
 
 	// First, check if disk space is low and do aggressive cleanup
 	if err := m.checkDiskSpace(5 * 1024 * 1024 * 1024); err != nil { // 5GB threshold
@@ -144,6 +262,18 @@ func (m *ChunkUploadManager) cleanupExpiredUploads() {
 		m.aggressiveCleanup()
 	}
 
+	// Sessions held in memory outlive their Redis key, which expires after the same timeout
+	m.uploads.Range(func(key, value interface{}) bool {
+		upload := value.(*ChunkUpload)
+		upload.mu.Lock()
+		lastActivity := upload.LastActivity
+		upload.mu.Unlock()
+		if now.Sub(lastActivity) > m.config.ChunkTimeout {
+			m.cleanupUpload(upload.UploadID)
+		}
+		return true
+	})
+
 	// Get all chunk uploads from Redis
 	keys, err := m.redis.Keys(ctx, "chunk_upload:*").Result()
 	if err != nil {
@@ -194,7 +324,7 @@ func (m *ChunkUploadManager) aggressiveCleanup() {
 	// Force cleanup of all expired uploads
 	m.uploads.Range(func(key, value interface{}) bool {
 		upload := value.(*ChunkUpload)
-		if time.Since(upload.LastActivity) > 10*time.Minute {
+		if m.clock.Now().Sub(upload.LastActivity) > 10*time.Minute {
 			m.cleanupUpload(upload.UploadID)
 		}
 		return true
@@ -210,88 +340,345 @@ func (m *ChunkUploadManager) cleanupUpload(uploadID string) {
 	// Remove from memory
 	m.uploads.Delete(uploadID)
 
+	// Remove persisted session
+	if err := m.db.DeleteChunkUpload(uploadID); err != nil {
+		log.Printf("Failed to delete chunk upload %s from database: %v", uploadID, err)
+	}
+
 	// Remove temp directory
-	tempDir := filepath.Join(m.config.TempDir, uploadID)
+	tempDir, err := storage.SafeJoin(m.config.TempDir, uploadID)
+	if err != nil {
+		log.Printf("Refusing to remove temp directory for upload %s: %v", uploadID, err)
+		return
+	}
 	os.RemoveAll(tempDir)
 }
 
-func (m *ChunkUploadManager) InitiateUpload(c *gin.Context) {
-	var req struct {
-		Filename         string `json:"filename" binding:"required"`
-		TotalSize        int64  `json:"total_size" binding:"required"`
-		ChunkSize        int64  `json:"chunk_size" binding:"required"`
-		FileHash         string `json:"file_hash,omitempty"`
-		DownloadPassword string `json:"download_password,omitempty"`
+// toStorage converts the session into its database record
+func (u *ChunkUpload) toStorage(timeout time.Duration) *ChunkUploadStorage {
+	stored := &ChunkUploadStorage{
+		UploadID:            u.UploadID,
+		Filename:            u.Filename,
+		TotalSize:           u.TotalSize,
+		TotalChunks:         u.TotalChunks,
+		ChunkSize:           u.ChunkSize,
+		ReceivedChunks:      u.ReceivedChunks,
+		HasDownloadPassword: u.HasDownloadPassword,
+		CreatedAt:           u.CreatedAt,
+		LastActivity:        u.LastActivity,
+		ExpiresAt:           u.LastActivity.Add(timeout),
+		StorageClass:        string(u.storageClass()),
+		Status:              "active",
+	}
+	if u.FileHash != "" {
+		stored.FileHash = &u.FileHash
+	}
+	if u.DownloadPassword != "" {
+		stored.DownloadPassword = &u.DownloadPassword
+	}
+	if u.APIKeyID != "" {
+		stored.APIKeyID = &u.APIKeyID
+	}
+	if u.ClientIP != "" {
+		stored.ClientIP = &u.ClientIP
+	}
+	return stored
+}
+
+// chunkUploadFromStorage converts a database record back into a session
+func chunkUploadFromStorage(stored *ChunkUploadStorage) *ChunkUpload {
+	upload := &ChunkUpload{
+		UploadID:            stored.UploadID,
+		Filename:            stored.Filename,
+		TotalSize:           stored.TotalSize,
+		TotalChunks:         stored.TotalChunks,
+		ChunkSize:           stored.ChunkSize,
+		ReceivedChunks:      stored.ReceivedChunks,
+		CreatedAt:           stored.CreatedAt,
+		LastActivity:        stored.LastActivity,
+		HasDownloadPassword: stored.HasDownloadPassword,
+		StorageClass:        StorageClass(stored.StorageClass),
+	}
+	if len(upload.ReceivedChunks) != upload.TotalChunks {
+		upload.ReceivedChunks = make([]bool, upload.TotalChunks)
+	}
+	if stored.FileHash != nil {
+		upload.FileHash = *stored.FileHash
+	}
+	if stored.DownloadPassword != nil {
+		upload.DownloadPassword = *stored.DownloadPassword
+	}
+	if stored.APIKeyID != nil {
+		upload.APIKeyID = *stored.APIKeyID
+	}
+	if stored.ClientIP != nil {
+		upload.ClientIP = *stored.ClientIP
+	}
+	return upload
+}
+
+// plan returns how the upload is split into chunks
+func (u *ChunkUpload) plan() chunks.Plan {
+	return chunks.Plan{TotalSize: u.TotalSize, ChunkSize: u.ChunkSize, TotalChunks: u.TotalChunks}
+}
+
+// expectedChunkSize returns the size of a complete chunk at the given index
+func (u *ChunkUpload) expectedChunkSize(index int) int64 {
+	return u.plan().ExpectedSize(index)
+}
+
+// saveUpload stores the session in Redis and persists it to PostgreSQL when it is new or
+// hasn't been persisted for uploadPersistInterval. Only the Redis write is required; a
+// failed database write just makes the session non-resumable.
+func (m *ChunkUploadManager) saveUpload(upload *ChunkUpload) error {
+	upload.mu.Lock()
+	uploadJSON, err := json.Marshal(upload)
+	var stored *ChunkUploadStorage
+	if err == nil && m.clock.Now().Sub(upload.persistedAt) >= uploadPersistInterval {
+		stored = upload.toStorage(m.config.ChunkTimeout)
+		stored.ReceivedChunks = append([]bool(nil), upload.ReceivedChunks...)
+		upload.persistedAt = m.clock.Now()
+	}
+	upload.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := m.redis.Set(ctx, "chunk_upload:"+upload.UploadID, uploadJSON, m.config.ChunkTimeout).Err(); err != nil {
+		return err
 	}
 
+	if stored != nil {
+		if err := m.db.SaveChunkUpload(stored); err != nil {
+			log.Printf("Failed to persist chunk upload %s: %v", upload.UploadID, err)
+		}
+	}
+	return nil
+}
+
+// loadUpload finds a session in memory, Redis or PostgreSQL, returning nil if it doesn't exist
+func (m *ChunkUploadManager) loadUpload(uploadID string) (*ChunkUpload, error) {
+	// A session cancelled by an admin may still be held in memory by this instance
+	if m.isCancelled(uploadID) {
+		m.uploads.Delete(uploadID)
+		return nil, nil
+	}
+
+	if uploadValue, exists := m.uploads.Load(uploadID); exists {
+		return uploadValue.(*ChunkUpload), nil
+	}
+
+	ctx := context.Background()
+	uploadJSON, err := m.redis.Get(ctx, "chunk_upload:"+uploadID).Result()
+	if err == nil {
+		var upload ChunkUpload
+		if err := json.Unmarshal([]byte(uploadJSON), &upload); err != nil {
+			return nil, err
+		}
+		m.uploads.Store(uploadID, &upload)
+		return &upload, nil
+	}
+
+	stored, err := m.db.GetChunkUpload(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.Status != "active" {
+		return nil, nil
+	}
+
+	upload := chunkUploadFromStorage(stored)
+	m.syncReceivedChunksFromDisk(upload)
+	m.uploads.Store(uploadID, upload)
+	return upload, nil
+}
+
+// chunkPath returns the temp file path for one chunk of an upload
+func (m *ChunkUploadManager) chunkPath(uploadID string, index int) (string, error) {
+	return storage.SafeJoin(m.config.TempDir, uploadID, fmt.Sprintf("chunk_%d", index))
+}
+
+// syncReceivedChunksFromDisk marks exactly the chunks that are fully present in the temp
+// directory as received, dropping any that were lost or only partially written
+func (m *ChunkUploadManager) syncReceivedChunksFromDisk(upload *ChunkUpload) {
+	for i := range upload.ReceivedChunks {
+		chunkPath, err := m.chunkPath(upload.UploadID, i)
+		if err != nil {
+			upload.ReceivedChunks[i] = false
+			continue
+		}
+		info, err := os.Stat(chunkPath)
+		upload.ReceivedChunks[i] = err == nil && info.Size() == upload.expectedChunkSize(i)
+	}
+}
+
+// restoreUploads reloads active sessions from PostgreSQL at startup, rebuilding their
+// received-chunk state from the temp directory
+func (m *ChunkUploadManager) restoreUploads() {
+	stored, err := m.db.ListActiveChunkUploads()
+	if err != nil {
+		log.Printf("Failed to restore chunk uploads: %v", err)
+		return
+	}
+
+	for _, record := range stored {
+		upload := chunkUploadFromStorage(record)
+		uploadDir, err := storage.SafeJoin(m.config.TempDir, upload.UploadID)
+		if err != nil {
+			log.Printf("Skipping chunk upload %s: %v", upload.UploadID, err)
+			continue
+		}
+		if err := os.MkdirAll(uploadDir, 0755); err != nil {
+			log.Printf("Failed to recreate temp directory for upload %s: %v", upload.UploadID, err)
+			continue
+		}
+		m.syncReceivedChunksFromDisk(upload)
+		m.uploads.Store(upload.UploadID, upload)
+
+		if uploadJSON, err := json.Marshal(upload); err == nil {
+			m.redis.Set(context.Background(), "chunk_upload:"+upload.UploadID, uploadJSON, record.ExpiresAt.Sub(m.clock.Now()))
+		}
+	}
+
+	if len(stored) > 0 {
+		log.Printf("Restored %d chunk upload sessions", len(stored))
+	}
+}
+
+// InitiateUploadRequest starts a chunked upload
+type InitiateUploadRequest struct {
+	Filename         string `json:"filename" binding:"required"`
+	TotalSize        int64  `json:"total_size" binding:"required"`
+	ChunkSize        int64  `json:"chunk_size" binding:"required"`
+	FileHash         string `json:"file_hash,omitempty"`
+	DownloadPassword string `json:"download_password,omitempty"`
+	StorageClass     string `json:"storage_class,omitempty"`
+}
+
+// InitiateUpload starts a chunked upload, answering with its ID and the number of chunks
+// to send
+//
+// @summary Start a chunked upload
+// @tags chunk
+// @body json InitiateUploadRequest
+// @success 200 json
+// @auth apiKey optional
+func (m *ChunkUploadManager) InitiateUpload(c *gin.Context) {
+	var req InitiateUploadRequest
+
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
 
-	// Validate request
-	if req.TotalSize > m.config.MaxFileSize {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":    "File too large",
-			"max_size": m.config.MaxFileSize,
-		})
+	// The file service enforces quotas and the storage class policy
+	var fs *FileService
+	if fileService, exists := c.Get("fileService"); exists {
+		fs, _ = fileService.(*FileService)
+	}
+	upload, apiErr := m.startUpload(&req, fs, callerFrom(c))
+	if apiErr != nil {
+		apiErr.respond(c)
 		return
 	}
 
-	if req.ChunkSize > m.config.ChunkSize {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":          "Chunk size too large",
-			"max_chunk_size": m.config.ChunkSize,
-		})
-		return
+	c.JSON(http.StatusOK, gin.H{
+		"upload_id":    upload.UploadID,
+		"total_chunks": upload.TotalChunks,
+		"chunk_size":   upload.ChunkSize,
+		"expires_at":   m.clock.Now().Add(m.config.ChunkTimeout),
+	})
+}
+
+// startUpload opens the session of a chunked upload for who, with the quotas and storage
+// class policy of fs unless it is nil
+func (m *ChunkUploadManager) startUpload(req *InitiateUploadRequest, fs *FileService, who caller) (*ChunkUpload, *apiError) {
+	if err := extensionPolicyError(m.config, files.NormalizeName(req.Filename), req.TotalSize); err != nil {
+		return nil, err
 	}
 
-	// Calculate total chunks
-	totalChunks := int((req.TotalSize + req.ChunkSize - 1) / req.ChunkSize)
-	if totalChunks > m.config.MaxChunksPerFile {
-		c.JSON(http.StatusBadRequest, gin.H{
+	// Validate request and calculate total chunks
+	plan, err := chunks.NewPlan(req.TotalSize, req.ChunkSize, chunks.Limits{
+		MaxFileSize:  m.config.MaxFileSize,
+		MaxChunkSize: m.config.ChunkSize,
+		MaxChunks:    m.config.MaxChunksPerFile,
+	})
+	switch err {
+	case nil:
+	case chunks.ErrFileTooLarge:
+		return nil, &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error":    "File too large",
+			"max_size": m.config.MaxFileSize,
+		}}
+	case chunks.ErrChunkTooLarge:
+		return nil, &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error":          "Chunk size too large",
+			"max_chunk_size": m.config.ChunkSize,
+		}}
+	case chunks.ErrTooManyChunks:
+		return nil, &apiError{status: http.StatusBadRequest, body: gin.H{
 			"error":      "Too many chunks",
 			"max_chunks": m.config.MaxChunksPerFile,
-		})
-		return
+		}}
+	default:
+		return nil, newAPIError(http.StatusBadRequest, "Total size and chunk size must be positive")
+	}
+	totalChunks := plan.TotalChunks
+
+	// Enforce per-key / per-IP storage quotas and the storage class policy
+	apiKey := who.apiKey
+	storageClass := StorageClassStandard
+	if fs != nil {
+		if err := fs.orgPolicyError(apiKey, files.NormalizeName(req.Filename), req.DownloadPassword != ""); err != nil {
+			return nil, err
+		}
+		if err := fs.uploadQuotaError(who, req.TotalSize); err != nil {
+			return nil, err
+		}
+		var apiErr *apiError
+		if storageClass, apiErr = fs.storageClassFor(req.StorageClass, apiKey); apiErr != nil {
+			return nil, apiErr
+		}
 	}
 
 	// Generate upload ID
-	uploadID := generateFileID()
+	uploadID := generateID()
 
 	// Create upload record
 	upload := ChunkUpload{
 		UploadID:            uploadID,
-		Filename:            req.Filename,
+		Filename:            files.NormalizeName(req.Filename),
 		TotalSize:           req.TotalSize,
 		TotalChunks:         totalChunks,
 		ChunkSize:           req.ChunkSize,
 		ReceivedChunks:      make([]bool, totalChunks),
-		CreatedAt:           time.Now(),
-		LastActivity:        time.Now(),
+		CreatedAt:           m.clock.Now(),
+		LastActivity:        m.clock.Now(),
 		FileHash:            req.FileHash,
 		DownloadPassword:    req.DownloadPassword,
 		HasDownloadPassword: req.DownloadPassword != "",
+		StorageClass:        storageClass,
 	}
 
-	// Store in Redis with expiration
-	uploadJSON, err := json.Marshal(upload)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload session"})
-		return
+	if apiKey != nil {
+		upload.APIKeyID = apiKey.ID
 	}
+	upload.ClientIP = who.clientIP
 
-	ctx := context.Background()
-	if err := m.redis.Set(ctx, "chunk_upload:"+uploadID, uploadJSON, m.config.ChunkTimeout).Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store upload session"})
-		return
+	// Store in Redis with expiration, and in PostgreSQL so it survives restarts
+	if err := m.saveUpload(&upload); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to store upload session")
 	}
 
 	// Store in memory for quick access
 	m.uploads.Store(uploadID, &upload)
 
 	// Create temp directory for chunks
-	tempDir := filepath.Join(m.config.TempDir, uploadID)
+	tempDir, err := storage.SafeJoin(m.config.TempDir, uploadID)
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to create temp directory")
+	}
 	log.Printf("Creating temp directory: %s", tempDir)
 	log.Printf("Config TempDir: %s", m.config.TempDir)
 	
@@ -299,11 +686,10 @@ func (m *ChunkUploadManager) InitiateUpload(c *gin.Context) {
 	parentDir := m.config.TempDir
 	if stat, err := os.Stat(parentDir); err != nil {
 		log.Printf("Parent directory %s does not exist or is not accessible: %v", parentDir, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		return nil, &apiError{status: http.StatusInternalServerError, body: gin.H{
 			"error": "Failed to create temp directory",
 			"details": fmt.Sprintf("Parent directory %s not accessible: %v", parentDir, err),
-		})
-		return
+		}}
 	} else {
 		log.Printf("Parent directory %s exists, mode: %v", parentDir, stat.Mode())
 		
@@ -325,79 +711,54 @@ func (m *ChunkUploadManager) InitiateUpload(c *gin.Context) {
 	
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		log.Printf("Failed to create temp directory %s: %v", tempDir, err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		return nil, &apiError{status: http.StatusInternalServerError, body: gin.H{
 			"error": "Failed to create temp directory",
 			"details": fmt.Sprintf("Cannot create directory %s: %v", tempDir, err),
 			"parent_dir": parentDir,
 			"temp_dir": tempDir,
-		})
-		return
+		}}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"upload_id":    uploadID,
-		"total_chunks": totalChunks,
-		"chunk_size":   req.ChunkSize,
-		"expires_at":   time.Now().Add(m.config.ChunkTimeout),
-	})
+	return &upload, nil
 }
 
+// UploadChunk stores one chunk of an upload. Chunks may arrive in any order, and sending
+// one again is acknowledged without storing it twice.
+//
+// @summary Upload a chunk
+// @tags chunk
+// @path upload_id Upload ID
+// @path chunk_index Index of the chunk, from 0
+// @form chunk file required The bytes of the chunk
+// @success 200 json
 func (m *ChunkUploadManager) UploadChunk(c *gin.Context) {
 	// Get file service from context for semaphore access
 	fileService, exists := c.Get("fileService")
 	if exists {
 		if fs, ok := fileService.(*FileService); ok {
-			// Acquire upload semaphore
-			if err := fs.uploadSem.Acquire(c.Request.Context(), 1); err != nil {
-				c.JSON(http.StatusServiceUnavailable, gin.H{
-					"error": "Server busy, please try again later",
-				})
+			// Acquire an upload slot
+			release, ok := fs.acquireUploadSlot(c)
+			if !ok {
 				return
 			}
-			defer fs.uploadSem.Release(1)
+			defer release()
 		}
 	}
 
-	uploadID := c.Param("upload_id")
-	chunkIndexStr := c.Param("chunk_index")
-
-	chunkIndex, err := strconv.Atoi(chunkIndexStr)
+	chunkIndex, err := strconv.Atoi(c.Param("chunk_index"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chunk index"})
 		return
 	}
 
-	// Get upload from memory or Redis
-	uploadValue, exists := m.uploads.Load(uploadID)
-	if !exists {
-		// Try to load from Redis
-		ctx := context.Background()
-		uploadJSON, err := m.redis.Get(ctx, "chunk_upload:"+uploadID).Result()
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
-			return
-		}
-
-		var upload ChunkUpload
-		if err := json.Unmarshal([]byte(uploadJSON), &upload); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse upload session"})
-			return
-		}
-
-		uploadValue = &upload
-		m.uploads.Store(uploadID, uploadValue)
-	}
-
-	upload := uploadValue.(*ChunkUpload)
-
-	// Validate chunk index
-	if chunkIndex < 0 || chunkIndex >= upload.TotalChunks {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chunk index"})
+	upload, received, apiErr := m.chunkTarget(c.Param("upload_id"), chunkIndex)
+	if apiErr != nil {
+		apiErr.respond(c)
 		return
 	}
 
 	// Check if chunk already received
-	if upload.ReceivedChunks[chunkIndex] {
+	if received {
 		c.JSON(http.StatusOK, gin.H{
 			"message":     "Chunk already received",
 			"chunk_index": chunkIndex,
@@ -413,97 +774,137 @@ func (m *ChunkUploadManager) UploadChunk(c *gin.Context) {
 	}
 	defer file.Close()
 
+	receivedCount, apiErr := m.writeChunk(upload, chunkIndex, file)
+	if apiErr != nil {
+		apiErr.respond(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Chunk uploaded successfully",
+		"chunk_index":     chunkIndex,
+		"received_chunks": receivedCount,
+		"total_chunks":    upload.TotalChunks,
+		"complete":        receivedCount == upload.TotalChunks,
+	})
+}
+
+// chunkTarget returns the upload a chunk is sent to, and whether the chunk already arrived
+func (m *ChunkUploadManager) chunkTarget(uploadID string, chunkIndex int) (*ChunkUpload, bool, *apiError) {
+	// Get upload from memory, Redis or PostgreSQL
+	upload, err := m.loadUpload(uploadID)
+	if err != nil {
+		return nil, false, chunkRetryError(nil, "Failed to load upload session", err)
+	}
+	if upload == nil {
+		return nil, false, newAPIError(http.StatusNotFound, "Upload session not found")
+	}
+
+	// Validate chunk index
+	if !upload.plan().ValidIndex(chunkIndex) {
+		return nil, false, newAPIError(http.StatusBadRequest, "Invalid chunk index")
+	}
+	return upload, upload.isReceived(chunkIndex), nil
+}
+
+// writeChunk stores the content of a chunk and marks it received, returning how many
+// chunks of the upload arrived
+func (m *ChunkUploadManager) writeChunk(upload *ChunkUpload, chunkIndex int, content io.Reader) (int, *apiError) {
 	// Save chunk to temp file
-	chunkPath := filepath.Join(m.config.TempDir, uploadID, fmt.Sprintf("chunk_%d", chunkIndex))
+	chunkPath, err := m.chunkPath(upload.UploadID, chunkIndex)
+	if err != nil {
+		return 0, newAPIError(http.StatusBadRequest, "Invalid upload ID")
+	}
+	injectDiskDelay()
 	tempFile, err := os.Create(chunkPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create temp file"})
-		return
+		return 0, chunkRetryError(upload, "Failed to create temp file", err)
 	}
 	defer tempFile.Close()
 
-	// Copy chunk data to temp file
-	if _, err := io.Copy(tempFile, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chunk"})
-		return
+	// Copy chunk data to temp file, dropping a partial chunk so a retry starts over
+	if _, err := io.Copy(tempFile, content); err != nil {
+		os.Remove(chunkPath)
+		return 0, chunkRetryError(upload, "Failed to save chunk", err)
 	}
 
 	// Mark chunk as received
-	upload.ReceivedChunks[chunkIndex] = true
-	upload.LastActivity = time.Now()
+	receivedCount := upload.markReceived(chunkIndex, m.clock.Now())
 
-	// Update in Redis
-	uploadJSON, err := json.Marshal(upload)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update upload session"})
-		return
+	// Update in Redis and PostgreSQL
+	if err := m.saveUpload(upload); err != nil {
+		return 0, chunkRetryError(upload, "Failed to update upload session", err)
 	}
+	m.publishChunkReceived(upload, chunkIndex)
+	return receivedCount, nil
+}
 
-	ctx := context.Background()
-	if err := m.redis.Set(ctx, "chunk_upload:"+uploadID, uploadJSON, m.config.ChunkTimeout).Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update upload session"})
+// CompleteUpload queues the assembly of a chunked upload once every chunk arrived, answering
+// with the job to follow
+//
+// @summary Finish a chunked upload
+// @tags chunk
+// @path upload_id Upload ID
+// @success 202 json The file is being assembled; follow the job
+func (m *ChunkUploadManager) CompleteUpload(c *gin.Context) {
+	// Get file service from context
+	fileService, exists := c.Get("fileService")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "File service not available"})
 		return
 	}
 
-	// Check if all chunks received
-	allReceived := true
-	receivedCount := 0
-	for _, received := range upload.ReceivedChunks {
-		if received {
-			receivedCount++
-		} else {
-			allReceived = false
-		}
+	job, apiErr := m.finishUpload(c.Param("upload_id"), fileService.(*FileService))
+	if apiErr != nil {
+		apiErr.respond(c)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":         "Chunk uploaded successfully",
-		"chunk_index":     chunkIndex,
-		"received_chunks": receivedCount,
-		"total_chunks":    upload.TotalChunks,
-		"complete":        allReceived,
+	// Return job ID immediately for client polling
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":  job.JobID,
+		"file_id": job.FileID,
+		"status":  "pending",
+		"message": "File processing started. Use the file_id to check status at /api/file/{file_id}/status, or stream progress from /api/job/{job_id}/events",
 	})
 }
 
-func (m *ChunkUploadManager) CompleteUpload(c *gin.Context) {
-	uploadID := c.Param("upload_id")
-
-	// Get upload from memory or Redis
-	uploadValue, exists := m.uploads.Load(uploadID)
-	if !exists {
-		ctx := context.Background()
-		uploadJSON, err := m.redis.Get(ctx, "chunk_upload:"+uploadID).Result()
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
-			return
-		}
-
-		var upload ChunkUpload
-		if err := json.Unmarshal([]byte(uploadJSON), &upload); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse upload session"})
-			return
-		}
-
-		uploadValue = &upload
-		m.uploads.Store(uploadID, uploadValue)
+// finishUpload queues the assembly of an upload whose chunks all arrived, returning the
+// job assembling it
+func (m *ChunkUploadManager) finishUpload(uploadID string, fs *FileService) (*ProcessingJob, *apiError) {
+	// Get upload from memory, Redis or PostgreSQL
+	upload, err := m.loadUpload(uploadID)
+	if err != nil {
+		log.Printf("Failed to load upload session %s: %v", uploadID, err)
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to parse upload session")
+	}
+	if upload == nil {
+		return nil, newAPIError(http.StatusNotFound, "Upload session not found")
 	}
-
-	upload := uploadValue.(*ChunkUpload)
 
 	// Check if all chunks received
-	for i, received := range upload.ReceivedChunks {
-		if !received {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":         "Missing chunks",
-				"missing_chunk": i,
-			})
-			return
-		}
+	if missing := upload.firstMissing(); missing >= 0 {
+		return nil, &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error":         "Missing chunks",
+			"missing_chunk": missing,
+		}}
+	}
+
+	// Persist the complete session so a restart during processing can't lose it
+	upload.mu.Lock()
+	upload.persistedAt = time.Time{}
+	upload.mu.Unlock()
+	if err := m.saveUpload(upload); err != nil {
+		log.Printf("Failed to save upload session %s: %v", uploadID, err)
 	}
 
 	// Create processing job for background processing
-	fileID := generateFileID()
-	jobID := generateFileID() // Reuse the same function for job ID
+	fileID, err := newFileID(m.config, m.db)
+	if err != nil {
+		log.Printf("Failed to allocate a file ID for upload %s: %v", uploadID, err)
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to create processing job")
+	}
+	jobID := generateID()
 
 	job := &ProcessingJob{
 		JobID:     jobID,
@@ -511,23 +912,14 @@ func (m *ChunkUploadManager) CompleteUpload(c *gin.Context) {
 		FileID:    fileID,
 		Status:    "pending",
 		Progress:  0,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: m.clock.Now(),
+		UpdatedAt: m.clock.Now(),
 	}
 
-	// Store job in memory and Redis
-	m.jobs.Store(jobID, job)
+	// Store job in memory and Redis, and remember it for the upload's status WebSocket
+	m.updateJob(job)
 	ctx := context.Background()
-	jobJSON, _ := json.Marshal(job)
-	m.redis.Set(ctx, "processing_job:"+jobID, jobJSON, 24*time.Hour)
-
-	// Get file service from context
-	fileService, exists := c.Get("fileService")
-	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "File service not available"})
-		return
-	}
-	fs := fileService.(*FileService)
+	m.redis.Set(ctx, "upload_job:"+uploadID, jobID, 24*time.Hour)
 
 	// Store initial processing status in Redis for file status endpoint
 	statusJSON, _ := json.Marshal(map[string]interface{}{
@@ -537,16 +929,14 @@ func (m *ChunkUploadManager) CompleteUpload(c *gin.Context) {
 	})
 	fs.redis.Set(ctx, "processing:"+fileID, statusJSON, 1*time.Hour)
 
-	// Start background processing
-	go m.processFileInBackground(job, upload, fs)
-
-	// Return job ID immediately for client polling
-	c.JSON(http.StatusAccepted, gin.H{
-		"job_id":  jobID,
-		"file_id": fileID,
-		"status":  "pending",
-		"message": "File processing started. Use the file_id to check status at /api/file/{file_id}/status",
-	})
+	// Queue for a worker; fall back to processing here if the queue is unavailable
+	if fs.jobQueue == nil {
+		go m.processFileInBackground(job, upload, fs)
+	} else if err := fs.jobQueue.Enqueue(job); err != nil {
+		log.Printf("Failed to enqueue job %s, processing in-process: %v", jobID, err)
+		go m.processFileInBackground(job, upload, fs)
+	}
+	return job, nil
 }
 
 func (m *ChunkUploadManager) processFileInBackground(job *ProcessingJob, upload *ChunkUpload, fs *FileService) {
@@ -556,64 +946,101 @@ func (m *ChunkUploadManager) processFileInBackground(job *ProcessingJob, upload
 	// Update job status to processing
 	job.Status = "processing"
 	job.Progress = 10
-	job.UpdatedAt = time.Now()
+	job.UpdatedAt = m.clock.Now()
 	m.updateJob(job)
 
 	// Assemble file from chunks with streaming approach
 	log.Printf("Assembling file from chunks for file ID: %s", job.FileID)
-	assembledFile, err := m.assembleFileStreaming(upload, job.FileID)
+	assembledFile, contentHash, err := m.assembleFileStreaming(upload, job.FileID)
 	if err != nil {
 		log.Printf("Failed to assemble file %s: %v", job.FileID, err)
+		m.retryOrDeadLetter(job, "Failed to assemble file: "+err.Error())
+		return
+	}
+	defer assembledFile.Close()
+
+	// Verify the whole-file hash provided when the upload was initiated
+	if upload.FileHash != "" && !strings.EqualFold(upload.FileHash, contentHash) {
+		log.Printf("Hash mismatch for file %s (expected %s, got %s)", job.FileID, upload.FileHash, contentHash)
+		os.Remove(assembledFile.Name())
+
+		// The corrupted chunk can't be identified, so all chunks must be sent again before
+		// the upload can be completed a second time. The chunk files go too, or a restart
+		// would rebuild them as received from disk.
+		upload.resetReceived(m.clock.Now())
+		for i := 0; i < upload.TotalChunks; i++ {
+			if chunkPath, err := m.chunkPath(upload.UploadID, i); err == nil {
+				os.Remove(chunkPath)
+			}
+		}
+		if err := m.saveUpload(upload); err != nil {
+			log.Printf("Failed to reset upload session %s after hash mismatch: %v", upload.UploadID, err)
+		}
+
 		job.Status = "failed"
-		job.Error = "Failed to assemble file: " + err.Error()
-		job.UpdatedAt = time.Now()
+		job.Error = "Hash mismatch: the assembled file does not match the provided SHA-256 hash"
+		job.UpdatedAt = m.clock.Now()
 		m.updateJob(job)
-		// Store failed status in Redis instead of deleting
 		errorStatus := map[string]interface{}{
-			"status":    "failed",
-			"error":     job.Error,
-			"timestamp": time.Now().Unix(),
+			"status":        "failed",
+			"error":         job.Error,
+			"error_code":    "hash_mismatch",
+			"message":       "Upload every chunk again to the same upload_id, then complete the upload again.",
+			"retryable":     true,
+			"upload_id":     upload.UploadID,
+			"expected_hash": strings.ToLower(upload.FileHash),
+			"actual_hash":   contentHash,
+			"timestamp":     m.clock.Now().Unix(),
 		}
 		errorJSON, _ := json.Marshal(errorStatus)
 		fs.redis.Set(ctx, "processing:"+job.FileID, string(errorJSON), time.Hour*24)
 		return
 	}
-	defer assembledFile.Close()
 
 	// Update progress
 	job.Progress = 50
-	job.UpdatedAt = time.Now()
+	job.UpdatedAt = m.clock.Now()
 	m.updateJob(job)
 
 	// Get file info
 	fileInfo, err := assembledFile.Stat()
 	if err != nil {
-		job.Status = "failed"
-		job.Error = "Failed to get file info: " + err.Error()
-		job.UpdatedAt = time.Now()
-		m.updateJob(job)
-		// Clean up processing status on failure
-		fs.redis.Del(ctx, "processing:"+job.FileID)
+		os.Remove(assembledFile.Name())
+		m.retryOrDeadLetter(job, "Failed to get file info: "+err.Error())
+		return
+	}
+
+	// Scan the assembled file before it becomes downloadable
+	scanResult, err := fs.scanContent(assembledFile, fileInfo.Size())
+	if err != nil {
+		log.Printf("Virus scan of file %s failed: %v", job.FileID, err)
+		os.Remove(assembledFile.Name())
+		m.retryOrDeadLetter(job, "Virus scan failed: "+err.Error())
+		return
+	}
+	if scanResult != nil && scanResult.Status == ScanStatusInfected {
+		m.rejectInfectedUpload(job, upload, assembledFile, scanResult, fs)
+		return
+	}
+	if _, err := assembledFile.Seek(0, 0); err != nil {
+		os.Remove(assembledFile.Name())
+		m.retryOrDeadLetter(job, "Failed to rewind assembled file: "+err.Error())
 		return
 	}
 
 	// Store file with streaming approach
 	log.Printf("Storing assembled file for file ID: %s", job.FileID)
-	result, err := m.storeAssembledFileStreaming(fs, job.FileID, upload.Filename, assembledFile, upload.DownloadPassword)
+	result, err := m.storeAssembledFileStreaming(fs, job.FileID, upload, assembledFile, contentHash, scanResult)
 	if err != nil {
 		log.Printf("Failed to store file %s: %v", job.FileID, err)
-		job.Status = "failed"
-		job.Error = "Failed to store file: " + err.Error()
-		job.UpdatedAt = time.Now()
-		m.updateJob(job)
-		// Clean up processing status on failure
-		fs.redis.Del(ctx, "processing:"+job.FileID)
+		os.Remove(assembledFile.Name())
+		m.retryOrDeadLetter(job, "Failed to store file: "+err.Error())
 		return
 	}
 
 	// Update progress
 	job.Progress = 90
-	job.UpdatedAt = time.Now()
+	job.UpdatedAt = m.clock.Now()
 	m.updateJob(job)
 
 	// Cleanup upload session
@@ -622,6 +1049,7 @@ func (m *ChunkUploadManager) processFileInBackground(job *ProcessingJob, upload
 	// Complete job
 	job.Status = "completed"
 	job.Progress = 100
+	job.NextAttemptAt = nil
 	
 	// Extract metadata from result
 	var deletePassword string
@@ -636,89 +1064,202 @@ func (m *ChunkUploadManager) processFileInBackground(job *ProcessingJob, upload
 		Size:           fileInfo.Size(),
 		DeletePassword: deletePassword,
 	}
-	job.UpdatedAt = time.Now()
+	job.UpdatedAt = m.clock.Now()
 	m.updateJob(job)
 	
+	sliMetrics.recordJob("good")
+	fs.queueHLSTranscode(job.FileID, files.MimeType(upload.Filename), upload.TotalSize)
+
 	// Only clean up processing status on successful completion
 	log.Printf("Successfully completed background processing for file ID: %s", job.FileID)
 	fs.redis.Del(ctx, "processing:"+job.FileID)
 }
 
 func (m *ChunkUploadManager) updateJob(job *ProcessingJob) {
-	m.jobs.Store(job.JobID, job)
 	ctx := context.Background()
 	jobJSON, _ := json.Marshal(job)
 	m.redis.Set(ctx, "processing_job:"+job.JobID, jobJSON, 24*time.Hour)
+
+	// Persist to PostgreSQL so job state outlives the Redis entry
+	if err := m.db.SaveProcessingJob(job.toStorage()); err != nil {
+		log.Printf("Failed to persist job %s: %v", job.JobID, err)
+	}
+
+	// Notify event stream subscribers on any instance
+	if err := m.redis.Publish(ctx, "job_events:"+job.JobID, jobJSON).Err(); err != nil {
+		log.Printf("Failed to publish job event for %s: %v", job.JobID, err)
+	}
+	m.publishJobUpdate(job)
 }
 
+// GetJobStatus returns the state of the job assembling a chunked upload, and its file once
+// it completed
+//
+// @summary Get a processing job
+// @tags chunk
+// @path job_id Job ID
+// @success 200 ProcessingJob
 func (m *ChunkUploadManager) GetJobStatus(c *gin.Context) {
-	jobID := c.Param("job_id")
+	job, apiErr := m.jobStatus(c.Param("job_id"))
+	if apiErr != nil {
+		apiErr.respond(c)
+		return
+	}
 
-	// Get job from memory or Redis
-	jobValue, exists := m.jobs.Load(jobID)
-	if !exists {
-		ctx := context.Background()
-		jobJSON, err := m.redis.Get(ctx, "processing_job:"+jobID).Result()
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
-			return
-		}
+	c.JSON(http.StatusOK, job)
+}
 
+// jobStatus returns a job, or the error answering a request for it
+func (m *ChunkUploadManager) jobStatus(jobID string) (*ProcessingJob, *apiError) {
+	job, err := m.loadJob(jobID)
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to parse job")
+	}
+	if job == nil {
+		return nil, newAPIError(http.StatusNotFound, "Job not found")
+	}
+	return job, nil
+}
+
+// loadJob returns a job from Redis or PostgreSQL, or nil if it can't be found. Jobs may be
+// processed by another process, so there is no in-memory copy to consult.
+func (m *ChunkUploadManager) loadJob(jobID string) (*ProcessingJob, error) {
+	ctx := context.Background()
+	jobJSON, err := m.redis.Get(ctx, "processing_job:"+jobID).Result()
+	if err == nil {
 		var job ProcessingJob
 		if err := json.Unmarshal([]byte(jobJSON), &job); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse job"})
-			return
+			return nil, err
 		}
-
-		jobValue = &job
-		m.jobs.Store(jobID, jobValue)
+		return &job, nil
 	}
 
-	job := jobValue.(*ProcessingJob)
-	c.JSON(http.StatusOK, job)
+	stored, err := m.db.GetProcessingJob(jobID)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	return processingJobFromStorage(stored), nil
 }
 
-func (m *ChunkUploadManager) assembleFileStreaming(upload *ChunkUpload, fileID string) (*os.File, error) {
+// assembleFileStreaming combines the chunks into a single file and returns it along with
+// the hex-encoded SHA-256 of the assembled content. The target is pre-allocated and chunks
+// are written concurrently at their offsets; each chunk is read once and the same buffer is
+// handed to an in-order hasher, so the chunks are never read twice.
+func (m *ChunkUploadManager) assembleFileStreaming(upload *ChunkUpload, fileID string) (*os.File, string, error) {
 	// Check available disk space before assembly
 	if err := m.checkDiskSpace(upload.TotalSize * 2); err != nil {
-		return nil, fmt.Errorf("insufficient disk space: %v", err)
+		return nil, "", fmt.Errorf("insufficient disk space: %v", err)
 	}
 
 	// Create final file
-	finalPath := filepath.Join(m.config.TempDir, fileID+"_assembled")
+	finalPath, err := storage.SafeJoin(m.config.TempDir, fileID+"_assembled")
+	if err != nil {
+		return nil, "", err
+	}
 	finalFile, err := os.Create(finalPath)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// Assemble chunks in order
-	for i := 0; i < upload.TotalChunks; i++ {
-		chunkPath := filepath.Join(m.config.TempDir, upload.UploadID, fmt.Sprintf("chunk_%d", i))
-		chunkFile, err := os.Open(chunkPath)
-		if err != nil {
-			finalFile.Close()
-			os.Remove(finalPath)
-			return nil, err
+	fail := func(err error) (*os.File, string, error) {
+		finalFile.Close()
+		os.Remove(finalPath)
+		return nil, "", err
+	}
+
+	// Pre-allocate so chunks can be written at their offsets in any order
+	if err := finalFile.Truncate(upload.TotalSize); err != nil {
+		return fail(err)
+	}
+
+	workers := m.config.ChunkAssemblyWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	group, ctx := errgroup.WithContext(context.Background())
+	group.SetLimit(workers)
+
+	// Chunk buffers are held from the read until they have been hashed. Slots are taken in
+	// chunk order, so the chunk the hasher waits for always has one and memory stays bounded
+	// to workers+1 chunks.
+	buffered := make(chan struct{}, workers+1)
+	ready := make([]chan []byte, upload.TotalChunks)
+	for i := range ready {
+		ready[i] = make(chan []byte, 1)
+	}
+
+	// SHA-256 is sequential, so hash the chunks in order while the writes proceed in parallel
+	type hashResult struct {
+		sum string
+		err error
+	}
+	hashDone := make(chan hashResult, 1)
+	go func() {
+		hasher := sha256.New()
+		for i := 0; i < upload.TotalChunks; i++ {
+			var data []byte
+			select {
+			case data = <-ready[i]:
+			default:
+				select {
+				case data = <-ready[i]:
+				case <-ctx.Done():
+					hashDone <- hashResult{err: ctx.Err()}
+					return
+				}
+			}
+			hasher.Write(data)
+			<-buffered
 		}
+		hashDone <- hashResult{sum: hex.EncodeToString(hasher.Sum(nil))}
+	}()
 
-		if _, err := io.Copy(finalFile, chunkFile); err != nil {
-			chunkFile.Close()
-			finalFile.Close()
-			os.Remove(finalPath)
-			return nil, err
+launch:
+	for i := 0; i < upload.TotalChunks; i++ {
+		select {
+		case buffered <- struct{}{}:
+		case <-ctx.Done():
+			break launch
 		}
 
-		chunkFile.Close()
+		index := i
+		group.Go(func() error {
+			path, err := m.chunkPath(upload.UploadID, index)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if expected := upload.expectedChunkSize(index); int64(len(data)) != expected {
+				return fmt.Errorf("chunk %d has %d bytes, expected %d", index, len(data), expected)
+			}
+
+			if _, err := finalFile.WriteAt(data, int64(index)*upload.ChunkSize); err != nil {
+				return err
+			}
+			ready[index] <- data
+			return nil
+		})
+	}
+
+	writeErr := group.Wait()
+	hash := <-hashDone
+	if writeErr != nil {
+		return fail(writeErr)
+	}
+	if hash.err != nil {
+		return fail(hash.err)
 	}
 
 	// Reset file pointer to beginning
 	if _, err := finalFile.Seek(0, 0); err != nil {
-		finalFile.Close()
-		os.Remove(finalPath)
-		return nil, err
+		return fail(err)
 	}
 
-	return finalFile, nil
+	return finalFile, hash.sum, nil
 }
 
 // checkDiskSpace checks if there's enough available disk space
@@ -745,7 +1286,10 @@ func (m *ChunkUploadManager) checkDiskSpace(requiredBytes int64) error {
 	return nil
 }
 
-func (m *ChunkUploadManager) storeAssembledFileStreaming(fs *FileService, fileID, filename string, file *os.File, downloadPassword string) (map[string]interface{}, error) {
+func (m *ChunkUploadManager) storeAssembledFileStreaming(fs *FileService, fileID string, upload *ChunkUpload, file *os.File, contentHash string, scanResult *ScanResult) (map[string]interface{}, error) {
+	filename := upload.Filename
+	downloadPassword := upload.DownloadPassword
+
 	// Get file size
 	fileInfo, err := file.Stat()
 	if err != nil {
@@ -756,15 +1300,16 @@ func (m *ChunkUploadManager) storeAssembledFileStreaming(fs *FileService, fileID
 	// Read file content for storage decision
 	var content []byte
 
-	// For very large files (>100MB), store directly on disk without compression
-	if fileSize > 100*1024*1024 {
+	// For very large files (>100MB) and the fast-ssd class, store directly on disk without
+	// compression. Large archive-class files are also copied as-is to avoid loading them
+	// into memory.
+	storageClass := upload.storageClass()
+	if fileSize > 100*1024*1024 || storageClass == StorageClassFastSSD {
 		// Store large file directly without loading into memory
-		filesDir := filepath.Join(fs.config.TempDir, "files")
-		if err := os.MkdirAll(filesDir, 0755); err != nil {
+		storagePath, err := storageClassPath(fs.config, storageClass, fileID)
+		if err != nil {
 			return nil, err
 		}
-		
-		storagePath := filepath.Join(filesDir, fileID)
 
 		// Create directory if needed
 		if err := os.MkdirAll(filepath.Dir(storagePath), 0755); err != nil {
@@ -789,12 +1334,20 @@ func (m *ChunkUploadManager) storeAssembledFileStreaming(fs *FileService, fileID
 		}
 
 		// Generate random delete password
-		deletePassword := generateRandomPassword()
+		deletePassword := files.GeneratePassword()
 		
 		// Create metadata for large file
-		now := time.Now()
-		expiresAt := now.Add(24 * time.Hour)
-		detectedMimeType := GetMimeType(filename)
+		now := m.clock.Now()
+		retention := fs.retentionForKeyID(upload.APIKeyID)
+		expiresAt := now.Add(retention)
+		detectedMimeType := files.MimeType(filename)
+
+		var imageInfo *ImageInfo
+		if files.IsImageFile(detectedMimeType) {
+			if _, err := file.Seek(0, 0); err == nil {
+				imageInfo = extractImageInfoFromReader(file)
+			}
+		}
 		
 		metadata := FileMetadata{
 			ID:                  fileID,
@@ -807,11 +1360,15 @@ func (m *ChunkUploadManager) storeAssembledFileStreaming(fs *FileService, fileID
 			DeletePassword:      deletePassword,
 			DownloadPassword:    downloadPassword,
 			HasDownloadPassword: downloadPassword != "",
+			Image:               imageInfo,
+			SHA256:              contentHash,
+			StorageClass:        storageClass,
+			Scan:                scanResult,
 		}
 		
 		// Store file reference and metadata in Redis
 		ctx := context.Background()
-		expiration := 24 * time.Hour
+		expiration := retention
 		
 		// Store file metadata in PostgreSQL
 		fileStorage := &FileStorage{
@@ -829,12 +1386,18 @@ func (m *ChunkUploadManager) storeAssembledFileStreaming(fs *FileService, fileID
 			DeletePassword:     deletePassword,
 			DownloadPassword:   nil,
 			HasDownloadPassword: downloadPassword != "",
+			ImageInfo:          imageInfo,
+			ContentHash:        &contentHash,
+			StorageClass:       string(storageClass),
+			ScanResult:         scanResult,
 		}
 
 		if downloadPassword != "" {
 			fileStorage.DownloadPassword = &downloadPassword
 		}
 
+		upload.applyOwner(fileStorage)
+
 		if err := fs.db.SaveFile(fileStorage); err != nil {
 			return nil, fmt.Errorf("failed to save file metadata to database: %v", err)
 		}
@@ -858,14 +1421,17 @@ func (m *ChunkUploadManager) storeAssembledFileStreaming(fs *FileService, fileID
 		return nil, err
 	}
 
-	return m.storeAssembledFile(fs, fileID, filename, content, downloadPassword)
+	return m.storeAssembledFile(fs, fileID, upload, content, contentHash, scanResult)
 }
 
-func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID, filename string, content []byte, downloadPassword string) (map[string]interface{}, error) {
+func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID string, upload *ChunkUpload, content []byte, contentHash string, scanResult *ScanResult) (map[string]interface{}, error) {
 	ctx := context.Background()
+	filename := upload.Filename
+	downloadPassword := upload.DownloadPassword
 
 	// Generate random delete password
-	deletePassword := generateRandomPassword()
+	deletePassword := files.GeneratePassword()
+	storageClass := upload.storageClass()
 
 	// For large files, skip compression to avoid memory issues
 	var compressedContent []byte
@@ -878,7 +1444,7 @@ func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID, filenam
 		fmt.Printf("Skipping compression for large file: %s (%d bytes)\n", filename, len(content))
 	} else {
 		// Select compression type
-		compressionType = fs.compressor.SelectCompressionType(filename, int64(len(content)))
+		compressionType = compressionForClass(fs.compressor, storageClass, filename, int64(len(content)))
 
 		// Compress file
 		var err error
@@ -888,11 +1454,17 @@ func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID, filenam
 		}
 	}
 
-	// Create metadata with 24-hour expiration
-	now := time.Now()
-	expiresAt := now.Add(24 * time.Hour)
+	// Create metadata expiring after the retention period
+	now := m.clock.Now()
+	retention := fs.retentionForKeyID(upload.APIKeyID)
+	expiresAt := now.Add(retention)
 
-	detectedMimeType := GetMimeType(filename)
+	detectedMimeType := files.MimeType(filename)
+
+	var imageInfo *ImageInfo
+	if files.IsImageFile(detectedMimeType) {
+		imageInfo = extractImageInfo(content)
+	}
 
 	metadata := FileMetadata{
 		ID:                  fileID,
@@ -906,18 +1478,25 @@ func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID, filenam
 		DeletePassword:      deletePassword,
 		DownloadPassword:    downloadPassword,
 		HasDownloadPassword: downloadPassword != "",
+		Image:               imageInfo,
+		SHA256:              contentHash,
+		StorageClass:        storageClass,
+		Scan:                scanResult,
 	}
 
-	// Determine storage strategy based on file size
+	// Determine storage strategy based on storage class and file size
 	var storageType string
 	var storagePath *string
 	var fileContent []byte
 	
-	// For very large files (>1GB), store on disk; otherwise store in PostgreSQL
-	if len(compressedContent) > 1024*1024*1024 { // 1GB threshold
+	// Store on disk for disk-backed classes and very large files (>1GB); otherwise in PostgreSQL
+	if storeOnDisk(storageClass, int64(len(compressedContent))) {
 		storageType = "disk"
-		// Store file on disk
-		diskPath := filepath.Join(m.config.TempDir, "files", fileID)
+		// Store file in the class's storage directory
+		diskPath, err := storageClassPath(m.config, storageClass, fileID)
+		if err != nil {
+			return nil, err
+		}
 		if err := os.MkdirAll(filepath.Dir(diskPath), 0755); err != nil {
 			return nil, fmt.Errorf("failed to create file directory: %v", err)
 		}
@@ -951,12 +1530,18 @@ func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID, filenam
 		DeletePassword:     deletePassword,
 		DownloadPassword:   nil,
 		HasDownloadPassword: downloadPassword != "",
+		ImageInfo:          imageInfo,
+		ContentHash:        &contentHash,
+		StorageClass:       string(storageClass),
+		ScanResult:         scanResult,
 	}
 
 	if downloadPassword != "" {
 		fileStorage.DownloadPassword = &downloadPassword
 	}
 
+	upload.applyOwner(fileStorage)
+
 	if err := fs.db.SaveFile(fileStorage); err != nil {
 		// If database save fails, clean up disk file if it was created
 		if storageType == "disk" && storagePath != nil {
@@ -968,7 +1553,7 @@ func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID, filenam
 	// Cache metadata in Redis for faster access (optional)
 	metadataJSON, err := json.Marshal(metadata)
 	if err == nil {
-		expiration := 24 * time.Hour
+		expiration := retention
 		fs.redis.Set(ctx, "file:"+fileID, metadataJSON, expiration)
 	}
 
@@ -979,39 +1564,29 @@ func (m *ChunkUploadManager) storeAssembledFile(fs *FileService, fileID, filenam
 	}, nil
 }
 
+// GetUploadStatus reports which chunks of an upload arrived
+//
+// @summary Get the progress of a chunked upload
+// @tags chunk
+// @path upload_id Upload ID
+// @success 200 json
 func (m *ChunkUploadManager) GetUploadStatus(c *gin.Context) {
 	uploadID := c.Param("upload_id")
 
-	// Get upload from memory or Redis
-	uploadValue, exists := m.uploads.Load(uploadID)
-	if !exists {
-		ctx := context.Background()
-		uploadJSON, err := m.redis.Get(ctx, "chunk_upload:"+uploadID).Result()
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
-			return
-		}
-
-		var upload ChunkUpload
-		if err := json.Unmarshal([]byte(uploadJSON), &upload); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse upload session"})
-			return
-		}
-
-		uploadValue = &upload
-		m.uploads.Store(uploadID, uploadValue)
+	// Get upload from memory, Redis or PostgreSQL
+	upload, err := m.loadUpload(uploadID)
+	if err != nil {
+		log.Printf("Failed to load upload session %s: %v", uploadID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse upload session"})
+		return
 	}
-
-	upload := uploadValue.(*ChunkUpload)
-
-	// Count received chunks
-	receivedCount := 0
-	for _, received := range upload.ReceivedChunks {
-		if received {
-			receivedCount++
-		}
+	if upload == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+		return
 	}
 
+	receivedCount := upload.receivedCount()
+
 	c.JSON(http.StatusOK, gin.H{
 		"upload_id":       upload.UploadID,
 		"filename":        upload.Filename,
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Delays suggested to clients retrying a chunk after a transient failure. A full disk
+// takes cleanup or an operator to recover from, so clients back off longer.
+const (
+	chunkRetryDelay         = 2 * time.Second
+	chunkRetryDelayDiskFull = 30 * time.Second
+)
+
+// chunkRetryAfter returns how long a client should wait before resending a chunk that
+// failed with err, and the status to answer with
+func chunkRetryAfter(err error) (time.Duration, int) {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return chunkRetryDelayDiskFull, http.StatusInsufficientStorage
+	}
+	return chunkRetryDelay, http.StatusServiceUnavailable
+}
+
+// retryableChunkError answers a chunk request that failed for a reason that may pass,
+// like a full disk or a Redis timeout, with retryable set, the suggested backoff and,
+// when the session is known, the chunks the server holds, so the client resends only
+// the missing ones instead of restarting the upload
+func retryableChunkError(c *gin.Context, upload *ChunkUpload, message string, err error) {
+	chunkRetryError(upload, message, err).respond(c)
+}
+
+// chunkRetryError is retryableChunkError, returning the error instead of writing it
+func chunkRetryError(upload *ChunkUpload, message string, err error) *apiError {
+	log.Printf("Chunk upload failed, client may retry: %s: %v", message, err)
+	delay, status := chunkRetryAfter(err)
+	code := errorCodeUnavailable
+	if status == http.StatusInsufficientStorage {
+		code = errorCodeDiskFull
+	}
+
+	response := gin.H{
+		"error":     message,
+		"retryable": true,
+	}
+	if upload != nil {
+		missing := upload.missingChunks()
+		response["upload_id"] = upload.UploadID
+		response["received_chunks"] = upload.TotalChunks - len(missing)
+		response["total_chunks"] = upload.TotalChunks
+		response["missing_chunks"] = missing
+	}
+	return retryLaterError(status, code, delay, response)
+}
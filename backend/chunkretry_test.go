@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRetryableChunkError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upload := &ChunkUpload{UploadID: "up1", TotalChunks: 4, ReceivedChunks: []bool{true, false, true, false}}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	retryableChunkError(c, upload, "Failed to save chunk", fmt.Errorf("write chunk: %w", syscall.ENOSPC))
+	if w.Code != http.StatusInsufficientStorage || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("disk full: got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	var resp struct {
+		Retryable      bool  `json:"retryable"`
+		RetryAfter     int   `json:"retry_after_seconds"`
+		ReceivedChunks int   `json:"received_chunks"`
+		MissingChunks  []int `json:"missing_chunks"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !resp.Retryable || resp.RetryAfter != 30 || resp.ReceivedChunks != 2 || fmt.Sprint(resp.MissingChunks) != "[1 3]" {
+		t.Errorf("response = %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	retryableChunkError(c, nil, "Failed to load upload session", fmt.Errorf("redis: i/o timeout"))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("timeout: got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,187 @@
+// Package client is a Go client of the ONE API.
+//
+// The methods and types in client_gen.go are generated from the OpenAPI description the
+// service serves at /api/openapi.json; run go generate in the backend directory after
+// changing a handler's annotations. Methods answering JSON decode it into the described
+// type, or a map when the response isn't described by one; the others return the
+// *http.Response, whose body the caller must close.
+//
+//	c := client.New("https://files.example.com")
+//	c.APIKey = os.Getenv("ONE_API_KEY")
+//	uploaded, err := c.UploadFile(ctx, &client.UploadFileForm{
+//		File: &client.FormFile{Name: "report.pdf", Content: f},
+//	}, nil)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API of one server
+type Client struct {
+	BaseURL    string       // Where the server is, without /api
+	HTTPClient *http.Client // http.DefaultClient when nil
+	APIKey     string       // Sent as X-API-Key when set
+	AdminToken string       // Sent as Authorization: Bearer when set, from AdminAuth
+}
+
+// New returns a client of the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// APIError is an error response of the API
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"error"`
+	Detail     string `json:"message,omitempty"`
+
+	// Set on responses telling the client to come back later, like 429 and 503: why, such
+	// as rate_limited or server_busy, and how long to wait before retrying
+	Code       string        `json:"error_code,omitempty"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Message, e.Detail)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// FormFile is a file sent in a multipart form
+type FormFile struct {
+	Name    string
+	Content io.Reader
+}
+
+// request is one call of the API
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	header      http.Header
+	body        io.Reader
+	contentType string
+}
+
+// do sends a request, turning error responses into an *APIError
+func (c *Client) do(ctx context.Context, r request) (*http.Response, error) {
+	target := c.BaseURL + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, target, r.body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	if c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		if apiErr.Code == "" {
+			apiErr.Code = resp.Header.Get("X-Error-Code")
+		}
+		apiErr.RetryAfter = retryAfter(resp.Header.Get("Retry-After"))
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// doJSON sends a request and decodes its JSON response into out
+func (c *Client) doJSON(ctx context.Context, r request, out any) error {
+	resp, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jsonBody encodes a request body
+func jsonBody(v any) (io.Reader, string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(data), "application/json", nil
+}
+
+// formPart is a field or file of a multipart form
+type formPart struct {
+	name  string
+	value string
+	file  *FormFile
+}
+
+// multipartBody streams a multipart form, so files aren't held in memory
+func multipartBody(parts []formPart) (io.Reader, string) {
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		for _, part := range parts {
+			if part.file == nil {
+				if err := form.WriteField(part.name, part.value); err != nil {
+					writer.CloseWithError(err)
+					return
+				}
+				continue
+			}
+			w, err := form.CreateFormFile(part.name, part.file.Name)
+			if err == nil {
+				_, err = io.Copy(w, part.file.Content)
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+		writer.CloseWithError(form.Close())
+	}()
+	return reader, form.FormDataContentType()
+}
@@ -0,0 +1,2880 @@
+// Code generated by cmd/openapi from openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// APIKeyRequest is a schema of the API
+type APIKeyRequest struct {
+	ClientCertIdentity string   `json:"client_cert_identity,omitempty"` // Client certificate identity that authenticates as the key; empty removes the mapping
+	EgressQuotaBytes   int64    `json:"egress_quota_bytes,omitempty"`   // Bytes the key may download per month; 0 means unlimited
+	ExpiresAt          string   `json:"expires_at,omitempty"`
+	Name               string   `json:"name,omitempty"`
+	OrgID              string   `json:"org_id,omitempty"` // Organization the key is a member of, and its role there; an empty org_id leaves the org
+	OrgRole            string   `json:"org_role,omitempty"`
+	QuotaBytes         int64    `json:"quota_bytes,omitempty"`
+	QuotaFiles         int      `json:"quota_files,omitempty"`
+	RateLimit          int      `json:"rate_limit,omitempty"`
+	StorageClasses     []string `json:"storage_classes,omitempty"` // Storage classes the key may request; an empty list allows all classes
+}
+
+// AbuseRequest is a schema of the API
+type AbuseRequest struct {
+	IP    string `json:"ip,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// Accessibility is the text an uploader wrote to describe a file
+type Accessibility struct {
+	AltText     string `json:"alt_text,omitempty"`    // Replaces an image for screen readers
+	Caption     string `json:"caption,omitempty"`     // Shown next to the file
+	Description string `json:"description,omitempty"` // Longer account of media content
+}
+
+// AccessibilityRequest replaces the accessibility text of a file
+type AccessibilityRequest struct {
+	AltText     string `json:"alt_text,omitempty"`
+	Caption     string `json:"caption,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ActiveUploadsRequest is a schema of the API
+type ActiveUploadsRequest struct {
+	APIKeyID       string `json:"api_key_id,omitempty"`
+	ClientIP       string `json:"client_ip,omitempty"`
+	Limit          int    `json:"limit,omitempty"`
+	MinIdleSeconds int64  `json:"min_idle_seconds,omitempty"` // Only sessions idle at least this long
+	Sort           string `json:"sort,omitempty"`             // created_at (default), last_activity or total_size
+}
+
+// AdminAuthResponse is a schema of the API
+type AdminAuthResponse struct {
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Token     string `json:"token,omitempty"`
+}
+
+// AdminFileListRequest pages, filters and sorts the admin file list
+type AdminFileListRequest struct {
+	Limit       int    `json:"limit,omitempty"`
+	MIMEType    string `json:"mime_type,omitempty"` // Exact type, or a prefix like "image/"
+	Offset      int    `json:"offset,omitempty"`
+	Order       string `json:"order,omitempty"`        // "asc" or "desc" (default)
+	Search      string `json:"search,omitempty"`       // Filename substring, case-insensitive
+	Sort        string `json:"sort,omitempty"`         // uploaded_at, expires_at, filename or size
+	StorageType string `json:"storage_type,omitempty"` // "postgresql" or "disk"
+}
+
+// AdminRequest is a schema of the API
+type AdminRequest struct {
+	AdminPassword string `json:"admin_password,omitempty"`
+	Username      string `json:"username,omitempty"` // Directory account signing in with AUTH_PROVIDER=ldap, whose password is AdminPassword
+}
+
+// AppendFileRequest creates an append-mode file
+type AppendFileRequest struct {
+	DownloadPassword string `json:"download_password,omitempty"`
+	Filename         string `json:"filename"`
+	StorageClass     string `json:"storage_class,omitempty"`
+}
+
+// ArchiveSubsetRequest selects archive entries by path, where a directory path selects
+// everything below it, or by listing index
+type ArchiveSubsetRequest struct {
+	Indexes []int    `json:"indexes,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+}
+
+// BandwidthStatsRequest is a schema of the API
+type BandwidthStatsRequest struct {
+	Limit  int    `json:"limit,omitempty"`
+	Period string `json:"period,omitempty"` // "YYYY-MM", defaults to the current month
+}
+
+// Base64UploadRequest is a schema of the API
+type Base64UploadRequest struct {
+	AltText          string `json:"alt_text,omitempty"` // Accessibility text, see Accessibility
+	Caption          string `json:"caption,omitempty"`
+	Content          string `json:"content"` // base64 or data URI
+	CustomID         string `json:"custom_id,omitempty"`
+	Description      string `json:"description,omitempty"`
+	DownloadPassword string `json:"download_password,omitempty"`
+	EmailTo          string `json:"email_to,omitempty"` // Comma-separated addresses to mail the link to
+	FileHash         string `json:"file_hash,omitempty"`
+	Filename         string `json:"filename,omitempty"`
+	PasswordHint     string `json:"password_hint,omitempty"`
+	Slug             string `json:"slug,omitempty"` // Vanity slug for a /f/:slug link
+	StorageClass     string `json:"storage_class,omitempty"`
+}
+
+// CallerLimits is what the caller may still do before hitting a limit
+type CallerLimits struct {
+	Concurrency *UploadConcurrency `json:"concurrency,omitempty"`
+	Egress      *EgressStatus      `json:"egress,omitempty"`
+	Org         *QuotaStatus       `json:"org,omitempty"`
+	RateLimit   *RateLimitState    `json:"rate_limit,omitempty"`
+	Sizes       *UploadSizeLimits  `json:"sizes,omitempty"`
+	Storage     *QuotaStatus       `json:"storage,omitempty"`
+}
+
+// CollectionRequest gathers existing files into a collection
+type CollectionRequest struct {
+	FileIds    []string `json:"file_ids,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	OnConflict string   `json:"on_conflict,omitempty"` // reject, rename or overwrite
+}
+
+// CostReportRequest is a schema of the API
+type CostReportRequest struct {
+	Period string `json:"period,omitempty"` // "YYYY-MM" of the egress data, defaults to the current month
+}
+
+// DeadLetterJobsRequest is a schema of the API
+type DeadLetterJobsRequest struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// DownloadPasswordRequest sets the download password of a file. An empty password removes
+// it; the field must still be given, so an empty body can't unprotect a file by accident.
+type DownloadPasswordRequest struct {
+	DownloadPassword string `json:"download_password,omitempty"`
+}
+
+// DownloadSegment is one byte range of a segmented download
+type DownloadSegment struct {
+	Index  int    `json:"index,omitempty"`
+	Length int64  `json:"length,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Range  string `json:"range,omitempty"` // Range header requesting the segment
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// EgressStatus is this month's egress with what remains of its quota
+type EgressStatus struct {
+	Period         string    `json:"period,omitempty"`
+	QuotaBytes     int64     `json:"quota_bytes,omitempty"`     // 0 = unlimited
+	RemainingBytes int64     `json:"remaining_bytes,omitempty"` // -1 when unlimited
+	ResetsAt       time.Time `json:"resets_at,omitempty"`
+	Subject        string    `json:"subject,omitempty"` // "api_key" or "ip"
+	UsedBytes      int64     `json:"used_bytes,omitempty"`
+}
+
+// FileAccessCounts totals the logged accesses of a file by type
+type FileAccessCounts struct {
+	Downloads    int64     `json:"downloads,omitempty"`
+	LastAccessAt time.Time `json:"last_access_at,omitempty"`
+	Previews     int64     `json:"previews,omitempty"`
+	Streams      int64     `json:"streams,omitempty"`
+	UniqueIps    int64     `json:"unique_ips,omitempty"`
+}
+
+// FileAccessesRequest is a schema of the API
+type FileAccessesRequest struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// FileEventsRequest is a schema of the API
+type FileEventsRequest struct {
+	After int64    `json:"after,omitempty"` // Cursor: the id of the last event received
+	Limit int      `json:"limit,omitempty"`
+	Types []string `json:"types,omitempty"`
+}
+
+// FileExportRequest exports the admin file list with its filters applied. Limit and
+// offset are ignored: all matching files are exported.
+type FileExportRequest struct {
+	Format      string `json:"format,omitempty"` // csv (default) or json
+	Limit       int    `json:"limit,omitempty"`
+	MIMEType    string `json:"mime_type,omitempty"` // Exact type, or a prefix like "image/"
+	Offset      int    `json:"offset,omitempty"`
+	Order       string `json:"order,omitempty"`        // "asc" or "desc" (default)
+	Search      string `json:"search,omitempty"`       // Filename substring, case-insensitive
+	Sort        string `json:"sort,omitempty"`         // uploaded_at, expires_at, filename or size
+	StorageType string `json:"storage_type,omitempty"` // "postgresql" or "disk"
+}
+
+// FileMetadata is a schema of the API
+type FileMetadata struct {
+	Accesses            *FileAccessCounts `json:"accesses,omitempty"`
+	Accessibility       *Accessibility    `json:"accessibility,omitempty"`
+	CompressedSize      int64             `json:"compressed_size,omitempty"`
+	Compression         string            `json:"compression,omitempty"`
+	DeletePassword      string            `json:"delete_password,omitempty"`
+	DownloadPassword    string            `json:"download_password,omitempty"`
+	ExpiresAt           time.Time         `json:"expires_at,omitempty"`
+	Filename            string            `json:"filename,omitempty"`
+	HasDownloadPassword bool              `json:"has_download_password,omitempty"`
+	ID                  string            `json:"id,omitempty"`
+	Image               *ImageInfo        `json:"image,omitempty"`
+	MIMEType            string            `json:"mime_type,omitempty"`
+	Org                 *OrgBranding      `json:"org,omitempty"`
+	Scan                *ScanResult       `json:"scan,omitempty"`
+	SHA256              string            `json:"sha256,omitempty"`
+	Size                int64             `json:"size,omitempty"`
+	StorageClass        string            `json:"storage_class,omitempty"`
+	Tags                map[string]string `json:"tags,omitempty"` // From the upload policy the file was uploaded with
+	UploadTime          time.Time         `json:"upload_time,omitempty"`
+}
+
+// FileResult is a schema of the API
+type FileResult struct {
+	DeletePassword string `json:"delete_password,omitempty"`
+	FileID         string `json:"file_id,omitempty"`
+	Filename       string `json:"filename,omitempty"`
+	Size           int64  `json:"size,omitempty"`
+	URL            string `json:"url,omitempty"`
+}
+
+// ImageInfo describes an uploaded image so clients can reserve layout space and pick
+// preview variants without downloading it
+type ImageInfo struct {
+	Format        string `json:"format,omitempty"`
+	HasAlpha      bool   `json:"has_alpha,omitempty"`
+	HasIccProfile bool   `json:"has_icc_profile,omitempty"`
+	Height        int    `json:"height,omitempty"`
+	Orientation   int    `json:"orientation,omitempty"` // EXIF orientation for JPEGs
+	Width         int    `json:"width,omitempty"`
+}
+
+// ImportRequest names a file on another instance and the passwords it needs
+type ImportRequest struct {
+	DeleteOriginal bool   `json:"delete_original,omitempty"` // Delete the file on the other instance once copied; needs delete_password
+	DeletePassword string `json:"delete_password,omitempty"` // Delete password of the file, kept for the copy
+	Password       string `json:"password,omitempty"`        // Download password of the file, kept for the copy
+	StorageClass   string `json:"storage_class,omitempty"`   // fast-ssd, standard or archive
+	URL            string `json:"url"`                       // Page (/f/:id or /f/:slug), download or metadata link of the file
+}
+
+// ImportResponse is an imported file
+type ImportResponse struct {
+	EmailedTo       []string      `json:"emailed_to,omitempty"` // Addresses the link was mailed to
+	FileID          string        `json:"file_id,omitempty"`
+	Message         string        `json:"message,omitempty"`
+	Metadata        *FileMetadata `json:"metadata,omitempty"`
+	OriginalDeleted bool          `json:"original_deleted,omitempty"` // Whether the original was deleted
+	SHA256          string        `json:"sha256,omitempty"`
+	Slug            string        `json:"slug,omitempty"`
+	SlugURL         string        `json:"slug_url,omitempty"`
+	SourceURL       string        `json:"source_url,omitempty"` // Download link of the original
+}
+
+// InitiateUploadRequest starts a chunked upload
+type InitiateUploadRequest struct {
+	ChunkSize        int64  `json:"chunk_size"`
+	DownloadPassword string `json:"download_password,omitempty"`
+	FileHash         string `json:"file_hash,omitempty"`
+	Filename         string `json:"filename"`
+	StorageClass     string `json:"storage_class,omitempty"`
+	TotalSize        int64  `json:"total_size"`
+}
+
+// LocalizedDocumentRequest creates a localized document from existing files
+type LocalizedDocumentRequest struct {
+	DefaultLang string             `json:"default_lang,omitempty"` // The first variant when empty
+	Name        string             `json:"name,omitempty"`
+	Variants    []LocalizedVariant `json:"variants,omitempty"`
+}
+
+// LocalizedVariant is the file holding one language of a localized document
+type LocalizedVariant struct {
+	FileID string `json:"file_id,omitempty"`
+	Lang   string `json:"lang,omitempty"` // BCP 47 tag, like "en" or "pt-BR"
+}
+
+// MeteringReportRequest is a schema of the API
+type MeteringReportRequest struct {
+	GroupBy string `json:"group_by,omitempty"` // "key" (default) or "org"
+	Period  string `json:"period,omitempty"`   // "YYYY-MM", defaults to the current month
+}
+
+// MimeCheckRequest checks a batch of files. With FileIDs only those files are checked;
+// otherwise Limit files from Offset.
+type MimeCheckRequest struct {
+	Apply   bool     `json:"apply,omitempty"` // Correct the mismatches found
+	FileIds []string `json:"file_ids,omitempty"`
+	Limit   int      `json:"limit,omitempty"`
+	Offset  int      `json:"offset,omitempty"`
+}
+
+// OrgBranding is shown with an organization's files
+type OrgBranding struct {
+	AccentColor string `json:"accent_color,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	LogoURL     string `json:"logo_url,omitempty"`
+}
+
+// OrgPolicy holds the rules an organization sets for its members' uploads
+type OrgPolicy struct {
+	BlockedExtensions       []string `json:"blocked_extensions,omitempty"`
+	MaxRetentionHours       int      `json:"max_retention_hours,omitempty"` // 0 keeps the server's retention
+	NameConflict            string   `json:"name_conflict,omitempty"`       // Default collision policy of members' collections
+	RequireDownloadPassword bool     `json:"require_download_password,omitempty"`
+}
+
+// OrgRequest is a schema of the API
+type OrgRequest struct {
+	Branding   *OrgBranding `json:"branding,omitempty"`
+	Name       string       `json:"name,omitempty"`
+	Policy     *OrgPolicy   `json:"policy,omitempty"`
+	QuotaBytes int64        `json:"quota_bytes,omitempty"`
+	QuotaFiles int          `json:"quota_files,omitempty"`
+}
+
+// OwnerExpirationRequest moves the expiry of a file to ExpiresAt, or ExtendHours past its
+// current expiry
+type OwnerExpirationRequest struct {
+	ExpiresAt   string `json:"expires_at,omitempty"` // RFC3339
+	ExtendHours int    `json:"extend_hours,omitempty"`
+}
+
+// ProcessingJob is a schema of the API
+type ProcessingJob struct {
+	Attempts      int         `json:"attempts,omitempty"` // Failed attempts so far, when the next one is due while retrying, and whether the job failed for good after exhausting its attempts
+	CreatedAt     time.Time   `json:"created_at,omitempty"`
+	DeadLetter    bool        `json:"dead_letter,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	FileID        string      `json:"file_id,omitempty"`
+	JobID         string      `json:"job_id,omitempty"`
+	NextAttemptAt time.Time   `json:"next_attempt_at,omitempty"`
+	Progress      int         `json:"progress,omitempty"` // 0-100
+	Result        *FileResult `json:"result,omitempty"`
+	Status        string      `json:"status,omitempty"` // pending, processing, retrying, completed, failed
+	UpdatedAt     time.Time   `json:"updated_at,omitempty"`
+	UploadID      string      `json:"upload_id,omitempty"`
+}
+
+// PublicStats are the rounded totals /api/stats publishes
+type PublicStats struct {
+	CacheMaxAgeSeconds int64 `json:"cache_max_age_seconds,omitempty"`
+	TotalBytesServed   int64 `json:"total_bytes_served,omitempty"`
+	TotalFiles         int64 `json:"total_files,omitempty"`
+	UpdatedAt          int64 `json:"updated_at,omitempty"` // Unix time the totals were counted
+	UptimeSeconds      int64 `json:"uptime_seconds,omitempty"`
+}
+
+// QuotaStatus is storage usage with what remains of its quota
+type QuotaStatus struct {
+	QuotaBytes     int64  `json:"quota_bytes,omitempty"`     // 0 = unlimited
+	QuotaFiles     int    `json:"quota_files,omitempty"`     // 0 = unlimited
+	RemainingBytes int64  `json:"remaining_bytes,omitempty"` // -1 when unlimited
+	RemainingFiles int    `json:"remaining_files,omitempty"` // -1 when unlimited
+	Subject        string `json:"subject,omitempty"`         // "api_key", "ip" or "org"
+	UsedBytes      int64  `json:"used_bytes,omitempty"`
+	UsedFiles      int    `json:"used_files,omitempty"`
+}
+
+// RateLimitState is the caller's request budget in the current window, counting the
+// request asking for it
+type RateLimitState struct {
+	Limit     int       `json:"limit,omitempty"`     // Requests per minute, 0 = unlimited
+	Remaining int       `json:"remaining,omitempty"` // -1 when unlimited
+	ResetsAt  time.Time `json:"resets_at,omitempty"` // When the count restarts
+	Scope     string    `json:"scope,omitempty"`     // "api_key" or "ip"
+	Throttled bool      `json:"throttled,omitempty"` // Held to a quarter of the budget by abuse detection
+	Used      int       `json:"used,omitempty"`      // Requests made in the current window
+}
+
+// RenameRequest changes the name a file is served under
+type RenameRequest struct {
+	Filename string `json:"filename"`
+}
+
+// ScanResult is the virus scan verdict for a file
+type ScanResult struct {
+	Engine    string    `json:"engine,omitempty"`
+	ScannedAt time.Time `json:"scanned_at,omitempty"`
+	Signature string    `json:"signature,omitempty"` // Malware name reported for infected files
+	Status    string    `json:"status,omitempty"`
+}
+
+// ScanVerdict is the body of a scanner webhook delivery
+type ScanVerdict struct {
+	Engine    string `json:"engine,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
+	ID        string `json:"id,omitempty"` // Unique per delivery; retries of a delivery reuse it
+	Signature string `json:"signature,omitempty"`
+	Status    string `json:"status,omitempty"` // clean or infected
+}
+
+// SegmentPlan is how to download a file in segments
+type SegmentPlan struct {
+	FileID      string            `json:"file_id,omitempty"`
+	Filename    string            `json:"filename,omitempty"`
+	SegmentSize int64             `json:"segment_size,omitempty"`
+	Segments    []DownloadSegment `json:"segments,omitempty"`
+	SHA256      string            `json:"sha256,omitempty"`
+	Size        int64             `json:"size,omitempty"`
+	URL         string            `json:"url,omitempty"`
+}
+
+// UpdateExpirationRequest is a schema of the API
+type UpdateExpirationRequest struct {
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// UpdatePasswordRequest is a schema of the API
+type UpdatePasswordRequest struct {
+	FileID       string `json:"file_id,omitempty"`
+	NewPassword  string `json:"new_password,omitempty"`
+	PasswordType string `json:"password_type,omitempty"` // "download" or "delete"
+}
+
+// UploadCheckRequest is a schema of the API
+type UploadCheckRequest struct {
+	DownloadPassword string `json:"download_password,omitempty"`
+	Filename         string `json:"filename"`
+	SHA256           string `json:"sha256"`
+	Size             int64  `json:"size,omitempty"`
+	StorageClass     string `json:"storage_class,omitempty"`
+}
+
+// UploadConcurrency describes the upload lanes and how busy they are
+type UploadConcurrency struct {
+	ActiveUploads          int64  `json:"active_uploads,omitempty"` // Slots of the main lane held
+	Class                  string `json:"class,omitempty"`          // Where a new upload goes: "main" while a slot is free; "fast_lane" once the main lane is saturated, for uploads below small_upload_max_size; "queued" when it is saturated and there is no fast lane, or the upload is too large for it
+	MaxConcurrentUploads   int    `json:"max_concurrent_uploads,omitempty"`
+	SmallUploadConcurrency int    `json:"small_upload_concurrency,omitempty"` // Slots of the fast lane
+	SmallUploadMaxSize     int64  `json:"small_upload_max_size,omitempty"`    // 0 when the fast lane is disabled
+}
+
+// UploadPolicyRequest asks for a policy. Zero values take the defaults.
+type UploadPolicyRequest struct {
+	AllowedTypes []string          `json:"allowed_types,omitempty"` // MIME types, or families like "image/*"; any when empty
+	ExpiresIn    int               `json:"expires_in,omitempty"`    // Seconds the policy is valid; defaults to an hour
+	MaxSize      int64             `json:"max_size,omitempty"`      // Bytes; defaults to the largest simple upload
+	Tags         map[string]string `json:"tags,omitempty"`          // Attached to every file uploaded under the policy
+}
+
+// UploadPolicyResponse is a minted policy
+type UploadPolicyResponse struct {
+	AllowedTypes []string          `json:"allowed_types,omitempty"`
+	ExpiresAt    time.Time         `json:"expires_at,omitempty"`
+	KeyID        string            `json:"key_id,omitempty"`
+	MaxSize      int64             `json:"max_size,omitempty"`
+	Policy       string            `json:"policy,omitempty"` // Send as the policy field of the upload form
+	Tags         map[string]string `json:"tags,omitempty"`
+	UploadURL    string            `json:"upload_url,omitempty"` // Where the browser posts the form
+}
+
+// UploadResponse is the answer to a successful upload
+type UploadResponse struct {
+	EmailedTo []string      `json:"emailed_to,omitempty"` // Addresses the link was mailed to
+	FileID    string        `json:"file_id,omitempty"`
+	Message   string        `json:"message,omitempty"`
+	Metadata  *FileMetadata `json:"metadata,omitempty"`
+	SHA256    string        `json:"sha256,omitempty"`
+	Slug      string        `json:"slug,omitempty"`
+	SlugURL   string        `json:"slug_url,omitempty"`
+}
+
+// UploadSizeLimits are the sizes uploads of the caller must stay within
+type UploadSizeLimits struct {
+	ExtensionMaxSizes   map[string]int64 `json:"extension_max_sizes,omitempty"`
+	MaxChunkSize        int64            `json:"max_chunk_size,omitempty"`
+	MaxChunksPerFile    int              `json:"max_chunks_per_file,omitempty"`
+	MaxFileSize         int64            `json:"max_file_size,omitempty"`
+	MaxUploadSize       int64            `json:"max_upload_size,omitempty"`        // Largest file the caller can store now, within its remaining quotas
+	SimpleUploadMaxSize int64            `json:"simple_upload_max_size,omitempty"` // Larger files use chunked upload
+}
+
+// ListAbuseScores calls POST /api/admin/abuse: list abuse scores.
+//
+// Lists the scored IPs, highest score first.
+func (c *Client) ListAbuseScores(ctx context.Context, body *AbuseRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/abuse", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ClearAbuseScore calls POST /api/admin/abuse/clear: clear the abuse score of an IP.
+//
+// Forgives an IP, lifting its block.
+func (c *Client) ClearAbuseScore(ctx context.Context, body *AbuseRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/abuse/clear", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminAuth calls POST /api/admin/auth: sign in as admin.
+//
+// Exchanges the admin password, or directory credentials with AUTH_PROVIDER=ldap, for an
+// admin token.
+func (c *Client) AdminAuth(ctx context.Context, body *AdminRequest) (*AdminAuthResponse, error) {
+	r := request{method: "POST", path: "/api/admin/auth", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out AdminAuthResponse
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBandwidthStats calls POST /api/admin/bandwidth: get egress statistics.
+//
+// Returns the egress totals of a month and the files, API keys and IPs that used the
+// most. Counters reach the database within a minute of being served.
+func (c *Client) GetBandwidthStats(ctx context.Context, body *BandwidthStatsRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/bandwidth", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetCostReport calls POST /api/admin/cost-report: estimate storage costs.
+//
+// Estimates the monthly cost per storage class from the bytes currently stored and the
+// egress accounted in the period, priced as if each class were kept on object storage. It
+// helps decide which content is worth moving to a cheaper class.
+func (c *Client) GetCostReport(ctx context.Context, body *CostReportRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/cost-report", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListFileEvents calls POST /api/admin/events: list file events.
+//
+// Serves the file event log as a cursor-based feed. Consumers pass the returned
+// next_cursor as after to receive the following events; the cursor stays put when there
+// are no new events.
+func (c *Client) ListFileEvents(ctx context.Context, body *FileEventsRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/events", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateFilePassword calls PUT /api/admin/file/password: set or remove the download
+// password of a file.
+//
+// Lets admins set or remove the download password of any file.
+func (c *Client) UpdateFilePassword(ctx context.Context, body *UpdatePasswordRequest) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/admin/file/password", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminDeleteFile calls DELETE /api/admin/file/{id}: delete a file.
+//
+// Deletes any file, moving it to the trash like deleteFile.
+func (c *Client) AdminDeleteFile(ctx context.Context, id string) (map[string]any, error) {
+	r := request{method: "DELETE", path: "/api/admin/file/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetFileAccesses calls POST /api/admin/file/{id}/accesses: get the accesses of a file.
+//
+// Returns the access totals of a file, its accesses per day and the most recent accesses.
+func (c *Client) GetFileAccesses(ctx context.Context, id string, body *FileAccessesRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/file/" + url.PathEscape(id) + "/accesses", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateFileExpiration calls PUT /api/admin/file/{id}/expires: change when a file
+// expires.
+//
+// Lets admins set the expiry of any file, without the owner's limits.
+func (c *Client) UpdateFileExpiration(ctx context.Context, id string, body *UpdateExpirationRequest) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/admin/file/" + url.PathEscape(id) + "/expires", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetAdminFileList calls POST /api/admin/files: list files.
+//
+// Lists the stored files a page at a time, searched, filtered and sorted as requested.
+func (c *Client) GetAdminFileList(ctx context.Context, body *AdminFileListRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/files", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExportAdminFiles calls POST /api/admin/files/export: export the file list.
+//
+// Streams the admin file list.
+func (c *Client) ExportAdminFiles(ctx context.Context, body *FileExportRequest) (*http.Response, error) {
+	r := request{method: "POST", path: "/api/admin/files/export", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// ListDeadLetterJobs calls POST /api/admin/jobs/dead: list dead-letter jobs.
+//
+// Returns jobs that failed for good after exhausting their retries.
+func (c *Client) ListDeadLetterJobs(ctx context.Context, body *DeadLetterJobsRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/jobs/dead", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RequeueDeadLetterJob calls POST /api/admin/jobs/{job_id}/requeue: retry a dead-letter
+// job.
+//
+// Gives a dead-letter job a fresh set of attempts, as long as its upload session and
+// chunks are still around.
+func (c *Client) RequeueDeadLetterJob(ctx context.Context, jobID string) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/jobs/" + url.PathEscape(jobID) + "/requeue", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateAPIKey calls POST /api/admin/keys: create an API key.
+//
+// Issues a new API key. The key itself is only returned in this response.
+func (c *Client) CreateAPIKey(ctx context.Context, body *APIKeyRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/keys", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListAPIKeys calls POST /api/admin/keys/list: list API keys.
+//
+// Lists the API keys with their limits and usage, without the keys themselves.
+func (c *Client) ListAPIKeys(ctx context.Context) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/keys/list", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeAPIKey calls DELETE /api/admin/keys/{id}: revoke an API key.
+//
+// Revokes an API key; requests with it are rejected from then on.
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) (map[string]any, error) {
+	r := request{method: "DELETE", path: "/api/admin/keys/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateAPIKey calls PUT /api/admin/keys/{id}: change an API key.
+//
+// Changes the name, limits and org of an API key.
+func (c *Client) UpdateAPIKey(ctx context.Context, id string, body *APIKeyRequest) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/admin/keys/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeAdminToken calls POST /api/admin/logout: sign out.
+//
+// Signs the request's admin token out on every instance.
+func (c *Client) RevokeAdminToken(ctx context.Context) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/logout", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMaintenanceStatus calls POST /api/admin/maintenance: get the maintenance status.
+//
+// Reports the windows, whether maintenance may run now and the state of the jobs on this
+// instance.
+func (c *Client) GetMaintenanceStatus(ctx context.Context) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/maintenance", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMeteringReport calls POST /api/admin/metering: get metered usage.
+//
+// Returns a month's metered usage per API key or per org. Usage reaches the database
+// within a minute of happening.
+func (c *Client) GetMeteringReport(ctx context.Context, body *MeteringReportRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/metering", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CheckMimeTypes calls POST /api/admin/mime/check: check the MIME types of files against
+// their content.
+//
+// Sniffs a batch of files and reports, and optionally corrects, the types their content
+// contradicts.
+func (c *Client) CheckMimeTypes(ctx context.Context, body *MimeCheckRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/mime/check", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMimeStats calls POST /api/admin/mime/stats: count files per MIME type.
+//
+// Counts the active files and their bytes per MIME type.
+func (c *Client) GetMimeStats(ctx context.Context) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/mime/stats", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateOrg calls POST /api/admin/orgs: create an org.
+//
+// Creates an org that API keys can be assigned to.
+func (c *Client) CreateOrg(ctx context.Context, body *OrgRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/orgs", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListOrgs calls POST /api/admin/orgs/list: list orgs.
+//
+// Lists the orgs with their quotas and usage.
+func (c *Client) ListOrgs(ctx context.Context) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/orgs/list", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteOrg calls DELETE /api/admin/orgs/{id}: delete an org.
+//
+// Deletes an org.
+func (c *Client) DeleteOrg(ctx context.Context, id string) (map[string]any, error) {
+	r := request{method: "DELETE", path: "/api/admin/orgs/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateOrg calls PUT /api/admin/orgs/{id}: change an org.
+//
+// Changes the name and quotas of an org.
+func (c *Client) UpdateOrg(ctx context.Context, id string, body *OrgRequest) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/admin/orgs/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RefreshAdminToken calls POST /api/admin/refresh: refresh the admin token.
+//
+// Exchanges the request's admin token for a new one before it expires. The old token is
+// revoked, so each token can be refreshed only once.
+func (c *Client) RefreshAdminToken(ctx context.Context) (*AdminAuthResponse, error) {
+	r := request{method: "POST", path: "/api/admin/refresh", query: url.Values{}, header: http.Header{}}
+	var out AdminAuthResponse
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetReplicationStatus calls POST /api/admin/replication: get the replication status.
+//
+// Reports how far the secondary lags behind the primary.
+func (c *Client) GetReplicationStatus(ctx context.Context) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/replication", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListActiveUploads calls POST /api/admin/uploads: list chunked uploads in flight.
+//
+// Lists the in-flight chunked uploads, oldest first by default.
+func (c *Client) ListActiveUploads(ctx context.Context, body *ActiveUploadsRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/admin/uploads", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CancelActiveUpload calls DELETE /api/admin/uploads/{upload_id}: cancel a chunked
+// upload.
+//
+// Force-cancels a chunked upload, deleting its received chunks.
+func (c *Client) CancelActiveUpload(ctx context.Context, uploadID string) (map[string]any, error) {
+	r := request{method: "DELETE", path: "/api/admin/uploads/" + url.PathEscape(uploadID), query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateAppendFile calls POST /api/append: create an append-mode file.
+//
+// Creates an empty disk-backed file that can grow through appendToFile.
+func (c *Client) CreateAppendFile(ctx context.Context, body *AppendFileRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/append", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BrowseArchiveParams are the optional parameters of BrowseArchive
+type BrowseArchiveParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// BrowseArchive calls GET /api/archive/{id}: list the entries of an archive.
+//
+// Lists the entries of a ZIP or tar archive.
+func (c *Client) BrowseArchive(ctx context.Context, id string, params *BrowseArchiveParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/archive/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DownloadArchiveSubsetParams are the optional parameters of DownloadArchiveSubset
+type DownloadArchiveSubsetParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// DownloadArchiveSubset calls POST /api/archive/{id}/download: download selected entries
+// of an archive as a ZIP.
+//
+// Streams a new ZIP holding only the selected entries of an archive, so a folder can be
+// taken out of a large archive in one request.
+func (c *Client) DownloadArchiveSubset(ctx context.Context, id string, body *ArchiveSubsetRequest, params *DownloadArchiveSubsetParams) (*http.Response, error) {
+	r := request{method: "POST", path: "/api/archive/" + url.PathEscape(id) + "/download", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// ExtractArchiveFileParams are the optional parameters of ExtractArchiveFile
+type ExtractArchiveFileParams struct {
+	// Name of the entry
+	Filename string
+	// Index of the entry, instead of its name
+	Index int
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// ExtractArchiveFile calls GET /api/archive/{id}/extract: extract an entry of an archive.
+//
+// Previews a single entry of a ZIP or tar archive.
+func (c *Client) ExtractArchiveFile(ctx context.Context, id string, params *ExtractArchiveFileParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/archive/" + url.PathEscape(id) + "/extract", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Filename != "" {
+			r.query.Set("filename", params.Filename)
+		}
+		if params.Index != 0 {
+			r.query.Set("index", strconv.FormatInt(int64(params.Index), 10))
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetArchiveTreeParams are the optional parameters of GetArchiveTree
+type GetArchiveTreeParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetArchiveTree calls GET /api/archive/{id}/tree: list the entries of an archive as a
+// tree.
+//
+// Returns an archive's entries as a nested directory tree. Each file node carries its
+// entry, whose index can be passed to the extract endpoint.
+func (c *Client) GetArchiveTree(ctx context.Context, id string, params *GetArchiveTreeParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/archive/" + url.PathEscape(id) + "/tree", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetCapabilities calls GET /api/capabilities: describe server limits and features.
+//
+// Describes server limits and features so clients don't need to hard-code them.
+func (c *Client) GetCapabilities(ctx context.Context) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/capabilities", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InitiateUpload calls POST /api/chunk/initiate: start a chunked upload.
+//
+// Starts a chunked upload, answering with its ID and the number of chunks to send.
+func (c *Client) InitiateUpload(ctx context.Context, body *InitiateUploadRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/chunk/initiate", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CompleteUpload calls POST /api/chunk/{upload_id}/complete: finish a chunked upload.
+//
+// Queues the assembly of a chunked upload once every chunk arrived, answering with the
+// job to follow.
+func (c *Client) CompleteUpload(ctx context.Context, uploadID string) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/chunk/" + url.PathEscape(uploadID) + "/complete", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetUploadStatus calls GET /api/chunk/{upload_id}/status: get the progress of a chunked
+// upload.
+//
+// Reports which chunks of an upload arrived.
+func (c *Client) GetUploadStatus(ctx context.Context, uploadID string) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/chunk/" + url.PathEscape(uploadID) + "/status", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UploadChunkForm is the multipart form of UploadChunk
+type UploadChunkForm struct {
+	// The bytes of the chunk
+	Chunk *FormFile
+}
+
+// UploadChunk calls POST /api/chunk/{upload_id}/{chunk_index}: upload a chunk.
+//
+// Stores one chunk of an upload. Chunks may arrive in any order, and sending one again is
+// acknowledged without storing it twice.
+func (c *Client) UploadChunk(ctx context.Context, uploadID string, chunkIndex string, form *UploadChunkForm) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/chunk/" + url.PathEscape(uploadID) + "/" + url.PathEscape(chunkIndex), query: url.Values{}, header: http.Header{}}
+	var parts []formPart
+	if form != nil {
+		if form.Chunk != nil {
+			parts = append(parts, formPart{name: "chunk", file: form.Chunk})
+		}
+	}
+	r.body, r.contentType = multipartBody(parts)
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateCollection calls POST /api/collections: collect existing files.
+//
+// Gathers existing files into a new collection.
+func (c *Client) CreateCollection(ctx context.Context, body *CollectionRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/collections", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UploadCollectionForm is the multipart form of UploadCollection
+type UploadCollectionForm struct {
+	// The files
+	Files []FormFile
+	// Name of the collection
+	Name string
+	// What to do with duplicate names: rename, overwrite or reject
+	OnConflict string
+	// Storage class of the files
+	StorageClass string
+}
+
+// UploadCollection calls POST /api/collections/upload: upload files as a collection.
+//
+// Stores every file of a multipart request (in "files" fields) and collects them,
+// answering with each file's metadata and delete password. The upload is all or nothing:
+// when one file is rejected, the ones already stored are deleted again.
+func (c *Client) UploadCollection(ctx context.Context, form *UploadCollectionForm) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/collections/upload", query: url.Values{}, header: http.Header{}}
+	var parts []formPart
+	if form != nil {
+		for i := range form.Files {
+			parts = append(parts, formPart{name: "files", file: &form.Files[i]})
+		}
+		if form.Name != "" {
+			parts = append(parts, formPart{name: "name", value: form.Name})
+		}
+		if form.OnConflict != "" {
+			parts = append(parts, formPart{name: "on_conflict", value: form.OnConflict})
+		}
+		if form.StorageClass != "" {
+			parts = append(parts, formPart{name: "storage_class", value: form.StorageClass})
+		}
+	}
+	r.body, r.contentType = multipartBody(parts)
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetCollectionFiles calls GET /api/collections/{id}: list the files of a collection.
+//
+// Lists the files of a collection that haven't expired or been deleted.
+func (c *Client) GetCollectionFiles(ctx context.Context, id string) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/collections/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DownloadCollectionParams are the optional parameters of DownloadCollection
+type DownloadCollectionParams struct {
+	// zip or tar
+	Format string
+}
+
+// DownloadCollection calls GET /api/collections/{id}/download: download a collection as
+// one archive.
+//
+// Streams every remaining file of a collection as one ZIP or, with format=tar, tar
+// archive built on the fly.
+func (c *Client) DownloadCollection(ctx context.Context, id string, params *DownloadCollectionParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/collections/" + url.PathEscape(id) + "/download", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Format != "" {
+			r.query.Set("format", params.Format)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetDashboardParams are the optional parameters of GetDashboard
+type GetDashboardParams struct {
+	// Most files and downloads to list
+	Limit int
+	// Hours within which files count as expiring soon
+	ExpiringWithin int
+}
+
+// GetDashboard calls GET /api/dashboard: summarize the caller's account.
+//
+// Summarizes the caller's account for the dashboard view: storage and egress against
+// their quotas, and, for API keys, the active files, those expiring soon and the latest
+// downloads of them. Anonymous callers only get their usage, since files uploaded from
+// one IP address may belong to several people.
+func (c *Client) GetDashboard(ctx context.Context, params *GetDashboardParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/dashboard", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Limit != 0 {
+			r.query.Set("limit", strconv.FormatInt(int64(params.Limit), 10))
+		}
+		if params.ExpiringWithin != 0 {
+			r.query.Set("expiring_within", strconv.FormatInt(int64(params.ExpiringWithin), 10))
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListFakeData calls GET /api/dev/fixtures: list the fixture files.
+//
+// Lists the fixture files without touching them.
+func (c *Client) ListFakeData(ctx context.Context) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/dev/fixtures", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ResetFakeData calls POST /api/dev/reset: restore the fixture files.
+//
+// Restores the fixture files to their seeded state.
+func (c *Client) ResetFakeData(ctx context.Context) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/dev/reset", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ServeAPIDocs calls GET /api/docs: browse the API documentation.
+//
+// Serves interactive documentation of the API. Requests tried from it are sent to this
+// server with the credentials entered under Authorize.
+func (c *Client) ServeAPIDocs(ctx context.Context) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/docs", query: url.Values{}, header: http.Header{}}
+	return c.do(ctx, r)
+}
+
+// DeleteFileParams are the optional parameters of DeleteFile
+type DeleteFileParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// DeleteFile calls DELETE /api/file/{id}: delete a file.
+//
+// Deletes a file, moving it to the trash unless TRASH_RETENTION_HOURS is 0. It takes the
+// delete password, an API key that may manage the file, or an admin token.
+func (c *Client) DeleteFile(ctx context.Context, id string, params *DeleteFileParams) (map[string]any, error) {
+	r := request{method: "DELETE", path: "/api/file/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetFileParams are the optional parameters of GetFile
+type GetFileParams struct {
+	// Byte range to download
+	Range string
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetFile calls GET /api/file/{id}: download a file.
+//
+// Downloads a file as an attachment under its original name, serving byte ranges on
+// request.
+func (c *Client) GetFile(ctx context.Context, id string, params *GetFileParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Range != "" {
+			r.header.Set("Range", params.Range)
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// PatchFileParams are the optional parameters of PatchFile
+type PatchFileParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// PatchFile calls PATCH /api/file/{id}: rename a file, or append to an append-mode file.
+//
+// Serves PATCH /api/file/:id, which appends to append-mode files when given an offset and
+// renames the file otherwise.
+func (c *Client) PatchFile(ctx context.Context, id string, body *RenameRequest, params *PatchFileParams) (map[string]any, error) {
+	r := request{method: "PATCH", path: "/api/file/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateFileAccessibilityParams are the optional parameters of UpdateFileAccessibility
+type UpdateFileAccessibilityParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// UpdateFileAccessibility calls PUT /api/file/{id}/accessibility: replace the
+// accessibility text of a file.
+//
+// Lets the uploader of a file, proven by the delete password or an API key that may
+// manage it, replace its alt text, caption and description. Fields left out are cleared.
+func (c *Client) UpdateFileAccessibility(ctx context.Context, id string, body *AccessibilityRequest, params *UpdateFileAccessibilityParams) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/file/" + url.PathEscape(id) + "/accessibility", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReplaceFileContentForm is the multipart form of ReplaceFileContent
+type ReplaceFileContentForm struct {
+	// The new content
+	File *FormFile
+	// Expected SHA-256 of the content
+	FileHash string
+}
+
+// ReplaceFileContentParams are the optional parameters of ReplaceFileContent
+type ReplaceFileContentParams struct {
+	// Expected SHA-256 of the content, when file_hash isn't given
+	XContentSHA256 string
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// ReplaceFileContent calls PUT /api/file/{id}/content: upload a new version of a file.
+//
+// Lets the uploader of a file, proven by the delete password or an API key that may
+// manage it, push a new version of its content under the same ID and URL. The name,
+// passwords, storage class and expiry are kept. The old content is kept as a version for
+// VERSION_RETENTION; everything derived from it, like posters, rendered pages and HLS
+// renditions, is discarded.
+func (c *Client) ReplaceFileContent(ctx context.Context, id string, form *ReplaceFileContentForm, params *ReplaceFileContentParams) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/file/" + url.PathEscape(id) + "/content", query: url.Values{}, header: http.Header{}}
+	var parts []formPart
+	if form != nil {
+		if form.File != nil {
+			parts = append(parts, formPart{name: "file", file: form.File})
+		}
+		if form.FileHash != "" {
+			parts = append(parts, formPart{name: "file_hash", value: form.FileHash})
+		}
+	}
+	r.body, r.contentType = multipartBody(parts)
+	if params != nil {
+		if params.XContentSHA256 != "" {
+			r.header.Set("X-Content-SHA256", params.XContentSHA256)
+		}
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateOwnerExpirationParams are the optional parameters of UpdateOwnerExpiration
+type UpdateOwnerExpirationParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// UpdateOwnerExpiration calls PUT /api/file/{id}/expires: change when a file expires.
+//
+// Lets the uploader of a file, proven by the delete password or an API key that may
+// manage it, change when it expires within the lifetime allowed by policy.
+func (c *Client) UpdateOwnerExpiration(ctx context.Context, id string, body *OwnerExpirationRequest, params *UpdateOwnerExpirationParams) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/file/" + url.PathEscape(id) + "/expires", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FinalizeAppendFileParams are the optional parameters of FinalizeAppendFile
+type FinalizeAppendFileParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// FinalizeAppendFile calls POST /api/file/{id}/finalize: close an append-mode file.
+//
+// Closes an append-mode file; after this the normal 24-hour expiry applies.
+func (c *Client) FinalizeAppendFile(ctx context.Context, id string, params *FinalizeAppendFileParams) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/file/" + url.PathEscape(id) + "/finalize", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMetalinkParams are the optional parameters of GetMetalink
+type GetMetalinkParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetMetalink calls GET /api/file/{id}/meta4: get a Metalink 4 document of a file.
+//
+// Serves a Metalink 4 document for a file. Files uploaded in one piece carry their
+// SHA-256; the hash of chunked uploads isn't known and is left out.
+func (c *Client) GetMetalink(ctx context.Context, id string, params *GetMetalinkParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/meta4", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetFileOEmbedParams are the optional parameters of GetFileOEmbed
+type GetFileOEmbedParams struct {
+	// Only json is supported
+	Format string
+	// Largest thumbnail width
+	Maxwidth int
+	// Largest thumbnail height
+	Maxheight int
+}
+
+// GetFileOEmbed calls GET /api/file/{id}/oembed: get an oEmbed link preview of a file.
+//
+// Answers oEmbed consumers with a link preview of a file. Only the JSON format is
+// supported; a thumbnail larger than maxwidth or maxheight is left out.
+func (c *Client) GetFileOEmbed(ctx context.Context, id string, params *GetFileOEmbedParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/oembed", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Format != "" {
+			r.query.Set("format", params.Format)
+		}
+		if params.Maxwidth != 0 {
+			r.query.Set("maxwidth", strconv.FormatInt(int64(params.Maxwidth), 10))
+		}
+		if params.Maxheight != 0 {
+			r.query.Set("maxheight", strconv.FormatInt(int64(params.Maxheight), 10))
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateOwnerDownloadPasswordParams are the optional parameters of UpdateOwnerDownloadPassword
+type UpdateOwnerDownloadPasswordParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// UpdateOwnerDownloadPassword calls PUT /api/file/{id}/password: set or remove the
+// download password of a file.
+//
+// Lets the uploader of a file, proven by the delete password or an API key that may
+// manage it, set, change or remove its download password.
+func (c *Client) UpdateOwnerDownloadPassword(ctx context.Context, id string, body *DownloadPasswordRequest, params *UpdateOwnerDownloadPasswordParams) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/file/" + url.PathEscape(id) + "/password", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetFileQRParams are the optional parameters of GetFileQR
+type GetFileQRParams struct {
+	// svg for an SVG instead of a PNG
+	Format string
+	// Error correction level: L, M, Q or H
+	Level string
+	// Width of the PNG in pixels
+	Size int
+	// Put the download password in the URL
+	EmbedPassword bool
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetFileQR calls GET /api/file/{id}/qr: render a QR code of a file's download URL.
+//
+// Renders a QR code of a file's download URL on PUBLIC_URL, as a PNG or, with format=svg,
+// an SVG. With embed_password=true the URL carries the download password of a protected
+// file, which the request must give as password, so scanning downloads the file directly.
+func (c *Client) GetFileQR(ctx context.Context, id string, params *GetFileQRParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/qr", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Format != "" {
+			r.query.Set("format", params.Format)
+		}
+		if params.Level != "" {
+			r.query.Set("level", params.Level)
+		}
+		if params.Size != 0 {
+			r.query.Set("size", strconv.FormatInt(int64(params.Size), 10))
+		}
+		if params.EmbedPassword != false {
+			r.query.Set("embed_password", strconv.FormatBool(params.EmbedPassword))
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// RestoreFileParams are the optional parameters of RestoreFile
+type RestoreFileParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// RestoreFile calls POST /api/file/{id}/restore: restore a deleted file.
+//
+// Takes a deleted file out of the trash. Like deletion, it takes the delete password, an
+// API key that may manage the file, or an admin token.
+func (c *Client) RestoreFile(ctx context.Context, id string, params *RestoreFileParams) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/file/" + url.PathEscape(id) + "/restore", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetSegmentPlanParams are the optional parameters of GetSegmentPlan
+type GetSegmentPlanParams struct {
+	// Number of segments
+	Segments int
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetSegmentPlan calls GET /api/file/{id}/segments: get the checksummed segments of a
+// file.
+//
+// Serves the segment plan of a file. Checksumming reads the whole file, so plans are
+// cached per segment size; files still being appended to are always read anew.
+func (c *Client) GetSegmentPlan(ctx context.Context, id string, params *GetSegmentPlanParams) (*SegmentPlan, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/segments", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Segments != 0 {
+			r.query.Set("segments", strconv.FormatInt(int64(params.Segments), 10))
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out SegmentPlan
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetFileStatsParams are the optional parameters of GetFileStats
+type GetFileStatsParams struct {
+	// Delete password returned by the upload
+	DeletePassword string
+}
+
+// GetFileStats calls GET /api/file/{id}/stats: get the access statistics of a file.
+//
+// Shows the owner of a file, proven by the delete password or an API key that may manage
+// it, how often it was accessed and how many bytes were served of it.
+func (c *Client) GetFileStats(ctx context.Context, id string, params *GetFileStatsParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/stats", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DeletePassword != "" {
+			r.query.Set("delete_password", params.DeletePassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetFileStatus calls GET /api/file/{id}/status: get the processing status of a file.
+//
+// Returns processing status or direct access for files.
+func (c *Client) GetFileStatus(ctx context.Context, id string) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/status", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetShareSummaryParams are the optional parameters of GetShareSummary
+type GetShareSummaryParams struct {
+	// pdf for a PDF instead of HTML
+	Format string
+}
+
+// GetShareSummary calls GET /api/file/{id}/summary: render the share summary of a file.
+//
+// Renders the share summary of a file, as HTML or, with format=pdf, as a PDF.
+func (c *Client) GetShareSummary(ctx context.Context, id string, params *GetShareSummaryParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/summary", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Format != "" {
+			r.query.Set("format", params.Format)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// TailFileParams are the optional parameters of TailFile
+type TailFileParams struct {
+	// end to start at the current end of the file
+	From string
+	// Byte offset to start at
+	Offset int
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// TailFile calls GET /api/file/{id}/tail: follow an append-mode file.
+//
+// Streams bytes appended to an append-mode file as Server-Sent Events. Each "data" event
+// carries a JSON object with the byte offset and the new text, or the bytes
+// base64-encoded with "encoding": "base64" when they aren't valid UTF-8; a final
+// "finalized" event is sent once the uploader finalizes the file.
+func (c *Client) TailFile(ctx context.Context, id string, params *TailFileParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/tail", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.From != "" {
+			r.query.Set("from", params.From)
+		}
+		if params.Offset != 0 {
+			r.query.Set("offset", strconv.FormatInt(int64(params.Offset), 10))
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// ListFileVersionsParams are the optional parameters of ListFileVersions
+type ListFileVersionsParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// ListFileVersions calls GET /api/file/{id}/versions: list the versions of a file.
+//
+// Lists the current content of a file and the previous versions still kept, newest first.
+// Anyone who may download the file may list and download them.
+func (c *Client) ListFileVersions(ctx context.Context, id string, params *ListFileVersionsParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/versions", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetFileVersionParams are the optional parameters of GetFileVersion
+type GetFileVersionParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetFileVersion calls GET /api/file/{id}/versions/{version}: download a previous version
+// of a file.
+//
+// Downloads a previous version of a file under the file's name. The current version is
+// served like /api/file/:id.
+func (c *Client) GetFileVersion(ctx context.Context, id string, version string, params *GetFileVersionParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/file/" + url.PathEscape(id) + "/versions/" + url.PathEscape(version), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// ExportOwnFilesParams are the optional parameters of ExportOwnFiles
+type ExportOwnFilesParams struct {
+	// Filter by name
+	Search string
+	// Filter by MIME type
+	MIMEType string
+	// Filter by storage type
+	StorageType string
+	// Field to sort by
+	Sort string
+	// asc or desc
+	Order string
+	// csv or json
+	Format string
+}
+
+// ExportOwnFiles calls GET /api/files/export: export the files of the caller's API key.
+//
+// Streams the files uploaded with the request's API key, filtered by the search,
+// mime_type, storage_type, sort and order query parameters of the admin file list.
+func (c *Client) ExportOwnFiles(ctx context.Context, params *ExportOwnFilesParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/files/export", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Search != "" {
+			r.query.Set("search", params.Search)
+		}
+		if params.MIMEType != "" {
+			r.query.Set("mime_type", params.MIMEType)
+		}
+		if params.StorageType != "" {
+			r.query.Set("storage_type", params.StorageType)
+		}
+		if params.Sort != "" {
+			r.query.Set("sort", params.Sort)
+		}
+		if params.Order != "" {
+			r.query.Set("order", params.Order)
+		}
+		if params.Format != "" {
+			r.query.Set("format", params.Format)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetGeoJSONParams are the optional parameters of GetGeoJSON
+type GetGeoJSONParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetGeoJSON calls GET /api/geojson/{id}: get a GeoJSON file with its bounds.
+//
+// Serves a GeoJSON file as-is with its bounds in response headers, so map libraries can
+// consume it directly.
+func (c *Client) GetGeoJSON(ctx context.Context, id string, params *GetGeoJSONParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/geojson/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetGeoJSONInfoParams are the optional parameters of GetGeoJSONInfo
+type GetGeoJSONInfoParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetGeoJSONInfo calls GET /api/geojson/{id}/info: get the bounds and features of a
+// GeoJSON file.
+//
+// Returns bounds and feature statistics for a GeoJSON file.
+func (c *Client) GetGeoJSONInfo(ctx context.Context, id string, params *GetGeoJSONInfoParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/geojson/" + url.PathEscape(id) + "/info", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ImportFile calls POST /api/import: import a file from another instance.
+//
+// Copies a file from another instance of this service.
+func (c *Client) ImportFile(ctx context.Context, body *ImportRequest) (*ImportResponse, error) {
+	r := request{method: "POST", path: "/api/import", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out ImportResponse
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetJobStatus calls GET /api/job/{job_id}: get a processing job.
+//
+// Returns the state of the job assembling a chunked upload, and its file once it
+// completed.
+func (c *Client) GetJobStatus(ctx context.Context, jobID string) (*ProcessingJob, error) {
+	r := request{method: "GET", path: "/api/job/" + url.PathEscape(jobID), query: url.Values{}, header: http.Header{}}
+	var out ProcessingJob
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StreamJobEvents calls GET /api/job/{job_id}/events: follow a processing job.
+//
+// Streams processing job updates as Server-Sent Events. A "progress" event is sent with
+// the current job state and on every change; the stream ends with a "completed" event
+// carrying the FileResult, or a "failed" event carrying the error.
+func (c *Client) StreamJobEvents(ctx context.Context, jobID string) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/job/" + url.PathEscape(jobID) + "/events", query: url.Values{}, header: http.Header{}}
+	return c.do(ctx, r)
+}
+
+// GetLimits calls GET /api/limits: describe the caller's limits.
+//
+// Reports the caller's rate limit, quotas, size limits and upload concurrency, so clients
+// can pace themselves instead of discovering limits through 429 responses. API keys are
+// reported with their own limits, anonymous callers with those of their IP.
+func (c *Client) GetLimits(ctx context.Context) (*CallerLimits, error) {
+	r := request{method: "GET", path: "/api/limits", query: url.Values{}, header: http.Header{}}
+	var out CallerLimits
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateLocalizedDocument calls POST /api/localized: group files as the languages of a
+// document.
+//
+// Groups existing files as the language variants of one document.
+func (c *Client) CreateLocalizedDocument(ctx context.Context, body *LocalizedDocumentRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/localized", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OpenLocalizedDocumentParams are the optional parameters of OpenLocalizedDocument
+type OpenLocalizedDocumentParams struct {
+	// Preferred language, over Accept-Language
+	Lang string
+	// Languages the reader prefers
+	AcceptLanguage string
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// OpenLocalizedDocument calls GET /api/localized/{id}: open the variant of a document for
+// the reader's language.
+//
+// Redirects to the download of the variant that suits the reader. A password given for
+// the download is passed on.
+func (c *Client) OpenLocalizedDocument(ctx context.Context, id string, params *OpenLocalizedDocumentParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/localized/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Lang != "" {
+			r.query.Set("lang", params.Lang)
+		}
+		if params.AcceptLanguage != "" {
+			r.header.Set("Accept-Language", params.AcceptLanguage)
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetLocalizedVariants calls GET /api/localized/{id}/variants: list the languages of a
+// document.
+//
+// Lists the languages a localized document still offers, default first, with each
+// variant's metadata.
+func (c *Client) GetLocalizedVariants(ctx context.Context, id string) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/localized/" + url.PathEscape(id) + "/variants", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMediaInfoParams are the optional parameters of GetMediaInfo
+type GetMediaInfoParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetMediaInfo calls GET /api/media/{id}/info: describe an audio or video file.
+//
+// Returns the duration, resolution, codecs and bitrate of an audio or video file.
+func (c *Client) GetMediaInfo(ctx context.Context, id string, params *GetMediaInfoParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/media/" + url.PathEscape(id) + "/info", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetMediaPosterParams are the optional parameters of GetMediaPoster
+type GetMediaPosterParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetMediaPoster calls GET /api/media/{id}/poster: get the poster frame of a video.
+//
+// Serves the first frame of a video as a JPEG, at most maxPosterWidth wide.
+func (c *Client) GetMediaPoster(ctx context.Context, id string, params *GetMediaPosterParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/media/" + url.PathEscape(id) + "/poster", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// ServeRemuxParams are the optional parameters of ServeRemux
+type ServeRemuxParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// ServeRemux calls GET /api/media/{id}/remux: get the browser-playable remux of a video.
+//
+// Serves the browser-playable remux of an MKV or AVI file. Until the remux is done, it
+// answers 202 and queues the remux if it isn't queued.
+func (c *Client) ServeRemux(ctx context.Context, id string, params *ServeRemuxParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/media/" + url.PathEscape(id) + "/remux", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetMetadataParams are the optional parameters of GetMetadata
+type GetMetadataParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetMetadata calls GET /api/metadata/{id}: get the metadata of a file.
+//
+// Returns the public metadata of a file. The content hash of a protected file is only
+// included with its download password.
+func (c *Client) GetMetadata(ctx context.Context, id string, params *GetMetadataParams) (*FileMetadata, error) {
+	r := request{method: "GET", path: "/api/metadata/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out FileMetadata
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenderNotebookParams are the optional parameters of RenderNotebook
+type RenderNotebookParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// RenderNotebook calls GET /api/notebook/{id}: render a Jupyter notebook.
+//
+// Renders a Jupyter notebook as a static HTML page. Nothing from the notebook is
+// executed: text is escaped, images are limited to data URIs and HTML outputs are
+// isolated in sandboxed iframes without scripts.
+func (c *Client) RenderNotebook(ctx context.Context, id string, params *RenderNotebookParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/notebook/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetOpenAPISpec calls GET /api/openapi.json: get the OpenAPI description of the API.
+//
+// Serves the OpenAPI description of the API.
+func (c *Client) GetOpenAPISpec(ctx context.Context) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/openapi.json", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetOrg calls GET /api/org: describe the caller's org.
+//
+// Describes the org of the request's API key, its usage and the key's role.
+func (c *Client) GetOrg(ctx context.Context) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/org", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateOrgBranding calls PUT /api/org/branding: change the branding of the caller's org.
+//
+// Lets org admins change the branding shown with their files.
+func (c *Client) UpdateOrgBranding(ctx context.Context, body *OrgBranding) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/org/branding", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListOrgEventsParams are the optional parameters of ListOrgEvents
+type ListOrgEventsParams struct {
+	// Cursor returned as next_cursor
+	After int
+	// Comma-separated event types
+	Types string
+	// Most events to list
+	Limit int
+}
+
+// ListOrgEvents calls GET /api/org/events: list the file events of the caller's org.
+//
+// Serves the file event log of an org's files to its admins, as the same cursor feed as
+// the admin event log.
+func (c *Client) ListOrgEvents(ctx context.Context, params *ListOrgEventsParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/org/events", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.After != 0 {
+			r.query.Set("after", strconv.FormatInt(int64(params.After), 10))
+		}
+		if params.Types != "" {
+			r.query.Set("types", params.Types)
+		}
+		if params.Limit != 0 {
+			r.query.Set("limit", strconv.FormatInt(int64(params.Limit), 10))
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListOrgFilesParams are the optional parameters of ListOrgFiles
+type ListOrgFilesParams struct {
+	// Most files to list
+	Limit int
+}
+
+// ListOrgFiles calls GET /api/org/files: list the files of the caller's org.
+//
+// Lists the active files owned by the org of the request's API key.
+func (c *Client) ListOrgFiles(ctx context.Context, params *ListOrgFilesParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/org/files", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Limit != 0 {
+			r.query.Set("limit", strconv.FormatInt(int64(params.Limit), 10))
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateOrgPolicy calls PUT /api/org/policy: change the upload policy of the caller's
+// org.
+//
+// Lets org admins change the rules for their members' uploads.
+func (c *Client) UpdateOrgPolicy(ctx context.Context, body *OrgPolicy) (map[string]any, error) {
+	r := request{method: "PUT", path: "/api/org/policy", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PreviewFileParams are the optional parameters of PreviewFile
+type PreviewFileParams struct {
+	// Show a hex dump
+	Hex bool
+	// Open 3D models in the viewer
+	Viewer bool
+	// Apply the EXIF orientation of JPEG images
+	Orient bool
+	// Render a font specimen
+	Specimen bool
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// PreviewFile calls GET /api/preview/{id}: preview a file in the browser.
+//
+// Serves a file inline for previewing, with viewers for hex dumps, 3D models and fonts on
+// request.
+func (c *Client) PreviewFile(ctx context.Context, id string, params *PreviewFileParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/preview/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Hex != false {
+			r.query.Set("hex", strconv.FormatBool(params.Hex))
+		}
+		if params.Viewer != false {
+			r.query.Set("viewer", strconv.FormatBool(params.Viewer))
+		}
+		if params.Orient != false {
+			r.query.Set("orient", strconv.FormatBool(params.Orient))
+		}
+		if params.Specimen != false {
+			r.query.Set("specimen", strconv.FormatBool(params.Specimen))
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetPDFPageParams are the optional parameters of GetPDFPage
+type GetPDFPageParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetPDFPage calls GET /api/preview/{id}/page/{n}: render a page of a PDF.
+//
+// Serves one page of a PDF as a PNG, at most maxPDFPageSize on its longest side.
+func (c *Client) GetPDFPage(ctx context.Context, id string, n string, params *GetPDFPageParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/preview/" + url.PathEscape(id) + "/page/" + url.PathEscape(n), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetTablePreviewParams are the optional parameters of GetTablePreview
+type GetTablePreviewParams struct {
+	// First row after the header
+	Offset int
+	// Number of rows
+	Limit int
+	// Field delimiter
+	Delimiter string
+	// true or false, whether the first row is a header
+	Header string
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetTablePreview calls GET /api/preview/{id}/table: preview rows of a CSV or TSV file.
+//
+// Returns rows offset..offset+limit-1 of a CSV or TSV file, counted after the header. The
+// delimiter and header are detected unless ?delimiter= or ?header= is given.
+func (c *Client) GetTablePreview(ctx context.Context, id string, params *GetTablePreviewParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/preview/" + url.PathEscape(id) + "/table", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Offset != 0 {
+			r.query.Set("offset", strconv.FormatInt(int64(params.Offset), 10))
+		}
+		if params.Limit != 0 {
+			r.query.Set("limit", strconv.FormatInt(int64(params.Limit), 10))
+		}
+		if params.Delimiter != "" {
+			r.query.Set("delimiter", params.Delimiter)
+		}
+		if params.Header != "" {
+			r.query.Set("header", params.Header)
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetTextPreviewParams are the optional parameters of GetTextPreview
+type GetTextPreviewParams struct {
+	// First line, from 1
+	From int
+	// Number of lines
+	Lines int
+	// Include syntax highlighting tokens
+	Highlight bool
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetTextPreview calls GET /api/preview/{id}/text: preview lines of a text file.
+//
+// Returns lines from..from+lines-1 (1-based) of a text file with its detected language,
+// and with ?highlight=true syntax highlighting tokens for each line.
+func (c *Client) GetTextPreview(ctx context.Context, id string, params *GetTextPreviewParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/preview/" + url.PathEscape(id) + "/text", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.From != 0 {
+			r.query.Set("from", strconv.FormatInt(int64(params.From), 10))
+		}
+		if params.Lines != 0 {
+			r.query.Set("lines", strconv.FormatInt(int64(params.Lines), 10))
+		}
+		if params.Highlight != false {
+			r.query.Set("highlight", strconv.FormatBool(params.Highlight))
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReceiveScanVerdictParams are the optional parameters of ReceiveScanVerdict
+type ReceiveScanVerdictParams struct {
+	// HMAC-SHA256 of the timestamp and body
+	XScannerSignature string
+	// Unix time of the delivery
+	XScannerTimestamp string
+}
+
+// ReceiveScanVerdict calls POST /api/scanner/verdict: apply a verdict of the external
+// scanner.
+//
+// Applies a signed verdict from the external scanner. Clean verdicts are stored with the
+// file; infected files are moved to quarantine and deleted.
+func (c *Client) ReceiveScanVerdict(ctx context.Context, body *ScanVerdict, params *ReceiveScanVerdictParams) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/scanner/verdict", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if params != nil {
+		if params.XScannerSignature != "" {
+			r.header.Set("X-Scanner-Signature", params.XScannerSignature)
+		}
+		if params.XScannerTimestamp != "" {
+			r.header.Set("X-Scanner-Timestamp", params.XScannerTimestamp)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SpeedTestDownloadParams are the optional parameters of SpeedTestDownload
+type SpeedTestDownloadParams struct {
+	// Bytes to send
+	Size int
+}
+
+// SpeedTestDownload calls GET /api/speedtest/download: measure download bandwidth.
+//
+// Streams random bytes so clients can measure download bandwidth.
+func (c *Client) SpeedTestDownload(ctx context.Context, params *SpeedTestDownloadParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/speedtest/download", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Size != 0 {
+			r.query.Set("size", strconv.FormatInt(int64(params.Size), 10))
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// SpeedTestUpload calls POST /api/speedtest/upload: measure upload bandwidth.
+//
+// Discards the request body and reports how fast it was received.
+func (c *Client) SpeedTestUpload(ctx context.Context, body io.Reader) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/speedtest/upload", query: url.Values{}, header: http.Header{}}
+	r.body, r.contentType = body, "application/octet-stream"
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetPublicStats calls GET /api/stats: get the public service totals.
+//
+// Serves the public service totals. Uptime is this instance's, in whole hours.
+func (c *Client) GetPublicStats(ctx context.Context) (*PublicStats, error) {
+	r := request{method: "GET", path: "/api/stats", query: url.Values{}, header: http.Header{}}
+	var out PublicStats
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// FastStreamFileParams are the optional parameters of FastStreamFile
+type FastStreamFileParams struct {
+	// Byte range to stream
+	Range string
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// FastStreamFile calls GET /api/stream/{id}: stream a media file.
+//
+// Provides optimized streaming for large media files.
+func (c *Client) FastStreamFile(ctx context.Context, id string, params *FastStreamFileParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/stream/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Range != "" {
+			r.header.Set("Range", params.Range)
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// ServeHLSParams are the optional parameters of ServeHLS
+type ServeHLSParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// ServeHLS calls GET /api/stream/{id}/hls/{name}: get an HLS playlist or segment.
+//
+// Serves the playlists and segments of a transcoded video. Until the transcode is done,
+// the master playlist answers 202 and queues the transcode if it isn't queued.
+func (c *Client) ServeHLS(ctx context.Context, id string, name string, params *ServeHLSParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/stream/" + url.PathEscape(id) + "/hls/" + url.PathEscape(name), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// UploadFileForm is the multipart form of UploadFile
+type UploadFileForm struct {
+	// Alt text of an image
+	AltText string
+	// Caption of the file
+	Caption string
+	// Custom ID, the same as slug
+	CustomID string
+	// Long description of the file
+	Description string
+	// Password required to download the file
+	DownloadPassword string
+	// Comma-separated addresses to mail the link to
+	EmailTo string
+	// The file to upload
+	File *FormFile
+	// Expected SHA-256 of the content
+	FileHash string
+	// Hint mailed along with the link
+	PasswordHint string
+	// Signed upload policy from POST /api/upload-policies, instead of an API key
+	Policy string
+	// Vanity slug for /f/:slug
+	Slug string
+	// Storage class: fast-ssd, standard or archive
+	StorageClass string
+}
+
+// UploadFileParams are the optional parameters of UploadFile
+type UploadFileParams struct {
+	// Expected SHA-256 of the content, when file_hash isn't given
+	XContentSHA256 string
+}
+
+// UploadFile calls POST /api/upload: upload a file.
+//
+// Stores a file sent as a multipart form, compressing it when that pays off.
+func (c *Client) UploadFile(ctx context.Context, form *UploadFileForm, params *UploadFileParams) (*UploadResponse, error) {
+	r := request{method: "POST", path: "/api/upload", query: url.Values{}, header: http.Header{}}
+	var parts []formPart
+	if form != nil {
+		if form.AltText != "" {
+			parts = append(parts, formPart{name: "alt_text", value: form.AltText})
+		}
+		if form.Caption != "" {
+			parts = append(parts, formPart{name: "caption", value: form.Caption})
+		}
+		if form.CustomID != "" {
+			parts = append(parts, formPart{name: "custom_id", value: form.CustomID})
+		}
+		if form.Description != "" {
+			parts = append(parts, formPart{name: "description", value: form.Description})
+		}
+		if form.DownloadPassword != "" {
+			parts = append(parts, formPart{name: "download_password", value: form.DownloadPassword})
+		}
+		if form.EmailTo != "" {
+			parts = append(parts, formPart{name: "email_to", value: form.EmailTo})
+		}
+		if form.File != nil {
+			parts = append(parts, formPart{name: "file", file: form.File})
+		}
+		if form.FileHash != "" {
+			parts = append(parts, formPart{name: "file_hash", value: form.FileHash})
+		}
+		if form.PasswordHint != "" {
+			parts = append(parts, formPart{name: "password_hint", value: form.PasswordHint})
+		}
+		if form.Policy != "" {
+			parts = append(parts, formPart{name: "policy", value: form.Policy})
+		}
+		if form.Slug != "" {
+			parts = append(parts, formPart{name: "slug", value: form.Slug})
+		}
+		if form.StorageClass != "" {
+			parts = append(parts, formPart{name: "storage_class", value: form.StorageClass})
+		}
+	}
+	r.body, r.contentType = multipartBody(parts)
+	if params != nil {
+		if params.XContentSHA256 != "" {
+			r.header.Set("X-Content-SHA256", params.XContentSHA256)
+		}
+	}
+	var out UploadResponse
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateUploadPolicy calls POST /api/upload-policies: create a signed upload policy.
+//
+// Mints a signed policy for browser uploads under the request's API key.
+func (c *Client) CreateUploadPolicy(ctx context.Context, body *UploadPolicyRequest) (*UploadPolicyResponse, error) {
+	r := request{method: "POST", path: "/api/upload-policies", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out UploadPolicyResponse
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UploadBase64 calls POST /api/upload/base64: upload base64-encoded content.
+//
+// Accepts a JSON body with base64-encoded content for clients that cannot send multipart
+// requests. The response matches uploadFile.
+func (c *Client) UploadBase64(ctx context.Context, body *Base64UploadRequest) (*UploadResponse, error) {
+	r := request{method: "POST", path: "/api/upload/base64", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out UploadResponse
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CheckUploadByHash calls POST /api/upload/check: create a file from content the server
+// already stores.
+//
+// Lets clients skip transferring content the server already stores. When an active file
+// with the same SHA-256 and size exists, a new file_id is created from it immediately;
+// otherwise the client should fall back to a regular upload.
+//
+// Knowing a hash doesn't prove possession of the content, so only files uploaded by the
+// same API key (or, for anonymous uploads, the same client IP) are matched. Otherwise the
+// endpoint would reveal whether anyone stored a given file and hand out copies of it.
+//
+// There is no shared-blob reference counting, so the new record gets its own copy of the
+// content (copied inside PostgreSQL). Disk-stored files are therefore never matched,
+// since deleting one record would remove the shared file, and only the standard storage
+// class can be requested. Only files up to CHUNK_THRESHOLD are looked up, as larger ones
+// are usually stored on disk; every answer tells the limit in max_size.
+func (c *Client) CheckUploadByHash(ctx context.Context, body *UploadCheckRequest) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/upload/check", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// QuickUploadForm is the multipart form of QuickUpload
+type QuickUploadForm struct {
+	// Password required to download the file
+	DownloadPassword string
+	// The file to upload
+	File *FormFile
+	// Storage class; only standard is accepted
+	StorageClass string
+}
+
+// QuickUpload calls POST /api/upload/quick: upload a tiny file quickly.
+//
+// Is a low-latency upload path for tiny files such as screenshots. It skips compression
+// selection, defers the database write to the metadata queue and returns a short URL
+// immediately.
+func (c *Client) QuickUpload(ctx context.Context, form *QuickUploadForm) (map[string]any, error) {
+	r := request{method: "POST", path: "/api/upload/quick", query: url.Values{}, header: http.Header{}}
+	var parts []formPart
+	if form != nil {
+		if form.DownloadPassword != "" {
+			parts = append(parts, formPart{name: "download_password", value: form.DownloadPassword})
+		}
+		if form.File != nil {
+			parts = append(parts, formPart{name: "file", file: form.File})
+		}
+		if form.StorageClass != "" {
+			parts = append(parts, formPart{name: "storage_class", value: form.StorageClass})
+		}
+	}
+	r.body, r.contentType = multipartBody(parts)
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetUsage calls GET /api/usage: get the caller's storage and egress usage.
+//
+// Returns the storage and egress usage of the caller: the API key when one is used,
+// otherwise the client IP.
+func (c *Client) GetUsage(ctx context.Context) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/usage", query: url.Values{}, header: http.Header{}}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BrowseArchiveZIPParams are the optional parameters of BrowseArchiveZIP
+type BrowseArchiveZIPParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// BrowseArchiveZIP calls GET /api/zip/{id}: list the entries of an archive.
+//
+// Lists the entries of a ZIP or tar archive.
+func (c *Client) BrowseArchiveZIP(ctx context.Context, id string, params *BrowseArchiveZIPParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/zip/" + url.PathEscape(id), query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DownloadArchiveSubsetZIPParams are the optional parameters of DownloadArchiveSubsetZIP
+type DownloadArchiveSubsetZIPParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// DownloadArchiveSubsetZIP calls POST /api/zip/{id}/download: download selected entries
+// of an archive as a ZIP.
+//
+// Streams a new ZIP holding only the selected entries of an archive, so a folder can be
+// taken out of a large archive in one request.
+func (c *Client) DownloadArchiveSubsetZIP(ctx context.Context, id string, body *ArchiveSubsetRequest, params *DownloadArchiveSubsetZIPParams) (*http.Response, error) {
+	r := request{method: "POST", path: "/api/zip/" + url.PathEscape(id) + "/download", query: url.Values{}, header: http.Header{}}
+	if body != nil {
+		var err error
+		if r.body, r.contentType, err = jsonBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// ExtractArchiveFileZIPParams are the optional parameters of ExtractArchiveFileZIP
+type ExtractArchiveFileZIPParams struct {
+	// Name of the entry
+	Filename string
+	// Index of the entry, instead of its name
+	Index int
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// ExtractArchiveFileZIP calls GET /api/zip/{id}/extract: extract an entry of an archive.
+//
+// Previews a single entry of a ZIP or tar archive.
+func (c *Client) ExtractArchiveFileZIP(ctx context.Context, id string, params *ExtractArchiveFileZIPParams) (*http.Response, error) {
+	r := request{method: "GET", path: "/api/zip/" + url.PathEscape(id) + "/extract", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.Filename != "" {
+			r.query.Set("filename", params.Filename)
+		}
+		if params.Index != 0 {
+			r.query.Set("index", strconv.FormatInt(int64(params.Index), 10))
+		}
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	return c.do(ctx, r)
+}
+
+// GetArchiveTreeZIPParams are the optional parameters of GetArchiveTreeZIP
+type GetArchiveTreeZIPParams struct {
+	// Download password set by the uploader
+	DownloadPassword string
+}
+
+// GetArchiveTreeZIP calls GET /api/zip/{id}/tree: list the entries of an archive as a
+// tree.
+//
+// Returns an archive's entries as a nested directory tree. Each file node carries its
+// entry, whose index can be passed to the extract endpoint.
+func (c *Client) GetArchiveTreeZIP(ctx context.Context, id string, params *GetArchiveTreeZIPParams) (map[string]any, error) {
+	r := request{method: "GET", path: "/api/zip/" + url.PathEscape(id) + "/tree", query: url.Values{}, header: http.Header{}}
+	if params != nil {
+		if params.DownloadPassword != "" {
+			r.query.Set("password", params.DownloadPassword)
+		}
+	}
+	var out map[string]any
+	if err := c.doJSON(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
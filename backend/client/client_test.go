@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/upload" || r.Header.Get("X-API-Key") != "key" {
+			t.Errorf("got %s %s with key %q", r.Method, r.URL.Path, r.Header.Get("X-API-Key"))
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(file)
+		if header.Filename != "notes.txt" || string(content) != "hello" || r.FormValue("download_password") != "secret" {
+			t.Errorf("got %s %q, password %q", header.Filename, content, r.FormValue("download_password"))
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"file_id":  "abc",
+			"metadata": map[string]any{"id": "abc", "filename": "notes.txt", "delete_password": "del"},
+		})
+	}))
+	defer server.Close()
+
+	c := New(server.URL + "/")
+	c.APIKey = "key"
+	uploaded, err := c.UploadFile(context.Background(), &UploadFileForm{
+		File:             &FormFile{Name: "notes.txt", Content: strings.NewReader("hello")},
+		DownloadPassword: "secret",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.FileID != "abc" || uploaded.Metadata.DeletePassword != "del" {
+		t.Errorf("got %+v", uploaded)
+	}
+}
+
+func TestDownloadAndErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Password required","message":"This file is protected"}`))
+			return
+		}
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	resp, err := c.GetFile(context.Background(), "a/b", &GetFileParams{DownloadPassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(content) != "content of /api/file/a/b" {
+		t.Errorf("got %q", content)
+	}
+
+	_, err = c.GetFile(context.Background(), "abc", nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Password required" {
+		t.Fatalf("got %v", err)
+	}
+	if apiErr.Error() != "401 Password required: This file is protected" {
+		t.Errorf("got %q", apiErr.Error())
+	}
+}
+
+func TestRetryAfterError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "42")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"Rate limit exceeded. Please try again later.","error_code":"rate_limited","retry_after_seconds":42}`))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).GetLimits(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "rate_limited" || apiErr.RetryAfter != 42*time.Second {
+		t.Fatalf("got %+v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine clients such as CI pipelines can authenticate with a client certificate
+// instead of an X-API-Key header. A certificate signed by CLIENT_CA is mapped to the API
+// key whose client_cert_identity matches one of its identities, and from then on is
+// treated like that key, with its rate limit, quotas and storage classes.
+
+// clientCertIdentities lists the identities of the verified client certificate of a
+// connection: the subject common name and the DNS, email and URI subject alternative names.
+// Certificates the TLS handshake didn't verify against CLIENT_CA yield none.
+func clientCertIdentities(state *tls.ConnectionState) []string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := state.VerifiedChains[0][0]
+
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
+
+// listenerTLSConfig loads a listener's certificate and, with clientCA set, checks client
+// certificates against that CA as clientAuth says
+func listenerTLSConfig(certFile, keyFile, clientCA string, clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCA != "" {
+		caPEM, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = clientAuth
+	}
+	return tlsConfig, nil
+}
+
+// apiTLSConfig is the TLS configuration of the public API listener, nil when it serves
+// plain HTTP. Client certificates are verified when offered but not required, so
+// browsers keep working on the same port.
+func apiTLSConfig(config *Config) (*tls.Config, error) {
+	if config.TLSCert == "" && config.TLSKey == "" {
+		if config.ClientCA != "" || config.ClientCertAddr != "" {
+			return nil, fmt.Errorf("CLIENT_CA and CLIENT_CERT_ADDR require TLS_CERT and TLS_KEY")
+		}
+		return nil, nil
+	}
+	return listenerTLSConfig(config.TLSCert, config.TLSKey, config.ClientCA, tls.VerifyClientCertIfGiven)
+}
+
+// newClientCertServer prepares the dedicated listener at CLIENT_CERT_ADDR, which serves
+// the API only to clients presenting a certificate signed by CLIENT_CA
+func newClientCertServer(config *Config, router *gin.Engine) (*http.Server, error) {
+	if config.ClientCA == "" {
+		return nil, fmt.Errorf("CLIENT_CERT_ADDR requires CLIENT_CA")
+	}
+	tlsConfig, err := listenerTLSConfig(config.TLSCert, config.TLSKey, config.ClientCA, tls.RequireAndVerifyClientCert)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:           config.ClientCertAddr,
+		Handler:        router,
+		TLSConfig:      tlsConfig,
+		IdleTimeout:    120 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}, nil
+}
+
+// serveClientCert runs the client certificate listener until it fails
+func serveClientCert(server *http.Server) {
+	log.Printf("Client certificate listener starting on %s", server.Addr)
+	log.Fatalf("Client certificate listener stopped: %v", server.ListenAndServeTLS("", ""))
+}
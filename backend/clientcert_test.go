@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientCertificateAuthenticatesAsAPIKey(t *testing.T) {
+	ts := newTestService(t)
+	ca, caKey, _, _ := testCertificate(t, "client CA", nil, nil)
+	publisher, _, _, _ := testCertificate(t, "ci-publisher", ca, caKey)
+	stranger, _, _, _ := testCertificate(t, "someone-else", ca, caKey)
+
+	identity := "ci-publisher"
+	ts.store.CreateAPIKey(&APIKeyStorage{ID: "ci", Name: "CI", KeyHash: hashAPIKey("one_secret"), RateLimit: 2, ClientCertIdentity: &identity})
+	ts.store.CreateAPIKey(&APIKeyStorage{ID: "other", Name: "Other", KeyHash: hashAPIKey("one_other"), RateLimit: 100})
+
+	router := gin.New()
+	router.Use(apiKeyMiddleware(ts.FileService))
+	router.GET("/whoami", func(c *gin.Context) {
+		if key := apiKeyFromContext(c); key != nil {
+			c.String(http.StatusOK, key.ID)
+			return
+		}
+		c.String(http.StatusOK, "anonymous")
+	})
+	request := func(verified *x509.Certificate, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+		if verified != nil {
+			req.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{verified},
+				VerifiedChains:   [][]*x509.Certificate{{verified, ca}},
+			}
+		}
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request(publisher, ""); w.Code != http.StatusOK || w.Body.String() != "ci" {
+		t.Fatalf("mapped certificate: got %d %q, want the ci key", w.Code, w.Body.String())
+	}
+	if w := request(publisher, ""); w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("certificate requests don't count against the key's rate limit")
+	}
+	if w := request(publisher, ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("over the key's rate limit: got %d, want 429", w.Code)
+	}
+
+	if w := request(stranger, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unmapped certificate: got %d, want 401", w.Code)
+	}
+	// An explicit API key wins over the certificate
+	if w := request(stranger, "one_other"); w.Body.String() != "other" {
+		t.Errorf("API key with certificate: got %q, want the other key", w.Body.String())
+	}
+	if w := request(nil, ""); w.Body.String() != "anonymous" {
+		t.Errorf("no credentials: got %q, want anonymous", w.Body.String())
+	}
+
+	// A certificate the handshake didn't verify carries no identity
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{publisher}}
+	if identities := clientCertIdentities(state); identities != nil {
+		t.Errorf("unverified certificate yielded identities %v", identities)
+	}
+}
+
+func TestAPITLSConfig(t *testing.T) {
+	config := &Config{ClientCA: "ca.pem"}
+	if _, err := apiTLSConfig(config); err == nil {
+		t.Error("CLIENT_CA without a server certificate should be rejected")
+	}
+	config = &Config{}
+	if tlsConfig, err := apiTLSConfig(config); err != nil || tlsConfig != nil {
+		t.Errorf("without TLS_CERT: got %v, %v; want plain HTTP", tlsConfig, err)
+	}
+}
@@ -0,0 +1,535 @@
+// Command bench generates synthetic uploads and downloads against a running instance and
+// reports throughput and latency percentiles per operation:
+//
+//	go run ./cmd/bench -url http://localhost:8080 -concurrency 8 -duration 1m \
+//		-sizes 10KB,1MB,20MB -mix text=2,binary=1,media=1 -api-key $KEY
+//
+// The content mix selects the server's compression paths: text compresses well, binary is
+// random data the server still tries to compress, and media uses a video extension the
+// server stores uncompressed. Files at least -chunk-threshold large go through the chunked
+// upload API. Anonymous clients are rate limited per IP, so pass an API key with a high
+// rate limit for sustained runs.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type contentKind struct {
+	name      string
+	extension string
+	weight    int
+}
+
+type uploadedFile struct {
+	id             string
+	size           int64
+	deletePassword string
+}
+
+// sample is one timed request
+type sample struct {
+	op      string
+	latency time.Duration
+	bytes   int64
+	status  int
+	err     error
+}
+
+type bench struct {
+	client         *http.Client
+	baseURL        string
+	apiKey         string
+	sizes          []int64
+	kinds          []contentKind
+	chunkThreshold int64
+	chunkSize      int64
+
+	mu    sync.Mutex
+	files []uploadedFile
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the instance")
+	apiKey := flag.String("api-key", "", "API key sent as X-API-Key")
+	concurrency := flag.Int("concurrency", 4, "concurrent clients")
+	duration := flag.Duration("duration", 30*time.Second, "how long to generate load")
+	sizesFlag := flag.String("sizes", "10KB,1MB,10MB", "comma-separated upload sizes, picked uniformly")
+	mixFlag := flag.String("mix", "text=1,binary=1,media=1", "content mix as kind=weight (text, binary, media)")
+	downloadRatio := flag.Float64("download-ratio", 3, "downloads per upload")
+	seedFiles := flag.Int("seed-files", 10, "files uploaded before the run as download targets")
+	chunkThreshold := flag.String("chunk-threshold", "50MB", "upload files at least this large in chunks")
+	chunkSize := flag.String("chunk-size", "10MB", "chunk size for chunked uploads")
+	seed := flag.Int64("seed", 1, "random seed for sizes, content and operations")
+	cleanup := flag.Bool("cleanup", true, "delete the uploaded files afterwards")
+	flag.Parse()
+
+	sizes, err := parseSizes(*sizesFlag)
+	if err != nil {
+		log.Fatalf("Invalid -sizes: %v", err)
+	}
+	kinds, err := parseMix(*mixFlag)
+	if err != nil {
+		log.Fatalf("Invalid -mix: %v", err)
+	}
+	threshold, err := parseSize(*chunkThreshold)
+	if err != nil {
+		log.Fatalf("Invalid -chunk-threshold: %v", err)
+	}
+	chunk, err := parseSize(*chunkSize)
+	if err != nil || chunk <= 0 {
+		log.Fatalf("Invalid -chunk-size: %s", *chunkSize)
+	}
+
+	b := &bench{
+		client:         &http.Client{Timeout: 10 * time.Minute},
+		baseURL:        strings.TrimRight(*baseURL, "/"),
+		apiKey:         *apiKey,
+		sizes:          sizes,
+		kinds:          kinds,
+		chunkThreshold: threshold,
+		chunkSize:      chunk,
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	log.Printf("Seeding %d files", *seedFiles)
+	for i := 0; i < *seedFiles; i++ {
+		if s := b.upload(rng); s.err != nil {
+			log.Fatalf("Seeding failed: %v", s.err)
+		}
+	}
+
+	log.Printf("Running %d clients for %s", *concurrency, *duration)
+	samples := make(chan sample, 1024)
+	var collected []sample
+	collectorDone := make(chan struct{})
+	go func() {
+		for s := range samples {
+			collected = append(collected, s)
+		}
+		close(collectorDone)
+	}()
+
+	started := time.Now()
+	deadline := started.Add(*duration)
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(clientSeed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(clientSeed))
+			for time.Now().Before(deadline) {
+				if rng.Float64() < *downloadRatio/(*downloadRatio+1) {
+					samples <- b.download(rng)
+				} else {
+					samples <- b.upload(rng)
+				}
+			}
+		}(*seed + int64(i) + 1)
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+	close(samples)
+	<-collectorDone
+
+	report(os.Stdout, collected, elapsed)
+
+	if *cleanup {
+		b.deleteAll()
+	}
+}
+
+// upload sends one synthetic file, through the chunked API when it is large enough
+func (b *bench) upload(rng *rand.Rand) sample {
+	size := b.sizes[rng.Intn(len(b.sizes))]
+	kind := pickKind(rng, b.kinds)
+	content := generateContent(rng, kind.name, size)
+	filename := fmt.Sprintf("bench-%d%s", rng.Int63(), kind.extension)
+
+	op := "upload_" + kind.name
+	if size >= b.chunkThreshold {
+		op = "chunked_upload_" + kind.name
+	}
+
+	started := time.Now()
+	var file uploadedFile
+	var status int
+	var err error
+	if size >= b.chunkThreshold {
+		file, status, err = b.chunkedUpload(filename, content)
+	} else {
+		file, status, err = b.simpleUpload(filename, content)
+	}
+	s := sample{op: op, latency: time.Since(started), bytes: size, status: status, err: err}
+	if err == nil {
+		b.mu.Lock()
+		b.files = append(b.files, file)
+		b.mu.Unlock()
+	}
+	return s
+}
+
+func (b *bench) simpleUpload(filename string, content []byte) (uploadedFile, int, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return uploadedFile{}, 0, err
+	}
+	part.Write(content)
+	writer.Close()
+
+	var result struct {
+		FileID   string `json:"file_id"`
+		Metadata struct {
+			DeletePassword string `json:"delete_password"`
+		} `json:"metadata"`
+	}
+	status, err := b.do(http.MethodPost, "/api/upload", &body, writer.FormDataContentType(), &result)
+	if err != nil {
+		return uploadedFile{}, status, err
+	}
+	return uploadedFile{id: result.FileID, size: int64(len(content)), deletePassword: result.Metadata.DeletePassword}, status, nil
+}
+
+// chunkedUpload initiates a chunked upload, sends the chunks in order and waits for the
+// processing job, so the latency covers assembly and storage
+func (b *bench) chunkedUpload(filename string, content []byte) (uploadedFile, int, error) {
+	initiate, _ := json.Marshal(map[string]interface{}{
+		"filename":   filename,
+		"total_size": len(content),
+		"chunk_size": b.chunkSize,
+	})
+	var upload struct {
+		UploadID    string `json:"upload_id"`
+		TotalChunks int    `json:"total_chunks"`
+	}
+	if status, err := b.do(http.MethodPost, "/api/chunk/initiate", bytes.NewReader(initiate), "application/json", &upload); err != nil {
+		return uploadedFile{}, status, err
+	}
+
+	for i := 0; i < upload.TotalChunks; i++ {
+		end := int64(i+1) * b.chunkSize
+		if end > int64(len(content)) {
+			end = int64(len(content))
+		}
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("chunk", "chunk")
+		if err != nil {
+			return uploadedFile{}, 0, err
+		}
+		part.Write(content[int64(i)*b.chunkSize : end])
+		writer.Close()
+		if status, err := b.do(http.MethodPost, fmt.Sprintf("/api/chunk/%s/%d", upload.UploadID, i), &body, writer.FormDataContentType(), nil); err != nil {
+			return uploadedFile{}, status, err
+		}
+	}
+
+	var completed struct {
+		JobID string `json:"job_id"`
+	}
+	if status, err := b.do(http.MethodPost, "/api/chunk/"+upload.UploadID+"/complete", nil, "", &completed); err != nil {
+		return uploadedFile{}, status, err
+	}
+
+	for {
+		var job struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+			Result *struct {
+				FileID         string `json:"file_id"`
+				DeletePassword string `json:"delete_password"`
+			} `json:"result"`
+		}
+		status, err := b.do(http.MethodGet, "/api/job/"+completed.JobID, nil, "", &job)
+		if err != nil {
+			return uploadedFile{}, status, err
+		}
+		switch job.Status {
+		case "completed":
+			if job.Result == nil {
+				return uploadedFile{}, status, fmt.Errorf("job completed without a result")
+			}
+			return uploadedFile{id: job.Result.FileID, size: int64(len(content)), deletePassword: job.Result.DeletePassword}, status, nil
+		case "failed":
+			return uploadedFile{}, status, fmt.Errorf("processing failed: %s", job.Error)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// download fetches a random uploaded file and checks its length, uploading one first
+// when there is none yet
+func (b *bench) download(rng *rand.Rand) sample {
+	b.mu.Lock()
+	if len(b.files) == 0 {
+		b.mu.Unlock()
+		return b.upload(rng)
+	}
+	file := b.files[rng.Intn(len(b.files))]
+	b.mu.Unlock()
+
+	started := time.Now()
+	req, err := http.NewRequest(http.MethodGet, b.baseURL+"/api/file/"+file.id, nil)
+	if err != nil {
+		return sample{op: "download", err: err}
+	}
+	b.authorize(req)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return sample{op: "download", latency: time.Since(started), err: err}
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(io.Discard, resp.Body)
+	s := sample{op: "download", latency: time.Since(started), bytes: n, status: resp.StatusCode, err: err}
+	if err == nil && resp.StatusCode != http.StatusOK {
+		s.err = fmt.Errorf("status %d", resp.StatusCode)
+	} else if err == nil && n != file.size {
+		s.err = fmt.Errorf("downloaded %d bytes, want %d", n, file.size)
+	}
+	return s
+}
+
+func (b *bench) deleteAll() {
+	b.mu.Lock()
+	files := b.files
+	b.mu.Unlock()
+
+	failed := 0
+	for _, file := range files {
+		path := "/api/file/" + file.id + "?delete_password=" + file.deletePassword
+		if _, err := b.do(http.MethodDelete, path, nil, "", nil); err != nil {
+			failed++
+		}
+	}
+	log.Printf("Deleted %d uploaded files (%d failed)", len(files)-failed, failed)
+}
+
+// do sends a request and decodes a successful JSON response into out
+func (b *bench) do(method, path string, body io.Reader, contentType string, out interface{}) (int, error) {
+	req, err := http.NewRequest(method, b.baseURL+path, body)
+	if err != nil {
+		return 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	b.authorize(req)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(data))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (b *bench) authorize(req *http.Request) {
+	if b.apiKey != "" {
+		req.Header.Set("X-API-Key", b.apiKey)
+	}
+}
+
+// generateContent returns size bytes of the given kind: words for text, random bytes for
+// binary and media
+func generateContent(rng *rand.Rand, kind string, size int64) []byte {
+	content := make([]byte, size)
+	if kind != "text" {
+		rng.Read(content)
+		return content
+	}
+
+	words := []string{"lorem", "ipsum", "dolor", "sit", "amet", "upload", "stream", "chunk", "compress", "storage"}
+	var buf bytes.Buffer
+	buf.Grow(int(size))
+	for int64(buf.Len()) < size {
+		buf.WriteString(words[rng.Intn(len(words))])
+		if rng.Intn(12) == 0 {
+			buf.WriteByte('\n')
+		} else {
+			buf.WriteByte(' ')
+		}
+	}
+	copy(content, buf.Bytes())
+	return content
+}
+
+func pickKind(rng *rand.Rand, kinds []contentKind) contentKind {
+	total := 0
+	for _, kind := range kinds {
+		total += kind.weight
+	}
+	n := rng.Intn(total)
+	for _, kind := range kinds {
+		if n < kind.weight {
+			return kind
+		}
+		n -= kind.weight
+	}
+	return kinds[len(kinds)-1]
+}
+
+func parseMix(mix string) ([]contentKind, error) {
+	extensions := map[string]string{"text": ".txt", "binary": ".bin", "media": ".mp4"}
+	var kinds []contentKind
+	for _, entry := range strings.Split(mix, ",") {
+		name, weightStr, found := strings.Cut(strings.TrimSpace(entry), "=")
+		extension, known := extensions[name]
+		if !known {
+			return nil, fmt.Errorf("unknown content kind %q", name)
+		}
+		weight := 1
+		if found {
+			var err error
+			if weight, err = strconv.Atoi(weightStr); err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight %q", weightStr)
+			}
+		}
+		if weight > 0 {
+			kinds = append(kinds, contentKind{name: name, extension: extension, weight: weight})
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no content kinds")
+	}
+	return kinds, nil
+}
+
+func parseSizes(list string) ([]int64, error) {
+	var sizes []int64
+	for _, entry := range strings.Split(list, ",") {
+		size, err := parseSize(entry)
+		if err != nil {
+			return nil, err
+		}
+		if size <= 0 {
+			return nil, fmt.Errorf("size must be positive: %s", entry)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// parseSize reads sizes such as 512, 10KB, 5MB and 1GB
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// report prints request counts, throughput and latency percentiles per operation
+func report(w io.Writer, samples []sample, elapsed time.Duration) {
+	byOp := make(map[string][]sample)
+	for _, s := range samples {
+		byOp[s.op] = append(byOp[s.op], s)
+	}
+	ops := make([]string, 0, len(byOp))
+	for op := range byOp {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	fmt.Fprintf(w, "\nCompleted %d requests in %s\n\n", len(samples), elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "%-24s %8s %7s %9s %10s %10s %10s %10s %10s %10s\n",
+		"operation", "requests", "errors", "req/s", "MB/s", "p50", "p90", "p95", "p99", "max")
+	for _, op := range ops {
+		opSamples := byOp[op]
+		var latencies []time.Duration
+		var transferred int64
+		errors := 0
+		for _, s := range opSamples {
+			if s.err != nil {
+				errors++
+				continue
+			}
+			latencies = append(latencies, s.latency)
+			transferred += s.bytes
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		fmt.Fprintf(w, "%-24s %8d %7d %9.1f %10.2f %10s %10s %10s %10s %10s\n",
+			op, len(opSamples), errors,
+			float64(len(latencies))/elapsed.Seconds(),
+			float64(transferred)/(1<<20)/elapsed.Seconds(),
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 95),
+			percentile(latencies, 99), percentile(latencies, 100))
+	}
+
+	// Group errors by status, e.g. to spot rate limiting (429) or overload (503)
+	statuses := make(map[string]int)
+	for _, s := range samples {
+		if s.err == nil {
+			continue
+		}
+		key := "network"
+		if s.status != 0 {
+			key = strconv.Itoa(s.status)
+		}
+		statuses[key]++
+	}
+	if len(statuses) > 0 {
+		keys := make([]string, 0, len(statuses))
+		for key := range statuses {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(w, "\nErrors by status:")
+		for _, key := range keys {
+			fmt.Fprintf(w, " %s=%d", key, statuses[key])
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies by the nearest-rank method
+func percentile(sorted []time.Duration, p int) string {
+	if len(sorted) == 0 {
+		return "-"
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1].Round(100 * time.Microsecond).String()
+}
@@ -0,0 +1,48 @@
+// Command openapi writes the OpenAPI description of the service, generated from the
+// router setup and the annotations of the handlers, and the Go client generated from it.
+// Run it from the backend directory, usually through go generate:
+//
+//	go generate .
+//
+// The service serves the description it was built with at /api/openapi.json, and a test
+// fails when either file is out of date.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"file-storage-service/internal/openapi"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "Directory of the package that sets up the router")
+	root := flag.String("root", "setupRouter", "Function that registers the routes")
+	specPath := flag.String("o", "openapi.json", "Where to write the OpenAPI description")
+	clientPath := flag.String("client", "client/client_gen.go", "Where to write the Go client, or \"\" for none")
+	flag.Parse()
+
+	doc, err := openapi.Generate(os.DirFS(*dir), ".", *root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	spec, err := doc.JSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*specPath, spec, 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	if *clientPath == "" {
+		return
+	}
+	client, err := openapi.GenerateClient(doc, "client")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*clientPath, client, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"file-storage-service/internal/files"
+)
+
+// A collection groups files under one ID, either uploaded together in a single multipart
+// request or gathered from existing file IDs, so they can be listed and downloaded as one
+// ZIP or tar built on the fly. Collections only reference their files: each file keeps its
+// own expiry and delete password, and the collection lives in Redis until its last file
+// expires. Password-protected files can't be collected, since one download serves them all.
+// Files sharing a name are handled by the collection's name collision policy: rejected,
+// numbered in downloads, or overwritten by the later file.
+
+// maxCollectionFiles is the most files a collection may hold
+const maxCollectionFiles = 100
+
+// Collection is a named group of files
+type Collection struct {
+	ID           string                `json:"id"`
+	Name         string                `json:"name,omitempty"`
+	FileIDs      []string              `json:"file_ids"`
+	NameConflict files.CollisionPolicy `json:"name_conflict,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+	ExpiresAt    time.Time             `json:"expires_at"`
+}
+
+// CollectionRequest gathers existing files into a collection
+type CollectionRequest struct {
+	Name       string   `json:"name"`
+	FileIDs    []string `json:"file_ids"`
+	OnConflict string   `json:"on_conflict,omitempty"` // reject, rename or overwrite
+}
+
+// collisionPolicy resolves the name collision policy of a new collection: the one the
+// request asks for, else the default of the uploader's org, else the server's. It writes
+// the error response and returns false for an unknown policy.
+func (s *FileService) collisionPolicy(c *gin.Context, requested string) (files.CollisionPolicy, bool) {
+	// COLLECTION_NAME_CONFLICT was checked at startup
+	fallback, _ := files.ParseCollisionPolicy(s.config.CollectionNameConflict, files.CollisionRename)
+	if policy, err := s.orgPolicyFor(apiKeyFromContext(c)); err != nil {
+		log.Printf("Failed to get org policy, using the default name collision policy: %v", err)
+	} else if policy != nil && policy.NameConflict != "" {
+		fallback = files.CollisionPolicy(policy.NameConflict)
+	}
+
+	policy, err := files.ParseCollisionPolicy(requested, fallback)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return policy, true
+}
+
+// resolveNameCollisions applies a collision policy to the names of files being collected
+// in order, returning which of them stay in the collection. Under reject it writes a 409
+// response and returns false.
+func resolveNameCollisions(c *gin.Context, names []string, policy files.CollisionPolicy) ([]bool, bool) {
+	namespace := files.NewNamespace(policy)
+	keep := make([]bool, len(names))
+	for i, name := range names {
+		_, replaced, err := namespace.Add(name)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "Duplicate filename",
+				"message":     "Another file in the collection has the same name.",
+				"filename":    name,
+				"on_conflict": policy,
+			})
+			return nil, false
+		}
+		keep[i] = true
+		if replaced >= 0 {
+			keep[replaced] = false
+		}
+	}
+	return keep, true
+}
+
+// saveCollection stores a collection until its last file expires
+func (s *FileService) saveCollection(collection *Collection) error {
+	collectionJSON, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(context.Background(), "collection:"+collection.ID, collectionJSON, collection.ExpiresAt.Sub(s.clock.Now())).Err()
+}
+
+// getCollection returns a collection, or nil when it doesn't exist or has expired
+func (s *FileService) getCollection(collectionID string) (*Collection, error) {
+	collectionJSON, err := s.redis.Get(context.Background(), "collection:"+collectionID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var collection Collection
+	if err := json.Unmarshal(collectionJSON, &collection); err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// newCollection creates and stores a collection of files, writing the response with the
+// files' metadata
+func (s *FileService) newCollection(c *gin.Context, name string, policy files.CollisionPolicy, metadata []FileMetadata) {
+	now := s.clock.Now()
+	collection := &Collection{ID: generateID(), Name: name, NameConflict: policy, CreatedAt: now, ExpiresAt: now}
+	for _, file := range metadata {
+		collection.FileIDs = append(collection.FileIDs, file.ID)
+		if file.ExpiresAt.After(collection.ExpiresAt) {
+			collection.ExpiresAt = file.ExpiresAt
+		}
+	}
+
+	if err := s.saveCollection(collection); err != nil {
+		log.Printf("Failed to save collection %s: %v", collection.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save collection"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"collection_id": collection.ID,
+		"name":          collection.Name,
+		"name_conflict": collection.NameConflict,
+		"files":         metadata,
+		"expires_at":    collection.ExpiresAt,
+	})
+}
+
+// createCollection gathers existing files into a new collection
+//
+// @summary Collect existing files
+// @tags collections
+// @body json CollectionRequest
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) createCollection(c *gin.Context) {
+	var req CollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file_ids is required"})
+		return
+	}
+	if len(req.FileIDs) > maxCollectionFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A collection holds at most %d files", maxCollectionFiles)})
+		return
+	}
+	policy, ok := s.collisionPolicy(c, req.OnConflict)
+	if !ok {
+		return
+	}
+
+	seen := map[string]bool{}
+	var metadata []FileMetadata
+	for _, fileID := range req.FileIDs {
+		if seen[fileID] {
+			continue
+		}
+		seen[fileID] = true
+
+		file, err := s.lookupFile(fileID, false)
+		if err != nil {
+			log.Printf("Failed to get file metadata: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if file == nil || file.ExpiresAt.Before(s.clock.Now()) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found", "file_id": fileID})
+			return
+		}
+		if file.HasDownloadPassword {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Password-protected files can't be added to a collection",
+				"file_id": fileID,
+			})
+			return
+		}
+		metadata = append(metadata, publicMetadata(file))
+	}
+
+	names := make([]string, len(metadata))
+	for i, file := range metadata {
+		names[i] = file.Filename
+	}
+	keep, ok := resolveNameCollisions(c, names, policy)
+	if !ok {
+		return
+	}
+	kept := make([]FileMetadata, 0, len(metadata))
+	for i, file := range metadata {
+		if keep[i] {
+			kept = append(kept, file)
+		}
+	}
+
+	s.newCollection(c, req.Name, policy, kept)
+}
+
+// uploadCollection stores every file of a multipart request (in "files" fields) and
+// collects them, answering with each file's metadata and delete password. The upload is
+// all or nothing: when one file is rejected, the ones already stored are deleted again.
+//
+// @summary Upload files as a collection
+// @tags collections
+// @form files []file required The files
+// @form name string Name of the collection
+// @form on_conflict string What to do with duplicate names: rename, overwrite or reject
+// @form storage_class string Storage class of the files
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) uploadCollection(c *gin.Context) {
+	release, ok := s.acquireUploadSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		return
+	}
+	headers := form.File["files"]
+	if len(headers) > maxCollectionFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A collection holds at most %d files", maxCollectionFiles)})
+		return
+	}
+
+	// Files an overwrite drops aren't stored at all
+	policy, ok := s.collisionPolicy(c, c.PostForm("on_conflict"))
+	if !ok {
+		return
+	}
+	names := make([]string, len(headers))
+	for i, header := range headers {
+		names[i] = files.NormalizeName(header.Filename)
+	}
+	keep, ok := resolveNameCollisions(c, names, policy)
+	if !ok {
+		return
+	}
+	kept := headers[:0:0]
+	for i, header := range headers {
+		if keep[i] {
+			kept = append(kept, header)
+		}
+	}
+	headers = kept
+
+	// Check every file before storing any
+	var total int64
+	for _, header := range headers {
+		if !checkExtensionPolicy(c, s.config, files.NormalizeName(header.Filename), header.Size) {
+			return
+		}
+		if !s.checkOrgPolicy(c, files.NormalizeName(header.Filename), false) {
+			return
+		}
+		if header.Size > s.config.ChunkThreshold {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":       "File too large for standard upload",
+				"message":     "Files larger than the chunk threshold must use chunked upload",
+				"filename":    header.Filename,
+				"max_size":    s.config.ChunkThreshold,
+				"use_chunked": true,
+			})
+			return
+		}
+		total += header.Size
+	}
+
+	apiKey := apiKeyFromContext(c)
+	if !s.checkUploadQuota(c, total) {
+		return
+	}
+	storageClass, ok := s.storageClassFromRequest(c, c.PostForm("storage_class"), apiKey)
+	if !ok {
+		return
+	}
+
+	var metadata []FileMetadata
+	var stored []*FileStorage
+	for _, header := range headers {
+		fileMetadata, file, ok := s.storeCollectionFile(c, header, apiKey, storageClass)
+		if !ok {
+			for _, file := range stored {
+				s.discardStoredFile(file)
+			}
+			return
+		}
+		metadata = append(metadata, *fileMetadata)
+		stored = append(stored, file)
+	}
+
+	s.newCollection(c, c.PostForm("name"), policy, metadata)
+}
+
+// storeCollectionFile stores one file of a collection upload, writing the error response
+// and returning false when that fails
+func (s *FileService) storeCollectionFile(c *gin.Context, header *multipart.FileHeader, apiKey *APIKeyStorage, storageClass StorageClass) (*FileMetadata, *FileStorage, bool) {
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return nil, nil, false
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	content, err := io.ReadAll(io.TeeReader(file, hasher))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return nil, nil, false
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+
+	return s.saveUploadedContent(c, files.NormalizeName(header.Filename), content, contentHash, "", apiKey, storageClass, nil)
+}
+
+// discardStoredFile deletes a file that was stored as part of a failed request
+func (s *FileService) discardStoredFile(file *FileStorage) {
+	if err := s.db.DeleteFile(file.ID); err != nil {
+		log.Printf("Failed to delete file %s: %v", file.ID, err)
+	}
+	if file.StorageType == "disk" && file.StoragePath != nil {
+		if err := removeStoredFile(s.config, *file.StoragePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete file from disk: %v", err)
+		}
+	}
+	s.redis.Del(context.Background(), "file:"+file.ID)
+}
+
+// collectionFiles looks up the files of a collection that still exist. Files protected
+// with a download password after they were collected are left out like deleted ones,
+// since the collection can't ask for their passwords.
+func (s *FileService) collectionFiles(collection *Collection, withContent bool) ([]*FileStorage, error) {
+	var collected []*FileStorage
+	for _, fileID := range collection.FileIDs {
+		file, err := s.lookupFile(fileID, withContent)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil && !file.ExpiresAt.Before(s.clock.Now()) && !file.HasDownloadPassword {
+			collected = append(collected, file)
+		}
+	}
+	return collected, nil
+}
+
+// loadCollection looks up the collection of the :id parameter and its remaining files,
+// answering the request itself when that fails
+func (s *FileService) loadCollection(c *gin.Context, withContent bool) (*Collection, []*FileStorage, bool) {
+	collection, err := s.getCollection(c.Param("id"))
+	if err != nil {
+		log.Printf("Failed to get collection: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read collection"})
+		return nil, nil, false
+	}
+	if collection == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Collection not found or expired"})
+		return nil, nil, false
+	}
+	collected, err := s.collectionFiles(collection, withContent)
+	if err != nil {
+		log.Printf("Failed to get files of collection %s: %v", collection.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, nil, false
+	}
+	return collection, collected, true
+}
+
+// getCollectionFiles lists the files of a collection that haven't expired or been deleted
+//
+// @summary List the files of a collection
+// @tags collections
+// @path id Collection ID
+// @success 200 json
+func (s *FileService) getCollectionFiles(c *gin.Context) {
+	collection, collected, ok := s.loadCollection(c, false)
+	if !ok {
+		return
+	}
+
+	metadata := make([]FileMetadata, 0, len(collected))
+	var totalSize int64
+	for _, file := range collected {
+		metadata = append(metadata, publicMetadata(file))
+		totalSize += file.OriginalSize
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":            collection.ID,
+		"name":          collection.Name,
+		"name_conflict": collection.NameConflict,
+		"files":         metadata,
+		"total":         len(metadata),
+		"total_size":    totalSize,
+		"created_at":    collection.CreatedAt,
+		"expires_at":    collection.ExpiresAt,
+	})
+}
+
+// collectionEntryNames gives each file a unique name inside the download, numbering
+// repeated filenames like "notes (2).txt"
+func collectionEntryNames(collected []*FileStorage) []string {
+	namespace := files.NewNamespace(files.CollisionRename)
+	names := make([]string, len(collected))
+	for i, file := range collected {
+		names[i], _, _ = namespace.Add(file.Filename)
+	}
+	return names
+}
+
+// downloadCollection streams every remaining file of a collection as one ZIP or, with
+// format=tar, tar archive built on the fly
+//
+// @summary Download a collection as one archive
+// @tags collections
+// @path id Collection ID
+// @query format string zip or tar
+// @success 200 application/zip application/x-tar
+func (s *FileService) downloadCollection(c *gin.Context) {
+	format := c.DefaultQuery("format", "zip")
+	if format != "zip" && format != "tar" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or tar"})
+		return
+	}
+
+	collection, collected, ok := s.loadCollection(c, false)
+	if !ok {
+		return
+	}
+	if len(collected) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "All files of the collection have expired"})
+		return
+	}
+	// Streaming can't skip a file halfway, so the archive waits until every file is cleared
+	for _, file := range collected {
+		if !requireScanCleared(c, file) {
+			return
+		}
+	}
+
+	name := collection.Name
+	if name == "" {
+		name = "collection-" + collection.ID
+	}
+	contentType := "application/zip"
+	if format == "tar" {
+		contentType = "application/x-tar"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", files.ContentDisposition("attachment", files.NormalizeName(name)+"."+format))
+	c.Status(http.StatusOK)
+
+	sw := s.newStreamWriter(c, false)
+	defer sw.Close()
+
+	var err error
+	if format == "tar" {
+		err = s.writeCollectionTar(sw, collected)
+	} else {
+		err = s.writeCollectionZip(sw, collected)
+	}
+	if err != nil {
+		// The status is already sent; a truncated archive fails to open on the client
+		log.Printf("Failed to stream collection %s: %v", collection.ID, err)
+	}
+}
+
+// openCollectionFile opens the content of one collected file for reading
+func (s *FileService) openCollectionFile(file *FileStorage) (io.Reader, int64, func(), error) {
+	// The listing was loaded without content; fetch it one file at a time
+	withContent, err := s.lookupFile(file.ID, true)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if withContent == nil {
+		return nil, 0, nil, fmt.Errorf("file %s disappeared", file.ID)
+	}
+	source, size, closer, err := s.archiveSource(withContent)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return io.NewSectionReader(source, 0, size), size, closer, nil
+}
+
+func (s *FileService) writeCollectionZip(w io.Writer, collected []*FileStorage) error {
+	zipWriter := zip.NewWriter(w)
+	for i, name := range collectionEntryNames(collected) {
+		file := collected[i]
+		// Formats that don't shrink are stored as they are
+		method := zip.Deflate
+		if s.compressor.SelectCompressionType(file.Filename, file.OriginalSize) == CompressionNone {
+			method = zip.Store
+		}
+		if err := s.copyCollectionFile(file, func(size int64) (io.Writer, error) {
+			return zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: file.UploadTime})
+		}); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func (s *FileService) writeCollectionTar(w io.Writer, collected []*FileStorage) error {
+	tarWriter := tar.NewWriter(w)
+	for i, name := range collectionEntryNames(collected) {
+		file := collected[i]
+		if err := s.copyCollectionFile(file, func(size int64) (io.Writer, error) {
+			return tarWriter, tarWriter.WriteHeader(&tar.Header{
+				Name:     name,
+				Mode:     0644,
+				Size:     size,
+				ModTime:  file.UploadTime,
+				Typeflag: tar.TypeReg,
+				Format:   tar.FormatPAX,
+			})
+		}); err != nil {
+			return err
+		}
+	}
+	return tarWriter.Close()
+}
+
+// copyCollectionFile copies a file's content into the entry create starts for it
+func (s *FileService) copyCollectionFile(file *FileStorage, create func(size int64) (io.Writer, error)) error {
+	content, size, closer, err := s.openCollectionFile(file)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	target, err := create(size)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, content)
+	return err
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCollectionUploadAndDownload(t *testing.T) {
+	ts := newTestService(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, file := range []struct{ name, content string }{
+		{"notes.txt", "first notes"},
+		{"notes.txt", "second notes"},
+		{"data.csv", "a,b\n1,2\n"},
+	} {
+		part, err := writer.CreateFormFile("files", file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file.content))
+	}
+	writer.WriteField("name", "release")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/collections/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := ts.serve(ts.uploadCollection, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		CollectionID string         `json:"collection_id"`
+		Files        []FileMetadata `json:"files"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Files) != 3 || created.Files[0].DeletePassword == "" {
+		t.Fatalf("upload response lists %d files (delete password %q)", len(created.Files), created.Files[0].DeletePassword)
+	}
+	param := gin.Param{Key: "id", Value: created.CollectionID}
+
+	w = ts.serve(ts.getCollectionFiles, httptest.NewRequest(http.MethodGet, "/api/collections/x", nil), param)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":3`) || strings.Contains(w.Body.String(), created.Files[0].DeletePassword) {
+		t.Errorf("listing: got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = ts.serve(ts.downloadCollection, httptest.NewRequest(http.MethodGet, "/api/collections/x/download", nil), param)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "release.zip") {
+		t.Fatalf("zip download: got %d, disposition %q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	entries := readZipEntries(t, w.Body.Bytes())
+	if entries["notes.txt"] != "first notes" || entries["notes (2).txt"] != "second notes" || entries["data.csv"] != "a,b\n1,2\n" {
+		t.Errorf("zip entries %v", entries)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/collections/x/download?format=tar", nil)
+	w = ts.serve(ts.downloadCollection, req, param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("tar download: got %d", w.Code)
+	}
+	tarReader := tar.NewReader(w.Body)
+	var names []string
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tarReader)
+		if header.Name == "data.csv" && string(data) != "a,b\n1,2\n" {
+			t.Errorf("tar data.csv = %q", data)
+		}
+		names = append(names, header.Name)
+	}
+	if strings.Join(names, ",") != "notes.txt,notes (2).txt,data.csv" {
+		t.Errorf("tar entries %v", names)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/collections/x/download?format=rar", nil)
+	if w := ts.serve(ts.downloadCollection, req, param); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: got %d, want 400", w.Code)
+	}
+}
+
+func TestCreateCollectionFromExistingFiles(t *testing.T) {
+	ts := newTestService(t)
+	saveArchiveTestFile(t, ts, "one", "one.bin", []byte("1"))
+	saveArchiveTestFile(t, ts, "two", "two.bin", []byte("22"))
+	protected := saveRangeTestFile(t, ts, "locked", "postgresql", CompressionNone, []byte("secret"))
+	protected.HasDownloadPassword = true
+	ts.store.SaveFile(protected)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/collections", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.createCollection, req)
+	}
+
+	if w := create(`{"file_ids":["one","missing"]}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing file: got %d, want 404", w.Code)
+	}
+	if w := create(`{"file_ids":["one","locked"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("protected file: got %d, want 400", w.Code)
+	}
+	if w := create(`{"file_ids":[]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("no files: got %d, want 400", w.Code)
+	}
+
+	w := create(`{"name":"pair","file_ids":["one","two","one"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		CollectionID string `json:"collection_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	param := gin.Param{Key: "id", Value: created.CollectionID}
+
+	// Deleted files drop out of the collection
+	ts.store.DeleteFile("two")
+	w = ts.serve(ts.downloadCollection, httptest.NewRequest(http.MethodGet, "/api/collections/x/download", nil), param)
+	if entries := readZipEntries(t, w.Body.Bytes()); sortedKeys(entries) != "one.bin" {
+		t.Errorf("after deleting a file: entries %v", entries)
+	}
+
+	ts.store.DeleteFile("one")
+	w = ts.serve(ts.downloadCollection, httptest.NewRequest(http.MethodGet, "/api/collections/x/download", nil), param)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("all files gone: got %d, want 404", w.Code)
+	}
+	w = ts.serve(ts.getCollectionFiles, httptest.NewRequest(http.MethodGet, "/api/collections/x", nil), gin.Param{Key: "id", Value: "nope"})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown collection: got %d, want 404", w.Code)
+	}
+}
+
+func TestCollectionNameConflicts(t *testing.T) {
+	ts := newTestService(t)
+	saveArchiveTestFile(t, ts, "old", "report.pdf", []byte("v1"))
+	saveArchiveTestFile(t, ts, "new", "Report.pdf", []byte("v2"))
+	saveArchiveTestFile(t, ts, "other", "notes.txt", []byte("n"))
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/collections", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.createCollection, req)
+	}
+	fileIDs := func(w *httptest.ResponseRecorder) string {
+		var created struct {
+			Files []FileMetadata `json:"files"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		var ids []string
+		for _, file := range created.Files {
+			ids = append(ids, file.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	if w := create(`{"file_ids":["old","new","other"],"on_conflict":"reject"}`); w.Code != http.StatusConflict {
+		t.Errorf("reject: got %d, want 409", w.Code)
+	}
+	if w := create(`{"file_ids":["old","new","other"],"on_conflict":"overwrite"}`); w.Code != http.StatusOK || fileIDs(w) != "new,other" {
+		t.Errorf("overwrite: got %d, files %s", w.Code, fileIDs(w))
+	}
+	if w := create(`{"file_ids":["old","new"],"on_conflict":"merge"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown policy: got %d, want 400", w.Code)
+	}
+
+	// The server default applies when the request doesn't choose
+	ts.config.CollectionNameConflict = "reject"
+	if w := create(`{"file_ids":["old","new"]}`); w.Code != http.StatusConflict {
+		t.Errorf("default reject: got %d, want 409", w.Code)
+	}
+	if w := create(`{"file_ids":["old","new"],"on_conflict":"rename"}`); w.Code != http.StatusOK || fileIDs(w) != "old,new" {
+		t.Errorf("rename: got %d, files %s", w.Code, fileIDs(w))
+	}
+}
+
+func TestCollectionSkipsFilesProtectedLater(t *testing.T) {
+	ts := newTestService(t)
+	saveArchiveTestFile(t, ts, "open", "open.bin", []byte("1"))
+	saveArchiveTestFile(t, ts, "later", "later.bin", []byte("secret"))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/collections", strings.NewReader(`{"file_ids":["open","later"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(ts.createCollection, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		CollectionID string `json:"collection_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	param := gin.Param{Key: "id", Value: created.CollectionID}
+
+	// The owner sets a download password after the file was collected
+	stored, _ := ts.store.GetFile("later")
+	password := "hunter2"
+	stored.HasDownloadPassword = true
+	stored.DownloadPassword = &password
+	ts.store.SaveFile(stored)
+
+	w = ts.serve(ts.getCollectionFiles, httptest.NewRequest(http.MethodGet, "/api/collections/x", nil), param)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "later") {
+		t.Errorf("listing: got %d: %s", w.Code, w.Body.String())
+	}
+	w = ts.serve(ts.downloadCollection, httptest.NewRequest(http.MethodGet, "/api/collections/x/download", nil), param)
+	if entries := readZipEntries(t, w.Body.Bytes()); sortedKeys(entries) != "open.bin" {
+		t.Errorf("download: entries %v", entries)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,11 +28,38 @@ type Config struct {
 	DatabaseMaxConns int
 	DatabaseMinConns int
 
+	// Embedded mode: "sqlite" keeps metadata in an SQLite file instead of PostgreSQL
+	DatabaseDriver string
+	SQLitePath     string
+	SQLiteBlobDir  string // Content the database would hold; empty is "blobs" next to SQLitePath
+
 	// File storage
 	MaxFileSize       int64
 	MaxFilesPerUser   int
-	AllowedExtensions []string
-	ChunkThreshold    int64 // Files larger than this will use chunked upload
+	MaxBytesPerUser   int64            // 0 means unlimited
+	AllowedExtensions []string         // Empty means all extensions are allowed
+	BlockedExtensions []string         // Rejected even when allowed
+	ExtensionMaxSizes map[string]int64 // Per-extension limits below MaxFileSize
+	ChunkThreshold    int64            // Files larger than this will use chunked upload
+
+	// How long uploaded files are kept before they expire
+	FileRetention time.Duration
+
+	// How new file IDs look: "uuid", or "base58" for short IDs of FileIDLength characters
+	FileIDScheme string
+	FileIDLength int
+
+	// How long after the upload its owner may keep a file by extending its expiration; 0
+	// leaves extensions to admins. The default matches the 24 hours the privacy policy
+	// promises, so by default owners can't keep a file past it.
+	OwnerMaxLifetime time.Duration
+
+	// How long the previous content of a replaced file stays downloadable; 0 discards it
+	VersionRetention time.Duration
+
+	// How long a deleted file stays in the trash, restorable, before it is removed; 0
+	// removes files right away
+	TrashRetention time.Duration
 
 	// Chunk upload settings
 	ChunkSize        int64
@@ -39,19 +67,243 @@ type Config struct {
 	TempDir          string
 	ChunkTimeout     time.Duration
 
+	// Number of chunks written concurrently when assembling a chunked upload
+	ChunkAssemblyWorkers int
+
+	// Processing job queue: jobs processed concurrently per worker process, whether the API
+	// server also processes jobs, and how long a job may stay unacknowledged before another
+	// worker takes it over. Dedicated --worker processes must share TempDir with the API servers.
+	JobWorkers        int
+	EmbeddedJobWorker bool
+	JobClaimTimeout   time.Duration
+
+	// Attempts before a job failing with transient errors is moved to the dead letter, and
+	// the delay before the first retry, doubled after each further failure
+	JobMaxAttempts    int
+	JobRetryBaseDelay time.Duration
+
+	// Storage classes: directories for disk-backed classes (empty means TempDir/files),
+	// the class used when none is requested, and the classes anonymous uploaders may request
+	FastSSDStorageDir       string
+	ArchiveStorageDir       string
+	DefaultStorageClass     string
+	AnonymousStorageClasses string
+
+	// Prices used by the cost report, in dollars per GB-month stored per storage class and
+	// per GB served. Defaults approximate S3 Express, S3 Standard and Glacier Instant Retrieval.
+	CostFastSSDPerGBMonth  float64
+	CostStandardPerGBMonth float64
+	CostArchivePerGBMonth  float64
+	CostEgressPerGB        float64
+
 	// Compression
 	CompressionLevel int
 	EnableStreaming  bool
 
 	// Performance
 	MaxConcurrentUploads int
-	RequestTimeout       time.Duration
-	RedisPoolSize        int
-	RedisMaxIdleConns    int
-	RedisIdleTimeout     time.Duration
+	// Uploads below SmallUploadMaxSize wait in a fast lane of SmallUploadConcurrency
+	// slots when MaxConcurrentUploads are busy; 0 disables the lane
+	SmallUploadMaxSize     int64
+	SmallUploadConcurrency int
+	RequestTimeout         time.Duration
+	RedisPoolSize          int
+	RedisMaxIdleConns      int
+	RedisIdleTimeout       time.Duration
+
+	// Streamed downloads are flushed to the client every StreamFlushInterval, media every
+	// MediaFlushInterval; a write a client doesn't accept within StreamWriteTimeout fails
+	StreamFlushInterval time.Duration
+	MediaFlushInterval  time.Duration
+	StreamWriteTimeout  time.Duration
+
+	// Admin settings. Admin tokens are signed with AdminJWTSecret (a random secret per
+	// process when empty); tokens signed with one of the previous secrets stay valid, so
+	// the secret can be rotated without signing everyone out.
+	AdminPassword           string
+	AdminJWTSecret          string
+	AdminJWTPreviousSecrets []string
+	AdminTokenTTL           time.Duration
+
+	// AuthProvider is how admins sign in: "password" checks ADMIN_PASSWORD, "ldap" binds
+	// as the user against LDAPURL and grants admin to members of a group mapped to the
+	// admin role in LDAPGroupRoles (role:group DN pairs separated by semicolons)
+	AuthProvider       string
+	LDAPURL            string
+	LDAPBindDN         string
+	LDAPBindPassword   string
+	LDAPUserBaseDN     string
+	LDAPUserAttribute  string
+	LDAPGroupAttribute string
+	LDAPGroupRoles     string
+	LDAPCACert         string
+
+	// Bearer token identity providers provision users and groups with over SCIM at
+	// /scim/v2 (empty disables SCIM)
+	SCIMToken string
+
+	// Address of a separate admin listener serving the admin API, /metrics and pprof
+	// (empty keeps the admin API on the public port), with an optional TLS certificate
+	// and a CA that client certificates must be signed by
+	AdminAddr     string
+	AdminTLSCert  string
+	AdminTLSKey   string
+	AdminClientCA string
+
+	// TLS for the API listener, and the CA that API client certificates are verified
+	// against: offered certificates authenticate as their mapped API key, and the
+	// listener at ClientCertAddr, if any, accepts only clients with a certificate
+	TLSCert        string
+	TLSKey         string
+	ClientCA       string
+	ClientCertAddr string
+
+	// Hosts of other instances files may be imported from, as host or host:port (empty
+	// disables imports)
+	ImportAllowedHosts []string
+
+	// Address of the gRPC listener, which uses the TLS certificate of the API listener
+	// (empty disables gRPC)
+	GRPCAddr string
+
+	// Speed test
+	SpeedTestMaxSize   int64
+	SpeedTestRateLimit int // Speed test requests per minute per IP
+
+	// API keys
+	APIKeyDefaultRateLimit int
+
+	// Signs upload policies minted for browser uploads (a random secret per process when
+	// empty), and the longest a policy may stay valid
+	UploadPolicySecret      string
+	UploadPolicyMaxLifetime time.Duration
+
+	// Bytes each anonymous client IP may download per month (0 = unlimited); API keys
+	// have their own egress_quota_bytes
+	MonthlyEgressPerIP int64
 
-	// Admin settings
-	AdminPassword string
+	// Usage metering of API keys for billing: hourly records in PostgreSQL, also posted to
+	// the webhook when one is set, signed with the secret
+	MeteringEnabled       bool
+	MeteringWebhookURL    string
+	MeteringWebhookSecret string
+
+	// Small uploads (quick and base64)
+	QuickUploadMaxSize   int64
+	Base64UploadMaxSize  int64
+	MetadataQueueSize    int
+	MetadataQueueWorkers int
+
+	// Virus scanning with clamd (empty address disables scanning). Files larger than the
+	// max scan size are stored unscanned; with fail-open, uploads are accepted while clamd
+	// is unreachable instead of being refused.
+	ClamAVAddr        string
+	ClamAVTimeout     time.Duration
+	ClamAVMaxScanSize int64
+	ClamAVFailOpen    bool
+
+	// Verdicts of an external asynchronous scanner, posted to /api/scanner/verdict and
+	// signed with the secret (empty disables the endpoint). Deliveries older than the
+	// tolerance are refused as replays.
+	ScanWebhookSecret    string
+	ScanWebhookTolerance time.Duration
+
+	// Replication to a secondary PostgreSQL database (empty URL disables it) and the
+	// directory, typically a volume in another region, that disk-stored files are copied to
+	ReplicaDatabaseURL  string
+	ReplicaStorageDir   string
+	ReplicationInterval time.Duration
+
+	// How long entries of the file event log are kept. Events carry the client IP, so the
+	// default matches the 30 days the privacy policy promises for IP logs.
+	FileEventRetention time.Duration
+
+	// How long metered usage and the bandwidth of files and API keys are kept, and how
+	// long the bandwidth of a client IP is kept after it was last counted. Older bandwidth
+	// of keys and IPs is folded into anonymous monthly totals.
+	UsageRetention   time.Duration
+	UsageIPRetention time.Duration
+
+	// Semicolon-separated windows ("<cron> <duration>") in MaintenanceTimezone during which
+	// heavy background jobs run; empty allows them at any time
+	MaintenanceWindows  string
+	MaintenanceTimezone string
+
+	// Availability objective of each endpoint class, used for the burn-rate suggestions at
+	// /metrics, and where a --worker process serves its metrics (empty disables)
+	SLOAvailabilityTarget float64
+	WorkerMetricsAddr     string
+
+	// ffmpeg and ffprobe binaries for video posters and media info, and how long either
+	// may run on one file. The media endpoints answer 503 when they aren't installed.
+	FFmpegPath          string
+	FFprobePath         string
+	MediaProcessTimeout time.Duration
+
+	// Videos of at least HLSMinSize bytes are transcoded to HLS in the background
+	// (0 disables), by HLSWorkers per job worker process
+	HLSMinSize          int64
+	HLSSegmentSeconds   int
+	HLSWorkers          int
+	HLSTranscodeTimeout time.Duration
+
+	// MKV and AVI files with browser-playable codecs are remuxed to MP4 or WebM on
+	// request by RemuxWorkers per job worker process (0 disables)
+	RemuxWorkers int
+	RemuxTimeout time.Duration
+
+	// poppler's pdftoppm and pdfinfo binaries for PDF page previews, which share
+	// MediaProcessTimeout
+	PDFToPPMPath string
+	PDFInfoPath  string
+
+	// Base URL clients reach the service at, for links in generated documents such as
+	// metalinks (empty uses the request's host), and base URLs of mirrors serving the
+	// same /api/file paths, such as a CDN in front of the service
+	PublicURL  string
+	MirrorURLs []string
+
+	// Drop folder: files placed in DropDir are uploaded once they stop changing for a scan
+	// interval (empty disables). DropAPIKeyID owns the uploads (empty uploads anonymously).
+	// DropRemove deletes ingested files instead of moving them to DropDir/ingested.
+	DropDir          string
+	DropScanInterval time.Duration
+	DropAPIKeyID     string
+	DropStorageClass string
+	DropRemove       bool
+
+	// SMTP server that mails download links when an upload asks for it (empty SMTPHost
+	// disables), the body template file and subject, and how many mails one API key or
+	// IP may send per hour and one address may receive per day
+	SMTPHost                     string
+	SMTPPort                     int
+	SMTPUsername                 string
+	SMTPPassword                 string
+	SMTPFrom                     string
+	EmailLinkTemplate            string
+	EmailLinkSubject             string
+	EmailLinkHourlyLimit         int
+	EmailLinkRecipientDailyLimit int
+
+	// Whether /api/stats publishes rounded service totals for landing pages
+	PublicStatsEnabled bool
+
+	// What a collection does with files sharing a name when neither the request nor the
+	// uploader's org chooses: reject, rename or overwrite
+	CollectionNameConflict string
+
+	// Abuse detection: client IPs are scored on honeypot hits and 404 bursts (more than
+	// AbuseNotFoundLimit a minute), throttled from AbuseThrottleScore and blocked for
+	// AbuseBlockDuration from AbuseBlockScore
+	AbuseDetection     bool
+	AbuseThrottleScore int
+	AbuseBlockScore    int
+	AbuseBlockDuration time.Duration
+	AbuseNotFoundLimit int
+
+	// Development: seed fixture files on startup and serve /api/dev to reset them. Never
+	// enable in production.
+	FakeData bool
 }
 
 func LoadConfig() *Config {
@@ -73,26 +325,179 @@ func LoadConfig() *Config {
 		DatabaseMaxConns: getEnvInt("DB_MAX_CONNS", 20),
 		DatabaseMinConns: getEnvInt("DB_MIN_CONNS", 5),
 
+		DatabaseDriver: getEnv("DATABASE_DRIVER", "postgres"),
+		SQLitePath:     getEnv("SQLITE_PATH", "./data/file-storage.db"),
+		SQLiteBlobDir:  getEnv("SQLITE_BLOB_DIR", ""),
+
 		MaxFileSize:       getEnvInt64("MAX_FILE_SIZE", 10*1024*1024*1024), // 10GB
-		MaxFilesPerUser:   getEnvInt("MAX_FILES_PER_USER", 1000),
-		AllowedExtensions: []string{},                                    // Empty means all extensions allowed
+		MaxFilesPerUser:   getEnvInt("MAX_FILES_PER_USER", 1000),           // 0 = unlimited
+		MaxBytesPerUser:   getEnvInt64("MAX_BYTES_PER_USER", 0),
+		AllowedExtensions: getEnvList("ALLOWED_EXTENSIONS"),
+		BlockedExtensions: getEnvList("BLOCKED_EXTENSIONS"),
+		ExtensionMaxSizes: getEnvSizeMap("EXTENSION_MAX_SIZES"),
 		ChunkThreshold:    getEnvInt64("CHUNK_THRESHOLD", 100*1024*1024), // 100MB threshold
 
+		FileRetention:    time.Duration(getEnvInt("FILE_RETENTION_HOURS", 24)) * time.Hour,
+		FileIDScheme:     getEnv("FILE_ID_SCHEME", "uuid"),
+		FileIDLength:     getEnvInt("FILE_ID_LENGTH", 10),
+		OwnerMaxLifetime: time.Duration(getEnvInt("OWNER_MAX_LIFETIME_HOURS", 24)) * time.Hour,
+		VersionRetention: time.Duration(getEnvInt("VERSION_RETENTION_HOURS", 168)) * time.Hour,
+		TrashRetention:   time.Duration(getEnvInt("TRASH_RETENTION_HOURS", 24)) * time.Hour,
+
 		// Chunk upload settings
 		ChunkSize:        getEnvInt64("CHUNK_SIZE", 50*1024*1024), // 50MB chunks (optimized for better progress tracking)
 		MaxChunksPerFile: getEnvInt("MAX_CHUNKS_PER_FILE", 200),   // 200 chunks max (10GB total)
 		TempDir:          getEnv("TEMP_DIR", "./temp"),
 		ChunkTimeout:     getEnvDuration("CHUNK_TIMEOUT", "30m"), // Increased timeout for larger chunks
 
-		CompressionLevel:     getEnvInt("COMPRESSION_LEVEL", 6),
-		EnableStreaming:      getEnvBool("ENABLE_STREAMING", true),
-		MaxConcurrentUploads: getEnvInt("MAX_CONCURRENT_UPLOADS", 50),
-		RequestTimeout:       getEnvDuration("REQUEST_TIMEOUT", "15m"), // Increased for large file processing
-		RedisPoolSize:        getEnvInt("REDIS_POOL_SIZE", 100),        // Increased for high concurrency
-		RedisMaxIdleConns:    getEnvInt("REDIS_MAX_IDLE_CONNS", 20),
-		RedisIdleTimeout:     getEnvDuration("REDIS_IDLE_TIMEOUT", "5m"),
+		ChunkAssemblyWorkers: getEnvInt("CHUNK_ASSEMBLY_WORKERS", 4),
+
+		JobWorkers:        getEnvInt("JOB_WORKERS", 2),
+		EmbeddedJobWorker: getEnvBool("EMBEDDED_JOB_WORKER", true),
+		JobClaimTimeout:   getEnvDuration("JOB_CLAIM_TIMEOUT", "30m"),
+		JobMaxAttempts:    getEnvInt("JOB_MAX_ATTEMPTS", 5),
+		JobRetryBaseDelay: getEnvDuration("JOB_RETRY_BASE_DELAY", "10s"),
+
+		FastSSDStorageDir:       getEnv("STORAGE_CLASS_FAST_SSD_DIR", ""),
+		ArchiveStorageDir:       getEnv("STORAGE_CLASS_ARCHIVE_DIR", ""),
+		DefaultStorageClass:     getEnv("DEFAULT_STORAGE_CLASS", "standard"),
+		AnonymousStorageClasses: getEnv("ANONYMOUS_STORAGE_CLASSES", "standard"),
 
-		AdminPassword: getEnv("ADMIN_PASSWORD", ""),
+		CostFastSSDPerGBMonth:  getEnvFloat("COST_FAST_SSD_PER_GB_MONTH", 0.16),
+		CostStandardPerGBMonth: getEnvFloat("COST_STANDARD_PER_GB_MONTH", 0.023),
+		CostArchivePerGBMonth:  getEnvFloat("COST_ARCHIVE_PER_GB_MONTH", 0.004),
+		CostEgressPerGB:        getEnvFloat("COST_EGRESS_PER_GB", 0.09),
+
+		CompressionLevel:       getEnvInt("COMPRESSION_LEVEL", 6),
+		EnableStreaming:        getEnvBool("ENABLE_STREAMING", true),
+		MaxConcurrentUploads:   getEnvInt("MAX_CONCURRENT_UPLOADS", 50),
+		SmallUploadMaxSize:     getEnvInt64("SMALL_UPLOAD_MAX_SIZE", 10*1024*1024), // 10MB
+		SmallUploadConcurrency: getEnvInt("SMALL_UPLOAD_CONCURRENCY", 10),
+		StreamFlushInterval:    getEnvDuration("STREAM_FLUSH_INTERVAL", "1s"),
+		MediaFlushInterval:     getEnvDuration("MEDIA_FLUSH_INTERVAL", "100ms"),
+		StreamWriteTimeout:     getEnvDuration("STREAM_WRITE_TIMEOUT", "30s"),
+		RequestTimeout:         getEnvDuration("REQUEST_TIMEOUT", "15m"), // Increased for large file processing
+		RedisPoolSize:          getEnvInt("REDIS_POOL_SIZE", 100),        // Increased for high concurrency
+		RedisMaxIdleConns:      getEnvInt("REDIS_MAX_IDLE_CONNS", 20),
+		RedisIdleTimeout:       getEnvDuration("REDIS_IDLE_TIMEOUT", "5m"),
+
+		AdminPassword:           getEnv("ADMIN_PASSWORD", ""),
+		AdminJWTSecret:          getEnv("ADMIN_JWT_SECRET", ""),
+		AdminJWTPreviousSecrets: getEnvList("ADMIN_JWT_PREVIOUS_SECRETS"),
+		AdminTokenTTL:           getEnvDuration("ADMIN_TOKEN_TTL", "2h"),
+
+		AuthProvider:       getEnv("AUTH_PROVIDER", "password"),
+		LDAPURL:            getEnv("LDAP_URL", ""),
+		LDAPBindDN:         getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:   getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPUserBaseDN:     getEnv("LDAP_USER_BASE_DN", ""),
+		LDAPUserAttribute:  getEnv("LDAP_USER_ATTRIBUTE", "uid"),
+		LDAPGroupAttribute: getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPGroupRoles:     getEnv("LDAP_GROUP_ROLES", ""),
+		LDAPCACert:         getEnv("LDAP_CA_CERT", ""),
+
+		SCIMToken: getEnv("SCIM_TOKEN", ""),
+
+		AdminAddr:     getEnv("ADMIN_ADDR", ""),
+		AdminTLSCert:  getEnv("ADMIN_TLS_CERT", ""),
+		AdminTLSKey:   getEnv("ADMIN_TLS_KEY", ""),
+		AdminClientCA: getEnv("ADMIN_CLIENT_CA", ""),
+
+		TLSCert:        getEnv("TLS_CERT", ""),
+		TLSKey:         getEnv("TLS_KEY", ""),
+		ClientCA:       getEnv("CLIENT_CA", ""),
+		ClientCertAddr: getEnv("CLIENT_CERT_ADDR", ""),
+
+		ImportAllowedHosts: getEnvList("IMPORT_ALLOWED_HOSTS"),
+
+		GRPCAddr: getEnv("GRPC_ADDR", ""),
+
+		SpeedTestMaxSize:   getEnvInt64("SPEEDTEST_MAX_SIZE", 25*1024*1024), // 25MB per speed test request
+		SpeedTestRateLimit: getEnvInt("SPEEDTEST_RATE_LIMIT", 10),
+
+		APIKeyDefaultRateLimit: getEnvInt("API_KEY_DEFAULT_RATE_LIMIT", 600), // Requests per minute for new keys
+
+		UploadPolicySecret:      getEnv("UPLOAD_POLICY_SECRET", ""),
+		UploadPolicyMaxLifetime: getEnvDuration("UPLOAD_POLICY_MAX_LIFETIME", "168h"),
+
+		MonthlyEgressPerIP: getEnvInt64("MONTHLY_EGRESS_BYTES_PER_IP", 0),
+
+		MeteringEnabled:       getEnvBool("METERING_ENABLED", false),
+		MeteringWebhookURL:    getEnv("METERING_WEBHOOK_URL", ""),
+		MeteringWebhookSecret: getEnv("METERING_WEBHOOK_SECRET", ""),
+
+		QuickUploadMaxSize:   getEnvInt64("QUICK_UPLOAD_MAX_SIZE", 1024*1024),     // 1MB
+		Base64UploadMaxSize:  getEnvInt64("BASE64_UPLOAD_MAX_SIZE", 10*1024*1024), // 10MB decoded
+		MetadataQueueSize:    getEnvInt("METADATA_QUEUE_SIZE", 1000),
+		MetadataQueueWorkers: getEnvInt("METADATA_QUEUE_WORKERS", 4),
+
+		ClamAVAddr:        getEnv("CLAMAV_ADDR", ""),
+		ClamAVTimeout:     getEnvDuration("CLAMAV_TIMEOUT", "2m"),
+		ClamAVMaxScanSize: getEnvInt64("CLAMAV_MAX_SCAN_SIZE", 100*1024*1024), // clamd's default StreamMaxLength is 25MB; raise it to match
+		ClamAVFailOpen:    getEnvBool("CLAMAV_FAIL_OPEN", false),
+
+		ScanWebhookSecret:    getEnv("SCAN_WEBHOOK_SECRET", ""),
+		ScanWebhookTolerance: getEnvDuration("SCAN_WEBHOOK_TOLERANCE", "5m"),
+
+		ReplicaDatabaseURL:  getEnv("REPLICA_DATABASE_URL", ""),
+		ReplicaStorageDir:   getEnv("REPLICA_STORAGE_DIR", "./replica"),
+		ReplicationInterval: getEnvDuration("REPLICATION_INTERVAL", "5s"),
+
+		FileEventRetention: time.Duration(getEnvInt("FILE_EVENT_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		UsageRetention:     time.Duration(getEnvInt("USAGE_RETENTION_DAYS", 400)) * 24 * time.Hour,
+		UsageIPRetention:   time.Duration(getEnvInt("USAGE_IP_RETENTION_DAYS", 30)) * 24 * time.Hour,
+
+		MaintenanceWindows:  getEnv("MAINTENANCE_WINDOWS", ""),
+		MaintenanceTimezone: getEnv("MAINTENANCE_TIMEZONE", "UTC"),
+
+		SLOAvailabilityTarget: getEnvFloat("SLO_AVAILABILITY_TARGET", 0.999),
+		WorkerMetricsAddr:     getEnv("WORKER_METRICS_ADDR", ""),
+
+		FFmpegPath:          getEnv("FFMPEG_PATH", "ffmpeg"),
+		FFprobePath:         getEnv("FFPROBE_PATH", "ffprobe"),
+		MediaProcessTimeout: getEnvDuration("MEDIA_PROCESS_TIMEOUT", "1m"),
+
+		HLSMinSize:          getEnvInt64("HLS_MIN_SIZE", 0),
+		HLSSegmentSeconds:   getEnvInt("HLS_SEGMENT_SECONDS", 6),
+		HLSWorkers:          getEnvInt("HLS_WORKERS", 1),
+		HLSTranscodeTimeout: getEnvDuration("HLS_TRANSCODE_TIMEOUT", "2h"),
+
+		RemuxWorkers: getEnvInt("REMUX_WORKERS", 1),
+		RemuxTimeout: getEnvDuration("REMUX_TIMEOUT", "30m"),
+
+		PDFToPPMPath: getEnv("PDFTOPPM_PATH", "pdftoppm"),
+		PDFInfoPath:  getEnv("PDFINFO_PATH", "pdfinfo"),
+
+		PublicURL:  strings.TrimSuffix(getEnv("PUBLIC_URL", ""), "/"),
+		MirrorURLs: getEnvList("MIRROR_URLS"),
+
+		DropDir:          getEnv("DROP_DIR", ""),
+		DropScanInterval: getEnvDuration("DROP_SCAN_INTERVAL", "5s"),
+		DropAPIKeyID:     getEnv("DROP_API_KEY_ID", ""),
+		DropStorageClass: getEnv("DROP_STORAGE_CLASS", ""),
+		DropRemove:       getEnvBool("DROP_REMOVE", false),
+
+		SMTPHost:                     getEnv("SMTP_HOST", ""),
+		SMTPPort:                     getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:                 getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                 getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:                     getEnv("SMTP_FROM", ""),
+		EmailLinkTemplate:            getEnv("EMAIL_LINK_TEMPLATE", ""),
+		EmailLinkSubject:             getEnv("EMAIL_LINK_SUBJECT", defaultEmailLinkSubject),
+		EmailLinkHourlyLimit:         getEnvInt("EMAIL_LINK_HOURLY_LIMIT", 10),
+		EmailLinkRecipientDailyLimit: getEnvInt("EMAIL_LINK_RECIPIENT_DAILY_LIMIT", 5),
+
+		PublicStatsEnabled: getEnvBool("PUBLIC_STATS_ENABLED", false),
+
+		CollectionNameConflict: getEnv("COLLECTION_NAME_CONFLICT", "rename"),
+
+		AbuseDetection:     getEnvBool("ABUSE_DETECTION", false),
+		AbuseThrottleScore: getEnvInt("ABUSE_THROTTLE_SCORE", 50),
+		AbuseBlockScore:    getEnvInt("ABUSE_BLOCK_SCORE", 100),
+		AbuseBlockDuration: getEnvDuration("ABUSE_BLOCK_DURATION", "1h"),
+		AbuseNotFoundLimit: getEnvInt("ABUSE_NOT_FOUND_LIMIT", 30),
+
+		FakeData: getEnvBool("FAKE_DATA", false),
 	}
 }
 
@@ -121,6 +526,15 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	return defaultValue
 }
 
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -138,3 +552,29 @@ func getEnvDuration(key string, defaultValue string) time.Duration {
 	duration, _ := time.ParseDuration(defaultValue)
 	return duration
 }
+
+// getEnvList parses a comma-separated list, e.g. "jpg, png,pdf"
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvSizeMap parses comma-separated name:bytes pairs, e.g. "mp4:2147483648,zip:524288000"
+func getEnvSizeMap(key string) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, item := range getEnvList(key) {
+		name, value, ok := strings.Cut(item, ":")
+		if !ok {
+			continue
+		}
+		if size, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && size > 0 {
+			sizes[strings.TrimSpace(name)] = size
+		}
+	}
+	return sizes
+}
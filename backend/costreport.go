@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+// storagePricePerGBMonth returns the configured storage price of a class. Files stored in
+// PostgreSQL belong to the standard class and are priced like it.
+func (c *Config) storagePricePerGBMonth(class StorageClass) float64 {
+	switch class {
+	case StorageClassFastSSD:
+		return c.CostFastSSDPerGBMonth
+	case StorageClassArchive:
+		return c.CostArchivePerGBMonth
+	default:
+		return c.CostStandardPerGBMonth
+	}
+}
+
+// ClassCost is the estimated monthly cost of one storage class
+type ClassCost struct {
+	StorageClass      string  `json:"storage_class"` // Empty for egress of files that no longer exist
+	StoredFiles       int     `json:"stored_files"`
+	StoredBytes       int64   `json:"stored_bytes"`
+	EgressBytes       int64   `json:"egress_bytes"`
+	StorageCost       float64 `json:"storage_cost"`
+	EgressCost        float64 `json:"egress_cost"`
+	TotalCost         float64 `json:"total_cost"`
+	StoragePricePerGB float64 `json:"storage_price_per_gb_month"`
+	ArchiveSavings    float64 `json:"archive_savings,omitempty"` // Storage cost saved by moving the class to archive
+}
+
+type CostReportRequest struct {
+	Period string `json:"period,omitempty"` // "YYYY-MM" of the egress data, defaults to the current month
+}
+
+// roundCents rounds a dollar amount to whole cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// getCostReport estimates the monthly cost per storage class from the bytes currently
+// stored and the egress accounted in the period, priced as if each class were kept on
+// object storage. It helps decide which content is worth moving to a cheaper class.
+//
+// @summary Estimate storage costs
+// @tags admin
+// @body json CostReportRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getCostReport(c *gin.Context) {
+	var req CostReportRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Period == "" {
+		req.Period = egressPeriod(time.Now())
+	}
+	period, err := time.Parse("2006-01", req.Period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must use YYYY-MM format"})
+		return
+	}
+
+	stored, err := s.db.GetStoredBytesByClass()
+	if err != nil {
+		log.Printf("Failed to get stored bytes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	egress, err := s.db.GetEgressByClass(period)
+	if err != nil {
+		log.Printf("Failed to get egress: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	costs := make(map[string]*ClassCost)
+	classCost := func(class string) *ClassCost {
+		if cost, ok := costs[class]; ok {
+			return cost
+		}
+		cost := &ClassCost{StorageClass: class}
+		costs[class] = cost
+		return cost
+	}
+	for _, usage := range stored {
+		cost := classCost(usage.StorageClass)
+		cost.StoredFiles = usage.Files
+		cost.StoredBytes = usage.Bytes
+	}
+	for _, usage := range egress {
+		classCost(usage.StorageClass).EgressBytes = usage.Bytes
+	}
+
+	report := make([]*ClassCost, 0, len(costs))
+	var totalCost, totalSavings float64
+	for _, cost := range costs {
+		class := StorageClass(cost.StorageClass)
+		storedGB := float64(cost.StoredBytes) / bytesPerGB
+		cost.StoragePricePerGB = s.config.storagePricePerGBMonth(class)
+		cost.StorageCost = roundCents(storedGB * cost.StoragePricePerGB)
+		cost.EgressCost = roundCents(float64(cost.EgressBytes) / bytesPerGB * s.config.CostEgressPerGB)
+		cost.TotalCost = roundCents(cost.StorageCost + cost.EgressCost)
+		if class != StorageClassArchive && cost.StoredBytes > 0 {
+			cost.ArchiveSavings = roundCents(storedGB * (cost.StoragePricePerGB - s.config.CostArchivePerGBMonth))
+			totalSavings += cost.ArchiveSavings
+		}
+		totalCost += cost.TotalCost
+		report = append(report, cost)
+	}
+
+	sort.Slice(report, func(i, j int) bool { return report[i].TotalCost > report[j].TotalCost })
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":                    req.Period,
+		"currency":                  "USD",
+		"classes":                   report,
+		"total":                     roundCents(totalCost),
+		"potential_archive_savings": roundCents(totalSavings),
+		"prices": gin.H{
+			"fast_ssd_per_gb_month": s.config.CostFastSSDPerGBMonth,
+			"standard_per_gb_month": s.config.CostStandardPerGBMonth,
+			"archive_per_gb_month":  s.config.CostArchivePerGBMonth,
+			"egress_per_gb":         s.config.CostEgressPerGB,
+		},
+		"note": "Storage is priced on the bytes stored now as if kept for the whole month; egress uses the bytes accounted in the period.",
+	})
+}
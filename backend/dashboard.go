@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dashboardDefaultLimit    = 20
+	dashboardMaxLimit        = 100
+	dashboardExpiringDefault = 24 * time.Hour
+)
+
+// DashboardFiles is a page of the caller's files and how many there are in total
+type DashboardFiles struct {
+	Total int            `json:"total"`
+	Files []FileMetadata `json:"files"`
+}
+
+// getDashboard summarizes the caller's account for the dashboard view: storage and
+// egress against their quotas, and, for API keys, the active files, those expiring
+// soon and the latest downloads of them. Anonymous callers only get their usage, since
+// files uploaded from one IP address may belong to several people.
+//
+// @summary Summarize the caller's account
+// @tags account
+// @query limit integer Most files and downloads to list
+// @query expiring_within integer Hours within which files count as expiring soon
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) getDashboard(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(dashboardDefaultLimit)))
+	if err != nil || limit <= 0 || limit > dashboardMaxLimit {
+		limit = dashboardDefaultLimit
+	}
+	expiringWithin := dashboardExpiringDefault
+	if value := c.Query("expiring_within"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiring_within must be a positive number of hours"})
+			return
+		}
+		expiringWithin = time.Duration(hours) * time.Hour
+	}
+
+	storage, err := s.quotaUsage(c)
+	if err != nil {
+		log.Printf("Failed to get storage usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+	egress, err := s.egressUsage(c)
+	if err != nil {
+		log.Printf("Failed to get egress usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+	response := gin.H{
+		"storage":         storage,
+		"remaining_files": storage.RemainingFiles(),
+		"remaining_bytes": storage.RemainingBytes(),
+		"egress":          egress,
+	}
+
+	apiKey := apiKeyFromContext(c)
+	if apiKey == nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if org, err := s.orgQuotaUsage(c); err != nil {
+		log.Printf("Failed to get org usage: %v", err)
+	} else if org != nil {
+		response["org_storage"] = org
+	}
+
+	active, err := s.dashboardFiles(FileListQuery{APIKeyID: apiKey.ID, Limit: limit})
+	if err != nil {
+		log.Printf("Failed to list dashboard files: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	expiresBefore := s.clock.Now().Add(expiringWithin)
+	expiring, err := s.dashboardFiles(FileListQuery{
+		APIKeyID:      apiKey.ID,
+		SortBy:        "expires_at",
+		Ascending:     true,
+		Limit:         limit,
+		ExpiresBefore: &expiresBefore,
+	})
+	if err != nil {
+		log.Printf("Failed to list expiring dashboard files: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	downloads, err := s.db.ListAPIKeyFileEvents(apiKey.ID, []string{FileEventDownloaded}, limit)
+	if err != nil {
+		log.Printf("Failed to list dashboard events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response["active_files"] = active
+	response["expiring_soon"] = expiring
+	response["expiring_within_hours"] = int(expiringWithin / time.Hour)
+	response["recent_downloads"] = downloads
+	c.JSON(http.StatusOK, response)
+}
+
+// dashboardFiles lists a page of files as their public metadata
+func (s *FileService) dashboardFiles(query FileListQuery) (*DashboardFiles, error) {
+	stored, total, err := s.db.ListActiveFiles(query)
+	if err != nil {
+		return nil, err
+	}
+	page := &DashboardFiles{Total: total, Files: make([]FileMetadata, 0, len(stored))}
+	for _, file := range stored {
+		page.Files = append(page.Files, publicMetadata(file))
+	}
+	return page, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	ts := newTestService(t)
+	key := &APIKeyStorage{ID: "key-1", QuotaFiles: 10}
+	ts.store.CreateAPIKey(key)
+
+	owned := map[string]time.Duration{"soon": 2 * time.Hour, "later": 72 * time.Hour, "mid": 12 * time.Hour}
+	for id, retention := range owned {
+		ts.saveTestFile(t, id, "content", retention)
+		file, _ := ts.store.GetFile(id)
+		file.APIKeyID = &key.ID
+		ts.store.SaveFile(file)
+	}
+	ts.saveTestFile(t, "someone-else", "content", time.Hour)
+	ts.store.AddFileEvent("soon", FileEventDownloaded, nil, "203.0.113.7")
+	ts.store.AddFileEvent("someone-else", FileEventDownloaded, nil, "203.0.113.7")
+
+	var dashboard struct {
+		RemainingFiles int            `json:"remaining_files"`
+		ActiveFiles    DashboardFiles `json:"active_files"`
+		ExpiringSoon   DashboardFiles `json:"expiring_soon"`
+		Downloads      []FileEvent    `json:"recent_downloads"`
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/dashboard?expiring_within=24", nil)
+	w := ts.serve(asKey(key, ts.getDashboard), req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &dashboard); err != nil {
+		t.Fatal(err)
+	}
+
+	if dashboard.RemainingFiles != 7 {
+		t.Errorf("remaining_files = %d, want 7", dashboard.RemainingFiles)
+	}
+	if dashboard.ActiveFiles.Total != 3 || len(dashboard.ActiveFiles.Files) != 3 {
+		t.Errorf("active files = %+v", dashboard.ActiveFiles)
+	}
+	if expiring := dashboard.ExpiringSoon; expiring.Total != 2 || expiring.Files[0].ID != "soon" || expiring.Files[1].ID != "mid" {
+		t.Errorf("expiring soon = %+v", expiring)
+	}
+	if len(dashboard.Downloads) != 1 || dashboard.Downloads[0].FileID != "soon" {
+		t.Errorf("recent downloads = %+v", dashboard.Downloads)
+	}
+	for _, file := range dashboard.ActiveFiles.Files {
+		if file.DeletePassword != "" {
+			t.Errorf("dashboard exposes the delete password of %s", file.ID)
+		}
+	}
+}
+
+func TestDashboardAnonymous(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "anonymous", "content", time.Hour)
+
+	w := ts.serve(ts.getDashboard, httptest.NewRequest(http.MethodGet, "/api/dashboard", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var dashboard map[string]json.RawMessage
+	json.Unmarshal(w.Body.Bytes(), &dashboard)
+	if _, ok := dashboard["storage"]; !ok {
+		t.Error("anonymous dashboard has no storage usage")
+	}
+	if _, ok := dashboard["active_files"]; ok {
+		t.Error("anonymous dashboard lists files")
+	}
+
+	w = ts.serve(ts.getDashboard, httptest.NewRequest(http.MethodGet, "/api/dashboard?expiring_within=soon", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid expiring_within: got %d, want 400", w.Code)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"log"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v4"
@@ -38,6 +39,15 @@ func NewDatabase(config *Config) (*Database, error) {
 		)
 	}
 
+	return connectDatabase(config, connStr, config.DatabaseMaxConns, config.DatabaseMinConns)
+}
+
+// NewReplicaDatabase connects to the secondary database that files are replicated to
+func NewReplicaDatabase(config *Config) (*Database, error) {
+	return connectDatabase(config, config.ReplicaDatabaseURL, 4, 1)
+}
+
+func connectDatabase(config *Config, connStr string, maxConns, minConns int) (*Database, error) {
 	// Configure connection pool
 	poolConfig, err := pgxpool.ParseConfig(connStr)
 	if err != nil {
@@ -45,11 +55,12 @@ func NewDatabase(config *Config) (*Database, error) {
 	}
 
 	// Set pool configuration
-	poolConfig.MaxConns = int32(config.DatabaseMaxConns)
-	poolConfig.MinConns = int32(config.DatabaseMinConns)
+	poolConfig.MaxConns = int32(maxConns)
+	poolConfig.MinConns = int32(minConns)
 	poolConfig.MaxConnLifetime = time.Hour
 	poolConfig.MaxConnIdleTime = 30 * time.Minute
 	poolConfig.HealthCheckPeriod = 1 * time.Minute
+	installDatabaseFaults(poolConfig)
 
 	// Create connection pool
 	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
@@ -127,6 +138,44 @@ func (db *Database) RunMigrations() error {
 	return nil
 }
 
+// UpgradeSchema brings an existing database up to date with the current schema. The
+// statements in schema_upgrade.sql are idempotent, so this runs on every startup.
+func (db *Database) UpgradeSchema() error {
+	upgradeSQL, err := ioutil.ReadFile(filepath.Join(".", "schema_upgrade.sql"))
+	if err != nil {
+		return fmt.Errorf("failed to read schema upgrade file: %v", err)
+	}
+
+	ctx := context.Background()
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, string(upgradeSQL)); err != nil {
+		return fmt.Errorf("failed to execute schema upgrade: %v", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit schema upgrade: %v", err)
+	}
+	return nil
+}
+
+// EnsureSchema creates the schema of a new database or upgrades an existing one
+func (db *Database) EnsureSchema() error {
+	schemaExists, err := db.CheckSchemaExists()
+	if err != nil {
+		return err
+	}
+	if !schemaExists {
+		log.Printf("Database schema not found, running migrations...")
+		return db.RunMigrations()
+	}
+	log.Printf("Database schema already exists")
+	return db.UpgradeSchema()
+}
+
 // CheckSchemaExists checks if the database schema is already initialized
 func (db *Database) CheckSchemaExists() (bool, error) {
 	ctx := context.Background()
@@ -166,6 +215,32 @@ func (db *Database) CleanupExpiredData() error {
 	return nil
 }
 
+// DeleteExpiredDiskFiles deletes the records of expired disk-stored files and returns their
+// storage paths, so the caller can remove the files from disk
+func (db *Database) DeleteExpiredDiskFiles() ([]string, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		DELETE FROM files
+		WHERE expires_at < NOW() AND storage_path IS NOT NULL
+		RETURNING storage_path
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired disk files: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan storage path: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
 // UpdateFileExpiration updates the expiration time for a file
 func (db *Database) UpdateFileExpiration(fileID string, expiresAt time.Time) error {
 	ctx := context.Background()
@@ -205,11 +280,24 @@ type FileStorage struct {
 	DeletePassword  string    `db:"delete_password"`
 	DownloadPassword *string  `db:"download_password"`
 	HasDownloadPassword bool  `db:"has_download_password"`
+	APIKeyID        *string   `db:"api_key_id"`
+	AppendState     *string   `db:"append_state"`
+	UploaderIP      *string   `db:"uploader_ip"`
+	ContentHash     *string   `db:"content_hash"`
+	ImageInfo       *ImageInfo `db:"image_info"`
+	StorageClass    string    `db:"storage_class"`
+	ScanResult      *ScanResult `db:"scan_result"`
+	OrgID           *string   `db:"org_id"`
+	Version         int       `db:"version"` // Content revision, incremented when the content is replaced
+	DeletedAt       *time.Time `db:"deleted_at"` // When the file was moved to the trash (nil otherwise)
+	Accessibility   *Accessibility `db:"accessibility"` // Alt text, caption and description given by the uploader
+	Tags            map[string]string `db:"tags"` // Tags of the upload policy the file was uploaded with
 	CreatedAt       time.Time `db:"created_at"`
 	UpdatedAt       time.Time `db:"updated_at"`
 }
 
-// SaveFile saves file metadata and content to the database
+// SaveFile saves file metadata and content to the database. A file uploaded with an API
+// key that belongs to an organization is owned by that organization.
 func (db *Database) SaveFile(file *FileStorage) error {
 	ctx := context.Background()
 	
@@ -217,17 +305,48 @@ func (db *Database) SaveFile(file *FileStorage) error {
 		INSERT INTO files (
 			id, filename, original_size, compressed_size, mime_type, compression_type,
 			storage_type, storage_path, file_content, upload_time, expires_at, delete_password,
-			download_password, has_download_password
+			download_password, has_download_password, api_key_id, append_state, uploader_ip,
+			content_hash, image_info, storage_class, scan_result, org_id, accessibility, tags
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21,
+			COALESCE($22, (SELECT org_id FROM api_keys WHERE id = $15)), $23, $24
 		)
 	`
+
+	// Store image info as JSONB, or NULL for non-images
+	var imageInfoJSON []byte
+	if file.ImageInfo != nil {
+		imageInfoJSON, _ = json.Marshal(file.ImageInfo)
+	}
+
+	// Likewise the scan verdict, or NULL when scanning is disabled
+	var scanResultJSON []byte
+	if file.ScanResult != nil {
+		scanResultJSON, _ = json.Marshal(file.ScanResult)
+	}
+
+	// And what the uploader wrote for people who can't see or hear the file
+	var accessibilityJSON []byte
+	if file.Accessibility != nil {
+		accessibilityJSON, _ = json.Marshal(file.Accessibility)
+	}
+	var tagsJSON []byte
+	if len(file.Tags) > 0 {
+		tagsJSON, _ = json.Marshal(file.Tags)
+	}
+
+	storageClass := file.StorageClass
+	if storageClass == "" {
+		storageClass = string(StorageClassStandard)
+	}
 	
 	_, err := db.Pool.Exec(ctx, query,
 		file.ID, file.Filename, file.OriginalSize, file.CompressedSize,
 		file.MimeType, file.CompressionType, file.StorageType, file.StoragePath,
 		file.FileContent, file.UploadTime, file.ExpiresAt, file.DeletePassword,
-		file.DownloadPassword, file.HasDownloadPassword,
+		file.DownloadPassword, file.HasDownloadPassword, file.APIKeyID, file.AppendState,
+		file.UploaderIP, file.ContentHash, imageInfoJSON, storageClass, scanResultJSON, file.OrgID,
+		accessibilityJSON, tagsJSON,
 	)
 	
 	if err != nil {
@@ -244,17 +363,20 @@ func (db *Database) GetFile(fileID string) (*FileStorage, error) {
 	query := `
 		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
 			   storage_type, storage_path, file_content, upload_time, expires_at, delete_password,
-			   download_password, has_download_password, created_at, updated_at
+			   download_password, has_download_password, api_key_id, append_state, uploader_ip,
+			   scan_result, org_id, version, accessibility, tags, created_at, updated_at
 		FROM files
-		WHERE id = $1 AND expires_at > NOW()
+		WHERE id = $1 AND expires_at > NOW() AND deleted_at IS NULL
 	`
 	
 	var file FileStorage
+	var scanResultJSON, accessibilityJSON, tagsJSON []byte
 	err := db.Pool.QueryRow(ctx, query, fileID).Scan(
 		&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
 		&file.MimeType, &file.CompressionType, &file.StorageType, &file.StoragePath,
 		&file.FileContent, &file.UploadTime, &file.ExpiresAt, &file.DeletePassword,
-		&file.DownloadPassword, &file.HasDownloadPassword,
+		&file.DownloadPassword, &file.HasDownloadPassword, &file.APIKeyID, &file.AppendState,
+		&file.UploaderIP, &scanResultJSON, &file.OrgID, &file.Version, &accessibilityJSON, &tagsJSON,
 		&file.CreatedAt, &file.UpdatedAt,
 	)
 	
@@ -264,29 +386,73 @@ func (db *Database) GetFile(fileID string) (*FileStorage, error) {
 		}
 		return nil, fmt.Errorf("failed to get file metadata and content: %v", err)
 	}
+
+	if len(scanResultJSON) > 0 {
+		var scanResult ScanResult
+		if err := json.Unmarshal(scanResultJSON, &scanResult); err == nil {
+			file.ScanResult = &scanResult
+		}
+	}
+
+	if len(accessibilityJSON) > 0 {
+		var accessibility Accessibility
+		if err := json.Unmarshal(accessibilityJSON, &accessibility); err == nil {
+			file.Accessibility = &accessibility
+		}
+	}
+	if len(tagsJSON) > 0 {
+		json.Unmarshal(tagsJSON, &file.Tags)
+	}
 	
 	return &file, nil
 }
 
 // GetFileMetadata retrieves only file metadata (without content) from the database
 func (db *Database) GetFileMetadata(fileID string) (*FileStorage, error) {
+	return db.getFileMetadataWhere("deleted_at IS NULL", fileID)
+}
+
+// GetTrashedFile retrieves the metadata of a file in the trash, or nil when the file
+// isn't in the trash or expired
+func (db *Database) GetTrashedFile(fileID string) (*FileStorage, error) {
+	return db.getFileMetadataWhere("deleted_at IS NOT NULL", fileID)
+}
+
+// FileIDExists reports whether any file has the ID, including expired files and files in
+// the trash
+func (db *Database) FileIDExists(fileID string) (bool, error) {
+	ctx := context.Background()
+
+	var exists bool
+	err := db.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM files WHERE id = $1)`, fileID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file ID: %v", err)
+	}
+	return exists, nil
+}
+
+// getFileMetadataWhere retrieves the metadata of an unexpired file matching the condition
+func (db *Database) getFileMetadataWhere(condition, fileID string) (*FileStorage, error) {
 	ctx := context.Background()
 	
 	query := `
 		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
 			   storage_type, storage_path, upload_time, expires_at, delete_password,
-			   download_password, has_download_password, created_at, updated_at
+			   download_password, has_download_password, api_key_id, append_state, uploader_ip,
+			   content_hash, image_info, storage_class, scan_result, org_id, version, deleted_at,
+			   accessibility, tags, created_at, updated_at
 		FROM files
-		WHERE id = $1 AND expires_at > NOW()
-	`
+		WHERE id = $1 AND expires_at > NOW() AND ` + condition
 	
 	var file FileStorage
+	var imageInfoJSON, scanResultJSON, accessibilityJSON, tagsJSON []byte
 	err := db.Pool.QueryRow(ctx, query, fileID).Scan(
 		&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
 		&file.MimeType, &file.CompressionType, &file.StorageType, &file.StoragePath,
 		&file.UploadTime, &file.ExpiresAt, &file.DeletePassword,
-		&file.DownloadPassword, &file.HasDownloadPassword,
-		&file.CreatedAt, &file.UpdatedAt,
+		&file.DownloadPassword, &file.HasDownloadPassword, &file.APIKeyID, &file.AppendState,
+		&file.UploaderIP, &file.ContentHash, &imageInfoJSON, &file.StorageClass, &scanResultJSON,
+		&file.OrgID, &file.Version, &file.DeletedAt, &accessibilityJSON, &tagsJSON, &file.CreatedAt, &file.UpdatedAt,
 	)
 	
 	if err != nil {
@@ -295,6 +461,30 @@ func (db *Database) GetFileMetadata(fileID string) (*FileStorage, error) {
 		}
 		return nil, fmt.Errorf("failed to get file metadata: %v", err)
 	}
+
+	if len(imageInfoJSON) > 0 {
+		var imageInfo ImageInfo
+		if err := json.Unmarshal(imageInfoJSON, &imageInfo); err == nil {
+			file.ImageInfo = &imageInfo
+		}
+	}
+
+	if len(scanResultJSON) > 0 {
+		var scanResult ScanResult
+		if err := json.Unmarshal(scanResultJSON, &scanResult); err == nil {
+			file.ScanResult = &scanResult
+		}
+	}
+
+	if len(accessibilityJSON) > 0 {
+		var accessibility Accessibility
+		if err := json.Unmarshal(accessibilityJSON, &accessibility); err == nil {
+			file.Accessibility = &accessibility
+		}
+	}
+	if len(tagsJSON) > 0 {
+		json.Unmarshal(tagsJSON, &file.Tags)
+	}
 	
 	return &file, nil
 }
@@ -306,7 +496,7 @@ func (db *Database) GetFileContent(fileID string) ([]byte, error) {
 	query := `
 		SELECT file_content
 		FROM files
-		WHERE id = $1 AND expires_at > NOW()
+		WHERE id = $1 AND expires_at > NOW() AND deleted_at IS NULL
 	`
 	
 	var content []byte
@@ -322,6 +512,21 @@ func (db *Database) GetFileContent(fileID string) ([]byte, error) {
 	return content, nil
 }
 
+// GetTrashedFileContent retrieves the content the database keeps for a file in the trash
+func (db *Database) GetTrashedFileContent(fileID string) ([]byte, error) {
+	ctx := context.Background()
+
+	var content []byte
+	err := db.Pool.QueryRow(ctx, `SELECT file_content FROM files WHERE id = $1 AND deleted_at IS NOT NULL`, fileID).Scan(&content)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("file not found in trash")
+		}
+		return nil, fmt.Errorf("failed to get file content: %v", err)
+	}
+	return content, nil
+}
+
 // DeleteFile removes file metadata from the database
 func (db *Database) DeleteFile(fileID string) error {
 	ctx := context.Background()
@@ -339,6 +544,115 @@ func (db *Database) DeleteFile(fileID string) error {
 	return nil
 }
 
+// TrashFile moves a file to the trash. Trashed files are hidden like deleted ones until
+// they are restored or purged.
+func (db *Database) TrashFile(fileID string, deletedAt time.Time) error {
+	ctx := context.Background()
+
+	result, err := db.Pool.Exec(ctx, `
+		UPDATE files SET deleted_at = $2
+		WHERE id = $1 AND expires_at > NOW() AND deleted_at IS NULL
+	`, fileID, deletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to move file to trash: %v", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("file not found")
+	}
+
+	return nil
+}
+
+// RestoreFile takes a file out of the trash
+func (db *Database) RestoreFile(fileID string) error {
+	ctx := context.Background()
+
+	result, err := db.Pool.Exec(ctx, `
+		UPDATE files SET deleted_at = NULL
+		WHERE id = $1 AND expires_at > NOW() AND deleted_at IS NOT NULL
+	`, fileID)
+	if err != nil {
+		return fmt.Errorf("failed to restore file: %v", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("file not found in trash")
+	}
+
+	return nil
+}
+
+// PurgeTrashedFiles deletes the files moved to the trash before the given time and
+// returns the storage paths of the disk-stored ones, so the caller can remove them
+func (db *Database) PurgeTrashedFiles(before time.Time) ([]string, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		DELETE FROM files
+		WHERE deleted_at < $1
+		RETURNING storage_path
+	`, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge trashed files: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path *string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan storage path: %v", err)
+		}
+		if path != nil {
+			paths = append(paths, *path)
+		}
+	}
+	return paths, rows.Err()
+}
+
+// ClaimSlug points a vanity slug at a file. It returns false when the slug belongs to
+// another file; slugs of expired files are taken over, while those of files in the trash
+// are kept for when they are restored.
+func (db *Database) ClaimSlug(slug, fileID string) (bool, error) {
+	ctx := context.Background()
+
+	result, err := db.Pool.Exec(ctx, `
+		INSERT INTO file_slugs (slug, file_id) VALUES ($1, $2)
+		ON CONFLICT (slug) DO UPDATE SET file_id = EXCLUDED.file_id, created_at = NOW()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM files f WHERE f.id = file_slugs.file_id AND f.expires_at > NOW()
+		)
+	`, slug, fileID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim slug: %v", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// GetFileIDBySlug returns the ID of the file a vanity slug points at, or "" when there is
+// no such slug or its file expired or is in the trash
+func (db *Database) GetFileIDBySlug(slug string) (string, error) {
+	ctx := context.Background()
+
+	var fileID string
+	err := db.Pool.QueryRow(ctx, `
+		SELECT f.id
+		FROM file_slugs s
+		JOIN files f ON f.id = s.file_id
+		WHERE s.slug = $1 AND f.expires_at > NOW() AND f.deleted_at IS NULL
+	`, slug).Scan(&fileID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to look up slug: %v", err)
+	}
+
+	return fileID, nil
+}
+
 // ChunkUploadStorage represents chunk upload session in the database
 type ChunkUploadStorage struct {
 	UploadID           string    `db:"upload_id"`
@@ -350,6 +664,9 @@ type ChunkUploadStorage struct {
 	FileHash           *string   `db:"file_hash"`
 	DownloadPassword   *string   `db:"download_password"`
 	HasDownloadPassword bool     `db:"has_download_password"`
+	APIKeyID           *string   `db:"api_key_id"`
+	ClientIP           *string   `db:"client_ip"`
+	StorageClass       string    `db:"storage_class"`
 	CreatedAt          time.Time `db:"created_at"`
 	LastActivity       time.Time `db:"last_activity"`
 	ExpiresAt          time.Time `db:"expires_at"`
@@ -370,13 +687,14 @@ func (db *Database) SaveChunkUpload(upload *ChunkUploadStorage) error {
 		INSERT INTO chunk_uploads (
 			upload_id, filename, total_size, total_chunks, chunk_size,
 			received_chunks, file_hash, download_password, has_download_password,
-			last_activity, expires_at, status
+			api_key_id, client_ip, storage_class, last_activity, expires_at, status
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15
 		)
 		ON CONFLICT (upload_id) DO UPDATE SET
 			received_chunks = EXCLUDED.received_chunks,
 			last_activity = EXCLUDED.last_activity,
+			expires_at = EXCLUDED.expires_at,
 			status = EXCLUDED.status
 	`
 	
@@ -384,6 +702,7 @@ func (db *Database) SaveChunkUpload(upload *ChunkUploadStorage) error {
 		upload.UploadID, upload.Filename, upload.TotalSize, upload.TotalChunks,
 		upload.ChunkSize, receivedChunksJSON, upload.FileHash,
 		upload.DownloadPassword, upload.HasDownloadPassword,
+		upload.APIKeyID, upload.ClientIP, upload.StorageClass,
 		upload.LastActivity, upload.ExpiresAt, upload.Status,
 	)
 	
@@ -399,35 +718,75 @@ func (db *Database) GetChunkUpload(uploadID string) (*ChunkUploadStorage, error)
 	ctx := context.Background()
 	
 	query := `
-		SELECT upload_id, filename, total_size, total_chunks, chunk_size,
-			   received_chunks, file_hash, download_password, has_download_password,
-			   created_at, last_activity, expires_at, status
+		SELECT ` + chunkUploadColumns + `
 		FROM chunk_uploads
 		WHERE upload_id = $1 AND expires_at > NOW()
 	`
 	
+	upload, err := scanChunkUpload(db.Pool.QueryRow(ctx, query, uploadID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Upload not found or expired
+		}
+		return nil, fmt.Errorf("failed to get chunk upload: %v", err)
+	}
+	
+	return upload, nil
+}
+
+// ListActiveChunkUploads returns all unexpired chunk upload sessions that are still accepting chunks
+func (db *Database) ListActiveChunkUploads() ([]*ChunkUploadStorage, error) {
+	ctx := context.Background()
+
+	query := `
+		SELECT ` + chunkUploadColumns + `
+		FROM chunk_uploads
+		WHERE status = 'active' AND expires_at > NOW()
+	`
+
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunk uploads: %v", err)
+	}
+	defer rows.Close()
+
+	var uploads []*ChunkUploadStorage
+	for rows.Next() {
+		upload, err := scanChunkUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chunk upload: %v", err)
+		}
+		uploads = append(uploads, upload)
+	}
+
+	return uploads, rows.Err()
+}
+
+const chunkUploadColumns = `upload_id, filename, total_size, total_chunks, chunk_size,
+			   received_chunks, file_hash, download_password, has_download_password,
+			   api_key_id, client_ip, storage_class, created_at, last_activity, expires_at, status`
+
+// scanChunkUpload scans a row selected with chunkUploadColumns
+func scanChunkUpload(row pgx.Row) (*ChunkUploadStorage, error) {
 	var upload ChunkUploadStorage
 	var receivedChunksJSON []byte
-	
-	err := db.Pool.QueryRow(ctx, query, uploadID).Scan(
+
+	err := row.Scan(
 		&upload.UploadID, &upload.Filename, &upload.TotalSize, &upload.TotalChunks,
 		&upload.ChunkSize, &receivedChunksJSON, &upload.FileHash,
 		&upload.DownloadPassword, &upload.HasDownloadPassword,
+		&upload.APIKeyID, &upload.ClientIP, &upload.StorageClass,
 		&upload.CreatedAt, &upload.LastActivity, &upload.ExpiresAt, &upload.Status,
 	)
-	
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, nil // Upload not found or expired
-		}
-		return nil, fmt.Errorf("failed to get chunk upload: %v", err)
+		return nil, err
 	}
-	
+
 	// Unmarshal received chunks
 	if err := json.Unmarshal(receivedChunksJSON, &upload.ReceivedChunks); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal received chunks: %v", err)
 	}
-	
+
 	return &upload, nil
 }
 
@@ -445,17 +804,21 @@ func (db *Database) DeleteChunkUpload(uploadID string) error {
 }
 
 // ProcessingJobStorage represents processing job in the database
+
 type ProcessingJobStorage struct {
-	JobID       string     `db:"job_id"`
-	UploadID    string     `db:"upload_id"`
-	FileID      *string    `db:"file_id"`
-	Status      string     `db:"status"`
-	Progress    int        `db:"progress"`
-	ErrorMessage *string   `db:"error_message"`
-	ResultData  []byte     `db:"result_data"`
-	CreatedAt   time.Time  `db:"created_at"`
-	UpdatedAt   time.Time  `db:"updated_at"`
-	CompletedAt *time.Time `db:"completed_at"`
+	JobID         string     `db:"job_id"`
+	UploadID      string     `db:"upload_id"`
+	FileID        *string    `db:"file_id"`
+	Status        string     `db:"status"`
+	Progress      int        `db:"progress"`
+	ErrorMessage  *string    `db:"error_message"`
+	ResultData    []byte     `db:"result_data"`
+	Attempts      int        `db:"attempts"`
+	NextAttemptAt *time.Time `db:"next_attempt_at"`
+	DeadLetter    bool       `db:"dead_letter"`
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+	CompletedAt   *time.Time `db:"completed_at"`
 }
 
 // SaveProcessingJob saves processing job to the database
@@ -465,9 +828,9 @@ func (db *Database) SaveProcessingJob(job *ProcessingJobStorage) error {
 	query := `
 		INSERT INTO processing_jobs (
 			job_id, upload_id, file_id, status, progress, error_message,
-			result_data, completed_at
+			result_data, attempts, next_attempt_at, dead_letter, completed_at
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
 		)
 		ON CONFLICT (job_id) DO UPDATE SET
 			file_id = EXCLUDED.file_id,
@@ -475,13 +838,17 @@ func (db *Database) SaveProcessingJob(job *ProcessingJobStorage) error {
 			progress = EXCLUDED.progress,
 			error_message = EXCLUDED.error_message,
 			result_data = EXCLUDED.result_data,
+			attempts = EXCLUDED.attempts,
+			next_attempt_at = EXCLUDED.next_attempt_at,
+			dead_letter = EXCLUDED.dead_letter,
 			completed_at = EXCLUDED.completed_at,
 			updated_at = NOW()
 	`
 	
 	_, err := db.Pool.Exec(ctx, query,
 		job.JobID, job.UploadID, job.FileID, job.Status, job.Progress,
-		job.ErrorMessage, job.ResultData, job.CompletedAt,
+		job.ErrorMessage, job.ResultData, job.Attempts, job.NextAttemptAt, job.DeadLetter,
+		job.CompletedAt,
 	)
 	
 	if err != nil {
@@ -496,19 +863,12 @@ func (db *Database) GetProcessingJob(jobID string) (*ProcessingJobStorage, error
 	ctx := context.Background()
 	
 	query := `
-		SELECT job_id, upload_id, file_id, status, progress, error_message,
-			   result_data, created_at, updated_at, completed_at
+		SELECT ` + processingJobColumns + `
 		FROM processing_jobs
 		WHERE job_id = $1
 	`
 	
-	var job ProcessingJobStorage
-	err := db.Pool.QueryRow(ctx, query, jobID).Scan(
-		&job.JobID, &job.UploadID, &job.FileID, &job.Status, &job.Progress,
-		&job.ErrorMessage, &job.ResultData, &job.CreatedAt, &job.UpdatedAt,
-		&job.CompletedAt,
-	)
-	
+	job, err := scanProcessingJob(db.Pool.QueryRow(ctx, query, jobID))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil // Job not found
@@ -516,9 +876,54 @@ func (db *Database) GetProcessingJob(jobID string) (*ProcessingJobStorage, error
 		return nil, fmt.Errorf("failed to get processing job: %v", err)
 	}
 	
+	return job, nil
+}
+
+const processingJobColumns = `job_id, upload_id, file_id, status, progress, error_message,
+			   result_data, attempts, next_attempt_at, dead_letter, created_at, updated_at,
+			   completed_at`
+
+func scanProcessingJob(row pgx.Row) (*ProcessingJobStorage, error) {
+	var job ProcessingJobStorage
+	err := row.Scan(
+		&job.JobID, &job.UploadID, &job.FileID, &job.Status, &job.Progress,
+		&job.ErrorMessage, &job.ResultData, &job.Attempts, &job.NextAttemptAt, &job.DeadLetter,
+		&job.CreatedAt, &job.UpdatedAt, &job.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
 	return &job, nil
 }
 
+// ListDeadLetterJobs returns the processing jobs that failed after exhausting their
+// retries, most recent first
+func (db *Database) ListDeadLetterJobs(limit int) ([]*ProcessingJobStorage, error) {
+	ctx := context.Background()
+
+	query := `SELECT ` + processingJobColumns + `
+		FROM processing_jobs
+		WHERE dead_letter
+		ORDER BY updated_at DESC
+		LIMIT $1`
+
+	rows, err := db.Pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead-letter jobs: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]*ProcessingJobStorage, 0)
+	for rows.Next() {
+		job, err := scanProcessingJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan processing job: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
 // LogFileAccess logs file access for analytics
 func (db *Database) LogFileAccess(fileID, accessType, ipAddress, userAgent string) error {
 	ctx := context.Background()
@@ -538,6 +943,108 @@ func (db *Database) LogFileAccess(fileID, accessType, ipAddress, userAgent strin
 	return nil
 }
 
+// FileAccess is one entry of the file access log
+type FileAccess struct {
+	AccessType string    `json:"access_type"`
+	IPAddress  *string   `json:"ip_address,omitempty"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	AccessTime time.Time `json:"access_time"`
+}
+
+// FileAccessCounts totals the logged accesses of a file by type
+type FileAccessCounts struct {
+	Downloads    int64      `json:"downloads"`
+	Previews     int64      `json:"previews"`
+	Streams      int64      `json:"streams"`
+	UniqueIPs    int64      `json:"unique_ips"`
+	LastAccessAt *time.Time `json:"last_access_at,omitempty"`
+}
+
+// DailyFileAccesses counts the accesses of a file on one day (UTC)
+type DailyFileAccesses struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	Downloads int64  `json:"downloads"`
+	Previews  int64  `json:"previews"`
+	Streams   int64  `json:"streams"`
+}
+
+// GetFileAccessCounts totals the logged accesses of a file
+func (db *Database) GetFileAccessCounts(fileID string) (*FileAccessCounts, error) {
+	ctx := context.Background()
+
+	var counts FileAccessCounts
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE access_type = 'download'),
+		       COUNT(*) FILTER (WHERE access_type = 'preview'),
+		       COUNT(*) FILTER (WHERE access_type = 'stream'),
+		       COUNT(DISTINCT ip_address),
+		       MAX(access_time)
+		FROM file_access_logs
+		WHERE file_id = $1
+	`, fileID).Scan(&counts.Downloads, &counts.Previews, &counts.Streams, &counts.UniqueIPs, &counts.LastAccessAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count file accesses: %v", err)
+	}
+	return &counts, nil
+}
+
+// GetFileAccessDaily counts the logged accesses of a file per day, oldest first
+func (db *Database) GetFileAccessDaily(fileID string) ([]DailyFileAccesses, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT to_char(access_time AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+		       COUNT(*) FILTER (WHERE access_type = 'download'),
+		       COUNT(*) FILTER (WHERE access_type = 'preview'),
+		       COUNT(*) FILTER (WHERE access_type = 'stream')
+		FROM file_access_logs
+		WHERE file_id = $1
+		GROUP BY day
+		ORDER BY day
+	`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count daily file accesses: %v", err)
+	}
+	defer rows.Close()
+
+	days := make([]DailyFileAccesses, 0)
+	for rows.Next() {
+		var day DailyFileAccesses
+		if err := rows.Scan(&day.Date, &day.Downloads, &day.Previews, &day.Streams); err != nil {
+			return nil, fmt.Errorf("failed to scan daily file accesses: %v", err)
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// ListFileAccesses returns the most recent logged accesses of a file, newest first
+func (db *Database) ListFileAccesses(fileID string, limit int) ([]FileAccess, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT access_type, host(ip_address), user_agent, access_time
+		FROM file_access_logs
+		WHERE file_id = $1
+		ORDER BY access_time DESC, id DESC
+		LIMIT $2
+	`, fileID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file accesses: %v", err)
+	}
+	defer rows.Close()
+
+	accesses := make([]FileAccess, 0)
+	for rows.Next() {
+		var access FileAccess
+		if err := rows.Scan(&access.AccessType, &access.IPAddress, &access.UserAgent, &access.AccessTime); err != nil {
+			return nil, fmt.Errorf("failed to scan file access: %v", err)
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, rows.Err()
+}
+
 // UpdateFileDownloadPassword updates the download password for a file
 func (db *Database) UpdateFileDownloadPassword(fileID string, newPassword string) error {
 	ctx := context.Background()
@@ -576,25 +1083,1766 @@ func (db *Database) UpdateFileDownloadPassword(fileID string, newPassword string
 	return nil
 }
 
-// UpdateFileDeletePassword updates the delete password for a file
-func (db *Database) UpdateFileDeletePassword(fileID string, newPassword string) error {
+// UpdateFileScanResult replaces the virus scan verdict of a file
+func (db *Database) UpdateFileScanResult(fileID string, result *ScanResult) error {
 	ctx := context.Background()
-	
-	query := `
-		UPDATE files 
-		SET delete_password = $2, updated_at = NOW()
-		WHERE id = $1
-	`
-	
-	result, err := db.Pool.Exec(ctx, query, fileID, newPassword)
+
+	resultJSON, err := json.Marshal(result)
 	if err != nil {
-		return fmt.Errorf("failed to update delete password: %v", err)
+		return fmt.Errorf("failed to marshal scan result: %v", err)
 	}
-	
-	rowsAffected := result.RowsAffected()
-	if rowsAffected == 0 {
+
+	query := `UPDATE files SET scan_result = $2, updated_at = NOW() WHERE id = $1`
+	tag, err := db.Pool.Exec(ctx, query, fileID, resultJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update scan result: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("file not found")
+	}
+	return nil
+}
+
+// UpdateFileName changes the name a file is served under
+func (db *Database) UpdateFileName(fileID, filename string) error {
+	ctx := context.Background()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE files SET filename = $2, updated_at = NOW() WHERE id = $1`, fileID, filename)
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
 		return fmt.Errorf("file not found")
 	}
-	
 	return nil
-}
\ No newline at end of file
+}
+
+// UpdateFileAccessibility replaces the alt text, caption and description of a file, or
+// clears them when accessibility is nil
+func (db *Database) UpdateFileAccessibility(fileID string, accessibility *Accessibility) error {
+	ctx := context.Background()
+
+	var accessibilityJSON []byte
+	if accessibility != nil {
+		accessibilityJSON, _ = json.Marshal(accessibility)
+	}
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE files SET accessibility = $2, updated_at = NOW() WHERE id = $1`, fileID, accessibilityJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update accessibility: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("file not found")
+	}
+	return nil
+}
+
+// ReplaceFileContent swaps the stored content of a file, and what describes it, for new
+// content
+func (db *Database) ReplaceFileContent(file *FileStorage) error {
+	ctx := context.Background()
+
+	var imageInfoJSON []byte
+	if file.ImageInfo != nil {
+		imageInfoJSON, _ = json.Marshal(file.ImageInfo)
+	}
+	var scanResultJSON []byte
+	if file.ScanResult != nil {
+		scanResultJSON, _ = json.Marshal(file.ScanResult)
+	}
+
+	query := `
+		UPDATE files SET
+			original_size = $2, compressed_size = $3, compression_type = $4, storage_type = $5,
+			storage_path = $6, file_content = $7, content_hash = $8, image_info = $9,
+			scan_result = $10, version = $11, updated_at = NOW()
+		WHERE id = $1
+	`
+	tag, err := db.Pool.Exec(ctx, query,
+		file.ID, file.OriginalSize, file.CompressedSize, file.CompressionType, file.StorageType,
+		file.StoragePath, file.FileContent, file.ContentHash, imageInfoJSON, scanResultJSON,
+		file.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to replace file content: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("file not found")
+	}
+	return nil
+}
+
+// FileVersion is the content of a file before it was replaced, kept for VERSION_RETENTION
+type FileVersion struct {
+	FileID          string    `db:"file_id"`
+	Version         int       `db:"version"`
+	OriginalSize    int64     `db:"original_size"`
+	CompressedSize  *int64    `db:"compressed_size"`
+	CompressionType string    `db:"compression_type"`
+	StorageType     string    `db:"storage_type"`
+	StoragePath     *string   `db:"storage_path"`
+	FileContent     []byte    `db:"file_content"`
+	ContentHash     *string   `db:"content_hash"`
+	ReplacedAt      time.Time `db:"replaced_at"`
+	ExpiresAt       time.Time `db:"expires_at"`
+}
+
+// SaveFileVersion keeps the previous content of a file
+func (db *Database) SaveFileVersion(version *FileVersion) error {
+	ctx := context.Background()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO file_versions (
+			file_id, version, original_size, compressed_size, compression_type, storage_type,
+			storage_path, file_content, content_hash, replaced_at, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`,
+		version.FileID, version.Version, version.OriginalSize, version.CompressedSize,
+		version.CompressionType, version.StorageType, version.StoragePath, version.FileContent,
+		version.ContentHash, version.ReplacedAt, version.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save file version: %v", err)
+	}
+	return nil
+}
+
+// ListFileVersions retrieves the kept previous versions of a file without content,
+// newest first
+func (db *Database) ListFileVersions(fileID string) ([]*FileVersion, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT file_id, version, original_size, compressed_size, compression_type, storage_type,
+			   storage_path, content_hash, replaced_at, expires_at
+		FROM file_versions
+		WHERE file_id = $1 AND expires_at > NOW()
+		ORDER BY version DESC
+	`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file versions: %v", err)
+	}
+	defer rows.Close()
+
+	versions := make([]*FileVersion, 0)
+	for rows.Next() {
+		var v FileVersion
+		if err := rows.Scan(&v.FileID, &v.Version, &v.OriginalSize, &v.CompressedSize, &v.CompressionType,
+			&v.StorageType, &v.StoragePath, &v.ContentHash, &v.ReplacedAt, &v.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file version: %v", err)
+		}
+		versions = append(versions, &v)
+	}
+	return versions, rows.Err()
+}
+
+// GetFileVersion retrieves a previous version of a file with its content, or nil when it
+// isn't kept
+func (db *Database) GetFileVersion(fileID string, version int) (*FileVersion, error) {
+	ctx := context.Background()
+
+	var v FileVersion
+	err := db.Pool.QueryRow(ctx, `
+		SELECT file_id, version, original_size, compressed_size, compression_type, storage_type,
+			   storage_path, file_content, content_hash, replaced_at, expires_at
+		FROM file_versions
+		WHERE file_id = $1 AND version = $2 AND expires_at > NOW()
+	`, fileID, version).Scan(&v.FileID, &v.Version, &v.OriginalSize, &v.CompressedSize, &v.CompressionType,
+		&v.StorageType, &v.StoragePath, &v.FileContent, &v.ContentHash, &v.ReplacedAt, &v.ExpiresAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file version: %v", err)
+	}
+	return &v, nil
+}
+
+// DeleteExpiredFileVersions deletes the versions past their retention and those of files
+// that expired or no longer exist, and returns the storage paths of the disk-stored ones, so the
+// caller can remove them from disk
+func (db *Database) DeleteExpiredFileVersions() ([]string, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		DELETE FROM file_versions v
+		WHERE v.expires_at < NOW()
+		   OR NOT EXISTS (SELECT 1 FROM files f WHERE f.id = v.file_id AND f.expires_at > NOW())
+		RETURNING v.storage_path
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired file versions: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path *string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan storage path: %v", err)
+		}
+		if path != nil {
+			paths = append(paths, *path)
+		}
+	}
+	return paths, rows.Err()
+}
+
+// UpdateFileMimeType corrects the MIME type of a file
+func (db *Database) UpdateFileMimeType(fileID, mimeType string) error {
+	ctx := context.Background()
+
+	tag, err := db.Pool.Exec(ctx, `UPDATE files SET mime_type = $2, updated_at = NOW() WHERE id = $1`, fileID, mimeType)
+	if err != nil {
+		return fmt.Errorf("failed to update MIME type: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("file not found")
+	}
+	return nil
+}
+
+// MimeTypeStats counts the active files of one MIME type and their original size
+type MimeTypeStats struct {
+	MimeType string `json:"mime_type"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// GetMimeTypeStats counts the active files per MIME type, most common first
+func (db *Database) GetMimeTypeStats() ([]MimeTypeStats, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT mime_type, COUNT(*), COALESCE(SUM(original_size), 0)::BIGINT
+		FROM files
+		WHERE expires_at > NOW() AND deleted_at IS NULL
+		GROUP BY mime_type
+		ORDER BY COUNT(*) DESC, mime_type
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count MIME types: %v", err)
+	}
+	defer rows.Close()
+
+	stats := make([]MimeTypeStats, 0)
+	for rows.Next() {
+		var entry MimeTypeStats
+		if err := rows.Scan(&entry.MimeType, &entry.Files, &entry.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan MIME type stats: %v", err)
+		}
+		stats = append(stats, entry)
+	}
+	return stats, rows.Err()
+}
+
+// UpdateFileDeletePassword updates the delete password for a file
+func (db *Database) UpdateFileDeletePassword(fileID string, newPassword string) error {
+	ctx := context.Background()
+	
+	query := `
+		UPDATE files 
+		SET delete_password = $2, updated_at = NOW()
+		WHERE id = $1
+	`
+	
+	result, err := db.Pool.Exec(ctx, query, fileID, newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to update delete password: %v", err)
+	}
+	
+	rowsAffected := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("file not found")
+	}
+	
+	return nil
+}
+// APIKeyStorage represents an API key in the database
+
+type APIKeyStorage struct {
+	ID               string     `db:"id" json:"id"`
+	Name             string     `db:"name" json:"name"`
+	KeyPrefix        string     `db:"key_prefix" json:"key_prefix"`
+	KeyHash          string     `db:"key_hash" json:"-"`
+	RateLimit        int        `db:"rate_limit" json:"rate_limit"`
+	QuotaBytes       int64      `db:"quota_bytes" json:"quota_bytes"`
+	QuotaFiles       int        `db:"quota_files" json:"quota_files"`
+	StorageClasses   string     `db:"storage_classes" json:"storage_classes"`       // Comma-separated; empty allows all classes
+	EgressQuotaBytes int64      `db:"egress_quota_bytes" json:"egress_quota_bytes"` // Bytes served per month (0 = unlimited)
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`
+	LastUsedAt       *time.Time `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt        *time.Time `db:"expires_at" json:"expires_at"`
+	RevokedAt        *time.Time `db:"revoked_at" json:"revoked_at"`
+
+	// Identity of the client certificate that authenticates as this key, if any
+	ClientCertIdentity *string `db:"client_cert_identity" json:"client_cert_identity"`
+
+	// Organization the key belongs to, if any, and its role there
+	OrgID   *string `db:"org_id" json:"org_id"`
+	OrgRole string  `db:"org_role" json:"org_role"`
+}
+
+// IsActive reports whether the key can currently be used for authentication
+func (k *APIKeyStorage) IsActive() bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	if k.ExpiresAt != nil && k.ExpiresAt.Before(time.Now()) {
+		return false
+	}
+	return true
+}
+
+const apiKeyColumns = `id, name, key_prefix, key_hash, rate_limit, quota_bytes, quota_files,
+			   storage_classes, egress_quota_bytes, client_cert_identity, org_id, org_role,
+			   created_at, updated_at, last_used_at, expires_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*APIKeyStorage, error) {
+	var key APIKeyStorage
+	err := row.Scan(
+		&key.ID, &key.Name, &key.KeyPrefix, &key.KeyHash, &key.RateLimit,
+		&key.QuotaBytes, &key.QuotaFiles, &key.StorageClasses, &key.EgressQuotaBytes,
+		&key.ClientCertIdentity, &key.OrgID, &key.OrgRole, &key.CreatedAt, &key.UpdatedAt,
+		&key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// CreateAPIKey saves a new API key to the database
+func (db *Database) CreateAPIKey(key *APIKeyStorage) error {
+	ctx := context.Background()
+
+	query := `
+		INSERT INTO api_keys (
+			id, name, key_prefix, key_hash, rate_limit, quota_bytes, quota_files, storage_classes,
+			egress_quota_bytes, expires_at, client_cert_identity, org_id, org_role
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+		)
+	`
+
+	_, err := db.Pool.Exec(ctx, query,
+		key.ID, key.Name, key.KeyPrefix, key.KeyHash, key.RateLimit,
+		key.QuotaBytes, key.QuotaFiles, key.StorageClasses, key.EgressQuotaBytes, key.ExpiresAt,
+		key.ClientCertIdentity, key.OrgID, key.OrgRole,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %v", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the SHA-256 hash of its secret
+func (db *Database) GetAPIKeyByHash(keyHash string) (*APIKeyStorage, error) {
+	ctx := context.Background()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(db.Pool.QueryRow(ctx, query, keyHash))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Key not found
+		}
+		return nil, fmt.Errorf("failed to get API key: %v", err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByCertIdentity retrieves the API key mapped to any of a client certificate's
+// identities
+func (db *Database) GetAPIKeyByCertIdentity(identities []string) (*APIKeyStorage, error) {
+	ctx := context.Background()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE client_cert_identity = ANY($1)
+			  ORDER BY created_at LIMIT 1`
+
+	key, err := scanAPIKey(db.Pool.QueryRow(ctx, query, identities))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // No key for this certificate
+		}
+		return nil, fmt.Errorf("failed to get API key for client certificate: %v", err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (db *Database) GetAPIKey(keyID string) (*APIKeyStorage, error) {
+	ctx := context.Background()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1`
+
+	key, err := scanAPIKey(db.Pool.QueryRow(ctx, query, keyID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Key not found
+		}
+		return nil, fmt.Errorf("failed to get API key: %v", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys retrieves all API keys, newest first
+func (db *Database) ListAPIKeys() ([]*APIKeyStorage, error) {
+	ctx := context.Background()
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`
+
+	rows, err := db.Pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := make([]*APIKeyStorage, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// UpdateAPIKey updates the mutable settings of an API key
+func (db *Database) UpdateAPIKey(key *APIKeyStorage) error {
+	ctx := context.Background()
+
+	query := `
+		UPDATE api_keys
+		SET name = $2, rate_limit = $3, quota_bytes = $4, quota_files = $5, storage_classes = $6,
+			egress_quota_bytes = $7, expires_at = $8, client_cert_identity = $9, org_id = $10,
+			org_role = $11
+		WHERE id = $1
+	`
+
+	result, err := db.Pool.Exec(ctx, query,
+		key.ID, key.Name, key.RateLimit, key.QuotaBytes, key.QuotaFiles, key.StorageClasses,
+		key.EgressQuotaBytes, key.ExpiresAt, key.ClientCertIdentity, key.OrgID, key.OrgRole,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %v", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+// RevokeAPIKey marks an API key as revoked
+func (db *Database) RevokeAPIKey(keyID string) error {
+	ctx := context.Background()
+
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	result, err := db.Pool.Exec(ctx, query, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+// TouchAPIKey records the last time an API key was used
+func (db *Database) TouchAPIKey(keyID string) error {
+	ctx := context.Background()
+
+	_, err := db.Pool.Exec(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to update API key usage: %v", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyUsage returns the number of active files and stored bytes for an API key
+func (db *Database) GetAPIKeyUsage(keyID string) (int, int64, error) {
+	ctx := context.Background()
+
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(original_size), 0)
+		FROM files
+		WHERE api_key_id = $1 AND expires_at > NOW()
+	`
+
+	var fileCount int
+	var totalBytes int64
+	if err := db.Pool.QueryRow(ctx, query, keyID).Scan(&fileCount, &totalBytes); err != nil {
+		return 0, 0, fmt.Errorf("failed to get API key usage: %v", err)
+	}
+
+	return fileCount, totalBytes, nil
+}
+
+// UpdateAppendedFile records the new size of an append-mode file and extends its expiration
+func (db *Database) UpdateAppendedFile(fileID string, newSize int64, expiresAt time.Time) error {
+	ctx := context.Background()
+
+	query := `
+		UPDATE files
+		SET original_size = $2, compressed_size = $2, expires_at = $3
+		WHERE id = $1 AND append_state = 'open'
+	`
+
+	result, err := db.Pool.Exec(ctx, query, fileID, newSize, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to update appended file: %v", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("file not found or not open for appending")
+	}
+
+	return nil
+}
+
+// FinalizeAppendedFile closes an append-mode file so normal expiry applies
+func (db *Database) FinalizeAppendedFile(fileID string, expiresAt time.Time) error {
+	ctx := context.Background()
+
+	query := `
+		UPDATE files
+		SET append_state = 'finalized', expires_at = $2
+		WHERE id = $1 AND append_state = 'open'
+	`
+
+	result, err := db.Pool.Exec(ctx, query, fileID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to finalize appended file: %v", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("file not found or not open for appending")
+	}
+
+	return nil
+}
+
+// GetUploaderIPUsage returns the number of active files and stored bytes uploaded anonymously from an IP
+func (db *Database) GetUploaderIPUsage(ipAddress string) (int, int64, error) {
+	ctx := context.Background()
+
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(original_size), 0)
+		FROM files
+		WHERE uploader_ip = $1 AND api_key_id IS NULL AND expires_at > NOW()
+	`
+
+	var fileCount int
+	var totalBytes int64
+	if err := db.Pool.QueryRow(ctx, query, ipAddress).Scan(&fileCount, &totalBytes); err != nil {
+		return 0, 0, fmt.Errorf("failed to get uploader usage: %v", err)
+	}
+
+	return fileCount, totalBytes, nil
+}
+
+// FindFileByContentHash returns metadata of an active, database-stored file with the given
+// content hash and size uploaded by the same uploader: the given API key, or for anonymous
+// uploads (apiKeyID nil) the same client IP. Password-protected and append-mode files are
+// never matched.
+func (db *Database) FindFileByContentHash(contentHash string, size int64, apiKeyID *string, uploaderIP string) (*FileStorage, error) {
+	ctx := context.Background()
+
+	query := `
+		SELECT id, filename, original_size, compressed_size, mime_type, compression_type
+		FROM files
+		WHERE content_hash = $1 AND original_size = $2 AND expires_at > NOW() AND deleted_at IS NULL
+		  AND storage_type = 'postgresql' AND has_download_password = FALSE
+		  AND append_state IS NULL
+		  AND (api_key_id = $3 OR ($3::VARCHAR IS NULL AND api_key_id IS NULL AND uploader_ip = $4))
+		ORDER BY expires_at DESC
+		LIMIT 1
+	`
+
+	var file FileStorage
+	err := db.Pool.QueryRow(ctx, query, contentHash, size, apiKeyID, uploaderIP).Scan(
+		&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+		&file.MimeType, &file.CompressionType,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find file by content hash: %v", err)
+	}
+
+	return &file, nil
+}
+
+// CloneFile saves a new file record whose content is copied from an existing file inside
+// PostgreSQL, so the bytes never pass through the application
+func (db *Database) CloneFile(sourceID string, file *FileStorage) error {
+	ctx := context.Background()
+
+	query := `
+		INSERT INTO files (
+			id, filename, original_size, compressed_size, mime_type, compression_type,
+			storage_type, file_content, upload_time, expires_at, delete_password,
+			download_password, has_download_password, api_key_id, uploader_ip, content_hash,
+			image_info, storage_class, scan_result, org_id, accessibility
+		)
+		SELECT $2, $3, original_size, compressed_size, $4, compression_type,
+			   storage_type, file_content, $5, $6, $7,
+			   $8, $9, $10, $11, content_hash,
+			   image_info, storage_class, scan_result,
+			   COALESCE($12, (SELECT org_id FROM api_keys WHERE id = $10)), $13
+		FROM files
+		WHERE id = $1 AND expires_at > NOW() AND deleted_at IS NULL
+	`
+
+	// The accessibility text belongs to the upload, not the content
+	var accessibilityJSON []byte
+	if file.Accessibility != nil {
+		accessibilityJSON, _ = json.Marshal(file.Accessibility)
+	}
+
+	result, err := db.Pool.Exec(ctx, query, sourceID,
+		file.ID, file.Filename, file.MimeType, file.UploadTime, file.ExpiresAt,
+		file.DeletePassword, file.DownloadPassword, file.HasDownloadPassword,
+		file.APIKeyID, file.UploaderIP, file.OrgID, accessibilityJSON,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clone file: %v", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("source file not found")
+	}
+
+	return nil
+}
+
+// BandwidthUsage is the number of bytes served to a file, API key or IP in a month
+type BandwidthUsage struct {
+	Period      time.Time `json:"-"`            // First day of the month
+	SubjectType string    `json:"subject_type"` // "file", "key" or "ip"
+	SubjectID   string    `json:"subject_id"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// AddBandwidthUsage adds served bytes to the monthly bandwidth counters
+func (db *Database) AddBandwidthUsage(usage []BandwidthUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+
+	query := `
+		INSERT INTO bandwidth_usage (period, subject_type, subject_id, bytes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (period, subject_type, subject_id)
+		DO UPDATE SET bytes = bandwidth_usage.bytes + EXCLUDED.bytes, updated_at = NOW()
+	`
+
+	batch := &pgx.Batch{}
+	for _, u := range usage {
+		batch.Queue(query, u.Period, u.SubjectType, u.SubjectID, u.Bytes)
+	}
+
+	results := db.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+	for range usage {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to add bandwidth usage: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteUsageBefore removes the usage records and file bandwidth from before cutoff. The
+// bandwidth of API keys last counted before cutoff and of client IPs last counted before
+// ipCutoff is folded into an anonymous subject of each month, so the bytes served stay
+// counted without whom they were served to.
+func (db *Database) DeleteUsageBefore(cutoff, ipCutoff time.Time) error {
+	ctx := context.Background()
+
+	for subjectType, before := range map[string]time.Time{"key": cutoff, "ip": ipCutoff} {
+		_, err := db.Pool.Exec(ctx, `
+			WITH folded AS (
+				DELETE FROM bandwidth_usage
+				WHERE subject_type = $1 AND subject_id <> '' AND updated_at < $2
+				RETURNING period, bytes
+			)
+			INSERT INTO bandwidth_usage (period, subject_type, subject_id, bytes)
+			SELECT period, $1, '', SUM(bytes)::BIGINT FROM folded GROUP BY period
+			ON CONFLICT (period, subject_type, subject_id)
+			DO UPDATE SET bytes = bandwidth_usage.bytes + EXCLUDED.bytes, updated_at = NOW()
+		`, subjectType, before)
+		if err != nil {
+			return fmt.Errorf("failed to fold %s bandwidth: %v", subjectType, err)
+		}
+	}
+	if _, err := db.Pool.Exec(ctx, `
+		DELETE FROM bandwidth_usage WHERE subject_type = 'file' AND updated_at < $1
+	`, cutoff); err != nil {
+		return fmt.Errorf("failed to delete old file bandwidth: %v", err)
+	}
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM usage_records WHERE hour < $1`, cutoff); err != nil {
+		return fmt.Errorf("failed to delete old usage records: %v", err)
+	}
+	return nil
+}
+
+// GetBandwidthUsage returns the total bytes served to one subject type in a month and
+// the subjects that used the most, leaving out the anonymous subject
+func (db *Database) GetBandwidthUsage(period time.Time, subjectType string, limit int) (int64, []BandwidthUsage, error) {
+	ctx := context.Background()
+
+	var total int64
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(bytes), 0)::BIGINT FROM bandwidth_usage
+		WHERE period = $1 AND subject_type = $2
+	`, period, subjectType).Scan(&total)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get bandwidth total: %v", err)
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT subject_id, bytes FROM bandwidth_usage
+		WHERE period = $1 AND subject_type = $2 AND subject_id <> ''
+		ORDER BY bytes DESC
+		LIMIT $3
+	`, period, subjectType, limit)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get bandwidth usage: %v", err)
+	}
+	defer rows.Close()
+
+	top := make([]BandwidthUsage, 0)
+	for rows.Next() {
+		u := BandwidthUsage{Period: period, SubjectType: subjectType}
+		if err := rows.Scan(&u.SubjectID, &u.Bytes); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan bandwidth usage: %v", err)
+		}
+		top = append(top, u)
+	}
+
+	return total, top, rows.Err()
+}
+
+// MonthlyBandwidth is the number of bytes served in a month
+type MonthlyBandwidth struct {
+	Period string `json:"period"` // YYYY-MM
+	Bytes  int64  `json:"bytes"`
+}
+
+// GetFileBandwidth returns the bytes served of a file per month, newest first
+func (db *Database) GetFileBandwidth(fileID string) ([]MonthlyBandwidth, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT to_char(period, 'YYYY-MM'), bytes FROM bandwidth_usage
+		WHERE subject_type = 'file' AND subject_id = $1
+		ORDER BY period DESC
+	`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file bandwidth: %v", err)
+	}
+	defer rows.Close()
+
+	months := make([]MonthlyBandwidth, 0)
+	for rows.Next() {
+		var month MonthlyBandwidth
+		if err := rows.Scan(&month.Period, &month.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan file bandwidth: %v", err)
+		}
+		months = append(months, month)
+	}
+	return months, rows.Err()
+}
+
+// ServiceStats are service-wide totals for the public statistics
+type ServiceStats struct {
+	ActiveFiles int64
+	BytesServed int64
+}
+
+// GetServiceStats counts the active files and the bytes served since metering began.
+// Every response is counted once per API key or client IP, so summing those two subject
+// types counts each byte once.
+func (db *Database) GetServiceStats() (*ServiceStats, error) {
+	ctx := context.Background()
+
+	stats := &ServiceStats{}
+	if err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM files WHERE expires_at > NOW() AND deleted_at IS NULL
+	`).Scan(&stats.ActiveFiles); err != nil {
+		return nil, fmt.Errorf("failed to count active files: %v", err)
+	}
+	if err := db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(bytes), 0)::BIGINT FROM bandwidth_usage
+		WHERE subject_type IN ('key', 'ip')
+	`).Scan(&stats.BytesServed); err != nil {
+		return nil, fmt.Errorf("failed to sum bytes served: %v", err)
+	}
+	return stats, nil
+}
+
+// ClassUsage is the number of files and bytes attributed to a storage class
+type ClassUsage struct {
+	StorageClass string `json:"storage_class"`
+	Files        int    `json:"files"`
+	Bytes        int64  `json:"bytes"`
+}
+
+// GetStoredBytesByClass returns the active files and their stored (compressed) bytes per
+// storage class
+func (db *Database) GetStoredBytesByClass() ([]ClassUsage, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT storage_class, COUNT(*), COALESCE(SUM(COALESCE(compressed_size, original_size)), 0)::BIGINT
+		FROM files
+		WHERE expires_at > NOW()
+		GROUP BY storage_class
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored bytes by class: %v", err)
+	}
+	defer rows.Close()
+
+	usage := make([]ClassUsage, 0)
+	for rows.Next() {
+		var u ClassUsage
+		if err := rows.Scan(&u.StorageClass, &u.Files, &u.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan class usage: %v", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// UsageRecord is metered usage of an API key during one hour
+type UsageRecord struct {
+	Hour     time.Time `json:"hour"`
+	APIKeyID string    `json:"api_key_id"`
+	OrgID    *string   `json:"org_id,omitempty"`
+	Metric   string    `json:"metric"`
+	Quantity int64     `json:"quantity"`
+}
+
+// UsageRollup is the metered usage of an API key or an org over a month
+type UsageRollup struct {
+	AccountType      string `json:"account_type"` // "key" or "org"
+	AccountID        string `json:"account_id"`
+	StorageByteHours int64  `json:"storage_byte_hours"`
+	EgressBytes      int64  `json:"egress_bytes"`
+	APICalls         int64  `json:"api_calls"`
+}
+
+// AddUsageRecords adds metered usage to the hourly records, stamping each with the
+// current org of its key. The org is filled in on the records passed in.
+func (db *Database) AddUsageRecords(records []UsageRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+
+	query := `
+		INSERT INTO usage_records (hour, api_key_id, org_id, metric, quantity)
+		VALUES ($1, $2, (SELECT org_id FROM api_keys WHERE id = $2), $3, $4)
+		ON CONFLICT (hour, api_key_id, metric)
+		DO UPDATE SET quantity = usage_records.quantity + EXCLUDED.quantity, updated_at = NOW()
+		RETURNING org_id
+	`
+
+	batch := &pgx.Batch{}
+	for _, r := range records {
+		batch.Queue(query, r.Hour, r.APIKeyID, r.Metric, r.Quantity)
+	}
+
+	results := db.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+	for i := range records {
+		if err := results.QueryRow().Scan(&records[i].OrgID); err != nil {
+			return fmt.Errorf("failed to add usage record: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetStoredBytesByAPIKey returns the bytes currently stored by each API key
+func (db *Database) GetStoredBytesByAPIKey() (map[string]int64, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT api_key_id, COALESCE(SUM(COALESCE(compressed_size, original_size)), 0)::BIGINT
+		FROM files
+		WHERE expires_at > NOW() AND api_key_id IS NOT NULL
+		GROUP BY api_key_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored bytes by API key: %v", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]int64)
+	for rows.Next() {
+		var keyID string
+		var bytes int64
+		if err := rows.Scan(&keyID, &bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan stored bytes: %v", err)
+		}
+		stored[keyID] = bytes
+	}
+	return stored, rows.Err()
+}
+
+// GetUsageRollup sums the usage records of a month per API key, or per org when
+// groupBy is "org"
+func (db *Database) GetUsageRollup(period time.Time, groupBy string) ([]UsageRollup, error) {
+	ctx := context.Background()
+
+	account := "api_key_id"
+	if groupBy == "org" {
+		account = "org_id"
+	}
+	rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+		SELECT %[1]s,
+			   COALESCE(SUM(quantity) FILTER (WHERE metric = 'storage_byte_hours'), 0)::BIGINT,
+			   COALESCE(SUM(quantity) FILTER (WHERE metric = 'egress_bytes'), 0)::BIGINT,
+			   COALESCE(SUM(quantity) FILTER (WHERE metric = 'api_calls'), 0)::BIGINT
+		FROM usage_records
+		WHERE hour >= $1 AND hour < $1::timestamptz + INTERVAL '1 month' AND %[1]s IS NOT NULL
+		GROUP BY %[1]s
+		ORDER BY %[1]s
+	`, account), period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage rollup: %v", err)
+	}
+	defer rows.Close()
+
+	rollups := make([]UsageRollup, 0)
+	for rows.Next() {
+		rollup := UsageRollup{AccountType: "key"}
+		if groupBy == "org" {
+			rollup.AccountType = "org"
+		}
+		if err := rows.Scan(&rollup.AccountID, &rollup.StorageByteHours, &rollup.EgressBytes, &rollup.APICalls); err != nil {
+			return nil, fmt.Errorf("failed to scan usage rollup: %v", err)
+		}
+		rollups = append(rollups, rollup)
+	}
+	return rollups, rows.Err()
+}
+
+// GetEgressByClass returns the bytes served in a month per storage class of the file.
+// Files that no longer exist are reported with an empty storage class.
+func (db *Database) GetEgressByClass(period time.Time) ([]ClassUsage, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT COALESCE(f.storage_class, ''), COUNT(*), COALESCE(SUM(b.bytes), 0)::BIGINT
+		FROM bandwidth_usage b
+		LEFT JOIN files f ON f.id = b.subject_id
+		WHERE b.period = $1 AND b.subject_type = 'file'
+		GROUP BY 1
+	`, period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get egress by class: %v", err)
+	}
+	defer rows.Close()
+
+	usage := make([]ClassUsage, 0)
+	for rows.Next() {
+		var u ClassUsage
+		if err := rows.Scan(&u.StorageClass, &u.Files, &u.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan class usage: %v", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// ReplicationChange is a file change recorded for replication
+type ReplicationChange struct {
+	ID        int64
+	FileID    string
+	Operation string // "upsert" or "delete"
+	CreatedAt time.Time
+}
+
+// ReplicationState is the progress of replication, kept on the secondary database
+type ReplicationState struct {
+	SeededAt      *time.Time `json:"seeded_at"`
+	LastAppliedAt *time.Time `json:"last_applied_at"`
+	PromotedAt    *time.Time `json:"promoted_at"`
+}
+
+// GetReplicationChanges returns the oldest pending file changes
+func (db *Database) GetReplicationChanges(limit int) ([]ReplicationChange, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, file_id, operation, created_at
+		FROM replication_log
+		ORDER BY id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replication changes: %v", err)
+	}
+	defer rows.Close()
+
+	var changes []ReplicationChange
+	for rows.Next() {
+		var change ReplicationChange
+		if err := rows.Scan(&change.ID, &change.FileID, &change.Operation, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan replication change: %v", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// AckReplicationChanges removes the changes up to and including lastID once replicated
+func (db *Database) AckReplicationChanges(lastID int64) error {
+	ctx := context.Background()
+
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM replication_log WHERE id <= $1`, lastID); err != nil {
+		return fmt.Errorf("failed to acknowledge replication changes: %v", err)
+	}
+	return nil
+}
+
+// GetReplicationBacklog returns the number of pending changes and when the oldest was made
+func (db *Database) GetReplicationBacklog() (int64, *time.Time, error) {
+	ctx := context.Background()
+
+	var pending int64
+	var oldest *time.Time
+	err := db.Pool.QueryRow(ctx, `SELECT COUNT(*), MIN(created_at) FROM replication_log`).Scan(&pending, &oldest)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get replication backlog: %v", err)
+	}
+	return pending, oldest, nil
+}
+
+// SeedReplicationLog queues every active file for replication, for the first copy to a
+// new secondary
+func (db *Database) SeedReplicationLog() (int64, error) {
+	ctx := context.Background()
+
+	result, err := db.Pool.Exec(ctx, `
+		INSERT INTO replication_log (file_id, operation)
+		SELECT id, 'upsert' FROM files WHERE expires_at > NOW()
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to seed replication log: %v", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// ClearReplicationLog drops all pending changes, used when replication is disabled so the
+// log doesn't grow without a consumer
+func (db *Database) ClearReplicationLog() error {
+	ctx := context.Background()
+
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM replication_log`); err != nil {
+		return fmt.Errorf("failed to clear replication log: %v", err)
+	}
+	return nil
+}
+
+// GetFileForReplication retrieves every column of a file, including content, whether or
+// not it has expired. It returns nil if the file no longer exists.
+func (db *Database) GetFileForReplication(fileID string) (*FileStorage, error) {
+	ctx := context.Background()
+
+	query := `
+		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
+			   storage_type, storage_path, file_content, upload_time, expires_at, delete_password,
+			   download_password, has_download_password, api_key_id, append_state, uploader_ip,
+			   content_hash, image_info, storage_class, scan_result, org_id, deleted_at, accessibility,
+			   tags, created_at, updated_at
+		FROM files
+		WHERE id = $1
+	`
+
+	var file FileStorage
+	var imageInfoJSON, scanResultJSON, accessibilityJSON, tagsJSON []byte
+	err := db.Pool.QueryRow(ctx, query, fileID).Scan(
+		&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+		&file.MimeType, &file.CompressionType, &file.StorageType, &file.StoragePath,
+		&file.FileContent, &file.UploadTime, &file.ExpiresAt, &file.DeletePassword,
+		&file.DownloadPassword, &file.HasDownloadPassword, &file.APIKeyID, &file.AppendState,
+		&file.UploaderIP, &file.ContentHash, &imageInfoJSON, &file.StorageClass, &scanResultJSON,
+		&file.OrgID, &file.DeletedAt, &accessibilityJSON, &tagsJSON, &file.CreatedAt, &file.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file for replication: %v", err)
+	}
+
+	if len(imageInfoJSON) > 0 {
+		var imageInfo ImageInfo
+		if err := json.Unmarshal(imageInfoJSON, &imageInfo); err == nil {
+			file.ImageInfo = &imageInfo
+		}
+	}
+	if len(scanResultJSON) > 0 {
+		var scanResult ScanResult
+		if err := json.Unmarshal(scanResultJSON, &scanResult); err == nil {
+			file.ScanResult = &scanResult
+		}
+	}
+	if len(accessibilityJSON) > 0 {
+		var accessibility Accessibility
+		if err := json.Unmarshal(accessibilityJSON, &accessibility); err == nil {
+			file.Accessibility = &accessibility
+		}
+	}
+	if len(tagsJSON) > 0 {
+		json.Unmarshal(tagsJSON, &file.Tags)
+	}
+
+	return &file, nil
+}
+
+// UpsertReplicatedFile writes a file copied from the primary to the secondary database.
+// one.replicating keeps the write out of the secondary's own replication log.
+func (db *Database) UpsertReplicatedFile(file *FileStorage) error {
+	ctx := context.Background()
+
+	var imageInfoJSON, scanResultJSON, accessibilityJSON, tagsJSON []byte
+	if file.ImageInfo != nil {
+		imageInfoJSON, _ = json.Marshal(file.ImageInfo)
+	}
+	if file.ScanResult != nil {
+		scanResultJSON, _ = json.Marshal(file.ScanResult)
+	}
+	if file.Accessibility != nil {
+		accessibilityJSON, _ = json.Marshal(file.Accessibility)
+	}
+	if len(file.Tags) > 0 {
+		tagsJSON, _ = json.Marshal(file.Tags)
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SET LOCAL one.replicating = 'on'`); err != nil {
+		return fmt.Errorf("failed to mark replication transaction: %v", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO files (
+			id, filename, original_size, compressed_size, mime_type, compression_type,
+			storage_type, storage_path, file_content, upload_time, expires_at, delete_password,
+			download_password, has_download_password, api_key_id, append_state, uploader_ip,
+			content_hash, image_info, storage_class, scan_result, created_at, org_id, deleted_at,
+			accessibility, tags
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24,
+			$25, $26
+		)
+		ON CONFLICT (id) DO UPDATE SET
+			filename = EXCLUDED.filename,
+			original_size = EXCLUDED.original_size,
+			compressed_size = EXCLUDED.compressed_size,
+			mime_type = EXCLUDED.mime_type,
+			compression_type = EXCLUDED.compression_type,
+			storage_type = EXCLUDED.storage_type,
+			storage_path = EXCLUDED.storage_path,
+			file_content = EXCLUDED.file_content,
+			upload_time = EXCLUDED.upload_time,
+			expires_at = EXCLUDED.expires_at,
+			delete_password = EXCLUDED.delete_password,
+			download_password = EXCLUDED.download_password,
+			has_download_password = EXCLUDED.has_download_password,
+			api_key_id = EXCLUDED.api_key_id,
+			append_state = EXCLUDED.append_state,
+			uploader_ip = EXCLUDED.uploader_ip,
+			content_hash = EXCLUDED.content_hash,
+			image_info = EXCLUDED.image_info,
+			storage_class = EXCLUDED.storage_class,
+			scan_result = EXCLUDED.scan_result,
+			org_id = EXCLUDED.org_id,
+			deleted_at = EXCLUDED.deleted_at,
+			accessibility = EXCLUDED.accessibility,
+			tags = EXCLUDED.tags
+	`,
+		file.ID, file.Filename, file.OriginalSize, file.CompressedSize,
+		file.MimeType, file.CompressionType, file.StorageType, file.StoragePath,
+		file.FileContent, file.UploadTime, file.ExpiresAt, file.DeletePassword,
+		file.DownloadPassword, file.HasDownloadPassword, file.APIKeyID, file.AppendState,
+		file.UploaderIP, file.ContentHash, imageInfoJSON, file.StorageClass, scanResultJSON,
+		file.CreatedAt, file.OrgID, file.DeletedAt, accessibilityJSON, tagsJSON,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert replicated file: %v", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteReplicatedFile removes a file deleted on the primary from the secondary database
+func (db *Database) DeleteReplicatedFile(fileID string) error {
+	ctx := context.Background()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SET LOCAL one.replicating = 'on'`); err != nil {
+		return fmt.Errorf("failed to mark replication transaction: %v", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM files WHERE id = $1`, fileID); err != nil {
+		return fmt.Errorf("failed to delete replicated file: %v", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetReplicationState returns the replication progress recorded on the secondary
+func (db *Database) GetReplicationState() (*ReplicationState, error) {
+	ctx := context.Background()
+
+	var state ReplicationState
+	err := db.Pool.QueryRow(ctx, `
+		SELECT seeded_at, last_applied_at, promoted_at FROM replication_state WHERE id = 1
+	`).Scan(&state.SeededAt, &state.LastAppliedAt, &state.PromotedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return &ReplicationState{}, nil
+		}
+		return nil, fmt.Errorf("failed to get replication state: %v", err)
+	}
+	return &state, nil
+}
+
+// MarkReplicationSeeded records that the existing files were queued for the first copy
+func (db *Database) MarkReplicationSeeded() error {
+	ctx := context.Background()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO replication_state (id, seeded_at) VALUES (1, NOW())
+		ON CONFLICT (id) DO UPDATE SET seeded_at = NOW()
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to mark replication seeded: %v", err)
+	}
+	return nil
+}
+
+// MarkReplicationApplied records when the last change was copied to the secondary
+func (db *Database) MarkReplicationApplied() error {
+	ctx := context.Background()
+
+	_, err := db.Pool.Exec(ctx, `UPDATE replication_state SET last_applied_at = NOW() WHERE id = 1`)
+	if err != nil {
+		return fmt.Errorf("failed to mark replication applied: %v", err)
+	}
+	return nil
+}
+
+// MarkReplicaPromoted records that the secondary now serves as the primary, after which
+// replication into it stops
+func (db *Database) MarkReplicaPromoted() error {
+	ctx := context.Background()
+
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO replication_state (id, promoted_at) VALUES (1, NOW())
+		ON CONFLICT (id) DO UPDATE SET promoted_at = NOW()
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to mark replica promoted: %v", err)
+	}
+	return nil
+}
+
+// ListDiskFilePaths returns the ID, storage class and storage path of every disk-stored file
+func (db *Database) ListDiskFilePaths() ([]*FileStorage, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, storage_class, storage_path FROM files WHERE storage_path IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list disk files: %v", err)
+	}
+	defer rows.Close()
+
+	var files []*FileStorage
+	for rows.Next() {
+		var file FileStorage
+		if err := rows.Scan(&file.ID, &file.StorageClass, &file.StoragePath); err != nil {
+			return nil, fmt.Errorf("failed to scan disk file: %v", err)
+		}
+		files = append(files, &file)
+	}
+	return files, rows.Err()
+}
+
+// FileListQuery selects a page of the unexpired files for the admin file list
+type FileListQuery struct {
+	Search      string // Case-insensitive filename substring
+	MimeType    string // Exact MIME type, or a prefix such as "image/" ending in a slash
+	StorageType string // "postgresql" or "disk"
+	APIKeyID    string // Only files uploaded with this API key
+	SortBy      string // One of fileListSortColumns; upload time when empty
+	Ascending   bool
+	Limit       int
+	Offset      int
+
+	// Only files expiring before this time, when set
+	ExpiresBefore *time.Time
+}
+
+// fileListFilter is the WHERE clause of the file list queries, taking the search
+// pattern, MIME type, storage type, API key and expiry bound as $1 to $5
+const fileListFilter = `
+	WHERE expires_at > NOW() AND deleted_at IS NULL
+	  AND ($1 = '' OR filename ILIKE $1)
+	  AND ($2 = '' OR mime_type = $2 OR (right($2, 1) = '/' AND starts_with(mime_type, $2)))
+	  AND ($3 = '' OR storage_type = $3)
+	  AND ($4 = '' OR api_key_id = $4)
+	  AND ($5::timestamptz IS NULL OR expires_at < $5)
+`
+
+// fileListSortColumns maps the sort keys of the admin file list to their columns
+var fileListSortColumns = map[string]string{
+	"uploaded_at": "upload_time",
+	"expires_at":  "expires_at",
+	"filename":    "filename",
+	"size":        "original_size",
+}
+
+// likePattern escapes the LIKE wildcards in s and wraps it in %
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// ListActiveFiles returns a page of the metadata of unexpired files matching the query,
+// along with the number of files matching it in total
+func (db *Database) ListActiveFiles(query FileListQuery) ([]*FileStorage, int, error) {
+	ctx := context.Background()
+
+	column, ok := fileListSortColumns[query.SortBy]
+	if !ok {
+		column = "upload_time"
+	}
+	direction := "DESC"
+	if query.Ascending {
+		direction = "ASC"
+	}
+	var search string
+	if query.Search != "" {
+		search = likePattern(query.Search)
+	}
+
+	// The id breaks ties so pages don't overlap when sorting by a non-unique column
+	rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
+			   storage_type, storage_path, upload_time, expires_at, has_download_password,
+			   COUNT(*) OVER ()
+		FROM files
+		%s
+		ORDER BY %s %s, id %s
+		LIMIT $6 OFFSET $7
+	`, fileListFilter, column, direction, direction), search, query.MimeType, query.StorageType, query.APIKeyID,
+		query.ExpiresBefore, query.Limit, query.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list files: %v", err)
+	}
+	defer rows.Close()
+
+	var files []*FileStorage
+	var total int
+	for rows.Next() {
+		var file FileStorage
+		if err := rows.Scan(&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+			&file.MimeType, &file.CompressionType, &file.StorageType, &file.StoragePath,
+			&file.UploadTime, &file.ExpiresAt, &file.HasDownloadPassword, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan file: %v", err)
+		}
+		files = append(files, &file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end has no rows to carry the total
+	if len(files) == 0 && query.Offset > 0 {
+		err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM files`+fileListFilter,
+			search, query.MimeType, query.StorageType, query.APIKeyID, query.ExpiresBefore).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count files: %v", err)
+		}
+	}
+	return files, total, nil
+}
+
+// UpdateStoragePath points a disk-stored file at a new location
+func (db *Database) UpdateStoragePath(fileID, storagePath string) error {
+	ctx := context.Background()
+
+	if _, err := db.Pool.Exec(ctx, `UPDATE files SET storage_path = $2 WHERE id = $1`, fileID, storagePath); err != nil {
+		return fmt.Errorf("failed to update storage path: %v", err)
+	}
+	return nil
+}
+
+// FileEvent is an entry of the file event log
+type FileEvent struct {
+	ID        int64           `json:"id"`
+	FileID    string          `json:"file_id"`
+	Type      string          `json:"type"`
+	Details   json.RawMessage `json:"details"`
+	IPAddress *string         `json:"ip_address,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AddFileEvent appends an event recorded by the application to the file event log
+func (db *Database) AddFileEvent(fileID, eventType string, details interface{}, ipAddress string) error {
+	ctx := context.Background()
+
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	var ip *string
+	if ipAddress != "" {
+		ip = &ipAddress
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO file_events (file_id, event_type, details, ip_address, org_id)
+		VALUES ($1, $2, $3, $4, (SELECT org_id FROM files WHERE id = $1))
+	`, fileID, eventType, detailsJSON, ip)
+	if err != nil {
+		return fmt.Errorf("failed to add file event: %v", err)
+	}
+	return nil
+}
+
+// ListFileEvents returns events after the cursor in order, optionally only of the given
+// types. Events from the last few seconds are held back: IDs are assigned when a row is
+// inserted but become visible on commit, so a recent lower ID could still appear behind
+// the cursor.
+func (db *Database) ListFileEvents(after int64, eventTypes []string, limit int) ([]FileEvent, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, file_id, event_type, details, ip_address, created_at
+		FROM file_events
+		WHERE id > $1
+		  AND (COALESCE(cardinality($2::text[]), 0) = 0 OR event_type = ANY($2))
+		  AND created_at < NOW() - INTERVAL '2 seconds'
+		ORDER BY id
+		LIMIT $3
+	`, after, eventTypes, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file events: %v", err)
+	}
+	defer rows.Close()
+
+	events := make([]FileEvent, 0)
+	for rows.Next() {
+		var event FileEvent
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.FileID, &event.Type, &details, &event.IPAddress, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file event: %v", err)
+		}
+		event.Details = details
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ListAPIKeyFileEvents retrieves the newest events of the existing files uploaded with
+// an API key, optionally only those of the given types
+func (db *Database) ListAPIKeyFileEvents(keyID string, eventTypes []string, limit int) ([]FileEvent, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT e.id, e.file_id, e.event_type, e.details, e.ip_address, e.created_at
+		FROM file_events e
+		JOIN files f ON f.id = e.file_id
+		WHERE f.api_key_id = $1
+		  AND (COALESCE(cardinality($2::text[]), 0) = 0 OR e.event_type = ANY($2))
+		ORDER BY e.id DESC
+		LIMIT $3
+	`, keyID, eventTypes, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API key file events: %v", err)
+	}
+	defer rows.Close()
+
+	events := make([]FileEvent, 0)
+	for rows.Next() {
+		var event FileEvent
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.FileID, &event.Type, &details, &event.IPAddress, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file event: %v", err)
+		}
+		event.Details = details
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteFileEventsBefore removes events older than the retention period
+func (db *Database) DeleteFileEventsBefore(cutoff time.Time) error {
+	ctx := context.Background()
+
+	if _, err := db.Pool.Exec(ctx, `DELETE FROM file_events WHERE created_at < $1`, cutoff); err != nil {
+		return fmt.Errorf("failed to delete old file events: %v", err)
+	}
+	return nil
+}
+
+// Org is an organization whose member API keys share ownership of their files
+type Org struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	QuotaBytes int64       `json:"quota_bytes"`
+	QuotaFiles int         `json:"quota_files"`
+	Branding   OrgBranding `json:"branding"`
+	Policy     OrgPolicy   `json:"policy"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// OrgBranding is shown with an organization's files
+type OrgBranding struct {
+	DisplayName string `json:"display_name,omitempty"`
+	LogoURL     string `json:"logo_url,omitempty"`
+	AccentColor string `json:"accent_color,omitempty"`
+}
+
+// OrgPolicy holds the rules an organization sets for its members' uploads
+type OrgPolicy struct {
+	MaxRetentionHours       int      `json:"max_retention_hours,omitempty"` // 0 keeps the server's retention
+	RequireDownloadPassword bool     `json:"require_download_password,omitempty"`
+	BlockedExtensions       []string `json:"blocked_extensions,omitempty"`
+	NameConflict            string   `json:"name_conflict,omitempty"` // Default collision policy of members' collections
+}
+
+const orgColumns = `id, name, quota_bytes, quota_files, branding, policy, created_at, updated_at`
+
+func scanOrg(row pgx.Row) (*Org, error) {
+	var org Org
+	var branding, policy []byte
+	if err := row.Scan(&org.ID, &org.Name, &org.QuotaBytes, &org.QuotaFiles, &branding, &policy, &org.CreatedAt, &org.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(branding, &org.Branding); err != nil {
+		return nil, fmt.Errorf("invalid branding of org %s: %v", org.ID, err)
+	}
+	if err := json.Unmarshal(policy, &org.Policy); err != nil {
+		return nil, fmt.Errorf("invalid policy of org %s: %v", org.ID, err)
+	}
+	return &org, nil
+}
+
+// CreateOrg saves a new organization
+func (db *Database) CreateOrg(org *Org) error {
+	ctx := context.Background()
+
+	branding, err := json.Marshal(org.Branding)
+	if err != nil {
+		return err
+	}
+	policy, err := json.Marshal(org.Policy)
+	if err != nil {
+		return err
+	}
+	_, err = db.Pool.Exec(ctx, `
+		INSERT INTO orgs (id, name, quota_bytes, quota_files, branding, policy) VALUES ($1, $2, $3, $4, $5, $6)
+	`, org.ID, org.Name, org.QuotaBytes, org.QuotaFiles, branding, policy)
+	if err != nil {
+		return fmt.Errorf("failed to create org: %v", err)
+	}
+	return nil
+}
+
+// GetOrg retrieves an organization by ID, or nil when it doesn't exist
+func (db *Database) GetOrg(orgID string) (*Org, error) {
+	ctx := context.Background()
+
+	org, err := scanOrg(db.Pool.QueryRow(ctx, `SELECT `+orgColumns+` FROM orgs WHERE id = $1`, orgID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get org: %v", err)
+	}
+	return org, nil
+}
+
+// ListOrgs retrieves all organizations by name
+func (db *Database) ListOrgs() ([]*Org, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `SELECT `+orgColumns+` FROM orgs ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orgs: %v", err)
+	}
+	defer rows.Close()
+
+	orgs := make([]*Org, 0)
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan org: %v", err)
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// UpdateOrg updates the name, quotas, branding and policy of an organization
+func (db *Database) UpdateOrg(org *Org) error {
+	ctx := context.Background()
+
+	branding, err := json.Marshal(org.Branding)
+	if err != nil {
+		return err
+	}
+	policy, err := json.Marshal(org.Policy)
+	if err != nil {
+		return err
+	}
+	result, err := db.Pool.Exec(ctx, `
+		UPDATE orgs SET name = $2, quota_bytes = $3, quota_files = $4, branding = $5, policy = $6 WHERE id = $1
+	`, org.ID, org.Name, org.QuotaBytes, org.QuotaFiles, branding, policy)
+	if err != nil {
+		return fmt.Errorf("failed to update org: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("org not found")
+	}
+	return nil
+}
+
+// DeleteOrg removes an organization. Its keys leave it and its files go back to being
+// owned by the keys that uploaded them.
+func (db *Database) DeleteOrg(orgID string) error {
+	ctx := context.Background()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE files SET org_id = NULL WHERE org_id = $1`, orgID); err != nil {
+		return fmt.Errorf("failed to release org files: %v", err)
+	}
+	// api_keys.org_id is cleared by its foreign key
+	result, err := tx.Exec(ctx, `DELETE FROM orgs WHERE id = $1`, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete org: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("org not found")
+	}
+	return tx.Commit(ctx)
+}
+
+// GetOrgUsage returns the number of active files and stored bytes owned by an organization
+func (db *Database) GetOrgUsage(orgID string) (int, int64, error) {
+	ctx := context.Background()
+
+	var fileCount int
+	var totalBytes int64
+	err := db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(original_size), 0)
+		FROM files
+		WHERE org_id = $1 AND expires_at > NOW()
+	`, orgID).Scan(&fileCount, &totalBytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get org usage: %v", err)
+	}
+	return fileCount, totalBytes, nil
+}
+
+// ListOrgFiles retrieves the active files of an organization, newest first
+func (db *Database) ListOrgFiles(orgID string, limit int) ([]*FileStorage, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
+			   upload_time, expires_at, has_download_password, api_key_id, storage_class, org_id
+		FROM files
+		WHERE org_id = $1 AND expires_at > NOW() AND deleted_at IS NULL
+		ORDER BY upload_time DESC
+		LIMIT $2
+	`, orgID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list org files: %v", err)
+	}
+	defer rows.Close()
+
+	files := make([]*FileStorage, 0)
+	for rows.Next() {
+		var file FileStorage
+		if err := rows.Scan(&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+			&file.MimeType, &file.CompressionType, &file.UploadTime, &file.ExpiresAt,
+			&file.HasDownloadPassword, &file.APIKeyID, &file.StorageClass, &file.OrgID); err != nil {
+			return nil, fmt.Errorf("failed to scan org file: %v", err)
+		}
+		files = append(files, &file)
+	}
+	return files, rows.Err()
+}
+
+// ListOrgFileEvents is ListFileEvents restricted to the files of one organization
+func (db *Database) ListOrgFileEvents(orgID string, after int64, eventTypes []string, limit int) ([]FileEvent, error) {
+	ctx := context.Background()
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, file_id, event_type, details, ip_address, created_at
+		FROM file_events
+		WHERE org_id = $1 AND id > $2
+		  AND (COALESCE(cardinality($3::text[]), 0) = 0 OR event_type = ANY($3))
+		  AND created_at < NOW() - INTERVAL '2 seconds'
+		ORDER BY id
+		LIMIT $4
+	`, orgID, after, eventTypes, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list org file events: %v", err)
+	}
+	defer rows.Close()
+
+	events := make([]FileEvent, 0)
+	for rows.Next() {
+		var event FileEvent
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.FileID, &event.Type, &details, &event.IPAddress, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan file event: %v", err)
+		}
+		event.Details = details
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRenderSize limits how large a file the server-side renderers will load into memory
+const maxRenderSize = 50 * 1024 * 1024
+
+// loadRenderableContent loads and decompresses a file for server-side rendering, checking
+// its download password and size before any content is read. It writes an error response
+// and returns false on failure.
+func (s *FileService) loadRenderableContent(c *gin.Context, fileID string) (*FileStorage, []byte, bool) {
+	fileStorage, err := s.lookupFile(fileID, false)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, nil, false
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return nil, nil, false
+	}
+
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return nil, nil, false
+	}
+	if !requireScanCleared(c, fileStorage) {
+		return nil, nil, false
+	}
+
+	if fileStorage.OriginalSize > maxRenderSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large to render",
+			"max_size": maxRenderSize,
+		})
+		return nil, nil, false
+	}
+
+	// Database-backed content is only fetched once the file is known to be small enough
+	if fileStorage.StorageType != "disk" {
+		fileStorage, err = s.lookupFile(fileID, true)
+		if err != nil || fileStorage == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load file"})
+			return nil, nil, false
+		}
+	}
+
+	content, err := s.loadFileContent(fileStorage, FileMetadata{Compression: CompressionType(fileStorage.CompressionType)})
+	if err != nil {
+		log.Printf("Failed to load %s for rendering: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return nil, nil, false
+	}
+
+	return fileStorage, content, true
+}
+
+// notebookText holds Jupyter's multiline strings, which may be a string or a list of lines
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*t = notebookText(text)
+	return nil
+}
+
+type notebook struct {
+	Cells []struct {
+		CellType       string       `json:"cell_type"`
+		Source         notebookText `json:"source"`
+		ExecutionCount *int         `json:"execution_count"`
+		Outputs        []struct {
+			OutputType string                  `json:"output_type"`
+			Name       string                  `json:"name"`
+			Text       notebookText            `json:"text"`
+			Data       map[string]notebookText `json:"data"`
+			EName      string                  `json:"ename"`
+			EValue     string                  `json:"evalue"`
+			Traceback  []string                `json:"traceback"`
+		} `json:"outputs"`
+	} `json:"cells"`
+	Metadata struct {
+		KernelSpec struct {
+			DisplayName string `json:"display_name"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+	NBFormat int `json:"nbformat"`
+}
+
+type renderedOutput struct {
+	Kind     string // "text", "error", "image" or "html"
+	Text     string
+	ImageURI template.URL
+	HTML     string // Rendered in a sandboxed iframe, never inline
+}
+
+type renderedCell struct {
+	Type           string
+	Source         string
+	Markdown       template.HTML // Rendered source of markdown cells
+	ExecutionCount string
+	Outputs        []renderedOutput
+}
+
+var (
+	ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	base64Pattern     = regexp.MustCompile(`^[A-Za-z0-9+/=\s]*$`)
+)
+
+// renderNotebookOutput converts one cell output, preferring the richest safe representation
+func renderNotebookOutput(outputType, name string, text notebookText, data map[string]notebookText, ename, evalue string, traceback []string) (renderedOutput, bool) {
+	switch outputType {
+	case "stream":
+		kind := "text"
+		if name == "stderr" {
+			kind = "error"
+		}
+		return renderedOutput{Kind: kind, Text: string(text)}, true
+	case "error":
+		trace := ansiEscapePattern.ReplaceAllString(strings.Join(traceback, "\n"), "")
+		if trace == "" {
+			trace = ename + ": " + evalue
+		}
+		return renderedOutput{Kind: "error", Text: trace}, true
+	case "execute_result", "display_data":
+		for _, imageType := range []string{"image/png", "image/jpeg", "image/gif"} {
+			if encoded, ok := data[imageType]; ok && base64Pattern.MatchString(string(encoded)) {
+				cleaned := strings.Join(strings.Fields(string(encoded)), "")
+				return renderedOutput{Kind: "image", ImageURI: template.URL("data:" + imageType + ";base64," + cleaned)}, true
+			}
+		}
+		if svg, ok := data["image/svg+xml"]; ok {
+			// Loaded through <img>, SVG can't run scripts
+			encoded := base64.StdEncoding.EncodeToString([]byte(svg))
+			return renderedOutput{Kind: "image", ImageURI: template.URL("data:image/svg+xml;base64," + encoded)}, true
+		}
+		if html, ok := data["text/html"]; ok {
+			return renderedOutput{Kind: "html", HTML: string(html)}, true
+		}
+		if plain, ok := data["text/plain"]; ok {
+			return renderedOutput{Kind: "text", Text: string(plain)}, true
+		}
+	}
+	return renderedOutput{}, false
+}
+
+var notebookTemplate = template.Must(template.New("notebook").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Filename}}</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",sans-serif;max-width:980px;margin:0 auto;padding:24px;color:#1f2328;background:#fff}
+.cell{margin:0 0 16px;display:flex;gap:12px}
+.prompt{flex:0 0 64px;text-align:right;color:#6e7781;font:12px monospace;padding-top:8px}
+.body{flex:1;min-width:0}
+pre{margin:0;padding:8px 12px;overflow-x:auto;font:13px/1.45 ui-monospace,monospace;white-space:pre-wrap;word-break:break-word}
+.code pre.source{background:#f6f8fa;border:1px solid #d0d7de;border-radius:6px}
+.markdown .body{font-size:15px;line-height:1.5;padding:0 12px}
+.markdown code{background:#f6f8fa;border-radius:4px;padding:1px 4px;font:13px ui-monospace,monospace}
+.markdown pre code{padding:0;background:none}
+.markdown pre{background:#f6f8fa;border-radius:6px}
+.markdown blockquote{margin:0;padding:0 12px;color:#57606a;border-left:4px solid #d0d7de}
+.output pre.error{background:#fff0f0;color:#82071e}
+.output img{max-width:100%}
+.output iframe{width:100%;min-height:120px;border:1px solid #d0d7de;border-radius:6px}
+header{color:#6e7781;font-size:13px;margin-bottom:24px}
+</style>
+</head>
+<body>
+<header>{{.Filename}}{{if .Kernel}} · {{.Kernel}}{{end}} · {{len .Cells}} cells</header>
+{{range .Cells}}<div class="cell {{.Type}}">
+<div class="prompt">{{if eq .Type "code"}}[{{.ExecutionCount}}]:{{end}}</div>
+<div class="body">
+{{if eq .Type "code"}}<pre class="source">{{.Source}}</pre>{{else if eq .Type "markdown"}}{{.Markdown}}{{else}}<pre>{{.Source}}</pre>{{end}}
+{{range .Outputs}}<div class="output">
+{{if eq .Kind "image"}}<img src="{{.ImageURI}}" alt="output">{{else if eq .Kind "html"}}<iframe sandbox srcdoc="{{.HTML}}"></iframe>{{else if eq .Kind "error"}}<pre class="error">{{.Text}}</pre>{{else}}<pre>{{.Text}}</pre>{{end}}
+</div>{{end}}
+</div>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// renderNotebook renders a Jupyter notebook as a static HTML page. Nothing from the
+// notebook is executed: text is escaped, images are limited to data URIs and HTML outputs
+// are isolated in sandboxed iframes without scripts.
+//
+// @summary Render a Jupyter notebook
+// @tags render
+// @path id File ID
+// @success 200 text/html
+// @auth downloadPassword adminToken optional
+func (s *FileService) renderNotebook(c *gin.Context) {
+	fileID := c.Param("id")
+
+	fileStorage, content, ok := s.loadRenderableContent(c, fileID)
+	if !ok {
+		return
+	}
+
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil || nb.NBFormat < 4 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Invalid notebook",
+			"message": "Only Jupyter notebooks in nbformat 4 or later can be rendered",
+		})
+		return
+	}
+
+	cells := make([]renderedCell, 0, len(nb.Cells))
+	for _, cell := range nb.Cells {
+		rendered := renderedCell{Type: cell.CellType, Source: string(cell.Source), ExecutionCount: " "}
+		if cell.ExecutionCount != nil {
+			rendered.ExecutionCount = strconv.Itoa(*cell.ExecutionCount)
+		}
+		if cell.CellType == "markdown" {
+			rendered.Markdown = renderMarkdown(rendered.Source)
+		}
+		for _, output := range cell.Outputs {
+			if out, ok := renderNotebookOutput(output.OutputType, output.Name, output.Text, output.Data, output.EName, output.EValue, output.Traceback); ok {
+				rendered.Outputs = append(rendered.Outputs, out)
+			}
+		}
+		cells = append(cells, rendered)
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; img-src data:; style-src 'unsafe-inline'; frame-ancestors 'self'")
+	c.Header("X-Frame-Options", "SAMEORIGIN")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Status(http.StatusOK)
+
+	err := notebookTemplate.Execute(c.Writer, map[string]interface{}{
+		"Filename": fileStorage.Filename,
+		"Kernel":   nb.Metadata.KernelSpec.DisplayName,
+		"Cells":    cells,
+	})
+	if err != nil {
+		log.Printf("renderNotebook: failed to render %s: %v", fileID, err)
+	}
+}
+
+// GeoJSONInfo summarizes a GeoJSON document so map clients can fit bounds before loading it
+type GeoJSONInfo struct {
+	Type          string     `json:"type"`
+	FeatureCount  int        `json:"feature_count"`
+	GeometryTypes []string   `json:"geometry_types"`
+	Bounds        *[]float64 `json:"bounds"` // [min_lon, min_lat, max_lon, max_lat]
+}
+
+// analyzeGeoJSON validates a GeoJSON document and computes its bounds
+func analyzeGeoJSON(content []byte) (*GeoJSONInfo, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(content, &root); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	rootType, _ := root["type"].(string)
+	info := &GeoJSONInfo{Type: rootType, GeometryTypes: []string{}}
+	bounds := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	seenTypes := map[string]bool{}
+
+	var visitCoordinates func(value interface{})
+	visitCoordinates = func(value interface{}) {
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		if len(items) >= 2 {
+			lon, lonOK := items[0].(float64)
+			lat, latOK := items[1].(float64)
+			if lonOK && latOK {
+				bounds[0] = math.Min(bounds[0], lon)
+				bounds[1] = math.Min(bounds[1], lat)
+				bounds[2] = math.Max(bounds[2], lon)
+				bounds[3] = math.Max(bounds[3], lat)
+				return
+			}
+		}
+		for _, item := range items {
+			visitCoordinates(item)
+		}
+	}
+
+	var visitGeometry func(geometry map[string]interface{})
+	visitGeometry = func(geometry map[string]interface{}) {
+		geometryType, _ := geometry["type"].(string)
+		if geometryType != "" && !seenTypes[geometryType] {
+			seenTypes[geometryType] = true
+			info.GeometryTypes = append(info.GeometryTypes, geometryType)
+		}
+		if geometryType == "GeometryCollection" {
+			geometries, _ := geometry["geometries"].([]interface{})
+			for _, g := range geometries {
+				if child, ok := g.(map[string]interface{}); ok {
+					visitGeometry(child)
+				}
+			}
+			return
+		}
+		visitCoordinates(geometry["coordinates"])
+	}
+
+	visitFeature := func(feature map[string]interface{}) {
+		info.FeatureCount++
+		if geometry, ok := feature["geometry"].(map[string]interface{}); ok {
+			visitGeometry(geometry)
+		}
+	}
+
+	switch rootType {
+	case "FeatureCollection":
+		features, ok := root["features"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("FeatureCollection has no features array")
+		}
+		for _, f := range features {
+			if feature, ok := f.(map[string]interface{}); ok {
+				visitFeature(feature)
+			}
+		}
+	case "Feature":
+		visitFeature(root)
+	case "Point", "MultiPoint", "LineString", "MultiLineString", "Polygon", "MultiPolygon", "GeometryCollection":
+		visitGeometry(root)
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q", rootType)
+	}
+
+	if !math.IsInf(bounds[0], 1) {
+		info.Bounds = &bounds
+	}
+	return info, nil
+}
+
+// getGeoJSON serves a GeoJSON file as-is with its bounds in response headers, so map
+// libraries can consume it directly
+//
+// @summary Get a GeoJSON file with its bounds
+// @tags render
+// @path id File ID
+// @success 200 application/geo+json
+// @auth downloadPassword adminToken optional
+func (s *FileService) getGeoJSON(c *gin.Context) {
+	fileStorage, content, ok := s.loadRenderableContent(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	info, err := analyzeGeoJSON(content)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid GeoJSON", "message": err.Error()})
+		return
+	}
+
+	if info.Bounds != nil {
+		b := *info.Bounds
+		c.Header("X-GeoJSON-Bounds", fmt.Sprintf("%g,%g,%g,%g", b[0], b[1], b[2], b[3]))
+	}
+	c.Header("X-GeoJSON-Feature-Count", strconv.Itoa(info.FeatureCount))
+	c.Header("Access-Control-Expose-Headers", corsExposedHeaders+", X-GeoJSON-Bounds, X-GeoJSON-Feature-Count")
+	if fileStorage.HasDownloadPassword {
+		// The password is part of the URL, so shared caches must not keep the content
+		c.Header("Cache-Control", "private, no-store")
+	} else {
+		c.Header("Cache-Control", "public, max-age=3600")
+	}
+	c.Data(http.StatusOK, "application/geo+json", content)
+}
+
+// getGeoJSONInfo returns bounds and feature statistics for a GeoJSON file
+//
+// @summary Get the bounds and features of a GeoJSON file
+// @tags render
+// @path id File ID
+// @success 200 json
+// @auth downloadPassword adminToken optional
+func (s *FileService) getGeoJSONInfo(c *gin.Context) {
+	fileStorage, content, ok := s.loadRenderableContent(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	info, err := analyzeGeoJSON(content)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid GeoJSON", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":  fileStorage.ID,
+		"filename": fileStorage.Filename,
+		"size":     fileStorage.OriginalSize,
+		"geojson":  info,
+	})
+}
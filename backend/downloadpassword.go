@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadPasswordRequest sets the download password of a file. An empty password removes
+// it; the field must still be given, so an empty body can't unprotect a file by accident.
+type DownloadPasswordRequest struct {
+	DownloadPassword *string `json:"download_password"`
+}
+
+// updateOwnerDownloadPassword lets the uploader of a file, proven by the delete password
+// or an API key that may manage it, set, change or remove its download password
+//
+// @summary Set or remove the download password of a file
+// @tags file
+// @path id File ID
+// @body json DownloadPasswordRequest
+// @success 200 json
+// @auth deletePassword apiKey
+func (s *FileService) updateOwnerDownloadPassword(c *gin.Context) {
+	fileID := c.Param("id")
+
+	var req DownloadPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.DownloadPassword == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"message": `Give the new download_password, or "" to remove it.`,
+		})
+		return
+	}
+	password := *req.DownloadPassword
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "Changing the download password requires the file's delete password.",
+		})
+		return
+	}
+
+	// Files of orgs that require download passwords keep one
+	if password == "" && fileStorage.APIKeyID != nil {
+		key, err := s.db.GetAPIKey(*fileStorage.APIKeyID)
+		if err != nil {
+			log.Printf("Failed to get API key %s: %v", *fileStorage.APIKeyID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check upload policy"})
+			return
+		}
+		policy, err := s.orgPolicyFor(key)
+		if err != nil {
+			log.Printf("Failed to get org policy: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check upload policy"})
+			return
+		}
+		if policy != nil && policy.RequireDownloadPassword {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Download password required",
+				"message": "The uploader's organization requires a download password on every file.",
+			})
+			return
+		}
+	}
+
+	if err := s.db.UpdateFileDownloadPassword(fileID, password); err != nil {
+		log.Printf("Failed to update download password of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	// PostgreSQL holds the password; drop the cached metadata so no copy keeps the old one
+	s.redis.Del(context.Background(), "file:"+fileID)
+	s.recordFileEvent(fileID, FileEventPasswordChanged, gin.H{"protected": password != ""}, c.ClientIP())
+
+	message := "Download password updated successfully"
+	if password == "" {
+		message = "Download password removed"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":               message,
+		"file_id":               fileID,
+		"has_download_password": password != "",
+	})
+}
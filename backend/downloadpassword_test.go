@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOwnerUpdatesDownloadPassword(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "plans", "secret plans", time.Hour)
+	param := gin.Param{Key: "id", Value: "plans"}
+
+	update := func(password, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/file/plans/password?delete_password="+password, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.updateOwnerDownloadPassword, req, param)
+	}
+	protected := func() (bool, string) {
+		file, _ := ts.store.GetFileMetadata("plans")
+		if file.DownloadPassword == nil {
+			return file.HasDownloadPassword, ""
+		}
+		return file.HasDownloadPassword, *file.DownloadPassword
+	}
+
+	if w := update("wrong", `{"download_password":"pw"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong delete password: got %d, want 401", w.Code)
+	}
+	if w := update("delete-me", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("no password given: got %d, want 400", w.Code)
+	}
+	if w := update("delete-me", `{"download_password":"pw"}`); w.Code != http.StatusOK {
+		t.Fatalf("set: got %d: %s", w.Code, w.Body.String())
+	}
+	if has, password := protected(); !has || password != "pw" {
+		t.Errorf("after set: has %v, password %q", has, password)
+	}
+	if w := update("delete-me", `{"download_password":""}`); w.Code != http.StatusOK {
+		t.Fatalf("remove: got %d: %s", w.Code, w.Body.String())
+	}
+	if has, password := protected(); has || password != "" {
+		t.Errorf("after remove: has %v, password %q", has, password)
+	}
+	if len(ts.store.events) != 2 || ts.store.events[0].Type != FileEventPasswordChanged {
+		t.Errorf("events = %+v", ts.store.events)
+	}
+
+	ts.store.CreateOrg(&Org{ID: "org-1", Name: "Team", Policy: OrgPolicy{RequireDownloadPassword: true}})
+	member := orgTestKey("member", "org-1", orgRoleMember)
+	ts.store.CreateAPIKey(member)
+	ts.store.files["plans"].APIKeyID = &member.ID
+	update("delete-me", `{"download_password":"pw"}`)
+	if w := update("delete-me", `{"download_password":""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("removal against org policy: got %d, want 400", w.Code)
+	}
+}
+
+func TestPasswordGatedEndpoints(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "locked", "hello world", time.Hour)
+	file, _ := ts.store.GetFile("locked")
+	password := "hunter2"
+	file.HasDownloadPassword = true
+	file.DownloadPassword = &password
+	ts.store.SaveFile(file)
+	token, _, err := ts.adminTokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := map[string]gin.HandlerFunc{
+		"download":     ts.getFile,
+		"preview":      ts.previewFile,
+		"stream":       ts.fastStreamFile,
+		"text preview": ts.getTextPreview,
+		"metalink":     ts.getMetalink,
+		"segments":     ts.getSegmentPlan,
+		"versions":     ts.listFileVersions,
+	}
+	for name, handler := range endpoints {
+		get := func(query string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/api/file/locked"+query, nil)
+			return ts.serve(handler, req, gin.Param{Key: "id", Value: "locked"})
+		}
+		for _, query := range []string{"", "?password=wrong", "?password=hunter", "?admin_token=forged"} {
+			if w := get(query); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s with %q: got %d, want 401", name, query, w.Code)
+			}
+		}
+		for _, query := range []string{"?password=hunter2", "?admin_token=" + token} {
+			if w := get(query); w.Code != http.StatusOK {
+				t.Errorf("%s with %q: got %d: %s", name, query, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	// The metadata stays public, and tells clients to ask for the password without leaking it
+	w := ts.serve(ts.getMetadata, httptest.NewRequest(http.MethodGet, "/api/metadata/locked", nil), gin.Param{Key: "id", Value: "locked"})
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), password) || strings.Contains(w.Body.String(), "hello world") {
+		t.Errorf("metadata: got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file-storage-service/internal/files"
+)
+
+// The drop folder turns the service into a bridge from the LAN to links: scanners and
+// render farms write files into DROP_DIR, and each file is uploaded through the regular
+// upload pipeline once it has stopped changing for a scan interval. An ingested file is
+// moved to the ingested subdirectory with its file ID in front of its name, or removed
+// with DROP_REMOVE, and an Internet Shortcut (.url) with its share link is written next
+// to it. Files that can't be uploaded are moved to the failed subdirectory with a .error
+// note. Instances sharing the folder claim files by renaming them into processing.
+
+// Subdirectories of the drop folder
+const (
+	dropProcessingDir = "processing"
+	dropIngestedDir   = "ingested"
+	dropFailedDir     = "failed"
+)
+
+// dropFileState is what a scan saw of a file, to tell when it has stopped changing
+type dropFileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// DropFolder watches DROP_DIR and uploads the files placed into it
+type DropFolder struct {
+	service *FileService
+	dir     string
+	seen    map[string]dropFileState
+}
+
+// NewDropFolder creates the subdirectories of the drop folder
+func NewDropFolder(service *FileService) (*DropFolder, error) {
+	dir := service.config.DropDir
+	for _, sub := range []string{dropProcessingDir, dropIngestedDir, dropFailedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create drop folder: %v", err)
+		}
+	}
+	return &DropFolder{service: service, dir: dir, seen: make(map[string]dropFileState)}, nil
+}
+
+// Run scans the drop folder every DROP_SCAN_INTERVAL
+func (d *DropFolder) Run() {
+	log.Printf("Watching drop folder %s", d.dir)
+	ticker := time.NewTicker(d.service.config.DropScanInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		d.scan()
+	}
+}
+
+// skipDropFile reports whether a name belongs to a file that is still being written or
+// isn't meant for upload, like editor backups and partial downloads
+func skipDropFile(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+		return true
+	}
+	for _, suffix := range []string{".part", ".partial", ".tmp", ".crdownload", ".download"} {
+		if strings.HasSuffix(strings.ToLower(name), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan uploads the files that haven't changed since the previous scan
+func (d *DropFolder) scan() {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		log.Printf("Failed to scan drop folder: %v", err)
+		return
+	}
+
+	seen := make(map[string]dropFileState)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || skipDropFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		state := dropFileState{size: info.Size(), modTime: info.ModTime()}
+		previous, ok := d.seen[name]
+		if !ok || previous.size != state.size || !previous.modTime.Equal(state.modTime) {
+			seen[name] = state
+			continue
+		}
+		d.ingest(name)
+	}
+	d.seen = seen
+}
+
+// ingest claims a file of the drop folder and uploads it
+func (d *DropFolder) ingest(name string) {
+	processingPath := filepath.Join(d.dir, dropProcessingDir, name)
+	if err := os.Rename(filepath.Join(d.dir, name), processingPath); err != nil {
+		// Another instance claimed it first
+		return
+	}
+
+	metadata, shareURL, err := d.upload(processingPath, name)
+	if err != nil {
+		log.Printf("Drop folder: failed to ingest %s: %v", name, err)
+		failedPath := filepath.Join(d.dir, dropFailedDir, name)
+		if err := os.Rename(processingPath, failedPath); err != nil {
+			log.Printf("Drop folder: failed to move %s to %s: %v", name, dropFailedDir, err)
+		}
+		os.WriteFile(failedPath+".error", []byte(err.Error()+"\n"), 0644)
+		return
+	}
+
+	ingestedName := metadata.ID + "_" + name
+	if d.service.config.DropRemove {
+		if err := os.Remove(processingPath); err != nil {
+			log.Printf("Drop folder: failed to remove %s: %v", name, err)
+		}
+	} else if err := os.Rename(processingPath, filepath.Join(d.dir, dropIngestedDir, ingestedName)); err != nil {
+		log.Printf("Drop folder: failed to move %s to %s: %v", name, dropIngestedDir, err)
+	}
+	shortcut := "[InternetShortcut]\r\nURL=" + shareURL + "\r\n"
+	if err := os.WriteFile(filepath.Join(d.dir, dropIngestedDir, ingestedName+".url"), []byte(shortcut), 0644); err != nil {
+		log.Printf("Drop folder: failed to write the link of %s: %v", name, err)
+	}
+	log.Printf("Drop folder: ingested %s as %s", name, shareURL)
+}
+
+// upload runs a file through the checks and storage of a regular upload, as the drop
+// folder's API key if one is configured, and returns its metadata and share link
+func (d *DropFolder) upload(path, name string) (*FileMetadata, string, error) {
+	s := d.service
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	// Like /api/upload, the content is handled in memory
+	if info.Size() > s.config.ChunkThreshold {
+		return nil, "", fmt.Errorf("file of %d bytes is larger than CHUNK_THRESHOLD", info.Size())
+	}
+
+	var apiKey *APIKeyStorage
+	if s.config.DropAPIKeyID != "" {
+		if apiKey, err = s.db.GetAPIKey(s.config.DropAPIKeyID); err != nil {
+			return nil, "", err
+		}
+		if apiKey == nil || !apiKey.IsActive() {
+			return nil, "", fmt.Errorf("DROP_API_KEY_ID %s is not an active API key", s.config.DropAPIKeyID)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(content)
+	contentHash := hex.EncodeToString(sum[:])
+
+	// Drop folder files come from the local host
+	who := caller{apiKey: apiKey, clientIP: "127.0.0.1"}
+	filename := files.NormalizeName(name)
+	if err := extensionPolicyError(s.config, filename, int64(len(content))); err != nil {
+		return nil, "", err
+	}
+	if err := s.orgPolicyError(apiKey, filename, false); err != nil {
+		return nil, "", err
+	}
+	storageClass, apiErr := s.storageClassFor(s.config.DropStorageClass, apiKey)
+	if apiErr != nil {
+		return nil, "", apiErr
+	}
+	metadata, _, apiErr := s.saveContent(who, filename, content, contentHash, "", storageClass, nil, nil)
+	if apiErr != nil {
+		return nil, "", apiErr
+	}
+	return metadata, d.baseURL() + "/api/file/" + metadata.ID, nil
+}
+
+// baseURL is where share links of ingested files point: PUBLIC_URL, or else the local
+// API listener
+func (d *DropFolder) baseURL() string {
+	if d.service.config.PublicURL != "" {
+		return d.service.config.PublicURL
+	}
+	return "http://localhost:" + d.service.config.Port
+}
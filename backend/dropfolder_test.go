@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDropFolder(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.DropDir = t.TempDir()
+	ts.config.PublicURL = "https://one.example"
+	ts.config.BlockedExtensions = []string{".exe"}
+	drop, err := NewDropFolder(ts.FileService)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(ts.config.DropDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("scan-0001.pdf", "%PDF-1.4 scanned page")
+	write("setup.exe", "MZ")
+	write("render.mp4.part", "still rendering")
+
+	// The first scan only notes the files, so writers get a scan interval to finish
+	drop.scan()
+	if len(ts.store.files) != 0 {
+		t.Fatalf("ingested files on the first scan: %v", ts.store.files)
+	}
+	drop.scan()
+
+	if len(ts.store.files) != 1 {
+		t.Fatalf("got %d files, want 1", len(ts.store.files))
+	}
+	var fileID string
+	for id, file := range ts.store.files {
+		fileID = id
+		if file.Filename != "scan-0001.pdf" {
+			t.Errorf("filename = %q", file.Filename)
+		}
+	}
+
+	ingested := filepath.Join(ts.config.DropDir, dropIngestedDir, fileID+"_scan-0001.pdf")
+	if _, err := os.Stat(ingested); err != nil {
+		t.Errorf("ingested file not moved: %v", err)
+	}
+	shortcut, err := os.ReadFile(ingested + ".url")
+	if err != nil || !strings.Contains(string(shortcut), "URL=https://one.example/api/file/"+fileID) {
+		t.Errorf("shortcut = %q, %v", shortcut, err)
+	}
+
+	note, err := os.ReadFile(filepath.Join(ts.config.DropDir, dropFailedDir, "setup.exe.error"))
+	if err != nil || !strings.Contains(string(note), "File type not allowed") {
+		t.Errorf("failure note = %q, %v", note, err)
+	}
+	if _, err := os.Stat(filepath.Join(ts.config.DropDir, "render.mp4.part")); err != nil {
+		t.Errorf("partial file touched: %v", err)
+	}
+}
+
+func TestDropFolderWaitsForWriter(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.DropDir = t.TempDir()
+	ts.config.DropRemove = true
+	drop, err := NewDropFolder(ts.FileService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(ts.config.DropDir, "frame.png")
+
+	os.WriteFile(path, []byte("first half"), 0644)
+	drop.scan()
+	os.WriteFile(path, []byte("first half, second half"), 0644)
+	drop.scan()
+	if len(ts.store.files) != 0 {
+		t.Fatal("ingested a file that was still growing")
+	}
+
+	drop.scan()
+	if len(ts.store.files) != 1 {
+		t.Fatalf("got %d files, want 1", len(ts.store.files))
+	}
+	for _, file := range ts.store.files {
+		if file.OriginalSize != int64(len("first half, second half")) {
+			t.Errorf("size = %d", file.OriginalSize)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file not removed with DROP_REMOVE: %v", err)
+	}
+}
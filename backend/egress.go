@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// Egress is counted in Redis as it is served and flushed to PostgreSQL periodically.
+// egressTotalsPrefix+period holds the month's running totals used for quota checks;
+// egressPendingKey holds increments not yet written to the database, with fields of the
+// form "<period>|<subject_type>:<subject_id>".
+const (
+	egressTotalsPrefix = "egress:"
+	egressPendingKey   = "egress_pending"
+	egressTotalsTTL    = 62 * 24 * time.Hour
+	egressFlushPeriod  = time.Minute
+)
+
+// egressPeriod returns the billing month of t, e.g. "2024-05"
+func egressPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// egressPeriodEnd returns when the current billing month ends and quotas reset
+func egressPeriodEnd(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// countingWriter counts the response body bytes written through it
+type countingWriter struct {
+	gin.ResponseWriter
+	written int64
+}
+
+func (w *countingWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.written += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection for flushes and deadlines
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *countingWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.written += int64(n)
+	return n, err
+}
+
+// EgressUsage describes the bytes served to a client this month and its monthly quota
+type EgressUsage struct {
+	Subject    string    `json:"subject"` // "api_key" or "ip"
+	Period     string    `json:"period"`
+	UsedBytes  int64     `json:"used_bytes"`
+	QuotaBytes int64     `json:"quota_bytes"` // 0 = unlimited
+	ResetsAt   time.Time `json:"resets_at"`
+}
+
+// egressSubject returns the Redis field that egress of the request is accounted to and
+// its monthly quota
+func (s *FileService) egressSubject(c *gin.Context) (subject, field string, quota int64) {
+	return s.egressSubjectOf(callerFrom(c))
+}
+
+// egressSubjectOf returns the Redis field that egress to a caller is accounted to and its
+// monthly quota
+func (s *FileService) egressSubjectOf(who caller) (subject, field string, quota int64) {
+	if who.apiKey != nil {
+		return "api_key", "key:" + who.apiKey.ID, who.apiKey.EgressQuotaBytes
+	}
+	return "ip", "ip:" + who.clientIP, s.config.MonthlyEgressPerIP
+}
+
+// egressUsage returns this month's egress for the client of the request
+func (s *FileService) egressUsage(c *gin.Context) (*EgressUsage, error) {
+	return s.egressUsageOf(callerFrom(c))
+}
+
+// egressUsageOf returns this month's egress for a caller
+func (s *FileService) egressUsageOf(who caller) (*EgressUsage, error) {
+	now := time.Now()
+	subject, field, quota := s.egressSubjectOf(who)
+	usage := &EgressUsage{
+		Subject:    subject,
+		Period:     egressPeriod(now),
+		QuotaBytes: quota,
+		ResetsAt:   egressPeriodEnd(now),
+	}
+
+	used, err := s.redis.HGet(context.Background(), egressTotalsPrefix+usage.Period, field).Int64()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	usage.UsedBytes = used
+	return usage, nil
+}
+
+// egressQuotaError refuses a download once the caller has used its monthly egress quota
+func (s *FileService) egressQuotaError(who caller) *apiError {
+	subject, _, quota := s.egressSubjectOf(who)
+	if quota <= 0 {
+		return nil
+	}
+	usage, err := s.egressUsageOf(who)
+	if err != nil {
+		// Fail closed: without the counter the quota can't be enforced
+		log.Printf("Failed to read egress usage: %v", err)
+		return retryLaterError(http.StatusServiceUnavailable, errorCodeDependencyUnavailable, retryAfterDependency, gin.H{
+			"error": "Usage accounting unavailable. Please try again later.",
+		})
+	}
+	if usage.UsedBytes >= quota {
+		return retryLaterError(http.StatusTooManyRequests, errorCodeEgressQuotaExceeded, time.Until(usage.ResetsAt), gin.H{
+			"error":   "Monthly egress quota exceeded",
+			"message": "This " + strings.ReplaceAll(subject, "_", " ") + " has used its download quota for this month.",
+			"usage":   usage,
+		})
+	}
+	return nil
+}
+
+// egressMiddleware enforces monthly egress quotas and records the bytes served per file,
+// per API key and per client IP. It is applied to the routes that serve file content.
+func (s *FileService) egressMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		who := callerFrom(c)
+		if err := s.egressQuotaError(who); err != nil {
+			err.respond(c)
+			return
+		}
+
+		writer := &countingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		if writer.written == 0 || writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		fileID := c.Param("id")
+		if fileID != "" {
+			s.recordDownload(c, fileID, writer.written)
+		}
+		s.recordServed(who, fileID, writer.written)
+	}
+}
+
+// recordServed accounts bytes of a file served to a caller, or of no file in particular
+// when fileID is empty, to its egress and metering
+func (s *FileService) recordServed(who caller, fileID string, bytes int64) {
+	_, field, _ := s.egressSubjectOf(who)
+	fields := []string{field}
+	if fileID != "" {
+		fields = append(fields, "file:"+fileID)
+	}
+	s.recordEgress(fields, bytes)
+	if who.apiKey != nil {
+		s.meter(who.apiKey.ID, meteringEgressBytes, bytes)
+	}
+}
+
+// recordEgress adds served bytes to the monthly totals and the pending database increments
+func (s *FileService) recordEgress(fields []string, bytes int64) {
+	ctx := context.Background()
+	period := egressPeriod(time.Now())
+	totalsKey := egressTotalsPrefix + period
+
+	pipe := s.redis.Pipeline()
+	for _, field := range fields {
+		pipe.HIncrBy(ctx, totalsKey, field, bytes)
+		pipe.HIncrBy(ctx, egressPendingKey, period+"|"+field, bytes)
+	}
+	pipe.Expire(ctx, totalsKey, egressTotalsTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to record egress: %v", err)
+	}
+}
+
+// startBandwidthFlush periodically writes the pending egress counters to PostgreSQL
+func (s *FileService) startBandwidthFlush() {
+	ticker := time.NewTicker(egressFlushPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.flushBandwidthUsage(); err != nil {
+			log.Printf("Failed to flush bandwidth usage: %v", err)
+		}
+	}
+}
+
+// flushBandwidthUsage moves the pending counters aside atomically, so increments made
+// meanwhile start a new batch, and adds them to the database. On failure the counters
+// are put back to be retried on the next flush.
+func (s *FileService) flushBandwidthUsage() error {
+	ctx := context.Background()
+	flushingKey := egressPendingKey + ":flushing:" + generateID()
+
+	if err := s.redis.Rename(ctx, egressPendingKey, flushingKey).Err(); err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return nil
+		}
+		return err
+	}
+	defer s.redis.Del(ctx, flushingKey)
+
+	pending, err := s.redis.HGetAll(ctx, flushingKey).Result()
+	if err != nil {
+		return err
+	}
+
+	usage := make([]BandwidthUsage, 0, len(pending))
+	for key, value := range pending {
+		bytes, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		period, subject, ok := strings.Cut(key, "|")
+		if !ok {
+			continue
+		}
+		subjectType, subjectID, ok := strings.Cut(subject, ":")
+		if !ok {
+			continue
+		}
+		periodStart, err := time.Parse("2006-01", period)
+		if err != nil {
+			continue
+		}
+		usage = append(usage, BandwidthUsage{
+			Period:      periodStart,
+			SubjectType: subjectType,
+			SubjectID:   subjectID,
+			Bytes:       bytes,
+		})
+	}
+
+	if err := s.db.AddBandwidthUsage(usage); err != nil {
+		pipe := s.redis.Pipeline()
+		for key, value := range pending {
+			if bytes, parseErr := strconv.ParseInt(value, 10, 64); parseErr == nil {
+				pipe.HIncrBy(ctx, egressPendingKey, key, bytes)
+			}
+		}
+		if _, restoreErr := pipe.Exec(ctx); restoreErr != nil {
+			log.Printf("Failed to restore pending egress counters: %v", restoreErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// cleanupUsage removes usage older than USAGE_RETENTION_DAYS and anonymizes the bandwidth
+// of client IPs after USAGE_IP_RETENTION_DAYS
+func (s *FileService) cleanupUsage() {
+	now := s.clock.Now()
+	if err := s.db.DeleteUsageBefore(now.Add(-s.config.UsageRetention), now.Add(-s.config.UsageIPRetention)); err != nil {
+		log.Printf("Failed to clean up usage: %v", err)
+	}
+}
+
+// getUsage returns the storage and egress usage of the caller: the API key when one is
+// used, otherwise the client IP
+//
+// @summary Get the caller's storage and egress usage
+// @tags account
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) getUsage(c *gin.Context) {
+	storage, err := s.quotaUsage(c)
+	if err != nil {
+		log.Printf("Failed to get storage usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	egress, err := s.egressUsage(c)
+	if err != nil {
+		log.Printf("Failed to get egress usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"storage": storage,
+		"egress":  egress,
+	})
+}
+
+type BandwidthStatsRequest struct {
+	Period string `json:"period,omitempty"` // "YYYY-MM", defaults to the current month
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// getBandwidthStats returns the egress totals of a month and the files, API keys and IPs
+// that used the most. Counters reach the database within a minute of being served.
+//
+// @summary Get egress statistics
+// @tags admin
+// @body json BandwidthStatsRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getBandwidthStats(c *gin.Context) {
+	var req BandwidthStatsRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Period == "" {
+		req.Period = egressPeriod(time.Now())
+	}
+	period, err := time.Parse("2006-01", req.Period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must use YYYY-MM format"})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 20
+	}
+
+	response := gin.H{"period": req.Period}
+	for _, subjectType := range []string{"file", "key", "ip"} {
+		total, top, err := s.db.GetBandwidthUsage(period, subjectType, req.Limit)
+		if err != nil {
+			log.Printf("Failed to get bandwidth usage: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		response[subjectType+"s"] = gin.H{"total_bytes": total, "top": top}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Uploaders can have the download link mailed to up to emailLinkMaxRecipients addresses
+// by passing email_to with the upload. Mail goes out through the SMTP server configured
+// with SMTP_HOST, rendered from EMAIL_LINK_TEMPLATE or the built-in message. Recipients
+// can't be given a message of the uploader's choosing, only a short password hint, and
+// every sender (API key or IP) and recipient has a budget of mails, so the service can't
+// be used as a spam relay.
+
+const (
+	emailLinkMaxRecipients = 5
+	maxPasswordHintLength  = 100
+
+	emailSenderPrefix    = "email_link:sender:"    // Mails sent per API key or IP, per hour
+	emailRecipientPrefix = "email_link:recipient:" // Mails received per address, per day
+)
+
+const defaultEmailLinkSubject = `{{.Filename}} was shared with you`
+
+const defaultEmailLinkBody = `A file was shared with you.
+
+File:     {{.Filename}} ({{.Size}})
+Download: {{.DownloadURL}}
+Expires:  {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}
+{{- if .PasswordProtected}}
+
+The file is protected by a download password, which the sender will give you separately.
+{{- if .PasswordHint}}
+Password hint: {{.PasswordHint}}
+{{- end}}
+{{- end}}
+
+You received this message because someone entered your address when uploading the file.
+`
+
+// LinkEmail is the data of a link mail, available to the templates
+type LinkEmail struct {
+	Recipients        []string `json:"-"`
+	Filename          string
+	Size              string
+	DownloadURL       string
+	ExpiresAt         time.Time
+	PasswordProtected bool
+	PasswordHint      string
+}
+
+// LinkMailer renders and sends link mails
+type LinkMailer struct {
+	config  *Config
+	subject *template.Template
+	body    *template.Template
+	// send delivers a message; smtp.SendMail unless replaced in tests
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewLinkMailer returns a mailer, or nil when SMTP_HOST isn't set
+func NewLinkMailer(config *Config) (*LinkMailer, error) {
+	if config.SMTPHost == "" {
+		return nil, nil
+	}
+	if _, err := mail.ParseAddress(config.SMTPFrom); err != nil {
+		return nil, fmt.Errorf("SMTP_FROM must be a mail address: %v", err)
+	}
+
+	body := defaultEmailLinkBody
+	if config.EmailLinkTemplate != "" {
+		data, err := os.ReadFile(config.EmailLinkTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read EMAIL_LINK_TEMPLATE: %v", err)
+		}
+		body = string(data)
+	}
+	bodyTemplate, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_LINK_TEMPLATE: %v", err)
+	}
+	subjectTemplate, err := template.New("subject").Parse(config.EmailLinkSubject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EMAIL_LINK_SUBJECT: %v", err)
+	}
+
+	return &LinkMailer{config: config, subject: subjectTemplate, body: bodyTemplate, send: smtp.SendMail}, nil
+}
+
+// message renders the mail to one recipient
+func (m *LinkMailer) message(email *LinkEmail, to string, now time.Time) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := m.subject.Execute(&subject, email); err != nil {
+		return nil, err
+	}
+	if err := m.body.Execute(&body, email); err != nil {
+		return nil, err
+	}
+
+	// A filename can't break out of the Subject header
+	subjectLine := strings.Join(strings.Fields(subject.String()), " ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.config.SMTPFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subjectLine))
+	fmt.Fprintf(&msg, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("Auto-Submitted: auto-generated\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body.String(), "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
+
+// Send mails the link to every recipient, one message each so recipients don't see
+// each other
+func (m *LinkMailer) Send(email *LinkEmail, now time.Time) {
+	addr := net.JoinHostPort(m.config.SMTPHost, strconv.Itoa(m.config.SMTPPort))
+	var auth smtp.Auth
+	if m.config.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.config.SMTPUsername, m.config.SMTPPassword, m.config.SMTPHost)
+	}
+	from, _ := mail.ParseAddress(m.config.SMTPFrom)
+
+	for _, to := range email.Recipients {
+		msg, err := m.message(email, to, now)
+		if err == nil {
+			err = m.send(addr, auth, from.Address, []string{to}, msg)
+		}
+		if err != nil {
+			log.Printf("Failed to mail the link of %s to %s: %v", email.Filename, to, err)
+		}
+	}
+}
+
+// linkEmailFromRequest validates the email_to and password_hint of an upload and charges
+// the mails to the sender's and recipients' budgets. It returns nil when no mail was
+// asked for, or writes the error response and returns false.
+func (s *FileService) linkEmailFromRequest(c *gin.Context, emailTo, passwordHint string) (*LinkEmail, bool) {
+	emailTo = strings.TrimSpace(emailTo)
+	if emailTo == "" {
+		return nil, true
+	}
+	if s.mailer == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sending links by email is not enabled"})
+		return nil, false
+	}
+
+	addresses, err := mail.ParseAddressList(emailTo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email_to must be a comma-separated list of mail addresses"})
+		return nil, false
+	}
+	if len(addresses) > emailLinkMaxRecipients {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Too many recipients",
+			"max_recipients": emailLinkMaxRecipients,
+		})
+		return nil, false
+	}
+	email := &LinkEmail{PasswordHint: strings.Join(strings.Fields(passwordHint), " ")}
+	if len([]rune(email.PasswordHint)) > maxPasswordHintLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("password_hint must be at most %d characters", maxPasswordHintLength)})
+		return nil, false
+	}
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		if key := strings.ToLower(address.Address); !seen[key] {
+			seen[key] = true
+			email.Recipients = append(email.Recipients, address.Address)
+		}
+	}
+
+	sender := "ip:" + c.ClientIP()
+	if apiKey := apiKeyFromContext(c); apiKey != nil {
+		sender = "key:" + apiKey.ID
+	}
+	now := s.clock.Now()
+	hour := strconv.FormatInt(now.Unix()/3600, 10)
+	if !s.chargeEmailBudget(emailSenderPrefix+sender+":"+hour, int64(len(email.Recipients)), s.config.EmailLinkHourlyLimit, time.Hour) {
+		nextHour := time.Duration(3600-now.Unix()%3600) * time.Second
+		respondRetryLater(c, http.StatusTooManyRequests, errorCodeEmailLimitExceeded, nextHour, gin.H{
+			"error":   "Email limit reached",
+			"message": fmt.Sprintf("At most %d links can be mailed per hour.", s.config.EmailLinkHourlyLimit),
+		})
+		return nil, false
+	}
+	day := strconv.FormatInt(now.Unix()/86400, 10)
+	for _, to := range email.Recipients {
+		if !s.chargeEmailBudget(emailRecipientPrefix+strings.ToLower(to)+":"+day, 1, s.config.EmailLinkRecipientDailyLimit, 24*time.Hour) {
+			nextDay := time.Duration(86400-now.Unix()%86400) * time.Second
+			respondRetryLater(c, http.StatusTooManyRequests, errorCodeEmailLimitExceeded, nextDay, gin.H{
+				"error":   "Email limit reached",
+				"message": fmt.Sprintf("%s has received the maximum number of links for today.", to),
+			})
+			return nil, false
+		}
+	}
+	return email, true
+}
+
+// chargeEmailBudget adds n mails to a budget counter, reporting whether it stays within
+// limit. Without Redis the budget can't be enforced, so no mail is sent.
+func (s *FileService) chargeEmailBudget(key string, n int64, limit int, window time.Duration) bool {
+	ctx := context.Background()
+	count, err := s.redis.IncrBy(ctx, key, n).Result()
+	if err != nil {
+		log.Printf("Failed to update email budget %s: %v", key, err)
+		return false
+	}
+	if count == n {
+		s.redis.Expire(ctx, key, window)
+	}
+	return count <= int64(limit)
+}
+
+// sendLinkEmail mails the link of a stored upload in the background
+func (s *FileService) sendLinkEmail(c *gin.Context, email *LinkEmail, metadata *FileMetadata) {
+	email.Filename = metadata.Filename
+	email.Size = formatSize(metadata.Size)
+	email.DownloadURL = s.publicBaseURL(c) + "/api/file/" + metadata.ID
+	email.ExpiresAt = metadata.ExpiresAt
+	email.PasswordProtected = metadata.HasDownloadPassword
+	if !email.PasswordProtected {
+		email.PasswordHint = ""
+	}
+	go s.mailer.Send(email, s.clock.Now())
+}
+
+// formatSize renders a byte count for people, like "4.2 MB"
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadEmailsLink(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.EmailLinkHourlyLimit = 3
+	ts.config.EmailLinkRecipientDailyLimit = 5
+	mailer, err := NewLinkMailer(&Config{
+		SMTPHost:         "smtp.example.com",
+		SMTPPort:         25,
+		SMTPFrom:         "ONE <one@example.com>",
+		EmailLinkSubject: defaultEmailLinkSubject,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan string, 10)
+	mailer.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:25" || from != "one@example.com" || len(to) != 1 {
+			t.Errorf("send(%s, %s, %v)", addr, from, to)
+		}
+		sent <- string(msg)
+		return nil
+	}
+	ts.mailer = mailer
+
+	upload := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/upload/base64", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.uploadBase64, req)
+	}
+
+	w := upload(`{"filename":"plan.txt","content":"aGVsbG8=","download_password":"pw",` +
+		`"email_to":"Ann <ann@example.com>, bob@example.com","password_hint":"our street"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		FileID    string   `json:"file_id"`
+		EmailedTo []string `json:"emailed_to"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if strings.Join(resp.EmailedTo, ",") != "ann@example.com,bob@example.com" {
+		t.Errorf("emailed_to = %v", resp.EmailedTo)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-sent:
+			for _, want := range []string{"Subject: plan.txt was shared with you\r\n", "/api/file/" + resp.FileID + "\r\n", "Password hint: our street"} {
+				if !strings.Contains(msg, want) {
+					t.Errorf("message lacks %q:\n%s", want, msg)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatal("link was not mailed")
+		}
+	}
+
+	if w := upload(`{"content":"aGVsbG8=","email_to":"carol@example.com, dave@example.com"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("over the hourly limit: got %d, want 429", w.Code)
+	}
+	if w := upload(`{"content":"aGVsbG8=","email_to":"not an address"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid address: got %d, want 400", w.Code)
+	}
+
+	ts.mailer = nil
+	if w := upload(`{"content":"aGVsbG8=","email_to":"ann@example.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("mail disabled: got %d, want 400", w.Code)
+	}
+}
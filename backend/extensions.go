@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// matchesExtension reports whether filename ends with the extension, which may contain
+// dots itself (e.g. "tar.gz") and is compared case-insensitively
+func matchesExtension(filename, extension string) bool {
+	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
+	return extension != "" && strings.HasSuffix(strings.ToLower(filename), "."+extension)
+}
+
+// extensionAllowed reports whether the extension policy permits uploading filename
+func (c *Config) extensionAllowed(filename string) bool {
+	for _, blocked := range c.BlockedExtensions {
+		if matchesExtension(filename, blocked) {
+			return false
+		}
+	}
+	if len(c.AllowedExtensions) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedExtensions {
+		if matchesExtension(filename, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxFileSizeFor returns the size limit of filename: the override of its longest matching
+// extension if it is lower than MAX_FILE_SIZE, otherwise MAX_FILE_SIZE
+func (c *Config) maxFileSizeFor(filename string) int64 {
+	maxSize := c.MaxFileSize
+	matched := ""
+	for extension, size := range c.ExtensionMaxSizes {
+		if matchesExtension(filename, extension) && len(extension) > len(matched) {
+			matched = extension
+			maxSize = size
+		}
+	}
+	if maxSize > c.MaxFileSize {
+		return c.MaxFileSize
+	}
+	return maxSize
+}
+
+// checkExtensionPolicy rejects uploads whose extension isn't allowed with 415 and those
+// over their extension's size limit with 413. The size may be 0 when not yet known.
+func checkExtensionPolicy(c *gin.Context, config *Config, filename string, size int64) bool {
+	if err := extensionPolicyError(config, filename, size); err != nil {
+		err.respond(c)
+		return false
+	}
+	return true
+}
+
+// extensionPolicyError is checkExtensionPolicy, returning the error instead of writing it
+func extensionPolicyError(config *Config, filename string, size int64) *apiError {
+	if !config.extensionAllowed(filename) {
+		response := gin.H{
+			"error":   "File type not allowed",
+			"message": "Files with this extension can't be uploaded.",
+		}
+		if len(config.AllowedExtensions) > 0 {
+			response["allowed_extensions"] = config.AllowedExtensions
+		}
+		return &apiError{status: http.StatusUnsupportedMediaType, body: response}
+	}
+
+	if maxSize := config.maxFileSizeFor(filename); size > maxSize {
+		return &apiError{status: http.StatusRequestEntityTooLarge, body: gin.H{
+			"error":    "File too large",
+			"message":  "Files of this type are limited to a smaller size.",
+			"max_size": maxSize,
+		}}
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// With FAKE_DATA set, the service seeds a fixed set of fixture files on startup: a file of
+// each common type, an empty and a large one, one behind a download password, one about
+// to expire, one in the trash, and uploads still processing or failed. The fixtures have
+// the same IDs and contents on every instance, so frontend and SDK tests can rely on them,
+// and POST /api/dev/reset puts them back as they were after a test changed or deleted them.
+
+// Passwords of the fixture files
+const (
+	fixtureDeletePassword   = "fixture-delete"
+	fixtureDownloadPassword = "fixture"
+)
+
+// Fixture states, besides plain available files
+const (
+	fixtureAvailable  = "available"
+	fixtureProtected  = "password_protected"
+	fixtureExpiring   = "expiring"
+	fixtureTrashed    = "trashed"
+	fixtureProcessing = "processing"
+	fixtureFailed     = "failed"
+)
+
+// fakeFile is a fixture file
+type fakeFile struct {
+	ID            string
+	Filename      string
+	MimeType      string
+	Content       []byte
+	State         string
+	Accessibility *Accessibility
+}
+
+// describe lists a fixture in responses
+func (f fakeFile) describe() gin.H {
+	return gin.H{
+		"id":        f.ID,
+		"filename":  f.Filename,
+		"mime_type": f.MimeType,
+		"size":      len(f.Content),
+		"state":     f.State,
+		"url":       "/api/file/" + f.ID,
+	}
+}
+
+// fixtureID returns the fixed ID of the nth fixture
+func fixtureID(n int) string {
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", n)
+}
+
+// fakeFiles returns the fixtures, always the same
+func fakeFiles() []fakeFile {
+	large := make([]byte, 2<<20)
+	for i := range large {
+		large[i] = byte(i*131 + i>>11)
+	}
+	return []fakeFile{
+		{ID: fixtureID(1), Filename: "hello.txt", MimeType: "text/plain",
+			Content: []byte("Hello from the fixture files!\n"), State: fixtureAvailable},
+		{ID: fixtureID(2), Filename: "README.md", MimeType: "text/markdown",
+			Content: []byte("# Fixture\n\nA *Markdown* file with a [link](https://example.com) and a list:\n\n- one\n- two\n"), State: fixtureAvailable},
+		{ID: fixtureID(3), Filename: "data.json", MimeType: "application/json",
+			Content: []byte(`{"name": "fixture", "count": 3, "tags": ["a", "b", "c"], "nested": {"ok": true}}` + "\n"), State: fixtureAvailable},
+		{ID: fixtureID(4), Filename: "table.csv", MimeType: "text/csv",
+			Content: []byte("id,name,score\n1,Ada,93\n2,Grace,88\n3,Linus,71\n"), State: fixtureAvailable},
+		{ID: fixtureID(5), Filename: "gradient.png", MimeType: "image/png",
+			Content: fixturePNG(), State: fixtureAvailable,
+			Accessibility: &Accessibility{AltText: "A gradient from red on the left to blue on the right", Caption: "Fixture image"}},
+		{ID: fixtureID(6), Filename: "sample.pdf", MimeType: "application/pdf",
+			Content: fixturePDF("Fixture document"), State: fixtureAvailable},
+		{ID: fixtureID(7), Filename: "empty.txt", MimeType: "text/plain",
+			Content: []byte{}, State: fixtureAvailable},
+		{ID: fixtureID(8), Filename: "large.bin", MimeType: "application/octet-stream",
+			Content: large, State: fixtureAvailable},
+		{ID: fixtureID(9), Filename: "secret.txt", MimeType: "text/plain",
+			Content: []byte("Only for those who know the password.\n"), State: fixtureProtected},
+		{ID: fixtureID(10), Filename: "expiring.txt", MimeType: "text/plain",
+			Content: []byte("This file expires ten minutes after a reset.\n"), State: fixtureExpiring},
+		{ID: fixtureID(11), Filename: "trashed.txt", MimeType: "text/plain",
+			Content: []byte("This file is in the trash.\n"), State: fixtureTrashed},
+		{ID: fixtureID(12), Filename: "video.mp4", MimeType: "video/mp4", State: fixtureProcessing},
+		{ID: fixtureID(13), Filename: "archive.zip", MimeType: "application/zip", State: fixtureFailed},
+	}
+}
+
+// fixturePNG draws a small horizontal gradient
+func fixturePNG() []byte {
+	const width, height = 64, 32
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		shade := uint8(x * 255 / (width - 1))
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: 255 - shade, G: 64, B: shade, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// fixturePDF writes a one-page PDF with a line of text
+func fixturePDF(text string) []byte {
+	content := fmt.Sprintf("BT /F1 24 Tf 72 720 Td (%s) Tj ET", pdfString(text))
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// seedFakeData removes whatever is left of the fixtures and stores them afresh
+func (s *FileService) seedFakeData() ([]gin.H, error) {
+	ctx := context.Background()
+	now := s.clock.Now()
+
+	fixtures := fakeFiles()
+	listing := make([]gin.H, 0, len(fixtures))
+	for _, fixture := range fixtures {
+		// Fixtures that are already gone fail to delete, which is fine
+		s.db.DeleteFile(fixture.ID)
+		s.redis.Del(ctx, "file:"+fixture.ID, "processing:"+fixture.ID)
+
+		switch fixture.State {
+		case fixtureProcessing, fixtureFailed:
+			// Uploads that aren't done have no file yet, only their processing status
+			status := map[string]interface{}{"status": fixture.State, "filename": fixture.Filename}
+			if fixture.State == fixtureFailed {
+				status["error"] = "The archive is corrupt."
+			}
+			statusJSON, _ := json.Marshal(status)
+			if err := s.redis.Set(ctx, "processing:"+fixture.ID, statusJSON, 0).Err(); err != nil {
+				return nil, fmt.Errorf("failed to seed %s: %v", fixture.Filename, err)
+			}
+		default:
+			if err := s.saveFakeFile(fixture, now); err != nil {
+				return nil, fmt.Errorf("failed to seed %s: %v", fixture.Filename, err)
+			}
+		}
+
+		listing = append(listing, fixture.describe())
+	}
+	return listing, nil
+}
+
+// saveFakeFile stores a fixture that has finished uploading
+func (s *FileService) saveFakeFile(fixture fakeFile, now time.Time) error {
+	retention := s.config.FileRetention
+	if fixture.State == fixtureExpiring {
+		retention = 10 * time.Minute
+	}
+	size := int64(len(fixture.Content))
+	sum := sha256.Sum256(fixture.Content)
+	contentHash := hex.EncodeToString(sum[:])
+
+	file := &FileStorage{
+		ID:              fixture.ID,
+		Filename:        fixture.Filename,
+		OriginalSize:    size,
+		CompressedSize:  &size,
+		MimeType:        fixture.MimeType,
+		CompressionType: string(CompressionNone),
+		StorageType:     "postgresql",
+		FileContent:     fixture.Content,
+		UploadTime:      now,
+		ExpiresAt:       now.Add(retention),
+		DeletePassword:  fixtureDeletePassword,
+		ContentHash:     &contentHash,
+		StorageClass:    string(StorageClassStandard),
+		Accessibility:   fixture.Accessibility,
+	}
+	if strings.HasPrefix(fixture.MimeType, "image/") {
+		file.ImageInfo = extractImageInfo(fixture.Content)
+	}
+	if fixture.State == fixtureProtected {
+		password := fixtureDownloadPassword
+		file.DownloadPassword = &password
+		file.HasDownloadPassword = true
+	}
+
+	if err := s.db.SaveFile(file); err != nil {
+		return err
+	}
+	if fixture.State == fixtureTrashed {
+		return s.db.TrashFile(fixture.ID, now)
+	}
+	return nil
+}
+
+// fakeDataResponse describes the fixtures and their passwords
+func fakeDataResponse(listing []gin.H) gin.H {
+	return gin.H{
+		"fixtures":          listing,
+		"delete_password":   fixtureDeletePassword,
+		"download_password": fixtureDownloadPassword,
+	}
+}
+
+// listFakeData lists the fixture files without touching them
+//
+// @summary List the fixture files
+// @tags dev
+// @success 200 json
+func (s *FileService) listFakeData(c *gin.Context) {
+	fixtures := fakeFiles()
+	listing := make([]gin.H, len(fixtures))
+	for i, fixture := range fixtures {
+		listing[i] = fixture.describe()
+	}
+	c.JSON(http.StatusOK, fakeDataResponse(listing))
+}
+
+// resetFakeData restores the fixture files to their seeded state
+//
+// @summary Restore the fixture files
+// @tags dev
+// @success 200 json
+func (s *FileService) resetFakeData(c *gin.Context) {
+	listing, err := s.seedFakeData()
+	if err != nil {
+		log.Printf("Failed to reset fake data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset fixture files"})
+		return
+	}
+	c.JSON(http.StatusOK, fakeDataResponse(listing))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResetFakeData(t *testing.T) {
+	ts := newTestService(t)
+	reset := func() {
+		t.Helper()
+		w := ts.serve(ts.resetFakeData, httptest.NewRequest(http.MethodPost, "/api/dev/reset", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("reset: got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	get := func(handler gin.HandlerFunc, path, id string) *httptest.ResponseRecorder {
+		return ts.serve(handler, httptest.NewRequest(http.MethodGet, path, nil), gin.Param{Key: "id", Value: id})
+	}
+	reset()
+
+	hello := fixtureID(1)
+	if w := get(ts.getFile, "/api/file/"+hello, hello); w.Code != http.StatusOK || w.Body.String() != "Hello from the fixture files!\n" {
+		t.Fatalf("text fixture: got %d %q", w.Code, w.Body.String())
+	}
+	image, _ := ts.store.GetFileMetadata(fixtureID(5))
+	if image.ImageInfo == nil || image.ImageInfo.Width != 64 || image.Accessibility == nil {
+		t.Errorf("image fixture: image info %+v, accessibility %+v", image.ImageInfo, image.Accessibility)
+	}
+	if w := get(ts.getFile, "/api/file/"+fixtureID(9), fixtureID(9)); w.Code != http.StatusUnauthorized {
+		t.Errorf("protected fixture without password: got %d, want 401", w.Code)
+	}
+	if w := get(ts.getFile, "/api/file/"+fixtureID(9)+"?password=fixture", fixtureID(9)); w.Code != http.StatusOK {
+		t.Errorf("protected fixture with password: got %d, want 200", w.Code)
+	}
+	if trashed, _ := ts.store.GetTrashedFile(fixtureID(11)); trashed == nil {
+		t.Error("trashed fixture isn't in the trash")
+	}
+	if w := get(ts.getFileStatus, "/api/status/"+fixtureID(12), fixtureID(12)); w.Code != http.StatusAccepted {
+		t.Errorf("processing fixture: got %d, want 202", w.Code)
+	}
+	if w := get(ts.getFileStatus, "/api/status/"+fixtureID(13), fixtureID(13)); w.Code != http.StatusBadRequest {
+		t.Errorf("failed fixture: got %d, want 400", w.Code)
+	}
+
+	// A reset undoes what tests did to the fixtures
+	ts.store.DeleteFile(hello)
+	ts.store.UpdateFileName(fixtureID(2), "renamed.md")
+	reset()
+	if file, _ := ts.store.GetFileMetadata(hello); file == nil {
+		t.Error("deleted fixture isn't back")
+	}
+	if file, _ := ts.store.GetFileMetadata(fixtureID(2)); file.Filename != "README.md" {
+		t.Errorf("renamed fixture is still %q", file.Filename)
+	}
+
+	w := ts.serve(ts.listFakeData, httptest.NewRequest(http.MethodGet, "/api/dev/fixtures", nil))
+	var listing struct {
+		Fixtures []struct {
+			ID    string `json:"id"`
+			State string `json:"state"`
+		} `json:"fixtures"`
+		DownloadPassword string `json:"download_password"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Fixtures) != len(fakeFiles()) || listing.DownloadPassword != fixtureDownloadPassword {
+		t.Errorf("listing = %+v", listing)
+	}
+}
@@ -0,0 +1,1151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// In-memory test doubles for the Redis client, the database and the clock. Each fake
+// embeds its interface, so calling a method a test didn't need to implement panics on
+// the nil embedded value instead of silently doing nothing.
+
+// fakeClock is a Clock that only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type fakeRedisEntry struct {
+	value     string
+	hash      map[string]string // Fields of a hash key
+	expiresAt time.Time         // Zero when the key doesn't expire
+}
+
+// fakeRedis keeps string and hash keys in memory and expires them by the fake clock
+type fakeRedis struct {
+	RedisClient
+	clock Clock
+
+	mu   sync.Mutex
+	data map[string]fakeRedisEntry
+}
+
+func newFakeRedis(clock Clock) *fakeRedis {
+	return &fakeRedis{clock: clock, data: make(map[string]fakeRedisEntry)}
+}
+
+// lookup returns a live entry; the caller holds r.mu
+func (r *fakeRedis) lookup(key string) (fakeRedisEntry, bool) {
+	entry, ok := r.data[key]
+	if ok && !entry.expiresAt.IsZero() && !r.clock.Now().Before(entry.expiresAt) {
+		delete(r.data, key)
+		return fakeRedisEntry{}, false
+	}
+	return entry, ok
+}
+
+func (r *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.lookup(key)
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(entry.value, nil)
+}
+
+func (r *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := fakeRedisEntry{value: s}
+	if expiration > 0 {
+		entry.expiresAt = r.clock.Now().Add(expiration)
+	}
+	r.data[key] = entry
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (r *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for _, key := range keys {
+		if _, ok := r.lookup(key); ok {
+			delete(r.data, key)
+			deleted++
+		}
+	}
+	return redis.NewIntResult(deleted, nil)
+}
+
+func (r *fakeRedis) Keys(ctx context.Context, pattern string) *redis.StringSliceCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for key := range r.data {
+		if _, ok := r.lookup(key); !ok {
+			continue
+		}
+		if matched, _ := path.Match(pattern, key); matched {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return redis.NewStringSliceResult(keys, nil)
+}
+
+func (r *fakeRedis) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for _, key := range keys {
+		if _, ok := r.lookup(key); ok {
+			count++
+		}
+	}
+	return redis.NewIntResult(count, nil)
+}
+
+func (r *fakeRedis) Incr(ctx context.Context, key string) *redis.IntCmd {
+	return r.IncrBy(ctx, key, 1)
+}
+
+func (r *fakeRedis) IncrBy(ctx context.Context, key string, n int64) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, _ := r.lookup(key)
+	var value int64
+	fmt.Sscan(entry.value, &value)
+	value += n
+	entry.value = fmt.Sprint(value)
+	r.data[key] = entry
+	return redis.NewIntResult(value, nil)
+}
+
+func (r *fakeRedis) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.lookup(key)
+	if ok {
+		entry.expiresAt = r.clock.Now().Add(expiration)
+		r.data[key] = entry
+	}
+	return redis.NewBoolResult(ok, nil)
+}
+
+func (r *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	_, exists := r.lookup(key)
+	r.mu.Unlock()
+	if exists {
+		return redis.NewBoolResult(false, nil)
+	}
+	r.Set(ctx, key, value, expiration)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (r *fakeRedis) Rename(ctx context.Context, key, newkey string) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.lookup(key)
+	if !ok {
+		return redis.NewStatusResult("", fmt.Errorf("ERR no such key"))
+	}
+	delete(r.data, key)
+	r.data[newkey] = entry
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (r *fakeRedis) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, _ := r.lookup(key)
+	if entry.hash == nil {
+		entry.hash = make(map[string]string)
+	}
+	var value int64
+	fmt.Sscan(entry.hash[field], &value)
+	value += incr
+	entry.hash[field] = fmt.Sprint(value)
+	r.data[key] = entry
+	return redis.NewIntResult(value, nil)
+}
+
+// fakePipeline runs the counter commands the service pipelines straight away
+type fakePipeline struct {
+	redis.Pipeliner
+	r *fakeRedis
+}
+
+func (r *fakeRedis) Pipeline() redis.Pipeliner {
+	return &fakePipeline{r: r}
+}
+
+func (p *fakePipeline) HIncrBy(ctx context.Context, key, field string, incr int64) *redis.IntCmd {
+	return p.r.HIncrBy(ctx, key, field, incr)
+}
+
+func (p *fakePipeline) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	return p.r.Expire(ctx, key, expiration)
+}
+
+func (p *fakePipeline) Exec(ctx context.Context) ([]redis.Cmder, error) {
+	return nil, nil
+}
+
+// HSet takes field/value pairs as separate arguments, which is all the service passes
+func (r *fakeRedis) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, _ := r.lookup(key)
+	if entry.hash == nil {
+		entry.hash = make(map[string]string)
+	}
+	var added int64
+	for i := 0; i+1 < len(values); i += 2 {
+		field := fmt.Sprint(values[i])
+		if _, ok := entry.hash[field]; !ok {
+			added++
+		}
+		entry.hash[field] = fmt.Sprint(values[i+1])
+	}
+	r.data[key] = entry
+	return redis.NewIntResult(added, nil)
+}
+
+func (r *fakeRedis) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, _ := r.lookup(key)
+	value, ok := entry.hash[field]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (r *fakeRedis) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, _ := r.lookup(key)
+	fields := make(map[string]string, len(entry.hash))
+	for field, value := range entry.hash {
+		fields[field] = value
+	}
+	return redis.NewStringStringMapResult(fields, nil)
+}
+
+// Publish drops the message; no test subscribes
+func (r *fakeRedis) Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd {
+	return redis.NewIntResult(0, nil)
+}
+
+func (r *fakeRedis) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	return redis.NewStatusResult("OK", nil)
+}
+
+// fakeStore keeps files and chunk upload sessions in memory. Like the SQL queries it
+// stands in for, it hides files whose expiry has passed.
+type fakeStore struct {
+	FileStore
+	clock Clock
+
+	mu           sync.Mutex
+	files        map[string]*FileStorage
+	chunkUploads map[string]*ChunkUploadStorage
+	jobs         map[string]*ProcessingJobStorage
+	apiKeys      map[string]*APIKeyStorage
+	orgs         map[string]*Org
+	usage        []UsageRecord
+	events       []FileEvent
+	bandwidth    []BandwidthUsage
+	bandwidthAt  []time.Time // When each bandwidth entry was added
+	accesses     map[string][]FileAccess
+	versions     map[string][]*FileVersion
+	slugs        map[string]string
+}
+
+func newFakeStore(clock Clock) *fakeStore {
+	return &fakeStore{
+		clock:        clock,
+		files:        make(map[string]*FileStorage),
+		chunkUploads: make(map[string]*ChunkUploadStorage),
+		jobs:         make(map[string]*ProcessingJobStorage),
+		apiKeys:      make(map[string]*APIKeyStorage),
+		orgs:         make(map[string]*Org),
+		accesses:     make(map[string][]FileAccess),
+		versions:     make(map[string][]*FileVersion),
+		slugs:        make(map[string]string),
+	}
+}
+
+func (s *fakeStore) SaveFile(file *FileStorage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *file
+	if stored.Version == 0 {
+		stored.Version = 1 // The column default
+	}
+	s.files[file.ID] = &stored
+	return nil
+}
+
+func (s *fakeStore) GetFile(fileID string) (*FileStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok || !file.ExpiresAt.After(s.clock.Now()) || file.DeletedAt != nil {
+		return nil, nil
+	}
+	copied := *file
+	return &copied, nil
+}
+
+func (s *fakeStore) GetFileMetadata(fileID string) (*FileStorage, error) {
+	file, err := s.GetFile(fileID)
+	if file != nil {
+		file.FileContent = nil
+	}
+	return file, err
+}
+
+func (s *fakeStore) DeleteFile(fileID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, fileID)
+	return nil
+}
+
+func (s *fakeStore) TrashFile(fileID string, deletedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok || !file.ExpiresAt.After(s.clock.Now()) || file.DeletedAt != nil {
+		return fmt.Errorf("file not found")
+	}
+	file.DeletedAt = &deletedAt
+	return nil
+}
+
+func (s *fakeStore) GetTrashedFile(fileID string) (*FileStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok || !file.ExpiresAt.After(s.clock.Now()) || file.DeletedAt == nil {
+		return nil, nil
+	}
+	copied := *file
+	copied.FileContent = nil
+	return &copied, nil
+}
+
+func (s *fakeStore) GetTrashedFileContent(fileID string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok || file.DeletedAt == nil {
+		return nil, fmt.Errorf("file not found in trash")
+	}
+	return file.FileContent, nil
+}
+
+func (s *fakeStore) FileIDExists(fileID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[fileID]
+	return ok, nil
+}
+
+func (s *fakeStore) RestoreFile(fileID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok || !file.ExpiresAt.After(s.clock.Now()) || file.DeletedAt == nil {
+		return fmt.Errorf("file not found in trash")
+	}
+	file.DeletedAt = nil
+	return nil
+}
+
+func (s *fakeStore) PurgeTrashedFiles(before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for id, file := range s.files {
+		if file.DeletedAt == nil || !file.DeletedAt.Before(before) {
+			continue
+		}
+		if file.StoragePath != nil {
+			paths = append(paths, *file.StoragePath)
+		}
+		delete(s.files, id)
+	}
+	return paths, nil
+}
+
+func (s *fakeStore) DeleteExpiredDiskFiles() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for id, file := range s.files {
+		if file.ExpiresAt.Before(s.clock.Now()) && file.StoragePath != nil {
+			paths = append(paths, *file.StoragePath)
+			delete(s.files, id)
+		}
+	}
+	return paths, nil
+}
+
+func (s *fakeStore) CleanupExpiredData() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, file := range s.files {
+		if file.ExpiresAt.Before(s.clock.Now()) {
+			delete(s.files, id)
+		}
+	}
+	return nil
+}
+
+// The fake keeps no replication log
+func (s *fakeStore) ClearReplicationLog() error {
+	return nil
+}
+
+func (s *fakeStore) ClaimSlug(slug, fileID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if owner, ok := s.slugs[slug]; ok {
+		if file, exists := s.files[owner]; exists && file.ExpiresAt.After(s.clock.Now()) {
+			return false, nil
+		}
+	}
+	s.slugs[slug] = fileID
+	return true, nil
+}
+
+func (s *fakeStore) GetFileIDBySlug(slug string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[s.slugs[slug]]
+	if !ok || !file.ExpiresAt.After(s.clock.Now()) || file.DeletedAt != nil {
+		return "", nil
+	}
+	return file.ID, nil
+}
+
+func (s *fakeStore) UpdateFileScanResult(fileID string, result *ScanResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	copied := *result
+	file.ScanResult = &copied
+	return nil
+}
+
+func (s *fakeStore) UpdateFileExpiration(fileID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	file.ExpiresAt = expiresAt
+	return nil
+}
+
+func (s *fakeStore) UpdateFileDeletePassword(fileID string, newPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	file.DeletePassword = newPassword
+	return nil
+}
+
+func (s *fakeStore) UpdateFileDownloadPassword(fileID string, newPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	file.DownloadPassword = nil
+	if newPassword != "" {
+		file.DownloadPassword = &newPassword
+	}
+	file.HasDownloadPassword = newPassword != ""
+	return nil
+}
+
+func (s *fakeStore) UpdateFileName(fileID, filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	file.Filename = filename
+	return nil
+}
+
+func (s *fakeStore) UpdateFileAccessibility(fileID string, accessibility *Accessibility) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	if accessibility == nil {
+		file.Accessibility = nil
+		return nil
+	}
+	copied := *accessibility
+	file.Accessibility = &copied
+	return nil
+}
+
+func (s *fakeStore) ReplaceFileContent(replaced *FileStorage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[replaced.ID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	file.OriginalSize = replaced.OriginalSize
+	file.CompressedSize = replaced.CompressedSize
+	file.CompressionType = replaced.CompressionType
+	file.StorageType = replaced.StorageType
+	file.StoragePath = replaced.StoragePath
+	file.FileContent = replaced.FileContent
+	file.ContentHash = replaced.ContentHash
+	file.ImageInfo = replaced.ImageInfo
+	file.ScanResult = replaced.ScanResult
+	file.Version = replaced.Version
+	file.UpdatedAt = s.clock.Now()
+	return nil
+}
+
+func (s *fakeStore) SaveFileVersion(version *FileVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *version
+	s.versions[version.FileID] = append(s.versions[version.FileID], &stored)
+	return nil
+}
+
+func (s *fakeStore) ListFileVersions(fileID string) ([]*FileVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := make([]*FileVersion, 0)
+	for _, v := range s.versions[fileID] {
+		if v.ExpiresAt.After(s.clock.Now()) {
+			listed := *v
+			listed.FileContent = nil
+			versions = append(versions, &listed)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (s *fakeStore) GetFileVersion(fileID string, version int) (*FileVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.versions[fileID] {
+		if v.Version == version && v.ExpiresAt.After(s.clock.Now()) {
+			found := *v
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) DeleteExpiredFileVersions() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var paths []string
+	for fileID, versions := range s.versions {
+		file, exists := s.files[fileID]
+		exists = exists && file.ExpiresAt.After(s.clock.Now())
+		kept := versions[:0]
+		for _, v := range versions {
+			if exists && v.ExpiresAt.After(s.clock.Now()) {
+				kept = append(kept, v)
+			} else if v.StoragePath != nil {
+				paths = append(paths, *v.StoragePath)
+			}
+		}
+		s.versions[fileID] = kept
+	}
+	return paths, nil
+}
+
+func (s *fakeStore) UpdateFileMimeType(fileID, mimeType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[fileID]
+	if !ok {
+		return fmt.Errorf("file not found")
+	}
+	file.MimeType = mimeType
+	return nil
+}
+
+func (s *fakeStore) GetMimeTypeStats() ([]MimeTypeStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byType := make(map[string]*MimeTypeStats)
+	for _, file := range s.files {
+		if !file.ExpiresAt.After(s.clock.Now()) || file.DeletedAt != nil {
+			continue
+		}
+		entry, ok := byType[file.MimeType]
+		if !ok {
+			entry = &MimeTypeStats{MimeType: file.MimeType}
+			byType[file.MimeType] = entry
+		}
+		entry.Files++
+		entry.Bytes += file.OriginalSize
+	}
+	stats := make([]MimeTypeStats, 0, len(byType))
+	for _, entry := range byType {
+		stats = append(stats, *entry)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Files != stats[j].Files {
+			return stats[i].Files > stats[j].Files
+		}
+		return stats[i].MimeType < stats[j].MimeType
+	})
+	return stats, nil
+}
+
+func (s *fakeStore) ListActiveFiles(query FileListQuery) ([]*FileStorage, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched []*FileStorage
+	for _, file := range s.files {
+		switch {
+		case !file.ExpiresAt.After(s.clock.Now()) || file.DeletedAt != nil:
+		case query.Search != "" && !strings.Contains(strings.ToLower(file.Filename), strings.ToLower(query.Search)):
+		case query.MimeType != "" && file.MimeType != query.MimeType &&
+			!(strings.HasSuffix(query.MimeType, "/") && strings.HasPrefix(file.MimeType, query.MimeType)):
+		case query.StorageType != "" && file.StorageType != query.StorageType:
+		case query.APIKeyID != "" && (file.APIKeyID == nil || *file.APIKeyID != query.APIKeyID):
+		case query.ExpiresBefore != nil && !file.ExpiresAt.Before(*query.ExpiresBefore):
+		default:
+			copied := *file
+			copied.FileContent = nil
+			matched = append(matched, &copied)
+		}
+	}
+
+	less := func(a, b *FileStorage) bool {
+		switch query.SortBy {
+		case "filename":
+			return a.Filename < b.Filename
+		case "size":
+			return a.OriginalSize < b.OriginalSize
+		case "expires_at":
+			return a.ExpiresAt.Before(b.ExpiresAt)
+		}
+		return a.UploadTime.Before(b.UploadTime)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if !query.Ascending {
+			a, b = b, a
+		}
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.ID < b.ID
+	})
+
+	total := len(matched)
+	if query.Offset >= total {
+		return nil, total, nil
+	}
+	matched = matched[query.Offset:]
+	if len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+	}
+	return matched, total, nil
+}
+
+func (s *fakeStore) SaveChunkUpload(upload *ChunkUploadStorage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *upload
+	s.chunkUploads[upload.UploadID] = &stored
+	return nil
+}
+
+func (s *fakeStore) GetChunkUpload(uploadID string) (*ChunkUploadStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.chunkUploads[uploadID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *upload
+	return &copied, nil
+}
+
+func (s *fakeStore) DeleteChunkUpload(uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.chunkUploads, uploadID)
+	return nil
+}
+
+func (s *fakeStore) ListActiveChunkUploads() ([]*ChunkUploadStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var uploads []*ChunkUploadStorage
+	for _, upload := range s.chunkUploads {
+		if upload.ExpiresAt.After(s.clock.Now()) {
+			copied := *upload
+			uploads = append(uploads, &copied)
+		}
+	}
+	return uploads, nil
+}
+
+func (s *fakeStore) SaveProcessingJob(job *ProcessingJobStorage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *job
+	s.jobs[job.JobID] = &stored
+	return nil
+}
+
+func (s *fakeStore) GetProcessingJob(jobID string) (*ProcessingJobStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (s *fakeStore) CreateAPIKey(key *APIKeyStorage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *key
+	s.apiKeys[key.ID] = &stored
+	return nil
+}
+
+// findAPIKey returns a copy of the first key matching; the caller holds s.mu
+func (s *fakeStore) findAPIKey(match func(*APIKeyStorage) bool) *APIKeyStorage {
+	for _, key := range s.apiKeys {
+		if match(key) {
+			copied := *key
+			return &copied
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) GetAPIKey(keyID string) (*APIKeyStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findAPIKey(func(key *APIKeyStorage) bool { return key.ID == keyID }), nil
+}
+
+func (s *fakeStore) AddBandwidthUsage(usage []BandwidthUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bandwidth = append(s.bandwidth, usage...)
+	for range usage {
+		s.bandwidthAt = append(s.bandwidthAt, s.clock.Now())
+	}
+	return nil
+}
+
+func (s *fakeStore) DeleteUsageBefore(cutoff, ipCutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var bandwidth []BandwidthUsage
+	var bandwidthAt []time.Time
+	for i, usage := range s.bandwidth {
+		at := s.bandwidthAt[i]
+		switch {
+		case usage.SubjectType == "file" && at.Before(cutoff):
+			continue
+		case usage.SubjectType == "key" && at.Before(cutoff), usage.SubjectType == "ip" && at.Before(ipCutoff):
+			usage.SubjectID = ""
+		}
+		bandwidth = append(bandwidth, usage)
+		bandwidthAt = append(bandwidthAt, at)
+	}
+	s.bandwidth, s.bandwidthAt = bandwidth, bandwidthAt
+
+	var records []UsageRecord
+	for _, record := range s.usage {
+		if !record.Hour.Before(cutoff) {
+			records = append(records, record)
+		}
+	}
+	s.usage = records
+	return nil
+}
+
+func (s *fakeStore) GetFileBandwidth(fileID string) ([]MonthlyBandwidth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bytes := make(map[string]int64)
+	for _, usage := range s.bandwidth {
+		if usage.SubjectType == "file" && usage.SubjectID == fileID {
+			bytes[egressPeriod(usage.Period)] += usage.Bytes
+		}
+	}
+	months := make([]MonthlyBandwidth, 0, len(bytes))
+	for period, n := range bytes {
+		months = append(months, MonthlyBandwidth{Period: period, Bytes: n})
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Period > months[j].Period })
+	return months, nil
+}
+
+func (s *fakeStore) GetServiceStats() (*ServiceStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := &ServiceStats{}
+	for _, file := range s.files {
+		if file.ExpiresAt.After(s.clock.Now()) && file.DeletedAt == nil {
+			stats.ActiveFiles++
+		}
+	}
+	for _, usage := range s.bandwidth {
+		if usage.SubjectType == "key" || usage.SubjectType == "ip" {
+			stats.BytesServed += usage.Bytes
+		}
+	}
+	return stats, nil
+}
+
+func (s *fakeStore) GetAPIKeyUsage(keyID string) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int
+	var size int64
+	for _, file := range s.files {
+		if file.APIKeyID != nil && *file.APIKeyID == keyID && file.ExpiresAt.After(s.clock.Now()) {
+			count++
+			size += file.OriginalSize
+		}
+	}
+	return count, size, nil
+}
+
+func (s *fakeStore) GetUploaderIPUsage(ipAddress string) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int
+	var size int64
+	for _, file := range s.files {
+		if file.UploaderIP != nil && *file.UploaderIP == ipAddress && file.APIKeyID == nil && file.ExpiresAt.After(s.clock.Now()) {
+			count++
+			size += file.OriginalSize
+		}
+	}
+	return count, size, nil
+}
+
+func (s *fakeStore) GetAPIKeyByHash(keyHash string) (*APIKeyStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findAPIKey(func(key *APIKeyStorage) bool { return key.KeyHash == keyHash }), nil
+}
+
+func (s *fakeStore) GetAPIKeyByCertIdentity(identities []string) (*APIKeyStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findAPIKey(func(key *APIKeyStorage) bool {
+		for _, identity := range identities {
+			if key.ClientCertIdentity != nil && *key.ClientCertIdentity == identity {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (s *fakeStore) TouchAPIKey(keyID string) error {
+	return nil
+}
+
+func (s *fakeStore) ListAPIKeys() ([]*APIKeyStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*APIKeyStorage, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (s *fakeStore) UpdateAPIKey(key *APIKeyStorage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.apiKeys[key.ID] == nil {
+		return fmt.Errorf("API key not found")
+	}
+	stored := *key
+	s.apiKeys[key.ID] = &stored
+	return nil
+}
+
+func (s *fakeStore) RevokeAPIKey(keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.apiKeys[keyID]
+	if key == nil || key.RevokedAt != nil {
+		return fmt.Errorf("API key not found")
+	}
+	now := s.clock.Now()
+	key.RevokedAt = &now
+	return nil
+}
+
+func (s *fakeStore) CreateOrg(org *Org) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *org
+	s.orgs[org.ID] = &stored
+	return nil
+}
+
+func (s *fakeStore) GetOrg(orgID string) (*Org, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	org, ok := s.orgs[orgID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *org
+	return &copied, nil
+}
+
+func (s *fakeStore) UpdateOrg(org *Org) error {
+	return s.CreateOrg(org)
+}
+
+func (s *fakeStore) ListOrgs() ([]*Org, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orgs := make([]*Org, 0, len(s.orgs))
+	for _, org := range s.orgs {
+		copied := *org
+		orgs = append(orgs, &copied)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Name < orgs[j].Name })
+	return orgs, nil
+}
+
+func (s *fakeStore) DeleteOrg(orgID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.orgs[orgID] == nil {
+		return fmt.Errorf("org not found")
+	}
+	delete(s.orgs, orgID)
+	for _, key := range s.apiKeys {
+		if key.OrgID != nil && *key.OrgID == orgID {
+			key.OrgID = nil
+		}
+	}
+	for _, file := range s.files {
+		if file.OrgID != nil && *file.OrgID == orgID {
+			file.OrgID = nil
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) GetOrgUsage(orgID string) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int
+	var size int64
+	for _, file := range s.files {
+		if file.OrgID != nil && *file.OrgID == orgID && file.ExpiresAt.After(s.clock.Now()) {
+			count++
+			size += file.OriginalSize
+		}
+	}
+	return count, size, nil
+}
+
+func (s *fakeStore) GetStoredBytesByAPIKey() (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := make(map[string]int64)
+	for _, file := range s.files {
+		if file.APIKeyID != nil && file.ExpiresAt.After(s.clock.Now()) {
+			stored[*file.APIKeyID] += file.OriginalSize
+		}
+	}
+	return stored, nil
+}
+
+func (s *fakeStore) AddUsageRecords(records []UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage = append(s.usage, records...)
+	return nil
+}
+
+func (s *fakeStore) LogFileAccess(fileID, accessType, ipAddress, userAgent string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accesses[fileID] = append(s.accesses[fileID], FileAccess{
+		AccessType: accessType,
+		IPAddress:  &ipAddress,
+		UserAgent:  &userAgent,
+		AccessTime: s.clock.Now(),
+	})
+	return nil
+}
+
+func (s *fakeStore) GetFileAccessCounts(fileID string) (*FileAccessCounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := &FileAccessCounts{}
+	ips := make(map[string]bool)
+	for _, access := range s.accesses[fileID] {
+		switch access.AccessType {
+		case "download":
+			counts.Downloads++
+		case "preview":
+			counts.Previews++
+		case "stream":
+			counts.Streams++
+		}
+		ips[*access.IPAddress] = true
+		at := access.AccessTime
+		counts.LastAccessAt = &at
+	}
+	counts.UniqueIPs = int64(len(ips))
+	return counts, nil
+}
+
+func (s *fakeStore) GetFileAccessDaily(fileID string) ([]DailyFileAccesses, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	days := make([]DailyFileAccesses, 0)
+	for _, access := range s.accesses[fileID] {
+		date := access.AccessTime.UTC().Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, DailyFileAccesses{Date: date})
+		}
+		day := &days[len(days)-1]
+		switch access.AccessType {
+		case "download":
+			day.Downloads++
+		case "preview":
+			day.Previews++
+		case "stream":
+			day.Streams++
+		}
+	}
+	return days, nil
+}
+
+func (s *fakeStore) ListFileAccesses(fileID string, limit int) ([]FileAccess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accesses := make([]FileAccess, 0)
+	for i := len(s.accesses[fileID]) - 1; i >= 0 && len(accesses) < limit; i-- {
+		accesses = append(accesses, s.accesses[fileID][i])
+	}
+	return accesses, nil
+}
+
+func (s *fakeStore) AddFileEvent(fileID, eventType string, details interface{}, ipAddress string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	detailsJSON, _ := json.Marshal(details)
+	s.events = append(s.events, FileEvent{
+		ID:        int64(len(s.events) + 1),
+		FileID:    fileID,
+		Type:      eventType,
+		Details:   detailsJSON,
+		IPAddress: &ipAddress,
+		CreatedAt: s.clock.Now(),
+	})
+	return nil
+}
+
+func (s *fakeStore) ListAPIKeyFileEvents(keyID string, eventTypes []string, limit int) ([]FileEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]FileEvent, 0)
+	for i := len(s.events) - 1; i >= 0 && len(events) < limit; i-- {
+		event := s.events[i]
+		file, ok := s.files[event.FileID]
+		if !ok || file.APIKeyID == nil || *file.APIKeyID != keyID {
+			continue
+		}
+		if len(eventTypes) > 0 && !containsString(eventTypes, event.Type) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
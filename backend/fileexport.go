@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-storage-service/internal/files"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Exports stream every file matching the file list filters as CSV or JSON, for auditing
+// and reporting offline. Admins export all files; API key holders export their own.
+
+// fileExportBatch is how many files are read from the database at a time
+const fileExportBatch = 500
+
+// FileExportRequest exports the admin file list with its filters applied. Limit and
+// offset are ignored: all matching files are exported.
+type FileExportRequest struct {
+	AdminFileListRequest
+	Format string `json:"format,omitempty"` // csv (default) or json
+}
+
+// FileExportRow is one exported file
+type FileExportRow struct {
+	FileID         string    `json:"file_id"`
+	Filename       string    `json:"filename"`
+	MimeType       string    `json:"mime_type"`
+	Size           int64     `json:"size"`
+	CompressedSize int64     `json:"compressed_size"`
+	Compression    string    `json:"compression"`
+	StorageType    string    `json:"storage_type"`
+	StoragePath    string    `json:"storage_path,omitempty"` // Admin exports only
+	UploadedAt     time.Time `json:"uploaded_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	HasPassword    bool      `json:"has_password"`
+}
+
+func newFileExportRow(file *FileStorage, admin bool) FileExportRow {
+	row := FileExportRow{
+		FileID:      file.ID,
+		Filename:    file.Filename,
+		MimeType:    file.MimeType,
+		Size:        file.OriginalSize,
+		Compression: file.CompressionType,
+		StorageType: file.StorageType,
+		UploadedAt:  file.UploadTime.UTC(),
+		ExpiresAt:   file.ExpiresAt.UTC(),
+		HasPassword: file.HasDownloadPassword,
+	}
+	if file.CompressedSize != nil {
+		row.CompressedSize = *file.CompressedSize
+	}
+	if admin && file.StoragePath != nil {
+		row.StoragePath = *file.StoragePath
+	}
+	return row
+}
+
+// fileExportHeader names the CSV columns of an export
+func fileExportHeader(admin bool) []string {
+	header := []string{"file_id", "filename", "mime_type", "size", "compressed_size", "compression",
+		"storage_type", "uploaded_at", "expires_at", "has_password"}
+	if admin {
+		header = append(header, "storage_path")
+	}
+	return header
+}
+
+// record returns the CSV columns of the row
+func (row FileExportRow) record(admin bool) []string {
+	record := []string{
+		row.FileID,
+		spreadsheetSafe(row.Filename),
+		row.MimeType,
+		strconv.FormatInt(row.Size, 10),
+		strconv.FormatInt(row.CompressedSize, 10),
+		row.Compression,
+		row.StorageType,
+		row.UploadedAt.Format(time.RFC3339),
+		row.ExpiresAt.Format(time.RFC3339),
+		strconv.FormatBool(row.HasPassword),
+	}
+	if admin {
+		record = append(record, row.StoragePath)
+	}
+	return record
+}
+
+// spreadsheetSafe keeps an uploaded filename from being run as a formula when the export
+// is opened in a spreadsheet
+func spreadsheetSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// exportAdminFiles streams the admin file list
+//
+// @summary Export the file list
+// @tags admin
+// @body json FileExportRequest optional
+// @success 200 text/csv application/json
+// @auth adminToken adminPassword
+func (s *FileService) exportAdminFiles(c *gin.Context) {
+	var req FileExportRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	query, err := req.query()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.exportFiles(c, query, req.Format, "files", true)
+}
+
+// exportOwnFiles streams the files uploaded with the request's API key, filtered by the
+// search, mime_type, storage_type, sort and order query parameters of the admin file list
+//
+// @summary Export the files of the caller's API key
+// @tags account
+// @query search string Filter by name
+// @query mime_type string Filter by MIME type
+// @query storage_type string Filter by storage type
+// @query sort string Field to sort by
+// @query order string asc or desc
+// @query format string csv or json
+// @success 200 text/csv application/json
+// @auth apiKey
+func (s *FileService) exportOwnFiles(c *gin.Context) {
+	apiKey := apiKeyFromContext(c)
+	if apiKey == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "An API key is required to export your files"})
+		return
+	}
+
+	req := AdminFileListRequest{
+		Search:      c.Query("search"),
+		MimeType:    c.Query("mime_type"),
+		StorageType: c.Query("storage_type"),
+		Sort:        c.Query("sort"),
+		Order:       c.Query("order"),
+	}
+	query, err := req.query()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query.APIKeyID = apiKey.ID
+	s.exportFiles(c, query, c.Query("format"), "my-files", false)
+}
+
+// exportFiles writes all files matching the query as an attachment. Failures after the
+// first batch can only be logged, leaving the export truncated.
+func (s *FileService) exportFiles(c *gin.Context, query FileListQuery, format, name string, admin bool) {
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	query.Limit = fileExportBatch
+	query.Offset = 0
+	batch, _, err := s.db.ListActiveFiles(query)
+	if err != nil {
+		log.Printf("Failed to export files: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve file list from database"})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", name, s.clock.Now().UTC().Format("20060102"), format)
+	c.Header("Content-Disposition", files.ContentDisposition("attachment", filename))
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		csvWriter.Write(fileExportHeader(admin))
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		c.Writer.WriteString("[")
+	}
+
+	exported := 0
+	for {
+		for _, file := range batch {
+			row := newFileExportRow(file, admin)
+			if format == "csv" {
+				err = csvWriter.Write(row.record(admin))
+			} else {
+				if exported > 0 {
+					c.Writer.WriteString(",")
+				}
+				err = encoder.Encode(row)
+			}
+			if err != nil {
+				log.Printf("Failed to write file export after %d files: %v", exported, err)
+				return
+			}
+			exported++
+		}
+		csvWriter.Flush()
+		c.Writer.Flush()
+
+		if len(batch) < fileExportBatch {
+			break
+		}
+		query.Offset += len(batch)
+		if batch, _, err = s.db.ListActiveFiles(query); err != nil {
+			log.Printf("Failed to export files after %d files: %v", exported, err)
+			return
+		}
+	}
+
+	if format == "json" {
+		c.Writer.WriteString("]")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileExport(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	key := &APIKeyStorage{ID: "key-1"}
+	ts.store.CreateAPIKey(key)
+	for _, id := range []string{"a", "b", "c"} {
+		ts.saveTestFile(t, id, "content", time.Hour)
+		ts.clock.Advance(time.Minute)
+	}
+	owned, _ := ts.store.GetFile("b")
+	owned.Filename = "=HYPERLINK(1).txt"
+	owned.APIKeyID = &key.ID
+	ts.store.SaveFile(owned)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/files/export", strings.NewReader(`{"order":"asc","limit":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(ts.exportAdminFiles, req)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("admin export: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0][0] != "file_id" || records[0][len(records[0])-1] != "storage_path" {
+		t.Fatalf("records = %q", records)
+	}
+	if records[1][0] != "a" || records[2][1] != "'=HYPERLINK(1).txt" {
+		t.Errorf("rows = %q", records[1:])
+	}
+
+	w = ts.serve(ts.exportOwnFiles, httptest.NewRequest(http.MethodGet, "/api/files/export", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous export: got %d, want 401", w.Code)
+	}
+
+	w = ts.serve(asKey(key, ts.exportOwnFiles), httptest.NewRequest(http.MethodGet, "/api/files/export?format=json", nil))
+	var rows []FileExportRow
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("own export: %v: %s", err, w.Body.String())
+	}
+	if len(rows) != 1 || rows[0].FileID != "b" || rows[0].Filename != "=HYPERLINK(1).txt" || rows[0].StoragePath != "" {
+		t.Errorf("own export = %+v", rows)
+	}
+
+	w = ts.serve(asKey(key, ts.exportOwnFiles), httptest.NewRequest(http.MethodGet, "/api/files/export?format=xml", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Files are identified by UUIDs unless FILE_ID_SCHEME asks for short Base58 IDs, which
+// make shared links shorter and easier to read out. Base58 leaves out 0, O, I and l, so
+// no two characters look alike. Short IDs are random, so they are checked against
+// existing files and drawn again on a collision. Files keep the ID they were given, and
+// links to UUIDs keep working whatever the scheme.
+
+const (
+	FileIDSchemeUUID   = "uuid"
+	FileIDSchemeBase58 = "base58"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Bounds of FILE_ID_LENGTH. Below the minimum, collisions get likely enough to make IDs
+// guessable; the maximum fits the 36 characters of the id columns.
+const (
+	minShortFileIDLength = 6
+	maxShortFileIDLength = 36
+)
+
+// maxFileIDAttempts is how many short IDs are drawn before giving up on finding a free one
+const maxFileIDAttempts = 5
+
+// checkFileIDScheme validates FILE_ID_SCHEME and, for short IDs, FILE_ID_LENGTH
+func checkFileIDScheme(config *Config) error {
+	switch config.FileIDScheme {
+	case FileIDSchemeUUID:
+		return nil
+	case FileIDSchemeBase58:
+		if config.FileIDLength < minShortFileIDLength || config.FileIDLength > maxShortFileIDLength {
+			return fmt.Errorf("FILE_ID_LENGTH must be between %d and %d, got %d", minShortFileIDLength, maxShortFileIDLength, config.FileIDLength)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown FILE_ID_SCHEME %q, expected uuid or base58", config.FileIDScheme)
+}
+
+// generateFileID returns a file ID in the configured scheme, without checking whether it
+// is taken
+func generateFileID(config *Config) string {
+	if config.FileIDScheme != FileIDSchemeBase58 {
+		return generateID()
+	}
+
+	id := make([]byte, 0, config.FileIDLength)
+	buf := make([]byte, config.FileIDLength*2)
+	for len(id) < config.FileIDLength {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("crypto/rand failed: %v", err))
+		}
+		for _, b := range buf {
+			// 232 is the largest multiple of 58 in a byte; rejecting above it keeps
+			// every character equally likely
+			if b < 232 && len(id) < config.FileIDLength {
+				id = append(id, base58Alphabet[b%58])
+			}
+		}
+	}
+	return string(id)
+}
+
+// newFileID returns an unused file ID for a file about to be stored. UUIDs don't
+// collide in practice and aren't checked.
+func newFileID(config *Config, db ChunkStore) (string, error) {
+	if config.FileIDScheme != FileIDSchemeBase58 {
+		return generateFileID(config), nil
+	}
+	for attempt := 0; attempt < maxFileIDAttempts; attempt++ {
+		id := generateFileID(config)
+		exists, err := db.FileIDExists(id)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no free file ID after %d attempts; raise FILE_ID_LENGTH", maxFileIDAttempts)
+}
+
+// isShortFileID reports whether id could be a Base58 ID of the configured length
+func isShortFileID(config *Config, id string) bool {
+	if config.FileIDScheme != FileIDSchemeBase58 || len(id) != config.FileIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune(base58Alphabet, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// allocateFileID returns an unused file ID for an upload, or writes the error response
+// and returns false
+func (s *FileService) allocateFileID(c *gin.Context) (string, bool) {
+	fileID, err := s.nextFileID()
+	if err != nil {
+		err.respond(c)
+		return "", false
+	}
+	return fileID, true
+}
+
+// nextFileID is allocateFileID, returning the error instead of writing it
+func (s *FileService) nextFileID() (string, *apiError) {
+	fileID, err := newFileID(s.config, s.db)
+	if err != nil {
+		log.Printf("Failed to allocate a file ID: %v", err)
+		return "", newAPIError(http.StatusInternalServerError, "Failed to save file")
+	}
+	return fileID, nil
+}
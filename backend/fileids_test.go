@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestGenerateFileID(t *testing.T) {
+	config := &Config{FileIDScheme: FileIDSchemeUUID, FileIDLength: 10}
+	if _, err := uuid.Parse(generateFileID(config)); err != nil {
+		t.Errorf("uuid scheme: %v", err)
+	}
+
+	config.FileIDScheme = FileIDSchemeBase58
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := generateFileID(config)
+		if !isShortFileID(config, id) {
+			t.Fatalf("%q isn't a short ID of 10 characters", id)
+		}
+		if seen[id] {
+			t.Fatalf("%q drawn twice", id)
+		}
+		seen[id] = true
+	}
+	for _, id := range []string{"abc", "0OIl0OIl0O", "3xK9abQ2zP!"} {
+		if isShortFileID(config, id) {
+			t.Errorf("%q taken for a short ID", id)
+		}
+	}
+}
+
+func TestCheckFileIDScheme(t *testing.T) {
+	for _, tc := range []struct {
+		scheme string
+		length int
+		ok     bool
+	}{
+		{"uuid", 0, true},
+		{"base58", 10, true},
+		{"base58", 5, false},
+		{"base58", 37, false},
+		{"ulid", 10, false},
+	} {
+		err := checkFileIDScheme(&Config{FileIDScheme: tc.scheme, FileIDLength: tc.length})
+		if (err == nil) != tc.ok {
+			t.Errorf("%s of %d: got %v", tc.scheme, tc.length, err)
+		}
+	}
+}
+
+// collidingStore reports the first taken IDs it is asked about as existing
+type collidingStore struct {
+	ChunkStore
+	taken int
+	asked int
+}
+
+func (s *collidingStore) FileIDExists(fileID string) (bool, error) {
+	s.asked++
+	return s.asked <= s.taken, nil
+}
+
+func TestNewFileIDRetriesCollisions(t *testing.T) {
+	config := &Config{FileIDScheme: FileIDSchemeBase58, FileIDLength: 8}
+
+	store := &collidingStore{taken: 2}
+	id, err := newFileID(config, store)
+	if err != nil || len(id) != 8 || store.asked != 3 {
+		t.Errorf("got %q, %v after %d checks, want an ID after 3", id, err, store.asked)
+	}
+
+	store = &collidingStore{taken: maxFileIDAttempts}
+	if _, err := newFileID(config, store); err == nil {
+		t.Error("no error with every ID taken")
+	}
+}
+
+func TestUploadWithShortFileID(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.FileIDScheme = FileIDSchemeBase58
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("short links"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := ts.serve(ts.uploadFile, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		FileID string `json:"file_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !isShortFileID(ts.config, resp.FileID) {
+		t.Fatalf("file_id = %q, want a short ID", resp.FileID)
+	}
+
+	// The file page of a short ID isn't taken for a slug
+	w = ts.serve(ts.resolveSlug, httptest.NewRequest(http.MethodGet, "/f/"+resp.FileID, nil), gin.Param{Key: "slug", Value: resp.FileID})
+	if w.Code == http.StatusFound {
+		t.Errorf("file page redirected to %q", w.Header().Get("Location"))
+	}
+}
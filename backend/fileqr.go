@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+	"file-storage-service/internal/qr"
+)
+
+// Default and bounds of the width of a QR code PNG, in pixels
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+// getFileQR renders a QR code of a file's download URL on PUBLIC_URL, as a PNG or, with
+// format=svg, an SVG. With embed_password=true the URL carries the download password of a
+// protected file, which the request must give as password, so scanning downloads the file
+// directly.
+//
+// @summary Render a QR code of a file's download URL
+// @tags file
+// @path id File ID
+// @query format string svg for an SVG instead of a PNG
+// @query level string Error correction level: L, M, Q or H
+// @query size integer Width of the PNG in pixels
+// @query embed_password boolean Put the download password in the URL
+// @success 200 image/png image/svg+xml
+// @auth downloadPassword adminToken optional
+func (s *FileService) getFileQR(c *gin.Context) {
+	format := c.DefaultQuery("format", "png")
+	if format != "png" && format != "svg" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be png or svg"})
+		return
+	}
+	level, err := qr.ParseLevel(c.DefaultQuery("level", "M"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level must be L, M, Q or H"})
+		return
+	}
+	size := defaultQRSize
+	if value := c.Query("size"); value != "" {
+		size, err = strconv.Atoi(value)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be a number of pixels from 64 to 2048"})
+			return
+		}
+	}
+
+	fileID := c.Param("id")
+	fileStorage, err := s.lookupFile(fileID, false)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found or expired"})
+		return
+	}
+
+	link := strings.TrimSuffix(s.publicBaseURL(c), "/") + "/api/file/" + url.PathEscape(fileStorage.ID)
+	if c.Query("embed_password") == "true" && fileStorage.HasDownloadPassword {
+		// Only the password itself can go into the code, so an admin token won't do
+		password := c.Query("password")
+		if !files.CanDownload(true, fileStorage.DownloadPassword, files.Credentials{Password: password}, nil) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Password required",
+				"message": "Embedding the password requires the file's download password.",
+			})
+			return
+		}
+		link += "?" + url.Values{"password": {password}}.Encode()
+	}
+
+	code, err := qr.Encode(link, level)
+	if errors.Is(err, qr.ErrTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The link is too long for a QR code at this level; try level=L"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to encode QR code of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+
+	// A code with a password in it must not end up in shared caches
+	if strings.Contains(link, "password=") {
+		c.Header("Cache-Control", "private, no-store")
+	} else {
+		c.Header("Cache-Control", "public, max-age=3600")
+	}
+
+	name := fileStorage.Filename + "-qr." + format
+	c.Header("Content-Disposition", files.ContentDisposition("inline", name))
+	if format == "svg" {
+		c.Data(http.StatusOK, "image/svg+xml", []byte(code.SVG()))
+		return
+	}
+
+	// Whole pixels per module, as close to the requested width as they get
+	scale := max(1, size/(code.Size+2*qr.QuietZone))
+	image, err := code.PNG(scale)
+	if err != nil {
+		log.Printf("Failed to render QR code of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render QR code"})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", image)
+}
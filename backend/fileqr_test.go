@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/qr"
+)
+
+func TestFileQR(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.PublicURL = "https://one.example"
+	ts.saveTestFile(t, "poster", "content", time.Hour)
+	file, _ := ts.store.GetFileMetadata("poster")
+	password := "s3cret"
+	file.HasDownloadPassword = true
+	file.DownloadPassword = &password
+	ts.store.SaveFile(file)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/file/poster/qr"+query, nil)
+		return ts.serve(ts.getFileQR, req, gin.Param{Key: "id", Value: "poster"})
+	}
+	svgOf := func(text string) string {
+		code, err := qr.Encode(text, qr.Medium)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code.SVG()
+	}
+
+	w := get("?format=svg")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("svg: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Body.String() != svgOf("https://one.example/api/file/poster") {
+		t.Error("svg doesn't encode the download URL")
+	}
+
+	w = get("?format=svg&embed_password=true&password=s3cret")
+	if w.Code != http.StatusOK || w.Body.String() != svgOf("https://one.example/api/file/poster?password=s3cret") {
+		t.Errorf("embedded password: got %d, or the code doesn't carry the password", w.Code)
+	}
+	if w.Header().Get("Cache-Control") != "private, no-store" {
+		t.Errorf("embedded password: Cache-Control = %q", w.Header().Get("Cache-Control"))
+	}
+	if w := get("?embed_password=true&password=wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got %d, want 401", w.Code)
+	}
+	if w := get("?embed_password=true&password=s3cre"); w.Code != http.StatusUnauthorized {
+		t.Errorf("password prefix: got %d, want 401", w.Code)
+	}
+	token, _, err := ts.adminTokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get("?embed_password=true&admin_token=" + token); w.Code != http.StatusUnauthorized {
+		t.Errorf("admin token instead of the password: got %d, want 401", w.Code)
+	}
+
+	w = get("?size=300")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("png: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "https://one.example/api/file/poster" is version 3 at M: 29 modules and the quiet zone
+	if got := img.Bounds().Dx(); got != 37*8 {
+		t.Errorf("width = %d, want %d", got, 37*8)
+	}
+
+	for _, query := range []string{"?format=gif", "?level=X", "?size=10", "?size=big"} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, w.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/file/missing/qr", nil)
+	if w := ts.serve(ts.getFileQR, req, gin.Param{Key: "id", Value: "missing"}); w.Code != http.StatusNotFound {
+		t.Errorf("missing file: got %d, want 404", w.Code)
+	}
+}
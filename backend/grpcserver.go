@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"file-storage-service/internal/files"
+	"file-storage-service/internal/onepb"
+)
+
+// grpcDownloadChunkSize is the most content sent in one DownloadResponse
+const grpcDownloadChunkSize = 256 * 1024
+
+// grpcFiles implements the Files service. Calls run the same service operations as their
+// REST counterparts, so both APIs share their access checks, limits and quotas.
+type grpcFiles struct {
+	onepb.UnimplementedFilesServer
+	service *FileService
+}
+
+// grpcAdmin implements the Admin service
+type grpcAdmin struct {
+	onepb.UnimplementedAdminServer
+	service *FileService
+}
+
+// newGRPCServer prepares the gRPC listener at GRPC_ADDR, with the TLS certificate of the
+// API listener when there is one. The admin service is left out when the admin API has
+// its own listener, like the admin routes are.
+func newGRPCServer(service *FileService) (*grpc.Server, error) {
+	var options []grpc.ServerOption
+	tlsConfig, err := apiTLSConfig(service.config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(options...)
+	onepb.RegisterFilesServer(server, &grpcFiles{service: service})
+	if service.config.AdminAddr == "" {
+		onepb.RegisterAdminServer(server, &grpcAdmin{service: service})
+	}
+	return server, nil
+}
+
+// serveGRPC runs the gRPC listener until it fails
+func serveGRPC(server *grpc.Server, addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("gRPC listener failed: %v", err)
+	}
+	log.Printf("gRPC listener starting on %s", addr)
+	log.Fatalf("gRPC listener stopped: %v", server.Serve(listener))
+}
+
+// grpcMetadataValue returns the first value of a metadata key of a call
+func grpcMetadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcBearerToken returns the admin token of a call's authorization metadata
+func grpcBearerToken(ctx context.Context) string {
+	return parseBearerToken(grpcMetadataValue(ctx, "authorization"))
+}
+
+// grpcCaller authenticates a call like apiKeyMiddleware, by its x-api-key metadata or a
+// client certificate mapped to an API key, and counts it against the rate limit of the
+// key or else of the peer's address, which is refused when blocked for abuse
+func (s *FileService) grpcCaller(ctx context.Context) (caller, error) {
+	who := caller{userAgent: grpcMetadataValue(ctx, "user-agent")}
+	var identities []string
+	if p, ok := peer.FromContext(ctx); ok {
+		who.clientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(who.clientIP); err == nil {
+			who.clientIP = host
+		}
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			identities = clientCertIdentities(&info.State)
+		}
+	}
+
+	key, apiErr := s.authenticateAPIKey(grpcMetadataValue(ctx, "x-api-key"), identities)
+	if apiErr != nil {
+		return who, s.grpcError(ctx, who, apiErr)
+	}
+	if key != nil {
+		if _, apiErr := s.chargeAPIKey(key); apiErr != nil {
+			return who, s.grpcError(ctx, who, apiErr)
+		}
+		who.apiKey = key
+		return who, nil
+	}
+
+	limit := ipRateLimit
+	if s.config.AbuseDetection {
+		throttled, apiErr := s.checkAbuse(who.clientIP)
+		if apiErr != nil {
+			return who, s.grpcError(ctx, who, apiErr)
+		}
+		if throttled {
+			limit /= 4
+		}
+	}
+	if apiErr := s.rateLimiter.admit(who.clientIP, limit); apiErr != nil {
+		return who, s.grpcError(ctx, who, apiErr)
+	}
+	return who, nil
+}
+
+// grpcError turns the error of an operation into a gRPC status with its message, passing
+// the Retry-After and error code of throttled calls on as trailers. Like abuseMiddleware,
+// it counts the not found answers of anonymous callers toward their abuse score.
+func (s *FileService) grpcError(ctx context.Context, who caller, err *apiError) error {
+	retryCode, retryAfter := err.code, err.retryAfter
+	if retryAfter == 0 && (err.status == http.StatusTooManyRequests || err.status == http.StatusServiceUnavailable) {
+		retryCode, retryAfter = defaultRetryErrorCode(err.status), retryAfterBusy
+	}
+	if retryAfter > 0 {
+		grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(retryAfterSeconds(retryAfter)), "x-error-code", retryCode))
+	}
+	if err.status == http.StatusNotFound && who.apiKey == nil && s.config.AbuseDetection {
+		s.countNotFound(who.clientIP)
+	}
+	return status.Error(grpcCode(err.status), err.Error())
+}
+
+// grpcCode maps an HTTP status to the closest gRPC code
+func grpcCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed, http.StatusUnprocessableEntity, http.StatusUnsupportedMediaType:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if code >= 500 {
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// grpcUploadReader reads the content of an upload stream, counting the bytes
+type grpcUploadReader struct {
+	stream  onepb.Files_UploadServer
+	pending []byte
+	read    int64
+}
+
+func (r *grpcUploadReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		msg, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if msg.GetInfo() != nil {
+			return 0, status.Error(codes.InvalidArgument, "UploadInfo may only be sent first")
+		}
+		r.pending = msg.GetChunk()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	r.read += int64(n)
+	return n, nil
+}
+
+// checkSize reports content that doesn't match the size the UploadInfo announced
+func (r *grpcUploadReader) checkSize(size int64) error {
+	if r.read > size {
+		return status.Errorf(codes.InvalidArgument, "received more than the %d bytes UploadInfo announced", size)
+	}
+	if r.read != size {
+		return status.Errorf(codes.InvalidArgument, "received %d bytes, but UploadInfo announced %d", r.read, size)
+	}
+	return nil
+}
+
+// grpcMetadata converts file metadata to its message
+func grpcMetadata(metadata *FileMetadata) *onepb.FileMetadata {
+	return &onepb.FileMetadata{
+		Id:                  metadata.ID,
+		Filename:            metadata.Filename,
+		Size:                metadata.Size,
+		CompressedSize:      metadata.CompressedSize,
+		MimeType:            metadata.MimeType,
+		Compression:         string(metadata.Compression),
+		UploadTime:          timestamppb.New(metadata.UploadTime),
+		ExpiresAt:           timestamppb.New(metadata.ExpiresAt),
+		DeletePassword:      metadata.DeletePassword,
+		HasDownloadPassword: metadata.HasDownloadPassword,
+		Sha256:              metadata.SHA256,
+		StorageClass:        string(metadata.StorageClass),
+	}
+}
+
+// Upload stores a streamed file like /api/upload, or like a chunked upload when it is
+// larger than CHUNK_THRESHOLD
+func (f *grpcFiles) Upload(stream onepb.Files_UploadServer) error {
+	ctx := stream.Context()
+	s := f.service
+	who, err := s.grpcCaller(ctx)
+	if err != nil {
+		return err
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if info == nil || info.Filename == "" || info.Size < 0 {
+		return status.Error(codes.InvalidArgument, "the first message must be an UploadInfo with the filename and size")
+	}
+	content := &grpcUploadReader{stream: stream}
+	if info.Size > s.config.ChunkThreshold {
+		return f.uploadChunked(stream, who, info, content)
+	}
+
+	release, apiErr := s.uploadSlot(ctx, info.Size)
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	defer release()
+
+	filename := files.NormalizeName(info.Filename)
+	if apiErr := extensionPolicyError(s.config, filename, info.Size); apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	if apiErr := s.orgPolicyError(who.apiKey, filename, info.DownloadPassword != ""); apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	if apiErr := s.uploadQuotaError(who, info.Size); apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	storageClass, apiErr := s.storageClassFor(info.StorageClass, who.apiKey)
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	slug, apiErr := s.requestedSlug(info.Slug, "")
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+
+	// Read one byte past the announced size to tell when the client sends more
+	hasher := sha256.New()
+	data, err := io.ReadAll(io.TeeReader(io.LimitReader(content, info.Size+1), hasher))
+	if err != nil {
+		return err
+	}
+	if err := content.checkSize(info.Size); err != nil {
+		return err
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	if apiErr := contentHashError(filename, info.FileHash, contentHash); apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+
+	response, apiErr := s.storeContent(who, filename, data, contentHash, info.DownloadPassword, storageClass, slug, nil, nil)
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	return stream.SendAndClose(&onepb.UploadResponse{
+		FileId:   response.FileID,
+		Sha256:   response.SHA256,
+		Metadata: grpcMetadata(response.Metadata),
+		SlugUrl:  response.SlugURL,
+	})
+}
+
+// uploadChunked stores the content of a large upload as the chunks of a chunked upload,
+// answering with the job assembling them
+func (f *grpcFiles) uploadChunked(stream onepb.Files_UploadServer, who caller, info *onepb.UploadInfo, content *grpcUploadReader) error {
+	ctx := stream.Context()
+	s := f.service
+	if info.Slug != "" {
+		return status.Error(codes.InvalidArgument, "files larger than CHUNK_THRESHOLD can't have a slug")
+	}
+
+	upload, apiErr := s.chunkManager.startUpload(&InitiateUploadRequest{
+		Filename:         info.Filename,
+		TotalSize:        info.Size,
+		ChunkSize:        s.config.ChunkSize,
+		FileHash:         info.FileHash,
+		DownloadPassword: info.DownloadPassword,
+		StorageClass:     info.StorageClass,
+	}, s, who)
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+
+	chunk := make([]byte, upload.ChunkSize)
+	for index := 0; index < upload.TotalChunks; index++ {
+		n, err := io.ReadFull(content, chunk)
+		if err == io.EOF {
+			return content.checkSize(info.Size)
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		release, apiErr := s.uploadSlot(ctx, int64(n))
+		if apiErr != nil {
+			return s.grpcError(ctx, who, apiErr)
+		}
+		_, apiErr = s.chunkManager.writeChunk(upload, index, bytes.NewReader(chunk[:n]))
+		release()
+		if apiErr != nil {
+			return s.grpcError(ctx, who, apiErr)
+		}
+	}
+	// Anything past the announced size is an error, not the start of another file
+	content.Read(make([]byte, 1))
+	if err := content.checkSize(info.Size); err != nil {
+		return err
+	}
+
+	job, apiErr := s.chunkManager.finishUpload(upload.UploadID, s)
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	return stream.SendAndClose(&onepb.UploadResponse{FileId: job.FileID, JobId: job.JobID})
+}
+
+// Download streams a file like /api/file/:id, counting it toward the caller's egress
+func (f *grpcFiles) Download(req *onepb.DownloadRequest, stream onepb.Files_DownloadServer) error {
+	ctx := stream.Context()
+	s := f.service
+	who, err := s.grpcCaller(ctx)
+	if err != nil {
+		return err
+	}
+	if apiErr := s.egressQuotaError(who); apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	release, apiErr := s.downloadSlot(ctx)
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	defer release()
+
+	creds := files.Credentials{Password: req.Password, AdminToken: grpcBearerToken(ctx)}
+	_, metadata, content, apiErr := s.readDownload(req.Id, creds)
+	if apiErr != nil {
+		return s.grpcError(ctx, who, apiErr)
+	}
+	s.logAccess(who, req.Id, accessDownload)
+
+	info := &onepb.DownloadInfo{Filename: metadata.Filename, ContentType: metadata.MimeType, Size: int64(len(content))}
+	if err := stream.Send(&onepb.DownloadResponse{Data: &onepb.DownloadResponse_Info{Info: info}}); err != nil {
+		return err
+	}
+	var sent int64
+	for sent < int64(len(content)) {
+		chunk := content[sent:min(sent+grpcDownloadChunkSize, int64(len(content)))]
+		if err = stream.Send(&onepb.DownloadResponse{Data: &onepb.DownloadResponse_Chunk{Chunk: chunk}}); err != nil {
+			break
+		}
+		sent += int64(len(chunk))
+	}
+	if sent > 0 {
+		s.recordDownloadBy(who, onepb.Files_Download_FullMethodName, req.Id, sent)
+		s.recordServed(who, req.Id, sent)
+	}
+	return err
+}
+
+// GetMetadata returns the metadata of a file like /api/metadata/:id
+func (f *grpcFiles) GetMetadata(ctx context.Context, req *onepb.GetMetadataRequest) (*onepb.FileMetadata, error) {
+	s := f.service
+	who, err := s.grpcCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metadata, apiErr := s.fileMetadata(req.Id, req.Password)
+	if apiErr != nil {
+		return nil, s.grpcError(ctx, who, apiErr)
+	}
+	return grpcMetadata(metadata), nil
+}
+
+// DeleteFile deletes a file like DELETE /api/file/:id
+func (f *grpcFiles) DeleteFile(ctx context.Context, req *onepb.DeleteFileRequest) (*onepb.DeleteFileResponse, error) {
+	s := f.service
+	who, err := s.grpcCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	restorableUntil, apiErr := s.deleteFileAs(who, req.Id, req.DeletePassword, grpcBearerToken(ctx))
+	if apiErr != nil {
+		return nil, s.grpcError(ctx, who, apiErr)
+	}
+	return grpcDeleted(restorableUntil), nil
+}
+
+// grpcDeleted is the answer to the deletion of a file
+func grpcDeleted(restorableUntil *time.Time) *onepb.DeleteFileResponse {
+	response := &onepb.DeleteFileResponse{Message: fileDeletedMessage}
+	if restorableUntil != nil {
+		response.RestorableUntil = timestamppb.New(*restorableUntil)
+	}
+	return response
+}
+
+// GetJob returns the job assembling a chunked upload like /api/job/:job_id
+func (f *grpcFiles) GetJob(ctx context.Context, req *onepb.GetJobRequest) (*onepb.Job, error) {
+	s := f.service
+	who, err := s.grpcCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	job, apiErr := s.chunkManager.jobStatus(req.JobId)
+	if apiErr != nil {
+		return nil, s.grpcError(ctx, who, apiErr)
+	}
+	return &onepb.Job{
+		JobId:     job.JobID,
+		UploadId:  job.UploadID,
+		FileId:    job.FileID,
+		Status:    job.Status,
+		Progress:  int32(job.Progress),
+		Error:     job.Error,
+		CreatedAt: timestamppb.New(job.CreatedAt),
+		UpdatedAt: timestamppb.New(job.UpdatedAt),
+	}, nil
+}
+
+// authorize admits an admin call carrying a valid admin token
+func (a *grpcAdmin) authorize(ctx context.Context) (caller, error) {
+	s := a.service
+	who, err := s.grpcCaller(ctx)
+	if err != nil {
+		return who, err
+	}
+	if apiErr := s.adminTokenError(grpcBearerToken(ctx)); apiErr != nil {
+		return who, s.grpcError(ctx, who, apiErr)
+	}
+	return who, nil
+}
+
+// ListFiles pages through the stored files like /api/admin/files
+func (a *grpcAdmin) ListFiles(ctx context.Context, req *onepb.ListFilesRequest) (*onepb.ListFilesResponse, error) {
+	s := a.service
+	who, err := a.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, apiErr := s.listFiles(&AdminFileListRequest{
+		Search:      req.Search,
+		MimeType:    req.MimeType,
+		StorageType: req.StorageType,
+		Sort:        req.Sort,
+		Order:       req.Order,
+		Limit:       int(req.Limit),
+		Offset:      int(req.Offset),
+	})
+	if apiErr != nil {
+		return nil, s.grpcError(ctx, who, apiErr)
+	}
+
+	response := &onepb.ListFilesResponse{Total: int32(list.Total), HasMore: list.HasMore}
+	for _, file := range list.Files {
+		response.Files = append(response.Files, &onepb.AdminFile{
+			FileId:       file.FileID,
+			Filename:     file.Filename,
+			Size:         file.Size,
+			OriginalSize: file.OriginalSize,
+			MimeType:     file.MimeType,
+			StorageType:  file.StorageType,
+			Compression:  file.Compression,
+			HasPassword:  file.HasPassword,
+			UploadedAt:   timestamppb.New(file.UploadedAt),
+			ExpiresAt:    timestamppb.New(file.ExpiresAt),
+		})
+	}
+	return response, nil
+}
+
+// DeleteFile deletes any file like DELETE /api/admin/file/:id
+func (a *grpcAdmin) DeleteFile(ctx context.Context, req *onepb.AdminDeleteFileRequest) (*onepb.DeleteFileResponse, error) {
+	s := a.service
+	who, err := a.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, restorableUntil, apiErr := s.deleteAnyFile(req.Id, who.clientIP)
+	if apiErr != nil {
+		return nil, s.grpcError(ctx, who, apiErr)
+	}
+	return grpcDeleted(restorableUntil), nil
+}
+
+// UpdateFileExpiration changes when a file expires like /api/admin/file/:id/expires
+func (a *grpcAdmin) UpdateFileExpiration(ctx context.Context, req *onepb.UpdateFileExpirationRequest) (*onepb.UpdateFileExpirationResponse, error) {
+	s := a.service
+	who, err := a.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt == nil {
+		return nil, status.Error(codes.InvalidArgument, "expires_at is required")
+	}
+	metadata, _, apiErr := s.setFileExpiration(req.Id, req.ExpiresAt.AsTime())
+	if apiErr != nil {
+		return nil, s.grpcError(ctx, who, apiErr)
+	}
+	return &onepb.UpdateFileExpirationResponse{Metadata: grpcMetadata(metadata)}, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"file-storage-service/internal/onepb"
+)
+
+// dialTestGRPC serves the gRPC API of ts on a loopback port
+func dialTestGRPC(t *testing.T, ts *testService) *grpc.ClientConn {
+	t.Helper()
+	server, err := newGRPCServer(ts.FileService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func grpcUpload(ctx context.Context, client onepb.FilesClient, info *onepb.UploadInfo, content []byte) (*onepb.UploadResponse, error) {
+	stream, err := client.Upload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&onepb.UploadRequest{Data: &onepb.UploadRequest_Info{Info: info}}); err != nil {
+		return nil, err
+	}
+	for len(content) > 0 {
+		n := min(len(content), 1000)
+		if err := stream.Send(&onepb.UploadRequest{Data: &onepb.UploadRequest_Chunk{Chunk: content[:n]}}); err != nil {
+			break // The server answered early; CloseAndRecv has its error
+		}
+		content = content[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestGRPCUploadDownload(t *testing.T) {
+	ts := newTestService(t)
+	client := onepb.NewFilesClient(dialTestGRPC(t, ts))
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("grpc content "), 500)
+
+	uploaded, err := grpcUpload(ctx, client, &onepb.UploadInfo{Filename: "notes.txt", Size: int64(len(content))}, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.FileId == "" || uploaded.Metadata.GetDeletePassword() == "" || uploaded.Metadata.Size != int64(len(content)) {
+		t.Fatalf("upload = %+v", uploaded)
+	}
+
+	stream, err := client.Download(ctx, &onepb.DownloadRequest{Id: uploaded.FileId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info *onepb.DownloadInfo
+	var downloaded []byte
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetInfo() != nil {
+			info = msg.GetInfo()
+		}
+		downloaded = append(downloaded, msg.GetChunk()...)
+	}
+	if info == nil || info.Filename != "notes.txt" {
+		t.Errorf("download info = %+v", info)
+	}
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("downloaded %d bytes, want %d", len(downloaded), len(content))
+	}
+
+	metadata, err := client.GetMetadata(ctx, &onepb.GetMetadataRequest{Id: uploaded.FileId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Filename != "notes.txt" || metadata.GetDeletePassword() != "" || !metadata.ExpiresAt.AsTime().After(ts.clock.Now()) {
+		t.Errorf("metadata = %+v", metadata)
+	}
+
+	if _, err := client.DeleteFile(ctx, &onepb.DeleteFileRequest{Id: uploaded.FileId, DeletePassword: "wrong"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("delete with a wrong password: %v", err)
+	}
+	if _, err := client.DeleteFile(ctx, &onepb.DeleteFileRequest{Id: uploaded.FileId, DeletePassword: uploaded.Metadata.DeletePassword}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetMetadata(ctx, &onepb.GetMetadataRequest{Id: uploaded.FileId}); status.Code(err) != codes.NotFound {
+		t.Errorf("metadata of a deleted file: %v", err)
+	}
+}
+
+func TestGRPCUploadSizeMismatch(t *testing.T) {
+	ts := newTestService(t)
+	client := onepb.NewFilesClient(dialTestGRPC(t, ts))
+
+	_, err := grpcUpload(context.Background(), client, &onepb.UploadInfo{Filename: "short.txt", Size: 100}, []byte("only a few bytes"))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("content shorter than announced: %v", err)
+	}
+	if _, err := grpcUpload(context.Background(), client, &onepb.UploadInfo{Size: 1}, []byte("x")); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("upload without a filename: %v", err)
+	}
+}
+
+func TestGRPCRetryTrailers(t *testing.T) {
+	ts := newTestService(t)
+	ts.store.CreateAPIKey(&APIKeyStorage{ID: "slow", Name: "Slow", KeyHash: hashAPIKey("one_slow"), RateLimit: 1})
+	client := onepb.NewFilesClient(dialTestGRPC(t, ts))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "one_slow")
+
+	if _, err := client.GetMetadata(ctx, &onepb.GetMetadataRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("first call: %v", err)
+	}
+	var trailer metadata.MD
+	_, err := client.GetMetadata(ctx, &onepb.GetMetadataRequest{Id: "missing"}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("call over the key's rate limit: %v", err)
+	}
+	if trailer.Get("retry-after") == nil || strings.Join(trailer.Get("x-error-code"), "") != errorCodeRateLimited {
+		t.Errorf("trailer = %v", trailer)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "one_unknown")
+	if _, err := client.GetMetadata(ctx, &onepb.GetMetadataRequest{Id: "missing"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("unknown API key: %v", err)
+	}
+}
+
+func TestGRPCAdmin(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	ts.saveTestFile(t, "kept", "content", time.Hour)
+	ts.saveTestFile(t, "doomed", "content", time.Hour)
+	admin := onepb.NewAdminClient(dialTestGRPC(t, ts))
+
+	if _, err := admin.ListFiles(context.Background(), &onepb.ListFilesRequest{}); status.Code(err) == codes.OK {
+		t.Error("file list without a token succeeded")
+	}
+
+	token, _, err := ts.adminTokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	list, err := admin.ListFiles(ctx, &onepb.ListFilesRequest{Sort: "filename", Order: "asc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 2 || len(list.Files) != 2 || list.Files[0].FileId != "doomed" {
+		t.Errorf("list = %+v", list)
+	}
+
+	expiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	updated, err := admin.UpdateFileExpiration(ctx, &onepb.UpdateFileExpirationRequest{Id: "kept", ExpiresAt: timestamppb.New(expiresAt)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.Metadata.ExpiresAt.AsTime().Equal(expiresAt) {
+		t.Errorf("expires at %v, want %v", updated.Metadata.ExpiresAt.AsTime(), expiresAt)
+	}
+
+	if _, err := admin.DeleteFile(ctx, &onepb.AdminDeleteFileRequest{Id: "doomed"}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := ts.store.GetFile("doomed"); stored != nil {
+		t.Error("file still stored after the admin deleted it")
+	}
+}
+
+func TestGRPCUploadChunked(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.ChunkThreshold = 1024
+	ts.config.ChunkSize = 1024
+	ts.jobQueue = nil // The fake Redis has no streams, so assemble in-process
+	client := onepb.NewFilesClient(dialTestGRPC(t, ts))
+	content := bytes.Repeat([]byte("chunked "), 400)
+
+	uploaded, err := grpcUpload(context.Background(), client, &onepb.UploadInfo{Filename: "large.bin", Size: int64(len(content))}, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.JobId == "" || uploaded.FileId == "" {
+		t.Errorf("upload = %+v", uploaded)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		job, err := client.GetJob(context.Background(), &onepb.GetJobRequest{JobId: uploaded.JobId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == "completed" {
+			break
+		}
+		if job.Status == "failed" || time.Now().After(deadline) {
+			t.Fatalf("job = %+v", job)
+		}
+	}
+	if stored, _ := ts.store.GetFile(uploaded.FileId); stored == nil || stored.OriginalSize != int64(len(content)) {
+		t.Errorf("stored = %+v", stored)
+	}
+}
@@ -1,88 +1,57 @@
 package main
 
 import (
-	"archive/zip"
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"math/big"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/klauspost/compress/zstd"
 	"github.com/pierrec/lz4/v4"
-	"golang.org/x/text/encoding/japanese"
-	"golang.org/x/text/transform"
+
+	"file-storage-service/internal/files"
 )
 
 type FileMetadata struct {
-	ID                  string          `json:"id"`
-	Filename            string          `json:"filename"`
-	Size                int64           `json:"size"`
-	CompressedSize      int64           `json:"compressed_size"`
-	MimeType            string          `json:"mime_type"`
-	Compression         CompressionType `json:"compression"`
-	UploadTime          time.Time       `json:"upload_time"`
-	ExpiresAt           time.Time       `json:"expires_at"`
-	DeletePassword      string          `json:"delete_password,omitempty"`
-	DownloadPassword    string          `json:"download_password,omitempty"`
-	HasDownloadPassword bool            `json:"has_download_password"`
-}
-
-// convertToUTF8 tries to convert string from various Japanese encodings to UTF-8
-func convertToUTF8(input string) string {
-	// First check if it's already valid UTF-8
-	if utf8.ValidString(input) {
-		return input
-	}
-
-	// Convert string to bytes for better encoding detection
-	inputBytes := []byte(input)
-
-	// Try to convert from Shift_JIS (most common for Windows ZIP files)
-	decoder := japanese.ShiftJIS.NewDecoder()
-	if result, _, err := transform.Bytes(decoder, inputBytes); err == nil {
-		resultStr := string(result)
-		if utf8.ValidString(resultStr) && containsJapanese(resultStr) {
-			return resultStr
-		}
-	}
-
-	// Try to convert from EUC-JP
-	decoder = japanese.EUCJP.NewDecoder()
-	if result, _, err := transform.Bytes(decoder, inputBytes); err == nil {
-		resultStr := string(result)
-		if utf8.ValidString(resultStr) && containsJapanese(resultStr) {
-			return resultStr
-		}
-	}
-
-	// Try to convert from ISO-2022-JP
-	decoder = japanese.ISO2022JP.NewDecoder()
-	if result, _, err := transform.Bytes(decoder, inputBytes); err == nil {
-		resultStr := string(result)
-		if utf8.ValidString(resultStr) && containsJapanese(resultStr) {
-			return resultStr
-		}
-	}
-
-	// If all conversions fail, return the original string
-	return input
+	ID                  string            `json:"id"`
+	Filename            string            `json:"filename"`
+	Size                int64             `json:"size"`
+	CompressedSize      int64             `json:"compressed_size"`
+	MimeType            string            `json:"mime_type"`
+	Compression         CompressionType   `json:"compression"`
+	UploadTime          time.Time         `json:"upload_time"`
+	ExpiresAt           time.Time         `json:"expires_at"`
+	DeletePassword      string            `json:"delete_password,omitempty"`
+	DownloadPassword    string            `json:"download_password,omitempty"`
+	HasDownloadPassword bool              `json:"has_download_password"`
+	Image               *ImageInfo        `json:"image,omitempty"`
+	SHA256              string            `json:"sha256,omitempty"`
+	StorageClass        StorageClass      `json:"storage_class,omitempty"`
+	Scan                *ScanResult       `json:"scan,omitempty"`
+	Org                 *OrgBranding      `json:"org,omitempty"`
+	Accesses            *FileAccessCounts `json:"accesses,omitempty"`
+	Accessibility       *Accessibility    `json:"accessibility,omitempty"`
+	Tags                map[string]string `json:"tags,omitempty"` // From the upload policy the file was uploaded with
 }
 
 // getFileStatus returns processing status or direct access for files
+//
+// @summary Get the processing status of a file
+// @tags file
+// @path id File ID
+// @success 200 json
+// @success 202 json The file is still being processed
 func (s *FileService) getFileStatus(c *gin.Context) {
 	fileID := c.Param("id")
 	ctx := context.Background()
@@ -111,18 +80,25 @@ func (s *FileService) getFileStatus(c *gin.Context) {
 				if errorDetail, exists := processingStatus["error"].(string); exists {
 					errorMsg = errorDetail
 				}
-				c.JSON(http.StatusBadRequest, gin.H{
+				response := gin.H{
 					"status": "failed",
 					"message": errorMsg,
 					"error_type": "processing_failed",
-				})
+				}
+				// Pass through details such as hash mismatches from chunked uploads
+				for _, key := range []string{"error_code", "expected_hash", "actual_hash"} {
+					if value, exists := processingStatus[key]; exists {
+						response[key] = value
+					}
+				}
+				c.JSON(http.StatusBadRequest, response)
 				return
 			}
 		}
 	}
 
 	// Get file metadata from PostgreSQL (primary source)
-	fileStorage, dbErr := s.db.GetFileMetadata(fileID)
+	fileStorage, dbErr := s.lookupFile(fileID, false)
 	var metadata FileMetadata
 	var fileFound bool
 
@@ -208,157 +184,256 @@ func (s *FileService) getFileStatus(c *gin.Context) {
 	}
 }
 
-// containsJapanese checks if the string contains Japanese characters
-func containsJapanese(s string) bool {
-	for _, r := range s {
-		// Check for Hiragana, Katakana, and Kanji ranges
-		if (r >= 0x3040 && r <= 0x309F) || // Hiragana
-			(r >= 0x30A0 && r <= 0x30FF) || // Katakana
-			(r >= 0x4E00 && r <= 0x9FAF) { // Kanji
-			return true
-		}
+// uploadFile stores a file sent as a multipart form, compressing it when that pays off
+//
+// @summary Upload a file
+// @tags upload
+// @form file file required The file to upload
+// @form download_password string Password required to download the file
+// @form storage_class string Storage class: fast-ssd, standard or archive
+// @form email_to string Comma-separated addresses to mail the link to
+// @form password_hint string Hint mailed along with the link
+// @form slug string Vanity slug for /f/:slug
+// @form custom_id string Custom ID, the same as slug
+// @form alt_text string Alt text of an image
+// @form caption string Caption of the file
+// @form description string Long description of the file
+// @form file_hash string Expected SHA-256 of the content
+// @form policy string Signed upload policy from POST /api/upload-policies, instead of an API key
+// @header X-Content-SHA256 Expected SHA-256 of the content, when file_hash isn't given
+// @success 200 UploadResponse
+// @auth apiKey optional
+func (s *FileService) uploadFile(c *gin.Context) {
+	// Acquire an upload slot
+	release, ok := s.acquireUploadSlot(c)
+	if !ok {
+		return
 	}
-	return false
-}
+	defer release()
 
-// detectAndConvertFilename attempts to convert filename from various encodings
-func detectAndConvertFilename(name string) string {
-	// If it's already valid UTF-8 and contains readable characters, return as-is
-	if utf8.ValidString(name) && isReadableText(name) {
-		return name
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
 	}
+	defer file.Close()
 
-	// Convert the filename string back to raw bytes
-	// Go's ZIP reader reads filenames as latin-1, so we need to convert back to bytes
-	rawBytes := make([]byte, len(name))
-	for i, r := range []byte(name) {
-		rawBytes[i] = r
+	// A signed policy uploads as the key that minted it, within the policy's limits
+	policy, ok := s.applyUploadPolicy(c)
+	if !ok {
+		return
+	}
+	if policy != nil && !policy.checkFile(c, files.NormalizeName(header.Filename), header.Size) {
+		return
 	}
 
-	// Try Shift_JIS conversion (most common for Japanese Windows ZIP files)
-	decoder := japanese.ShiftJIS.NewDecoder()
-	if converted, _, err := transform.Bytes(decoder, rawBytes); err == nil {
-		result := string(converted)
-		if utf8.ValidString(result) && containsJapanese(result) {
-			return result
-		}
+	if !checkExtensionPolicy(c, s.config, files.NormalizeName(header.Filename), header.Size) {
+		return
+	}
+	if !s.checkOrgPolicy(c, files.NormalizeName(header.Filename), c.PostForm("download_password") != "") {
+		return
 	}
 
-	// Try EUC-JP conversion
-	decoder = japanese.EUCJP.NewDecoder()
-	if converted, _, err := transform.Bytes(decoder, rawBytes); err == nil {
-		result := string(converted)
-		if utf8.ValidString(result) && containsJapanese(result) {
-			return result
-		}
+	// Check if file exceeds chunk threshold
+	if header.Size > s.config.ChunkThreshold {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": "File too large for standard upload",
+			"message": "Files larger than 100MB must use chunked upload",
+			"max_size": s.config.ChunkThreshold,
+			"use_chunked": true,
+		})
+		return
 	}
 
-	// If conversion fails, try the original convertToUTF8 function
-	return convertToUTF8(name)
-}
+	// Enforce per-key / per-IP storage quotas
+	apiKey := apiKeyFromContext(c)
+	if !s.checkUploadQuota(c, header.Size) {
+		return
+	}
 
-// isReadableText checks if the string contains mostly readable characters
-func isReadableText(s string) bool {
-	if len(s) == 0 {
-		return true
-	}
-
-	readableCount := 0
-	for _, r := range s {
-		// Count printable ASCII, Japanese characters, and common punctuation
-		if (r >= 32 && r <= 126) || // ASCII printable
-			(r >= 0x3040 && r <= 0x309F) || // Hiragana
-			(r >= 0x30A0 && r <= 0x30FF) || // Katakana
-			(r >= 0x4E00 && r <= 0x9FAF) || // Kanji
-			r == '/' || r == '\\' || r == '.' || r == '-' || r == '_' {
-			readableCount++
-		}
+	storageClass, ok := s.storageClassFromRequest(c, c.PostForm("storage_class"), apiKey)
+	if !ok {
+		return
+	}
+	email, ok := s.linkEmailFromRequest(c, c.PostForm("email_to"), c.PostForm("password_hint"))
+	if !ok {
+		return
+	}
+	slug, ok := s.slugFromRequest(c, c.PostForm("slug"), c.PostForm("custom_id"))
+	if !ok {
+		return
+	}
+	accessibility, ok := accessibilityFromRequest(c, c.PostForm("alt_text"), c.PostForm("caption"), c.PostForm("description"))
+	if !ok {
+		return
 	}
 
-	// If more than 70% of characters are readable, consider it valid
-	return float64(readableCount)/float64(len([]rune(s))) > 0.7
-}
+	// Read file content, hashing it on the way in
+	hasher := sha256.New()
+	content, err := io.ReadAll(io.TeeReader(file, hasher))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	if policy != nil && !policy.checkContent(c, files.NormalizeName(header.Filename), content) {
+		return
+	}
+
+	// Verify the client-computed SHA-256 if one was provided (form field or header)
+	expectedHash := c.PostForm("file_hash")
+	if expectedHash == "" {
+		expectedHash = c.GetHeader("X-Content-SHA256")
+	}
+	if !verifyContentHash(c, header.Filename, expectedHash, contentHash) {
+		return
+	}
 
-// generateRandomPassword generates a random password for file deletion
-func generateRandomPassword() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	const length = 12
+	s.storeUploadedContent(c, files.NormalizeName(header.Filename), content, contentHash, c.PostForm("download_password"), apiKey, storageClass, email, slug, accessibility)
+}
 
-	password := make([]byte, length)
-	for i := range password {
-		num, _ := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
-		password[i] = charset[num.Int64()]
+// verifyContentHash compares the client-provided SHA-256 (if any) with the received
+// content and writes a 422 response on mismatch
+func verifyContentHash(c *gin.Context, filename, expectedHash, contentHash string) bool {
+	if err := contentHashError(filename, expectedHash, contentHash); err != nil {
+		err.respond(c)
+		return false
 	}
-	return string(password)
+	return true
 }
 
-func (s *FileService) uploadFile(c *gin.Context) {
-	// Acquire upload semaphore
-	if err := s.uploadSem.Acquire(c.Request.Context(), 1); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Server busy, please try again later",
-		})
+// contentHashError is verifyContentHash, returning the error instead of writing it
+func contentHashError(filename, expectedHash, contentHash string) *apiError {
+	if expectedHash != "" && !strings.EqualFold(expectedHash, contentHash) {
+		log.Printf("uploadFile: hash mismatch for %s (expected %s, got %s)", filename, expectedHash, contentHash)
+		return &apiError{status: http.StatusUnprocessableEntity, body: gin.H{
+			"error":         "Hash mismatch",
+			"error_code":    "hash_mismatch",
+			"message":       "The uploaded content does not match the provided SHA-256 hash. The upload may have been corrupted in transit.",
+			"retryable":     true,
+			"expected_hash": strings.ToLower(expectedHash),
+			"actual_hash":   contentHash,
+		}}
+	}
+	return nil
+}
+
+// UploadResponse is the answer to a successful upload
+type UploadResponse struct {
+	Message   string        `json:"message"`
+	FileID    string        `json:"file_id"`
+	Metadata  *FileMetadata `json:"metadata"` // Includes the delete password
+	SHA256    string        `json:"sha256"`
+	Slug      string        `json:"slug,omitempty"`
+	SlugURL   string        `json:"slug_url,omitempty"`
+	EmailedTo []string      `json:"emailed_to,omitempty"` // Addresses the link was mailed to
+}
+
+// storeUploadedContent compresses and persists a fully received upload with the
+// uploader's accessibility text, points the vanity slug at it and mails its link when
+// asked to, and writes the standard upload response
+func (s *FileService) storeUploadedContent(c *gin.Context, filename string, content []byte, contentHash string, downloadPassword string, apiKey *APIKeyStorage, storageClass StorageClass, email *LinkEmail, slug string, accessibility *Accessibility) {
+	who := callerFrom(c)
+	who.apiKey = apiKey
+	response, err := s.storeContent(who, filename, content, contentHash, downloadPassword, storageClass, slug, accessibility, uploadPolicyTags(c))
+	if err != nil {
+		err.respond(c)
 		return
 	}
-	defer s.uploadSem.Release(1)
+	if email != nil {
+		s.sendLinkEmail(c, email, response.Metadata)
+		response.EmailedTo = email.Recipients
+	}
+	c.JSON(http.StatusOK, response)
+}
 
-	file, header, err := c.Request.FormFile("file")
+// storeContent compresses and persists a fully received upload, points the vanity slug
+// at it, and returns the standard upload response
+func (s *FileService) storeContent(who caller, filename string, content []byte, contentHash string, downloadPassword string, storageClass StorageClass, slug string, accessibility *Accessibility, tags map[string]string) (*UploadResponse, *apiError) {
+	metadata, fileStorage, err := s.saveContent(who, filename, content, contentHash, downloadPassword, storageClass, accessibility, tags)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
-		return
+		return nil, err
+	}
+	if slug != "" {
+		if err := s.claimSlugFor(slug, fileStorage); err != nil {
+			return nil, err
+		}
 	}
-	defer file.Close()
 
-	// Check if file exceeds chunk threshold
-	if header.Size > s.config.ChunkThreshold {
-		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-			"error": "File too large for standard upload",
-			"message": "Files larger than 100MB must use chunked upload",
-			"max_size": s.config.ChunkThreshold,
-			"use_chunked": true,
-		})
-		return
+	response := &UploadResponse{
+		Message:  "File uploaded successfully",
+		FileID:   metadata.ID,
+		Metadata: metadata,
+		SHA256:   contentHash,
+	}
+	if slug != "" {
+		response.Slug = slug
+		response.SlugURL = "/f/" + slug
 	}
+	return response, nil
+}
 
-	// Read file content
-	content, err := io.ReadAll(file)
+// saveUploadedContent compresses and persists a fully received upload, returning its
+// metadata and stored record, or writes the error response and returns false
+func (s *FileService) saveUploadedContent(c *gin.Context, filename string, content []byte, contentHash string, downloadPassword string, apiKey *APIKeyStorage, storageClass StorageClass, accessibility *Accessibility) (*FileMetadata, *FileStorage, bool) {
+	who := callerFrom(c)
+	who.apiKey = apiKey
+	metadata, fileStorage, err := s.saveContent(who, filename, content, contentHash, downloadPassword, storageClass, accessibility, uploadPolicyTags(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
-		return
+		err.respond(c)
+		return nil, nil, false
+	}
+	return metadata, fileStorage, true
+}
+
+// saveContent compresses and persists a fully received upload of who with the given
+// tags, returning its metadata and stored record
+func (s *FileService) saveContent(who caller, filename string, content []byte, contentHash string, downloadPassword string, storageClass StorageClass, accessibility *Accessibility, tags map[string]string) (*FileMetadata, *FileStorage, *apiError) {
+	size := int64(len(content))
+
+	scanResult, apiErr := s.scanUploadedContent(filename, content, who.clientIP)
+	if apiErr != nil {
+		return nil, nil, apiErr
 	}
 
 	// Generate unique file ID
-	fileID := generateFileID()
+	fileID, apiErr := s.nextFileID()
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
 	ctx := context.Background()
 
-	// Get optional download password from form
-	downloadPassword := c.PostForm("download_password")
 	hasDownloadPassword := downloadPassword != ""
 
 	// Generate random delete password
-	deletePassword := generateRandomPassword()
+	deletePassword := files.GeneratePassword()
 
 	// Select compression type
-	compressionType := s.compressor.SelectCompressionType(header.Filename, header.Size)
+	compressionType := compressionForClass(s.compressor, storageClass, filename, size)
 
 	// Compress file
 	compressedContent, err := s.compressor.Compress(content, compressionType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compress file"})
-		return
+		return nil, nil, newAPIError(http.StatusInternalServerError, "Failed to compress file")
 	}
 
-	// Create metadata with 24-hour expiration
-	now := time.Now()
-	expiresAt := now.Add(24 * time.Hour)
+	// Create metadata expiring after the retention period
+	now := s.clock.Now()
+	retention := s.retentionFor(who.apiKey)
+	expiresAt := now.Add(retention)
 
-	detectedMimeType := GetMimeType(header.Filename)
-	log.Printf("uploadFile: filename=%s, detected MIME type=%s", header.Filename, detectedMimeType)
+	detectedMimeType := files.MimeType(filename)
+	log.Printf("uploadFile: filename=%s, detected MIME type=%s", filename, detectedMimeType)
+
+	var imageInfo *ImageInfo
+	if files.IsImageFile(detectedMimeType) {
+		imageInfo = extractImageInfo(content)
+	}
 
 	metadata := FileMetadata{
 		ID:                  fileID,
-		Filename:            header.Filename,
-		Size:                header.Size,
+		Filename:            filename,
+		Size:                size,
 		CompressedSize:      int64(len(compressedContent)),
 		MimeType:            detectedMimeType,
 		Compression:         compressionType,
@@ -367,28 +442,28 @@ func (s *FileService) uploadFile(c *gin.Context) {
 		DeletePassword:      deletePassword,
 		DownloadPassword:    downloadPassword,
 		HasDownloadPassword: hasDownloadPassword,
+		Image:               imageInfo,
+		SHA256:              contentHash,
+		StorageClass:        storageClass,
+		Scan:                scanResult,
+		Accessibility:       accessibility,
 	}
 
-	// Determine storage strategy based on file size
+	// Determine storage strategy based on storage class and file size
 	var storageType string
 	var storagePath *string
 	var fileContent []byte
 	
-	// For very large files (>1GB), store on disk; otherwise store in PostgreSQL
-	if header.Size > 1024*1024*1024 { // 1GB threshold
+	// Store on disk for disk-backed classes and very large files (>1GB); otherwise in PostgreSQL
+	if storeOnDisk(storageClass, size) {
 		storageType = "disk"
-		// Create storage directory
-		filesDir := filepath.Join(s.config.TempDir, "files")
-		if err := os.MkdirAll(filesDir, 0755); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create storage directory"})
-			return
+		// Save to the class's storage directory
+		diskPath, err := storageClassPath(s.config, storageClass, fileID)
+		if err != nil {
+			return nil, nil, newAPIError(http.StatusInternalServerError, "Failed to save file to disk")
 		}
-		
-		// Save to disk
-		diskPath := filepath.Join(filesDir, fileID)
 		if err := os.WriteFile(diskPath, compressedContent, 0644); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file to disk"})
-			return
+			return nil, nil, newAPIError(http.StatusInternalServerError, "Failed to save file to disk")
 		}
 		storagePath = &diskPath
 		fileContent = nil // Don't store content in database for disk files
@@ -401,8 +476,8 @@ func (s *FileService) uploadFile(c *gin.Context) {
 	// Store file metadata and content in PostgreSQL
 	fileStorage := &FileStorage{
 		ID:                  fileID,
-		Filename:           header.Filename,
-		OriginalSize:       header.Size,
+		Filename:           filename,
+		OriginalSize:       size,
 		CompressedSize:     &metadata.CompressedSize,
 		MimeType:           detectedMimeType,
 		CompressionType:    string(compressionType),
@@ -420,52 +495,107 @@ func (s *FileService) uploadFile(c *gin.Context) {
 		fileStorage.DownloadPassword = &downloadPassword
 	}
 
+	if who.apiKey != nil {
+		fileStorage.APIKeyID = &who.apiKey.ID
+	}
+	clientIP := who.clientIP
+	fileStorage.UploaderIP = &clientIP
+	fileStorage.ContentHash = &contentHash
+	fileStorage.ImageInfo = imageInfo
+	fileStorage.StorageClass = string(storageClass)
+	fileStorage.ScanResult = scanResult
+	fileStorage.Accessibility = accessibility
+	fileStorage.Tags = tags
+	metadata.Tags = tags
+
 	if err := s.db.SaveFile(fileStorage); err != nil {
 		// If database save fails, clean up disk file if it was created
 		if storageType == "disk" && storagePath != nil {
 			os.Remove(*storagePath)
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
-		return
+		return nil, nil, newAPIError(http.StatusInternalServerError, "Failed to save file")
 	}
+	s.queueHLSTranscode(fileID, detectedMimeType, size)
 
 	// Cache metadata in Redis for faster access (optional)
 	metadataJSON, err := json.Marshal(metadata)
 	if err == nil {
-		expiration := 24 * time.Hour
-		s.redis.Set(ctx, "file:"+fileID, metadataJSON, expiration)
+		s.redis.Set(ctx, "file:"+fileID, metadataJSON, retention)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "File uploaded successfully",
-		"file_id":  fileID,
-		"metadata": metadata,
-	})
+	return &metadata, fileStorage, nil
 }
 
+// getFile downloads a file as an attachment under its original name, serving byte ranges
+// on request
+//
+// @summary Download a file
+// @tags file
+// @path id File ID
+// @header Range Byte range to download
+// @success 200 application/octet-stream The content, with the file's type
+// @success 206 application/octet-stream The requested range
+// @auth downloadPassword adminToken optional
 func (s *FileService) getFile(c *gin.Context) {
-	// Acquire download semaphore
-	if err := s.downloadSem.Acquire(c.Request.Context(), 1); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Server busy, please try again later",
-		})
+	release, apiErr := s.downloadSlot(c.Request.Context())
+	if apiErr != nil {
+		apiErr.respond(c)
 		return
 	}
-	defer s.downloadSem.Release(1)
+	defer release()
 
 	fileID := c.Param("id")
+	creds := files.Credentials{Password: c.Query("password"), AdminToken: adminTokenFrom(c)}
+	fileStorage, metadata, content, apiErr := s.readDownload(fileID, creds)
+	if apiErr != nil {
+		apiErr.respond(c)
+		return
+	}
+	s.logFileAccess(c, fileID, accessDownload)
+
+	// Set appropriate headers
+	c.Header("Content-Disposition", files.ContentDisposition("attachment", metadata.Filename))
+	c.Header("Content-Type", metadata.MimeType)
+	c.Header("Content-Length", strconv.FormatInt(int64(len(content)), 10))
+	s.setByteServingHeaders(c, fileStorage)
+	if notModified(c, fileStorage) {
+		return
+	}
+
+	rangeSpec, partial, ok := resolveRange(c, fileStorage, int64(len(content)))
+	if !ok {
+		return
+	}
+	if partial {
+		c.Data(http.StatusPartialContent, metadata.MimeType, content[rangeSpec.Start:rangeSpec.End+1])
+		return
+	}
+	c.Data(http.StatusOK, metadata.MimeType, content)
+}
+
+// downloadSlot takes a slot of the download semaphore, refusing the download with 503
+// when ctx ends first
+func (s *FileService) downloadSlot(ctx context.Context) (func(), *apiError) {
+	if err := s.downloadSem.Acquire(ctx, 1); err != nil {
+		return nil, retryLaterError(http.StatusServiceUnavailable, errorCodeServerBusy, retryAfterBusy, gin.H{
+			"error": "Server busy, please try again later",
+		})
+	}
+	return func() { s.downloadSem.Release(1) }, nil
+}
 
+// readDownload looks up a file to download with the given credentials, returning its
+// record, its metadata with the passwords and its decompressed content
+func (s *FileService) readDownload(fileID string, creds files.Credentials) (*FileStorage, FileMetadata, []byte, *apiError) {
 	// Get file from PostgreSQL (primary source)
-	fileStorage, err := s.db.GetFile(fileID)
+	fileStorage, err := s.lookupFile(fileID, true)
 	if err != nil {
 		log.Printf("Failed to get file from database: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+		return nil, FileMetadata{}, nil, newAPIError(http.StatusInternalServerError, "Database error")
 	}
 	
 	if fileStorage == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
+		return nil, FileMetadata{}, nil, newAPIError(http.StatusNotFound, "File not found")
 	}
 
 	// Convert database record to metadata
@@ -492,142 +622,158 @@ func (s *FileService) getFile(c *gin.Context) {
 	}
 
 	// Check if file has expired
-	if metadata.ExpiresAt.Before(time.Now()) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File has expired"})
-		return
+	if metadata.ExpiresAt.Before(s.clock.Now()) {
+		return nil, FileMetadata{}, nil, newAPIError(http.StatusNotFound, "File has expired")
 	}
 
 	// Check download password if required (bypass for admin)
-	if metadata.HasDownloadPassword {
-		providedPassword := c.Query("password")
-		adminToken := c.Query("admin_token")
-		
-		isAdminAccess := false
-		if adminToken != "" {
-			if _, err := s.validateAdminToken(adminToken); err == nil {
-				isAdminAccess = true
-				log.Printf("Admin access granted for file %s", fileID)
-			}
-		}
-		
-		if !isAdminAccess && providedPassword != metadata.DownloadPassword {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Password required",
-				"message": "This file is password protected. Please provide the correct password.",
-			})
-			return
-		}
+	if err := s.downloadAccessError(metadata.HasDownloadPassword, &metadata.DownloadPassword, creds); err != nil {
+		return nil, FileMetadata{}, nil, err
+	}
+	if err := scanPendingError(fileStorage); err != nil {
+		return nil, FileMetadata{}, nil, err
 	}
 
 	// Get file content based on storage type
 	var content []byte
 	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
 		// Read from disk
-		diskContent, err := os.ReadFile(*fileStorage.StoragePath)
+		diskContent, err := readStoredFile(s.config, *fileStorage.StoragePath)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from disk"})
-			return
+			return nil, FileMetadata{}, nil, newAPIError(http.StatusInternalServerError, "Failed to read file from disk")
 		}
 
 		// Decompress file
 		content, err = s.compressor.Decompress(diskContent, metadata.Compression)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decompress file"})
-			return
+			return nil, FileMetadata{}, nil, newAPIError(http.StatusInternalServerError, "Failed to decompress file")
 		}
 	} else {
 		// Read from PostgreSQL
 		if fileStorage.FileContent == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File content not found"})
-			return
+			return nil, FileMetadata{}, nil, newAPIError(http.StatusNotFound, "File content not found")
 		}
 
 		// Decompress file
 		content, err = s.compressor.Decompress(fileStorage.FileContent, metadata.Compression)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decompress file"})
-			return
+			return nil, FileMetadata{}, nil, newAPIError(http.StatusInternalServerError, "Failed to decompress file")
 		}
 	}
 
-	// Set appropriate headers
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", metadata.Filename))
-	c.Header("Content-Type", metadata.MimeType)
-	c.Header("Content-Length", strconv.FormatInt(metadata.Size, 10))
-
-	c.Data(http.StatusOK, metadata.MimeType, content)
+	return fileStorage, metadata, content, nil
 }
 
+// deleteFile deletes a file, moving it to the trash unless TRASH_RETENTION_HOURS is 0. It
+// takes the delete password, an API key that may manage the file, or an admin token.
+//
+// @summary Delete a file
+// @tags file
+// @path id File ID
+// @success 200 json
+// @auth deletePassword apiKey adminToken
 func (s *FileService) deleteFile(c *gin.Context) {
 	fileID := c.Param("id")
-	ctx := context.Background()
+	restorableUntil, err := s.deleteFileAs(callerFrom(c), fileID, c.Query("delete_password"), adminTokenFrom(c))
+	if err != nil {
+		err.respond(c)
+		return
+	}
+	c.JSON(http.StatusOK, deletedResponse(fileID, restorableUntil))
+}
 
+// deleteFileAs deletes a file for a caller with its delete password, an API key that may
+// manage it, or an admin token, returning until when it can be restored from the trash
+func (s *FileService) deleteFileAs(who caller, fileID, deletePassword, adminToken string) (*time.Time, *apiError) {
 	// Get file metadata from PostgreSQL
-	fileStorage, err := s.db.GetFileMetadata(fileID)
+	fileStorage, err := s.lookupFile(fileID, false)
 	if err != nil {
 		log.Printf("Failed to get file metadata: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+		return nil, newAPIError(http.StatusInternalServerError, "Database error")
 	}
 	
 	if fileStorage == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
+		return nil, newAPIError(http.StatusNotFound, "File not found")
 	}
 
 	// Check delete password (bypass for admin)
-	providedPassword := c.Query("delete_password")
-	adminToken := c.Query("admin_token")
-	
-	isAdminAccess := false
-	if adminToken != "" {
-		if _, err := s.validateAdminToken(adminToken); err == nil {
-			isAdminAccess = true
-			log.Printf("Admin access granted for file deletion %s", fileID)
-		}
+	isAdminAccess := adminToken != "" && s.adminTokens.ValidToken(adminToken)
+	if isAdminAccess {
+		log.Printf("Admin access granted for file deletion %s", fileID)
 	}
+
+	// The API key that uploaded a file, or any key of the organization owning it, may
+	// delete it without the delete password
+	isOwnerKey := canManageFile(who.apiKey, fileStorage)
 	
-	if !isAdminAccess && providedPassword != fileStorage.DeletePassword {
-		c.JSON(http.StatusUnauthorized, gin.H{
+	if !isAdminAccess && !isOwnerKey && deletePassword != fileStorage.DeletePassword {
+		return nil, &apiError{status: http.StatusUnauthorized, body: gin.H{
 			"error":   "Invalid delete password",
 			"message": "The provided delete password is incorrect.",
-		})
-		return
+		}}
+	}
+
+	return s.removeFile(fileStorage, who.clientIP)
+}
+
+// removeFile deletes a file, moving it to the trash unless it is disabled, and returns
+// until when it can be restored from there
+func (s *FileService) removeFile(fileStorage *FileStorage, ipAddress string) (*time.Time, *apiError) {
+	fileID := fileStorage.ID
+
+	// Deleted files go to the trash first, unless it is disabled
+	if s.config.TrashRetention > 0 {
+		until, err := s.trashFile(fileStorage, ipAddress)
+		if err != nil {
+			return nil, err
+		}
+		return &until, nil
 	}
 
 	// Delete from PostgreSQL
 	if err := s.db.DeleteFile(fileID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file from database"})
-		return
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to delete file from database")
 	}
 
 	// Delete disk file if it exists
 	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
-		if err := os.Remove(*fileStorage.StoragePath); err != nil && !os.IsNotExist(err) {
+		if err := removeStoredFile(s.config, *fileStorage.StoragePath); err != nil && !os.IsNotExist(err) {
 			log.Printf("Failed to delete file from disk: %v", err)
 		}
 	}
 
 	// Remove from Redis cache (optional)
-	s.redis.Del(ctx, "file:"+fileID)
-
-	c.JSON(http.StatusOK, gin.H{"message": "File deleted successfully"})
+	s.redis.Del(context.Background(), "file:"+fileID)
+	s.metadataQueue.Discard(fileID)
+	return nil, nil
 }
 
+// previewFile serves a file inline for previewing, with viewers for hex dumps, 3D models and
+// fonts on request
+//
+// @summary Preview a file in the browser
+// @tags preview
+// @path id File ID
+// @query hex boolean Show a hex dump
+// @query viewer boolean Open 3D models in the viewer
+// @query orient boolean Apply the EXIF orientation of JPEG images
+// @query specimen boolean Render a font specimen
+// @success 200 application/octet-stream The content, with the file's type
+// @success 302 Archives redirect to the archive listing
+// @auth downloadPassword adminToken optional
 func (s *FileService) previewFile(c *gin.Context) {
 	// Acquire download semaphore for preview
-	if err := s.downloadSem.Acquire(c.Request.Context(), 1); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Server busy, please try again later",
-		})
+	release, apiErr := s.downloadSlot(c.Request.Context())
+	if apiErr != nil {
+		apiErr.respond(c)
 		return
 	}
-	defer s.downloadSem.Release(1)
+	defer release()
 
 	fileID := c.Param("id")
 
 	// Get file from PostgreSQL (primary source)
-	fileStorage, err := s.db.GetFile(fileID)
+	fileStorage, err := s.lookupFile(fileID, true)
 	if err != nil {
 		log.Printf("Failed to get file from database: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -652,6 +798,8 @@ func (s *FileService) previewFile(c *gin.Context) {
 		DeletePassword:     fileStorage.DeletePassword,
 		DownloadPassword:   "",
 		HasDownloadPassword: fileStorage.HasDownloadPassword,
+		Accessibility:      fileStorage.Accessibility,
+		Tags:               fileStorage.Tags,
 	}
 	
 	if fileStorage.CompressedSize != nil {
@@ -663,98 +811,85 @@ func (s *FileService) previewFile(c *gin.Context) {
 	}
 
 	// Check if file has expired
-	if metadata.ExpiresAt.Before(time.Now()) {
+	if metadata.ExpiresAt.Before(s.clock.Now()) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File has expired"})
 		return
 	}
 
 	// Check download password if required (bypass for admin)
-	if metadata.HasDownloadPassword {
-		providedPassword := c.Query("password")
-		adminToken := c.Query("admin_token")
-		
-		isAdminAccess := false
-		if adminToken != "" {
-			if _, err := s.validateAdminToken(adminToken); err == nil {
-				isAdminAccess = true
-				log.Printf("Admin access granted for file %s", fileID)
-			}
-		}
-		
-		if !isAdminAccess && providedPassword != metadata.DownloadPassword {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Password required",
-				"message": "This file is password protected. Please provide the correct password.",
-			})
-			return
-		}
+	if !s.requireDownloadAccess(c, metadata.HasDownloadPassword, &metadata.DownloadPassword) {
+		return
+	}
+	if !requireScanCleared(c, fileStorage) {
+		return
+	}
+
+	// Archives are browsed through the archive API
+	if detectArchiveFormat(metadata.Filename) != "" {
+		c.Redirect(http.StatusFound, fmt.Sprintf("/api/archive/%s", fileID))
+		return
+	}
+	s.logFileAccess(c, fileID, accessPreview)
+
+	// The hex dump of the header works for any type, previewable or not
+	if c.Query("hex") == "true" {
+		s.serveHexPreview(c, fileStorage)
+		return
 	}
 
 	// Check if file type is previewable
 	log.Printf("previewFile: checking if %s (MIME: %s) is previewable", metadata.Filename, metadata.MimeType)
-	if !isPreviewable(metadata.MimeType) {
+	if !files.IsPreviewable(metadata.MimeType) {
 		log.Printf("previewFile: file type %s not previewable", metadata.MimeType)
 		c.JSON(http.StatusUnsupportedMediaType, gin.H{
 			"error":            "File type not previewable",
 			"message":          "This file type cannot be previewed in the browser. Please download the file to view it.",
 			"mime_type":        metadata.MimeType,
 			"suggested_action": "download",
+			"hex_preview_url":  fmt.Sprintf("/api/preview/%s?hex=true", fileID),
 		})
 		return
 	}
 
-	// Special handling for ZIP files - redirect to ZIP contents API
-	if metadata.MimeType == "application/zip" {
-		c.Redirect(http.StatusFound, fmt.Sprintf("/api/zip/%s", fileID))
+	// 3D models can be previewed through an embeddable viewer page, whatever their size
+	if isModelFile(metadata.MimeType) && c.Query("viewer") == "true" {
+		s.serveModelViewer(c, fileID, metadata)
+		return
+	}
+
+	// Optional variant with EXIF rotation applied, e.g. for thumbnails drawn on a canvas.
+	// Variants are dispatched before the range and streaming paths, which serve raw bytes.
+	if metadata.MimeType == "image/jpeg" && c.Query("orient") == "true" {
+		s.serveOrientedPreview(c, fileStorage, metadata)
+		return
+	}
+
+	// Fonts can be previewed as a rendered specimen image
+	if isFontFile(metadata.MimeType) && c.Query("specimen") == "true" {
+		s.serveFontSpecimen(c, fileStorage, metadata)
 		return
 	}
 
 	// Set appropriate headers for preview
 	c.Header("Content-Type", metadata.MimeType)
 	c.Header("Content-Length", strconv.FormatInt(metadata.Size, 10))
-	c.Header("Accept-Ranges", "bytes")
-
-	// Handle range requests for large files
-	rangeHeader := c.GetHeader("Range")
-	if rangeHeader != "" {
-		s.handleRangeRequestFromDB(c, fileStorage, metadata, rangeHeader)
+	s.setByteServingHeaders(c, fileStorage)
+	if notModified(c, fileStorage) {
 		return
 	}
 
-	// For media files, redirect to optimized streaming endpoint
-	if isMediaFile(metadata.MimeType) && metadata.Size > 5*1024*1024 { // 5MB threshold for media
-		// Add cache headers for media files
-		c.Header("Cache-Control", "public, max-age=3600")
-		c.Header("ETag", fmt.Sprintf("\"%s\"", fileID))
-		
-		// Check for conditional requests
-		if match := c.GetHeader("If-None-Match"); match != "" {
-			if strings.Trim(match, "\"") == fileID {
-				c.Status(http.StatusNotModified)
-				return
-			}
-		}
-		
-		s.streamContentFromDB(c, fileStorage, metadata)
+	// Handle range requests for large files
+	rangeSpec, partial, ok := resolveRange(c, fileStorage, metadata.Size)
+	if !ok {
 		return
 	}
-	
-	// For large images, also add cache headers
-	if isImageFile(metadata.MimeType) && metadata.Size > 1*1024*1024 { // 1MB threshold for images
-		c.Header("Cache-Control", "public, max-age=3600")
-		c.Header("ETag", fmt.Sprintf("\"%s\"", fileID))
-		
-		// Check for conditional requests
-		if match := c.GetHeader("If-None-Match"); match != "" {
-			if strings.Trim(match, "\"") == fileID {
-				c.Status(http.StatusNotModified)
-				return
-			}
-		}
+	if partial {
+		s.streamRangeFromDB(c, fileStorage, metadata, rangeSpec)
+		return
 	}
 
-	// For large files, use streaming
-	if metadata.Size > 10*1024*1024 { // 10MB threshold
+	// Stream media over 5MB and any file over 10MB instead of loading it
+	if (files.IsMediaFile(metadata.MimeType) && metadata.Size > 5*1024*1024) || metadata.Size > 10*1024*1024 {
 		s.streamContentFromDB(c, fileStorage, metadata)
 		return
 	}
@@ -763,7 +898,7 @@ func (s *FileService) previewFile(c *gin.Context) {
 	var content []byte
 	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
 		// Read from disk
-		diskContent, err := os.ReadFile(*fileStorage.StoragePath)
+		diskContent, err := readStoredFile(s.config, *fileStorage.StoragePath)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from disk"})
 			return
@@ -793,33 +928,23 @@ func (s *FileService) previewFile(c *gin.Context) {
 	c.Data(http.StatusOK, metadata.MimeType, content)
 }
 
-// handleRangeRequestFromDB handles range requests for files stored in database
-func (s *FileService) handleRangeRequestFromDB(c *gin.Context, fileStorage *FileStorage, metadata FileMetadata, rangeHeader string) {
-	// Parse range header
-	ranges, err := parseRangeHeader(rangeHeader, metadata.Size)
-	if err != nil {
-		c.Header("Content-Range", fmt.Sprintf("bytes */%d", metadata.Size))
-		c.Status(http.StatusRequestedRangeNotSatisfiable)
-		return
-	}
-
-	if len(ranges) != 1 {
-		// Multi-range not supported
-		c.Header("Content-Range", fmt.Sprintf("bytes */%d", metadata.Size))
-		c.Status(http.StatusRequestedRangeNotSatisfiable)
-		return
+// loadFileContent reads and decompresses the full content of a file from disk or PostgreSQL
+func (s *FileService) loadFileContent(fileStorage *FileStorage, metadata FileMetadata) ([]byte, error) {
+	stored := fileStorage.FileContent
+	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
+		diskContent, err := readStoredFile(s.config, *fileStorage.StoragePath)
+		if err != nil {
+			return nil, err
+		}
+		stored = diskContent
+	} else if stored == nil {
+		return nil, fmt.Errorf("file content not found")
 	}
+	return s.compressor.Decompress(stored, metadata.Compression)
+}
 
-	rangeSpec := ranges[0]
-	contentLength := rangeSpec.end - rangeSpec.start + 1
-
-	// Set headers for partial content
-	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeSpec.start, rangeSpec.end, metadata.Size))
-	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
-	c.Header("Content-Type", metadata.MimeType)
-	c.Header("Cache-Control", "public, max-age=3600")
-	c.Status(http.StatusPartialContent)
-
+// streamRangeFromDB sends one byte range of a file after resolveRange wrote the 206 headers
+func (s *FileService) streamRangeFromDB(c *gin.Context, fileStorage *FileStorage, metadata FileMetadata, rangeSpec files.Range) {
 	// Get file content and stream the requested range
 	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
 		s.streamRangeFromDisk(c, *fileStorage.StoragePath, metadata, rangeSpec)
@@ -837,14 +962,14 @@ func (s *FileService) handleRangeRequestFromDB(c *gin.Context, fileStorage *File
 		}
 
 		// Validate range
-		if rangeSpec.start >= int64(len(content)) || rangeSpec.end >= int64(len(content)) {
+		if rangeSpec.Start >= int64(len(content)) || rangeSpec.End >= int64(len(content)) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid range"})
 			return
 		}
 
 		// Stream the requested range
-		rangeContent := content[rangeSpec.start : rangeSpec.end+1]
-		if _, err := c.Writer.Write(rangeContent); err != nil {
+		rangeContent := content[rangeSpec.Start : rangeSpec.End+1]
+		if err := s.streamBytes(c, rangeContent, true); err != nil {
 			log.Printf("Error writing range response: %v", err)
 		}
 	}
@@ -877,14 +1002,21 @@ func (s *FileService) streamContentFromDB(c *gin.Context, fileStorage *FileStora
 		// Stream with buffer for better performance
 		reader := bytes.NewReader(content)
 		buffer := make([]byte, 1024*1024) // 1MB buffer
-		_, err = io.CopyBuffer(c.Writer, reader, buffer)
-		if err != nil {
+		if _, err := s.streamTo(c, reader, buffer, true); err != nil {
 			log.Printf("Error streaming file: %v", err)
 		}
 	}
 }
 
 // fastStreamFile provides optimized streaming for large media files
+//
+// @summary Stream a media file
+// @tags stream
+// @path id File ID
+// @header Range Byte range to stream
+// @success 200 application/octet-stream
+// @success 206 application/octet-stream
+// @auth downloadPassword adminToken optional
 func (s *FileService) fastStreamFile(c *gin.Context) {
 	// Note: No semaphore acquisition for streaming to allow unlimited concurrent streams
 	// Streaming is bandwidth-limited rather than CPU/memory intensive
@@ -893,7 +1025,7 @@ func (s *FileService) fastStreamFile(c *gin.Context) {
 	log.Printf("fastStreamFile called for fileID: %s", fileID)
 
 	// Get file metadata from PostgreSQL
-	fileStorage, err := s.db.GetFileMetadata(fileID)
+	fileStorage, err := s.lookupFile(fileID, false)
 	if err != nil {
 		log.Printf("Failed to get file metadata from database: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -929,35 +1061,22 @@ func (s *FileService) fastStreamFile(c *gin.Context) {
 	}
 
 	// Check if file has expired
-	if metadata.ExpiresAt.Before(time.Now()) {
+	if metadata.ExpiresAt.Before(s.clock.Now()) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File has expired"})
 		return
 	}
 
 	// Check download password if required
-	if metadata.HasDownloadPassword {
-		providedPassword := c.Query("password")
-		adminToken := c.Query("admin_token")
-		
-		isAdminAccess := false
-		if adminToken != "" {
-			if _, err := s.validateAdminToken(adminToken); err == nil {
-				isAdminAccess = true
-				log.Printf("Admin access granted for file %s", fileID)
-			}
-		}
-		
-		if !isAdminAccess && providedPassword != metadata.DownloadPassword {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Password required",
-				"message": "This file is password protected. Please provide the correct password.",
-			})
-			return
-		}
+	if !s.requireDownloadAccess(c, metadata.HasDownloadPassword, &metadata.DownloadPassword) {
+		return
 	}
+	if !requireScanCleared(c, fileStorage) {
+		return
+	}
+	s.logFileAccess(c, fileID, accessStream)
 
 	// Get file from PostgreSQL for streaming
-	fileStorageForStream, err := s.db.GetFile(fileID)
+	fileStorageForStream, err := s.lookupFile(fileID, true)
 	if err != nil {
 		log.Printf("Failed to get file for streaming: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -972,22 +1091,18 @@ func (s *FileService) fastStreamFile(c *gin.Context) {
 	// Set optimized headers for media streaming
 	c.Header("Content-Type", metadata.MimeType)
 	c.Header("Content-Length", strconv.FormatInt(metadata.Size, 10))
-	c.Header("Accept-Ranges", "bytes")
-	c.Header("Cache-Control", "public, max-age=3600")
-	c.Header("ETag", fmt.Sprintf("\"%s\"", fileID))
-
-	// Check for conditional requests (If-None-Match)
-	if match := c.GetHeader("If-None-Match"); match != "" {
-		if strings.Trim(match, "\"") == fileID {
-			c.Status(http.StatusNotModified)
-			return
-		}
+	s.setByteServingHeaders(c, fileStorageForStream)
+	if notModified(c, fileStorageForStream) {
+		return
 	}
 
 	// Handle range requests for media files
-	rangeHeader := c.GetHeader("Range")
-	if rangeHeader != "" {
-		s.handleRangeRequestFromDB(c, fileStorageForStream, metadata, rangeHeader)
+	rangeSpec, partial, ok := resolveRange(c, fileStorageForStream, metadata.Size)
+	if !ok {
+		return
+	}
+	if partial {
+		s.streamRangeFromDB(c, fileStorageForStream, metadata, rangeSpec)
 		return
 	}
 
@@ -1015,7 +1130,7 @@ func (s *FileService) streamMediaFromDisk(c *gin.Context, diskPath string, metad
 	// Open file directly for uncompressed files (media files are typically uncompressed)
 	if metadata.Compression == CompressionNone {
 		log.Printf("Attempting to open file at path: %s", diskPath)
-		file, err := os.Open(diskPath)
+		file, err := openStoredFile(s.config, diskPath, os.O_RDONLY)
 		if err != nil {
 			log.Printf("Failed to open file at path %s: %v", diskPath, err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -1034,8 +1149,7 @@ func (s *FileService) streamMediaFromDisk(c *gin.Context, diskPath string, metad
 
 		// Use larger buffer for media files (1MB for better throughput)
 		buffer := make([]byte, 1024*1024)
-		_, err = io.CopyBuffer(c.Writer, file, buffer)
-		if err != nil {
+		if _, err := s.streamTo(c, file, buffer, true); err != nil {
 			log.Printf("Error streaming media file: %v", err)
 		}
 		return
@@ -1074,8 +1188,7 @@ func (s *FileService) streamMediaFromRedis(c *gin.Context, compressedContent str
 	// Stream with larger buffer for media files
 	reader := bytes.NewReader(content)
 	buffer := make([]byte, 1024*1024) // 1MB buffer
-	_, err = io.CopyBuffer(c.Writer, reader, buffer)
-	if err != nil {
+	if _, err := s.streamTo(c, reader, buffer, true); err != nil {
 		log.Printf("Error streaming media file: %v", err)
 	}
 }
@@ -1083,7 +1196,7 @@ func (s *FileService) streamMediaFromRedis(c *gin.Context, compressedContent str
 // handleOptimizedRangeRequest handles range requests with optimizations for media files
 func (s *FileService) handleOptimizedRangeRequest(c *gin.Context, compressedContent string, metadata FileMetadata, rangeHeader string) {
 	// Parse range header
-	ranges, err := parseRangeHeader(rangeHeader, metadata.Size)
+	ranges, err := files.ParseRange(rangeHeader, metadata.Size)
 	if err != nil {
 		c.Header("Content-Range", fmt.Sprintf("bytes */%d", metadata.Size))
 		c.Status(http.StatusRequestedRangeNotSatisfiable)
@@ -1098,10 +1211,10 @@ func (s *FileService) handleOptimizedRangeRequest(c *gin.Context, compressedCont
 	}
 
 	rangeSpec := ranges[0]
-	contentLength := rangeSpec.end - rangeSpec.start + 1
+	contentLength := rangeSpec.End - rangeSpec.Start + 1
 
 	// Set headers for partial content
-	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeSpec.start, rangeSpec.end, metadata.Size))
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeSpec.Start, rangeSpec.End, metadata.Size))
 	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
 	c.Header("Content-Type", metadata.MimeType)
 	c.Header("Cache-Control", "public, max-age=3600")
@@ -1117,10 +1230,10 @@ func (s *FileService) handleOptimizedRangeRequest(c *gin.Context, compressedCont
 }
 
 // streamOptimizedRangeFromDisk optimized range streaming from disk
-func (s *FileService) streamOptimizedRangeFromDisk(c *gin.Context, diskPath string, metadata FileMetadata, rangeSpec Range) {
+func (s *FileService) streamOptimizedRangeFromDisk(c *gin.Context, diskPath string, metadata FileMetadata, rangeSpec files.Range) {
 	// For uncompressed files, seek directly (most efficient)
 	if metadata.Compression == CompressionNone {
-		file, err := os.Open(diskPath)
+		file, err := openStoredFile(s.config, diskPath, os.O_RDONLY)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
 			return
@@ -1128,15 +1241,17 @@ func (s *FileService) streamOptimizedRangeFromDisk(c *gin.Context, diskPath stri
 		defer file.Close()
 
 		// Seek to start position
-		if _, err := file.Seek(rangeSpec.start, 0); err != nil {
+		if _, err := file.Seek(rangeSpec.Start, 0); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to seek file"})
 			return
 		}
 
 		// Stream the requested range with optimized buffer
-		contentLength := rangeSpec.end - rangeSpec.start + 1
+		contentLength := rangeSpec.End - rangeSpec.Start + 1
 		buffer := make([]byte, 256*1024) // 256KB buffer for range requests
 		remaining := contentLength
+		sw := s.newStreamWriter(c, true)
+		defer sw.Close()
 
 		for remaining > 0 {
 			toRead := int64(len(buffer))
@@ -1154,7 +1269,7 @@ func (s *FileService) streamOptimizedRangeFromDisk(c *gin.Context, diskPath stri
 				break
 			}
 
-			if _, err := c.Writer.Write(buffer[:n]); err != nil {
+			if _, err := sw.Write(buffer[:n]); err != nil {
 				log.Printf("Error writing range response: %v", err)
 				return
 			}
@@ -1168,7 +1283,7 @@ func (s *FileService) streamOptimizedRangeFromDisk(c *gin.Context, diskPath stri
 }
 
 // streamOptimizedRangeFromRedis optimized range streaming from Redis
-func (s *FileService) streamOptimizedRangeFromRedis(c *gin.Context, compressedContent string, metadata FileMetadata, rangeSpec Range) {
+func (s *FileService) streamOptimizedRangeFromRedis(c *gin.Context, compressedContent string, metadata FileMetadata, rangeSpec files.Range) {
 	// Decompress if needed
 	var content []byte
 	var err error
@@ -1184,58 +1299,22 @@ func (s *FileService) streamOptimizedRangeFromRedis(c *gin.Context, compressedCo
 	}
 
 	// Validate range
-	if rangeSpec.start >= int64(len(content)) || rangeSpec.end >= int64(len(content)) {
+	if rangeSpec.Start >= int64(len(content)) || rangeSpec.End >= int64(len(content)) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid range"})
 		return
 	}
 
 	// Stream the requested range
-	rangeContent := content[rangeSpec.start : rangeSpec.end+1]
-	if _, err := c.Writer.Write(rangeContent); err != nil {
+	rangeContent := content[rangeSpec.Start : rangeSpec.End+1]
+	if err := s.streamBytes(c, rangeContent, true); err != nil {
 		log.Printf("Error writing range response: %v", err)
 	}
 }
 
-func isPreviewable(mimeType string) bool {
-	previewable := []string{
-		"image/", "text/", "application/json", "application/xml",
-		"video/", "audio/", "application/pdf", "application/zip",
-	}
-
-	for _, prefix := range previewable {
-		if strings.HasPrefix(mimeType, prefix) {
-			return true
-		}
-	}
-	return false
-}
-
-func isMediaFile(mimeType string) bool {
-	return strings.HasPrefix(mimeType, "video/") || strings.HasPrefix(mimeType, "audio/")
-}
-
-func isImageFile(mimeType string) bool {
-	return strings.HasPrefix(mimeType, "image/")
-}
-
-func (s *FileService) getMetadata(c *gin.Context) {
-	fileID := c.Param("id")
-
-	// Get file metadata from PostgreSQL
-	fileStorage, err := s.db.GetFileMetadata(fileID)
-	if err != nil {
-		log.Printf("Failed to get file metadata: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-	
-	if fileStorage == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found or expired"})
-		return
-	}
-
-	// Convert to safe metadata (don't expose passwords)
-	safeMetadata := FileMetadata{
+// publicMetadata is the metadata of a stored file that anyone may see, without its
+// passwords and content hash
+func publicMetadata(fileStorage *FileStorage) FileMetadata {
+	metadata := FileMetadata{
 		ID:                  fileStorage.ID,
 		Filename:            fileStorage.Filename,
 		Size:                fileStorage.OriginalSize,
@@ -1245,302 +1324,70 @@ func (s *FileService) getMetadata(c *gin.Context) {
 		UploadTime:          fileStorage.UploadTime,
 		ExpiresAt:           fileStorage.ExpiresAt,
 		HasDownloadPassword: fileStorage.HasDownloadPassword,
+		Image:               fileStorage.ImageInfo,
+		StorageClass:        StorageClass(fileStorage.StorageClass),
+		Scan:                fileStorage.ScanResult,
+		Accessibility:       fileStorage.Accessibility,
+		Tags:                fileStorage.Tags,
 	}
-	
-	if fileStorage.CompressedSize != nil {
-		safeMetadata.CompressedSize = *fileStorage.CompressedSize
-	}
-
-	c.JSON(http.StatusOK, safeMetadata)
-}
-
-func (s *FileService) browseZip(c *gin.Context) {
-	fileID := c.Param("id")
-
-	// Get file from PostgreSQL
-	fileStorage, err := s.db.GetFile(fileID)
-	if err != nil {
-		log.Printf("Failed to get file from database: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-	
-	if fileStorage == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
-	}
-
-	// Convert database record to metadata
-	metadata := FileMetadata{
-		ID:                  fileStorage.ID,
-		Filename:           fileStorage.Filename,
-		Size:               fileStorage.OriginalSize,
-		CompressedSize:     0,
-		MimeType:           fileStorage.MimeType,
-		Compression:        CompressionType(fileStorage.CompressionType),
-		UploadTime:         fileStorage.UploadTime,
-		ExpiresAt:          fileStorage.ExpiresAt,
-		DeletePassword:     fileStorage.DeletePassword,
-		DownloadPassword:   "",
-		HasDownloadPassword: fileStorage.HasDownloadPassword,
-	}
-	
 	if fileStorage.CompressedSize != nil {
 		metadata.CompressedSize = *fileStorage.CompressedSize
 	}
-	
-	if fileStorage.DownloadPassword != nil {
-		metadata.DownloadPassword = *fileStorage.DownloadPassword
-	}
-
-	// Check if file has expired
-	if metadata.ExpiresAt.Before(time.Now()) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File has expired"})
-		return
-	}
-
-	// Check if file is a ZIP
-	if !strings.HasSuffix(strings.ToLower(metadata.Filename), ".zip") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a ZIP archive"})
-		return
-	}
-
-	// Get file content based on storage type
-	var content []byte
-	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
-		// Read from disk
-		diskContent, err := os.ReadFile(*fileStorage.StoragePath)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from disk"})
-			return
-		}
-
-		// Decompress file
-		content, err = s.compressor.Decompress(diskContent, metadata.Compression)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decompress file"})
-			return
-		}
-	} else {
-		// Read from PostgreSQL
-		if fileStorage.FileContent == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File content not found"})
-			return
-		}
-
-		// Decompress file
-		content, err = s.compressor.Decompress(fileStorage.FileContent, metadata.Compression)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decompress file"})
-			return
-		}
-	}
+	return metadata
+}
 
-	// Read ZIP contents
-	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+// getMetadata returns the public metadata of a file. The content hash of a protected file
+// is only included with its download password.
+//
+// @summary Get the metadata of a file
+// @tags file
+// @path id File ID
+// @success 200 FileMetadata
+// @auth downloadPassword adminToken optional
+func (s *FileService) getMetadata(c *gin.Context) {
+	metadata, err := s.fileMetadata(c.Param("id"), c.Query("password"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read ZIP archive"})
+		err.respond(c)
 		return
 	}
-
-	// Extract file list
-	var files []map[string]interface{}
-	for _, file := range zipReader.File {
-		// Try to detect and convert encoding of filename
-		fileName := detectAndConvertFilename(file.Name)
-
-		fileInfo := map[string]interface{}{
-			"name":       fileName,
-			"size":       file.UncompressedSize64,
-			"compressed": file.CompressedSize64,
-			"modified":   file.Modified,
-			"is_dir":     file.FileInfo().IsDir(),
-			"method":     file.Method,
-		}
-		files = append(files, fileInfo)
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"filename": metadata.Filename,
-		"files":    files,
-		"total":    len(files),
-	})
+	c.JSON(http.StatusOK, metadata)
 }
 
-func (s *FileService) extractZipFile(c *gin.Context) {
-	log.Printf("extractZipFile function called")
-	fileID := c.Param("id")
-	fileName := c.Query("filename")
-
-	if fileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "filename parameter is required"})
-		return
-	}
-
-	log.Printf("Extracting file '%s' from ZIP %s", fileName, fileID)
-
-	// Get file from PostgreSQL
-	fileStorage, err := s.db.GetFile(fileID)
+// fileMetadata returns the public metadata of a file, with its content hash and access
+// totals when password is its download password
+func (s *FileService) fileMetadata(fileID, password string) (*FileMetadata, *apiError) {
+	// Get file metadata from PostgreSQL
+	fileStorage, err := s.lookupFile(fileID, false)
 	if err != nil {
-		log.Printf("Failed to get file from database: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+		log.Printf("Failed to get file metadata: %v", err)
+		return nil, newAPIError(http.StatusInternalServerError, "Database error")
 	}
 	
 	if fileStorage == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
-	}
-
-	// Convert database record to metadata
-	metadata := FileMetadata{
-		ID:                  fileStorage.ID,
-		Filename:           fileStorage.Filename,
-		Size:               fileStorage.OriginalSize,
-		CompressedSize:     0,
-		MimeType:           fileStorage.MimeType,
-		Compression:        CompressionType(fileStorage.CompressionType),
-		UploadTime:         fileStorage.UploadTime,
-		ExpiresAt:          fileStorage.ExpiresAt,
-		DeletePassword:     fileStorage.DeletePassword,
-		DownloadPassword:   "",
-		HasDownloadPassword: fileStorage.HasDownloadPassword,
-	}
-	
-	if fileStorage.CompressedSize != nil {
-		metadata.CompressedSize = *fileStorage.CompressedSize
-	}
-	
-	if fileStorage.DownloadPassword != nil {
-		metadata.DownloadPassword = *fileStorage.DownloadPassword
-	}
-
-	// Check if file has expired
-	if metadata.ExpiresAt.Before(time.Now()) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File has expired"})
-		return
-	}
-
-	// Check if file is a ZIP
-	if !strings.HasSuffix(strings.ToLower(metadata.Filename), ".zip") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a ZIP archive"})
-		return
-	}
-
-	// Get file content based on storage type
-	var content []byte
-	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
-		// Read from disk
-		diskContent, err := os.ReadFile(*fileStorage.StoragePath)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from disk"})
-			return
-		}
-
-		// Decompress file
-		content, err = s.compressor.Decompress(diskContent, metadata.Compression)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decompress file"})
-			return
-		}
-	} else {
-		// Read from PostgreSQL
-		if fileStorage.FileContent == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "File content not found"})
-			return
-		}
-
-		// Decompress file
-		content, err = s.compressor.Decompress(fileStorage.FileContent, metadata.Compression)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decompress file"})
-			return
-		}
+		return nil, newAPIError(http.StatusNotFound, "File not found or expired")
 	}
 
-	// Read ZIP contents
-	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read ZIP archive"})
-		return
-	}
+	// Convert to safe metadata (don't expose passwords)
+	safeMetadata := publicMetadata(fileStorage)
 
-	// Find the requested file
-	var targetFile *zip.File
-	for _, file := range zipReader.File {
-		convertedName := detectAndConvertFilename(file.Name)
-		// Debug log for troubleshooting
-		log.Printf("Comparing requested '%s' with ZIP file '%s' (converted: '%s')", fileName, file.Name, convertedName)
-		if convertedName == fileName || file.Name == fileName {
-			targetFile = file
-			break
-		}
+	// The hash fingerprints the content, so protected files only reveal it with the password
+	passwordVerified := !fileStorage.HasDownloadPassword ||
+		(fileStorage.DownloadPassword != nil && password == *fileStorage.DownloadPassword)
+	if fileStorage.ContentHash != nil && passwordVerified {
+		safeMetadata.SHA256 = *fileStorage.ContentHash
 	}
+	safeMetadata.Org = s.orgBranding(fileStorage)
 
-	if targetFile == nil {
-		// Enhanced error message with available files
-		var availableFiles []string
-		for _, file := range zipReader.File {
-			availableFiles = append(availableFiles, detectAndConvertFilename(file.Name))
+	// Access totals are left out rather than failing the request
+	if passwordVerified {
+		if counts, err := s.db.GetFileAccessCounts(fileID); err != nil {
+			log.Printf("Failed to count accesses of %s: %v", fileID, err)
+		} else {
+			safeMetadata.Accesses = counts
 		}
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":           "File not found in ZIP archive",
-			"requested_file":  fileName,
-			"available_files": availableFiles,
-		})
-		return
-	}
-
-	// Check if it's a directory
-	if targetFile.FileInfo().IsDir() {
-		log.Printf("Target file is a directory")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot preview directory"})
-		return
-	}
-	log.Printf("Target file is not a directory, proceeding to open")
-
-	// Open the file from ZIP
-	rc, err := targetFile.Open()
-	if err != nil {
-		log.Printf("Failed to open file from ZIP: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file from ZIP"})
-		return
-	}
-	defer rc.Close()
-	log.Printf("File opened successfully from ZIP")
-
-	// Read file content
-	fileContent, err := io.ReadAll(rc)
-	if err != nil {
-		log.Printf("Failed to read file content: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file content"})
-		return
 	}
-	log.Printf("File content read successfully, size: %d bytes", len(fileContent))
-
-	// Determine MIME type
-	convertedName := detectAndConvertFilename(targetFile.Name)
-	log.Printf("About to call GetMimeType with: %s", convertedName)
-	mimeType := GetMimeType(convertedName)
-	log.Printf("GetMimeType returned: %s", mimeType)
-	log.Printf("File: %s, Converted name: %s, MIME type: %s", targetFile.Name, convertedName, mimeType)
 
-	// Check if file type is previewable
-	if !isPreviewable(mimeType) {
-		c.JSON(http.StatusUnsupportedMediaType, gin.H{
-			"error":     "File type not previewable",
-			"message":   "This file type cannot be previewed in the browser.",
-			"mime_type": mimeType,
-		})
-		return
-	}
-
-	// Set appropriate headers for preview
-	c.Header("Content-Type", mimeType)
-	c.Header("Content-Length", strconv.FormatInt(int64(len(fileContent)), 10))
-	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s", detectAndConvertFilename(targetFile.Name)))
-
-	c.Data(http.StatusOK, mimeType, fileContent)
+	return &safeMetadata, nil
 }
 
 // streamFileContent streams large files to avoid memory issues
@@ -1559,7 +1406,7 @@ func (s *FileService) streamFileContent(c *gin.Context, compressedContent string
 func (s *FileService) streamFromDisk(c *gin.Context, diskPath string, metadata FileMetadata) {
 	// Open compressed file
 	log.Printf("Opening file from disk: %s", diskPath)
-	file, err := os.Open(diskPath)
+	file, err := openStoredFile(s.config, diskPath, os.O_RDONLY)
 	if err != nil {
 		log.Printf("Failed to open file from disk %s: %v", diskPath, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1606,8 +1453,7 @@ func (s *FileService) streamFromDisk(c *gin.Context, diskPath string, metadata F
 
 	// Copy with buffering to control memory usage
 	buffer := make([]byte, 64*1024) // 64KB buffer
-	_, err = io.CopyBuffer(c.Writer, reader, buffer)
-	if err != nil {
+	if _, err := s.streamTo(c, reader, buffer, false); err != nil {
 		log.Printf("Error streaming file: %v", err)
 	}
 }
@@ -1629,8 +1475,7 @@ func (s *FileService) streamFromRedis(c *gin.Context, compressedContent string,
 	// Write in chunks to avoid memory spikes
 	reader := bytes.NewReader(content)
 	buffer := make([]byte, 64*1024) // 64KB buffer
-	_, err = io.CopyBuffer(c.Writer, reader, buffer)
-	if err != nil {
+	if _, err := s.streamTo(c, reader, buffer, false); err != nil {
 		log.Printf("Error streaming file: %v", err)
 	}
 }
@@ -1638,7 +1483,7 @@ func (s *FileService) streamFromRedis(c *gin.Context, compressedContent string,
 // handleRangeRequest handles HTTP Range requests for partial content
 func (s *FileService) handleRangeRequest(c *gin.Context, compressedContent string, metadata FileMetadata, rangeHeader string) {
 	// Parse range header
-	ranges, err := parseRangeHeader(rangeHeader, metadata.Size)
+	ranges, err := files.ParseRange(rangeHeader, metadata.Size)
 	if err != nil {
 		c.Header("Content-Range", fmt.Sprintf("bytes */%d", metadata.Size))
 		c.Status(http.StatusRequestedRangeNotSatisfiable)
@@ -1653,10 +1498,10 @@ func (s *FileService) handleRangeRequest(c *gin.Context, compressedContent strin
 	}
 
 	rangeSpec := ranges[0]
-	contentLength := rangeSpec.end - rangeSpec.start + 1
+	contentLength := rangeSpec.End - rangeSpec.Start + 1
 
 	// Set headers for partial content
-	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeSpec.start, rangeSpec.end, metadata.Size))
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeSpec.Start, rangeSpec.End, metadata.Size))
 	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
 	c.Header("Content-Type", metadata.MimeType)
 	c.Status(http.StatusPartialContent)
@@ -1670,83 +1515,13 @@ func (s *FileService) handleRangeRequest(c *gin.Context, compressedContent strin
 	}
 }
 
-// Range represents a byte range
-type Range struct {
-	start int64
-	end   int64
-}
-
-// parseRangeHeader parses HTTP Range header
-func parseRangeHeader(rangeHeader string, fileSize int64) ([]Range, error) {
-	// Remove "bytes=" prefix
-	rangeHeader = strings.TrimPrefix(rangeHeader, "bytes=")
-	
-	// Parse range specifications
-	rangeSpecs := strings.Split(rangeHeader, ",")
-	var ranges []Range
-	
-	for _, spec := range rangeSpecs {
-		spec = strings.TrimSpace(spec)
-		if spec == "" {
-			continue
-		}
-		
-		// Parse individual range spec
-		if strings.HasPrefix(spec, "-") {
-			// Suffix range: -500 (last 500 bytes)
-			suffix, err := strconv.ParseInt(spec[1:], 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid range suffix: %s", spec)
-			}
-			start := fileSize - suffix
-			if start < 0 {
-				start = 0
-			}
-			ranges = append(ranges, Range{start: start, end: fileSize - 1})
-		} else if strings.HasSuffix(spec, "-") {
-			// Start range: 500- (from byte 500 to end)
-			start, err := strconv.ParseInt(spec[:len(spec)-1], 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid range start: %s", spec)
-			}
-			if start >= fileSize {
-				return nil, fmt.Errorf("range start beyond file size")
-			}
-			ranges = append(ranges, Range{start: start, end: fileSize - 1})
-		} else {
-			// Full range: 500-1000
-			parts := strings.Split(spec, "-")
-			if len(parts) != 2 {
-				return nil, fmt.Errorf("invalid range format: %s", spec)
-			}
-			start, err := strconv.ParseInt(parts[0], 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid range start: %s", parts[0])
-			}
-			end, err := strconv.ParseInt(parts[1], 10, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid range end: %s", parts[1])
-			}
-			if start > end || start >= fileSize {
-				return nil, fmt.Errorf("invalid range: %d-%d", start, end)
-			}
-			if end >= fileSize {
-				end = fileSize - 1
-			}
-			ranges = append(ranges, Range{start: start, end: end})
-		}
-	}
-	
-	return ranges, nil
-}
-
 // streamRangeFromDisk streams a specific range from disk
-func (s *FileService) streamRangeFromDisk(c *gin.Context, diskPath string, metadata FileMetadata, rangeSpec Range) {
+func (s *FileService) streamRangeFromDisk(c *gin.Context, diskPath string, metadata FileMetadata, rangeSpec files.Range) {
 	// For compressed files, we need to decompress first (less efficient for ranges)
 	// In a production system, consider storing large files uncompressed for better range support
 	if metadata.Compression != CompressionNone {
 		// Decompress entire file first (not ideal but necessary for compressed files)
-		file, err := os.Open(diskPath)
+		file, err := openStoredFile(s.config, diskPath, os.O_RDONLY)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
 			return
@@ -1760,13 +1535,15 @@ func (s *FileService) streamRangeFromDisk(c *gin.Context, diskPath string, metad
 		}
 
 		// Stream the requested range
-		rangeContent := content[rangeSpec.start : rangeSpec.end+1]
-		c.Writer.Write(rangeContent)
+		rangeContent := content[rangeSpec.Start : rangeSpec.End+1]
+		if err := s.streamBytes(c, rangeContent, true); err != nil {
+			log.Printf("Error writing range response: %v", err)
+		}
 		return
 	}
 
 	// For uncompressed files, we can seek directly
-	file, err := os.Open(diskPath)
+	file, err := openStoredFile(s.config, diskPath, os.O_RDONLY)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
 		return
@@ -1774,15 +1551,17 @@ func (s *FileService) streamRangeFromDisk(c *gin.Context, diskPath string, metad
 	defer file.Close()
 
 	// Seek to start position
-	if _, err := file.Seek(rangeSpec.start, 0); err != nil {
+	if _, err := file.Seek(rangeSpec.Start, 0); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to seek file"})
 		return
 	}
 
 	// Stream the requested range
-	contentLength := rangeSpec.end - rangeSpec.start + 1
+	contentLength := rangeSpec.End - rangeSpec.Start + 1
 	buffer := make([]byte, 64*1024) // 64KB buffer
 	remaining := contentLength
+	sw := s.newStreamWriter(c, true)
+	defer sw.Close()
 
 	for remaining > 0 {
 		toRead := int64(len(buffer))
@@ -1800,13 +1579,16 @@ func (s *FileService) streamRangeFromDisk(c *gin.Context, diskPath string, metad
 			break
 		}
 
-		c.Writer.Write(buffer[:n])
+		if _, err := sw.Write(buffer[:n]); err != nil {
+			log.Printf("Error writing range response: %v", err)
+			return
+		}
 		remaining -= int64(n)
 	}
 }
 
 // streamRangeFromRedis streams a specific range from Redis
-func (s *FileService) streamRangeFromRedis(c *gin.Context, compressedContent string, metadata FileMetadata, rangeSpec Range) {
+func (s *FileService) streamRangeFromRedis(c *gin.Context, compressedContent string, metadata FileMetadata, rangeSpec files.Range) {
 	// Decompress content
 	content, err := s.compressor.Decompress([]byte(compressedContent), metadata.Compression)
 	if err != nil {
@@ -1815,8 +1597,10 @@ func (s *FileService) streamRangeFromRedis(c *gin.Context, compressedContent str
 	}
 
 	// Stream the requested range
-	rangeContent := content[rangeSpec.start : rangeSpec.end+1]
-	c.Writer.Write(rangeContent)
+	rangeContent := content[rangeSpec.Start : rangeSpec.End+1]
+	if err := s.streamBytes(c, rangeContent, true); err != nil {
+		log.Printf("Error writing range response: %v", err)
+	}
 }
 
 // readFileContent reads all content from a file
@@ -1830,12 +1614,14 @@ func readFileContent(file *os.File) []byte {
 }
 
 type UpdateExpirationRequest struct {
-	AdminPassword string `json:"admin_password"`
-	ExpiresAt     string `json:"expires_at"`
+	ExpiresAt string `json:"expires_at"`
 }
 
 type AdminRequest struct {
 	AdminPassword string `json:"admin_password"`
+
+	// Directory account signing in with AUTH_PROVIDER=ldap, whose password is AdminPassword
+	Username string `json:"username,omitempty"`
 }
 
 type AdminAuthResponse struct {
@@ -1843,74 +1629,30 @@ type AdminAuthResponse struct {
 	ExpiresAt int64  `json:"expires_at"`
 }
 
-type AdminClaims struct {
-	IsAdmin bool `json:"is_admin"`
-	jwt.RegisteredClaims
-}
-
-var jwtSecret = []byte("admin-jwt-secret-key-change-in-production")
-
-func (s *FileService) generateAdminToken() (string, int64, error) {
-	expirationTime := time.Now().Add(2 * time.Hour)
-	claims := &AdminClaims{
-		IsAdmin: true,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   "admin",
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		return "", 0, err
-	}
-
-	return tokenString, expirationTime.Unix(), nil
-}
-
-func (s *FileService) validateAdminToken(tokenString string) (*AdminClaims, error) {
-	claims := &AdminClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if !token.Valid || !claims.IsAdmin {
-		return nil, fmt.Errorf("invalid admin token")
-	}
-
-	return claims, nil
-}
-
+// adminAuth exchanges the admin password, or directory credentials with AUTH_PROVIDER=ldap,
+// for an admin token
+//
+// @summary Sign in as admin
+// @tags admin
+// @body json AdminRequest
+// @success 200 AdminAuthResponse
 func (s *FileService) adminAuth(c *gin.Context) {
 	var req AdminRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	if !bindAdminRequest(c, &req) {
 		return
 	}
 
-	if s.config.AdminPassword == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":   "Admin functionality not configured",
-			"message": "ADMIN_PASSWORD environment variable not set",
-		})
-		return
-	}
-
-	if req.AdminPassword != s.config.AdminPassword {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "Invalid admin password",
-			"message": "The provided admin password is incorrect",
-		})
+	subject := "admin"
+	if s.ldap != nil && req.Username != "" {
+		if subject = s.ldapAdminLogin(c, req.Username, req.AdminPassword); subject == "" {
+			return
+		}
+	} else if err := s.adminPasswordError(req.AdminPassword); err != nil {
+		err.respond(c)
 		return
 	}
 
-	token, expiresAt, err := s.generateAdminToken()
+	token, expiresAt, err := s.adminTokens.IssueFor(subject)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -1922,29 +1664,19 @@ func (s *FileService) adminAuth(c *gin.Context) {
 	})
 }
 
+// updateFileExpiration lets admins set the expiry of any file, without the owner's limits
+//
+// @summary Change when a file expires
+// @tags admin
+// @path id File ID
+// @body json UpdateExpirationRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
 func (s *FileService) updateFileExpiration(c *gin.Context) {
 	fileID := c.Param("id")
-	ctx := context.Background()
 
 	var req UpdateExpirationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-
-	if s.config.AdminPassword == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Admin functionality not configured",
-			"message": "ADMIN_PASSWORD environment variable not set",
-		})
-		return
-	}
-
-	if req.AdminPassword != s.config.AdminPassword {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid admin password",
-			"message": "The provided admin password is incorrect",
-		})
+	if !bindAdminRequest(c, &req) {
 		return
 	}
 
@@ -1957,34 +1689,50 @@ func (s *FileService) updateFileExpiration(c *gin.Context) {
 		return
 	}
 
+	metadata, oldExpiresAt, apiErr := s.setFileExpiration(fileID, expiresAt)
+	if apiErr != nil {
+		apiErr.respond(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "File expiration updated successfully",
+		"file_id": fileID,
+		"old_expires_at": oldExpiresAt,
+		"new_expires_at": expiresAt,
+		"metadata": metadata,
+	})
+}
+
+// setFileExpiration changes when a file expires for an admin, returning its metadata with
+// the passwords and when it expired before
+func (s *FileService) setFileExpiration(fileID string, expiresAt time.Time) (*FileMetadata, time.Time, *apiError) {
+	ctx := context.Background()
+
 	// Get file metadata from PostgreSQL
 	fileStorage, err := s.db.GetFileMetadata(fileID)
 	if err != nil {
 		log.Printf("Failed to get file metadata: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+		return nil, time.Time{}, newAPIError(http.StatusInternalServerError, "Database error")
 	}
 	
 	if fileStorage == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
+		return nil, time.Time{}, newAPIError(http.StatusNotFound, "File not found")
 	}
 
 	oldExpiresAt := fileStorage.ExpiresAt
 
 	newExpiration := time.Until(expiresAt)
 	if newExpiration <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid expiration time",
+		return nil, time.Time{}, &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error":   "Invalid expiration time",
 			"message": "Expiration time must be in the future",
-		})
-		return
+		}}
 	}
 
 	// Update expiration in PostgreSQL
 	if err := s.db.UpdateFileExpiration(fileID, expiresAt); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file expiration"})
-		return
+		return nil, time.Time{}, newAPIError(http.StatusInternalServerError, "Failed to update file expiration")
 	}
 
 	// Update Redis cache if it exists (optional)
@@ -2015,103 +1763,68 @@ func (s *FileService) updateFileExpiration(c *gin.Context) {
 		s.redis.Set(ctx, "file:"+fileID, updatedMetadataJSON, newExpiration)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "File expiration updated successfully",
-		"file_id": fileID,
-		"old_expires_at": oldExpiresAt,
-		"new_expires_at": expiresAt,
-		"metadata": metadata,
-	})
+	return &metadata, oldExpiresAt, nil
 }
 
+// adminDeleteFile deletes any file, moving it to the trash like deleteFile
+//
+// @summary Delete a file
+// @tags admin
+// @path id File ID
+// @success 200 json
+// @auth adminToken adminPassword
 func (s *FileService) adminDeleteFile(c *gin.Context) {
 	fileID := c.Param("id")
 
-	var req AdminRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-
-	if s.config.AdminPassword == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Admin functionality not configured",
-			"message": "ADMIN_PASSWORD environment variable not set",
-		})
+	fileStorage, restorableUntil, err := s.deleteAnyFile(fileID, c.ClientIP())
+	if err != nil {
+		err.respond(c)
 		return
 	}
 
-	if req.AdminPassword != s.config.AdminPassword {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid admin password",
-			"message": "The provided admin password is incorrect",
-		})
-		return
-	}
+	response := deletedResponse(fileID, restorableUntil)
+	response["file_id"] = fileID
+	response["filename"] = fileStorage.Filename
+	c.JSON(http.StatusOK, response)
+}
 
+// deleteAnyFile deletes a file for an admin, returning it and until when it can be
+// restored from the trash
+func (s *FileService) deleteAnyFile(fileID, ipAddress string) (*FileStorage, *time.Time, *apiError) {
 	// Get file metadata from PostgreSQL
 	fileStorage, err := s.db.GetFileMetadata(fileID)
 	if err != nil {
 		log.Printf("Failed to get file metadata: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+		return nil, nil, newAPIError(http.StatusInternalServerError, "Database error")
 	}
 	
 	if fileStorage == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
+		return nil, nil, newAPIError(http.StatusNotFound, "File not found")
 	}
 
-	// Delete from PostgreSQL
-	if err := s.db.DeleteFile(fileID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file from database"})
-		return
+	restorableUntil, apiErr := s.removeFile(fileStorage, ipAddress)
+	if apiErr != nil {
+		return nil, nil, apiErr
 	}
-
-	// Delete disk file if it exists
-	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
-		if err := os.Remove(*fileStorage.StoragePath); err != nil && !os.IsNotExist(err) {
-			log.Printf("Failed to delete file from disk: %v", err)
-		}
-	}
-
-	// Remove from Redis cache (optional cleanup)
-	s.redis.Del(context.Background(), "file:"+fileID)
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "File deleted successfully",
-		"file_id": fileID,
-		"filename": fileStorage.Filename,
-	})
+	return fileStorage, restorableUntil, nil
 }
 
 type UpdatePasswordRequest struct {
-	AdminPassword string `json:"admin_password"`
-	FileID        string `json:"file_id"`
-	NewPassword   string `json:"new_password"`
-	PasswordType  string `json:"password_type"` // "download" or "delete"
+	FileID       string `json:"file_id"`
+	NewPassword  string `json:"new_password"`
+	PasswordType string `json:"password_type"` // "download" or "delete"
 }
 
+// updateFilePassword lets admins set or remove the download password of any file
+//
+// @summary Set or remove the download password of a file
+// @tags admin
+// @body json UpdatePasswordRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
 func (s *FileService) updateFilePassword(c *gin.Context) {
 	var req UpdatePasswordRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-
-	if s.config.AdminPassword == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Admin functionality not configured",
-			"message": "ADMIN_PASSWORD environment variable not set",
-		})
-		return
-	}
-
-	if req.AdminPassword != s.config.AdminPassword {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid admin password",
-			"message": "The provided admin password is incorrect",
-		})
+	if !bindAdminRequest(c, &req) {
 		return
 	}
 
@@ -2161,63 +1874,122 @@ func (s *FileService) updateFilePassword(c *gin.Context) {
 	})
 }
 
-func (s *FileService) getAdminFileList(c *gin.Context) {
-	ctx := context.Background()
+// AdminFileListRequest pages, filters and sorts the admin file list
+type AdminFileListRequest struct {
+	Search      string `json:"search,omitempty"`       // Filename substring, case-insensitive
+	MimeType    string `json:"mime_type,omitempty"`    // Exact type, or a prefix like "image/"
+	StorageType string `json:"storage_type,omitempty"` // "postgresql" or "disk"
+	Sort        string `json:"sort,omitempty"`         // uploaded_at, expires_at, filename or size
+	Order       string `json:"order,omitempty"`        // "asc" or "desc" (default)
+	Limit       int    `json:"limit,omitempty"`
+	Offset      int    `json:"offset,omitempty"`
+}
 
-	var req AdminRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
+// query validates the request and turns it into a database query
+func (req *AdminFileListRequest) query() (FileListQuery, error) {
+	query := FileListQuery{
+		Search:      strings.TrimSpace(req.Search),
+		MimeType:    strings.ToLower(strings.TrimSpace(req.MimeType)),
+		StorageType: req.StorageType,
+		SortBy:      req.Sort,
+		Limit:       req.Limit,
+		Offset:      req.Offset,
+	}
+	if query.SortBy == "" {
+		query.SortBy = "uploaded_at"
+	}
+	if _, ok := fileListSortColumns[query.SortBy]; !ok {
+		return query, fmt.Errorf("sort must be one of uploaded_at, expires_at, filename or size")
+	}
+	switch req.Order {
+	case "", "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
+	if query.StorageType != "" && query.StorageType != "postgresql" && query.StorageType != "disk" {
+		return query, fmt.Errorf("storage_type must be postgresql or disk")
+	}
+	if query.Offset < 0 {
+		return query, fmt.Errorf("offset must not be negative")
+	}
+	switch {
+	case query.Limit <= 0:
+		query.Limit = 100
+	case query.Limit > 1000:
+		query.Limit = 1000
 	}
+	return query, nil
+}
 
-	if s.config.AdminPassword == "" {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error": "Admin functionality not configured",
-			"message": "ADMIN_PASSWORD environment variable not set",
-		})
+// getAdminFileList lists the stored files a page at a time, searched, filtered and sorted as
+// requested
+//
+// @summary List files
+// @tags admin
+// @body json AdminFileListRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getAdminFileList(c *gin.Context) {
+	var req AdminFileListRequest
+	if !bindAdminRequest(c, &req) {
 		return
 	}
 
-	if req.AdminPassword != s.config.AdminPassword {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid admin password",
-			"message": "The provided admin password is incorrect",
-		})
+	list, err := s.listFiles(&req)
+	if err != nil {
+		err.respond(c)
 		return
 	}
+	c.JSON(http.StatusOK, list)
+}
 
-	// Get all files from PostgreSQL database
-	query := `
-		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
-			   storage_type, storage_path, upload_time, expires_at, has_download_password
-		FROM files 
-		WHERE expires_at > NOW()
-		ORDER BY upload_time DESC
-	`
-	
-	rows, err := s.db.Pool.Query(ctx, query)
+// AdminFileList is a page of the admin file list
+type AdminFileList struct {
+	Message string          `json:"message"`
+	Count   int             `json:"count"`
+	Total   int             `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	HasMore bool            `json:"has_more"`
+	Files   []AdminFileInfo `json:"files"`
+}
+
+// AdminFileInfo is a file of the admin file list
+type AdminFileInfo struct {
+	FileID       string    `json:"file_id"`
+	Filename     string    `json:"filename"`
+	Size         int64     `json:"size"` // Bytes stored
+	OriginalSize int64     `json:"original_size"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	StorageType  string    `json:"storage_type"` // "postgresql" or "disk"
+	StoragePath  *string   `json:"storage_path"` // Disk path if applicable
+	Compressed   bool      `json:"compressed"`
+	Compression  string    `json:"compression"`
+	MimeType     string    `json:"mime_type"`
+	HasPassword  bool      `json:"has_password"`
+}
+
+// listFiles returns the page of the admin file list a request asks for
+func (s *FileService) listFiles(req *AdminFileListRequest) (*AdminFileList, *apiError) {
+	query, err := req.query()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve file list from database"})
-		return
+		return nil, newAPIError(http.StatusBadRequest, err.Error())
 	}
-	defer rows.Close()
 
-	files := make([]map[string]interface{}, 0)
+	activeFiles, total, err := s.db.ListActiveFiles(query)
+	if err != nil {
+		log.Printf("Failed to list files: %v", err)
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to retrieve file list from database")
+	}
 
-	for rows.Next() {
-		var fileID, filename, mimeType, compressionType, storageType string
-		var originalSize int64
-		var compressedSize *int64
-		var storagePath *string
-		var uploadTime, expiresAt time.Time
-		var hasDownloadPassword bool
+	files := make([]AdminFileInfo, 0, len(activeFiles))
 
-		err := rows.Scan(&fileID, &filename, &originalSize, &compressedSize, &mimeType, 
-			&compressionType, &storageType, &storagePath, &uploadTime, &expiresAt, &hasDownloadPassword)
-		if err != nil {
-			log.Printf("Failed to scan file row: %v", err)
-			continue
-		}
+	for _, file := range activeFiles {
+		fileID, originalSize, compressedSize := file.ID, file.OriginalSize, file.CompressedSize
+		storageType, storagePath, compressionType := file.StorageType, file.StoragePath, file.CompressionType
 
 		// Get actual file size and storage info
 		var actualFileSize int64
@@ -2246,25 +2018,29 @@ func (s *FileService) getAdminFileList(c *gin.Context) {
 			compressed = false
 		}
 
-		files = append(files, map[string]interface{}{
-			"file_id":       fileID,
-			"filename":      filename,
-			"size":          actualFileSize,
-			"original_size": originalSize,
-			"uploaded_at":   uploadTime,
-			"expires_at":    expiresAt,
-			"storage_type":  storageType, // "postgresql" or "disk"
-			"storage_path":  storagePath, // disk path if applicable
-			"compressed":    compressed,
-			"compression":   compressionType,
-			"mime_type":     mimeType,
-			"has_password":  hasDownloadPassword,
+		files = append(files, AdminFileInfo{
+			FileID:       fileID,
+			Filename:     file.Filename,
+			Size:         actualFileSize,
+			OriginalSize: originalSize,
+			UploadedAt:   file.UploadTime,
+			ExpiresAt:    file.ExpiresAt,
+			StorageType:  storageType,
+			StoragePath:  storagePath,
+			Compressed:   compressed,
+			Compression:  compressionType,
+			MimeType:     file.MimeType,
+			HasPassword:  file.HasDownloadPassword,
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "File list retrieved successfully",
-		"count":   len(files),
-		"files":   files,
-	})
+	return &AdminFileList{
+		Message: "File list retrieved successfully",
+		Count:   len(files),
+		Total:   total,
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+		HasMore: query.Offset+len(files) < total,
+		Files:   files,
+	}, nil
 }
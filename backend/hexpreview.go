@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The hex preview dumps the first bytes of any file, in the layout of hexdump -C, so a
+// file of an unknown type can be identified by its header before it is downloaded.
+// Uncompressed files on disk are read only up to the requested length, like the text
+// preview.
+
+const (
+	defaultHexPreviewBytes = 512
+	maxHexPreviewBytes     = 64 * 1024
+)
+
+// serveHexPreview answers /api/preview/:id?hex=true, reading the number of bytes given
+// by the bytes query parameter
+func (s *FileService) serveHexPreview(c *gin.Context, fileStorage *FileStorage) {
+	length := defaultHexPreviewBytes
+	if value := c.Query("bytes"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxHexPreviewBytes {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "bytes must be between 1 and the maximum",
+				"max_bytes": maxHexPreviewBytes,
+			})
+			return
+		}
+		length = n
+	}
+
+	reader, err := s.openTextContent(fileStorage)
+	if err != nil {
+		log.Printf("Failed to open %s for hex preview: %v", fileStorage.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer reader.Close()
+
+	head := make([]byte, length)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		log.Printf("Failed to read %s for hex preview: %v", fileStorage.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	head = head[:n]
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":       fileStorage.ID,
+		"filename":      fileStorage.Filename,
+		"mime_type":     fileStorage.MimeType,
+		"size":          fileStorage.OriginalSize,
+		"bytes":         n,
+		"truncated":     int64(n) < fileStorage.OriginalSize,
+		"detected_type": http.DetectContentType(head),
+		"dump":          hex.Dump(head),
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHexPreview(t *testing.T) {
+	ts := newTestService(t)
+	content := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 40)
+	ts.saveTestFile(t, "mystery", content, time.Hour)
+	file, _ := ts.store.GetFile("mystery")
+	file.Filename = "mystery.bin"
+	file.MimeType = "application/octet-stream"
+	ts.store.SaveFile(file)
+	param := gin.Param{Key: "id", Value: "mystery"}
+
+	w := ts.serve(ts.previewFile, httptest.NewRequest(http.MethodGet, "/api/preview/mystery", nil), param)
+	if w.Code != http.StatusUnsupportedMediaType || !strings.Contains(w.Body.String(), "hex=true") {
+		t.Errorf("plain preview: got %d %s", w.Code, w.Body.String())
+	}
+
+	w = ts.serve(ts.previewFile, httptest.NewRequest(http.MethodGet, "/api/preview/mystery?hex=true&bytes=16", nil), param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("hex preview: got %d %s", w.Code, w.Body.String())
+	}
+	var preview struct {
+		Bytes        int    `json:"bytes"`
+		Truncated    bool   `json:"truncated"`
+		DetectedType string `json:"detected_type"`
+		Dump         string `json:"dump"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if preview.Bytes != 16 || !preview.Truncated || preview.DetectedType != "image/png" {
+		t.Errorf("preview = %+v", preview)
+	}
+	if want := "00000000  89 50 4e 47 0d 0a 1a 0a  00 00 00 00 00 00 00 00  |.PNG............|\n"; preview.Dump != want {
+		t.Errorf("dump = %q, want %q", preview.Dump, want)
+	}
+
+	w = ts.serve(ts.previewFile, httptest.NewRequest(http.MethodGet, "/api/preview/mystery?hex=true&bytes=1000000", nil), param)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("oversized: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"file-storage-service/internal/storage"
+)
+
+// Large videos are transcoded to HLS in the background so mobile clients can stream them
+// adaptively instead of range-requesting the original. Transcodes are queued on a Redis
+// stream and run by job worker processes; the renditions are written next to the original
+// in the file's storage class directory, as <id>.hls/, and removed by the periodic cleanup
+// once the file is gone.
+const (
+	hlsStream       = "hls_transcodes"
+	hlsGroup        = "hls_transcoders"
+	hlsQueuedPrefix = "hls_queued:" // Set while a transcode is queued or running
+	hlsErrorPrefix  = "hls_error:"  // Last failure, kept for a day before a retry is allowed
+	hlsPlaylistName = "playlist.m3u8"
+)
+
+// hlsRenditions is the bitrate ladder. Renditions taller than the source are skipped,
+// except the smallest, so every video gets at least one.
+var hlsRenditions = []struct {
+	height       int
+	videoBitrate string
+}{
+	{360, "800k"},
+	{720, "2800k"},
+	{1080, "5000k"},
+}
+
+// hlsFileName matches the files ffmpeg writes for a transcode: the master playlist, one
+// playlist per rendition and its segments
+var hlsFileName = regexp.MustCompile(`^(playlist\.m3u8|stream_\d+\.m3u8|stream_\d+_\d+\.ts)$`)
+
+// HLSTranscoder consumes the transcode queue
+type HLSTranscoder struct {
+	service  *FileService
+	consumer string
+}
+
+// NewHLSTranscoder returns a transcoder, or nil when HLS_MIN_SIZE is 0
+func NewHLSTranscoder(s *FileService) *HLSTranscoder {
+	if s.config.HLSMinSize <= 0 {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	err := s.redis.XGroupCreateMkStream(context.Background(), hlsStream, hlsGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("Failed to create HLS consumer group: %v", err)
+	}
+	return &HLSTranscoder{service: s, consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid())}
+}
+
+// hlsEligible reports whether a file is transcoded to HLS
+func hlsEligible(config *Config, mimeType string, size int64) bool {
+	return config.HLSMinSize > 0 && strings.HasPrefix(mimeType, "video/") && size >= config.HLSMinSize
+}
+
+// hlsDir returns the directory holding a file's HLS renditions
+func hlsDir(config *Config, file *FileStorage) (string, error) {
+	return storageClassPath(config, StorageClass(file.StorageClass), file.ID+".hls")
+}
+
+// Enqueue queues a transcode unless one is already queued or running
+func (t *HLSTranscoder) Enqueue(fileID string) error {
+	ctx := context.Background()
+	queued, err := t.service.redis.SetNX(ctx, hlsQueuedPrefix+fileID, time.Now().Unix(), t.service.config.HLSTranscodeTimeout).Result()
+	if err != nil || !queued {
+		return err
+	}
+	return t.service.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: hlsStream,
+		Values: map[string]interface{}{"file_id": fileID},
+	}).Err()
+}
+
+// queueHLSTranscode queues a transcode for a newly stored file if it qualifies
+func (s *FileService) queueHLSTranscode(fileID, mimeType string, size int64) {
+	if s.hls == nil || !hlsEligible(s.config, mimeType, size) {
+		return
+	}
+	if err := s.hls.Enqueue(fileID); err != nil {
+		log.Printf("Failed to queue HLS transcode of %s: %v", fileID, err)
+	}
+}
+
+// Run transcodes with the given number of concurrent workers until ctx is cancelled
+func (t *HLSTranscoder) Run(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go t.work(ctx)
+	}
+	<-ctx.Done()
+}
+
+func (t *HLSTranscoder) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		// Queued jobs wait in the stream while maintenance is deferred
+		if !t.service.awaitMaintenance(ctx, maintenanceHLSTranscoding) {
+			return
+		}
+		streams, err := t.service.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    hlsGroup,
+			Consumer: t.consumer,
+			Streams:  []string{hlsStream, ">"},
+			Count:    1,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil && ctx.Err() == nil {
+				log.Printf("Failed to read HLS stream: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				// A transcode lost to a crash is queued again by the next playlist request
+				// once its hls_queued key expires, so messages are acknowledged right away
+				t.service.redis.XAck(ctx, hlsStream, hlsGroup, message.ID)
+				fileID, _ := message.Values["file_id"].(string)
+				if fileID == "" {
+					continue
+				}
+				if err := t.transcode(fileID); err != nil {
+					log.Printf("HLS transcode of %s failed: %v", fileID, err)
+					t.service.redis.Set(ctx, hlsErrorPrefix+fileID, err.Error(), 24*time.Hour)
+				}
+				t.service.redis.Del(ctx, hlsQueuedPrefix+fileID)
+				t.service.maintenanceDone(maintenanceHLSTranscoding)
+			}
+		}
+	}
+}
+
+// transcode writes the HLS renditions of a file into a partial directory and renames it
+// into place when ffmpeg is done, so an incomplete transcode is never served
+func (t *HLSTranscoder) transcode(fileID string) error {
+	s := t.service
+	file, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		return err
+	}
+	if file == nil || !hlsEligible(s.config, file.MimeType, file.OriginalSize) {
+		return nil
+	}
+
+	dir, err := hlsDir(s.config, file)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, hlsPlaylistName)); err == nil {
+		return nil
+	}
+
+	input, cleanup, err := s.mediaInputPath(file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := s.probeMedia(input)
+	if err != nil {
+		return err
+	}
+	if info.VideoCodec == "" {
+		return fmt.Errorf("no video stream")
+	}
+
+	partial, err := storageClassPath(s.config, StorageClass(file.StorageClass), file.ID+".hls.partial")
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(partial)
+	if err := os.Mkdir(partial, 0755); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	if _, err := runMediaTool(s.config.HLSTranscodeTimeout, s.config.FFmpegPath, hlsTranscodeArgs(input, partial, info, s.config.HLSSegmentSeconds)...); err != nil {
+		os.RemoveAll(partial)
+		return err
+	}
+	os.RemoveAll(dir)
+	if err := os.Rename(partial, dir); err != nil {
+		os.RemoveAll(partial)
+		return err
+	}
+
+	s.redis.Del(context.Background(), hlsErrorPrefix+fileID)
+	log.Printf("Transcoded %s to HLS in %s", fileID, time.Since(started).Round(time.Second))
+	return nil
+}
+
+// hlsTranscodeArgs builds the ffmpeg arguments producing one H.264 rendition per ladder
+// step with aligned keyframes, their playlists and a master playlist in outDir
+func hlsTranscodeArgs(input, outDir string, info *MediaInfo, segmentSeconds int) []string {
+	renditions := hlsRenditions[:1]
+	for i := 1; i < len(hlsRenditions) && hlsRenditions[i].height <= info.Height; i++ {
+		renditions = hlsRenditions[:i+1]
+	}
+	hasAudio := info.AudioCodec != ""
+
+	filter := fmt.Sprintf("[0:v:0]split=%d", len(renditions))
+	for i := range renditions {
+		filter += fmt.Sprintf("[s%d]", i)
+	}
+	var streamMap []string
+	for i, rendition := range renditions {
+		filter += fmt.Sprintf(";[s%d]scale=-2:%d[v%d]", i, rendition.height, i)
+		if hasAudio {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d", i, i))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d", i))
+		}
+	}
+
+	args := append([]string{"-v", "error"}, mediaInputArgs(input)...)
+	args = append(args, "-filter_complex", filter)
+	for i, rendition := range renditions {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%d]", i),
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), rendition.videoBitrate)
+	}
+	if hasAudio {
+		for range renditions {
+			args = append(args, "-map", "0:a:0")
+		}
+		args = append(args, "-c:a", "aac", "-b:a", "128k", "-ac", "2")
+	}
+	args = append(args,
+		"-preset", "veryfast",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(outDir, "stream_%v_%05d.ts"),
+		"-master_pl_name", hlsPlaylistName,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(outDir, "stream_%v.m3u8"))
+	return args
+}
+
+// serveHLS serves the playlists and segments of a transcoded video. Until the transcode
+// is done, the master playlist answers 202 and queues the transcode if it isn't queued.
+//
+// @summary Get an HLS playlist or segment
+// @tags stream
+// @path id File ID
+// @path name Playlist or segment name
+// @success 200 application/vnd.apple.mpegurl video/mp2t
+// @success 202 json The transcode is still running
+// @auth downloadPassword adminToken optional
+func (s *FileService) serveHLS(c *gin.Context) {
+	name := c.Param("name")
+	if !hlsFileName.MatchString(name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HLS file not found"})
+		return
+	}
+
+	file, ok := s.loadMediaFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if s.hls == nil || !hlsEligible(s.config, file.MimeType, file.OriginalSize) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":      "HLS not available for this file",
+			"stream_url": "/api/stream/" + file.ID,
+		})
+		return
+	}
+
+	dir, err := hlsDir(s.config, file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to locate HLS files"})
+		return
+	}
+	if _, err := os.Stat(filepath.Join(dir, hlsPlaylistName)); err != nil {
+		s.hlsNotReady(c, file, name)
+		return
+	}
+
+	path, err := storage.SafeJoin(dir, name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HLS file not found"})
+		return
+	}
+	if file.HasDownloadPassword {
+		// The password is part of the URL, so shared caches must not keep the content
+		c.Header("Cache-Control", "private, no-store")
+	} else {
+		c.Header("Cache-Control", "public, max-age=3600")
+	}
+	if strings.HasSuffix(name, ".ts") {
+		f, err := openStoredFile(s.config, path, os.O_RDONLY)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "HLS file not found"})
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read HLS segment"})
+			return
+		}
+		c.Header("Content-Type", "video/mp2t")
+		http.ServeContent(c.Writer, c.Request, name, info.ModTime(), f)
+		return
+	}
+
+	playlist, err := readStoredFile(s.config, path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HLS file not found"})
+		return
+	}
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", rewriteHLSPlaylist(playlist, c.Request.URL.RawQuery))
+}
+
+// hlsNotReady answers a request for a transcode that hasn't finished
+func (s *FileService) hlsNotReady(c *gin.Context, file *FileStorage, name string) {
+	if name != hlsPlaylistName {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HLS file not found"})
+		return
+	}
+
+	ctx := context.Background()
+	if lastError, err := s.redis.Get(ctx, hlsErrorPrefix+file.ID).Result(); err == nil {
+		log.Printf("HLS playlist of %s requested after a failed transcode: %s", file.ID, lastError)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "HLS transcode failed",
+			"message":    "This video could not be transcoded. Stream the original instead.",
+			"stream_url": "/api/stream/" + file.ID,
+		})
+		return
+	}
+
+	if err := s.hls.Enqueue(file.ID); err != nil {
+		log.Printf("Failed to queue HLS transcode of %s: %v", file.ID, err)
+	}
+	c.Header("Retry-After", "30")
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":     "processing",
+		"message":    "The video is being prepared for streaming.",
+		"stream_url": "/api/stream/" + file.ID,
+	})
+}
+
+// rewriteHLSPlaylist appends the request's query, such as the download password, to every
+// URI in a playlist, since players resolve the relative URIs without it
+func rewriteHLSPlaylist(playlist []byte, rawQuery string) []byte {
+	if rawQuery == "" {
+		return playlist
+	}
+	lines := strings.Split(string(playlist), "\n")
+	for i, line := range lines {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines[i] = line + "?" + rawQuery
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// cleanupHLS removes the renditions of files that no longer exist and partial
+// transcodes abandoned by a crashed worker
+func (s *FileService) cleanupHLS() {
+	for _, dir := range s.config.storageDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() || !strings.Contains(name, ".hls") {
+				continue
+			}
+			path, err := storage.SafeJoin(dir, name)
+			if err != nil {
+				continue
+			}
+
+			if strings.HasSuffix(name, ".hls.partial") {
+				if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > s.config.HLSTranscodeTimeout {
+					os.RemoveAll(path)
+				}
+				continue
+			}
+			if !strings.HasSuffix(name, ".hls") {
+				continue
+			}
+			file, err := s.db.GetFileMetadata(strings.TrimSuffix(name, ".hls"))
+			if err == nil && file == nil {
+				os.RemoveAll(path)
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHLSCacheControl(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.HLSMinSize = 1
+	ts.hls = &HLSTranscoder{service: ts.FileService}
+
+	publish := func(id string) {
+		file := saveRangeTestFile(t, ts, id, "postgresql", CompressionNone, []byte("video"))
+		dir, err := hlsDir(ts.config, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, hlsPlaylistName), []byte("#EXTM3U\nstream_0.m3u8\n"), 0644)
+		os.WriteFile(filepath.Join(dir, "stream_0_0.ts"), []byte("segment"), 0644)
+	}
+	publish("open")
+	publish("locked")
+	locked, _ := ts.store.GetFile("locked")
+	password := "hunter2"
+	locked.HasDownloadPassword = true
+	locked.DownloadPassword = &password
+	ts.store.SaveFile(locked)
+
+	serve := func(id, name, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/stream/"+id+"/hls/"+name+query, nil)
+		return ts.serve(ts.serveHLS, req, gin.Param{Key: "id", Value: id}, gin.Param{Key: "name", Value: name})
+	}
+	for _, name := range []string{hlsPlaylistName, "stream_0_0.ts"} {
+		if w := serve("open", name, ""); w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "public, max-age=3600" {
+			t.Errorf("public %s: got %d, Cache-Control %q", name, w.Code, w.Header().Get("Cache-Control"))
+		}
+		if w := serve("locked", name, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("protected %s without password: got %d, want 401", name, w.Code)
+		}
+		if w := serve("locked", name, "?password=hunter2"); w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "private, no-store" {
+			t.Errorf("protected %s: got %d, Cache-Control %q", name, w.Code, w.Header().Get("Cache-Control"))
+		}
+	}
+}
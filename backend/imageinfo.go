@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// imageInfoHeaderSize is how much of a file is inspected for image metadata; headers
+// (including embedded ICC profiles) practically always fit in it
+const imageInfoHeaderSize = 512 * 1024
+
+// ImageInfo describes an uploaded image so clients can reserve layout space and pick
+// preview variants without downloading it
+type ImageInfo struct {
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	Format        string `json:"format"`
+	HasAlpha      bool   `json:"has_alpha"`
+	HasICCProfile bool   `json:"has_icc_profile"`
+	Orientation   int    `json:"orientation,omitempty"` // EXIF orientation for JPEGs
+}
+
+// extractImageInfo reads image metadata from the start of a file, returning nil for
+// unsupported or non-image content
+func extractImageInfo(header []byte) *ImageInfo {
+	if len(header) > imageInfoHeaderSize {
+		header = header[:imageInfoHeaderSize]
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(header))
+	if err != nil {
+		return nil
+	}
+
+	info := &ImageInfo{
+		Width:    config.Width,
+		Height:   config.Height,
+		Format:   format,
+		HasAlpha: colorModelHasAlpha(config.ColorModel),
+	}
+
+	switch format {
+	case "jpeg":
+		info.HasICCProfile = jpegHasICCProfile(header)
+		info.Orientation = jpegOrientation(header)
+		// Report dimensions as displayed, since that is what layout needs
+		if info.Orientation >= 5 {
+			info.Width, info.Height = info.Height, info.Width
+		}
+	case "png":
+		info.HasICCProfile = pngHasICCProfile(header)
+	}
+
+	return info
+}
+
+// extractImageInfoFromReader is extractImageInfo for content that isn't held in memory
+func extractImageInfoFromReader(r io.Reader) *ImageInfo {
+	header, err := io.ReadAll(io.LimitReader(r, imageInfoHeaderSize))
+	if err != nil {
+		return nil
+	}
+	return extractImageInfo(header)
+}
+
+func colorModelHasAlpha(model color.Model) bool {
+	switch model {
+	case color.RGBAModel, color.RGBA64Model, color.NRGBAModel, color.NRGBA64Model, color.AlphaModel, color.Alpha16Model:
+		return true
+	}
+
+	// Paletted images (GIF, indexed PNG) have alpha when any entry is transparent
+	if palette, ok := model.(color.Palette); ok {
+		for _, entry := range palette {
+			if _, _, _, a := entry.RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jpegHasICCProfile reports whether a JPEG carries an APP2 ICC_PROFILE segment
+func jpegHasICCProfile(data []byte) bool {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return false
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return false
+		}
+		segmentEnd := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if segmentEnd > len(data) {
+			return false
+		}
+		if marker == 0xE2 && bytes.HasPrefix(data[pos+4:segmentEnd], []byte("ICC_PROFILE\x00")) {
+			return true
+		}
+		pos = segmentEnd
+	}
+	return false
+}
+
+// pngHasICCProfile reports whether a PNG has an iCCP chunk before its image data
+func pngHasICCProfile(data []byte) bool {
+	pos := 8 // PNG signature
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		switch chunkType {
+		case "iCCP":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+		pos += 12 + length // length + type + data + CRC
+	}
+	return false
+}
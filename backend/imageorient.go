@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when absent
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // Start of scan / end of image
+			return 1
+		}
+		segmentLength := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		segmentEnd := pos + 2 + segmentLength
+		if segmentLength < 2 || segmentEnd > len(data) {
+			return 1
+		}
+
+		segment := data[pos+4 : segmentEnd]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		pos = segmentEnd
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from IFD0 of a TIFF-structured EXIF block
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:8]))
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+
+	entryCount := int(order.Uint16(tiff[ifdOffset : ifdOffset+2]))
+	for i := 0; i < entryCount; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+const (
+	// maxOrientBytes and maxOrientPixels bound the memory spent on an oriented variant;
+	// larger images are served as stored along with their X-Image-Orientation
+	maxOrientBytes  = 64 * 1024 * 1024
+	maxOrientPixels = 50_000_000
+)
+
+// applyOrientation returns img transformed so it displays upright for the given EXIF orientation
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Work on RGBA pixels so each pixel is a plain 4-byte copy
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	// Orientations 5-8 swap width and height
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirror horizontal
+				sx, sy = w-1-x, y
+			case 3: // Rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirror vertical
+				sx, sy = x, h-1-y
+			case 5: // Transpose
+				sx, sy = y, x
+			case 6: // Rotate 90 CW
+				sx, sy = y, h-1-x
+			case 7: // Transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotate 90 CCW
+				sx, sy = w-1-y, x
+			}
+			si := src.PixOffset(src.Rect.Min.X+sx, src.Rect.Min.Y+sy)
+			di := y*dst.Stride + x*4
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// serveOrientedPreview serves a JPEG with its EXIF rotation baked into the pixels. The
+// re-encoded variant carries no EXIF, so browsers can't rotate it a second time. The
+// original file is left untouched; the variant is cached in Redis and has its own ETag.
+func (s *FileService) serveOrientedPreview(c *gin.Context, fileStorage *FileStorage, metadata FileMetadata) {
+	fileID := metadata.ID
+	etag := fileID + "-" + contentVersion(fileStorage) + "-oriented"
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", etag))
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Trim(match, "\"") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if metadata.Size > maxOrientBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "Image too large to orient",
+			"message": "Fetch the preview without orient=true and apply the EXIF orientation on the client.",
+		})
+		return
+	}
+
+	content, err := s.loadFileContent(fileStorage, metadata)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	serve := func(data []byte) {
+		c.Header("Content-Length", strconv.Itoa(len(data)))
+		c.Data(http.StatusOK, "image/jpeg", data)
+	}
+
+	orientation := jpegOrientation(content)
+	c.Header("X-Image-Orientation", strconv.Itoa(orientation))
+	if orientation == 1 {
+		serve(content)
+		return
+	}
+
+	ctx := context.Background()
+	cacheKey := "preview:oriented:" + fileID
+	if cached, err := s.redis.Get(ctx, cacheKey).Bytes(); err == nil {
+		serve(cached)
+		return
+	}
+
+	// Check the dimensions before decoding, which allocates for every pixel
+	imgConfig, err := jpeg.DecodeConfig(bytes.NewReader(content))
+	if err != nil || int64(imgConfig.Width)*int64(imgConfig.Height) > maxOrientPixels {
+		serve(content)
+		return
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(content))
+	if err != nil {
+		log.Printf("serveOrientedPreview: failed to decode %s: %v", fileID, err)
+		serve(content)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, applyOrientation(img, orientation), &jpeg.Options{Quality: 90}); err != nil {
+		log.Printf("serveOrientedPreview: failed to encode %s: %v", fileID, err)
+		serve(content)
+		return
+	}
+
+	s.redis.Set(ctx, cacheKey, buf.Bytes(), s.config.FileRetention)
+	serve(buf.Bytes())
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// Files can be imported from another instance of this service, to ease moving between
+// deployments. The importing instance reads the file's metadata and content through the
+// other instance's REST API and stores a copy that keeps its name, its accessibility
+// text, the time it had left before expiring, its download password and, when given, its
+// delete password. Only hosts listed in IMPORT_ALLOWED_HOSTS are contacted, so the
+// endpoint can't be used to reach arbitrary addresses from the server.
+
+// ImportRequest names a file on another instance and the passwords it needs
+type ImportRequest struct {
+	URL            string `json:"url" binding:"required"`    // Page (/f/:id or /f/:slug), download or metadata link of the file
+	Password       string `json:"password,omitempty"`        // Download password of the file, kept for the copy
+	DeletePassword string `json:"delete_password,omitempty"` // Delete password of the file, kept for the copy
+	DeleteOriginal bool   `json:"delete_original,omitempty"` // Delete the file on the other instance once copied; needs delete_password
+	StorageClass   string `json:"storage_class,omitempty"`   // fast-ssd, standard or archive
+}
+
+// ImportResponse is an imported file
+type ImportResponse struct {
+	UploadResponse
+	SourceURL       string `json:"source_url"`       // Download link of the original
+	OriginalDeleted bool   `json:"original_deleted"` // Whether the original was deleted
+}
+
+// importHTTPClient talks to other instances. Redirects aren't followed, so a listed host
+// can't send the server on to one that isn't.
+var importHTTPClient = &http.Client{
+	Timeout: 10 * time.Minute,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// importSource is a file on another instance
+type importSource struct {
+	baseURL string // Scheme and host of the instance
+	fileID  string
+	page    bool // Linked by its page, whose ID may be a slug
+}
+
+// parseImportURL finds the instance and file a link points to. Page links may name the
+// file by its slug, resolved later.
+func (s *FileService) parseImportURL(raw string) (*importSource, error) {
+	link, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+		return nil, fmt.Errorf("url must be an http or https link to a file")
+	}
+	if !slices.ContainsFunc(s.config.ImportAllowedHosts, func(host string) bool { return strings.EqualFold(host, link.Host) }) {
+		return nil, fmt.Errorf("files can't be imported from %s", link.Host)
+	}
+
+	for _, prefix := range []string{"/f/", "/api/file/", "/api/metadata/"} {
+		id, ok := strings.CutPrefix(link.Path, prefix)
+		if ok && id != "" && !strings.Contains(id, "/") {
+			return &importSource{baseURL: link.Scheme + "://" + link.Host, fileID: id, page: prefix == "/f/"}, nil
+		}
+	}
+	return nil, fmt.Errorf("url must link to a file page, /api/file/:id or /api/metadata/:id")
+}
+
+// request calls the API of the source instance
+func (src *importSource) request(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	target := src.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return importHTTPClient.Do(req)
+}
+
+// resolveSlug replaces the slug of a page link with the ID of the file it points to; the
+// page of a slug redirects to the page of the file
+func (src *importSource) resolveSlug(ctx context.Context) error {
+	if !src.page {
+		return nil
+	}
+	resp, err := src.request(ctx, http.MethodGet, "/f/"+url.PathEscape(src.fileID), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusFound {
+		if id, ok := strings.CutPrefix(resp.Header.Get("Location"), "/f/"); ok && id != "" {
+			src.fileID = id
+		}
+	}
+	return nil
+}
+
+// importFailed writes the response for a failed call to the source instance
+func importFailed(c *gin.Context, what string, resp *http.Response, err error) {
+	if err != nil {
+		log.Printf("Failed to %s from the import source: %v", what, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The source instance could not be reached"})
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found or expired on the source instance"})
+	case http.StatusUnauthorized, http.StatusForbidden:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Password required",
+			"message": "The source instance refused the download password.",
+		})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("The source instance answered %s", resp.Status)})
+	}
+}
+
+// importFile copies a file from another instance of this service
+//
+// @summary Import a file from another instance
+// @tags upload
+// @body json ImportRequest
+// @success 200 ImportResponse
+// @auth apiKey optional
+func (s *FileService) importFile(c *gin.Context) {
+	if len(s.config.ImportAllowedHosts) == 0 {
+		respondRetryLater(c, http.StatusServiceUnavailable, errorCodeNotConfigured, retryAfterNotConfigured, gin.H{
+			"error": "Imports are not configured on this server",
+		})
+		return
+	}
+
+	var req ImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if req.DeleteOriginal && req.DeletePassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delete_original needs the delete_password of the file"})
+		return
+	}
+	source, err := s.parseImportURL(req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	release, ok := s.acquireUploadSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx := c.Request.Context()
+	if err := source.resolveSlug(ctx); err != nil {
+		importFailed(c, "resolve the file page", nil, err)
+		return
+	}
+	fileID := url.PathEscape(source.fileID)
+	password := url.Values{}
+	if req.Password != "" {
+		password.Set("password", req.Password)
+	}
+
+	resp, err := source.request(ctx, http.MethodGet, "/api/metadata/"+fileID, password)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		importFailed(c, "read the metadata", resp, err)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return
+	}
+	var original FileMetadata
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&original)
+	resp.Body.Close()
+	if err != nil {
+		importFailed(c, "decode the metadata", nil, err)
+		return
+	}
+
+	if !original.ExpiresAt.After(s.clock.Now()) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found or expired on the source instance"})
+		return
+	}
+	if original.HasDownloadPassword && req.Password == "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Password required",
+			"message": "The file is password protected on the source instance. Please provide its password.",
+		})
+		return
+	}
+	filename := files.NormalizeName(original.Filename)
+	if original.Size > s.config.ChunkThreshold {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large to import",
+			"max_size": s.config.ChunkThreshold,
+		})
+		return
+	}
+	if !checkExtensionPolicy(c, s.config, filename, original.Size) {
+		return
+	}
+	if !s.checkOrgPolicy(c, filename, original.HasDownloadPassword) {
+		return
+	}
+	if !s.checkUploadQuota(c, original.Size) {
+		return
+	}
+	apiKey := apiKeyFromContext(c)
+	storageClass, ok := s.storageClassFromRequest(c, req.StorageClass, apiKey)
+	if !ok {
+		return
+	}
+
+	resp, err = source.request(ctx, http.MethodGet, "/api/file/"+fileID, password)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		importFailed(c, "download the file", resp, err)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return
+	}
+	hasher := sha256.New()
+	content, err := io.ReadAll(io.TeeReader(io.LimitReader(resp.Body, original.Size+1), hasher))
+	resp.Body.Close()
+	if err == nil && int64(len(content)) != original.Size {
+		err = fmt.Errorf("received %d bytes, the metadata says %d", len(content), original.Size)
+	}
+	if err != nil {
+		importFailed(c, "download the file", nil, err)
+		return
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	if !verifyContentHash(c, filename, original.SHA256, contentHash) {
+		return
+	}
+
+	downloadPassword := ""
+	if original.HasDownloadPassword {
+		downloadPassword = req.Password
+	}
+	metadata, fileStorage, ok := s.saveUploadedContent(c, filename, content, contentHash, downloadPassword, apiKey, storageClass, original.Accessibility)
+	if !ok {
+		return
+	}
+
+	// Keep the time the original had left, unless this server keeps files for less, and
+	// the delete password its owner already has
+	if original.ExpiresAt.Before(metadata.ExpiresAt) {
+		err = s.db.UpdateFileExpiration(metadata.ID, original.ExpiresAt)
+		metadata.ExpiresAt = original.ExpiresAt
+	}
+	if err == nil && req.DeletePassword != "" {
+		err = s.db.UpdateFileDeletePassword(metadata.ID, req.DeletePassword)
+		metadata.DeletePassword = req.DeletePassword
+	}
+	s.redis.Del(context.Background(), "file:"+metadata.ID)
+	if err != nil {
+		log.Printf("Failed to keep the settings of imported file %s: %v", metadata.ID, err)
+		s.db.DeleteFile(metadata.ID)
+		if fileStorage.StoragePath != nil {
+			removeStoredFile(s.config, *fileStorage.StoragePath)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+
+	response := ImportResponse{
+		UploadResponse: UploadResponse{
+			Message:  "File imported successfully",
+			FileID:   metadata.ID,
+			Metadata: metadata,
+			SHA256:   contentHash,
+		},
+		SourceURL: source.baseURL + "/api/file/" + fileID,
+	}
+	if req.DeleteOriginal {
+		resp, err := source.request(ctx, http.MethodDelete, "/api/file/"+fileID, url.Values{"delete_password": {req.DeletePassword}})
+		if err != nil {
+			log.Printf("Failed to delete the original of imported file %s: %v", metadata.ID, err)
+		} else {
+			resp.Body.Close()
+			response.OriginalDeleted = resp.StatusCode == http.StatusOK
+			if !response.OriginalDeleted {
+				log.Printf("Failed to delete the original of imported file %s: %s", metadata.ID, resp.Status)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
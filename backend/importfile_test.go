@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newImportTest serves a source instance over HTTP and returns it with a service allowed
+// to import from it
+func newImportTest(t *testing.T) (source, ts *testService, sourceURL string) {
+	t.Helper()
+	source = newTestService(t)
+	server := httptest.NewServer(setupRouter(source.FileService))
+	t.Cleanup(server.Close)
+
+	ts = newTestService(t)
+	link, _ := url.Parse(server.URL)
+	ts.config.ImportAllowedHosts = []string{link.Host}
+	return source, ts, server.URL
+}
+
+func importTestFile(ts *testService, body string) (*httptest.ResponseRecorder, ImportResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(ts.importFile, req)
+	var resp ImportResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestImportFile(t *testing.T) {
+	source, ts, sourceURL := newImportTest(t)
+	source.saveTestFile(t, "original", "imported content", 2*time.Hour)
+	stored, _ := source.store.GetFile("original")
+	password := "open-sesame"
+	stored.DownloadPassword = &password
+	stored.HasDownloadPassword = true
+	source.store.SaveFile(stored)
+
+	if w, _ := importTestFile(ts, `{"url":"`+sourceURL+`/f/original"}`); w.Code != http.StatusForbidden {
+		t.Errorf("protected file without a password: got %d, want 403", w.Code)
+	}
+	if w, _ := importTestFile(ts, `{"url":"`+sourceURL+`/f/original","password":"wrong"}`); w.Code != http.StatusForbidden {
+		t.Errorf("wrong password: got %d, want 403", w.Code)
+	}
+
+	w, imported := importTestFile(ts, `{"url":"`+sourceURL+`/f/original","password":"open-sesame","delete_password":"delete-me"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: got %d: %s", w.Code, w.Body.String())
+	}
+	if imported.OriginalDeleted || imported.SourceURL != sourceURL+"/api/file/original" {
+		t.Errorf("response = %+v", imported)
+	}
+	copied, _ := ts.store.GetFile(imported.FileID)
+	if copied == nil || copied.Filename != "original.txt" {
+		t.Fatalf("copy = %+v", copied)
+	}
+	download := httptest.NewRequest(http.MethodGet, "/api/file/"+imported.FileID+"?password=open-sesame", nil)
+	if w := ts.serve(ts.getFile, download, gin.Param{Key: "id", Value: imported.FileID}); w.Body.String() != "imported content" {
+		t.Errorf("copy content = %q", w.Body.String())
+	}
+	if !copied.ExpiresAt.Equal(ts.clock.Now().Add(2 * time.Hour)) {
+		t.Errorf("copy expires at %v, want the original's expiry", copied.ExpiresAt)
+	}
+	if !copied.HasDownloadPassword || copied.DownloadPassword == nil || *copied.DownloadPassword != "open-sesame" {
+		t.Errorf("copy download password = %v", copied.DownloadPassword)
+	}
+	if copied.DeletePassword != "delete-me" || imported.Metadata.DeletePassword != "delete-me" {
+		t.Errorf("copy delete password = %q", copied.DeletePassword)
+	}
+	if original, _ := source.store.GetFile("original"); original == nil {
+		t.Error("original deleted without delete_original")
+	}
+}
+
+func TestImportFileDeleteOriginal(t *testing.T) {
+	source, ts, sourceURL := newImportTest(t)
+	source.saveTestFile(t, "moving", "moving content", time.Hour)
+
+	if w, _ := importTestFile(ts, `{"url":"`+sourceURL+`/api/file/moving","delete_original":true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("delete_original without delete_password: got %d, want 400", w.Code)
+	}
+	w, imported := importTestFile(ts, `{"url":"`+sourceURL+`/api/file/moving","delete_password":"delete-me","delete_original":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: got %d: %s", w.Code, w.Body.String())
+	}
+	if !imported.OriginalDeleted {
+		t.Error("original not reported deleted")
+	}
+	if original, _ := source.store.GetFile("moving"); original != nil {
+		t.Error("original still stored on the source")
+	}
+	if w, _ := importTestFile(ts, `{"url":"`+sourceURL+`/api/metadata/moving"}`); w.Code != http.StatusNotFound {
+		t.Errorf("importing a deleted file: got %d, want 404", w.Code)
+	}
+}
+
+func TestImportFileHosts(t *testing.T) {
+	ts := newTestService(t)
+	if w, _ := importTestFile(ts, `{"url":"http://old.example.com/f/abc"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without allowed hosts: got %d, want 503", w.Code)
+	}
+
+	ts.config.ImportAllowedHosts = []string{"old.example.com"}
+	for _, link := range []string{
+		"http://127.0.0.1/f/abc",
+		"http://old.example.com.evil.test/f/abc",
+		"ftp://old.example.com/f/abc",
+		"http://old.example.com/admin",
+		"http://old.example.com/f/",
+	} {
+		if w, _ := importTestFile(ts, `{"url":"`+link+`"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", link, w.Code)
+		}
+	}
+}
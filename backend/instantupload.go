@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+var sha256HexPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type UploadCheckRequest struct {
+	SHA256           string `json:"sha256" binding:"required"`
+	Size             int64  `json:"size"`
+	Filename         string `json:"filename" binding:"required"`
+	DownloadPassword string `json:"download_password,omitempty"`
+	StorageClass     string `json:"storage_class,omitempty"`
+}
+
+// checkUploadByHash lets clients skip transferring content the server already stores.
+// When an active file with the same SHA-256 and size exists, a new file_id is created
+// from it immediately; otherwise the client should fall back to a regular upload.
+//
+// Knowing a hash doesn't prove possession of the content, so only files uploaded by the
+// same API key (or, for anonymous uploads, the same client IP) are matched. Otherwise
+// the endpoint would reveal whether anyone stored a given file and hand out copies of it.
+//
+// There is no shared-blob reference counting, so the new record gets its own copy of
+// the content (copied inside PostgreSQL). Disk-stored files are therefore never matched,
+// since deleting one record would remove the shared file, and only the standard storage
+// class can be requested. Only files up to CHUNK_THRESHOLD are looked up, as larger ones
+// are usually stored on disk; every answer tells the limit in max_size.
+//
+// @summary Create a file from content the server already stores
+// @tags upload
+// @body json UploadCheckRequest
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) checkUploadByHash(c *gin.Context) {
+	var req UploadCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	contentHash := strings.ToLower(req.SHA256)
+	if !sha256HexPattern.MatchString(contentHash) || req.Size < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sha256 must be a hex-encoded SHA-256 hash"})
+		return
+	}
+
+	if req.Size > s.config.ChunkThreshold {
+		c.JSON(http.StatusOK, gin.H{
+			"exists":   false,
+			"message":  "Instant upload only covers files up to max_size bytes, upload the file normally",
+			"max_size": s.config.ChunkThreshold,
+		})
+		return
+	}
+
+	if !checkExtensionPolicy(c, s.config, files.NormalizeName(req.Filename), req.Size) {
+		return
+	}
+	if !s.checkOrgPolicy(c, files.NormalizeName(req.Filename), req.DownloadPassword != "") {
+		return
+	}
+
+	if !requireStandardStorageClass(c, req.StorageClass) {
+		return
+	}
+
+	apiKey := apiKeyFromContext(c)
+	var apiKeyID *string
+	if apiKey != nil {
+		apiKeyID = &apiKey.ID
+	}
+	clientIP := c.ClientIP()
+
+	existing, err := s.db.FindFileByContentHash(contentHash, req.Size, apiKeyID, clientIP)
+	if err != nil {
+		log.Printf("Failed to look up content hash: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if existing == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"exists":   false,
+			"message":  "Content not found, upload the file normally",
+			"max_size": s.config.ChunkThreshold,
+		})
+		return
+	}
+
+	if !s.checkUploadQuota(c, req.Size) {
+		return
+	}
+
+	filename := files.NormalizeName(req.Filename)
+	fileID, ok := s.allocateFileID(c)
+	if !ok {
+		return
+	}
+	now := s.clock.Now()
+	retention := s.retentionFor(apiKey)
+	expiresAt := now.Add(retention)
+	deletePassword := files.GeneratePassword()
+	hasDownloadPassword := req.DownloadPassword != ""
+
+	var compressedSize int64
+	if existing.CompressedSize != nil {
+		compressedSize = *existing.CompressedSize
+	}
+
+	metadata := FileMetadata{
+		ID:                  fileID,
+		Filename:            filename,
+		Size:                existing.OriginalSize,
+		CompressedSize:      compressedSize,
+		MimeType:            files.MimeType(filename),
+		Compression:         CompressionType(existing.CompressionType),
+		UploadTime:          now,
+		ExpiresAt:           expiresAt,
+		DeletePassword:      deletePassword,
+		DownloadPassword:    req.DownloadPassword,
+		HasDownloadPassword: hasDownloadPassword,
+		SHA256:              contentHash,
+	}
+
+	fileStorage := &FileStorage{
+		ID:                  fileID,
+		Filename:            metadata.Filename,
+		MimeType:            metadata.MimeType,
+		UploadTime:          now,
+		ExpiresAt:           expiresAt,
+		DeletePassword:      deletePassword,
+		HasDownloadPassword: hasDownloadPassword,
+		UploaderIP:          &clientIP,
+	}
+
+	if hasDownloadPassword {
+		fileStorage.DownloadPassword = &req.DownloadPassword
+	}
+
+	fileStorage.APIKeyID = apiKeyID
+
+	if err := s.db.CloneFile(existing.ID, fileStorage); err != nil {
+		// The source may have expired between lookup and copy; the client can just upload
+		log.Printf("Failed to clone file %s: %v", existing.ID, err)
+		c.JSON(http.StatusOK, gin.H{
+			"exists":   false,
+			"message":  "Content not found, upload the file normally",
+			"max_size": s.config.ChunkThreshold,
+		})
+		return
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err == nil {
+		s.redis.Set(context.Background(), "file:"+fileID, metadataJSON, retention)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"exists":   true,
+		"message":  "File uploaded successfully",
+		"file_id":  fileID,
+		"metadata": metadata,
+		"sha256":   contentHash,
+		"max_size": s.config.ChunkThreshold,
+	})
+}
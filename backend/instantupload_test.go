@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadCheckAboveThreshold(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.ChunkThreshold = 1024
+
+	body := `{"sha256": "` + strings.Repeat("ab", 32) + `", "size": 2048, "filename": "large.bin"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/check", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(ts.checkUploadByHash, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Exists  bool  `json:"exists"`
+		MaxSize int64 `json:"max_size"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Exists || resp.MaxSize != 1024 {
+		t.Errorf("response = %s", w.Body.String())
+	}
+}
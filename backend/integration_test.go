@@ -0,0 +1,356 @@
+//go:build integration
+
+package main
+
+// End-to-end tests running the whole service against real PostgreSQL and Redis:
+//
+//	go test -tags integration -run Integration ./...
+//
+// INTEGRATION_DATABASE_URL and INTEGRATION_REDIS_ADDR select existing servers, such as CI
+// service containers. Without them, throwaway postgres and redis containers are started
+// with docker and removed afterwards.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const integrationAdminPassword = "integration-admin"
+
+var (
+	integrationService *FileService
+	integrationURL     string
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runIntegration(m))
+}
+
+func runIntegration(m *testing.M) int {
+	databaseURL := os.Getenv("INTEGRATION_DATABASE_URL")
+	redisAddr := os.Getenv("INTEGRATION_REDIS_ADDR")
+
+	if databaseURL == "" {
+		id, addr, err := startContainer("postgres:15-alpine", "5432", "POSTGRES_PASSWORD=postgres", "POSTGRES_DB=file_sharing")
+		if err != nil {
+			log.Printf("Failed to start PostgreSQL: %v", err)
+			return 1
+		}
+		defer stopContainer(id)
+		databaseURL = fmt.Sprintf("postgres://postgres:postgres@%s/file_sharing?sslmode=disable", addr)
+	}
+	if redisAddr == "" {
+		id, addr, err := startContainer("redis:7-alpine", "6379")
+		if err != nil {
+			log.Printf("Failed to start Redis: %v", err)
+			return 1
+		}
+		defer stopContainer(id)
+		redisAddr = addr
+	}
+	if err := waitForDependencies(databaseURL, redisAddr, time.Minute); err != nil {
+		log.Printf("Dependencies not ready: %v", err)
+		return 1
+	}
+
+	tempDir, err := os.MkdirTemp("", "one-integration")
+	if err != nil {
+		log.Printf("Failed to create temp dir: %v", err)
+		return 1
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("DATABASE_URL", databaseURL)
+	os.Setenv("REDIS_ADDR", redisAddr)
+	os.Setenv("TEMP_DIR", tempDir)
+	os.Setenv("ADMIN_PASSWORD", integrationAdminPassword)
+	os.Setenv("CHUNK_SIZE", "1048576")
+	config := LoadConfig()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: config.RedisAddr})
+	defer redisClient.Close()
+
+	database, err := NewDatabase(config)
+	if err != nil {
+		log.Printf("Failed to connect to PostgreSQL: %v", err)
+		return 1
+	}
+	defer database.Close()
+	if err := database.EnsureSchema(); err != nil {
+		log.Printf("Failed to prepare schema: %v", err)
+		return 1
+	}
+
+	integrationService = newFileService(config, redisClient, database, systemClock{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go integrationService.jobQueue.Run(ctx, 1)
+
+	server := httptest.NewServer(setupRouter(integrationService))
+	defer server.Close()
+	integrationURL = server.URL
+
+	return m.Run()
+}
+
+// startContainer runs image with its port published on a random local port and returns
+// the container ID and the published address
+func startContainer(image, port string, env ...string) (string, string, error) {
+	args := []string{"run", "-d", "--rm", "-p", "127.0.0.1::" + port}
+	for _, e := range env {
+		args = append(args, "-e", e)
+	}
+	out, err := exec.Command("docker", append(args, image)...).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("docker run %s: %v", image, err)
+	}
+	id := strings.TrimSpace(string(out))
+
+	out, err = exec.Command("docker", "port", id, port).Output()
+	if err != nil {
+		stopContainer(id)
+		return "", "", fmt.Errorf("docker port %s: %v", image, err)
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	return id, addr, nil
+}
+
+func stopContainer(id string) {
+	exec.Command("docker", "rm", "-f", id).Run()
+}
+
+// waitForDependencies waits until PostgreSQL accepts queries and Redis answers pings
+func waitForDependencies(databaseURL, redisAddr string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: redisAddr})
+	defer redisClient.Close()
+
+	var err error
+	for ctx.Err() == nil {
+		if err = redisClient.Ping(ctx).Err(); err == nil {
+			var pool *pgxpool.Pool
+			if pool, err = pgxpool.Connect(ctx, databaseURL); err == nil {
+				err = pool.Ping(ctx)
+				pool.Close()
+				if err == nil {
+					return nil
+				}
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	return err
+}
+
+// integrationRequest sends a request to the test server and decodes a JSON response into out
+func integrationRequest(t *testing.T, method, path string, body io.Reader, contentType string, headers map[string]string, out interface{}) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, integrationURL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: invalid JSON response %q: %v", method, path, data, err)
+		}
+	}
+	return resp, data
+}
+
+func integrationJSON(t *testing.T, method, path string, payload interface{}, out interface{}) *http.Response {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := integrationRequest(t, method, path, bytes.NewReader(body), "application/json", nil, out)
+	return resp
+}
+
+// integrationMultipart posts a single file with the given form fields
+func integrationMultipart(t *testing.T, path, field, filename string, content []byte, fields map[string]string, out interface{}) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.Close()
+	resp, _ := integrationRequest(t, http.MethodPost, path, &body, writer.FormDataContentType(), nil, out)
+	return resp
+}
+
+func randomContent(t *testing.T, size int) []byte {
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestIntegrationUploadDownloadWithPassword(t *testing.T) {
+	content := []byte(strings.Repeat("integration test line\n", 500))
+
+	var upload struct {
+		FileID   string `json:"file_id"`
+		Metadata struct {
+			DeletePassword string `json:"delete_password"`
+		} `json:"metadata"`
+	}
+	resp := integrationMultipart(t, "/api/upload", "file", "notes.txt", content, map[string]string{"download_password": "secret"}, &upload)
+	if resp.StatusCode != http.StatusOK || upload.FileID == "" {
+		t.Fatalf("upload returned %d, file ID %q", resp.StatusCode, upload.FileID)
+	}
+
+	// Password flow
+	if resp, _ := integrationRequest(t, http.MethodGet, "/api/file/"+upload.FileID, nil, "", nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("download without password returned %d, want 401", resp.StatusCode)
+	}
+	if resp, _ := integrationRequest(t, http.MethodGet, "/api/file/"+upload.FileID+"?password=wrong", nil, "", nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("download with wrong password returned %d, want 401", resp.StatusCode)
+	}
+	resp, data := integrationRequest(t, http.MethodGet, "/api/file/"+upload.FileID+"?password=secret", nil, "", nil, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(data, content) {
+		t.Fatalf("download returned %d with %d bytes, want %d bytes", resp.StatusCode, len(data), len(content))
+	}
+
+	// Range requests
+	resp, data = integrationRequest(t, http.MethodGet, "/api/preview/"+upload.FileID+"?password=secret", nil, "", map[string]string{"Range": "bytes=100-199"}, nil)
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(data, content[100:200]) {
+		t.Errorf("range request returned %d with %q", resp.StatusCode, data)
+	}
+	if got, want := resp.Header.Get("Content-Range"), fmt.Sprintf("bytes 100-199/%d", len(content)); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+	resp, _ = integrationRequest(t, http.MethodGet, "/api/preview/"+upload.FileID+"?password=secret", nil, "", map[string]string{"Range": fmt.Sprintf("bytes=%d-", len(content))}, nil)
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unsatisfiable range returned %d, want 416", resp.StatusCode)
+	}
+
+	// Deletion requires the delete password
+	if resp, _ := integrationRequest(t, http.MethodDelete, "/api/file/"+upload.FileID+"?delete_password=wrong", nil, "", nil, nil); resp.StatusCode == http.StatusOK {
+		t.Error("delete with wrong password succeeded")
+	}
+	if resp, _ := integrationRequest(t, http.MethodDelete, "/api/file/"+upload.FileID+"?delete_password="+upload.Metadata.DeletePassword, nil, "", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("delete returned %d", resp.StatusCode)
+	}
+	if resp, _ := integrationRequest(t, http.MethodGet, "/api/file/"+upload.FileID+"?password=secret", nil, "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("download after delete returned %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestIntegrationChunkedUploadLifecycle(t *testing.T) {
+	const chunkSize = 1 << 20
+	content := randomContent(t, 2*chunkSize+12345)
+
+	var initiated struct {
+		UploadID    string `json:"upload_id"`
+		TotalChunks int    `json:"total_chunks"`
+	}
+	resp := integrationJSON(t, http.MethodPost, "/api/chunk/initiate", map[string]interface{}{
+		"filename":          "data.bin",
+		"total_size":        len(content),
+		"chunk_size":        chunkSize,
+		"download_password": "chunked",
+	}, &initiated)
+	if resp.StatusCode != http.StatusOK || initiated.TotalChunks != 3 {
+		t.Fatalf("initiate returned %d with %d chunks", resp.StatusCode, initiated.TotalChunks)
+	}
+
+	// Send the chunks out of order
+	for _, index := range []int{2, 0, 1} {
+		end := (index + 1) * chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		path := fmt.Sprintf("/api/chunk/%s/%d", initiated.UploadID, index)
+		if resp := integrationMultipart(t, path, "chunk", "chunk", content[index*chunkSize:end], nil, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("chunk %d returned %d", index, resp.StatusCode)
+		}
+	}
+
+	var completed struct {
+		JobID  string `json:"job_id"`
+		FileID string `json:"file_id"`
+	}
+	resp, _ = integrationRequest(t, http.MethodPost, "/api/chunk/"+initiated.UploadID+"/complete", nil, "", nil, &completed)
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		t.Fatalf("complete returned %d", resp.StatusCode)
+	}
+
+	// Assembly runs on the job worker
+	var job ProcessingJob
+	deadline := time.Now().Add(time.Minute)
+	for {
+		integrationRequest(t, http.MethodGet, "/api/job/"+completed.JobID, nil, "", nil, &job)
+		if job.Status == "completed" || job.Status == "failed" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if job.Status != "completed" {
+		t.Fatalf("job ended as %q: %s", job.Status, job.Error)
+	}
+	fileID := job.FileID
+
+	resp, data := integrationRequest(t, http.MethodGet, "/api/file/"+fileID+"?password=chunked", nil, "", nil, nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(data, content) {
+		t.Fatalf("download of assembled file returned %d with %d bytes, want %d", resp.StatusCode, len(data), len(content))
+	}
+
+	// Expire the file through the admin API, then let the cleanup remove it
+	expiresAt := time.Now().Add(2 * time.Second).UTC().Format(time.RFC3339)
+	resp, _ = integrationRequest(t, http.MethodPut, "/api/admin/file/"+fileID+"/expires",
+		strings.NewReader(`{"expires_at":"`+expiresAt+`"}`), "application/json",
+		map[string]string{adminPasswordHeader: integrationAdminPassword}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expiration update returned %d", resp.StatusCode)
+	}
+	time.Sleep(3 * time.Second)
+
+	if resp, _ := integrationRequest(t, http.MethodGet, "/api/file/"+fileID+"?password=chunked", nil, "", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("download of expired file returned %d, want 404", resp.StatusCode)
+	}
+	integrationService.cleanupExpiredFiles()
+	if file, err := integrationService.db.GetFileMetadata(fileID); err != nil || file != nil {
+		t.Errorf("expired file still stored after cleanup: %v, %v", file, err)
+	}
+}
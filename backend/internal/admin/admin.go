@@ -0,0 +1,192 @@
+// Package admin holds admin authentication: checking the admin password and issuing and
+// validating the short-lived tokens the admin UI uses afterwards.
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrNotConfigured is returned when no admin password is set, which disables admin access
+	ErrNotConfigured = errors.New("admin functionality not configured")
+	// ErrInvalidPassword is returned for a wrong admin password
+	ErrInvalidPassword = errors.New("invalid admin password")
+	// ErrRevoked is returned for a token that was revoked before it expired
+	ErrRevoked = errors.New("admin token revoked")
+)
+
+// CheckPassword compares a presented admin password with the configured one in constant time
+func CheckPassword(configured, presented string) error {
+	if configured == "" {
+		return ErrNotConfigured
+	}
+	if subtle.ConstantTimeCompare([]byte(configured), []byte(presented)) != 1 {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// Claims are the JWT claims of an admin token
+type Claims struct {
+	IsAdmin bool `json:"is_admin"`
+	jwt.RegisteredClaims
+}
+
+// RevocationList remembers revoked tokens by their ID until they would have expired
+type RevocationList interface {
+	Revoke(tokenID string, expiresAt time.Time) error
+	Revoked(tokenID string) (bool, error)
+}
+
+// Tokens issues and validates HS256 admin tokens. Tokens name the key they were signed
+// with in their kid header, so the secret can be rotated: new tokens are signed with the
+// current secret while those signed with a previous one stay valid until they expire.
+type Tokens struct {
+	signingKeyID string
+	secrets      map[string][]byte
+	ttl          time.Duration
+	now          func() time.Time
+	revocations  RevocationList
+}
+
+// KeyID returns the kid of tokens signed with secret: a short hash that identifies the
+// secret without revealing it
+func KeyID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:4])
+}
+
+// NewTokens returns a Tokens signing with secret, whose tokens are valid for ttl, that
+// also accepts tokens signed with the previous secrets
+func NewTokens(secret []byte, ttl time.Duration, previous ...[]byte) *Tokens {
+	t := &Tokens{
+		signingKeyID: KeyID(secret),
+		secrets:      make(map[string][]byte, len(previous)+1),
+		ttl:          ttl,
+		now:          time.Now,
+	}
+	for _, old := range previous {
+		t.secrets[KeyID(old)] = old
+	}
+	t.secrets[t.signingKeyID] = secret
+	return t
+}
+
+// WithRevocations makes the tokens revocable, checking every token against list
+func (t *Tokens) WithRevocations(list RevocationList) *Tokens {
+	t.revocations = list
+	return t
+}
+
+// Issue returns a new admin token and its expiry as a Unix timestamp
+func (t *Tokens) Issue() (string, int64, error) {
+	return t.IssueFor("admin")
+}
+
+// IssueFor is Issue for a token naming subject, the directory user who signed in
+func (t *Tokens) IssueFor(subject string) (string, int64, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", 0, err
+	}
+
+	now := t.now()
+	expirationTime := now.Add(t.ttl)
+	claims := &Claims{
+		IsAdmin: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Subject:   subject,
+			ID:        hex.EncodeToString(id),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = t.signingKeyID
+	tokenString, err := token.SignedString(t.secrets[t.signingKeyID])
+	if err != nil {
+		return "", 0, err
+	}
+
+	return tokenString, expirationTime.Unix(), nil
+}
+
+// Validate parses an admin token, rejecting expired tokens, other signing methods and
+// tokens without the admin claim
+func (t *Tokens) Validate(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		secret, ok := t.secrets[keyID]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", keyID)
+		}
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithTimeFunc(t.now))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || !claims.IsAdmin {
+		return nil, fmt.Errorf("invalid admin token")
+	}
+
+	if t.revocations != nil {
+		revoked, err := t.revocations.Revoked(claims.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %v", err)
+		}
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// Revoke invalidates a valid token before it expires
+func (t *Tokens) Revoke(tokenString string) error {
+	claims, err := t.Validate(tokenString)
+	if err != nil {
+		return err
+	}
+	if t.revocations == nil {
+		return fmt.Errorf("admin tokens can't be revoked")
+	}
+	return t.revocations.Revoke(claims.ID, claims.ExpiresAt.Time)
+}
+
+// Refresh exchanges a valid token for a new one for the same subject, revoking the old
+// token when revocation is enabled
+func (t *Tokens) Refresh(tokenString string) (string, int64, error) {
+	claims, err := t.Validate(tokenString)
+	if err != nil {
+		return "", 0, err
+	}
+	token, expiresAt, err := t.IssueFor(claims.Subject)
+	if err != nil {
+		return "", 0, err
+	}
+	if t.revocations != nil {
+		if err := t.revocations.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+			return "", 0, err
+		}
+	}
+	return token, expiresAt, nil
+}
+
+// ValidToken reports whether tokenString is a valid admin token
+func (t *Tokens) ValidToken(tokenString string) bool {
+	_, err := t.Validate(tokenString)
+	return err == nil
+}
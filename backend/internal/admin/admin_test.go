@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCheckPassword(t *testing.T) {
+	if err := CheckPassword("", "anything"); err != ErrNotConfigured {
+		t.Errorf("CheckPassword without a configured password = %v, want ErrNotConfigured", err)
+	}
+	if err := CheckPassword("secret", "wrong"); err != ErrInvalidPassword {
+		t.Errorf("CheckPassword with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+	if err := CheckPassword("secret", "secret"); err != nil {
+		t.Errorf("CheckPassword with the right password = %v", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tokens := NewTokens([]byte("test-secret"), time.Hour)
+	now := time.Now()
+	tokens.now = func() time.Time { return now }
+
+	token, expiresAt, err := tokens.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt != now.Add(time.Hour).Unix() {
+		t.Errorf("expiresAt = %d, want %d", expiresAt, now.Add(time.Hour).Unix())
+	}
+	if !tokens.ValidToken(token) {
+		t.Error("freshly issued token rejected")
+	}
+
+	if claims, err := tokens.Validate(token); err != nil || claims.Subject != "admin" {
+		t.Errorf("Issue subject = %v, %v; want admin", claims, err)
+	}
+	named, _, err := tokens.IssueFor("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := tokens.Validate(named); err != nil || claims.Subject != "alice" {
+		t.Errorf("IssueFor subject = %v, %v; want alice", claims, err)
+	}
+
+	if NewTokens([]byte("other-secret"), time.Hour).ValidToken(token) {
+		t.Error("token accepted with a different secret")
+	}
+
+	tokens.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if tokens.ValidToken(token) {
+		t.Error("expired token accepted")
+	}
+
+	// A validly signed token without the admin claim is not an admin token
+	claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}}
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	unsigned.Header["kid"] = KeyID([]byte("test-secret"))
+	unprivileged, err := unsigned.SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens.now = func() time.Time { return now }
+	if tokens.ValidToken(unprivileged) {
+		t.Error("token without the admin claim accepted")
+	}
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+	old := NewTokens([]byte("old-secret"), time.Hour)
+	token, _, err := old.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := NewTokens([]byte("new-secret"), time.Hour, []byte("old-secret"))
+	if !rotated.ValidToken(token) {
+		t.Error("token signed with the previous secret rejected")
+	}
+	fresh, _, err := rotated.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.ValidToken(fresh) {
+		t.Error("token signed with the new secret accepted by the old key set")
+	}
+	if NewTokens([]byte("new-secret"), time.Hour).ValidToken(token) {
+		t.Error("token accepted after its secret was retired")
+	}
+
+	// Without a kid there is no key to check the signature with
+	claims := &Claims{IsAdmin: true, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("new-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ValidToken(legacy) {
+		t.Error("token without a kid accepted")
+	}
+}
+
+type memoryRevocations map[string]time.Time
+
+func (m memoryRevocations) Revoke(tokenID string, expiresAt time.Time) error {
+	m[tokenID] = expiresAt
+	return nil
+}
+
+func (m memoryRevocations) Revoked(tokenID string) (bool, error) {
+	_, ok := m[tokenID]
+	return ok, nil
+}
+
+func TestTokenRevocation(t *testing.T) {
+	revoked := memoryRevocations{}
+	tokens := NewTokens([]byte("test-secret"), time.Hour).WithRevocations(revoked)
+
+	token, _, err := tokens.IssueFor("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed, _, err := tokens.Refresh(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.ValidToken(token) {
+		t.Error("token still valid after it was refreshed")
+	}
+	if claims, err := tokens.Validate(refreshed); err != nil || claims.Subject != "alice" {
+		t.Errorf("refreshed token = %v, %v; want subject alice", claims, err)
+	}
+	if _, _, err := tokens.Refresh(token); err != ErrRevoked {
+		t.Errorf("refreshing a revoked token = %v, want ErrRevoked", err)
+	}
+
+	if err := tokens.Revoke(refreshed); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.ValidToken(refreshed) {
+		t.Error("token still valid after it was revoked")
+	}
+	if len(revoked) != 2 {
+		t.Errorf("%d revocations recorded, want 2", len(revoked))
+	}
+}
@@ -0,0 +1,95 @@
+// Package chunks holds the rules of chunked uploads: how a file is split into chunks,
+// which limits a new upload must respect, and how received chunks are tracked.
+package chunks
+
+import "errors"
+
+var (
+	// ErrInvalidSize is returned for a non-positive total or chunk size
+	ErrInvalidSize = errors.New("total size and chunk size must be positive")
+	// ErrFileTooLarge is returned when the total size exceeds Limits.MaxFileSize
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrChunkTooLarge is returned when the chunk size exceeds Limits.MaxChunkSize
+	ErrChunkTooLarge = errors.New("chunk size too large")
+	// ErrTooManyChunks is returned when the file would need more than Limits.MaxChunks chunks
+	ErrTooManyChunks = errors.New("too many chunks")
+)
+
+// Limits bound the chunked uploads a server accepts
+type Limits struct {
+	MaxFileSize  int64
+	MaxChunkSize int64
+	MaxChunks    int
+}
+
+// Plan describes how a file of TotalSize bytes is split into chunks of ChunkSize bytes;
+// only the last chunk may be shorter
+type Plan struct {
+	TotalSize   int64
+	ChunkSize   int64
+	TotalChunks int
+}
+
+// NewPlan validates a requested upload against limits and computes its chunk count
+func NewPlan(totalSize, chunkSize int64, limits Limits) (Plan, error) {
+	if totalSize <= 0 || chunkSize <= 0 {
+		return Plan{}, ErrInvalidSize
+	}
+	if totalSize > limits.MaxFileSize {
+		return Plan{}, ErrFileTooLarge
+	}
+	if chunkSize > limits.MaxChunkSize {
+		return Plan{}, ErrChunkTooLarge
+	}
+
+	totalChunks := (totalSize + chunkSize - 1) / chunkSize
+	if totalChunks > int64(limits.MaxChunks) {
+		return Plan{}, ErrTooManyChunks
+	}
+	return Plan{TotalSize: totalSize, ChunkSize: chunkSize, TotalChunks: int(totalChunks)}, nil
+}
+
+// ValidIndex reports whether index names a chunk of the plan
+func (p Plan) ValidIndex(index int) bool {
+	return index >= 0 && index < p.TotalChunks
+}
+
+// ExpectedSize returns the size of a complete chunk at the given index
+func (p Plan) ExpectedSize(index int) int64 {
+	if index == p.TotalChunks-1 {
+		return p.TotalSize - int64(p.TotalChunks-1)*p.ChunkSize
+	}
+	return p.ChunkSize
+}
+
+// CountReceived returns how many chunks of a received bitmap are set
+func CountReceived(received []bool) int {
+	count := 0
+	for _, ok := range received {
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// FirstMissing returns the index of the first chunk not yet received, or -1
+func FirstMissing(received []bool) int {
+	for i, ok := range received {
+		if !ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// Missing returns the indexes of the chunks not yet received, in order
+func Missing(received []bool) []int {
+	missing := make([]int, 0)
+	for i, ok := range received {
+		if !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
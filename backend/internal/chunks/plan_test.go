@@ -0,0 +1,60 @@
+package chunks
+
+import "testing"
+
+func TestNewPlan(t *testing.T) {
+	limits := Limits{MaxFileSize: 1000, MaxChunkSize: 100, MaxChunks: 10}
+
+	plan, err := NewPlan(950, 100, limits)
+	if err != nil {
+		t.Fatalf("NewPlan rejected a valid upload: %v", err)
+	}
+	if plan.TotalChunks != 10 {
+		t.Errorf("TotalChunks = %d, want 10", plan.TotalChunks)
+	}
+	if got := plan.ExpectedSize(0); got != 100 {
+		t.Errorf("ExpectedSize(0) = %d, want 100", got)
+	}
+	if got := plan.ExpectedSize(9); got != 50 {
+		t.Errorf("ExpectedSize(9) = %d, want 50", got)
+	}
+	if plan.ValidIndex(-1) || plan.ValidIndex(10) || !plan.ValidIndex(9) {
+		t.Error("ValidIndex accepts indexes outside the plan")
+	}
+
+	cases := []struct {
+		totalSize, chunkSize int64
+		want                 error
+	}{
+		{0, 100, ErrInvalidSize},
+		{500, 0, ErrInvalidSize},
+		{500, -100, ErrInvalidSize},
+		{1001, 100, ErrFileTooLarge},
+		{500, 101, ErrChunkTooLarge},
+		{1000, 50, ErrTooManyChunks},
+	}
+	for _, tc := range cases {
+		if _, err := NewPlan(tc.totalSize, tc.chunkSize, limits); err != tc.want {
+			t.Errorf("NewPlan(%d, %d) = %v, want %v", tc.totalSize, tc.chunkSize, err, tc.want)
+		}
+	}
+}
+
+func TestReceivedBitmap(t *testing.T) {
+	received := []bool{true, false, true, false}
+	if got := CountReceived(received); got != 2 {
+		t.Errorf("CountReceived = %d, want 2", got)
+	}
+	if got := FirstMissing(received); got != 1 {
+		t.Errorf("FirstMissing = %d, want 1", got)
+	}
+	if got := FirstMissing([]bool{true, true}); got != -1 {
+		t.Errorf("FirstMissing of a complete upload = %d, want -1", got)
+	}
+	if got := Missing(received); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("Missing = %v, want [1 3]", got)
+	}
+	if got := Missing([]bool{true, true}); got == nil || len(got) != 0 {
+		t.Errorf("Missing of a complete upload = %v, want []", got)
+	}
+}
@@ -0,0 +1,44 @@
+package files
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"math/big"
+)
+
+// TokenValidator checks admin tokens, which unlock every file
+type TokenValidator interface {
+	ValidToken(token string) bool
+}
+
+// Credentials are what a request presented to read a password-protected file
+type Credentials struct {
+	Password   string
+	AdminToken string
+}
+
+// CanDownload reports whether creds unlock a file. Files without a download password are
+// readable by anyone; protected files need the password or a valid admin token.
+func CanDownload(hasPassword bool, storedPassword *string, creds Credentials, admins TokenValidator) bool {
+	if !hasPassword {
+		return true
+	}
+	if creds.AdminToken != "" && admins != nil && admins.ValidToken(creds.AdminToken) {
+		return true
+	}
+	return storedPassword != nil && subtle.ConstantTimeCompare([]byte(creds.Password), []byte(*storedPassword)) == 1
+}
+
+// GeneratePassword returns a random 12 character alphanumeric password, used for delete
+// passwords and as a building block for keys
+func GeneratePassword() string {
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	const length = 12
+
+	password := make([]byte, length)
+	for i := range password {
+		num, _ := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		password[i] = charset[num.Int64()]
+	}
+	return string(password)
+}
@@ -0,0 +1,53 @@
+package files
+
+import "testing"
+
+type staticTokens string
+
+func (s staticTokens) ValidToken(token string) bool {
+	return token == string(s)
+}
+
+func TestCanDownload(t *testing.T) {
+	secret := "hunter2"
+	admins := staticTokens("admin-token")
+
+	cases := []struct {
+		name        string
+		hasPassword bool
+		stored      *string
+		creds       Credentials
+		want        bool
+	}{
+		{"public file", false, nil, Credentials{}, true},
+		{"correct password", true, &secret, Credentials{Password: "hunter2"}, true},
+		{"wrong password", true, &secret, Credentials{Password: "hunter3"}, false},
+		{"missing password", true, &secret, Credentials{}, false},
+		{"admin token", true, &secret, Credentials{AdminToken: "admin-token"}, true},
+		{"invalid admin token", true, &secret, Credentials{AdminToken: "forged"}, false},
+		{"protected without stored password", true, nil, Credentials{}, false},
+	}
+	for _, tc := range cases {
+		if got := CanDownload(tc.hasPassword, tc.stored, tc.creds, admins); got != tc.want {
+			t.Errorf("%s: CanDownload = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if CanDownload(true, &secret, Credentials{AdminToken: "admin-token"}, nil) {
+		t.Error("CanDownload accepted an admin token without a validator")
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		password := GeneratePassword()
+		if len(password) != 12 {
+			t.Fatalf("GeneratePassword = %q, want 12 characters", password)
+		}
+		if seen[password] {
+			t.Fatalf("GeneratePassword repeated %q", password)
+		}
+		seen[password] = true
+	}
+}
@@ -0,0 +1,78 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CollisionPolicy decides what happens when a name is added to a namespace, such as a
+// collection, that already holds it. Names are compared case-insensitively, since the
+// archives and filesystems they end up in often are.
+type CollisionPolicy string
+
+const (
+	CollisionReject    CollisionPolicy = "reject"    // Refuse the new name
+	CollisionRename    CollisionPolicy = "rename"    // Number the new name, like "notes (2).txt"
+	CollisionOverwrite CollisionPolicy = "overwrite" // The new entry replaces the old one
+)
+
+// ErrNameTaken is returned by Namespace.Add under CollisionReject
+var ErrNameTaken = errors.New("name already taken")
+
+// ParseCollisionPolicy reads a policy name, returning fallback for an empty one
+func ParseCollisionPolicy(name string, fallback CollisionPolicy) (CollisionPolicy, error) {
+	switch policy := CollisionPolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return fallback, nil
+	case CollisionReject, CollisionRename, CollisionOverwrite:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown name collision policy %q: use reject, rename or overwrite", name)
+	}
+}
+
+// Namespace hands out names for entries added in order under a collision policy
+type Namespace struct {
+	policy CollisionPolicy
+	used   map[string]int // Lowercased name to the index of the entry holding it
+	next   int
+}
+
+// NewNamespace returns an empty namespace
+func NewNamespace(policy CollisionPolicy) *Namespace {
+	return &Namespace{policy: policy, used: make(map[string]int)}
+}
+
+// Add names the next entry. It returns the name the entry gets and, when the entry
+// overwrites an earlier one, that entry's index; otherwise replaced is -1.
+func (n *Namespace) Add(name string) (assigned string, replaced int, err error) {
+	index := n.next
+	key := strings.ToLower(name)
+	earlier, taken := n.used[key]
+	if !taken {
+		n.used[key] = index
+		n.next++
+		return name, -1, nil
+	}
+
+	switch n.policy {
+	case CollisionReject:
+		return "", -1, fmt.Errorf("%w: %s", ErrNameTaken, name)
+	case CollisionOverwrite:
+		n.used[key] = index
+		n.next++
+		return name, earlier, nil
+	default:
+		ext := path.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for i := 2; taken; i++ {
+			assigned = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+			_, taken = n.used[strings.ToLower(assigned)]
+		}
+		n.used[strings.ToLower(assigned)] = index
+		n.next++
+		return assigned, -1, nil
+	}
+}
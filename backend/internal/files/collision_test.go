@@ -0,0 +1,59 @@
+package files
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNamespaceRename(t *testing.T) {
+	ns := NewNamespace(CollisionRename)
+	var got []string
+	for _, name := range []string{"notes.txt", "Notes.txt", "notes (2).txt", "notes.txt", "README"} {
+		assigned, replaced, err := ns.Add(name)
+		if err != nil || replaced != -1 {
+			t.Fatalf("Add(%q) = %q, %d, %v", name, assigned, replaced, err)
+		}
+		got = append(got, assigned)
+	}
+	want := []string{"notes.txt", "Notes (2).txt", "notes (2) (2).txt", "notes (3).txt", "README"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("names = %q, want %q", got, want)
+			break
+		}
+	}
+}
+
+func TestNamespaceReject(t *testing.T) {
+	ns := NewNamespace(CollisionReject)
+	if _, _, err := ns.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ns.Add("A.TXT"); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("duplicate: err = %v, want ErrNameTaken", err)
+	}
+}
+
+func TestNamespaceOverwrite(t *testing.T) {
+	ns := NewNamespace(CollisionOverwrite)
+	ns.Add("a.txt")
+	ns.Add("b.txt")
+	if name, replaced, err := ns.Add("a.txt"); err != nil || name != "a.txt" || replaced != 0 {
+		t.Errorf("Add = %q, %d, %v; want a.txt replacing 0", name, replaced, err)
+	}
+	if _, replaced, _ := ns.Add("a.txt"); replaced != 2 {
+		t.Errorf("second overwrite replaced %d, want 2", replaced)
+	}
+}
+
+func TestParseCollisionPolicy(t *testing.T) {
+	if policy, err := ParseCollisionPolicy("", CollisionRename); err != nil || policy != CollisionRename {
+		t.Errorf("empty = %q, %v", policy, err)
+	}
+	if policy, err := ParseCollisionPolicy(" Reject ", CollisionRename); err != nil || policy != CollisionReject {
+		t.Errorf("Reject = %q, %v", policy, err)
+	}
+	if _, err := ParseCollisionPolicy("merge", CollisionRename); err == nil {
+		t.Error("unknown policy accepted")
+	}
+}
@@ -0,0 +1,123 @@
+package files
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// convertToUTF8 tries to convert string from various Japanese encodings to UTF-8
+func convertToUTF8(input string) string {
+	// First check if it's already valid UTF-8
+	if utf8.ValidString(input) {
+		return input
+	}
+
+	// Convert string to bytes for better encoding detection
+	inputBytes := []byte(input)
+
+	// Try to convert from Shift_JIS (most common for Windows ZIP files)
+	decoder := japanese.ShiftJIS.NewDecoder()
+	if result, _, err := transform.Bytes(decoder, inputBytes); err == nil {
+		resultStr := string(result)
+		if utf8.ValidString(resultStr) && containsJapanese(resultStr) {
+			return resultStr
+		}
+	}
+
+	// Try to convert from EUC-JP
+	decoder = japanese.EUCJP.NewDecoder()
+	if result, _, err := transform.Bytes(decoder, inputBytes); err == nil {
+		resultStr := string(result)
+		if utf8.ValidString(resultStr) && containsJapanese(resultStr) {
+			return resultStr
+		}
+	}
+
+	// Try to convert from ISO-2022-JP
+	decoder = japanese.ISO2022JP.NewDecoder()
+	if result, _, err := transform.Bytes(decoder, inputBytes); err == nil {
+		resultStr := string(result)
+		if utf8.ValidString(resultStr) && containsJapanese(resultStr) {
+			return resultStr
+		}
+	}
+
+	// If all conversions fail, return the original string
+	return input
+}
+
+// containsJapanese checks if the string contains Japanese characters
+func containsJapanese(s string) bool {
+	for _, r := range s {
+		// Check for Hiragana, Katakana, and Kanji ranges
+		if (r >= 0x3040 && r <= 0x309F) || // Hiragana
+			(r >= 0x30A0 && r <= 0x30FF) || // Katakana
+			(r >= 0x4E00 && r <= 0x9FAF) { // Kanji
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeArchiveName converts an archive entry name from the legacy Japanese encodings
+// common in ZIP files created on Windows. The result is always valid UTF-8.
+func DecodeArchiveName(name string) string {
+	// If it's already valid UTF-8 and contains readable characters, return as-is
+	if utf8.ValidString(name) && isReadableText(name) {
+		return name
+	}
+
+	// Convert the filename string back to raw bytes
+	// Go's ZIP reader reads filenames as latin-1, so we need to convert back to bytes
+	rawBytes := make([]byte, len(name))
+	for i, r := range []byte(name) {
+		rawBytes[i] = r
+	}
+
+	// Try Shift_JIS conversion (most common for Japanese Windows ZIP files)
+	decoder := japanese.ShiftJIS.NewDecoder()
+	if converted, _, err := transform.Bytes(decoder, rawBytes); err == nil {
+		result := string(converted)
+		if utf8.ValidString(result) && containsJapanese(result) {
+			return result
+		}
+	}
+
+	// Try EUC-JP conversion
+	decoder = japanese.EUCJP.NewDecoder()
+	if converted, _, err := transform.Bytes(decoder, rawBytes); err == nil {
+		result := string(converted)
+		if utf8.ValidString(result) && containsJapanese(result) {
+			return result
+		}
+	}
+
+	// If conversion fails, try the original convertToUTF8 function; it returns its input
+	// unchanged when nothing decodes, so replace whatever invalid bytes remain
+	return strings.ToValidUTF8(convertToUTF8(name), "\uFFFD")
+}
+
+// isReadableText checks if the string contains mostly readable characters
+func isReadableText(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+
+	readableCount := 0
+	for _, r := range s {
+		// Count printable ASCII, Japanese characters, and common punctuation
+		if (r >= 32 && r <= 126) || // ASCII printable
+			(r >= 0x3040 && r <= 0x309F) || // Hiragana
+			(r >= 0x30A0 && r <= 0x30FF) || // Katakana
+			(r >= 0x4E00 && r <= 0x9FAF) || // Kanji
+			r == '/' || r == '\\' || r == '.' || r == '-' || r == '_' {
+			readableCount++
+		}
+	}
+
+	// If more than 70% of characters are readable, consider it valid
+	return float64(readableCount)/float64(len([]rune(s))) > 0.7
+}
@@ -0,0 +1,36 @@
+package files
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDecodeArchiveName(t *testing.T) {
+	cases := map[string]string{
+		"report.pdf":                   "report.pdf",
+		"写真/旅行.jpg":                    "写真/旅行.jpg",
+		"\x83e\x83X\x83g.txt":          "テスト.txt", // Shift_JIS
+		"\xa5\xc6\xa5\xb9\xa5\xc8.txt": "テスト.txt", // EUC-JP
+	}
+	for name, want := range cases {
+		if got := DecodeArchiveName(name); got != want {
+			t.Errorf("DecodeArchiveName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func FuzzDecodeArchiveName(f *testing.F) {
+	for _, name := range []string{"report.pdf", "写真/旅行.jpg", "\x83e\x83X\x83g.txt", "\xa5\xc6\xa5\xb9\xa5\xc8.txt", "\xff\xfe.bin", ""} {
+		f.Add(name)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		decoded := DecodeArchiveName(name)
+		if !utf8.ValidString(decoded) {
+			t.Fatalf("DecodeArchiveName(%q) = %q, not valid UTF-8", name, decoded)
+		}
+		if utf8.ValidString(name) && isReadableText(name) && decoded != name {
+			t.Fatalf("DecodeArchiveName(%q) changed a readable UTF-8 name to %q", name, decoded)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+// Package files holds the rules for stored files that don't depend on HTTP or on where
+// content lives: name and MIME type normalization, archive filename decoding, byte range
+// parsing and download access.
+package files
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxFilenameBytes matches the filename limit of common filesystems
+const maxFilenameBytes = 255
+
+// windowsReservedNames can't be used as file names on Windows, with or without an extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// NormalizeName turns a client-provided name into one that is safe to store, serve
+// and save on any platform: NFC-normalized, without directory components, control or
+// bidi formatting characters, characters reserved on Windows, or reserved device names.
+func NormalizeName(name string) string {
+	name = strings.ToValidUTF8(name, "_")
+	name = norm.NFC.String(name)
+
+	// Keep only the last path element, whichever separator the client used
+	name = strings.ReplaceAll(name, "\\", "/")
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			// Drop control characters and invisible formatting such as RTL overrides
+		case strings.ContainsRune(`<>:"|?*`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	name = b.String()
+
+	// Windows ignores trailing dots and spaces; this also reduces "." and ".." to nothing
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if name == "" {
+		return "file"
+	}
+
+	base := name
+	if idx := strings.Index(base, "."); idx >= 0 {
+		base = base[:idx]
+	}
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+
+	return truncateFilename(name, maxFilenameBytes)
+}
+
+// truncateFilename shortens a name to at most maxBytes, keeping its extension and
+// never splitting a UTF-8 sequence
+func truncateFilename(name string, maxBytes int) string {
+	if len(name) <= maxBytes {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxBytes/2 {
+		ext = ""
+	}
+	stem := name[:len(name)-len(ext)]
+
+	limit := maxBytes - len(ext)
+	for limit > 0 && !utf8.RuneStart(stem[limit]) {
+		limit--
+	}
+	return stem[:limit] + ext
+}
+
+// ContentDisposition builds a Content-Disposition header value with an ASCII fallback
+// name and an RFC 5987 encoded UTF-8 name, so non-ASCII names survive in all clients
+func ContentDisposition(dispositionType, filename string) string {
+	filename = NormalizeName(filename)
+
+	var fallback strings.Builder
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+
+	return dispositionType + `; filename="` + fallback.String() + `"; filename*=UTF-8''` + encodeRFC5987(filename)
+}
+
+// encodeRFC5987 percent-encodes everything except RFC 5987 attr-chars
+func encodeRFC5987(value string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if ch < 0x80 && (('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9') || strings.IndexByte("!#$&+-.^_`|~", ch) >= 0) {
+			b.WriteByte(ch)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[ch>>4])
+			b.WriteByte(hex[ch&0x0f])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package files
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	cases := map[string]string{
+		"report.pdf":            "report.pdf",
+		"../../etc/passwd":      "passwd",
+		`C:\Users\me\notes.txt`: "notes.txt",
+		"a<b>c:d.txt":           "a_b_c_d.txt",
+		"evil\u202etxt.exe":     "eviltxt.exe",
+		"CON.txt":               "_CON.txt",
+		"trailing. . ":          "trailing",
+		"..":                    "file",
+		"":                      "file",
+		"e\u0301t\u00e9.txt":    "\u00e9t\u00e9.txt", // NFC
+		"bad\xffbyte.txt":       "bad_byte.txt",
+	}
+	for name, want := range cases {
+		if got := NormalizeName(name); got != want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	long := strings.Repeat("あ", 100) + ".txt"
+	if got := NormalizeName(long); len(got) > maxFilenameBytes || !strings.HasSuffix(got, ".txt") {
+		t.Errorf("NormalizeName of a long name = %q (%d bytes)", got, len(got))
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	got := ContentDisposition("attachment", "résumé \"final\".pdf")
+	want := `attachment; filename="r_sum_ _final_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%20_final_.pdf`
+	if got != want {
+		t.Errorf("ContentDisposition = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,151 @@
+package files
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// PreviewableMimePrefixes lists MIME type prefixes that can be previewed in the browser
+var PreviewableMimePrefixes = []string{
+	"image/", "text/", "application/json", "application/xml",
+	"video/", "audio/", "application/pdf", "application/zip",
+	"font/", "model/",
+}
+
+// MimeType returns the MIME type for a file name from its extension
+func MimeType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	// Manual mapping for common types (fallback first)
+	switch ext {
+	case ".txt":
+		return "text/plain"
+	case ".json":
+		return "application/json"
+	case ".xml":
+		return "application/xml"
+	case ".html":
+		return "text/html"
+	case ".css":
+		return "text/css"
+	case ".js":
+		return "text/javascript"
+	case ".png":
+		return "image/png"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".pdf":
+		return "application/pdf"
+	// Video files
+	case ".mp4":
+		return "video/mp4"
+	case ".webm":
+		return "video/webm"
+	case ".ogv":
+		return "video/ogg"
+	case ".avi":
+		return "video/x-msvideo"
+	case ".mov":
+		return "video/quicktime"
+	case ".wmv":
+		return "video/x-ms-wmv"
+	case ".flv":
+		return "video/x-flv"
+	case ".mkv":
+		return "video/x-matroska"
+	// Audio files
+	case ".mp3":
+		return "audio/mpeg"
+	case ".wav":
+		return "audio/wav"
+	case ".ogg":
+		return "audio/ogg"
+	case ".aac":
+		return "audio/aac"
+	case ".flac":
+		return "audio/flac"
+	case ".m4a":
+		return "audio/mp4"
+	case ".zip":
+		return "application/zip"
+	case ".tar":
+		return "application/x-tar"
+	case ".gz", ".tgz":
+		return "application/gzip"
+	case ".zst", ".tzst":
+		return "application/zstd"
+	// Fonts
+	case ".ttf":
+		return "font/ttf"
+	case ".otf":
+		return "font/otf"
+	case ".woff":
+		return "font/woff"
+	case ".woff2":
+		return "font/woff2"
+	// Data formats
+	case ".ipynb":
+		return "application/x-ipynb+json"
+	case ".geojson":
+		return "application/geo+json"
+	case ".csv":
+		return "text/csv"
+	case ".tsv", ".tab":
+		return "text/tab-separated-values"
+	// 3D models
+	case ".gltf":
+		return "model/gltf+json"
+	case ".glb":
+		return "model/gltf-binary"
+	case ".obj":
+		return "model/obj"
+	case ".stl":
+		return "model/stl"
+	}
+
+	// Try Go standard library as fallback
+	mimeType := mime.TypeByExtension(ext)
+	if mimeType != "" {
+		// Drop parameters such as "; charset=utf-8" that some platforms add
+		mimeType = NormalizeMimeType(mimeType)
+		return mimeType
+	}
+
+	// Default fallback
+	return "application/octet-stream"
+}
+
+// NormalizeMimeType lowercases a MIME type and strips parameters such as charset,
+// falling back to application/octet-stream for anything unparsable
+func NormalizeMimeType(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// IsPreviewable reports whether a browser can display the MIME type inline
+func IsPreviewable(mimeType string) bool {
+	for _, prefix := range PreviewableMimePrefixes {
+		if strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMediaFile reports whether the MIME type is audio or video
+func IsMediaFile(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "video/") || strings.HasPrefix(mimeType, "audio/")
+}
+
+// IsImageFile reports whether the MIME type is an image
+func IsImageFile(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
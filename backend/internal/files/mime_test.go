@@ -0,0 +1,36 @@
+package files
+
+import "testing"
+
+func TestMimeType(t *testing.T) {
+	cases := map[string]string{
+		"photo.JPG":      "image/jpeg",
+		"clip.mp4":       "video/mp4",
+		"notebook.ipynb": "application/x-ipynb+json",
+		"data.tsv":       "text/tab-separated-values",
+		"archive.zip":    "application/zip",
+		"backup.tar.gz":  "application/gzip",
+		"backup.tar.zst": "application/zstd",
+		"unknown.zzzz":   "application/octet-stream",
+		"no-extension":   "application/octet-stream",
+	}
+	for name, want := range cases {
+		if got := MimeType(name); got != want {
+			t.Errorf("MimeType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeMimeType(t *testing.T) {
+	cases := map[string]string{
+		"text/plain; charset=utf-8": "text/plain",
+		"Image/PNG":                 "image/png",
+		"garbage":                   "application/octet-stream",
+		"":                          "application/octet-stream",
+	}
+	for mimeType, want := range cases {
+		if got := NormalizeMimeType(mimeType); got != want {
+			t.Errorf("NormalizeMimeType(%q) = %q, want %q", mimeType, got, want)
+		}
+	}
+}
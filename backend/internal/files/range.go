@@ -0,0 +1,109 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range represents a byte range
+type Range struct {
+	Start int64
+	End   int64 // Inclusive
+}
+
+// MaxRanges caps how many range specs a single Range header may carry
+const MaxRanges = 16
+
+// ErrNotSatisfiable is returned for a well-formed Range header none of whose ranges
+// overlap the file; the client should get 416. Other errors mean the header is malformed
+// and, as RFC 9110 requires, should be ignored.
+var ErrNotSatisfiable = errors.New("range not satisfiable")
+
+// ParseRange parses an HTTP Range header against a file of fileSize bytes. Every range
+// returned is satisfiable; ranges that aren't are dropped as long as one remains.
+func ParseRange(rangeHeader string, fileSize int64) ([]Range, error) {
+	// Only byte ranges are supported
+	if !strings.HasPrefix(rangeHeader, "bytes=") {
+		return nil, fmt.Errorf("unsupported range unit")
+	}
+	rangeHeader = strings.TrimPrefix(rangeHeader, "bytes=")
+
+	// Parse range specifications
+	rangeSpecs := strings.Split(rangeHeader, ",")
+	if len(rangeSpecs) > MaxRanges {
+		return nil, fmt.Errorf("too many ranges")
+	}
+	var ranges []Range
+	unsatisfiable := false
+
+	for _, spec := range rangeSpecs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		// Parse individual range spec
+		if strings.HasPrefix(spec, "-") {
+			// Suffix range: -500 (last 500 bytes)
+			suffix, err := strconv.ParseInt(spec[1:], 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, fmt.Errorf("invalid range suffix: %s", spec)
+			}
+			if suffix == 0 || fileSize <= 0 {
+				unsatisfiable = true
+				continue
+			}
+			start := fileSize - suffix
+			if start < 0 {
+				start = 0
+			}
+			ranges = append(ranges, Range{Start: start, End: fileSize - 1})
+		} else if strings.HasSuffix(spec, "-") {
+			// Start range: 500- (from byte 500 to end)
+			start, err := strconv.ParseInt(spec[:len(spec)-1], 10, 64)
+			if err != nil || start < 0 {
+				return nil, fmt.Errorf("invalid range start: %s", spec)
+			}
+			if start >= fileSize {
+				unsatisfiable = true
+				continue
+			}
+			ranges = append(ranges, Range{Start: start, End: fileSize - 1})
+		} else {
+			// Full range: 500-1000
+			parts := strings.Split(spec, "-")
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid range format: %s", spec)
+			}
+			start, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range start: %s", parts[0])
+			}
+			end, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range end: %s", parts[1])
+			}
+			if start < 0 || start > end {
+				return nil, fmt.Errorf("invalid range: %d-%d", start, end)
+			}
+			if start >= fileSize {
+				unsatisfiable = true
+				continue
+			}
+			if end >= fileSize {
+				end = fileSize - 1
+			}
+			ranges = append(ranges, Range{Start: start, End: end})
+		}
+	}
+	if len(ranges) == 0 {
+		if unsatisfiable {
+			return nil, ErrNotSatisfiable
+		}
+		return nil, fmt.Errorf("no ranges specified")
+	}
+
+	return ranges, nil
+}
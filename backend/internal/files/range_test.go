@@ -0,0 +1,80 @@
+package files
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header string
+		size   int64
+		want   []Range
+	}{
+		{"bytes=0-99", 1000, []Range{{0, 99}}},
+		{"bytes=-500", 1000, []Range{{500, 999}}},
+		{"bytes=-5000", 1000, []Range{{0, 999}}},
+		{"bytes=500-", 1000, []Range{{500, 999}}},
+		{"bytes=900-5000", 1000, []Range{{900, 999}}},
+		{"bytes=0-0, 5-9", 1000, []Range{{0, 0}, {5, 9}}},
+	}
+	for _, tc := range cases {
+		got, err := ParseRange(tc.header, tc.size)
+		if err != nil {
+			t.Errorf("ParseRange(%q, %d) failed: %v", tc.header, tc.size, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("ParseRange(%q, %d) = %v, want %v", tc.header, tc.size, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("ParseRange(%q, %d) = %v, want %v", tc.header, tc.size, got, tc.want)
+			}
+		}
+	}
+
+	for _, header := range []string{"bytes=9-0", "bytes=", "items=0-5", "0-5", "bytes=a-b", "bytes=1-2-3", "bytes=--5"} {
+		if got, err := ParseRange(header, 1000); err == nil || errors.Is(err, ErrNotSatisfiable) {
+			t.Errorf("ParseRange(%q, 1000) = %v, %v; want a syntax error", header, got, err)
+		}
+	}
+	for _, header := range []string{"bytes=-0", "bytes=1000-", "bytes=1000-1999", "bytes=1000-,2000-2999"} {
+		if got, err := ParseRange(header, 1000); !errors.Is(err, ErrNotSatisfiable) {
+			t.Errorf("ParseRange(%q, 1000) = %v, %v; want ErrNotSatisfiable", header, got, err)
+		}
+	}
+	if got, err := ParseRange("bytes=-5", 0); !errors.Is(err, ErrNotSatisfiable) {
+		t.Errorf("ParseRange on an empty file = %v, %v; want ErrNotSatisfiable", got, err)
+	}
+	// Unsatisfiable ranges are dropped while another one overlaps the file
+	if got, err := ParseRange("bytes=2000-,0-9", 1000); err != nil || len(got) != 1 || got[0] != (Range{0, 9}) {
+		t.Errorf("ParseRange with one satisfiable range = %v, %v; want [{0 9}]", got, err)
+	}
+}
+
+func FuzzParseRange(f *testing.F) {
+	for _, header := range []string{"bytes=0-99", "bytes=-500", "bytes=500-", "bytes=0-0,5-9", "bytes=-0", "bytes=9-0", "bytes=", "items=0-5"} {
+		f.Add(header, int64(1000))
+	}
+	f.Add("bytes=-5", int64(0))
+
+	f.Fuzz(func(t *testing.T, header string, fileSize int64) {
+		if fileSize < 0 {
+			return
+		}
+		ranges, err := ParseRange(header, fileSize)
+		if err != nil {
+			return
+		}
+		if len(ranges) == 0 || len(ranges) > MaxRanges {
+			t.Fatalf("ParseRange(%q, %d) returned %d ranges", header, fileSize, len(ranges))
+		}
+		for _, r := range ranges {
+			if r.Start < 0 || r.Start > r.End || r.End >= fileSize {
+				t.Fatalf("ParseRange(%q, %d) returned unsatisfiable range %d-%d", header, fileSize, r.Start, r.End)
+			}
+		}
+	})
+}
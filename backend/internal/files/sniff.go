@@ -0,0 +1,71 @@
+package files
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SniffLength is how many leading bytes SniffMimeType looks at
+const SniffLength = 512
+
+// sniffCanonical maps the types content sniffing reports to the names MimeType uses
+var sniffCanonical = map[string]string{
+	"audio/wave":         "audio/wav",
+	"video/avi":          "video/x-msvideo",
+	"application/x-gzip": "application/gzip",
+}
+
+// sniffCompatible lists, per sniffed type, the more specific types that share its
+// signature. Matroska and WebM share the EBML header, the ISO media formats share the
+// ftyp box, and Ogg holds audio or video.
+var sniffCompatible = map[string][]string{
+	"video/webm":      {"video/x-matroska", "audio/webm"},
+	"video/mp4":       {"audio/mp4", "video/quicktime", "video/3gpp", "image/heic", "image/avif"},
+	"application/ogg": {"audio/ogg", "video/ogg", "audio/opus"},
+	"audio/wav":       {"audio/x-wav", "audio/vnd.wave"},
+}
+
+// zipContainerMarkers identify types stored as ZIP archives, such as office documents
+var zipContainerMarkers = []string{"+zip", "openxmlformats", "opendocument", "java-archive", "epub", "android.package-archive"}
+
+// SniffMimeType returns the type the leading bytes of a file identify, or "" when they
+// don't identify one more precisely than plain text or binary data
+func SniffMimeType(head []byte) string {
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	sniffed := NormalizeMimeType(http.DetectContentType(head))
+	if canonical, ok := sniffCanonical[sniffed]; ok {
+		sniffed = canonical
+	}
+	if sniffed == "application/octet-stream" || sniffed == "text/plain" {
+		return ""
+	}
+	return sniffed
+}
+
+// MimeMismatch reports whether a declared type contradicts the sniffed one. Types that
+// sniffing can't tell apart from the sniffed one, like a DOCX sniffed as ZIP, agree.
+func MimeMismatch(declared, sniffed string) bool {
+	if sniffed == "" || declared == sniffed {
+		return false
+	}
+	for _, compatible := range sniffCompatible[sniffed] {
+		if declared == compatible {
+			return false
+		}
+	}
+	switch sniffed {
+	case "application/zip":
+		for _, marker := range zipContainerMarkers {
+			if strings.Contains(declared, marker) {
+				return false
+			}
+		}
+	case "text/xml":
+		return !strings.Contains(declared, "xml")
+	case "text/html":
+		return declared != "application/xhtml+xml"
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package files
+
+import "testing"
+
+func TestSniffMimeType(t *testing.T) {
+	cases := map[string]string{
+		"\x89PNG\r\n\x1a\n\x00\x00":        "image/png",
+		"%PDF-1.7\n":                       "application/pdf",
+		"\x1f\x8b\x08\x00":                 "application/gzip",
+		"RIFF\x24\x00\x00\x00WAVEfmt ":     "audio/wav",
+		"just some notes\n":                "",
+		"\x00\x01\x02\x03\x04\x05\x06\x07": "",
+	}
+	for head, want := range cases {
+		if got := SniffMimeType([]byte(head)); got != want {
+			t.Errorf("SniffMimeType(%q) = %q, want %q", head, got, want)
+		}
+	}
+}
+
+func TestMimeMismatch(t *testing.T) {
+	cases := []struct {
+		declared, sniffed string
+		want              bool
+	}{
+		{"image/jpeg", "image/png", true},
+		{"application/octet-stream", "application/pdf", true},
+		{"text/plain", "image/png", true},
+		{"image/png", "image/png", false},
+		{"image/png", "", false},
+		{"video/x-matroska", "video/webm", false},
+		{"audio/mp4", "video/mp4", false},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip", false},
+		{"image/svg+xml", "text/xml", false},
+		{"text/plain", "text/xml", true},
+		{"text/plain", "text/html", true},
+	}
+	for _, tc := range cases {
+		if got := MimeMismatch(tc.declared, tc.sniffed); got != tc.want {
+			t.Errorf("MimeMismatch(%q, %q) = %v, want %v", tc.declared, tc.sniffed, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Package highlight detects the language of a text file and splits its lines into tokens
+// for syntax highlighting. It is a lexer, not a parser: it recognizes comments, strings,
+// numbers and keywords, which is all a preview needs to be readable.
+package highlight
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kind classifies a token
+type Kind string
+
+const (
+	Plain   Kind = "plain"
+	Keyword Kind = "keyword"
+	String  Kind = "string"
+	Comment Kind = "comment"
+	Number  Kind = "number"
+)
+
+// Token is a run of a line with one kind. The texts of a line's tokens add up to the line.
+type Token struct {
+	Kind Kind   `json:"kind"`
+	Text string `json:"text"`
+}
+
+// PlainText is the language of files that aren't highlighted
+const PlainText = "plaintext"
+
+type language struct {
+	lineComments []string
+	blockComment [2]string // Opening and closing delimiter, empty if none
+	quotes       string    // Single-line string delimiters
+	multiline    []string  // String delimiters that may span lines
+	keywords     map[string]bool
+}
+
+func words(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(list) {
+		set[word] = true
+	}
+	return set
+}
+
+var cStyle = [2]string{"/*", "*/"}
+
+var languages = map[string]*language{
+	"go": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"'`, multiline: []string{"`"},
+		keywords: words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota"),
+	},
+	"javascript": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"'`, multiline: []string{"`"},
+		keywords: words("async await break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new of return static super switch this throw try typeof var void while with yield null undefined true false"),
+	},
+	"typescript": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"'`, multiline: []string{"`"},
+		keywords: words("abstract any as async await boolean break case catch class const continue declare default delete do else enum export extends finally for from function if implements import in instanceof interface keyof let namespace never new number of private protected public readonly return static string super switch this throw try type typeof unknown var void while yield null undefined true false"),
+	},
+	"python": {
+		lineComments: []string{"#"}, quotes: `"'`, multiline: []string{`"""`, `'''`},
+		keywords: words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self"),
+	},
+	"ruby": {
+		lineComments: []string{"#"}, quotes: `"'`,
+		keywords: words("alias and begin break case class def defined? do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield"),
+	},
+	"rust": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"`,
+		keywords: words("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+	},
+	"java": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"'`,
+		keywords: words("abstract assert boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long native new package private protected public return short static super switch synchronized this throw throws try void volatile while null true false var record"),
+	},
+	"c": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"'`,
+		keywords: words("auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while NULL"),
+	},
+	"cpp": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"'`,
+		keywords: words("auto bool break case catch char class const constexpr continue default delete do double else enum explicit extern false float for friend goto if inline int long namespace new noexcept nullptr operator private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void volatile while"),
+	},
+	"csharp": {
+		lineComments: []string{"//"}, blockComment: cStyle, quotes: `"'`,
+		keywords: words("abstract as async await base bool break case catch class const continue default delegate do double else enum event explicit false finally float for foreach if implicit in int interface internal is lock long namespace new null object out override params private protected public readonly ref return sealed static string struct switch this throw true try typeof using var virtual void while"),
+	},
+	"php": {
+		lineComments: []string{"//", "#"}, blockComment: cStyle, quotes: `"'`,
+		keywords: words("abstract array as break case catch class const continue default do echo else elseif empty extends final finally for foreach function if implements include interface isset namespace new null private protected public require return static switch throw trait try use var while true false"),
+	},
+	"shell": {
+		lineComments: []string{"#"}, quotes: `"'`,
+		keywords: words("if then else elif fi case esac for while until do done in function return local export readonly unset shift exit"),
+	},
+	"sql": {
+		lineComments: []string{"--"}, blockComment: cStyle, quotes: `'"`,
+		keywords: words("select from where insert into values update set delete create table index view drop alter add column primary key foreign references join inner left right outer on group by order having limit offset as and or not null is in exists distinct union all case when then else end begin commit rollback SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE INDEX VIEW DROP ALTER ADD COLUMN PRIMARY KEY FOREIGN REFERENCES JOIN INNER LEFT RIGHT OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AS AND OR NOT NULL IS IN EXISTS DISTINCT UNION ALL CASE WHEN THEN ELSE END BEGIN COMMIT ROLLBACK"),
+	},
+	"css": {
+		blockComment: cStyle, quotes: `"'`,
+		keywords: words("important inherit initial unset none auto"),
+	},
+	"html": {
+		blockComment: [2]string{"<!--", "-->"}, quotes: `"'`,
+	},
+	"yaml": {
+		lineComments: []string{"#"}, quotes: `"'`,
+		keywords: words("true false null yes no on off"),
+	},
+	"toml": {
+		lineComments: []string{"#"}, quotes: `"'`, multiline: []string{`"""`, `'''`},
+		keywords: words("true false"),
+	},
+	"json": {
+		quotes:   `"`,
+		keywords: words("true false null"),
+	},
+	"dockerfile": {
+		lineComments: []string{"#"}, quotes: `"'`,
+		keywords: words("FROM RUN CMD LABEL EXPOSE ENV ADD COPY ENTRYPOINT VOLUME USER WORKDIR ARG ONBUILD STOPSIGNAL HEALTHCHECK SHELL AS"),
+	},
+}
+
+var extensions = map[string]string{
+	".go": "go",
+	".js": "javascript", ".mjs": "javascript", ".cjs": "javascript", ".jsx": "javascript",
+	".ts": "typescript", ".tsx": "typescript",
+	".py": "python", ".pyw": "python",
+	".rb":   "ruby",
+	".rs":   "rust",
+	".java": "java", ".kt": "java",
+	".c": "c", ".h": "c",
+	".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hpp": "cpp", ".hh": "cpp",
+	".cs":  "csharp",
+	".php": "php",
+	".sh":  "shell", ".bash": "shell", ".zsh": "shell",
+	".sql": "sql",
+	".css": "css", ".scss": "css",
+	".html": "html", ".htm": "html", ".xml": "html", ".svg": "html", ".vue": "html",
+	".yaml": "yaml", ".yml": "yaml",
+	".toml": "toml", ".ini": "toml",
+	".json": "json", ".geojson": "json", ".ipynb": "json",
+	".md": "markdown", ".markdown": "markdown",
+	".txt": PlainText, ".log": PlainText, ".csv": PlainText,
+}
+
+var interpreters = map[string]string{
+	"sh": "shell", "bash": "shell", "zsh": "shell", "dash": "shell",
+	"python": "python", "python3": "python", "python2": "python",
+	"node": "javascript", "ruby": "ruby", "php": "php",
+}
+
+// Detect returns the language of a file from its name, or from the interpreter on a
+// shebang first line, falling back to PlainText
+func Detect(filename, firstLine string) string {
+	base := filepath.Base(filename)
+	if base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile.") {
+		return "dockerfile"
+	}
+	if base == "Makefile" {
+		return "shell"
+	}
+	if lang, ok := extensions[strings.ToLower(filepath.Ext(base))]; ok {
+		return lang
+	}
+
+	if strings.HasPrefix(firstLine, "#!") {
+		fields := strings.Fields(firstLine[2:])
+		if len(fields) > 0 {
+			interpreter := filepath.Base(fields[0])
+			if interpreter == "env" && len(fields) > 1 {
+				interpreter = fields[1]
+			}
+			if lang, ok := interpreters[interpreter]; ok {
+				return lang
+			}
+		}
+	}
+	return PlainText
+}
+
+// Supported reports whether a language has highlighting rules; other languages come
+// back as a single plain token per line
+func Supported(lang string) bool {
+	return languages[lang] != nil
+}
+
+// Languages lists the languages with highlighting rules, sorted by name
+func Languages() []string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Highlighter tokenizes consecutive lines of one file, carrying block comments and
+// multi-line strings from one line to the next
+type Highlighter struct {
+	lang *language
+	// open is the closing delimiter of a comment or string left open by the previous line
+	open     string
+	openKind Kind
+}
+
+// New returns a Highlighter for lang
+func New(lang string) *Highlighter {
+	return &Highlighter{lang: languages[lang]}
+}
+
+// Line splits one line, without its line ending, into tokens
+func (h *Highlighter) Line(line string) []Token {
+	var tokens []Token
+	emit := func(kind Kind, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(tokens); n > 0 && tokens[n-1].Kind == kind {
+			tokens[n-1].Text += text
+			return
+		}
+		tokens = append(tokens, Token{Kind: kind, Text: text})
+	}
+
+	if h.lang == nil {
+		emit(Plain, line)
+		return tokens
+	}
+
+	i := 0
+	for i < len(line) {
+		if h.open != "" {
+			end := strings.Index(line[i:], h.open)
+			if end < 0 {
+				emit(h.openKind, line[i:])
+				return tokens
+			}
+			end += i + len(h.open)
+			emit(h.openKind, line[i:end])
+			h.open = ""
+			i = end
+			continue
+		}
+
+		rest := line[i:]
+		if prefix := hasAnyPrefix(rest, h.lang.lineComments); prefix != "" {
+			emit(Comment, rest)
+			return tokens
+		}
+		if opener := h.lang.blockComment[0]; opener != "" && strings.HasPrefix(rest, opener) {
+			h.open, h.openKind = h.lang.blockComment[1], Comment
+			emit(Comment, opener)
+			i += len(opener)
+			continue
+		}
+		if delim := hasAnyPrefix(rest, h.lang.multiline); delim != "" {
+			h.open, h.openKind = delim, String
+			emit(String, delim)
+			i += len(delim)
+			continue
+		}
+
+		ch := line[i]
+		switch {
+		case strings.IndexByte(h.lang.quotes, ch) >= 0:
+			end := scanQuoted(line, i)
+			emit(String, line[i:end])
+			i = end
+		case isDigit(ch):
+			end := i + 1
+			for end < len(line) && (isIdentByte(line[end]) || line[end] == '.') {
+				end++
+			}
+			emit(Number, line[i:end])
+			i = end
+		case isIdentStart(ch):
+			end := i + 1
+			for end < len(line) && isIdentByte(line[end]) {
+				end++
+			}
+			// Ruby's defined? and similar keep their trailing punctuation
+			if end < len(line) && line[end] == '?' && h.lang.keywords[line[i:end+1]] {
+				end++
+			}
+			word := line[i:end]
+			if h.lang.keywords[word] {
+				emit(Keyword, word)
+			} else {
+				emit(Plain, word)
+			}
+			i = end
+		default:
+			emit(Plain, line[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+func hasAnyPrefix(s string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// scanQuoted returns the end of the string starting at start, past its closing quote, or
+// the end of the line if the string isn't closed
+func scanQuoted(line string, start int) int {
+	quote := line[start]
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(line)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentByte(ch byte) bool {
+	return isIdentStart(ch) || isDigit(ch)
+}
@@ -0,0 +1,85 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		filename, firstLine, want string
+	}{
+		{"main.go", "", "go"},
+		{"App.TSX", "", "typescript"},
+		{"Dockerfile", "", "dockerfile"},
+		{"deploy", "#!/usr/bin/env bash", "shell"},
+		{"script", "#!/usr/bin/python3", "python"},
+		{"notes.txt", "#!/bin/sh", PlainText},
+		{"data.bin", "", PlainText},
+	}
+	for _, tc := range cases {
+		if got := Detect(tc.filename, tc.firstLine); got != tc.want {
+			t.Errorf("Detect(%q, %q) = %q, want %q", tc.filename, tc.firstLine, got, tc.want)
+		}
+	}
+}
+
+func TestLine(t *testing.T) {
+	h := New("go")
+	got := h.Line(`func main() { x := "a\"b" // done`)
+	want := []Token{
+		{Keyword, "func"}, {Plain, " main() { x := "}, {String, `"a\"b"`}, {Plain, " "}, {Comment, "// done"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Line = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Line = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLineCarriesState(t *testing.T) {
+	h := New("python")
+	lines := []string{`doc = """first`, `second`, `end""" + 1`}
+	kinds := [][]Kind{
+		{Plain, String},
+		{String},
+		{String, Plain, Number},
+	}
+	for i, line := range lines {
+		tokens := h.Line(line)
+		if len(tokens) != len(kinds[i]) {
+			t.Fatalf("line %d: tokens %v, want kinds %v", i, tokens, kinds[i])
+		}
+		for j, kind := range kinds[i] {
+			if tokens[j].Kind != kind {
+				t.Errorf("line %d token %d: %v, want %s", i, j, tokens[j], kind)
+			}
+		}
+	}
+}
+
+func FuzzLine(f *testing.F) {
+	for _, seed := range []string{`func x() {}`, `/* open`, `"unterminated`, `a = 'b\'' # c`, "日本語 `raw", `0x1F.5e3`} {
+		f.Add("go", seed)
+		f.Add("python", seed)
+	}
+
+	f.Fuzz(func(t *testing.T, lang, line string) {
+		h := New(lang)
+		for i := 0; i < 2; i++ {
+			var joined strings.Builder
+			for _, token := range h.Line(line) {
+				if token.Text == "" {
+					t.Fatalf("empty token in %q", line)
+				}
+				joined.WriteString(token.Text)
+			}
+			if joined.String() != line {
+				t.Fatalf("tokens of %q join to %q", line, joined.String())
+			}
+		}
+	})
+}
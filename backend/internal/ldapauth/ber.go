@@ -0,0 +1,155 @@
+package ldapauth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The handful of BER elements LDAPv3 messages are built from (RFC 4511 section 5.1)
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+)
+
+// maxMessageSize bounds a single LDAP message read from the server
+const maxMessageSize = 1 << 20
+
+var errMalformed = errors.New("malformed LDAP message")
+
+// element is a decoded BER TLV
+type element struct {
+	tag     byte
+	content []byte
+}
+
+// encode returns the TLV of tag with the concatenated contents
+func encode(tag byte, contents ...[]byte) []byte {
+	var length int
+	for _, content := range contents {
+		length += len(content)
+	}
+	out := append([]byte{tag}, encodeLength(length)...)
+	for _, content := range contents {
+		out = append(out, content...)
+	}
+	return out
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+	var octets []byte
+	for ; length > 0; length >>= 8 {
+		octets = append([]byte{byte(length)}, octets...)
+	}
+	return append([]byte{0x80 | byte(len(octets))}, octets...)
+}
+
+func encodeInt(tag byte, value int) []byte {
+	octets := []byte{byte(value)}
+	for value >>= 8; value > 0; value >>= 8 {
+		octets = append([]byte{byte(value)}, octets...)
+	}
+	// Keep non-negative values positive in two's complement
+	if octets[0]&0x80 != 0 {
+		octets = append([]byte{0}, octets...)
+	}
+	return encode(tag, octets)
+}
+
+func encodeString(tag byte, value string) []byte {
+	return encode(tag, []byte(value))
+}
+
+func encodeBool(value bool) []byte {
+	if value {
+		return encode(tagBoolean, []byte{0xff})
+	}
+	return encode(tagBoolean, []byte{0})
+}
+
+// readElement reads one complete element from r
+func readElement(r *bufio.Reader) (element, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return element{}, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		count := int(first &^ 0x80)
+		if count == 0 || count > 4 {
+			return element{}, errMalformed
+		}
+		length = 0
+		for i := 0; i < count; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return element{}, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxMessageSize {
+		return element{}, fmt.Errorf("LDAP message of %d bytes exceeds the limit", length)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return element{}, err
+	}
+	return element{tag: tag, content: content}, nil
+}
+
+// children splits a constructed element's content into its elements
+func (e element) children() ([]element, error) {
+	var out []element
+	data := e.content
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errMalformed
+		}
+		tag, length, header := data[0], int(data[1]), 2
+		if data[1]&0x80 != 0 {
+			count := int(data[1] &^ 0x80)
+			if count == 0 || count > 4 || len(data) < 2+count {
+				return nil, errMalformed
+			}
+			length = 0
+			for _, b := range data[2 : 2+count] {
+				length = length<<8 | int(b)
+			}
+			header += count
+		}
+		if length < 0 || len(data) < header+length {
+			return nil, errMalformed
+		}
+		out = append(out, element{tag: tag, content: data[header : header+length]})
+		data = data[header+length:]
+	}
+	return out, nil
+}
+
+// int decodes an INTEGER or ENUMERATED element
+func (e element) int() (int, error) {
+	if len(e.content) == 0 || len(e.content) > 4 {
+		return 0, errMalformed
+	}
+	value := 0
+	if e.content[0]&0x80 != 0 {
+		value = -1
+	}
+	for _, b := range e.content {
+		value = value<<8 | int(b)
+	}
+	return value, nil
+}
@@ -0,0 +1,370 @@
+// Package ldapauth authenticates users against an LDAP directory such as OpenLDAP or
+// Active Directory: it looks the user up with a service account, binds as the user to
+// check the password and maps the user's groups to roles.
+package ldapauth
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCredentials is returned for an unknown user or a wrong password
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// LDAP protocol operations (RFC 4511 section 4) and result codes
+const (
+	opBindRequest      = 0x60
+	opBindResponse     = 0x61
+	opUnbindRequest    = 0x42
+	opSearchRequest    = 0x63
+	opSearchEntry      = 0x64
+	opSearchDone       = 0x65
+	opSearchReference  = 0x73
+	filterEquality     = 0xa3
+	authSimple         = 0x80
+	scopeWholeSubtree  = 2
+	resultSuccess      = 0
+	resultInvalidCreds = 49
+)
+
+// Config describes the directory and how users and their groups are found in it
+type Config struct {
+	// URL of the server, ldap://host[:389] or ldaps://host[:636]
+	URL string
+	// Service account the user lookup binds as; empty searches anonymously
+	BindDN       string
+	BindPassword string
+	// Subtree users are searched in and the attribute holding the login name, e.g. uid
+	// for OpenLDAP or sAMAccountName for Active Directory
+	UserBaseDN    string
+	UserAttribute string
+	// Attribute of the user entry listing the DNs of their groups, usually memberOf
+	GroupAttribute string
+	// Roles granted to members of each group, keyed by group DN
+	GroupRoles map[string]string
+	// CAs trusted for ldaps://, nil for the system roots
+	RootCAs *x509.CertPool
+	Timeout time.Duration
+}
+
+// User is an authenticated directory user
+type User struct {
+	Username string
+	DN       string
+	Groups   []string
+	Roles    []string
+}
+
+// HasRole reports whether one of the user's groups grants role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator checks user credentials against the directory of its Config
+type Authenticator struct {
+	config     Config
+	address    string
+	tls        bool
+	serverName string
+	groupRoles map[string]string
+}
+
+// New validates config and returns an Authenticator for it
+func New(config Config) (*Authenticator, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid LDAP URL %q", config.URL)
+	}
+	a := &Authenticator{config: config, serverName: u.Hostname(), groupRoles: map[string]string{}}
+	switch u.Scheme {
+	case "ldap":
+		a.address = hostPort(u, "389")
+	case "ldaps":
+		a.address, a.tls = hostPort(u, "636"), true
+	default:
+		return nil, fmt.Errorf("unsupported LDAP URL scheme %q", u.Scheme)
+	}
+	if config.UserBaseDN == "" || config.UserAttribute == "" {
+		return nil, errors.New("the LDAP user base DN and attribute are required")
+	}
+	if a.config.GroupAttribute == "" {
+		a.config.GroupAttribute = "memberOf"
+	}
+	if a.config.Timeout <= 0 {
+		a.config.Timeout = 10 * time.Second
+	}
+	for group, role := range config.GroupRoles {
+		a.groupRoles[normalizeDN(group)] = role
+	}
+	return a, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// normalizeDN lowercases a DN and drops the spaces around its separators, so group DNs
+// written by hand match the ones the directory returns
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		if name, value, ok := strings.Cut(part, "="); ok {
+			part = strings.TrimSpace(name) + "=" + strings.TrimSpace(value)
+		}
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Authenticate looks up username, binds as them with password and returns the user with
+// the roles of their groups. An unknown user or wrong password yields
+// ErrInvalidCredentials; other errors mean the directory couldn't be asked.
+func (a *Authenticator) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	// A simple bind with an empty password is an unauthenticated bind, which most
+	// servers accept for any DN
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	if a.config.BindDN != "" {
+		if err := conn.bind(a.config.BindDN, a.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind failed: %v", err)
+		}
+	}
+
+	entries, err := conn.search(a.config.UserBaseDN, a.config.UserAttribute, username, []string{a.config.GroupAttribute})
+	if err != nil {
+		return nil, fmt.Errorf("user search failed: %v", err)
+	}
+	switch len(entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+	default:
+		return nil, fmt.Errorf("%d directory entries match user %q", len(entries), username)
+	}
+	entry := entries[0]
+
+	if err := conn.bind(entry.dn, password); err != nil {
+		return nil, err
+	}
+
+	user := &User{Username: username, DN: entry.dn}
+	roles := map[string]bool{}
+	for name, values := range entry.attributes {
+		if !strings.EqualFold(name, a.config.GroupAttribute) {
+			continue
+		}
+		for _, group := range values {
+			user.Groups = append(user.Groups, group)
+			if role, ok := a.groupRoles[normalizeDN(group)]; ok {
+				roles[role] = true
+			}
+		}
+	}
+	for role := range roles {
+		user.Roles = append(user.Roles, role)
+	}
+	sort.Strings(user.Roles)
+	return user, nil
+}
+
+// conn is a connection to the directory server
+type conn struct {
+	net.Conn
+	reader    *bufio.Reader
+	timeout   time.Duration
+	messageID int
+}
+
+func (a *Authenticator) dial(ctx context.Context) (*conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.config.Timeout)
+	defer cancel()
+
+	var c net.Conn
+	var err error
+	if a.tls {
+		dialer := &tls.Dialer{Config: &tls.Config{
+			ServerName: a.serverName,
+			RootCAs:    a.config.RootCAs,
+			MinVersion: tls.VersionTLS12,
+		}}
+		c, err = dialer.DialContext(ctx, "tcp", a.address)
+	} else {
+		var dialer net.Dialer
+		c, err = dialer.DialContext(ctx, "tcp", a.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %v", err)
+	}
+	c.SetDeadline(time.Now().Add(a.config.Timeout))
+	return &conn{Conn: c, reader: bufio.NewReader(c), timeout: a.config.Timeout}, nil
+}
+
+// send writes a message carrying op and returns its message ID
+func (c *conn) send(op []byte) (int, error) {
+	c.messageID++
+	_, err := c.Write(encode(tagSequence, encodeInt(tagInteger, c.messageID), op))
+	return c.messageID, err
+}
+
+// receive reads the next message answering id and returns its protocol operation
+func (c *conn) receive(id int) (element, error) {
+	message, err := readElement(c.reader)
+	if err != nil {
+		return element{}, err
+	}
+	parts, err := message.children()
+	if err != nil || message.tag != tagSequence || len(parts) < 2 {
+		return element{}, errMalformed
+	}
+	if got, err := parts[0].int(); err != nil || got != id {
+		return element{}, fmt.Errorf("unexpected LDAP message ID %d", got)
+	}
+	return parts[1], nil
+}
+
+// result checks the LDAPResult in an operation's response
+func result(op element) error {
+	parts, err := op.children()
+	if err != nil || len(parts) < 3 {
+		return errMalformed
+	}
+	code, err := parts[0].int()
+	if err != nil {
+		return err
+	}
+	switch code {
+	case resultSuccess:
+		return nil
+	case resultInvalidCreds:
+		return ErrInvalidCredentials
+	default:
+		return fmt.Errorf("LDAP result code %d: %s", code, parts[2].content)
+	}
+}
+
+// bind performs a simple bind as dn
+func (c *conn) bind(dn, password string) error {
+	id, err := c.send(encode(opBindRequest,
+		encodeInt(tagInteger, 3),
+		encodeString(tagOctetString, dn),
+		encodeString(authSimple, password),
+	))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != opBindResponse {
+		return errMalformed
+	}
+	return result(op)
+}
+
+// searchEntry is an entry returned by a search
+type searchEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// search finds the entries under base whose attribute equals value
+func (c *conn) search(base, attribute, value string, attributes []string) ([]searchEntry, error) {
+	var requested [][]byte
+	for _, name := range attributes {
+		requested = append(requested, encodeString(tagOctetString, name))
+	}
+	id, err := c.send(encode(opSearchRequest,
+		encodeString(tagOctetString, base),
+		encodeInt(tagEnumerated, scopeWholeSubtree),
+		encodeInt(tagEnumerated, 0), // never dereference aliases
+		encodeInt(tagInteger, 2),    // two entries are enough to tell the user is ambiguous
+		encodeInt(tagInteger, int(c.timeout.Seconds())),
+		encodeBool(false),
+		encode(filterEquality, encodeString(tagOctetString, attribute), encodeString(tagOctetString, value)),
+		encode(tagSequence, requested...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []searchEntry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case opSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case opSearchReference:
+			// Referrals to other servers aren't followed
+		case opSearchDone:
+			return entries, result(op)
+		default:
+			return nil, errMalformed
+		}
+	}
+}
+
+func parseEntry(op element) (searchEntry, error) {
+	parts, err := op.children()
+	if err != nil || len(parts) != 2 {
+		return searchEntry{}, errMalformed
+	}
+	entry := searchEntry{dn: string(parts[0].content), attributes: map[string][]string{}}
+	attributes, err := parts[1].children()
+	if err != nil {
+		return searchEntry{}, err
+	}
+	for _, attribute := range attributes {
+		fields, err := attribute.children()
+		if err != nil || len(fields) != 2 {
+			return searchEntry{}, errMalformed
+		}
+		values, err := fields[1].children()
+		if err != nil {
+			return searchEntry{}, err
+		}
+		name := string(fields[0].content)
+		for _, value := range values {
+			entry.attributes[name] = append(entry.attributes[name], string(value.content))
+		}
+	}
+	return entry, nil
+}
+
+// close unbinds and closes the connection
+func (c *conn) close() {
+	c.send(encode(opUnbindRequest))
+	c.Conn.Close()
+}
@@ -0,0 +1,184 @@
+package ldapauth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDirectory is a minimal LDAP server holding a fixed set of users
+type fakeDirectory struct {
+	passwords map[string]string   // DN -> password
+	users     map[string]string   // uid -> DN
+	groups    map[string][]string // DN -> memberOf
+}
+
+func (d *fakeDirectory) serve(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.handle(c)
+		}
+	}()
+	return "ldap://" + listener.Addr().String()
+}
+
+func ldapResult(op byte, code int) []byte {
+	return encode(op, encodeInt(tagEnumerated, code), encodeString(tagOctetString, ""), encodeString(tagOctetString, ""))
+}
+
+func (d *fakeDirectory) handle(c net.Conn) {
+	defer c.Close()
+	reader := bufio.NewReader(c)
+	reply := func(id int, op []byte) {
+		c.Write(encode(tagSequence, encodeInt(tagInteger, id), op))
+	}
+	for {
+		message, err := readElement(reader)
+		if err != nil {
+			return
+		}
+		parts, _ := message.children()
+		id, _ := parts[0].int()
+		op := parts[1]
+		fields, _ := op.children()
+		switch op.tag {
+		case opBindRequest:
+			dn, password := string(fields[1].content), string(fields[2].content)
+			if stored, ok := d.passwords[dn]; ok && stored == password {
+				reply(id, ldapResult(opBindResponse, resultSuccess))
+			} else {
+				reply(id, ldapResult(opBindResponse, resultInvalidCreds))
+			}
+		case opSearchRequest:
+			filter, _ := fields[6].children()
+			if string(filter[0].content) == "uid" {
+				if dn, ok := d.users[string(filter[1].content)]; ok {
+					var values [][]byte
+					for _, group := range d.groups[dn] {
+						values = append(values, encodeString(tagOctetString, group))
+					}
+					attribute := encode(tagSequence, encodeString(tagOctetString, "memberOf"), encode(tagSet, values...))
+					reply(id, encode(opSearchEntry, encodeString(tagOctetString, dn), encode(tagSequence, attribute)))
+				}
+			}
+			reply(id, ldapResult(opSearchDone, resultSuccess))
+		default:
+			return
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	directory := &fakeDirectory{
+		passwords: map[string]string{
+			"cn=reader,dc=example,dc=com":           "service-secret",
+			"uid=alice,ou=people,dc=example,dc=com": "alice-secret",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-secret",
+		},
+		users: map[string]string{
+			"alice": "uid=alice,ou=people,dc=example,dc=com",
+			"bob":   "uid=bob,ou=people,dc=example,dc=com",
+		},
+		groups: map[string][]string{
+			"uid=alice,ou=people,dc=example,dc=com": {"cn=File Admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			"uid=bob,ou=people,dc=example,dc=com":   {"cn=staff,ou=groups,dc=example,dc=com"},
+		},
+	}
+	auth, err := New(Config{
+		URL:           directory.serve(t),
+		BindDN:        "cn=reader,dc=example,dc=com",
+		BindPassword:  "service-secret",
+		UserBaseDN:    "ou=people,dc=example,dc=com",
+		UserAttribute: "uid",
+		GroupRoles: map[string]string{
+			"CN=file admins, OU=groups, DC=example, DC=com": "admin",
+			"cn=staff,ou=groups,dc=example,dc=com":          "user",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	alice, err := auth.Authenticate(ctx, "alice", "alice-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.DN != "uid=alice,ou=people,dc=example,dc=com" || !reflect.DeepEqual(alice.Roles, []string{"admin", "user"}) {
+		t.Errorf("alice = %+v, want admin and user roles", alice)
+	}
+	bob, err := auth.Authenticate(ctx, "bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.HasRole("admin") || !bob.HasRole("user") {
+		t.Errorf("bob has roles %v, want only user", bob.Roles)
+	}
+
+	for _, tc := range []struct{ username, password string }{
+		{"alice", "wrong"},
+		{"mallory", "alice-secret"},
+		{"alice", ""},
+		{"", "alice-secret"},
+	} {
+		if _, err := auth.Authenticate(ctx, tc.username, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want ErrInvalidCredentials", tc.username, tc.password, err)
+		}
+	}
+
+	// A broken service account is a configuration problem, not a wrong user password
+	auth.config.BindPassword = "stale"
+	if _, err := auth.Authenticate(ctx, "alice", "alice-secret"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("with a wrong service password: got %v, want a bind error", err)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	for _, url := range []string{"", "http://ldap.example.com", "ldap://"} {
+		if _, err := New(Config{URL: url, UserBaseDN: "dc=example", UserAttribute: "uid"}); err == nil {
+			t.Errorf("New accepted URL %q", url)
+		}
+	}
+	auth, err := New(Config{URL: "ldaps://ldap.example.com", UserBaseDN: "dc=example", UserAttribute: "uid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.address != "ldap.example.com:636" || !auth.tls || auth.config.GroupAttribute != "memberOf" {
+		t.Errorf("ldaps defaults: address %q, tls %v, group attribute %q", auth.address, auth.tls, auth.config.GroupAttribute)
+	}
+}
+
+func TestBERRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	data := encode(tagSequence, encodeInt(tagInteger, 200), encodeString(tagOctetString, long))
+	e, err := readElement(bufio.NewReader(strings.NewReader(string(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, err := e.children()
+	if err != nil || len(parts) != 2 {
+		t.Fatalf("children = %v, %v", parts, err)
+	}
+	if n, _ := parts[0].int(); n != 200 {
+		t.Errorf("integer = %d, want 200", n)
+	}
+	if string(parts[1].content) != long {
+		t.Error("long-form length string corrupted")
+	}
+	if _, err := (element{content: []byte{0x04, 0x05, 'a'}}).children(); err == nil {
+		t.Error("truncated element accepted")
+	}
+}
@@ -0,0 +1,5 @@
+// Package onepb holds the messages and services of the gRPC API, generated from
+// proto/one.proto by protoc with protoc-gen-go and protoc-gen-go-grpc
+package onepb
+
+//go:generate protoc --proto_path=../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative one.proto
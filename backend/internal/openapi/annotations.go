@@ -0,0 +1,315 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// annotation is one @name line of a doc comment
+type annotation struct {
+	Name string
+	Args string
+}
+
+// parseComment splits a doc comment into its annotations and the paragraphs of the rest
+func parseComment(doc *ast.CommentGroup) ([]annotation, []string) {
+	if doc == nil {
+		return nil, nil
+	}
+	var annotations []annotation
+	var paragraphs []string
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			paragraphs = append(paragraphs, strings.Join(paragraph, " "))
+			paragraph = nil
+		}
+	}
+	for _, comment := range doc.List {
+		line := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+		switch {
+		case strings.HasPrefix(line, "@"):
+			flush()
+			name, args, _ := strings.Cut(line[1:], " ")
+			annotations = append(annotations, annotation{Name: name, Args: strings.TrimSpace(args)})
+		case line == "":
+			flush()
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+	return annotations, paragraphs
+}
+
+// applyAPIAnnotations sets the info and security schemes of a document from the doc
+// comment of the root function
+func applyAPIAnnotations(doc *Document, comment *ast.CommentGroup) error {
+	annotations, _ := parseComment(comment)
+	var description []string
+	for _, a := range annotations {
+		switch a.Name {
+		case "title":
+			doc.Info.Title = a.Args
+		case "version":
+			doc.Info.Version = a.Args
+		case "description":
+			description = append(description, a.Args)
+		case "security":
+			fields := strings.Fields(a.Args)
+			if len(fields) < 2 {
+				return fmt.Errorf("@security %s: want a name and a location", a.Args)
+			}
+			name := fields[0]
+			switch fields[1] {
+			case "bearer":
+				doc.Components.SecuritySchemes[name] = &SecurityScheme{
+					Type: "http", Scheme: "bearer", Description: strings.Join(fields[2:], " "),
+				}
+			case "header", "query":
+				if len(fields) < 3 {
+					return fmt.Errorf("@security %s: want the %s name", a.Args, fields[1])
+				}
+				doc.Components.SecuritySchemes[name] = &SecurityScheme{
+					Type: "apiKey", In: fields[1], Name: fields[2], Description: strings.Join(fields[3:], " "),
+				}
+			default:
+				return fmt.Errorf("@security %s: unknown location %s", a.Args, fields[1])
+			}
+		default:
+			return fmt.Errorf("unknown API annotation @%s", a.Name)
+		}
+	}
+	if doc.Info.Title == "" || doc.Info.Version == "" {
+		return fmt.Errorf("@title and @version are required")
+	}
+	doc.Info.Description = strings.Join(description, " ")
+	return nil
+}
+
+// describeOperation builds the operation of a route from the annotations of its handler
+func describeOperation(r route, handler *ast.FuncDecl, schemas *schemaBuilder, security map[string]*SecurityScheme) (*Operation, error) {
+	annotations, paragraphs := parseComment(handler.Doc)
+	operation := &Operation{
+		OperationID: r.Handler,
+		Description: describeHandler(r.Handler, paragraphs),
+		Responses:   map[string]*Response{},
+	}
+	parameters := map[string]*Parameter{}
+	for _, name := range pathParameters(r.Path) {
+		parameter := &Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		operation.Parameters = append(operation.Parameters, parameter)
+		parameters[name] = parameter
+	}
+	var form *Schema
+
+	for _, a := range annotations {
+		switch a.Name {
+		case "summary":
+			operation.Summary = a.Args
+		case "tags":
+			for _, tag := range strings.Split(a.Args, ",") {
+				operation.Tags = append(operation.Tags, strings.TrimSpace(tag))
+			}
+		case "path":
+			name, description, _ := strings.Cut(a.Args, " ")
+			parameter := parameters[name]
+			if parameter == nil {
+				return nil, fmt.Errorf("@path %s: no such parameter in the path", name)
+			}
+			parameter.Description = strings.TrimSpace(description)
+		case "query":
+			parameter, err := parseParameter(a.Args, "query")
+			if err != nil {
+				return nil, fmt.Errorf("@query %s: %v", a.Args, err)
+			}
+			operation.Parameters = append(operation.Parameters, parameter)
+		case "header":
+			name, description, _ := strings.Cut(a.Args, " ")
+			operation.Parameters = append(operation.Parameters, &Parameter{
+				Name: name, In: "header", Description: strings.TrimSpace(description), Schema: &Schema{Type: "string"},
+			})
+		case "body":
+			fields := strings.Fields(a.Args)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("@body: want json Type [optional] or raw")
+			}
+			switch {
+			case fields[0] == "json" && (len(fields) == 2 || len(fields) == 3 && fields[2] == "optional"):
+				if !schemas.known(fields[1]) {
+					return nil, fmt.Errorf("@body %s: unknown type %s", a.Args, fields[1])
+				}
+				operation.RequestBody = &RequestBody{Required: len(fields) == 2, Content: map[string]*MediaType{
+					"application/json": {Schema: schemas.ref(fields[1])},
+				}}
+			case fields[0] == "raw":
+				contentType := "application/octet-stream"
+				if len(fields) > 1 {
+					contentType = fields[1]
+				}
+				operation.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+					contentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+				}}
+			default:
+				return nil, fmt.Errorf("@body %s: want json Type [optional] or raw", a.Args)
+			}
+		case "form":
+			parameter, err := parseParameter(a.Args, "formData")
+			if err != nil {
+				return nil, fmt.Errorf("@form %s: %v", a.Args, err)
+			}
+			if form == nil {
+				form = &Schema{Type: "object", Properties: map[string]*Schema{}}
+				operation.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{
+					"multipart/form-data": {Schema: form},
+				}}
+			}
+			parameter.Schema.Description = parameter.Description
+			form.Properties[parameter.Name] = parameter.Schema
+			if parameter.Required {
+				form.Required = append(form.Required, parameter.Name)
+			}
+		case "success":
+			code, response, err := parseResponse(a.Args, schemas)
+			if err != nil {
+				return nil, fmt.Errorf("@success %s: %v", a.Args, err)
+			}
+			operation.Responses[code] = response
+		case "auth":
+			for _, name := range strings.Fields(a.Args) {
+				if name == "optional" {
+					operation.Security = append(operation.Security, map[string][]string{})
+					continue
+				}
+				if security[name] == nil {
+					return nil, fmt.Errorf("@auth: unknown security scheme %s", name)
+				}
+				operation.Security = append(operation.Security, map[string][]string{name: {}})
+			}
+		case "deprecated":
+			operation.Deprecated = true
+		default:
+			return nil, fmt.Errorf("unknown annotation @%s", a.Name)
+		}
+	}
+
+	if operation.Summary == "" {
+		return nil, fmt.Errorf("missing @summary")
+	}
+	if len(operation.Responses) == 0 {
+		return nil, fmt.Errorf("missing @success")
+	}
+	if len(operation.Tags) == 0 {
+		operation.Tags = []string{firstSegment(r.Path)}
+	}
+	operation.Responses["default"] = &Response{Ref: "#/components/responses/" + errorResponse}
+	return operation, nil
+}
+
+// describeHandler turns the prose of a handler's doc comment into a description, dropping
+// the handler's name it starts with
+func describeHandler(name string, paragraphs []string) string {
+	if len(paragraphs) == 0 {
+		return ""
+	}
+	first := paragraphs[0]
+	if rest, ok := strings.CutPrefix(first, name+" "); ok && rest != "" {
+		first = strings.ToUpper(rest[:1]) + rest[1:]
+	}
+	description := append([]string{first}, paragraphs[1:]...)
+	for i, paragraph := range description {
+		if !strings.HasSuffix(paragraph, ".") && !strings.HasSuffix(paragraph, ":") {
+			description[i] = paragraph + "."
+		}
+	}
+	return strings.Join(description, "\n\n")
+}
+
+// parameterTypes are the types query parameters and form fields may have
+var parameterTypes = map[string]*Schema{
+	"string":  {Type: "string"},
+	"integer": {Type: "integer"},
+	"number":  {Type: "number"},
+	"boolean": {Type: "boolean"},
+	"file":    {Type: "string", Format: "binary"},
+}
+
+// parseParameter reads "name type [required] description"
+func parseParameter(args, in string) (*Parameter, error) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("want a name and a type")
+	}
+	// Form fields may repeat, as []type
+	typeName, repeated := strings.CutPrefix(fields[1], "[]")
+	schema := parameterTypes[typeName]
+	if schema == nil || ((typeName == "file" || repeated) && in != "formData") {
+		return nil, fmt.Errorf("unknown type %s", fields[1])
+	}
+	copied := *schema
+	parameter := &Parameter{Name: fields[0], In: in, Schema: &copied}
+	if repeated {
+		parameter.Schema = &Schema{Type: "array", Items: &copied}
+	}
+	rest := fields[2:]
+	if len(rest) > 0 && rest[0] == "required" {
+		parameter.Required = true
+		rest = rest[1:]
+	}
+	parameter.Description = strings.Join(rest, " ")
+	return parameter, nil
+}
+
+// parseResponse reads "code [Type | []Type | json | content-type ...] [description]"
+func parseResponse(args string, schemas *schemaBuilder) (string, *Response, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("want a status code")
+	}
+	code, err := strconv.Atoi(fields[0])
+	if err != nil || http.StatusText(code) == "" {
+		return "", nil, fmt.Errorf("invalid status code %s", fields[0])
+	}
+	response := &Response{}
+	rest := fields[1:]
+	if len(rest) > 0 {
+		name := strings.TrimPrefix(rest[0], "[]")
+		switch {
+		case rest[0] == "json":
+			response.Content = map[string]*MediaType{"application/json": {Schema: &Schema{Type: "object"}}}
+			rest = rest[1:]
+		case isTypeName(name) && schemas.known(name):
+			schema := schemas.ref(name)
+			if name != rest[0] {
+				schema = &Schema{Type: "array", Items: schema}
+			}
+			response.Content = map[string]*MediaType{"application/json": {Schema: schema}}
+			rest = rest[1:]
+		}
+	}
+	for len(rest) > 0 && strings.Contains(rest[0], "/") {
+		if response.Content == nil {
+			response.Content = map[string]*MediaType{}
+		}
+		schema := &Schema{Type: "string", Format: "binary"}
+		if strings.HasPrefix(rest[0], "text/") {
+			schema = &Schema{Type: "string"}
+		}
+		response.Content[rest[0]] = &MediaType{Schema: schema}
+		rest = rest[1:]
+	}
+	response.Description = strings.Join(rest, " ")
+	if response.Description == "" {
+		response.Description = http.StatusText(code)
+	}
+	return strconv.Itoa(code), response, nil
+}
+
+// isTypeName reports whether a word could name an exported Go type. Descriptions start
+// with capitals too, so it takes a known type to be one.
+func isTypeName(word string) bool {
+	return word != "" && word[0] >= 'A' && word[0] <= 'Z' && !strings.ContainsAny(word, "/.,")
+}
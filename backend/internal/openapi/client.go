@@ -0,0 +1,468 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenerateClient writes the generated half of a Go client package for the API a document
+// describes: a type per component schema, and a method per operation on the package's
+// Client. The package provides the rest by hand: Client with its do and doJSON methods,
+// the request, FormFile and formPart types, jsonBody and multipartBody.
+//
+// Credentials sent in headers, like API keys and bearer tokens, are the Client's to set.
+// Those sent as query parameters, like passwords of single files, are parameters of the
+// calls that take them.
+func GenerateClient(doc *Document, pkg string) ([]byte, error) {
+	g := &clientGenerator{doc: doc, imports: map[string]bool{"context": true, "net/http": true, "net/url": true}}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		if name != errorResponse {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.schemaType(name, doc.Components.Schemas[name])
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		operations := doc.Paths[path].Operations()
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			g.operation(strings.ToUpper(method), path, operations[method])
+		}
+	}
+
+	imports := make([]string, 0, len(g.imports))
+	for imported := range g.imports {
+		imports = append(imports, strconv.Quote(imported))
+	}
+	sort.Strings(imports)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by cmd/openapi from openapi.json. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\nimport (\n%s\n)\n\n", pkg, strings.Join(imports, "\n"))
+	out.Write(g.body.Bytes())
+	formatted, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the client: %v", err)
+	}
+	return formatted, nil
+}
+
+// clientGenerator accumulates the declarations of a client and the packages they use
+type clientGenerator struct {
+	doc     *Document
+	body    bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *clientGenerator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+// comment writes text as a comment, wrapped and indented
+func (g *clientGenerator) comment(indent, text string) {
+	for i, paragraph := range strings.Split(text, "\n\n") {
+		if i > 0 {
+			g.printf("%s//\n", indent)
+		}
+		line := indent + "//"
+		for _, word := range strings.Fields(paragraph) {
+			if len(line)+1+len(word) > 90 && line != indent+"//" {
+				g.printf("%s\n", line)
+				line = indent + "//"
+			}
+			line += " " + word
+		}
+		g.printf("%s\n", line)
+	}
+}
+
+// schemaType writes the Go type of a component schema
+func (g *clientGenerator) schemaType(name string, schema *Schema) {
+	switch {
+	case schema.Description == "":
+		g.printf("// %s is a schema of the API\n", name)
+	case strings.HasPrefix(schema.Description, name+" "):
+		g.comment("", schema.Description)
+	default:
+		g.comment("", name+": "+schema.Description)
+	}
+	g.printf("type %s %s\n\n", name, g.goType(schema, ""))
+}
+
+// goType returns the Go type of a schema; indent is that of the declaration it is in
+func (g *clientGenerator) goType(schema *Schema, indent string) string {
+	if schema.Ref != "" {
+		return "*" + strings.TrimPrefix(schema.Ref, schemaRef(""))
+	}
+	switch schema.Type {
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return "time.Time"
+		case "byte", "binary":
+			return "[]byte"
+		}
+		return "string"
+	case "integer":
+		switch schema.Format {
+		case "int32", "int64":
+			return schema.Format
+		}
+		return "int"
+	case "number":
+		if schema.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + strings.TrimPrefix(g.goType(schema.Items, indent), "*")
+	case "object":
+		if schema.AdditionalProperties != nil {
+			return "map[string]" + g.goType(schema.AdditionalProperties, indent)
+		}
+		if len(schema.Properties) == 0 {
+			return "map[string]any"
+		}
+		return g.structType(schema, indent)
+	}
+	return "any"
+}
+
+// structType returns a struct type with a field per property, in name order
+func (g *clientGenerator) structType(schema *Schema, indent string) string {
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, name := range names {
+		property := schema.Properties[name]
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s\t%s %s `json:%q`", indent, exportedName(name), g.goType(property, indent+"\t"), tag)
+		if property.Description != "" {
+			fmt.Fprintf(&b, " // %s", property.Description)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// clientParameter is a query or header parameter of a call
+type clientParameter struct {
+	Name        string
+	In          string
+	Field       string
+	Type        string
+	Description string
+}
+
+// operation writes the method of an operation, with the types of its parameters and form
+func (g *clientGenerator) operation(method, path string, operation *Operation) {
+	name := exportedName(operation.OperationID)
+	result := g.result(operation)
+	if result == "" {
+		return // Upgrades to other protocols have nothing to call
+	}
+
+	// Arguments: the path parameters in order, the body, then the optional parameters
+	args := []string{"ctx context.Context"}
+	var parameters []clientParameter
+	pathValues := map[string]string{}
+	for _, parameter := range operation.Parameters {
+		switch parameter.In {
+		case "path":
+			arg := unexportedName(parameter.Name)
+			args = append(args, arg+" string")
+			pathValues[parameter.Name] = arg
+		case "query", "header":
+			parameters = append(parameters, clientParameter{
+				Name: parameter.Name, In: parameter.In, Field: exportedName(parameter.Name),
+				Type: g.goType(parameter.Schema, "\t"), Description: parameter.Description,
+			})
+		}
+	}
+	parameters = append(parameters, g.querySchemes(operation)...)
+
+	var form *Schema
+	bodyKind := ""
+	if operation.RequestBody != nil {
+		for contentType, media := range operation.RequestBody.Content {
+			switch {
+			case contentType == "application/json" && media.Schema.Ref != "":
+				bodyKind = "json"
+				args = append(args, "body "+g.goType(media.Schema, ""))
+			case contentType == "multipart/form-data":
+				bodyKind = "form"
+				form = media.Schema
+				args = append(args, "form *"+name+"Form")
+			default:
+				bodyKind = "raw:" + contentType
+				args = append(args, "body io.Reader")
+				g.imports["io"] = true
+			}
+		}
+	}
+	if len(parameters) > 0 {
+		args = append(args, "params *"+name+"Params")
+	}
+
+	if form != nil {
+		g.formType(name, form)
+	}
+	if len(parameters) > 0 {
+		g.printf("// %sParams are the optional parameters of %s\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, parameter := range parameters {
+			if parameter.Description != "" {
+				g.comment("\t", parameter.Description)
+			}
+			g.printf("\t%s %s\n", parameter.Field, parameter.Type)
+		}
+		g.printf("}\n\n")
+	}
+
+	summary := operation.Summary
+	if len(summary) > 1 && strings.ToLower(summary[1:2]) == summary[1:2] {
+		summary = strings.ToLower(summary[:1]) + summary[1:]
+	}
+	g.comment("", fmt.Sprintf("%s calls %s %s: %s.", name, method, path, strings.TrimSuffix(summary, ".")))
+	if operation.Description != "" {
+		g.printf("//\n")
+		g.comment("", operation.Description)
+	}
+	if operation.Deprecated {
+		g.printf("//\n// Deprecated: the API no longer recommends this operation.\n")
+	}
+	g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+
+	requestPath := strconv.Quote(path)
+	for parameter, arg := range pathValues {
+		requestPath = strings.Replace(requestPath, "{"+parameter+"}", `" + url.PathEscape(`+arg+`) + "`, 1)
+	}
+	requestPath = strings.TrimSuffix(strings.TrimPrefix(requestPath, `"" + `), ` + ""`)
+	g.printf("\tr := request{method: %q, path: %s, query: url.Values{}, header: http.Header{}}\n", method, requestPath)
+
+	switch {
+	case bodyKind == "json":
+		g.printf("\tif body != nil {\n\t\tvar err error\n")
+		g.printf("\t\tif r.body, r.contentType, err = jsonBody(body); err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t}\n")
+	case bodyKind == "form":
+		g.formParts(form)
+	case strings.HasPrefix(bodyKind, "raw:"):
+		g.printf("\tr.body, r.contentType = body, %q\n", strings.TrimPrefix(bodyKind, "raw:"))
+	}
+
+	if len(parameters) > 0 {
+		g.printf("\tif params != nil {\n")
+		for _, parameter := range parameters {
+			target := "r.query"
+			if parameter.In == "header" {
+				target = "r.header"
+			}
+			g.printf("\t\tif params.%s != %s {\n", parameter.Field, zeroValue(parameter.Type))
+			g.printf("\t\t\t%s.Set(%q, %s)\n\t\t}\n", target, parameter.Name, g.formatValue(parameter.Type, "params."+parameter.Field))
+		}
+		g.printf("\t}\n")
+	}
+
+	switch result {
+	case "*http.Response":
+		g.printf("\treturn c.do(ctx, r)\n")
+	case "map[string]any":
+		g.printf("\tvar out map[string]any\n\tif err := c.doJSON(ctx, r, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn out, nil\n")
+	default:
+		g.printf("\tvar out %s\n\tif err := c.doJSON(ctx, r, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &out, nil\n", result[1:])
+	}
+	g.printf("}\n\n")
+}
+
+// result returns the Go type an operation's successful responses decode to: a described
+// type, a map for other JSON and the response itself for everything else. It returns ""
+// for operations that only switch protocols.
+func (g *clientGenerator) result(operation *Operation) string {
+	codes := make([]string, 0, len(operation.Responses))
+	for code := range operation.Responses {
+		if code != "default" {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	result, successes := "", 0
+	for _, code := range codes {
+		if code < "200" || code >= "300" {
+			continue
+		}
+		successes++
+		response := operation.Responses[code]
+		media := response.Content["application/json"]
+		candidate := "*http.Response"
+		switch {
+		case media == nil || len(response.Content) > 1:
+		case media.Schema.Ref != "":
+			candidate = g.goType(media.Schema, "")
+		default:
+			candidate = "map[string]any"
+		}
+		switch {
+		case result == "" || result == candidate:
+			result = candidate
+		case result != "*http.Response" && candidate != "*http.Response":
+			result = "map[string]any"
+		default:
+			result = "*http.Response"
+		}
+	}
+	if successes == 0 {
+		for _, code := range codes {
+			if code == "101" {
+				return ""
+			}
+		}
+		return "*http.Response"
+	}
+	return result
+}
+
+// querySchemes returns the security schemes sent as query parameters an operation takes
+func (g *clientGenerator) querySchemes(operation *Operation) []clientParameter {
+	taken := map[string]bool{}
+	for _, parameter := range operation.Parameters {
+		taken[parameter.Name] = true
+	}
+	var parameters []clientParameter
+	for _, requirement := range operation.Security {
+		for name := range requirement {
+			scheme := g.doc.Components.SecuritySchemes[name]
+			if scheme == nil || scheme.Type != "apiKey" || scheme.In != "query" || taken[scheme.Name] {
+				continue
+			}
+			taken[scheme.Name] = true
+			parameters = append(parameters, clientParameter{
+				Name: scheme.Name, In: "query", Field: exportedName(name), Type: "string", Description: scheme.Description,
+			})
+		}
+	}
+	return parameters
+}
+
+// formType writes the type of a multipart form
+func (g *clientGenerator) formType(name string, form *Schema) {
+	g.printf("// %sForm is the multipart form of %s\n", name, name)
+	g.printf("type %sForm struct {\n", name)
+	for _, field := range sortedProperties(form) {
+		schema := form.Properties[field]
+		if schema.Description != "" {
+			g.comment("\t", schema.Description)
+		}
+		g.printf("\t%s %s\n", exportedName(field), formFieldType(schema))
+	}
+	g.printf("}\n\n")
+}
+
+// formParts writes the statements building the multipart body of a form
+func (g *clientGenerator) formParts(form *Schema) {
+	g.printf("\tvar parts []formPart\n\tif form != nil {\n")
+	for _, field := range sortedProperties(form) {
+		goField := "form." + exportedName(field)
+		switch goType := formFieldType(form.Properties[field]); goType {
+		case "*FormFile":
+			g.printf("\t\tif %s != nil {\n\t\t\tparts = append(parts, formPart{name: %q, file: %s})\n\t\t}\n", goField, field, goField)
+		case "[]FormFile":
+			g.printf("\t\tfor i := range %s {\n\t\t\tparts = append(parts, formPart{name: %q, file: &%s[i]})\n\t\t}\n", goField, field, goField)
+		case "[]string":
+			g.printf("\t\tfor _, value := range %s {\n\t\t\tparts = append(parts, formPart{name: %q, value: value})\n\t\t}\n", goField, field)
+		default:
+			g.printf("\t\tif %s != %s {\n", goField, zeroValue(goType))
+			g.printf("\t\t\tparts = append(parts, formPart{name: %q, value: %s})\n\t\t}\n", field, g.formatValue(goType, goField))
+		}
+	}
+	g.printf("\t}\n\tr.body, r.contentType = multipartBody(parts)\n")
+}
+
+// formFieldType returns the Go type of a multipart field
+func formFieldType(schema *Schema) string {
+	if schema.Type == "array" {
+		if schema.Items.Format == "binary" {
+			return "[]FormFile"
+		}
+		return "[]string"
+	}
+	switch {
+	case schema.Format == "binary":
+		return "*FormFile"
+	case schema.Type == "integer":
+		return "int"
+	case schema.Type == "number":
+		return "float64"
+	case schema.Type == "boolean":
+		return "bool"
+	}
+	return "string"
+}
+
+// sortedProperties returns the property names of a schema in order
+func sortedProperties(schema *Schema) []string {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// zeroValue returns the zero value of a parameter type, which leaves the parameter out
+func zeroValue(goType string) string {
+	switch goType {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	}
+	return "0"
+}
+
+// formatValue returns the expression formatting a parameter value as a string
+func (g *clientGenerator) formatValue(goType, value string) string {
+	if goType == "string" {
+		return value
+	}
+	g.imports["strconv"] = true
+	switch goType {
+	case "bool":
+		return "strconv.FormatBool(" + value + ")"
+	case "float32", "float64":
+		return "strconv.FormatFloat(float64(" + value + "), 'g', -1, 64)"
+	}
+	return "strconv.FormatInt(int64(" + value + "), 10)"
+}
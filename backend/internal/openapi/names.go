@@ -0,0 +1,43 @@
+package openapi
+
+import "strings"
+
+// initialisms are spelled in capitals in Go names
+var initialisms = map[string]bool{
+	"api": true, "csv": true, "html": true, "http": true, "id": true, "ip": true, "json": true,
+	"mime": true, "pdf": true, "qr": true, "sha256": true, "ttl": true, "uri": true, "url": true,
+	"uuid": true, "zip": true,
+}
+
+// exportedName turns a name like "delete_password", "X-Content-SHA256" or "getFile"
+// into an exported Go identifier
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// unexportedName turns a name like "upload_id" into an unexported Go identifier such as
+// uploadID
+func unexportedName(name string) string {
+	exported := exportedName(name)
+	upper := 0
+	for upper < len(exported) && exported[upper] >= 'A' && exported[upper] <= 'Z' {
+		upper++
+	}
+	switch {
+	case upper == len(exported):
+		return strings.ToLower(exported)
+	case upper > 1:
+		upper-- // The last capital starts the next word, as in IDToken
+	}
+	return strings.ToLower(exported[:upper]) + exported[upper:]
+}
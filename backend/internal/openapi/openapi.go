@@ -0,0 +1,434 @@
+// Package openapi generates an OpenAPI 3 description of a gin API from its source, and a
+// Go client from that description.
+//
+// Routes come from the router setup: starting at a root function, calls like
+// api.GET("/file/:id", service.getFile) are followed through route groups and the helper
+// functions groups are passed to. Each operation is then described by annotations in
+// the doc comment of its handler, one per line:
+//
+//	@summary One-line summary
+//	@tags tag, ...                                    (default: the first path segment)
+//	@path name description                            (documents a path parameter)
+//	@query name type [required] description           (type: string, integer, number or boolean)
+//	@header name description
+//	@body json Type [optional]                        (a request body bound to a struct)
+//	@body raw [content-type]
+//	@form name type [required] description            (a multipart field; file for uploads, []type
+//	                                                   for repeated fields)
+//	@success code [Type | []Type | json | content-type ...] [description]
+//	@auth scheme ... [optional]                       (alternatives; optional allows none)
+//	@deprecated
+//
+// The rest of the comment becomes the description. The doc comment of the root function
+// holds the annotations of the whole API:
+//
+//	@title Title
+//	@version version
+//	@description text
+//	@security name header|query HeaderOrParameter description
+//	@security name bearer description
+//
+// Request and response types are described from their struct definitions: JSON tags name
+// the properties, `binding:"required"` makes them required and field comments describe
+// them.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem holds the operations on one path
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+	Head   *Operation `json:"head,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+}
+
+// Operation is one method on one path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation takes
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// MediaType is the schema of one content type
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Response is a response of an operation, or a reference to a shared one
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Schema is a JSON Schema, as far as the generator writes them
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Components holds what operations refer to
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way of authenticating
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operations returns the operations of a path item by lowercase method
+func (p *PathItem) Operations() map[string]*Operation {
+	operations := map[string]*Operation{}
+	for method, operation := range map[string]*Operation{
+		"get": p.Get, "put": p.Put, "post": p.Post, "delete": p.Delete, "head": p.Head, "patch": p.Patch,
+	} {
+		if operation != nil {
+			operations[method] = operation
+		}
+	}
+	return operations
+}
+
+// set puts the operation of a method
+func (p *PathItem) set(method string, operation *Operation) {
+	switch method {
+	case "GET":
+		p.Get = operation
+	case "PUT":
+		p.Put = operation
+	case "POST":
+		p.Post = operation
+	case "DELETE":
+		p.Delete = operation
+	case "HEAD":
+		p.Head = operation
+	case "PATCH":
+		p.Patch = operation
+	}
+}
+
+// errorResponse is the response every operation may give instead of succeeding
+const errorResponse = "Error"
+
+// JSON encodes the document, indented
+func (d *Document) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// source is the parsed package the API is defined in
+type source struct {
+	fset  *token.FileSet
+	funcs map[string][]*ast.FuncDecl
+	types map[string]*ast.TypeSpec
+	docs  map[string]*ast.CommentGroup // Doc comments of types declared alone
+
+	// Packages of the same module the types may come from, by the name they are imported as
+	fsys     fs.FS
+	dir      string
+	module   string
+	imports  map[string]string
+	packages map[string]*source
+}
+
+// parseSource parses the non-test Go files of a directory
+func parseSource(fsys fs.FS, dir string) (*source, error) {
+	fset := token.NewFileSet()
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	src := &source{
+		fset:     fset,
+		funcs:    map[string][]*ast.FuncDecl{},
+		types:    map[string]*ast.TypeSpec{},
+		docs:     map[string]*ast.CommentGroup{},
+		fsys:     fsys,
+		dir:      dir,
+		imports:  map[string]string{},
+		packages: map[string]*source{},
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		path := joinPath(dir, name)
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, path, data, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			name := importPath[strings.LastIndex(importPath, "/")+1:]
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			src.imports[name] = importPath
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				src.funcs[decl.Name.Name] = append(src.funcs[decl.Name.Name], decl)
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if spec, ok := spec.(*ast.TypeSpec); ok {
+						src.types[spec.Name.Name] = spec
+						if spec.Doc == nil && len(decl.Specs) == 1 {
+							src.docs[spec.Name.Name] = decl.Doc
+						} else {
+							src.docs[spec.Name.Name] = spec.Doc
+						}
+					}
+				}
+			}
+		}
+	}
+	if data, err := fs.ReadFile(fsys, joinPath(dir, "go.mod")); err == nil {
+		src.module = modulePath(data)
+	}
+	return src, nil
+}
+
+// imported returns the parsed package a name is imported as, when it belongs to the same
+// module, or nil
+func (src *source) imported(name string) *source {
+	importPath, ok := src.imports[name]
+	if !ok || src.module == "" || !strings.HasPrefix(importPath, src.module+"/") {
+		return nil
+	}
+	if pkg, ok := src.packages[importPath]; ok {
+		return pkg
+	}
+	pkg, err := parseSource(src.fsys, joinPath(src.dir, strings.TrimPrefix(importPath, src.module+"/")))
+	if err != nil {
+		pkg = nil
+	}
+	src.packages[importPath] = pkg
+	return pkg
+}
+
+// joinPath joins slash-separated paths of an fs.FS
+func joinPath(dir, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// modulePath returns the module path declared by a go.mod file
+func modulePath(gomod []byte) string {
+	for _, line := range strings.Split(string(gomod), "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return ""
+}
+
+// Generate describes the API whose routes are registered by the root function of the
+// package in dir of fsys
+func Generate(fsys fs.FS, dir, root string) (*Document, error) {
+	src, err := parseSource(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	rootFuncs := src.funcs[root]
+	if len(rootFuncs) != 1 {
+		return nil, fmt.Errorf("root function %s not found", root)
+	}
+
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				errorResponse: {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"error":   {Type: "string", Description: "What went wrong"},
+						"message": {Type: "string", Description: "More detail, when there is any"},
+						"error_code": {
+							Type:        "string",
+							Description: "Why the request should be retried later, on responses with Retry-After",
+						},
+						"retry_after_seconds": {Type: "integer", Description: "How long to wait before retrying, like Retry-After"},
+					},
+					Required: []string{"error"},
+				},
+			},
+			Responses: map[string]*Response{
+				errorResponse: {
+					Description: "The request failed",
+					Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: schemaRef(errorResponse)}}},
+				},
+			},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}
+	if err := applyAPIAnnotations(doc, rootFuncs[0].Doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", root, err)
+	}
+
+	routes, err := src.routes(rootFuncs[0])
+	if err != nil {
+		return nil, err
+	}
+	schemas := newSchemaBuilder(src, doc.Components.Schemas)
+	operationIDs := map[string]bool{}
+	tags := map[string]bool{}
+	for _, route := range routes {
+		handler := src.handler(route.Handler)
+		if handler == nil {
+			return nil, fmt.Errorf("%s %s: handler %s not found", route.Method, route.Path, route.Handler)
+		}
+		operation, err := describeOperation(route, handler, schemas, doc.Components.SecuritySchemes)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s (%s): %v", route.Method, route.Path, route.Handler, err)
+		}
+
+		// Handlers serving several paths are told apart by the first segment
+		if operationIDs[operation.OperationID] {
+			operation.OperationID += exportedName(firstSegment(route.Path))
+		}
+		if operationIDs[operation.OperationID] {
+			return nil, fmt.Errorf("%s %s: duplicate operation %s", route.Method, route.Path, operation.OperationID)
+		}
+		operationIDs[operation.OperationID] = true
+		for _, tag := range operation.Tags {
+			tags[tag] = true
+		}
+
+		path := openAPIPath(route.Path)
+		item := doc.Paths[path]
+		if item == nil {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		item.set(route.Method, operation)
+	}
+
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Tags = append(doc.Tags, Tag{Name: name})
+	}
+	return doc, nil
+}
+
+// schemaRef refers to a schema of the components
+func schemaRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+// openAPIPath turns gin's :name and *name parameters into {name}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// pathParameters returns the names of the parameters of a gin path, in order
+func pathParameters(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			names = append(names, segment[1:])
+		}
+	}
+	return names
+}
+
+// firstSegment returns the first segment of a path after /api
+func firstSegment(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/api"), "/")
+	if len(segments) < 2 {
+		return ""
+	}
+	return segments[1]
+}
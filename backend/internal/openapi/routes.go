@@ -0,0 +1,202 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// route is a handler registered for a method and path
+type route struct {
+	Method  string
+	Path    string
+	Handler string
+}
+
+// routeMethods are the registration methods of gin's route groups
+var routeMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "HEAD": true}
+
+// routes collects the routes under /api registered by a root function, following the
+// route groups it creates and the functions it passes them to
+func (src *source) routes(root *ast.FuncDecl) ([]route, error) {
+	var routes []route
+	seen := map[string]bool{}
+	var walk func(fn *ast.FuncDecl, groups map[string]string, depth int) error
+	walk = func(fn *ast.FuncDecl, groups map[string]string, depth int) error {
+		if depth > 8 {
+			return fmt.Errorf("%s: route registration nested too deeply", fn.Name.Name)
+		}
+		var err error
+		ast.Inspect(fn.Body, func(node ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			switch node := node.(type) {
+			case *ast.AssignStmt:
+				// api := router.Group("/api", ...)
+				if len(node.Lhs) == 1 && len(node.Rhs) == 1 {
+					if name, ok := node.Lhs[0].(*ast.Ident); ok {
+						if prefix, ok := groupPrefix(node.Rhs[0], groups); ok {
+							groups[name.Name] = prefix
+						}
+					}
+				}
+			case *ast.CallExpr:
+				if selector, ok := node.Fun.(*ast.SelectorExpr); ok && routeMethods[selector.Sel.Name] {
+					group, ok := selector.X.(*ast.Ident)
+					prefix, known := "", false
+					if ok {
+						prefix, known = groups[group.Name]
+					}
+					path, isLiteral := stringLiteral(node.Args)
+					if !known || !isLiteral || len(node.Args) < 2 {
+						return true
+					}
+					handler := handlerName(node.Args[len(node.Args)-1])
+					if handler == "" || !isAPIPath(prefix+path) {
+						return true
+					}
+					key := selector.Sel.Name + " " + prefix + path
+					if !seen[key] {
+						seen[key] = true
+						routes = append(routes, route{Method: selector.Sel.Name, Path: prefix + path, Handler: handler})
+					}
+					return true
+				}
+
+				// registerAdminRoutes(api, service) registers routes on a group it is given
+				callee, ok := node.Fun.(*ast.Ident)
+				if !ok || len(src.funcs[callee.Name]) != 1 {
+					return true
+				}
+				fn := src.funcs[callee.Name][0]
+				inner := map[string]string{}
+				params := paramNames(fn)
+				for i, arg := range node.Args {
+					if i >= len(params) {
+						break
+					}
+					if prefix, ok := groupPrefix(arg, groups); ok {
+						inner[params[i]] = prefix
+					}
+				}
+				if len(inner) > 0 {
+					err = walk(fn, inner, depth+1)
+				}
+			}
+			return true
+		})
+		return err
+	}
+
+	// The engine the root function creates, or is given, is the group of the root path
+	groups := map[string]string{}
+	for _, field := range root.Type.Params.List {
+		if star, ok := field.Type.(*ast.StarExpr); ok {
+			if selector, ok := star.X.(*ast.SelectorExpr); ok && (selector.Sel.Name == "Engine" || selector.Sel.Name == "RouterGroup") {
+				for _, name := range field.Names {
+					groups[name.Name] = ""
+				}
+			}
+		}
+	}
+	ast.Inspect(root.Body, func(node ast.Node) bool {
+		if assign, ok := node.(*ast.AssignStmt); ok && len(assign.Lhs) == 1 && len(assign.Rhs) == 1 {
+			if call, ok := assign.Rhs[0].(*ast.CallExpr); ok {
+				if selector, ok := call.Fun.(*ast.SelectorExpr); ok {
+					pkg, ok := selector.X.(*ast.Ident)
+					engine, named := assign.Lhs[0].(*ast.Ident)
+					if ok && named && pkg.Name == "gin" && (selector.Sel.Name == "New" || selector.Sel.Name == "Default") {
+						groups[engine.Name] = ""
+					}
+				}
+			}
+		}
+		return true
+	})
+	if err := walk(root, groups, 0); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// groupPrefix returns the path prefix of a route group expression: a known group, or a
+// Group call on one
+func groupPrefix(expr ast.Expr, groups map[string]string) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		prefix, ok := groups[expr.Name]
+		return prefix, ok
+	case *ast.CallExpr:
+		selector, ok := expr.Fun.(*ast.SelectorExpr)
+		if !ok || selector.Sel.Name != "Group" {
+			return "", false
+		}
+		parent, ok := groupPrefix(selector.X, groups)
+		path, isLiteral := stringLiteral(expr.Args)
+		if !ok || !isLiteral {
+			return "", false
+		}
+		return parent + path, true
+	}
+	return "", false
+}
+
+// stringLiteral returns the first argument when it is a string literal
+func stringLiteral(args []ast.Expr) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	literal, ok := args[0].(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(literal.Value)
+	return value, err == nil
+}
+
+// handlerName returns the name of a handler given as a method value or function, or ""
+// for anything else, such as function literals
+func handlerName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.SelectorExpr:
+		return expr.Sel.Name
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// paramNames returns the parameter names of a function
+func paramNames(fn *ast.FuncDecl) []string {
+	var names []string
+	for _, field := range fn.Type.Params.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// isAPIPath reports whether a path belongs to the API rather than the frontend
+func isAPIPath(path string) bool {
+	return path == "/api" || len(path) > 5 && path[:5] == "/api/"
+}
+
+// handler returns the declaration of a handler: a function or method taking a
+// *gin.Context
+func (src *source) handler(name string) *ast.FuncDecl {
+	for _, fn := range src.funcs[name] {
+		params := fn.Type.Params.List
+		if len(params) != 1 {
+			continue
+		}
+		if star, ok := params[0].Type.(*ast.StarExpr); ok {
+			if selector, ok := star.X.(*ast.SelectorExpr); ok && selector.Sel.Name == "Context" {
+				return fn
+			}
+		}
+	}
+	return nil
+}
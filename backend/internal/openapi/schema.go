@@ -0,0 +1,185 @@
+package openapi
+
+import (
+	"go/ast"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// schemaBuilder describes the package's types as component schemas
+type schemaBuilder struct {
+	src     *source
+	schemas map[string]*Schema
+}
+
+func newSchemaBuilder(src *source, schemas map[string]*Schema) *schemaBuilder {
+	return &schemaBuilder{src: src, schemas: schemas}
+}
+
+// known reports whether the package declares a struct type of that name
+func (b *schemaBuilder) known(name string) bool {
+	spec := b.src.types[name]
+	if spec == nil {
+		return false
+	}
+	_, ok := spec.Type.(*ast.StructType)
+	return ok
+}
+
+// ref refers to the schema of a struct type, describing it the first time
+func (b *schemaBuilder) ref(name string) *Schema {
+	if _, ok := b.schemas[name]; !ok {
+		spec := b.src.types[name]
+		schema := &Schema{Type: "object"}
+		b.schemas[name] = schema // Before the fields, which may refer back
+		b.describeStruct(spec.Type.(*ast.StructType), schema)
+		schema.Description = commentText(b.src.docs[name])
+	}
+	return &Schema{Ref: schemaRef(name)}
+}
+
+// describeStruct adds the JSON properties of a struct to a schema
+func (b *schemaBuilder) describeStruct(structType *ast.StructType, schema *Schema) {
+	for _, field := range structType.Fields.List {
+		tag := reflect.StructTag("")
+		if field.Tag != nil {
+			if value, err := strconv.Unquote(field.Tag.Value); err == nil {
+				tag = reflect.StructTag(value)
+			}
+		}
+		jsonName, options, _ := strings.Cut(tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+
+		// Embedded structs lend their fields, as encoding/json does
+		if len(field.Names) == 0 {
+			if ident, ok := unpointer(field.Type).(*ast.Ident); ok && jsonName == "" && b.known(ident.Name) {
+				b.describeStruct(b.src.types[ident.Name].Type.(*ast.StructType), schema)
+				continue
+			}
+		}
+
+		names := field.Names
+		if len(names) == 0 {
+			if ident, ok := unpointer(field.Type).(*ast.Ident); ok {
+				names = []*ast.Ident{ident}
+			}
+		}
+		for _, name := range names {
+			if !name.IsExported() {
+				continue
+			}
+			property := name.Name
+			if jsonName != "" {
+				property = jsonName
+			}
+			fieldSchema := b.typeSchema(field.Type)
+			description := strings.TrimSpace(commentText(field.Doc) + " " + commentText(field.Comment))
+			if description != "" && fieldSchema.Ref == "" {
+				fieldSchema.Description = description
+			}
+			if schema.Properties == nil {
+				schema.Properties = map[string]*Schema{}
+			}
+			schema.Properties[property] = fieldSchema
+			if strings.Contains(tag.Get("binding"), "required") && !strings.Contains(options, "omitempty") {
+				schema.Required = append(schema.Required, property)
+			}
+		}
+	}
+}
+
+// typeSchema describes a Go type
+func (b *schemaBuilder) typeSchema(expr ast.Expr) *Schema {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return b.typeSchema(expr.X)
+	case *ast.ArrayType:
+		if ident, ok := expr.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.typeSchema(expr.Elt)}
+	case *ast.MapType:
+		return &Schema{Type: "object", AdditionalProperties: b.typeSchema(expr.Value)}
+	case *ast.StructType:
+		schema := &Schema{Type: "object"}
+		b.describeStruct(expr, schema)
+		return schema
+	case *ast.SelectorExpr:
+		pkg, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return &Schema{}
+		}
+		switch pkg.Name + "." + expr.Sel.Name {
+		case "time.Time":
+			return &Schema{Type: "string", Format: "date-time"}
+		case "time.Duration":
+			return &Schema{Type: "integer", Format: "int64", Description: "Nanoseconds"}
+		case "gin.H":
+			return &Schema{Type: "object"}
+		}
+		// Types like storage.CompressionType of the same module are what they're made of,
+		// as far as that is a basic type
+		if pkg := b.src.imported(pkg.Name); pkg != nil {
+			if spec := pkg.types[expr.Sel.Name]; spec != nil {
+				if ident, ok := spec.Type.(*ast.Ident); ok && basicSchema(ident.Name) != nil {
+					return basicSchema(ident.Name)
+				}
+			}
+		}
+		return &Schema{}
+	case *ast.Ident:
+		if schema := basicSchema(expr.Name); schema != nil {
+			return schema
+		}
+		spec := b.src.types[expr.Name]
+		if spec == nil {
+			return &Schema{}
+		}
+		if _, ok := spec.Type.(*ast.StructType); ok {
+			return b.ref(expr.Name)
+		}
+		// Named types like `type StorageClass string` are what they're made of
+		return b.typeSchema(spec.Type)
+	}
+	return &Schema{}
+}
+
+// basicSchema describes a predeclared type, or returns nil for other names
+func basicSchema(name string) *Schema {
+	switch name {
+	case "string":
+		return &Schema{Type: "string"}
+	case "bool":
+		return &Schema{Type: "boolean"}
+	case "int", "int8", "int16", "uint", "uint8", "uint16":
+		return &Schema{Type: "integer"}
+	case "int32", "uint32":
+		return &Schema{Type: "integer", Format: "int32"}
+	case "int64", "uint64":
+		return &Schema{Type: "integer", Format: "int64"}
+	case "float32":
+		return &Schema{Type: "number", Format: "float"}
+	case "float64":
+		return &Schema{Type: "number", Format: "double"}
+	}
+	return nil
+}
+
+// unpointer strips a pointer from a type
+func unpointer(expr ast.Expr) ast.Expr {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		return star.X
+	}
+	return expr
+}
+
+// commentText returns a comment as one line
+func commentText(comment *ast.CommentGroup) string {
+	if comment == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(comment.Text()), " ")
+}
@@ -0,0 +1,211 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" as 1-M, the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("error correction = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionInformation(t *testing.T) {
+	for level, want := range map[Level]int{
+		Low:      0b111011111000100,
+		Medium:   0b101010000010010,
+		Quartile: 0b011010101011111,
+		High:     0b001011010001001,
+	} {
+		if got := formatInformation(level, 0); got != want {
+			t.Errorf("format information of level %d = %015b, want %015b", level, got, want)
+		}
+	}
+	if got := versionInformation(7); got != 0x07C94 {
+		t.Errorf("version information of 7 = %05X, want 07C94", got)
+	}
+}
+
+// decode reads a code back the way a reader would, to check that every part of the
+// encoding ends up where the reader looks for it
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+
+	// The format information next to the top left finder
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		if c.Black(8, i) {
+			bits |= 1 << i
+		}
+	}
+	for i, xy := range [][2]int{{8, 7}, {8, 8}, {7, 8}} {
+		if c.Black(xy[0], xy[1]) {
+			bits |= 1 << (6 + i)
+		}
+	}
+	for i := 9; i < 15; i++ {
+		if c.Black(14-i, 8) {
+			bits |= 1 << i
+		}
+	}
+	if bits != formatInformation(c.Level, c.Mask) {
+		t.Fatalf("format information %015b doesn't match level %d and mask %d", bits, c.Level, c.Mask)
+	}
+
+	// Unmask a copy, leaving out the function patterns like encode did
+	layout := layouts[c.Version][c.Level]
+	template := &Code{Version: c.Version, Level: c.Level, Size: c.Size}
+	for y := 0; y < c.Size; y++ {
+		template.modules = append(template.modules, make([]bool, c.Size))
+		template.isFunction = append(template.isFunction, make([]bool, c.Size))
+	}
+	template.drawFunctionPatterns()
+	for y := range template.modules {
+		copy(template.modules[y], c.modules[y])
+	}
+	template.applyMask(c.Mask)
+
+	var codewords []byte
+	var current byte
+	n := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if template.isFunction[y][x] {
+					continue
+				}
+				current <<= 1
+				if template.modules[y][x] {
+					current |= 1
+				}
+				if n++; n%8 == 0 {
+					codewords = append(codewords, current)
+					current = 0
+				}
+			}
+		}
+	}
+
+	blocks := layout.blocks1 + layout.blocks2
+	data := make([][]byte, blocks)
+	ecc := make([][]byte, blocks)
+	k := 0
+	for i := 0; i <= layout.data1; i++ {
+		for b := 0; b < blocks; b++ {
+			if i < layout.data1 || b >= layout.blocks1 {
+				data[b] = append(data[b], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < layout.ecc; i++ {
+		for b := 0; b < blocks; b++ {
+			ecc[b] = append(ecc[b], codewords[k])
+			k++
+		}
+	}
+	var stream []byte
+	for b := 0; b < blocks; b++ {
+		if got := reedSolomonRemainder(data[b], reedSolomonDivisor(layout.ecc)); !bytes.Equal(got, ecc[b]) {
+			t.Fatalf("block %d: error correction doesn't match its data", b)
+		}
+		stream = append(stream, data[b]...)
+	}
+
+	read := func(pos, n int) int {
+		v := 0
+		for i := pos; i < pos+n; i++ {
+			v = v<<1 | int(stream[i/8]>>(7-uint(i%8))&1)
+		}
+		return v
+	}
+	if mode := read(0, 4); mode != 0x4 {
+		t.Fatalf("mode = %X, want byte mode", mode)
+	}
+	length := read(4, countBits(c.Version))
+	var text []byte
+	for i := 0; i < length; i++ {
+		text = append(text, byte(read(4+countBits(c.Version)+8*i, 8)))
+	}
+	return string(text)
+}
+
+func TestEncode(t *testing.T) {
+	url := "https://one.example/f/0b5e7a3c-1f2d-4e5f-8a9b-0c1d2e3f4a5b"
+	cases := []struct {
+		text    string
+		level   Level
+		version int
+	}{
+		{"hi", Medium, 1},
+		{url, Low, 4},
+		{url, Medium, 4},
+		{url, High, 6},
+		{strings.Repeat("x", 150), Medium, 8},
+		{strings.Repeat("y", 134) + "?password=s3cret", Quartile, 10},
+		{strings.Repeat("z", 271), Low, 10},
+	}
+	for _, tc := range cases {
+		c, err := Encode(tc.text, tc.level)
+		if err != nil {
+			t.Errorf("Encode(%d bytes, %d): %v", len(tc.text), tc.level, err)
+			continue
+		}
+		if c.Version != tc.version || c.Size != 17+4*tc.version {
+			t.Errorf("Encode(%d bytes, %d): version %d of size %d, want version %d", len(tc.text), tc.level, c.Version, c.Size, tc.version)
+		}
+		if got := decode(t, c); got != tc.text {
+			t.Errorf("decoded %q, want %q", got, tc.text)
+		}
+	}
+
+	if _, err := Encode(strings.Repeat("z", 272), Low); !errors.Is(err, ErrTooLong) {
+		t.Errorf("272 bytes: got %v, want ErrTooLong", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode("https://one.example", Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := c.SVG()
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, `viewBox="0 0 33 33"`) {
+		t.Errorf("svg = %.80s", svg)
+	}
+
+	data, err := c.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Version 2 is 25 modules wide, plus the quiet zone on both sides
+	if got := img.Bounds().Dx(); got != 33*4 {
+		t.Errorf("width = %d, want %d", got, 33*4)
+	}
+	// The top left corner of the finder, just inside the quiet zone
+	if r, _, _, _ := img.At(4*4, 4*4).RGBA(); r != 0 {
+		t.Error("finder corner isn't dark")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("quiet zone isn't light")
+	}
+}
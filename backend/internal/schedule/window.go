@@ -0,0 +1,180 @@
+// Package schedule holds recurring time windows: a cron expression for when a window
+// opens and how long it stays open, as used for maintenance windows.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWindowDuration bounds how long a window may stay open, which also bounds how far
+// back Open looks for the start of the window containing a time
+const maxWindowDuration = 7 * 24 * time.Hour
+
+// Window opens at the minutes its cron expression matches and stays open for Duration
+type Window struct {
+	Spec     string
+	Duration time.Duration
+
+	minutes, hours, days, months, weekdays []bool
+	// Like cron, when both the day of month and the day of week are restricted, a day
+	// matching either one matches
+	anyDay, anyWeekday bool
+}
+
+// Windows is a set of windows; a time is inside it when it is inside any of them
+type Windows []*Window
+
+// cronFields are the bounds of the five fields of a cron expression
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseWindows parses windows separated by semicolons, each a five-field cron expression
+// for when it opens followed by how long it stays open, e.g. "0 2 * * * 3h; 0 12 * * 6,0 6h".
+// An empty spec has no windows.
+func ParseWindows(spec string) (Windows, error) {
+	var windows Windows
+	for _, part := range strings.Split(spec, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		window, err := ParseWindow(part)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// ParseWindow parses a single window, "<minute> <hour> <day of month> <month> <day of week> <duration>"
+func ParseWindow(spec string) (*Window, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields)+1 {
+		return nil, fmt.Errorf("window %q: want five cron fields and a duration", strings.TrimSpace(spec))
+	}
+
+	window := &Window{Spec: strings.Join(fields, " ")}
+	duration, err := time.ParseDuration(fields[len(cronFields)])
+	if err != nil || duration < time.Minute || duration > maxWindowDuration {
+		return nil, fmt.Errorf("window %q: duration must be between 1m and %s", window.Spec, maxWindowDuration)
+	}
+	window.Duration = duration
+
+	sets := make([][]bool, len(cronFields))
+	for i, field := range cronFields {
+		if sets[i], err = parseCronField(fields[i], field.min, field.max); err != nil {
+			return nil, fmt.Errorf("window %q: %s: %v", window.Spec, field.name, err)
+		}
+	}
+	window.minutes, window.hours, window.days, window.months, window.weekdays = sets[0], sets[1], sets[2], sets[3], sets[4]
+	window.weekdays[0] = window.weekdays[0] || window.weekdays[7] // 7 is Sunday too
+	window.anyDay = fields[2] == "*"
+	window.anyWeekday = fields[4] == "*"
+	return window, nil
+}
+
+// parseCronField parses a comma-separated list of *, n, a-b, each optionally with a /step
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			var err error
+			rangePart = item[:idx]
+			if step, err = strconv.Atoi(item[idx+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", item)
+			}
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", item)
+				}
+			} else if step > 1 {
+				high = max // "5/15" means from 5 on
+			}
+			if low < min || high > max || low > high {
+				return nil, fmt.Errorf("%q is out of range %d-%d", item, min, max)
+			}
+		}
+		for value := low; value <= high; value += step {
+			set[value] = true
+		}
+	}
+	return set, nil
+}
+
+// opensAt reports whether the window opens at the minute of t
+func (w *Window) opensAt(t time.Time) bool {
+	if !w.minutes[t.Minute()] || !w.hours[t.Hour()] || !w.months[t.Month()] {
+		return false
+	}
+	day, weekday := w.days[t.Day()], w.weekdays[t.Weekday()]
+	switch {
+	case w.anyDay && w.anyWeekday:
+		return true
+	case w.anyDay:
+		return weekday
+	case w.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Open reports whether t is inside the window, in the location of t
+func (w *Window) Open(t time.Time) bool {
+	start := t.Truncate(time.Minute)
+	for opening := start; t.Sub(opening) < w.Duration; opening = opening.Add(-time.Minute) {
+		if w.opensAt(opening) {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether t is inside any of the windows
+func (ws Windows) Open(t time.Time) bool {
+	for _, w := range ws {
+		if w.Open(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns when the next window opens after t, or the zero time when none opens
+// within a year
+func (ws Windows) NextOpen(t time.Time) time.Time {
+	if len(ws) == 0 {
+		return time.Time{}
+	}
+	end := t.AddDate(1, 0, 0)
+	for next := t.Truncate(time.Minute).Add(time.Minute); next.Before(end); next = next.Add(time.Minute) {
+		for _, w := range ws {
+			if w.opensAt(next) {
+				return next
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,91 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindows(t *testing.T) {
+	windows, err := ParseWindows("0 2 * * * 3h; 30 12 * * 6,0 90m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 || windows[0].Duration != 3*time.Hour || windows[1].Spec != "30 12 * * 6,0 90m" {
+		t.Errorf("windows = %+v", windows)
+	}
+	if windows, err := ParseWindows(" "); err != nil || len(windows) != 0 {
+		t.Errorf("empty spec: %v, %v", windows, err)
+	}
+
+	for _, invalid := range []string{
+		"0 2 * * *",       // No duration
+		"0 2 * * * 0s",    // Too short
+		"0 2 * * * 200h",  // Longer than a week
+		"60 2 * * * 1h",   // Minute out of range
+		"0 2-1 * * * 1h",  // Inverted range
+		"0 */0 * * * 1h",  // Zero step
+		"0 2 * jan * 1h",  // Names aren't supported
+		"0 2 * * * * 1h",  // Six cron fields
+		"0 2 32 * * 1h",   // Day out of range
+		"0 2 * * 1-8 1h",  // Weekday out of range
+		"0 2 * * * later", // Not a duration
+	} {
+		if _, err := ParseWindows(invalid); err == nil {
+			t.Errorf("ParseWindows(%q) accepted", invalid)
+		}
+	}
+}
+
+func TestWindowOpen(t *testing.T) {
+	windows, err := ParseWindows("0 2 * * * 3h; 0 */6 * * 0 30m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	cases := map[string]bool{
+		"2026-10-14T01:59:00Z": false,
+		"2026-10-14T02:00:00Z": true,
+		"2026-10-14T04:59:59Z": true,
+		"2026-10-14T05:00:00Z": false,
+		"2026-10-18T12:10:00Z": true,  // Sunday, every six hours
+		"2026-10-18T12:30:00Z": false, // Sunday window closed
+		"2026-10-17T12:10:00Z": false, // Saturday
+	}
+	for value, want := range cases {
+		if got := windows.Open(at(value)); got != want {
+			t.Errorf("Open(%s) = %v, want %v", value, got, want)
+		}
+	}
+
+	if next := windows.NextOpen(at("2026-10-14T05:00:00Z")); !next.Equal(at("2026-10-15T02:00:00Z")) {
+		t.Errorf("NextOpen = %s", next)
+	}
+	if next := Windows(nil).NextOpen(at("2026-10-14T05:00:00Z")); !next.IsZero() {
+		t.Errorf("NextOpen without windows = %s", next)
+	}
+}
+
+func TestWindowDayOfMonthOrWeekday(t *testing.T) {
+	// Like cron, the 1st of the month or any Monday
+	window, err := ParseWindow("0 3 1 * 1 1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, want := range map[string]bool{
+		"2026-10-01T03:30:00Z": true,  // Thursday the 1st
+		"2026-10-12T03:30:00Z": true,  // Monday
+		"2026-10-13T03:30:00Z": false, // Tuesday
+	} {
+		parsed, _ := time.Parse(time.RFC3339, value)
+		if got := window.Open(parsed); got != want {
+			t.Errorf("Open(%s) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// CompressionType names the codec stored content was compressed with
+type CompressionType string
+
+const (
+	CompressionNone CompressionType = "none"
+	CompressionGzip CompressionType = "gzip"
+	CompressionZstd CompressionType = "zstd"
+	CompressionLZ4  CompressionType = "lz4"
+)
+
+// Codec picks a compression type for new content, and compresses and decompresses it
+type Codec interface {
+	SelectCompressionType(filename string, size int64) CompressionType
+	Compress(data []byte, compressionType CompressionType) ([]byte, error)
+	Decompress(data []byte, compressionType CompressionType) ([]byte, error)
+}
+
+// alreadyCompressedExts are formats that don't shrink when compressed again
+var alreadyCompressedExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true,
+	".mp4": true, ".mkv": true, ".avi": true, ".mov": true,
+	".mp3": true, ".aac": true, ".ogg": true, ".flac": true,
+	".zip": true, ".rar": true, ".7z": true, ".tar": true, ".gz": true, ".tgz": true,
+	".zst": true, ".tzst": true,
+	".pdf": true,
+}
+
+// CompressionManager is the Codec used by the service, keeping one zstd encoder and
+// decoder for all requests
+type CompressionManager struct {
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+}
+
+func NewCompressionManager() *CompressionManager {
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	decoder, _ := zstd.NewReader(nil)
+
+	return &CompressionManager{
+		zstdEncoder: encoder,
+		zstdDecoder: decoder,
+	}
+}
+
+// SelectCompressionType picks a codec from the file extension and size
+func (cm *CompressionManager) SelectCompressionType(filename string, size int64) CompressionType {
+	// Don't compress already compressed files
+	if alreadyCompressedExts[strings.ToLower(filepath.Ext(filename))] {
+		return CompressionNone
+	}
+
+	// For very large files (>500MB), skip compression to avoid memory issues and improve performance
+	if size > 500*1024*1024 {
+		return CompressionNone
+	}
+
+	// For large files (>100MB), use fast compression only
+	if size > 100*1024*1024 {
+		return CompressionLZ4
+	}
+
+	// For small files, use LZ4 for speed
+	if size < 1024*10 { // 10KB
+		return CompressionLZ4
+	}
+
+	// For medium files, use Zstandard for balance
+	if size < 1024*1024*10 { // 10MB
+		return CompressionZstd
+	}
+
+	// For moderately large files, use LZ4 for better performance
+	return CompressionLZ4
+}
+
+func (cm *CompressionManager) Compress(data []byte, compressionType CompressionType) ([]byte, error) {
+	switch compressionType {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		return cm.compressGzip(data)
+	case CompressionZstd:
+		return cm.compressZstd(data)
+	case CompressionLZ4:
+		return cm.compressLZ4(data)
+	default:
+		return data, nil
+	}
+}
+
+func (cm *CompressionManager) Decompress(data []byte, compressionType CompressionType) ([]byte, error) {
+	switch compressionType {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		return cm.decompressGzip(data)
+	case CompressionZstd:
+		return cm.decompressZstd(data)
+	case CompressionLZ4:
+		return cm.decompressLZ4(data)
+	default:
+		return data, nil
+	}
+}
+
+func (cm *CompressionManager) compressGzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	writer.Close()
+	return buf.Bytes(), nil
+}
+
+func (cm *CompressionManager) decompressGzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (cm *CompressionManager) compressZstd(data []byte) ([]byte, error) {
+	return cm.zstdEncoder.EncodeAll(data, nil), nil
+}
+
+func (cm *CompressionManager) decompressZstd(data []byte) ([]byte, error) {
+	return cm.zstdDecoder.DecodeAll(data, nil)
+}
+
+func (cm *CompressionManager) compressLZ4(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := lz4.NewWriter(&buf)
+	_, err := writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	writer.Close()
+	return buf.Bytes(), nil
+}
+
+func (cm *CompressionManager) decompressLZ4(data []byte) ([]byte, error) {
+	reader := lz4.NewReader(bytes.NewReader(data))
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	cm := NewCompressionManager()
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 1000)
+
+	for _, compressionType := range []CompressionType{CompressionNone, CompressionGzip, CompressionZstd, CompressionLZ4} {
+		compressed, err := cm.Compress(data, compressionType)
+		if err != nil {
+			t.Fatalf("Compress(%s): %v", compressionType, err)
+		}
+		if compressionType != CompressionNone && len(compressed) >= len(data) {
+			t.Errorf("Compress(%s) did not shrink repetitive data: %d bytes", compressionType, len(compressed))
+		}
+		decompressed, err := cm.Decompress(compressed, compressionType)
+		if err != nil {
+			t.Fatalf("Decompress(%s): %v", compressionType, err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%s round trip changed the data", compressionType)
+		}
+	}
+}
+
+func TestSelectCompressionType(t *testing.T) {
+	cm := NewCompressionManager()
+	cases := []struct {
+		filename string
+		size     int64
+		want     CompressionType
+	}{
+		{"photo.JPG", 1 << 20, CompressionNone},
+		{"archive.zip", 1 << 20, CompressionNone},
+		{"notes.txt", 1 << 10, CompressionLZ4},
+		{"notes.txt", 1 << 20, CompressionZstd},
+		{"dump.sql", 50 << 20, CompressionLZ4},
+		{"dump.sql", 600 << 20, CompressionNone},
+	}
+	for _, tc := range cases {
+		if got := cm.SelectCompressionType(tc.filename, tc.size); got != tc.want {
+			t.Errorf("SelectCompressionType(%q, %d) = %s, want %s", tc.filename, tc.size, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package storage holds the on-disk rules of the file service: how paths below the
+// storage directories are built and validated, and how stored content is compressed.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafePath is returned when a path would escape its base directory or pass through a symlink
+var ErrUnsafePath = errors.New("unsafe path")
+
+// SafeJoin joins single path components onto base, the only way disk paths should be
+// built from IDs or names. Each component must be a plain name: no separators, no "." or
+// "..", no NUL bytes. Existing components below base must not be symlinks, so a planted
+// link can't redirect writes outside the storage directory.
+func SafeJoin(base string, elems ...string) (string, error) {
+	path := filepath.Clean(base)
+	for _, elem := range elems {
+		if elem == "" || elem == "." || elem == ".." ||
+			strings.ContainsAny(elem, `/\`) || strings.ContainsRune(elem, 0) {
+			return "", fmt.Errorf("%w: invalid path component %q", ErrUnsafePath, elem)
+		}
+		path = filepath.Join(path, elem)
+
+		info, err := os.Lstat(path)
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: %s is a symlink", ErrUnsafePath, path)
+		}
+	}
+
+	if !IsWithinDir(base, path) {
+		return "", fmt.Errorf("%w: %s escapes %s", ErrUnsafePath, path, base)
+	}
+	return path, nil
+}
+
+// IsWithinDir reports whether path is base itself or lies below it
+func IsWithinDir(base, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(base), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// RejectSymlinkDir returns an error if dir is a symlink. Storage directories are opened by
+// path many times, so a symlink swapped in later would silently move all data elsewhere.
+func RejectSymlinkDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s is a symlink", ErrUnsafePath, dir)
+	}
+	return nil
+}
+
+// ValidatePath checks that a storage path read from the database points inside one of
+// dirs before it is read or removed. The check is repeated with symlinks resolved in the
+// parent directory, so a linked directory inside a storage directory can't lead outside
+// of it.
+func ValidatePath(dirs []string, path string) error {
+	if !withinDirs(dirs, path) {
+		return fmt.Errorf("%w: %s is outside the storage directories", ErrUnsafePath, path)
+	}
+	info, err := os.Lstat(path)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s is a symlink", ErrUnsafePath, path)
+	}
+
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Nothing to read or remove
+		}
+		return err
+	}
+	var resolvedDirs []string
+	for _, dir := range dirs {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			resolvedDirs = append(resolvedDirs, resolved)
+		}
+	}
+	if !withinDirs(resolvedDirs, filepath.Join(parent, filepath.Base(path))) {
+		return fmt.Errorf("%w: %s resolves outside the storage directories", ErrUnsafePath, path)
+	}
+	return nil
+}
+
+// withinDirs reports whether path lies below one of dirs (not a directory itself)
+func withinDirs(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if IsWithinDir(dir, path) && filepath.Clean(path) != filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
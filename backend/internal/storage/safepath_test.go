@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafeJoinRejectsTraversal(t *testing.T) {
+	base := t.TempDir()
+
+	cases := [][]string{
+		{".."},
+		{"."},
+		{""},
+		{"../etc/passwd"},
+		{"files", ".."},
+		{"files", "../../etc"},
+		{"/etc/passwd"},
+		{`..\..\windows`},
+		{"a/b"},
+		{"chunk\x00.txt"},
+	}
+	for _, elems := range cases {
+		if path, err := SafeJoin(base, elems...); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("SafeJoin(%q) = %q, %v; want ErrUnsafePath", elems, path, err)
+		}
+	}
+
+	path, err := SafeJoin(base, "files", "abc123")
+	if err != nil {
+		t.Fatalf("SafeJoin rejected a plain path: %v", err)
+	}
+	if want := filepath.Join(base, "files", "abc123"); path != want {
+		t.Errorf("SafeJoin = %q, want %q", path, want)
+	}
+}
+
+func TestSafeJoinRejectsSymlinks(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Symlink(outside, filepath.Join(base, "upload")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if _, err := SafeJoin(base, "upload", "chunk_0"); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("SafeJoin through a symlinked directory: got %v, want ErrUnsafePath", err)
+	}
+	if err := RejectSymlinkDir(filepath.Join(base, "upload")); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("RejectSymlinkDir: got %v, want ErrUnsafePath", err)
+	}
+	if err := RejectSymlinkDir(outside); err != nil {
+		t.Errorf("RejectSymlinkDir on a real directory: %v", err)
+	}
+}
+
+func FuzzSafeJoin(f *testing.F) {
+	for _, seed := range []string{"abc123", "..", "../x", "a/../../b", `..\x`, "/abs", "", ".", "chunk_0", "x\x00y"} {
+		f.Add(seed)
+	}
+	base := f.TempDir()
+
+	f.Fuzz(func(t *testing.T, elem string) {
+		path, err := SafeJoin(base, elem)
+		if err != nil {
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Fatalf("SafeJoin(%q) returned unexpected error %v", elem, err)
+			}
+			return
+		}
+		if !IsWithinDir(base, path) || path == filepath.Clean(base) {
+			t.Fatalf("SafeJoin(%q) = %q escapes %q", elem, path, base)
+		}
+		if filepath.Dir(path) != filepath.Clean(base) {
+			t.Fatalf("SafeJoin(%q) = %q is not a direct child of %q", elem, path, base)
+		}
+	})
+}
+
+func FuzzValidatePath(f *testing.F) {
+	for _, seed := range []string{"abc123", "../secret", "../../etc/passwd", "/etc/passwd", "", ".", "a/../b"} {
+		f.Add(seed)
+	}
+	filesDir := filepath.Join(f.TempDir(), "files")
+
+	f.Fuzz(func(t *testing.T, suffix string) {
+		path := filesDir + string(filepath.Separator) + suffix
+		if ValidatePath([]string{filesDir}, path) != nil {
+			return
+		}
+		rel, err := filepath.Rel(filesDir, filepath.Clean(path))
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			t.Fatalf("ValidatePath accepted %q outside %q", path, filesDir)
+		}
+	})
+}
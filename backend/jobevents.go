@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamJobEvents streams processing job updates as Server-Sent Events. A "progress"
+// event is sent with the current job state and on every change; the stream ends with a
+// "completed" event carrying the FileResult, or a "failed" event carrying the error.
+//
+// @summary Follow a processing job
+// @tags chunk
+// @path job_id Job ID
+// @success 200 text/event-stream Server-Sent Events
+func (m *ChunkUploadManager) StreamJobEvents(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	// Subscribe before reading the current state so no update is missed in between
+	ctx := c.Request.Context()
+	pubsub := m.redis.Subscribe(context.Background(), "job_events:"+jobID)
+	defer pubsub.Close()
+	notifications := pubsub.Channel()
+
+	job, err := m.loadJob(jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse job"})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering for live updates
+	c.Status(http.StatusOK)
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(2 * time.Second) // Fallback in case a notification is lost
+	defer poll.Stop()
+
+	lastUpdate := time.Time{}
+	for {
+		// Only send states newer than the last one sent; pub/sub and polling can overlap
+		if job.UpdatedAt.After(lastUpdate) {
+			lastUpdate = job.UpdatedAt
+			switch job.Status {
+			case "completed", "failed":
+				c.SSEvent(job.Status, job)
+				c.Writer.Flush()
+				return
+			default:
+				c.SSEvent("progress", job)
+				c.Writer.Flush()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-notifications:
+			if !ok {
+				return
+			}
+			var update ProcessingJob
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				log.Printf("Invalid job event for %s: %v", jobID, err)
+				continue
+			}
+			job = &update
+		case <-poll.C:
+			current, err := m.loadJob(jobID)
+			if err != nil || current == nil {
+				return
+			}
+			job = current
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"file-storage-service/internal/storage"
+)
+
+const (
+	// jobStream is the Redis stream holding queued processing jobs
+	jobStream = "processing_jobs"
+	// jobGroup is the consumer group shared by all worker processes
+	jobGroup = "workers"
+	// jobRetrySet is a sorted set of job IDs waiting to be retried, scored by when they are due
+	jobRetrySet = "processing_jobs_retry"
+	// jobMaxRetryDelay caps the exponential backoff between attempts
+	jobMaxRetryDelay = 15 * time.Minute
+)
+
+// JobQueue hands chunk assembly jobs to workers through a Redis stream, so processing can
+// run on dedicated worker processes and jobs survive API server restarts. A worker keeps
+// re-claiming the message it is processing as a heartbeat; a job whose worker died stops
+// heartbeating and is claimed by another worker once it has been idle for JOB_CLAIM_TIMEOUT.
+//
+// Chunks are read from TEMP_DIR, so dedicated workers must share TEMP_DIR (and the storage
+// class directories) with the API servers.
+type JobQueue struct {
+	redis    RedisClient
+	manager  *ChunkUploadManager
+	service  *FileService
+	config   *Config
+	consumer string
+}
+
+func NewJobQueue(redisClient RedisClient, manager *ChunkUploadManager, service *FileService, config *Config) *JobQueue {
+	hostname, _ := os.Hostname()
+	queue := &JobQueue{
+		redis:    redisClient,
+		manager:  manager,
+		service:  service,
+		config:   config,
+		consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+
+	err := redisClient.XGroupCreateMkStream(context.Background(), jobStream, jobGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("Failed to create job consumer group: %v", err)
+	}
+
+	return queue
+}
+
+// Enqueue adds a job to the stream for the next free worker
+func (q *JobQueue) Enqueue(job *ProcessingJob) error {
+	return q.enqueueID(job.JobID)
+}
+
+func (q *JobQueue) enqueueID(jobID string) error {
+	return q.redis.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: jobStream,
+		Values: map[string]interface{}{"job_id": jobID},
+	}).Err()
+}
+
+// Run processes jobs with the given number of concurrent workers until ctx is cancelled
+func (q *JobQueue) Run(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	log.Printf("Job worker %s processing with %d workers from %s", q.consumer, workers, q.config.TempDir)
+
+	go q.reclaimStaleJobs(ctx)
+	go q.requeueDueRetries(ctx)
+	for i := 0; i < workers; i++ {
+		go q.work(ctx)
+	}
+	<-ctx.Done()
+}
+
+func (q *JobQueue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		streams, err := q.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    jobGroup,
+			Consumer: q.consumer,
+			Streams:  []string{jobStream, ">"},
+			Count:    1,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil && ctx.Err() == nil {
+				log.Printf("Failed to read job stream: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				q.handle(message)
+			}
+		}
+	}
+}
+
+// reclaimStaleJobs periodically takes over jobs left pending by workers that died
+func (q *JobQueue) reclaimStaleJobs(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pending, err := q.redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: jobStream,
+			Group:  jobGroup,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			continue
+		}
+
+		var stale []string
+		for _, entry := range pending {
+			if entry.Idle >= q.config.JobClaimTimeout {
+				stale = append(stale, entry.ID)
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+
+		messages, err := q.redis.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   jobStream,
+			Group:    jobGroup,
+			Consumer: q.consumer,
+			MinIdle:  q.config.JobClaimTimeout,
+			Messages: stale,
+		}).Result()
+		if err != nil {
+			log.Printf("Failed to claim stale jobs: %v", err)
+			continue
+		}
+		for _, message := range messages {
+			log.Printf("Reclaimed stale job message %s", message.ID)
+			q.handle(message)
+		}
+	}
+}
+
+// requeueDueRetries moves jobs whose retry delay has passed back onto the stream. Removing
+// the job from the retry set first means only one worker process requeues it.
+func (q *JobQueue) requeueDueRetries(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		due, err := q.redis.ZRangeByScore(ctx, jobRetrySet, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(time.Now().Unix(), 10),
+			Count: 100,
+		}).Result()
+		if err != nil {
+			continue
+		}
+
+		for _, jobID := range due {
+			removed, err := q.redis.ZRem(ctx, jobRetrySet, jobID).Result()
+			if err != nil || removed == 0 {
+				continue
+			}
+			if err := q.enqueueID(jobID); err != nil {
+				log.Printf("Failed to requeue job %s, retrying later: %v", jobID, err)
+				q.redis.ZAdd(ctx, jobRetrySet, &redis.Z{Score: float64(time.Now().Unix()), Member: jobID})
+			}
+		}
+	}
+}
+
+// retryOrDeadLetter handles a transient processing failure: the job is retried with
+// exponential backoff until JOB_MAX_ATTEMPTS attempts have failed, then it fails for good
+// and is kept in the dead-letter state for admins to inspect or requeue.
+func (m *ChunkUploadManager) retryOrDeadLetter(job *ProcessingJob, reason string) {
+	ctx := context.Background()
+	job.Attempts++
+	job.Error = reason
+	job.UpdatedAt = time.Now()
+
+	if job.Attempts >= m.config.JobMaxAttempts {
+		log.Printf("Job %s failed after %d attempts, moving to dead letter: %s", job.JobID, job.Attempts, reason)
+		job.Status = "failed"
+		job.DeadLetter = true
+		job.NextAttemptAt = nil
+		m.updateJob(job)
+		sliMetrics.recordJob("bad")
+
+		errorJSON, _ := json.Marshal(map[string]interface{}{
+			"status":    "failed",
+			"error":     reason,
+			"attempts":  job.Attempts,
+			"timestamp": time.Now().Unix(),
+		})
+		m.redis.Set(ctx, "processing:"+job.FileID, string(errorJSON), 24*time.Hour)
+		return
+	}
+
+	delay := m.config.JobRetryBaseDelay << (job.Attempts - 1)
+	if delay <= 0 || delay > jobMaxRetryDelay {
+		delay = jobMaxRetryDelay
+	}
+	nextAttempt := job.UpdatedAt.Add(delay)
+	log.Printf("Job %s failed (attempt %d/%d), retrying in %s: %s", job.JobID, job.Attempts, m.config.JobMaxAttempts, delay, reason)
+
+	job.Status = "retrying"
+	job.NextAttemptAt = &nextAttempt
+	m.updateJob(job)
+
+	err := m.redis.ZAdd(ctx, jobRetrySet, &redis.Z{Score: float64(nextAttempt.Unix()), Member: job.JobID}).Err()
+	if err != nil {
+		log.Printf("Failed to schedule retry of job %s: %v", job.JobID, err)
+	}
+}
+
+// heartbeat re-claims a message for this consumer until done is closed, resetting its idle
+// time so reclaimStaleJobs on other workers leaves a slow but live job alone
+func (q *JobQueue) heartbeat(messageID string, done <-chan struct{}) {
+	ticker := time.NewTicker(q.config.JobClaimTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := q.redis.XClaim(context.Background(), &redis.XClaimArgs{
+				Stream:   jobStream,
+				Group:    jobGroup,
+				Consumer: q.consumer,
+				Messages: []string{messageID},
+			}).Err()
+			if err != nil {
+				log.Printf("Failed to heartbeat job message %s: %v", messageID, err)
+			}
+		}
+	}
+}
+
+// handle processes one stream message and acknowledges it. Jobs that already finished
+// are skipped, so a job delivered twice is only processed once.
+func (q *JobQueue) handle(message redis.XMessage) {
+	defer q.redis.XAck(context.Background(), jobStream, jobGroup, message.ID)
+
+	done := make(chan struct{})
+	defer close(done)
+	go q.heartbeat(message.ID, done)
+
+	jobID, _ := message.Values["job_id"].(string)
+	job, err := q.manager.loadJob(jobID)
+	if err != nil || job == nil {
+		log.Printf("Dropping job %s: not found (%v)", jobID, err)
+		return
+	}
+	if job.Status == "completed" || job.Status == "failed" {
+		return
+	}
+
+	upload, err := q.manager.loadUpload(job.UploadID)
+	if err != nil || upload == nil {
+		job.Status = "failed"
+		job.Error = "Upload session expired before processing"
+		job.UpdatedAt = time.Now()
+		q.manager.updateJob(job)
+		return
+	}
+
+	// A worker with its own TEMP_DIR can't see the chunks the API server received
+	if uploadDir, err := storage.SafeJoin(q.config.TempDir, upload.UploadID); err != nil || !dirExists(uploadDir) {
+		log.Printf("Chunks for upload %s not found in %s; workers must share TEMP_DIR with the API servers", upload.UploadID, q.config.TempDir)
+		job.Status = "failed"
+		job.Error = "Chunk files not found on the processing worker"
+		job.UpdatedAt = time.Now()
+		q.manager.updateJob(job)
+		return
+	}
+
+	// A panicking job fails on its own instead of taking the worker down
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", jobID, r)
+			job.Status = "failed"
+			job.Error = "Internal error while processing the file"
+			job.UpdatedAt = time.Now()
+			q.manager.updateJob(job)
+		}
+	}()
+
+	q.manager.processFileInBackground(job, upload, q.service)
+}
+
+type DeadLetterJobsRequest struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// listDeadLetterJobs returns jobs that failed for good after exhausting their retries
+//
+// @summary List dead-letter jobs
+// @tags admin
+// @body json DeadLetterJobsRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) listDeadLetterJobs(c *gin.Context) {
+	var req DeadLetterJobsRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 100
+	}
+
+	stored, err := s.db.ListDeadLetterJobs(req.Limit)
+	if err != nil {
+		log.Printf("Failed to list dead-letter jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	jobs := make([]*ProcessingJob, 0, len(stored))
+	for _, job := range stored {
+		jobs = append(jobs, processingJobFromStorage(job))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(jobs),
+		"jobs":  jobs,
+	})
+}
+
+// requeueDeadLetterJob gives a dead-letter job a fresh set of attempts, as long as its
+// upload session and chunks are still around
+//
+// @summary Retry a dead-letter job
+// @tags admin
+// @path job_id Job ID
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) requeueDeadLetterJob(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	job, err := s.chunkManager.loadJob(jobID)
+	if err != nil {
+		log.Printf("Failed to load job %s: %v", jobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load job"})
+		return
+	}
+	if job == nil || !job.DeadLetter {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead-letter job not found"})
+		return
+	}
+
+	upload, err := s.chunkManager.loadUpload(job.UploadID)
+	if err != nil || upload == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Upload session expired",
+			"message": "The chunks of this job are gone, so it can't be processed again.",
+		})
+		return
+	}
+
+	job.Status = "pending"
+	job.Attempts = 0
+	job.DeadLetter = false
+	job.Error = ""
+	job.NextAttemptAt = nil
+	job.UpdatedAt = time.Now()
+	s.chunkManager.updateJob(job)
+
+	statusJSON, _ := json.Marshal(map[string]interface{}{
+		"status":   "processing",
+		"filename": upload.Filename,
+		"job_id":   job.JobID,
+	})
+	s.redis.Set(context.Background(), "processing:"+job.FileID, statusJSON, time.Hour)
+
+	if err := s.jobQueue.Enqueue(job); err != nil {
+		log.Printf("Failed to requeue job %s: %v", jobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Job queued for processing",
+		"job":     job,
+	})
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// toStorage converts the job into its database record
+func (j *ProcessingJob) toStorage() *ProcessingJobStorage {
+	stored := &ProcessingJobStorage{
+		JobID:         j.JobID,
+		UploadID:      j.UploadID,
+		Status:        j.Status,
+		Progress:      j.Progress,
+		Attempts:      j.Attempts,
+		NextAttemptAt: j.NextAttemptAt,
+		DeadLetter:    j.DeadLetter,
+		CreatedAt:     j.CreatedAt,
+		UpdatedAt:     j.UpdatedAt,
+	}
+	if j.FileID != "" {
+		stored.FileID = &j.FileID
+	}
+	if j.Error != "" {
+		stored.ErrorMessage = &j.Error
+	}
+	if j.Result != nil {
+		stored.ResultData, _ = json.Marshal(j.Result)
+	}
+	if j.Status == "completed" || j.Status == "failed" {
+		completedAt := j.UpdatedAt
+		stored.CompletedAt = &completedAt
+	}
+	return stored
+}
+
+// processingJobFromStorage converts a database record back into a job
+func processingJobFromStorage(stored *ProcessingJobStorage) *ProcessingJob {
+	job := &ProcessingJob{
+		JobID:         stored.JobID,
+		UploadID:      stored.UploadID,
+		Status:        stored.Status,
+		Progress:      stored.Progress,
+		Attempts:      stored.Attempts,
+		NextAttemptAt: stored.NextAttemptAt,
+		DeadLetter:    stored.DeadLetter,
+		CreatedAt:     stored.CreatedAt,
+		UpdatedAt:     stored.UpdatedAt,
+	}
+	if stored.FileID != nil {
+		job.FileID = *stored.FileID
+	}
+	if stored.ErrorMessage != nil {
+		job.Error = *stored.ErrorMessage
+	}
+	if len(stored.ResultData) > 0 {
+		var result FileResult
+		if err := json.Unmarshal(stored.ResultData, &result); err == nil {
+			job.Result = &result
+		}
+	}
+	return job
+}
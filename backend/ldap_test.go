@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"file-storage-service/internal/ldapauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseGroupRoles(t *testing.T) {
+	roles, err := parseGroupRoles("admin:cn=file-admins,ou=groups,dc=example,dc=com; user : cn=staff,dc=example,dc=com;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles["cn=file-admins,ou=groups,dc=example,dc=com"] != "admin" || roles["cn=staff,dc=example,dc=com"] != "user" || len(roles) != 2 {
+		t.Errorf("parseGroupRoles = %v", roles)
+	}
+	for _, value := range []string{"cn=admins,dc=example", "admin:", ":cn=admins"} {
+		if _, err := parseGroupRoles(value); err == nil {
+			t.Errorf("parseGroupRoles(%q) succeeded", value)
+		}
+	}
+	if _, err := newLDAPAuthenticator(&Config{AuthProvider: "kerberos"}); err == nil {
+		t.Error("an unknown AUTH_PROVIDER was accepted")
+	}
+}
+
+func TestLDAPAdminsUseBearerTokens(t *testing.T) {
+	ts := newTestService(t)
+	check := func(c *gin.Context) {
+		if ts.adminMiddleware()(c); !c.IsAborted() {
+			c.Status(http.StatusNoContent)
+		}
+	}
+	request := func(authorization, password string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if password != "" {
+			req.Header.Set(adminPasswordHeader, password)
+		}
+		return ts.serve(check, req).Code
+	}
+
+	token, _, err := ts.adminTokens.IssueFor("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without the directory, tokens don't replace the admin password
+	if code := request("Bearer "+token, ""); code != http.StatusServiceUnavailable {
+		t.Errorf("password provider with a token: got %d, want 503", code)
+	}
+
+	ts.ldap, err = ldapauth.New(ldapauth.Config{URL: "ldap://127.0.0.1", UserBaseDN: "dc=example", UserAttribute: "uid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := request("Bearer "+token, ""); code != http.StatusNoContent {
+		t.Errorf("ldap provider with a token: got %d, want 204", code)
+	}
+	if code := request("Bearer not-a-token", ""); code != http.StatusUnauthorized {
+		t.Errorf("ldap provider with a bad token: got %d, want 401", code)
+	}
+	// A configured ADMIN_PASSWORD keeps working as a break-glass login
+	ts.config.AdminPassword = "secret"
+	if code := request("", "secret"); code != http.StatusNoContent {
+		t.Errorf("ldap provider with the admin password: got %d, want 204", code)
+	}
+}
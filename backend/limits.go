@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// CallerLimits is what the caller may still do before hitting a limit
+type CallerLimits struct {
+	RateLimit   RateLimitState    `json:"rate_limit"`
+	Storage     QuotaStatus       `json:"storage"`
+	Org         *QuotaStatus      `json:"org,omitempty"` // Only for API keys in an org with a quota
+	Egress      EgressStatus      `json:"egress"`
+	Sizes       UploadSizeLimits  `json:"sizes"`
+	Concurrency UploadConcurrency `json:"concurrency"`
+}
+
+// RateLimitState is the caller's request budget in the current window, counting the
+// request asking for it
+type RateLimitState struct {
+	Scope     string    `json:"scope"`     // "api_key" or "ip"
+	Limit     int       `json:"limit"`     // Requests per minute, 0 = unlimited
+	Used      int       `json:"used"`      // Requests made in the current window
+	Remaining int       `json:"remaining"` // -1 when unlimited
+	ResetsAt  time.Time `json:"resets_at"` // When the count restarts
+	Throttled bool      `json:"throttled"` // Held to a quarter of the budget by abuse detection
+}
+
+// QuotaStatus is storage usage with what remains of its quota
+type QuotaStatus struct {
+	QuotaUsage
+	RemainingFiles int   `json:"remaining_files"` // -1 when unlimited
+	RemainingBytes int64 `json:"remaining_bytes"` // -1 when unlimited
+}
+
+// EgressStatus is this month's egress with what remains of its quota
+type EgressStatus struct {
+	EgressUsage
+	RemainingBytes int64 `json:"remaining_bytes"` // -1 when unlimited
+}
+
+// UploadSizeLimits are the sizes uploads of the caller must stay within
+type UploadSizeLimits struct {
+	MaxFileSize         int64            `json:"max_file_size"`
+	MaxUploadSize       int64            `json:"max_upload_size"`        // Largest file the caller can store now, within its remaining quotas
+	SimpleUploadMaxSize int64            `json:"simple_upload_max_size"` // Larger files use chunked upload
+	MaxChunkSize        int64            `json:"max_chunk_size"`
+	MaxChunksPerFile    int              `json:"max_chunks_per_file"`
+	ExtensionMaxSizes   map[string]int64 `json:"extension_max_sizes,omitempty"`
+}
+
+// UploadConcurrency describes the upload lanes and how busy they are
+type UploadConcurrency struct {
+	// Where a new upload goes: "main" while a slot is free; "fast_lane" once the main
+	// lane is saturated, for uploads below small_upload_max_size; "queued" when it is
+	// saturated and there is no fast lane, or the upload is too large for it
+	Class                  string `json:"class"`
+	MaxConcurrentUploads   int    `json:"max_concurrent_uploads"`
+	ActiveUploads          int64  `json:"active_uploads"`                     // Slots of the main lane held
+	SmallUploadMaxSize     int64  `json:"small_upload_max_size,omitempty"`    // 0 when the fast lane is disabled
+	SmallUploadConcurrency int    `json:"small_upload_concurrency,omitempty"` // Slots of the fast lane
+}
+
+// newQuotaStatus adds what remains to a usage
+func newQuotaStatus(usage *QuotaUsage) QuotaStatus {
+	return QuotaStatus{
+		QuotaUsage:     *usage,
+		RemainingFiles: usage.RemainingFiles(),
+		RemainingBytes: usage.RemainingBytes(),
+	}
+}
+
+// getLimits reports the caller's rate limit, quotas, size limits and upload concurrency,
+// so clients can pace themselves instead of discovering limits through 429 responses.
+// API keys are reported with their own limits, anonymous callers with those of their IP.
+//
+// @summary Describe the caller's limits
+// @tags account
+// @success 200 CallerLimits
+// @auth apiKey optional
+func (s *FileService) getLimits(c *gin.Context) {
+	rateLimit, err := s.rateLimitState(c)
+	if err != nil {
+		log.Printf("Failed to get rate limit state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get limits"})
+		return
+	}
+	storage, err := s.quotaUsage(c)
+	if err != nil {
+		log.Printf("Failed to get storage usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get limits"})
+		return
+	}
+	org, err := s.orgQuotaUsage(c)
+	if err != nil {
+		log.Printf("Failed to get org usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get limits"})
+		return
+	}
+	egress, err := s.egressUsage(c)
+	if err != nil {
+		log.Printf("Failed to get egress usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get limits"})
+		return
+	}
+
+	limits := CallerLimits{
+		RateLimit: rateLimit,
+		Storage:   newQuotaStatus(storage),
+		Egress:    EgressStatus{EgressUsage: *egress, RemainingBytes: -1},
+		Sizes: UploadSizeLimits{
+			MaxFileSize:         s.config.MaxFileSize,
+			MaxUploadSize:       s.config.MaxFileSize,
+			SimpleUploadMaxSize: s.config.ChunkThreshold,
+			MaxChunkSize:        s.config.ChunkSize,
+			MaxChunksPerFile:    s.config.MaxChunksPerFile,
+			ExtensionMaxSizes:   s.config.ExtensionMaxSizes,
+		},
+		Concurrency: s.uploadLanes.state(),
+	}
+	if egress.QuotaBytes > 0 {
+		limits.Egress.RemainingBytes = max(egress.QuotaBytes-egress.UsedBytes, 0)
+	}
+	quotas := []QuotaStatus{limits.Storage}
+	if org != nil {
+		status := newQuotaStatus(org)
+		limits.Org = &status
+		quotas = append(quotas, status)
+	}
+	for _, quota := range quotas {
+		if quota.RemainingFiles == 0 {
+			limits.Sizes.MaxUploadSize = 0
+		}
+		if quota.RemainingBytes >= 0 {
+			limits.Sizes.MaxUploadSize = min(limits.Sizes.MaxUploadSize, quota.RemainingBytes)
+		}
+	}
+
+	c.JSON(http.StatusOK, limits)
+}
+
+// rateLimitState returns the request budget of the caller in the current window: the
+// Redis counter of its API key, or the in-memory count of its IP
+func (s *FileService) rateLimitState(c *gin.Context) (RateLimitState, error) {
+	now := time.Now()
+
+	if key := apiKeyFromContext(c); key != nil {
+		window := now.Unix() / 60
+		count, err := s.redis.Get(context.Background(), apiKeyRateLimitKey(key.ID, window)).Int()
+		if err != nil && err != redis.Nil {
+			return RateLimitState{}, err
+		}
+		state := RateLimitState{
+			Scope:     "api_key",
+			Limit:     key.RateLimit,
+			Used:      count,
+			Remaining: -1,
+			ResetsAt:  time.Unix((window+1)*60, 0).UTC(),
+		}
+		if key.RateLimit > 0 {
+			state.Remaining = max(key.RateLimit-count, 0)
+		}
+		return state, nil
+	}
+
+	bucket, limit := ipRateLimitBucket(c, s.config)
+	used, resetsAt := s.rateLimiter.usage(bucket, now)
+	return RateLimitState{
+		Scope:     "ip",
+		Limit:     limit,
+		Used:      used,
+		Remaining: max(limit-used, 0),
+		ResetsAt:  resetsAt.UTC(),
+		Throttled: c.GetBool(abuseThrottledContextKey),
+	}, nil
+}
+
+// apiKeyRateLimitKey is the Redis counter of an API key's requests in a one-minute window
+func apiKeyRateLimitKey(keyID string, window int64) string {
+	return fmt.Sprintf("ratelimit:apikey:%s:%d", keyID, window)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getTestLimits(t *testing.T, handlers ...gin.HandlerFunc) CallerLimits {
+	t.Helper()
+	router := gin.New()
+	router.GET("/api/limits", handlers...)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/limits", nil)
+	req.RemoteAddr = "192.0.2.7:1234"
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var limits CallerLimits
+	if err := json.Unmarshal(w.Body.Bytes(), &limits); err != nil {
+		t.Fatal(err)
+	}
+	return limits
+}
+
+func TestLimitsAnonymous(t *testing.T) {
+	ts := newTestService(t)
+	limiter := rateLimitMiddleware(ts.config, ts.rateLimiter)
+
+	getTestLimits(t, limiter, ts.getLimits)
+	limits := getTestLimits(t, limiter, ts.getLimits)
+
+	if rate := limits.RateLimit; rate.Scope != "ip" || rate.Limit != 200 || rate.Used != 2 || rate.Remaining != 198 ||
+		time.Until(rate.ResetsAt) <= 0 {
+		t.Errorf("rate limit = %+v", rate)
+	}
+	if limits.Storage.Subject != "ip" || limits.Storage.RemainingBytes != -1 || limits.Org != nil {
+		t.Errorf("storage = %+v, org = %+v", limits.Storage, limits.Org)
+	}
+	if limits.Sizes.MaxUploadSize != ts.config.MaxFileSize || limits.Sizes.SimpleUploadMaxSize != ts.config.ChunkThreshold {
+		t.Errorf("sizes = %+v", limits.Sizes)
+	}
+	if limits.Concurrency.Class != "main" || limits.Concurrency.MaxConcurrentUploads != ts.config.MaxConcurrentUploads {
+		t.Errorf("concurrency = %+v", limits.Concurrency)
+	}
+}
+
+func TestLimitsAPIKey(t *testing.T) {
+	ts := newTestService(t)
+	key := &APIKeyStorage{ID: "key-1", RateLimit: 10, QuotaBytes: 100, EgressQuotaBytes: 1000}
+	ts.store.CreateAPIKey(key)
+	ts.saveTestFile(t, "owned", "content", time.Hour)
+	file, _ := ts.store.GetFile("owned")
+	file.APIKeyID = &key.ID
+	ts.store.SaveFile(file)
+	counter := apiKeyRateLimitKey(key.ID, time.Now().Unix()/60)
+	for range 3 {
+		ts.redis.Incr(context.Background(), counter)
+	}
+
+	limits := getTestLimits(t, asKey(key, ts.getLimits))
+
+	if rate := limits.RateLimit; rate.Scope != "api_key" || rate.Used != 3 || rate.Remaining != 7 || rate.ResetsAt.Second() != 0 {
+		t.Errorf("rate limit = %+v", rate)
+	}
+	remaining := 100 - limits.Storage.UsedBytes
+	if limits.Storage.Subject != "api_key" || limits.Storage.UsedBytes == 0 ||
+		limits.Storage.RemainingBytes != remaining || limits.Sizes.MaxUploadSize != remaining {
+		t.Errorf("storage = %+v, sizes = %+v", limits.Storage, limits.Sizes)
+	}
+	if limits.Egress.Subject != "api_key" || limits.Egress.RemainingBytes != 1000 {
+		t.Errorf("egress = %+v", limits.Egress)
+	}
+}
+
+func TestIPRateLimiter(t *testing.T) {
+	limiter := newIPRateLimiter()
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if !limiter.allow("192.0.2.7", 2, now) {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+	if limiter.allow("192.0.2.7", 2, now.Add(time.Second)) {
+		t.Error("request over the limit was allowed")
+	}
+	if used, resetsAt := limiter.usage("192.0.2.7", now); used != 2 || !resetsAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("usage = %d, %v", used, resetsAt)
+	}
+	if !limiter.allow("192.0.2.7", 2, now.Add(2*time.Minute)) {
+		t.Error("count did not restart after a minute")
+	}
+	if used, _ := limiter.usage("192.0.2.8", now); used != 0 {
+		t.Errorf("unknown client used %d", used)
+	}
+}
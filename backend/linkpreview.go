@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Chat apps and social networks unfurl links from the page's OpenGraph and Twitter meta
+// tags, which crawlers read without running the frontend. File pages (/f/:id) are
+// therefore served with tags describing the file, and /api/file/:id/oembed answers
+// oEmbed consumers. Both only show what /api/metadata/:id does; files behind a download
+// password get no thumbnail.
+
+// siteName is the name previews show when no org brands the file
+const siteName = "ONE"
+
+// Meta tags of index.html that file pages replace
+var (
+	previewMetaPattern  = regexp.MustCompile(`(?i)\s*<meta\s+(?:property="og:[^"]*"|name="twitter:(?:card|title|description|image)[^"]*")[^>]*>`)
+	previewTitlePattern = regexp.MustCompile(`(?is)<title>.*?</title>`)
+)
+
+// linkPreview is what a link to a file unfurls to
+type linkPreview struct {
+	SiteName    string
+	Title       string
+	Description string
+	PageURL     string
+	OEmbedURL   string
+	Image       string // Absolute URL of a thumbnail, or the generic ogp.png
+	ImageAlt    string
+	ImageWidth  int // Known for images only
+	ImageHeight int
+	Thumbnail   bool // Whether Image shows the file itself
+}
+
+// thumbnailPath returns the path of an image showing the file, or "" when there is none
+// or the file is password protected
+func thumbnailPath(file *FileStorage) string {
+	if file.HasDownloadPassword {
+		return ""
+	}
+	id := url.PathEscape(file.ID)
+	switch {
+	case strings.HasPrefix(file.MimeType, "image/") && file.ImageInfo != nil:
+		return "/api/preview/" + id
+	case strings.HasPrefix(file.MimeType, "video/"):
+		return "/api/media/" + id + "/poster"
+	case file.MimeType == "application/pdf":
+		return "/api/preview/" + id + "/page/1"
+	}
+	return ""
+}
+
+// buildLinkPreview describes the link to a file
+func (s *FileService) buildLinkPreview(c *gin.Context, file *FileStorage) *linkPreview {
+	base := strings.TrimSuffix(s.publicBaseURL(c), "/")
+	preview := &linkPreview{
+		SiteName:  siteName,
+		Title:     file.Filename,
+		PageURL:   base + "/f/" + url.PathEscape(file.ID),
+		OEmbedURL: base + "/api/file/" + url.PathEscape(file.ID) + "/oembed?format=json",
+		Image:     base + "/ogp.png",
+	}
+	if branding := s.orgBranding(file); branding != nil && branding.DisplayName != "" {
+		preview.SiteName = branding.DisplayName
+	}
+
+	details := []string{formatSize(file.OriginalSize)}
+	if file.MimeType != "" {
+		details = append([]string{file.MimeType}, details...)
+	}
+	if file.HasDownloadPassword {
+		details = append(details, "password protected")
+	}
+	details = append(details, "available until "+file.ExpiresAt.UTC().Format("January 2, 2006 15:04 MST"))
+	preview.Description = strings.Join(details, " · ")
+	if file.Accessibility != nil {
+		about := file.Accessibility.Caption
+		if about == "" {
+			about = file.Accessibility.Description
+		}
+		if about != "" {
+			preview.Description = strings.Join(strings.Fields(about), " ") + " (" + preview.Description + ")"
+		}
+	}
+
+	if path := thumbnailPath(file); path != "" {
+		preview.Image = base + path
+		preview.Thumbnail = true
+		if file.Accessibility != nil {
+			preview.ImageAlt = file.Accessibility.AltText
+		}
+		if strings.HasPrefix(file.MimeType, "image/") {
+			preview.ImageWidth, preview.ImageHeight = file.ImageInfo.Width, file.ImageInfo.Height
+		}
+	}
+	return preview
+}
+
+// metaTags renders the head elements of a link preview
+func (p *linkPreview) metaTags() string {
+	var tags strings.Builder
+	tag := func(attribute, name, content string) {
+		if content != "" {
+			fmt.Fprintf(&tags, "\n  <meta %s=\"%s\" content=\"%s\" />", attribute, name, html.EscapeString(content))
+		}
+	}
+	card := "summary"
+	if p.Thumbnail {
+		card = "summary_large_image"
+	}
+
+	fmt.Fprintf(&tags, "<title>%s - %s</title>", html.EscapeString(p.Title), html.EscapeString(p.SiteName))
+	tag("property", "og:site_name", p.SiteName)
+	tag("property", "og:title", p.Title)
+	tag("property", "og:description", p.Description)
+	tag("property", "og:type", "website")
+	tag("property", "og:url", p.PageURL)
+	tag("property", "og:image", p.Image)
+	tag("property", "og:image:alt", p.ImageAlt)
+	if p.ImageWidth > 0 && p.ImageHeight > 0 {
+		tag("property", "og:image:width", strconv.Itoa(p.ImageWidth))
+		tag("property", "og:image:height", strconv.Itoa(p.ImageHeight))
+	}
+	tag("name", "twitter:card", card)
+	tag("name", "twitter:title", p.Title)
+	tag("name", "twitter:description", p.Description)
+	tag("name", "twitter:image", p.Image)
+	tag("name", "twitter:image:alt", p.ImageAlt)
+	fmt.Fprintf(&tags, "\n  <link rel=\"alternate\" type=\"application/json+oembed\" href=\"%s\" title=\"%s\" />",
+		html.EscapeString(p.OEmbedURL), html.EscapeString(p.Title))
+	return tags.String()
+}
+
+// injectLinkPreview swaps the generic title and meta tags of the frontend's index.html for
+// those of a link preview. Pages without a head are returned as they are.
+func injectLinkPreview(page []byte, preview *linkPreview) []byte {
+	document := string(page)
+	end := strings.Index(strings.ToLower(document), "</head>")
+	if end < 0 {
+		return page
+	}
+	head := previewMetaPattern.ReplaceAllString(document[:end], "")
+	head = previewTitlePattern.ReplaceAllString(head, "")
+	return []byte(strings.TrimRight(head, " \t\r\n") + "\n  " + preview.metaTags() + "\n" + document[end:])
+}
+
+// serveFilePage serves the frontend for a file page, with the file's link preview when it
+// is available. Anything that goes wrong leaves the plain frontend.
+func (s *FileService) serveFilePage(c *gin.Context, fileID string) {
+	const indexPath = "./static/index.html"
+	file, err := s.lookupFile(fileID, false)
+	if err != nil {
+		log.Printf("Failed to get file metadata for the page of %s: %v", fileID, err)
+	}
+	if file == nil || file.ExpiresAt.Before(s.clock.Now()) {
+		c.File(indexPath)
+		return
+	}
+	page, err := os.ReadFile(indexPath)
+	if err != nil {
+		c.File(indexPath)
+		return
+	}
+	// The tags change with the file, so caches must check back
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", injectLinkPreview(page, s.buildLinkPreview(c, file)))
+}
+
+// getFileOEmbed answers oEmbed consumers with a link preview of a file. Only the JSON
+// format is supported; a thumbnail larger than maxwidth or maxheight is left out.
+//
+// @summary Get an oEmbed link preview of a file
+// @tags file
+// @path id File ID
+// @query format string Only json is supported
+// @query maxwidth integer Largest thumbnail width
+// @query maxheight integer Largest thumbnail height
+// @success 200 json
+func (s *FileService) getFileOEmbed(c *gin.Context) {
+	if format := c.DefaultQuery("format", "json"); format != "json" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Only format=json is supported"})
+		return
+	}
+	maxWidth, maxHeight := 0, 0
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{{"maxwidth", &maxWidth}, {"maxheight", &maxHeight}} {
+		if value := c.Query(limit.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": limit.name + " must be a positive number"})
+				return
+			}
+			*limit.value = n
+		}
+	}
+
+	fileID := c.Param("id")
+	file, err := s.lookupFile(fileID, false)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if file == nil || file.ExpiresAt.Before(s.clock.Now()) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found or expired"})
+		return
+	}
+
+	preview := s.buildLinkPreview(c, file)
+	response := gin.H{
+		"version":       "1.0",
+		"type":          "link",
+		"title":         preview.Title,
+		"description":   preview.Description,
+		"url":           preview.PageURL,
+		"provider_name": preview.SiteName,
+		"provider_url":  strings.TrimSuffix(s.publicBaseURL(c), "/"),
+		"cache_age":     int(file.ExpiresAt.Sub(s.clock.Now()).Seconds()),
+	}
+	// oEmbed thumbnails need their size, which only images have on record
+	if preview.Thumbnail && preview.ImageWidth > 0 &&
+		(maxWidth == 0 || preview.ImageWidth <= maxWidth) && (maxHeight == 0 || preview.ImageHeight <= maxHeight) {
+		response["thumbnail_url"] = preview.Image
+		response["thumbnail_width"] = preview.ImageWidth
+		response["thumbnail_height"] = preview.ImageHeight
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFileOEmbed(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.PublicURL = "https://one.example"
+	ts.saveTestFile(t, "photo", "content", time.Hour)
+	file, _ := ts.store.GetFileMetadata("photo")
+	file.Filename = "photo.png"
+	file.MimeType = "image/png"
+	file.ImageInfo = &ImageInfo{Width: 640, Height: 480, Format: "png"}
+	file.Accessibility = &Accessibility{AltText: "A red bicycle", Caption: "My bike"}
+	ts.store.SaveFile(file)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/file/photo/oembed"+query, nil)
+		return ts.serve(ts.getFileOEmbed, req, gin.Param{Key: "id", Value: "photo"})
+	}
+	var resp struct {
+		Type            string `json:"type"`
+		Title           string `json:"title"`
+		Description     string `json:"description"`
+		ProviderName    string `json:"provider_name"`
+		ThumbnailURL    string `json:"thumbnail_url"`
+		ThumbnailWidth  int    `json:"thumbnail_width"`
+		ThumbnailHeight int    `json:"thumbnail_height"`
+		CacheAge        int    `json:"cache_age"`
+	}
+
+	w := get("")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Type != "link" || resp.Title != "photo.png" || resp.ProviderName != "ONE" || resp.CacheAge != 3600 {
+		t.Errorf("oembed = %+v", resp)
+	}
+	if resp.ThumbnailURL != "https://one.example/api/preview/photo" || resp.ThumbnailWidth != 640 || resp.ThumbnailHeight != 480 {
+		t.Errorf("thumbnail = %q %dx%d", resp.ThumbnailURL, resp.ThumbnailWidth, resp.ThumbnailHeight)
+	}
+	if !strings.HasPrefix(resp.Description, "My bike (image/png · ") {
+		t.Errorf("description = %q", resp.Description)
+	}
+
+	resp.ThumbnailURL = ""
+	json.Unmarshal(get("?maxwidth=320").Body.Bytes(), &resp)
+	if resp.ThumbnailURL != "" {
+		t.Error("thumbnail wider than maxwidth")
+	}
+
+	// Protected files unfurl without showing their content
+	password := "s3cret"
+	file.HasDownloadPassword = true
+	file.DownloadPassword = &password
+	ts.store.SaveFile(file)
+	resp.ThumbnailURL = ""
+	json.Unmarshal(get("").Body.Bytes(), &resp)
+	if resp.ThumbnailURL != "" || !strings.Contains(resp.Description, "password protected") {
+		t.Errorf("protected file: thumbnail %q, description %q", resp.ThumbnailURL, resp.Description)
+	}
+
+	if w := get("?format=xml"); w.Code != http.StatusNotImplemented {
+		t.Errorf("xml: got %d, want 501", w.Code)
+	}
+	if w := get("?maxheight=0"); w.Code != http.StatusBadRequest {
+		t.Errorf("maxheight=0: got %d, want 400", w.Code)
+	}
+	ts.clock.Advance(2 * time.Hour)
+	if w := get(""); w.Code != http.StatusNotFound {
+		t.Errorf("expired file: got %d, want 404", w.Code)
+	}
+}
+
+func TestInjectLinkPreview(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8" />
+  <title>ONE - Blazing-fast file storage</title>
+  <meta property="og:title" content="ONE - Blazing-fast file storage" />
+  <meta property="og:image" content="/ogp.png" />
+  <meta name="twitter:card" content="summary" />
+  <meta name="twitter:image" content="/ogp.png" />
+  <meta name="twitter:author" content="@minagishl" />
+  <script type="module" src="/assets/index.js"></script>
+</head>
+<body><div id="root"></div></body>
+</html>`
+	preview := &linkPreview{
+		SiteName:    "ONE",
+		Title:       `"Q3" <report>.pdf`,
+		Description: "application/pdf · 1.0 MB",
+		PageURL:     "https://one.example/f/abc",
+		OEmbedURL:   "https://one.example/api/file/abc/oembed?format=json",
+		Image:       "https://one.example/api/preview/abc/page/1",
+		Thumbnail:   true,
+	}
+	got := string(injectLinkPreview([]byte(page), preview))
+
+	for _, want := range []string{
+		`<title>&#34;Q3&#34; &lt;report&gt;.pdf - ONE</title>`,
+		`<meta property="og:title" content="&#34;Q3&#34; &lt;report&gt;.pdf" />`,
+		`<meta property="og:image" content="https://one.example/api/preview/abc/page/1" />`,
+		`<meta name="twitter:card" content="summary_large_image" />`,
+		`<meta name="twitter:author" content="@minagishl" />`,
+		`<link rel="alternate" type="application/json+oembed" href="https://one.example/api/file/abc/oembed?format=json"`,
+		`<script type="module" src="/assets/index.js"></script>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("page lacks %s:\n%s", want, got)
+		}
+	}
+	for _, generic := range []string{"Blazing-fast", `content="/ogp.png"`, `content="summary"`} {
+		if strings.Contains(got, generic) {
+			t.Errorf("page still has %s:\n%s", generic, got)
+		}
+	}
+	if string(injectLinkPreview([]byte("no head"), preview)) != "no head" {
+		t.Error("page without a head was changed")
+	}
+}
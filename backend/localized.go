@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/text/language"
+)
+
+// A localized document puts translations of one document, each an uploaded file, behind
+// a single link. Opening the link picks the variant that best matches the reader's
+// Accept-Language, or the one named by ?lang=, and redirects to its download; readers
+// whose languages aren't offered get the default variant. Like collections, localized
+// documents only reference their files and live in Redis until the last variant expires.
+
+// maxLocalizedVariants is the most languages a localized document may offer
+const maxLocalizedVariants = 50
+
+// LocalizedVariant is the file holding one language of a localized document
+type LocalizedVariant struct {
+	Lang   string `json:"lang"` // BCP 47 tag, like "en" or "pt-BR"
+	FileID string `json:"file_id"`
+}
+
+// LocalizedDocument groups the language variants of a document. The default variant
+// comes first.
+type LocalizedDocument struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name,omitempty"`
+	Variants  []LocalizedVariant `json:"variants"`
+	CreatedAt time.Time          `json:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at"`
+}
+
+// LocalizedDocumentRequest creates a localized document from existing files
+type LocalizedDocumentRequest struct {
+	Name        string             `json:"name"`
+	Variants    []LocalizedVariant `json:"variants"`
+	DefaultLang string             `json:"default_lang,omitempty"` // The first variant when empty
+}
+
+// localizedFile is a variant whose file is still available
+type localizedFile struct {
+	Tag  language.Tag
+	File *FileStorage
+}
+
+// createLocalizedDocument groups existing files as the language variants of one document
+//
+// @summary Group files as the languages of a document
+// @tags localized
+// @body json LocalizedDocumentRequest
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) createLocalizedDocument(c *gin.Context) {
+	var req LocalizedDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if len(req.Variants) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "variants is required"})
+		return
+	}
+	if len(req.Variants) > maxLocalizedVariants {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A localized document offers at most %d languages", maxLocalizedVariants)})
+		return
+	}
+
+	now := s.clock.Now()
+	document := &LocalizedDocument{ID: generateID(), Name: req.Name, CreatedAt: now, ExpiresAt: now}
+	seen := map[string]bool{}
+	metadata := make([]gin.H, 0, len(req.Variants))
+	for _, variant := range req.Variants {
+		tag, err := language.Parse(variant.Lang)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid language tag", "lang": variant.Lang})
+			return
+		}
+		lang := tag.String()
+		if seen[lang] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate language", "lang": lang})
+			return
+		}
+		seen[lang] = true
+
+		file, err := s.lookupFile(variant.FileID, false)
+		if err != nil {
+			log.Printf("Failed to get file metadata: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if file == nil || file.ExpiresAt.Before(now) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found", "file_id": variant.FileID})
+			return
+		}
+
+		document.Variants = append(document.Variants, LocalizedVariant{Lang: lang, FileID: file.ID})
+		metadata = append(metadata, gin.H{"lang": lang, "file": publicMetadata(file)})
+		if file.ExpiresAt.After(document.ExpiresAt) {
+			document.ExpiresAt = file.ExpiresAt
+		}
+	}
+
+	// The default goes first
+	defaultIndex := 0
+	if req.DefaultLang != "" {
+		defaultIndex = -1
+		for i, variant := range document.Variants {
+			if variant.Lang == canonicalLang(req.DefaultLang) {
+				defaultIndex = i
+			}
+		}
+		if defaultIndex < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "default_lang must be one of the variants' languages"})
+			return
+		}
+	}
+	variants := document.Variants
+	variants[0], variants[defaultIndex] = variants[defaultIndex], variants[0]
+	metadata[0], metadata[defaultIndex] = metadata[defaultIndex], metadata[0]
+
+	if err := s.saveLocalizedDocument(document); err != nil {
+		log.Printf("Failed to save localized document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save localized document"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"localized_id": document.ID,
+		"name":         document.Name,
+		"url":          "/api/localized/" + document.ID,
+		"default_lang": document.Variants[0].Lang,
+		"variants":     metadata,
+		"expires_at":   document.ExpiresAt,
+	})
+}
+
+// canonicalLang returns the canonical form of a language tag, or the tag as given when it
+// doesn't parse
+func canonicalLang(lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return lang
+	}
+	return tag.String()
+}
+
+// saveLocalizedDocument stores a localized document until its last variant expires
+func (s *FileService) saveLocalizedDocument(document *LocalizedDocument) error {
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(context.Background(), "localized:"+document.ID, documentJSON, document.ExpiresAt.Sub(s.clock.Now())).Err()
+}
+
+// loadLocalizedDocument looks up the localized document of the :id parameter and its
+// variants that are still available, default first, answering the request itself when
+// that fails
+func (s *FileService) loadLocalizedDocument(c *gin.Context) (*LocalizedDocument, []localizedFile, bool) {
+	documentJSON, err := s.redis.Get(context.Background(), "localized:"+c.Param("id")).Bytes()
+	if err == redis.Nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Localized document not found or expired"})
+		return nil, nil, false
+	}
+	var document LocalizedDocument
+	if err == nil {
+		err = json.Unmarshal(documentJSON, &document)
+	}
+	if err != nil {
+		log.Printf("Failed to get localized document: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read localized document"})
+		return nil, nil, false
+	}
+
+	var available []localizedFile
+	for _, variant := range document.Variants {
+		file, err := s.lookupFile(variant.FileID, false)
+		if err != nil {
+			log.Printf("Failed to get variant %s of localized document %s: %v", variant.Lang, document.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, nil, false
+		}
+		if file != nil && !file.ExpiresAt.Before(s.clock.Now()) {
+			available = append(available, localizedFile{Tag: language.Make(variant.Lang), File: file})
+		}
+	}
+	if len(available) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Localized document not found or expired"})
+		return nil, nil, false
+	}
+	return &document, available, true
+}
+
+// chooseVariant picks the variant for an explicit language, or else for the
+// Accept-Language header, falling back to the first (default) variant. It returns false
+// when an explicit language isn't offered.
+func chooseVariant(available []localizedFile, lang, acceptLanguage string) (localizedFile, bool) {
+	tags := make([]language.Tag, len(available))
+	for i, variant := range available {
+		tags[i] = variant.Tag
+	}
+	matcher := language.NewMatcher(tags)
+
+	if lang != "" {
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return localizedFile{}, false
+		}
+		_, index, confidence := matcher.Match(tag)
+		if confidence == language.No {
+			return localizedFile{}, false
+		}
+		return available[index], true
+	}
+
+	// A malformed header still yields the tags before the error, if any
+	preferred, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, index, _ := matcher.Match(preferred...)
+	return available[index], true
+}
+
+// openLocalizedDocument redirects to the download of the variant that suits the reader.
+// A password given for the download is passed on.
+//
+// @summary Open the variant of a document for the reader's language
+// @tags localized
+// @path id Document ID
+// @query lang string Preferred language, over Accept-Language
+// @header Accept-Language Languages the reader prefers
+// @success 302 Redirect to the download of the variant
+// @auth downloadPassword adminToken optional
+func (s *FileService) openLocalizedDocument(c *gin.Context) {
+	_, available, ok := s.loadLocalizedDocument(c)
+	if !ok {
+		return
+	}
+
+	variant, ok := chooseVariant(available, c.Query("lang"), c.GetHeader("Accept-Language"))
+	if !ok {
+		langs := make([]string, len(available))
+		for i, variant := range available {
+			langs[i] = variant.Tag.String()
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Language not available", "lang": c.Query("lang"), "available": langs})
+		return
+	}
+
+	target := "/api/file/" + url.PathEscape(variant.File.ID)
+	if password := c.Query("password"); password != "" {
+		target += "?" + url.Values{"password": {password}}.Encode()
+	}
+	c.Header("Vary", "Accept-Language")
+	c.Header("Content-Language", variant.Tag.String())
+	c.Header("Cache-Control", "private, no-cache")
+	c.Redirect(http.StatusFound, target)
+}
+
+// getLocalizedVariants lists the languages a localized document still offers, default
+// first, with each variant's metadata
+//
+// @summary List the languages of a document
+// @tags localized
+// @path id Document ID
+// @success 200 json
+func (s *FileService) getLocalizedVariants(c *gin.Context) {
+	document, available, ok := s.loadLocalizedDocument(c)
+	if !ok {
+		return
+	}
+
+	variants := make([]gin.H, len(available))
+	for i, variant := range available {
+		variants[i] = gin.H{"lang": variant.Tag.String(), "file": publicMetadata(variant.File)}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":           document.ID,
+		"name":         document.Name,
+		"default_lang": available[0].Tag.String(),
+		"variants":     variants,
+		"created_at":   document.CreatedAt,
+		"expires_at":   document.ExpiresAt,
+	})
+}
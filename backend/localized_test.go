@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLocalizedDocument(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "manual-en", "Manual", 2*time.Hour)
+	ts.saveTestFile(t, "manual-de", "Handbuch", time.Hour)
+	ts.saveTestFile(t, "manual-ja", "マニュアル", 3*time.Hour)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/localized", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.createLocalizedDocument, req)
+	}
+
+	if w := create(`{"variants":[{"lang":"en","file_id":"manual-en"},{"lang":"EN","file_id":"manual-de"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("duplicate language: got %d, want 400", w.Code)
+	}
+	if w := create(`{"variants":[{"lang":"not a tag","file_id":"manual-en"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tag: got %d, want 400", w.Code)
+	}
+	if w := create(`{"variants":[{"lang":"en","file_id":"missing"}]}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing file: got %d, want 404", w.Code)
+	}
+	if w := create(`{"variants":[{"lang":"en","file_id":"manual-en"}],"default_lang":"fr"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("default not offered: got %d, want 400", w.Code)
+	}
+
+	w := create(`{"name":"Manual","default_lang":"en","variants":[
+		{"lang":"de","file_id":"manual-de"},{"lang":"en","file_id":"manual-en"},{"lang":"ja","file_id":"manual-ja"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		ID          string    `json:"localized_id"`
+		DefaultLang string    `json:"default_lang"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.DefaultLang != "en" || !resp.ExpiresAt.Equal(ts.clock.Now().Add(3*time.Hour)) {
+		t.Errorf("default_lang = %q, expires_at = %v", resp.DefaultLang, resp.ExpiresAt)
+	}
+
+	open := func(query, acceptLanguage string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/localized/"+resp.ID+query, nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		return ts.serve(ts.openLocalizedDocument, req, gin.Param{Key: "id", Value: resp.ID})
+	}
+	for _, tc := range []struct {
+		query, acceptLanguage, want string
+	}{
+		{"", "de-AT,de;q=0.9,en;q=0.5", "/api/file/manual-de"},
+		{"", "ja-JP", "/api/file/manual-ja"},
+		{"", "fr-FR,fr;q=0.9", "/api/file/manual-en"},
+		{"", "", "/api/file/manual-en"},
+		{"?lang=ja", "de", "/api/file/manual-ja"},
+		{"?lang=de&password=pw", "", "/api/file/manual-de?password=pw"},
+	} {
+		w := open(tc.query, tc.acceptLanguage)
+		if w.Code != http.StatusFound || w.Header().Get("Location") != tc.want {
+			t.Errorf("%q with %q: got %d to %q, want %q", tc.query, tc.acceptLanguage, w.Code, w.Header().Get("Location"), tc.want)
+		}
+		if w.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("%q with %q: Vary = %q", tc.query, tc.acceptLanguage, w.Header().Get("Vary"))
+		}
+	}
+	if w := open("?lang=fr", ""); w.Code != http.StatusNotFound {
+		t.Errorf("language not offered: got %d, want 404", w.Code)
+	}
+
+	// Once the default expires, the next variant takes over
+	ts.clock.Advance(2*time.Hour + time.Minute)
+	if w := open("", "fr"); w.Header().Get("Location") != "/api/file/manual-ja" {
+		t.Errorf("after the default expired: redirected to %q", w.Header().Get("Location"))
+	}
+	w = ts.serve(ts.getLocalizedVariants, httptest.NewRequest(http.MethodGet, "/api/localized/"+resp.ID+"/variants", nil), gin.Param{Key: "id", Value: resp.ID})
+	var listing struct {
+		DefaultLang string `json:"default_lang"`
+		Variants    []struct {
+			Lang string `json:"lang"`
+		} `json:"variants"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if listing.DefaultLang != "ja" || len(listing.Variants) != 1 {
+		t.Errorf("variants after expiry = %+v", listing)
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -12,24 +14,57 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"golang.org/x/sync/semaphore"
+
+	"file-storage-service/internal/admin"
+	"file-storage-service/internal/files"
+	"file-storage-service/internal/ldapauth"
+	"file-storage-service/internal/storage"
 )
 
 type FileService struct {
-	redis        *redis.Client
-	db           *Database
-	compressor   *CompressionManager
+	redis        RedisClient
+	db           FileStore
+	clock        Clock
+	compressor   storage.Codec
 	config       *Config
 	chunkManager *ChunkUploadManager
-	uploadSem    *semaphore.Weighted
+	uploadLanes  *uploadLanes
+	rateLimiter  *ipRateLimiter
 	downloadSem  *semaphore.Weighted
+
+	metadataQueue *MetadataQueue
+	jobQueue      *JobQueue
+	scanner       *VirusScanner  // nil when virus scanning is disabled
+	replicator    *Replicator    // nil when replication is disabled
+	hls           *HLSTranscoder // nil when HLS transcoding is disabled
+	remuxer       *MediaRemuxer  // nil when remuxing is disabled
+	adminTokens   *admin.Tokens
+	policySecret  []byte // Signs upload policies
+	startedAt     time.Time
+	ldap          *ldapauth.Authenticator // nil unless AUTH_PROVIDER is ldap
+	mailer        *LinkMailer             // nil unless SMTP_HOST is set
+	maintenance   *Maintenance            // nil runs maintenance jobs whenever they are due
 }
 
 func main() {
+	// --worker runs only the processing job consumer, without the HTTP server
+	workerMode := flag.Bool("worker", false, "run as a dedicated processing job worker")
+	// --promote-secondary turns the replica into a standalone primary after losing the primary region
+	promote := flag.Bool("promote-secondary", false, "promote the replica database and storage to primary")
+	flag.Parse()
+
 	// Load configuration
 	config := LoadConfig()
 
+	if *promote {
+		if err := promoteSecondary(config); err != nil {
+			log.Fatal("Failed to promote secondary:", err)
+		}
+		return
+	}
+
 	// Initialize Redis with optimized settings
-	redisClient := redis.NewClient(&redis.Options{
+	redisOptions := &redis.Options{
 		Addr:         config.RedisAddr,
 		Password:     config.RedisPassword,
 		DB:           config.RedisDB,
@@ -40,54 +75,213 @@ func main() {
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  config.RedisIdleTimeout,
 		PoolTimeout:  5 * time.Second, // Timeout when getting connection from pool
-	})
+	}
+	installRedisFaults(redisOptions)
+	redisClient := redis.NewClient(redisOptions)
 
 	// Test Redis connection
 	ctx := context.Background()
 	if err := redisClient.Ping(ctx).Err(); err != nil {
+		if config.DatabaseDriver == "sqlite" {
+			log.Fatal("Failed to connect to Redis (the embedded mode replaces PostgreSQL only and still needs Redis):", err)
+		}
 		log.Fatal("Failed to connect to Redis:", err)
 	}
 
-	// Initialize PostgreSQL database
-	database, err := NewDatabase(config)
+	// Initialize the database selected by DATABASE_DRIVER
+	database, err := openFileStore(config)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	defer database.Close()
 
-	// Check if schema exists and run migrations if needed
-	schemaExists, err := database.CheckSchemaExists()
+	// Run migrations on a new database and upgrade an existing one
+	if err := database.EnsureSchema(); err != nil {
+		log.Fatal("Failed to prepare database schema:", err)
+	}
+
+	// Initialize services
+	service := newFileService(config, redisClient, database, systemClock{})
+
+	// Before the worker split, so dedicated workers keep to the windows too
+	maintenance, err := NewMaintenance(config, service.clock, service.uploadLanes.saturated)
 	if err != nil {
-		log.Fatal("Failed to check schema existence:", err)
+		log.Fatal("Invalid maintenance windows:", err)
 	}
+	service.maintenance = maintenance
 
-	if !schemaExists {
-		log.Printf("Database schema not found, running migrations...")
-		if err := database.RunMigrations(); err != nil {
-			log.Fatal("Failed to run database migrations:", err)
+	if *workerMode {
+		if config.WorkerMetricsAddr != "" {
+			go service.serveWorkerMetrics()
+		}
+		if service.hls != nil {
+			go service.hls.Run(ctx, config.HLSWorkers)
+		}
+		if service.remuxer != nil {
+			go service.remuxer.Run(ctx, config.RemuxWorkers)
+		}
+		service.jobQueue.Run(ctx, config.JobWorkers)
+		return
+	}
+	if config.EmbeddedJobWorker {
+		go service.jobQueue.Run(ctx, config.JobWorkers)
+		if service.hls != nil {
+			go service.hls.Run(ctx, config.HLSWorkers)
+		}
+		if service.remuxer != nil {
+			go service.remuxer.Run(ctx, config.RemuxWorkers)
 		}
-	} else {
-		log.Printf("Database schema already exists")
-		
 	}
 
-	// Initialize services
-	compressor := NewCompressionManager()
-	chunkManager := NewChunkUploadManager(redisClient, config)
+	// Start expired file cleanup goroutines
+	go service.startExpiredFileCleanup()
+	go service.startDatabaseCleanup()
+	go service.startBandwidthFlush()
+	if config.MeteringEnabled {
+		go service.startMetering()
+	}
+	if config.ReplicaDatabaseURL != "" {
+		replicator, err := NewReplicator(service)
+		if err != nil {
+			log.Fatal("Failed to connect to replica database:", err)
+		}
+		service.replicator = replicator
+		go replicator.Run()
+	}
+
+	if config.DropDir != "" {
+		dropFolder, err := NewDropFolder(service)
+		if err != nil {
+			log.Fatal("Failed to set up drop folder:", err)
+		}
+		go dropFolder.Run()
+	}
+
+	if config.AuthProvider != "password" {
+		ldap, err := newLDAPAuthenticator(config)
+		if err != nil {
+			log.Fatal("Failed to configure authentication provider:", err)
+		}
+		service.ldap = ldap
+	}
+
+	if _, err := files.ParseCollisionPolicy(config.CollectionNameConflict, files.CollisionRename); err != nil {
+		log.Fatal("Invalid COLLECTION_NAME_CONFLICT:", err)
+	}
+	if err := checkFileIDScheme(config); err != nil {
+		log.Fatal("Invalid file ID scheme:", err)
+	}
+
+	if config.FakeData {
+		log.Println("Warning: FAKE_DATA is set; seeding fixture files, which /api/dev/reset restores")
+		if _, err := service.seedFakeData(); err != nil {
+			log.Fatal("Failed to seed fake data:", err)
+		}
+	}
+
+	mailer, err := NewLinkMailer(config)
+	if err != nil {
+		log.Fatal("Failed to configure link emails:", err)
+	}
+	service.mailer = mailer
+
+	router := setupRouter(service)
+
+	if config.AdminAddr != "" {
+		adminServer, err := newAdminServer(service)
+		if err != nil {
+			log.Fatal("Failed to configure admin listener:", err)
+		}
+		go serveAdmin(adminServer)
+	}
+
+	if config.GRPCAddr != "" {
+		grpcServer, err := newGRPCServer(service)
+		if err != nil {
+			log.Fatal("Failed to configure gRPC listener:", err)
+		}
+		go serveGRPC(grpcServer, config.GRPCAddr)
+	}
+
+	log.Printf("Server starting on %s:%s", config.Host, config.Port)
+	log.Printf("Max file size: %d MB", config.MaxFileSize/(1024*1024))
+	log.Printf("File retention: %s", config.FileRetention)
+
+	// Print all registered routes for debugging
+	routes := router.Routes()
+	log.Printf("Total routes registered: %d", len(routes))
+	for _, route := range routes {
+		log.Printf("Route: %s %s -> %s", route.Method, route.Path, route.Handler)
+	}
+
+	server := &http.Server{
+		Addr:           config.Host + ":" + config.Port,
+		Handler:        router,
+		ReadTimeout:    0,  // No read timeout for streaming support
+		WriteTimeout:   0,  // No write timeout for streaming support
+		IdleTimeout:    120 * time.Second, // Close idle connections after 2 minutes
+		MaxHeaderBytes: 1 << 20,           // 1MB max header size
+	}
+
+	tlsConfig, err := apiTLSConfig(config)
+	if err != nil {
+		log.Fatal("Failed to configure TLS:", err)
+	}
+	if config.ClientCertAddr != "" {
+		clientCertServer, err := newClientCertServer(config, router)
+		if err != nil {
+			log.Fatal("Failed to configure client certificate listener:", err)
+		}
+		go serveClientCert(clientCertServer)
+	}
+	if tlsConfig != nil {
+		server.TLSConfig = tlsConfig
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
+	log.Fatal(server.ListenAndServe())
+}
+
+// newFileService wires the services handling requests and processing jobs
+func newFileService(config *Config, redisClient RedisClient, database FileStore, clock Clock) *FileService {
+	compressor := storage.NewCompressionManager()
+	chunkManager := NewChunkUploadManager(redisClient, database, config, clock)
 
 	service := &FileService{
 		redis:        redisClient,
 		db:           database,
+		clock:        clock,
 		compressor:   compressor,
 		config:       config,
 		chunkManager: chunkManager,
-		uploadSem:    semaphore.NewWeighted(int64(config.MaxConcurrentUploads)),
+		uploadLanes:  newUploadLanes(config),
+		rateLimiter:  newIPRateLimiter(),
 		downloadSem:  semaphore.NewWeighted(100), // 100 concurrent downloads
+
+		metadataQueue: NewMetadataQueue(database, redisClient, config),
+		scanner:       NewVirusScanner(config),
+		adminTokens:   newAdminTokens(config, redisClient),
+		policySecret:  newUploadPolicySecret(config),
+		startedAt:     clock.Now(),
 	}
+	service.jobQueue = NewJobQueue(redisClient, chunkManager, service, config)
+	service.hls = NewHLSTranscoder(service)
+	service.remuxer = NewMediaRemuxer(service)
+	return service
+}
 
-	// Start expired file cleanup goroutines
-	go service.startExpiredFileCleanup()
-	go service.startDatabaseCleanup()
+// setupRouter registers the middleware and routes of the HTTP server
+//
+// @title ONE API
+// @version 1.0
+// @description File storage and sharing: uploads with automatic compression and expiry, downloads,
+// @description previews, archives, collections and the admin API.
+// @security apiKey header X-API-Key API key issued by an admin
+// @security adminToken bearer Admin token from POST /api/admin/auth
+// @security adminPassword header X-Admin-Password Admin password, for scripts that don't sign in
+// @security deletePassword query delete_password Delete password returned by the upload
+// @security downloadPassword query password Download password set by the uploader
+func setupRouter(service *FileService) *gin.Engine {
+	config := service.config
 
 	// Setup Gin router with optimizations
 	gin.SetMode(gin.DebugMode)
@@ -96,10 +290,17 @@ func main() {
 
 	// Middleware for performance and security
 	router.Use(gin.Recovery())
+	router.Use(retryAfterMiddleware())
 	router.Use(requestLoggingMiddleware())
+	router.Use(sliMiddleware())
 	router.Use(corsMiddleware())
 	router.Use(securityMiddleware())
-	router.Use(rateLimitMiddleware(config))
+	router.Use(apiKeyMiddleware(service))
+	if config.AbuseDetection {
+		router.Use(service.abuseMiddleware())
+		registerHoneypots(router, service)
+	}
+	router.Use(rateLimitMiddleware(config, service.rateLimiter))
 	router.Use(http2PushMiddleware())
 
 	// Add request timeout middleware
@@ -112,35 +313,113 @@ func main() {
 	})
 
 	// API routes MUST come before static file routes
+	// Routes serving file content count toward bandwidth usage and egress quotas
+	egress := service.egressMiddleware()
+
 	api := router.Group("/api")
 	{
+		api.GET("/capabilities", service.getCapabilities)
+		api.GET("/openapi.json", service.getOpenAPISpec)
+		api.GET("/docs", service.serveAPIDocs)
 		api.POST("/upload", service.uploadFile)
-		api.GET("/file/:id", service.getFile)
+		api.POST("/upload-policies", service.createUploadPolicy)
+		api.POST("/import", service.importFile)
+		api.POST("/upload/quick", service.quickUpload)
+		api.POST("/upload/base64", service.uploadBase64)
+		api.POST("/upload/check", service.checkUploadByHash)
+		api.GET("/file/:id", egress, service.getFile)
 		api.DELETE("/file/:id", service.deleteFile)
+		api.PUT("/file/:id/expires", service.updateOwnerExpiration)
+		api.PUT("/file/:id/password", service.updateOwnerDownloadPassword)
+		api.PUT("/file/:id/accessibility", service.updateFileAccessibility)
+		api.PUT("/file/:id/content", service.replaceFileContent)
+		api.GET("/file/:id/versions", service.listFileVersions)
+		api.GET("/file/:id/versions/:version", service.getFileVersion)
+		api.POST("/file/:id/restore", service.restoreFile)
+		api.POST("/append", service.createAppendFile)
+		api.PATCH("/file/:id", service.patchFile)
+		api.POST("/file/:id/finalize", service.finalizeAppendFile)
+		api.GET("/file/:id/tail", egress, service.tailFile)
+		api.GET("/file/:id/meta4", service.getMetalink)
+		api.GET("/file/:id/segments", service.getSegmentPlan)
+		api.GET("/file/:id/summary", service.getShareSummary)
+		api.GET("/file/:id/qr", service.getFileQR)
+		api.GET("/file/:id/oembed", service.getFileOEmbed)
 		api.GET("/metadata/:id", service.getMetadata)
-		api.GET("/preview/:id", service.previewFile)
-		api.GET("/stream/:id", service.fastStreamFile) // Optimized streaming endpoint
+		api.GET("/preview/:id", egress, service.previewFile)
+		api.GET("/preview/:id/page/:n", egress, service.getPDFPage)
+		api.GET("/preview/:id/text", egress, service.getTextPreview)
+		api.GET("/preview/:id/table", egress, service.getTablePreview)
+		api.GET("/stream/:id", egress, service.fastStreamFile) // Optimized streaming endpoint
+		api.GET("/stream/:id/hls/:name", egress, service.serveHLS)
 		// ZIP file extraction endpoint with query parameter
-		api.GET("/zip/:id/extract", service.extractZipFile)
-		api.GET("/zip/:id", service.browseZip)
+		api.GET("/archive/:id/extract", egress, service.extractArchiveFile)
+		api.GET("/archive/:id/tree", service.getArchiveTree)
+		api.POST("/archive/:id/download", egress, service.downloadArchiveSubset)
+		api.GET("/archive/:id", service.browseArchive)
+		// The original ZIP-only paths, kept for existing links
+		api.GET("/zip/:id/extract", egress, service.extractArchiveFile)
+		api.GET("/zip/:id/tree", service.getArchiveTree)
+		api.POST("/zip/:id/download", egress, service.downloadArchiveSubset)
+		api.GET("/zip/:id", service.browseArchive)
+		// Collections of files, downloadable as one ZIP or tar
+		api.POST("/collections", service.createCollection)
+		api.POST("/collections/upload", service.uploadCollection)
+		api.GET("/collections/:id", service.getCollectionFiles)
+		api.GET("/collections/:id/download", egress, service.downloadCollection)
+		api.POST("/localized", service.createLocalizedDocument)
+		api.GET("/localized/:id", service.openLocalizedDocument)
+		api.GET("/localized/:id/variants", service.getLocalizedVariants)
+		// Server-side rendering for data formats
+		api.GET("/notebook/:id", egress, service.renderNotebook)
+		api.GET("/geojson/:id", egress, service.getGeoJSON)
+		api.GET("/geojson/:id/info", service.getGeoJSONInfo)
+		// Video poster frames and media info from ffmpeg
+		api.GET("/media/:id/poster", service.getMediaPoster)
+		api.GET("/media/:id/info", service.getMediaInfo)
+		api.GET("/media/:id/remux", egress, service.serveRemux)
 
 		// Chunk upload endpoints
 		api.POST("/chunk/initiate", service.chunkManager.InitiateUpload)
 		api.POST("/chunk/:upload_id/:chunk_index", service.chunkManager.UploadChunk)
 		api.POST("/chunk/:upload_id/complete", service.chunkManager.CompleteUpload)
 		api.GET("/chunk/:upload_id/status", service.chunkManager.GetUploadStatus)
+		api.GET("/chunk/:upload_id/ws", service.chunkManager.UploadStatusSocket)
+		api.GET("/job/:job_id", service.chunkManager.GetJobStatus)
+		api.GET("/job/:job_id/events", service.chunkManager.StreamJobEvents)
 		api.GET("/file/:id/status", service.getFileStatus)
+		api.GET("/file/:id/stats", service.getFileStats)
+		api.GET("/usage", service.getUsage)
+		api.GET("/stats", service.getPublicStats)
+		api.POST("/scanner/verdict", service.receiveScanVerdict)
+		api.GET("/dashboard", service.getDashboard)
+		api.GET("/limits", service.getLimits)
+		api.GET("/files/export", service.exportOwnFiles)
+		api.GET("/org", service.getOrg)
+		api.GET("/org/files", service.listOrgFiles)
+		api.GET("/org/events", service.listOrgEvents)
+		api.PUT("/org/branding", service.updateOrgBranding)
+		api.PUT("/org/policy", service.updateOrgPolicy)
+
+		// Speed test endpoints (with their own per-IP rate limit, SPEEDTEST_RATE_LIMIT)
+		api.GET("/speedtest/download", service.speedTestDownload)
+		api.POST("/speedtest/upload", service.speedTestUpload)
+
+		// Fixture files for frontend and SDK development
+		if config.FakeData {
+			api.GET("/dev/fixtures", service.listFakeData)
+			api.POST("/dev/reset", service.resetFakeData)
+		}
 
-		// Admin endpoints
-		api.POST("/admin/auth", service.adminAuth)
-		api.PUT("/admin/file/:id/expires", service.updateFileExpiration)
-		api.PUT("/admin/file/password", service.updateFilePassword)
-		api.DELETE("/admin/file/:id", service.adminDeleteFile)
-		api.POST("/admin/files", service.getAdminFileList)
+		// Admin endpoints, unless they have their own listener
+		if config.AdminAddr == "" {
+			registerAdminRoutes(api, service)
+		}
 	}
 
 	// Serve static files (React build) - AFTER API routes
 	router.Static("/assets", "./static/assets")
+	router.Static("/vendor", "./static/vendor") // Third-party libraries, e.g. three.js for the model viewer
 	router.StaticFile("/favicon.ico", "./static/favicon.ico")
 	router.StaticFile("/logo.svg", "./static/logo.svg")
 	router.StaticFile("/ogp.png", "./static/ogp.png")
@@ -156,35 +435,31 @@ func main() {
 		c.File("./static/index.html")
 	})
 
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
-	})
-
-	log.Printf("Server starting on %s:%s", config.Host, config.Port)
-	log.Printf("Max file size: %d MB", config.MaxFileSize/(1024*1024))
-	log.Printf("File retention: 24 hours")
+	// Short links returned by quick uploads, and vanity links chosen at upload
+	router.GET("/s/:code", service.resolveShortLink)
+	router.GET("/f/:slug", service.resolveSlug)
 
-	// Print all registered routes for debugging
-	routes := router.Routes()
-	log.Printf("Total routes registered: %d", len(routes))
-	for _, route := range routes {
-		log.Printf("Route: %s %s -> %s", route.Method, route.Path, route.Handler)
+	// SCIM provisioning for identity providers
+	if config.SCIMToken != "" {
+		registerSCIMRoutes(router, service)
 	}
 
-	server := &http.Server{
-		Addr:           config.Host + ":" + config.Port,
-		Handler:        router,
-		ReadTimeout:    0,  // No read timeout for streaming support
-		WriteTimeout:   0,  // No write timeout for streaming support
-		IdleTimeout:    120 * time.Second, // Close idle connections after 2 minutes
-		MaxHeaderBytes: 1 << 20,           // 1MB max header size
+	// Prometheus metrics, for admins only on the public port, or moved to the admin
+	// listener with ADMIN_ADDR
+	if config.AdminAddr == "" {
+		router.GET("/metrics", service.adminMiddleware(), service.serveMetrics)
 	}
 
-	log.Fatal(server.ListenAndServe())
+	// Health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+	})
+
+	return router
 }
 
-func generateFileID() string {
+// generateID returns a new UUID, for keys, tokens, jobs and everything else but files
+func generateID() string {
 	return uuid.New().String()
 }
 
@@ -202,24 +477,66 @@ func (s *FileService) startDatabaseCleanup() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		if err := s.db.CleanupExpiredData(); err != nil {
+		if err := s.cleanupExpiredData(); err != nil {
 			log.Printf("Error during database cleanup: %v", err)
 		}
 	}
 }
 
+// cleanupExpiredData removes expired records, deleting the files of disk-stored ones first
+// so they don't outlive their rows
+func (s *FileService) cleanupExpiredData() error {
+	paths, err := s.db.DeleteExpiredDiskFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := removeStoredFile(s.config, path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete expired file %s from disk: %v", path, err)
+		}
+	}
+	if len(paths) > 0 {
+		log.Printf("Removed %d expired files from disk", len(paths))
+	}
+
+	// Without a secondary nothing consumes the replication log
+	if s.config.ReplicaDatabaseURL == "" {
+		s.runMaintenance(maintenanceReplicationLogClear, func() {
+			if err := s.db.ClearReplicationLog(); err != nil {
+				log.Printf("Failed to clear replication log: %v", err)
+			}
+		})
+	}
+
+	if err := s.db.CleanupExpiredData(); err != nil {
+		return err
+	}
+	s.runMaintenance(maintenanceTrashPurge, func() {
+		if err := s.purgeTrashedFiles(); err != nil {
+			log.Printf("Failed to purge trashed files: %v", err)
+		}
+	})
+	// After the files, so the versions of files that just expired go too
+	s.runMaintenance(maintenanceVersionCleanup, func() {
+		if err := s.cleanupFileVersions(); err != nil {
+			log.Printf("Failed to clean up file versions: %v", err)
+		}
+	})
+	return nil
+}
+
 func (s *FileService) cleanupExpiredFiles() {
 	log.Printf("Starting cleanup of expired files...")
 
 	// Clean up expired files from PostgreSQL
-	if err := s.db.CleanupExpiredData(); err != nil {
+	if err := s.cleanupExpiredData(); err != nil {
 		log.Printf("Error cleaning up expired files from database: %v", err)
 		return
 	}
 
 	// Optional: Clean up any remaining Redis cache entries
 	ctx := context.Background()
-	now := time.Now()
+	now := s.clock.Now()
 
 	// Get all files that have expired from Redis cache
 	expiredFiles, err := s.redis.ZRangeByScore(ctx, "files", &redis.ZRangeBy{
@@ -238,5 +555,11 @@ func (s *FileService) cleanupExpiredFiles() {
 		log.Printf("Cleaned up %d expired file entries from Redis cache", len(expiredFiles))
 	}
 
+	s.cleanupQuarantine()
+	s.cleanupHLS()
+	s.cleanupRemuxes()
+	s.runMaintenance(maintenanceEventPruning, s.cleanupFileEvents)
+	s.runMaintenance(maintenanceUsagePruning, s.cleanupUsage)
+
 	log.Printf("Cleanup of expired files completed")
 }
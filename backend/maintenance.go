@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/schedule"
+)
+
+// Heavy background jobs, like pruning the file event log or transcoding videos, compete
+// with requests for the database and disks. With MAINTENANCE_WINDOWS set they only run
+// inside the windows, and at any time they are deferred while every upload slot is taken,
+// so they don't add to the latency of peak hours. A deferred job runs on the next tick
+// that is allowed; queued transcodes and remuxes wait in their streams until then.
+
+// Maintenance jobs gated by the windows
+const (
+	maintenanceEventPruning        = "file_event_pruning"
+	maintenanceUsagePruning        = "usage_pruning"
+	maintenanceReplicationLogClear = "replication_log_clear"
+	maintenanceTrashPurge          = "trash_purge"
+	maintenanceVersionCleanup      = "version_cleanup"
+	maintenanceReplication         = "replication"
+	maintenanceHLSTranscoding      = "hls_transcoding"
+	maintenanceRemux               = "remux"
+)
+
+// maintenanceRecheck is how long a stream worker waits before asking again whether its
+// deferred job may run
+const maintenanceRecheck = 30 * time.Second
+
+// MaintenanceJobStatus is when a maintenance job last ran and since when it waits
+type MaintenanceJobStatus struct {
+	Name          string     `json:"name"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	DeferredSince *time.Time `json:"deferred_since,omitempty"`
+	DeferReason   string     `json:"defer_reason,omitempty"`
+}
+
+// Maintenance decides when maintenance jobs may run and tracks them
+type Maintenance struct {
+	windows  schedule.Windows
+	location *time.Location
+	clock    Clock
+	busy     func() bool
+
+	mu   sync.Mutex
+	jobs map[string]*MaintenanceJobStatus
+}
+
+// NewMaintenance parses MAINTENANCE_WINDOWS in MAINTENANCE_TIMEZONE. busy reports
+// whether the service is too loaded for maintenance.
+func NewMaintenance(config *Config, clock Clock, busy func() bool) (*Maintenance, error) {
+	windows, err := schedule.ParseWindows(config.MaintenanceWindows)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(config.MaintenanceTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %v", config.MaintenanceTimezone, err)
+	}
+	return &Maintenance{
+		windows:  windows,
+		location: location,
+		clock:    clock,
+		busy:     busy,
+		jobs:     make(map[string]*MaintenanceJobStatus),
+	}, nil
+}
+
+// deferReason returns why maintenance can't run now, or "" when it can
+func (m *Maintenance) deferReason() string {
+	if len(m.windows) > 0 && !m.windows.Open(m.clock.Now().In(m.location)) {
+		return "outside maintenance window"
+	}
+	if m.busy != nil && m.busy() {
+		return "upload slots saturated"
+	}
+	return ""
+}
+
+// run runs a maintenance job now if allowed, and otherwise records it as deferred
+func (m *Maintenance) run(name string, job func()) {
+	if !m.begin(name) {
+		return
+	}
+	job()
+	m.done(name)
+}
+
+// begin reports whether a maintenance job may run now, recording it as deferred if not
+func (m *Maintenance) begin(name string) bool {
+	reason := m.deferReason()
+
+	m.mu.Lock()
+	status := m.jobs[name]
+	if status == nil {
+		status = &MaintenanceJobStatus{Name: name}
+		m.jobs[name] = status
+	}
+	if reason != "" {
+		if status.DeferredSince == nil {
+			now := m.clock.Now()
+			status.DeferredSince = &now
+			log.Printf("Deferring %s: %s", name, reason)
+		}
+		status.DeferReason = reason
+		m.mu.Unlock()
+		return false
+	}
+	m.mu.Unlock()
+	return true
+}
+
+// done records that a maintenance job ran
+func (m *Maintenance) done(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	status := m.jobs[name]
+	status.LastRunAt = &now
+	status.DeferredSince = nil
+	status.DeferReason = ""
+}
+
+// status returns the state of the jobs seen so far, by name
+func (m *Maintenance) status() []MaintenanceJobStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]MaintenanceJobStatus, 0, len(m.jobs))
+	for _, status := range m.jobs {
+		jobs = append(jobs, *status)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// runMaintenance runs a heavy background job when maintenance is allowed
+func (s *FileService) runMaintenance(name string, job func()) {
+	if s.maintenance == nil {
+		job()
+		return
+	}
+	s.maintenance.run(name, job)
+}
+
+// awaitMaintenance blocks a stream worker until its job may run, returning false when ctx
+// is cancelled first. The caller reports each job it runs with maintenanceDone.
+func (s *FileService) awaitMaintenance(ctx context.Context, name string) bool {
+	for s.maintenance != nil && !s.maintenance.begin(name) {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(maintenanceRecheck):
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// maintenanceDone records that a stream worker ran its job
+func (s *FileService) maintenanceDone(name string) {
+	if s.maintenance != nil {
+		s.maintenance.done(name)
+	}
+}
+
+// getMaintenanceStatus reports the windows, whether maintenance may run now and the
+// state of the jobs on this instance
+//
+// @summary Get the maintenance status
+// @tags admin
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getMaintenanceStatus(c *gin.Context) {
+	m := s.maintenance
+	if m == nil {
+		c.JSON(http.StatusOK, gin.H{"windows": []string{}, "allowed": true, "jobs": []MaintenanceJobStatus{}})
+		return
+	}
+	windows := make([]string, 0, len(m.windows))
+	for _, window := range m.windows {
+		windows = append(windows, window.Spec)
+	}
+	reason := m.deferReason()
+	response := gin.H{
+		"windows":  windows,
+		"timezone": m.location.String(),
+		"allowed":  reason == "",
+		"jobs":     m.status(),
+	}
+	if reason != "" {
+		response["defer_reason"] = reason
+	}
+	if next := m.windows.NextOpen(s.clock.Now().In(m.location)); !next.IsZero() {
+		response["next_window_at"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
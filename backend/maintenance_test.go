@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	ts.config.MaintenanceWindows = "0 14 * * * 1h"
+	busy := false
+	maintenance, err := NewMaintenance(ts.config, ts.clock, func() bool { return busy })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.maintenance = maintenance
+
+	runs := 0
+	job := func() { runs++ }
+
+	// The fake clock starts at 12:00 UTC, before the window
+	ts.runMaintenance(maintenanceEventPruning, job)
+	if runs != 0 {
+		t.Fatal("job ran outside the window")
+	}
+
+	ts.clock.Advance(2*time.Hour + 10*time.Minute)
+	busy = true
+	ts.runMaintenance(maintenanceEventPruning, job)
+	if runs != 0 {
+		t.Fatal("job ran while the upload slots were saturated")
+	}
+
+	busy = false
+	ts.runMaintenance(maintenanceEventPruning, job)
+	if runs != 1 {
+		t.Fatalf("job ran %d times inside the window, want 1", runs)
+	}
+
+	ts.clock.Advance(time.Hour)
+	ts.runMaintenance(maintenanceEventPruning, job)
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/maintenance", strings.NewReader(`{}`))
+	w := ts.serve(ts.getMaintenanceStatus, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d: %s", w.Code, w.Body.String())
+	}
+	var status struct {
+		Allowed      bool                   `json:"allowed"`
+		DeferReason  string                 `json:"defer_reason"`
+		NextWindowAt time.Time              `json:"next_window_at"`
+		Jobs         []MaintenanceJobStatus `json:"jobs"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status.Allowed || status.DeferReason != "outside maintenance window" || !status.NextWindowAt.Equal(time.Date(2024, 1, 2, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("status = %+v", status)
+	}
+	if len(status.Jobs) != 1 || status.Jobs[0].LastRunAt == nil || status.Jobs[0].DeferredSince == nil {
+		t.Errorf("jobs = %+v", status.Jobs)
+	}
+}
+
+func TestMaintenanceDefersBackgroundJobs(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.TrashRetention = time.Hour
+	ts.config.MaintenanceWindows = "0 14 * * * 1h"
+	maintenance, err := NewMaintenance(ts.config, ts.clock, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.maintenance = maintenance
+
+	ts.saveTestFile(t, "render", "frames", 7*24*time.Hour)
+	ts.serve(ts.deleteFile, httptest.NewRequest(http.MethodDelete, "/api/file/render?delete_password=delete-me", nil), gin.Param{Key: "id", Value: "render"})
+
+	// At 13:00 the trash retention is over, but the window opens at 14:00
+	ts.clock.Advance(time.Hour)
+	if err := ts.cleanupExpiredData(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ts.store.files["render"]; !ok {
+		t.Fatal("trash purged outside the maintenance window")
+	}
+	deferred := map[string]bool{}
+	for _, job := range maintenance.status() {
+		deferred[job.Name] = job.DeferredSince != nil
+	}
+	if !deferred[maintenanceTrashPurge] || !deferred[maintenanceVersionCleanup] {
+		t.Errorf("deferred jobs = %v", deferred)
+	}
+
+	// Stream workers wait instead of taking jobs
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if ts.awaitMaintenance(ctx, maintenanceHLSTranscoding) {
+		t.Error("HLS transcoding allowed outside the maintenance window")
+	}
+
+	ts.clock.Advance(time.Hour + 10*time.Minute)
+	if err := ts.cleanupExpiredData(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ts.store.files["render"]; ok {
+		t.Fatal("trash not purged inside the maintenance window")
+	}
+	if !ts.awaitMaintenance(context.Background(), maintenanceHLSTranscoding) {
+		t.Error("HLS transcoding deferred inside the maintenance window")
+	}
+}
+
+func TestInvalidMaintenanceConfig(t *testing.T) {
+	if _, err := NewMaintenance(&Config{MaintenanceWindows: "0 2 * * *", MaintenanceTimezone: "UTC"}, systemClock{}, nil); err == nil {
+		t.Error("accepted a window without a duration")
+	}
+	if _, err := NewMaintenance(&Config{MaintenanceTimezone: "Mars/Olympus"}, systemClock{}, nil); err == nil {
+		t.Error("accepted an unknown time zone")
+	}
+}
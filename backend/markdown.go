@@ -0,0 +1,139 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownListItem = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+(.*)$`)
+	markdownRule     = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	markdownCodeSpan = regexp.MustCompile("`([^`]+)`")
+	markdownLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownImage    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	markdownBold     = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	markdownItalic   = regexp.MustCompile(`(^|[^*\w])[*_](\S(?:[^*_]*\S)?)[*_]`)
+)
+
+// renderMarkdown converts the Markdown subset used in notebook cells (headings, lists,
+// block quotes, fenced code, rules, emphasis, code spans and links) to HTML. All text is
+// escaped before formatting is applied, raw HTML is shown as text and only http(s) and
+// mailto links are kept, so the output is safe to embed.
+func renderMarkdown(source string) template.HTML {
+	var out strings.Builder
+	var paragraph []string
+	listTag := ""
+	inCode := false
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + renderMarkdownInline(strings.Join(paragraph, "\n")) + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			out.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			flushParagraph()
+			closeList()
+			if inCode {
+				out.WriteString("</code></pre>\n")
+			} else {
+				out.WriteString("<pre><code>")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case markdownHeading.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			match := markdownHeading.FindStringSubmatch(trimmed)
+			tag := "h" + string(rune('0'+len(match[1])))
+			out.WriteString("<" + tag + ">" + renderMarkdownInline(match[2]) + "</" + tag + ">\n")
+		case markdownRule.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			quote := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			out.WriteString("<blockquote>" + renderMarkdownInline(quote) + "</blockquote>\n")
+		case markdownListItem.MatchString(line):
+			flushParagraph()
+			match := markdownListItem.FindStringSubmatch(line)
+			tag := "ul"
+			if match[1][0] >= '0' && match[1][0] <= '9' {
+				tag = "ol"
+			}
+			if tag != listTag {
+				closeList()
+				out.WriteString("<" + tag + ">\n")
+				listTag = tag
+			}
+			out.WriteString("<li>" + renderMarkdownInline(match[2]) + "</li>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+
+	flushParagraph()
+	closeList()
+	if inCode {
+		out.WriteString("</code></pre>\n")
+	}
+	return template.HTML(out.String())
+}
+
+// renderMarkdownInline escapes text and applies inline formatting. Code spans are cut out
+// first so their contents are never formatted.
+func renderMarkdownInline(text string) string {
+	var codeSpans []string
+	text = markdownCodeSpan.ReplaceAllStringFunc(text, func(span string) string {
+		codeSpans = append(codeSpans, "<code>"+html.EscapeString(span[1:len(span)-1])+"</code>")
+		return "\x00" + string(rune(len(codeSpans)-1)) + "\x00"
+	})
+
+	text = html.EscapeString(text)
+	text = markdownImage.ReplaceAllStringFunc(text, func(image string) string {
+		// Images would load external resources; show their alt text instead
+		return markdownImage.FindStringSubmatch(image)[1]
+	})
+	text = markdownLink.ReplaceAllStringFunc(text, func(link string) string {
+		match := markdownLink.FindStringSubmatch(link)
+		target := html.UnescapeString(match[2])
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") && !strings.HasPrefix(target, "mailto:") {
+			return match[1]
+		}
+		return `<a href="` + html.EscapeString(target) + `" rel="noopener noreferrer" target="_blank">` + match[1] + `</a>`
+	})
+	text = markdownBold.ReplaceAllString(text, "<strong>$2</strong>")
+	text = markdownItalic.ReplaceAllString(text, "$1<em>$2</em>")
+	text = strings.ReplaceAll(text, "\n", "<br>\n")
+
+	for i, span := range codeSpans {
+		text = strings.Replace(text, "\x00"+string(rune(i))+"\x00", span, 1)
+	}
+	return text
+}
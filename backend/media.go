@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+
+	"file-storage-service/internal/files"
+)
+
+// Video posters and media info are produced by ffmpeg and ffprobe on first request and
+// cached in Redis until the file expires, so a preview can show a thumbnail and duration
+// before playback starts.
+
+const maxPosterWidth = 1280
+
+// mediaFormats are the demuxers ffmpeg may use on uploaded content. Playlist formats such
+// as HLS and concat are left out, since they make ffmpeg open other files.
+const mediaFormats = "mov,mp4,m4a,3gp,3g2,mj2,matroska,webm,avi,flv,mpegts,mpeg,ogg,asf,mp3,wav,flac,aac"
+
+var errMediaToolsUnavailable = errors.New("ffmpeg is not installed")
+
+// mediaGroup lets concurrent requests for the same poster or info share one ffmpeg run
+var mediaGroup singleflight.Group
+
+// MediaInfo describes the streams of an audio or video file
+type MediaInfo struct {
+	Duration   float64 `json:"duration"` // Seconds
+	Format     string  `json:"format"`
+	Bitrate    int64   `json:"bitrate,omitempty"` // Bits per second
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	FrameRate  float64 `json:"frame_rate,omitempty"`
+	VideoCodec string  `json:"video_codec,omitempty"`
+	AudioCodec string  `json:"audio_codec,omitempty"`
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		Disposition  struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// parseFFprobeOutput reads the first video and audio stream from `ffprobe -show_format
+// -show_streams -print_format json` output. Embedded cover art doesn't count as video.
+func parseFFprobeOutput(data []byte) (*MediaInfo, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	info := &MediaInfo{Format: probe.Format.FormatName}
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+
+	for _, stream := range probe.Streams {
+		switch {
+		case stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 && info.VideoCodec == "":
+			info.VideoCodec = stream.CodecName
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.FrameRate = parseFrameRate(stream.AvgFrameRate)
+		case stream.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = stream.CodecName
+		}
+	}
+	return info, nil
+}
+
+// parseFrameRate converts ffprobe rates such as "30000/1001" to frames per second
+func parseFrameRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// runMediaTool runs ffmpeg or ffprobe, killing it after timeout, and returns its output
+func runMediaTool(timeout time.Duration, tool string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, errMediaToolsUnavailable
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s timed out after %s", filepath.Base(tool), timeout)
+		}
+		return nil, fmt.Errorf("%s failed: %v: %s", filepath.Base(tool), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// probeMedia reads the streams of a local media file with ffprobe
+func (s *FileService) probeMedia(path string) (*MediaInfo, error) {
+	args := append([]string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams"}, mediaInputArgs(path)...)
+	output, err := runMediaTool(s.config.MediaProcessTimeout, s.config.FFprobePath, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseFFprobeOutput(output)
+}
+
+// mediaInputArgs restricts ffmpeg to reading the given local file with a media demuxer
+func mediaInputArgs(path string) []string {
+	return []string{"-protocol_whitelist", "file", "-format_whitelist", mediaFormats, "-i", "file:" + path}
+}
+
+// mediaInputPath returns a path ffmpeg can read a file's content from. Uncompressed
+// disk-stored files are read in place; other content is written to a temporary file that
+// the returned function removes.
+func (s *FileService) mediaInputPath(fileStorage *FileStorage) (string, func(), error) {
+	compression := CompressionType(fileStorage.CompressionType)
+	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil && compression == CompressionNone {
+		if err := validateStoragePath(s.config, *fileStorage.StoragePath); err != nil {
+			return "", nil, err
+		}
+		return *fileStorage.StoragePath, func() {}, nil
+	}
+
+	if fileStorage.StorageType != "disk" && fileStorage.FileContent == nil {
+		withContent, err := s.lookupFile(fileStorage.ID, true)
+		if err != nil {
+			return "", nil, err
+		}
+		if withContent == nil {
+			return "", nil, fmt.Errorf("file %s not found", fileStorage.ID)
+		}
+		fileStorage = withContent
+	}
+	content, err := s.loadFileContent(fileStorage, FileMetadata{Compression: compression})
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir := filepath.Join(s.config.TempDir, "media")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", nil, err
+	}
+	input, err := os.CreateTemp(dir, "input-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(input.Name()) }
+	if _, err := input.Write(content); err != nil {
+		input.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := input.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return input.Name(), cleanup, nil
+}
+
+// cachedMediaResult returns a derived result from Redis, or generates it once for all
+// concurrent callers and caches it until the file expires
+func (s *FileService) cachedMediaResult(cacheKey string, fileStorage *FileStorage, generate func(path string) ([]byte, error)) ([]byte, error) {
+	ctx := context.Background()
+	if cached, err := s.redis.Get(ctx, cacheKey).Bytes(); err == nil {
+		return cached, nil
+	}
+
+	result, err, _ := mediaGroup.Do(cacheKey, func() (interface{}, error) {
+		path, cleanup, err := s.mediaInputPath(fileStorage)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+
+		data, err := generate(path)
+		if err != nil {
+			return nil, err
+		}
+		if ttl := time.Until(fileStorage.ExpiresAt); ttl > 0 {
+			s.redis.Set(ctx, cacheKey, data, ttl)
+		}
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]byte), nil
+}
+
+// loadMediaFile looks up an audio or video file and checks its download password. It
+// writes an error response and returns false on failure.
+func (s *FileService) loadMediaFile(c *gin.Context, fileID string) (*FileStorage, bool) {
+	fileStorage, err := s.lookupFile(fileID, false)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return nil, false
+	}
+
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return nil, false
+	}
+	if !requireScanCleared(c, fileStorage) {
+		return nil, false
+	}
+
+	if !files.IsMediaFile(fileStorage.MimeType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":     "Not a media file",
+			"mime_type": fileStorage.MimeType,
+		})
+		return nil, false
+	}
+
+	return fileStorage, true
+}
+
+// mediaProcessingFailed writes the error response for a failed ffmpeg or ffprobe run
+func mediaProcessingFailed(c *gin.Context, fileID string, err error) {
+	if errors.Is(err, errMediaToolsUnavailable) {
+		respondRetryLater(c, http.StatusServiceUnavailable, errorCodeNotConfigured, retryAfterNotConfigured, gin.H{
+			"error":   "Media processing unavailable",
+			"message": "ffmpeg is not installed on this server.",
+		})
+		return
+	}
+	log.Printf("Media processing of %s failed: %v", fileID, err)
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":   "Failed to process media",
+		"message": "The file could not be decoded.",
+	})
+}
+
+// getMediaPoster serves the first frame of a video as a JPEG, at most maxPosterWidth wide
+//
+// @summary Get the poster frame of a video
+// @tags media
+// @path id File ID
+// @success 200 image/jpeg
+// @success 304
+// @auth downloadPassword adminToken optional
+func (s *FileService) getMediaPoster(c *gin.Context) {
+	fileStorage, ok := s.loadMediaFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if !strings.HasPrefix(fileStorage.MimeType, "video/") {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":     "Posters are only available for videos",
+			"mime_type": fileStorage.MimeType,
+		})
+		return
+	}
+
+	etag := fileStorage.ID + "-" + contentVersion(fileStorage) + "-poster"
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", etag))
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Trim(match, "\"") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	poster, err := s.cachedMediaResult("media:poster:"+fileStorage.ID, fileStorage, func(path string) ([]byte, error) {
+		args := append([]string{"-v", "error"}, mediaInputArgs(path)...)
+		args = append(args,
+			"-frames:v", "1",
+			"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", maxPosterWidth),
+			"-f", "image2", "-c:v", "mjpeg", "-q:v", "3",
+			"pipe:1")
+		poster, err := runMediaTool(s.config.MediaProcessTimeout, s.config.FFmpegPath, args...)
+		if err == nil && len(poster) == 0 {
+			err = fmt.Errorf("no video frame found")
+		}
+		return poster, err
+	})
+	if err != nil {
+		mediaProcessingFailed(c, fileStorage.ID, err)
+		return
+	}
+
+	c.Header("Content-Length", strconv.Itoa(len(poster)))
+	c.Data(http.StatusOK, "image/jpeg", poster)
+}
+
+// mediaInfo probes a file once and caches its media info until the file expires
+func (s *FileService) mediaInfo(fileStorage *FileStorage) (*MediaInfo, error) {
+	data, err := s.cachedMediaResult("media:info:"+fileStorage.ID, fileStorage, func(path string) ([]byte, error) {
+		info, err := s.probeMedia(path)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(info)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var info MediaInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid cached media info: %v", err)
+	}
+	return &info, nil
+}
+
+// getMediaInfo returns the duration, resolution, codecs and bitrate of an audio or video file
+//
+// @summary Describe an audio or video file
+// @tags media
+// @path id File ID
+// @success 200 json
+// @auth downloadPassword adminToken optional
+func (s *FileService) getMediaInfo(c *gin.Context) {
+	fileStorage, ok := s.loadMediaFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	info, err := s.mediaInfo(fileStorage)
+	if err != nil {
+		mediaProcessingFailed(c, fileStorage.ID, err)
+		return
+	}
+
+	response := gin.H{
+		"file_id":  fileStorage.ID,
+		"filename": fileStorage.Filename,
+		"size":     fileStorage.OriginalSize,
+		"media":    info,
+	}
+	if target := remuxTarget(fileStorage, info); target != "" && s.remuxer != nil {
+		response["remux_format"] = target
+		response["remux_url"] = "/api/media/" + fileStorage.ID + "/remux"
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, response)
+}
+
+// mediaToolsAvailable reports whether ffmpeg and ffprobe can be found
+func mediaToolsAvailable(config *Config) bool {
+	_, ffmpegErr := exec.LookPath(config.FFmpegPath)
+	_, ffprobeErr := exec.LookPath(config.FFprobePath)
+	return ffmpegErr == nil && ffprobeErr == nil
+}
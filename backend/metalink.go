@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// A Metalink (RFC 5854) describes a download to download managers: its size, its hash to
+// verify it with and every URL it can be fetched from. Managers that support it split the
+// file across the URLs with range requests and check the result, which makes large
+// downloads faster and resumable without the user copying URLs around.
+
+const metalinkContentType = "application/metalink4+xml"
+
+type metalink struct {
+	XMLName   xml.Name       `xml:"urn:ietf:params:xml:ns:metalink metalink"`
+	Generator string         `xml:"generator"`
+	Published string         `xml:"published"`
+	Files     []metalinkFile `xml:"file"`
+}
+
+type metalinkFile struct {
+	Name   string         `xml:"name,attr"`
+	Size   int64          `xml:"size"`
+	Hashes []metalinkHash `xml:"hash"`
+	URLs   []metalinkURL  `xml:"url"`
+}
+
+type metalinkHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metalinkURL struct {
+	Priority int    `xml:"priority,attr"`
+	URL      string `xml:",chardata"`
+}
+
+// publicBaseURL returns the base URL clients reach the service at
+func (s *FileService) publicBaseURL(c *gin.Context) string {
+	if s.config.PublicURL != "" {
+		return s.config.PublicURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// buildMetalink describes a file downloadable from this service and its mirrors. query is
+// added to every URL, so that protected files carry the credentials they were requested with.
+func (s *FileService) buildMetalink(c *gin.Context, file *FileStorage, query url.Values) *metalink {
+	entry := metalinkFile{Name: file.Filename, Size: file.OriginalSize}
+	if file.ContentHash != nil {
+		entry.Hashes = append(entry.Hashes, metalinkHash{Type: "sha-256", Value: *file.ContentHash})
+	}
+
+	path := "/api/file/" + url.PathEscape(file.ID)
+	if encoded := query.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	bases := append([]string{s.publicBaseURL(c)}, s.config.MirrorURLs...)
+	for i, base := range bases {
+		entry.URLs = append(entry.URLs, metalinkURL{Priority: i + 1, URL: strings.TrimSuffix(base, "/") + path})
+	}
+
+	return &metalink{
+		Generator: "ONE",
+		Published: file.UploadTime.UTC().Format(time.RFC3339),
+		Files:     []metalinkFile{entry},
+	}
+}
+
+// getMetalink serves a Metalink 4 document for a file. Files uploaded in one piece carry
+// their SHA-256; the hash of chunked uploads isn't known and is left out.
+//
+// @summary Get a Metalink 4 document of a file
+// @tags file
+// @path id File ID
+// @success 200 application/metalink4+xml
+// @auth downloadPassword adminToken optional
+func (s *FileService) getMetalink(c *gin.Context) {
+	fileStorage, err := s.lookupFile(c.Param("id"), false)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+
+	query := url.Values{}
+	if fileStorage.HasDownloadPassword {
+		for _, key := range []string{"password", "admin_token"} {
+			if value := c.Query(key); value != "" {
+				query.Set(key, value)
+			}
+		}
+	}
+
+	document, err := xml.MarshalIndent(s.buildMetalink(c, fileStorage, query), "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode metalink: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate metalink"})
+		return
+	}
+
+	c.Header("Content-Disposition", files.ContentDisposition("attachment", fileStorage.Filename+".meta4"))
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, metalinkContentType, append([]byte(xml.Header), document...))
+}
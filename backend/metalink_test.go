@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetalink(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.MirrorURLs = []string{"https://cdn.example/"}
+	ts.saveTestFile(t, "report", "hello metalink", time.Hour)
+	file, _ := ts.store.GetFile("report")
+	hash := "0f5a0e8b"
+	file.ContentHash = &hash
+	ts.store.SaveFile(file)
+
+	param := gin.Param{Key: "id", Value: "report"}
+	req := httptest.NewRequest(http.MethodGet, "http://files.example/api/file/report/meta4", nil)
+	w := ts.serve(ts.getMetalink, req, param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != metalinkContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var document metalink
+	if err := xml.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatalf("invalid metalink: %v", err)
+	}
+	if len(document.Files) != 1 {
+		t.Fatalf("got %d files", len(document.Files))
+	}
+	entry := document.Files[0]
+	if entry.Name != "report.txt" || entry.Size != int64(len("hello metalink")) {
+		t.Errorf("file = %+v", entry)
+	}
+	if len(entry.Hashes) != 1 || entry.Hashes[0].Type != "sha-256" || entry.Hashes[0].Value != hash {
+		t.Errorf("hashes = %+v", entry.Hashes)
+	}
+	want := []metalinkURL{
+		{Priority: 1, URL: "http://files.example/api/file/report"},
+		{Priority: 2, URL: "https://cdn.example/api/file/report"},
+	}
+	if len(entry.URLs) != len(want) || entry.URLs[0] != want[0] || entry.URLs[1] != want[1] {
+		t.Errorf("urls = %+v, want %+v", entry.URLs, want)
+	}
+}
+
+func TestMetalinkProtectedFile(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.PublicURL = "https://one.example"
+	ts.saveTestFile(t, "secret", "classified", time.Hour)
+	file, _ := ts.store.GetFile("secret")
+	password := "open sesame"
+	file.DownloadPassword = &password
+	file.HasDownloadPassword = true
+	ts.store.SaveFile(file)
+
+	param := gin.Param{Key: "id", Value: "secret"}
+	w := ts.serve(ts.getMetalink, httptest.NewRequest(http.MethodGet, "/api/file/secret/meta4", nil), param)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("without the password: got %d, want 401", w.Code)
+	}
+
+	w = ts.serve(ts.getMetalink, httptest.NewRequest(http.MethodGet, "/api/file/secret/meta4?password=open+sesame", nil), param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("with the password: got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "https://one.example/api/file/secret?password=open+sesame") {
+		t.Errorf("url without the password: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Usage metering records what each API key costs to serve, for operators that invoice
+// their users: the bytes it stores (sampled once an hour, so each sample is that hour's
+// byte-hours), the bytes downloaded with it and the API calls it makes. Usage is counted
+// in Redis as it happens and written to hourly records in PostgreSQL by a periodic flush,
+// which also posts each batch to the metering webhook. The database is the record of
+// truth; the webhook is best effort and not retried.
+
+const (
+	meteringStorageByteHours = "storage_byte_hours"
+	meteringEgressBytes      = "egress_bytes"
+	meteringAPICalls         = "api_calls"
+)
+
+const (
+	meteringPendingKey     = "metering_pending"
+	meteringSampledPrefix  = "metering_sampled:"
+	meteringFlushPeriod    = time.Minute
+	meteringWebhookTimeout = 10 * time.Second
+)
+
+// meteringHour returns the start of the hour that usage at t is recorded in
+func meteringHour(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// meter counts usage of an API key toward its current hourly record
+func (s *FileService) meter(keyID, metric string, quantity int64) {
+	if !s.config.MeteringEnabled || quantity <= 0 {
+		return
+	}
+	field := fmt.Sprintf("%d|%s|%s", meteringHour(s.clock.Now()).Unix(), keyID, metric)
+	if err := s.redis.HIncrBy(context.Background(), meteringPendingKey, field, quantity).Err(); err != nil {
+		log.Printf("Failed to meter %s of API key %s: %v", metric, keyID, err)
+	}
+}
+
+// parseMeteringPending turns pending counters into usage records, skipping malformed fields
+func parseMeteringPending(pending map[string]string) []UsageRecord {
+	records := make([]UsageRecord, 0, len(pending))
+	for field, value := range pending {
+		quantity, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		parts := strings.SplitN(field, "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		hour, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		records = append(records, UsageRecord{
+			Hour:     time.Unix(hour, 0).UTC(),
+			APIKeyID: parts[1],
+			Metric:   parts[2],
+			Quantity: quantity,
+		})
+	}
+	return records
+}
+
+// startMetering periodically writes metered usage to PostgreSQL
+func (s *FileService) startMetering() {
+	ticker := time.NewTicker(meteringFlushPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.flushMetering(); err != nil {
+			log.Printf("Failed to flush metered usage: %v", err)
+		}
+	}
+}
+
+// flushMetering samples the stored bytes once per hour across all instances, moves the
+// pending counters aside like flushBandwidthUsage and writes both as usage records. On
+// failure the counters are put back and the hour's sample is retaken on the next flush.
+func (s *FileService) flushMetering() error {
+	ctx := context.Background()
+	hour := meteringHour(s.clock.Now())
+
+	var records []UsageRecord
+	sampledKey := meteringSampledPrefix + strconv.FormatInt(hour.Unix(), 10)
+	sampling, err := s.redis.SetNX(ctx, sampledKey, 1, 2*time.Hour).Result()
+	if err != nil {
+		return err
+	}
+	if sampling {
+		stored, err := s.db.GetStoredBytesByAPIKey()
+		if err != nil {
+			s.redis.Del(ctx, sampledKey)
+			return err
+		}
+		for keyID, bytes := range stored {
+			records = append(records, UsageRecord{Hour: hour, APIKeyID: keyID, Metric: meteringStorageByteHours, Quantity: bytes})
+		}
+	}
+
+	flushingKey := meteringPendingKey + ":flushing:" + generateID()
+	var pending map[string]string
+	if err := s.redis.Rename(ctx, meteringPendingKey, flushingKey).Err(); err != nil {
+		if !strings.Contains(err.Error(), "no such key") {
+			if sampling {
+				s.redis.Del(ctx, sampledKey)
+			}
+			return err
+		}
+	} else {
+		defer s.redis.Del(ctx, flushingKey)
+		if pending, err = s.redis.HGetAll(ctx, flushingKey).Result(); err != nil {
+			return err
+		}
+		records = append(records, parseMeteringPending(pending)...)
+	}
+
+	if err := s.db.AddUsageRecords(records); err != nil {
+		if sampling {
+			s.redis.Del(ctx, sampledKey)
+		}
+		pipe := s.redis.Pipeline()
+		for field, value := range pending {
+			if quantity, parseErr := strconv.ParseInt(value, 10, 64); parseErr == nil {
+				pipe.HIncrBy(ctx, meteringPendingKey, field, quantity)
+			}
+		}
+		if _, restoreErr := pipe.Exec(ctx); restoreErr != nil {
+			log.Printf("Failed to restore pending metering counters: %v", restoreErr)
+		}
+		return err
+	}
+
+	if s.config.MeteringWebhookURL != "" && len(records) > 0 {
+		if err := s.sendMeteringWebhook(records); err != nil {
+			log.Printf("Failed to send %d usage records to the metering webhook: %v", len(records), err)
+		}
+	}
+	return nil
+}
+
+// signMeteringPayload returns the X-Metering-Signature of a webhook body
+func signMeteringPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendMeteringWebhook posts a batch of usage records to the metering webhook
+func (s *FileService) sendMeteringWebhook(records []UsageRecord) error {
+	body, err := json.Marshal(gin.H{"records": records})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), meteringWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.MeteringWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.MeteringWebhookSecret != "" {
+		req.Header.Set("X-Metering-Signature", signMeteringPayload(s.config.MeteringWebhookSecret, body))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+type MeteringReportRequest struct {
+	Period  string `json:"period,omitempty"`   // "YYYY-MM", defaults to the current month
+	GroupBy string `json:"group_by,omitempty"` // "key" (default) or "org"
+}
+
+// getMeteringReport returns a month's metered usage per API key or per org. Usage reaches
+// the database within a minute of happening.
+//
+// @summary Get metered usage
+// @tags admin
+// @body json MeteringReportRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getMeteringReport(c *gin.Context) {
+	var req MeteringReportRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Period == "" {
+		req.Period = egressPeriod(s.clock.Now())
+	}
+	period, err := time.Parse("2006-01", req.Period)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must use YYYY-MM format"})
+		return
+	}
+	switch req.GroupBy {
+	case "":
+		req.GroupBy = "key"
+	case "key", "org":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be key or org"})
+		return
+	}
+
+	rollups, err := s.db.GetUsageRollup(period, req.GroupBy)
+	if err != nil {
+		log.Printf("Failed to get usage rollup: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":           req.Period,
+		"group_by":         req.GroupBy,
+		"metering_enabled": s.config.MeteringEnabled,
+		"accounts":         rollups,
+	})
+}
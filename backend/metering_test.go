@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMeteringPending(t *testing.T) {
+	hour := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	records := parseMeteringPending(map[string]string{
+		"1714568400|key-1|api_calls":    "3",
+		"1714568400|key-1|egress_bytes": "2048",
+		"not-a-field":                   "1",
+		"1714568400|key-2|api_calls":    "lots",
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].Metric < records[j].Metric })
+
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(records), records)
+	}
+	if r := records[0]; !r.Hour.Equal(hour) || r.APIKeyID != "key-1" || r.Metric != meteringAPICalls || r.Quantity != 3 {
+		t.Errorf("api calls record = %+v", r)
+	}
+	if r := records[1]; r.Metric != meteringEgressBytes || r.Quantity != 2048 {
+		t.Errorf("egress record = %+v", r)
+	}
+}
+
+func TestFlushMetering(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.MeteringEnabled = true
+
+	keyID := "key-1"
+	ts.saveTestFile(t, "stored", "0123456789", 24*time.Hour)
+	file, _ := ts.store.GetFile("stored")
+	file.APIKeyID = &keyID
+	ts.store.SaveFile(file)
+
+	ts.meter(keyID, meteringAPICalls, 1)
+	ts.meter(keyID, meteringAPICalls, 1)
+	ts.meter(keyID, meteringEgressBytes, 500)
+	if err := ts.flushMetering(); err != nil {
+		t.Fatal(err)
+	}
+
+	totals := map[string]int64{}
+	for _, record := range ts.store.usage {
+		if record.APIKeyID != keyID || !record.Hour.Equal(meteringHour(ts.clock.Now())) {
+			t.Errorf("unexpected record %+v", record)
+		}
+		totals[record.Metric] += record.Quantity
+	}
+	if totals[meteringAPICalls] != 2 || totals[meteringEgressBytes] != 500 || totals[meteringStorageByteHours] != 10 {
+		t.Errorf("metered totals = %v", totals)
+	}
+
+	// Storage is sampled once per hour, however often the counters are flushed
+	ts.store.usage = nil
+	ts.meter(keyID, meteringAPICalls, 1)
+	if err := ts.flushMetering(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.store.usage) != 1 || ts.store.usage[0].Metric != meteringAPICalls {
+		t.Errorf("second flush in the hour recorded %+v", ts.store.usage)
+	}
+
+	ts.store.usage = nil
+	ts.clock.Advance(time.Hour)
+	if err := ts.flushMetering(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.store.usage) != 1 || ts.store.usage[0].Metric != meteringStorageByteHours {
+		t.Errorf("flush in the next hour recorded %+v", ts.store.usage)
+	}
+}
+
+func TestMeteringDisabled(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.MeteringEnabled = false
+	ts.meter("key-1", meteringAPICalls, 1)
+	if fields, _ := ts.redis.HGetAll(context.Background(), meteringPendingKey).Result(); len(fields) != 0 {
+		t.Errorf("usage metered while disabled: %v", fields)
+	}
+}
+
+func TestMeteringWebhook(t *testing.T) {
+	var body []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Metering-Signature")
+	}))
+	defer server.Close()
+
+	ts := newTestService(t)
+	ts.config.MeteringWebhookURL = server.URL
+	ts.config.MeteringWebhookSecret = "hook-secret"
+
+	records := []UsageRecord{{Hour: meteringHour(ts.clock.Now()), APIKeyID: "key-1", Metric: meteringAPICalls, Quantity: 7}}
+	if err := ts.sendMeteringWebhook(records); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"api_key_id":"key-1"`) || !strings.Contains(string(body), `"quantity":7`) {
+		t.Errorf("webhook body = %s", body)
+	}
+	if signature != signMeteringPayload("hook-secret", body) {
+		t.Errorf("signature %q doesn't match the body", signature)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	ts.config.MeteringWebhookURL = failing.URL
+	if err := ts.sendMeteringWebhook(records); err == nil {
+		t.Error("a failing webhook reported success")
+	}
+}
+
+func TestCleanupUsage(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.UsageRetention = 10 * 24 * time.Hour
+	ts.config.UsageIPRetention = 24 * time.Hour
+
+	period := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts.store.AddBandwidthUsage([]BandwidthUsage{
+		{Period: period, SubjectType: "file", SubjectID: "f1", Bytes: 100},
+		{Period: period, SubjectType: "key", SubjectID: "k1", Bytes: 100},
+		{Period: period, SubjectType: "ip", SubjectID: "192.0.2.1", Bytes: 10},
+	})
+	ts.store.AddUsageRecords([]UsageRecord{{Hour: meteringHour(ts.clock.Now()), APIKeyID: "k1", Metric: meteringAPICalls, Quantity: 1}})
+
+	subjects := func(subjectType string) []string {
+		var ids []string
+		for _, usage := range ts.store.bandwidth {
+			if usage.SubjectType == subjectType {
+				ids = append(ids, usage.SubjectID)
+			}
+		}
+		return ids
+	}
+
+	// Two days later only the client IP is past its retention
+	ts.clock.Advance(48 * time.Hour)
+	ts.cleanupUsage()
+	if ips := subjects("ip"); len(ips) != 1 || ips[0] != "" {
+		t.Errorf("IP bandwidth after its retention: %q", ips)
+	}
+	if keys := subjects("key"); len(keys) != 1 || keys[0] != "k1" {
+		t.Errorf("key bandwidth before its retention: %q", keys)
+	}
+	if len(ts.store.usage) != 1 {
+		t.Errorf("usage records before their retention: %+v", ts.store.usage)
+	}
+
+	ts.clock.Advance(10 * 24 * time.Hour)
+	ts.cleanupUsage()
+	if files, keys := subjects("file"), subjects("key"); len(files) != 0 || len(keys) != 1 || keys[0] != "" {
+		t.Errorf("after the usage retention: files %q, keys %q", files, keys)
+	}
+	if len(ts.store.usage) != 0 {
+		t.Errorf("usage records after their retention: %+v", ts.store.usage)
+	}
+	// The bytes served still count toward the statistics
+	if stats, _ := ts.store.GetServiceStats(); stats.BytesServed != 110 {
+		t.Errorf("bytes served = %d, want 110", stats.BytesServed)
+	}
+}
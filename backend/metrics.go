@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SLI metrics count user-facing requests per endpoint class as good or bad, so operators
+// can alert on the error budget burn rate instead of raw error counts. A request is bad
+// when the service failed it (5xx); client errors, quota rejections and unknown files
+// don't spend the error budget. Counters are per process and exposed in the Prometheus
+// text format at /metrics.
+
+// Endpoint classes with their own availability SLI
+const (
+	sliClassUpload   = "upload"
+	sliClassDownload = "download"
+	sliClassPreview  = "preview"
+	sliClassAPI      = "api"
+	sliClassAdmin    = "admin"
+)
+
+var sliClasses = []string{sliClassUpload, sliClassDownload, sliClassPreview, sliClassAPI, sliClassAdmin}
+
+// sliBurnRateAlerts are the multiwindow burn-rate alerts recommended in the Google SRE
+// workbook for a 30-day error budget: the budget share spent in the long window that
+// warrants the alert, confirmed by the short window
+var sliBurnRateAlerts = []struct {
+	severity, longWindow, shortWindow string
+	burnRate                          float64
+}{
+	{"page", "1h", "5m", 14.4},
+	{"page", "6h", "30m", 6},
+	{"ticket", "1d", "2h", 3},
+	{"ticket", "3d", "6h", 1},
+}
+
+type sliKey struct {
+	class, outcome string
+}
+
+// SLIMetrics holds the SLI counters of this process
+type SLIMetrics struct {
+	mu       sync.Mutex
+	requests map[sliKey]uint64
+	jobs     map[string]uint64
+}
+
+var sliMetrics = &SLIMetrics{
+	requests: make(map[sliKey]uint64),
+	jobs:     make(map[string]uint64),
+}
+
+// recordRequest counts a finished request of an endpoint class
+func (m *SLIMetrics) recordRequest(class string, status int) {
+	outcome := "good"
+	if status >= http.StatusInternalServerError {
+		outcome = "bad"
+	}
+	m.mu.Lock()
+	m.requests[sliKey{class, outcome}]++
+	m.mu.Unlock()
+}
+
+// recordJob counts a chunked upload processing job that completed ("good") or was given
+// up on after its retries ("bad"). Jobs failed by the client, such as a hash mismatch,
+// aren't counted.
+func (m *SLIMetrics) recordJob(outcome string) {
+	m.mu.Lock()
+	m.jobs[outcome]++
+	m.mu.Unlock()
+}
+
+// sliClass returns the endpoint class of a route, or "" for routes without an SLI such
+// as health checks, speed tests and static files
+func sliClass(method, route string) string {
+	switch {
+	case route == "":
+		return ""
+	case strings.HasPrefix(route, "/api/admin/"):
+		return sliClassAdmin
+	case strings.HasPrefix(route, "/api/upload"), route == "/api/append", route == "/api/file/:id/finalize",
+		method == http.MethodPatch && route == "/api/file/:id",
+		method == http.MethodPost && strings.HasPrefix(route, "/api/chunk/"):
+		return sliClassUpload
+	case method == http.MethodGet && route == "/api/file/:id", route == "/api/file/:id/tail",
+		strings.HasPrefix(route, "/api/stream/"), route == "/api/zip/:id/extract", route == "/s/:code":
+		return sliClassDownload
+	case strings.HasPrefix(route, "/api/preview/"), strings.HasPrefix(route, "/api/zip/"),
+		strings.HasPrefix(route, "/api/notebook/"), strings.HasPrefix(route, "/api/geojson/"),
+		strings.HasPrefix(route, "/api/media/"):
+		return sliClassPreview
+	case strings.HasPrefix(route, "/api/speedtest/"):
+		return ""
+	case strings.HasPrefix(route, "/api/"):
+		return sliClassAPI
+	}
+	return ""
+}
+
+// sliMiddleware counts every request of a route with an SLI once it has been handled
+func sliMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if class := sliClass(c.Request.Method, c.FullPath()); class != "" {
+			sliMetrics.recordRequest(class, c.Writer.Status())
+		}
+	}
+}
+
+// serveMetrics writes the SLI counters, the configured objective and the recommended
+// burn-rate recording rules and alerts in the Prometheus text format
+func (s *FileService) serveMetrics(c *gin.Context) {
+	var b strings.Builder
+
+	sliMetrics.mu.Lock()
+	b.WriteString("# HELP one_sli_requests_total Requests per endpoint class; outcome=\"bad\" when the service failed the request (5xx).\n")
+	b.WriteString("# TYPE one_sli_requests_total counter\n")
+	for _, class := range sliClasses {
+		for _, outcome := range []string{"good", "bad"} {
+			fmt.Fprintf(&b, "one_sli_requests_total{class=%q,outcome=%q} %d\n", class, outcome, sliMetrics.requests[sliKey{class, outcome}])
+		}
+	}
+	b.WriteString("# HELP one_sli_processing_jobs_total Chunked upload processing jobs; outcome=\"bad\" when moved to the dead letter.\n")
+	b.WriteString("# TYPE one_sli_processing_jobs_total counter\n")
+	for _, outcome := range []string{"good", "bad"} {
+		fmt.Fprintf(&b, "one_sli_processing_jobs_total{outcome=%q} %d\n", outcome, sliMetrics.jobs[outcome])
+	}
+	sliMetrics.mu.Unlock()
+
+	b.WriteString("# HELP one_slo_objective Availability objective of each endpoint class over 30 days.\n")
+	b.WriteString("# TYPE one_slo_objective gauge\n")
+	for _, class := range sliClasses {
+		fmt.Fprintf(&b, "one_slo_objective{class=%q} %g\n", class, s.config.SLOAvailabilityTarget)
+	}
+
+	// Recording rules for the error ratio over each window used by the alerts below
+	windows := make(map[string]bool)
+	for _, alert := range sliBurnRateAlerts {
+		windows[alert.longWindow] = true
+		windows[alert.shortWindow] = true
+	}
+	sortedWindows := make([]string, 0, len(windows))
+	for window := range windows {
+		sortedWindows = append(sortedWindows, window)
+	}
+	sort.Strings(sortedWindows)
+
+	b.WriteString("# HELP one_slo_recording_rule Suggested recording rules: record the expr label under the record label.\n")
+	b.WriteString("# TYPE one_slo_recording_rule gauge\n")
+	for _, window := range sortedWindows {
+		expr := fmt.Sprintf(`sum by (class) (rate(one_sli_requests_total{outcome="bad"}[%s])) / sum by (class) (rate(one_sli_requests_total[%s]))`, window, window)
+		fmt.Fprintf(&b, "one_slo_recording_rule{record=%q,window=%q,expr=%q} 1\n", "class:one_sli_error_ratio:rate"+window, window, expr)
+	}
+
+	b.WriteString("# HELP one_slo_burn_rate_alert Suggested multiwindow burn-rate alerts: fire when both windows' error ratio exceed the value, the burn rate times (1 - objective).\n")
+	b.WriteString("# TYPE one_slo_burn_rate_alert gauge\n")
+	errorBudget := 1 - s.config.SLOAvailabilityTarget
+	for _, alert := range sliBurnRateAlerts {
+		fmt.Fprintf(&b, "one_slo_burn_rate_alert{severity=%q,long_window=%q,short_window=%q,burn_rate=\"%g\"} %.6g\n",
+			alert.severity, alert.longWindow, alert.shortWindow, alert.burnRate, alert.burnRate*errorBudget)
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// serveWorkerMetrics exposes /metrics from a dedicated --worker process, which has no
+// HTTP server otherwise, so its processing job counters can be scraped too
+func (s *FileService) serveWorkerMetrics() {
+	router := gin.New()
+	router.GET("/metrics", s.serveMetrics)
+	if err := http.ListenAndServe(s.config.WorkerMetricsAddr, router); err != nil {
+		log.Printf("Worker metrics server stopped: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
@@ -57,12 +58,18 @@ func requestLoggingMiddleware() gin.HandlerFunc {
 	}
 }
 
+// corsExposedHeaders lets cross-origin players and fetch() read how a range request was
+// answered, and how long to back off when told to come back later
+const corsExposedHeaders = "Accept-Ranges, Content-Range, Content-Length, ETag, " +
+	"Retry-After, " + errorCodeHeader + ", X-RateLimit-Limit, X-RateLimit-Remaining"
+
 // corsMiddleware adds CORS headers for browser compatibility
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Content-SHA256, X-Delete-Password, Range, If-Range")
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
 		c.Header("Access-Control-Max-Age", "3600")
 
 		if c.Request.Method == "OPTIONS" {
@@ -74,79 +81,141 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-// rateLimitMiddleware implements basic rate limiting
-func rateLimitMiddleware(_ *Config) gin.HandlerFunc {
-	type clientInfo struct {
-		lastRequest time.Time
-		requests    int
-	}
+// ipRateLimitWindow is how long after a client's last admitted request its count restarts
+const ipRateLimitWindow = time.Minute
+
+// ipRateLimiter counts the requests of each anonymous client. A client's count restarts
+// once a minute has passed since its last admitted request.
+type ipRateLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*ipRateLimitClient
+}
 
-	clients := make(map[string]*clientInfo)
-	var mu sync.RWMutex
+type ipRateLimitClient struct {
+	lastRequest time.Time
+	requests    int
+}
+
+// newIPRateLimiter returns a limiter that forgets idle clients every minute
+func newIPRateLimiter() *ipRateLimiter {
+	limiter := &ipRateLimiter{clients: make(map[string]*ipRateLimitClient)}
 
-	// Cleanup old entries every minute
 	go func() {
 		ticker := time.NewTicker(time.Minute)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			mu.Lock()
+			limiter.mu.Lock()
 			now := time.Now()
-			for ip, client := range clients {
-				if now.Sub(client.lastRequest) > time.Minute {
-					delete(clients, ip)
+			for ip, client := range limiter.clients {
+				if now.Sub(client.lastRequest) > ipRateLimitWindow {
+					delete(limiter.clients, ip)
 				}
 			}
-			mu.Unlock()
+			limiter.mu.Unlock()
 		}
 	}()
+	return limiter
+}
 
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		now := time.Now()
+// allow counts a request of the client against limit, reporting false when its budget
+// for the window is spent
+func (l *ipRateLimiter) allow(key string, limit int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-		// Skip rate limiting for streaming endpoints to allow unlimited concurrent streams
-		if strings.HasPrefix(c.Request.URL.Path, "/api/stream/") {
-			c.Next()
-			return
-		}
+	client, exists := l.clients[key]
+	if !exists || now.Sub(client.lastRequest) > ipRateLimitWindow {
+		l.clients[key] = &ipRateLimitClient{lastRequest: now, requests: 1}
+		return true
+	}
+	if client.requests >= limit {
+		return false
+	}
+	client.requests++
+	client.lastRequest = now
+	return true
+}
 
-		mu.Lock()
-		defer mu.Unlock()
+// usage returns how many requests the client made in its current window and when the
+// count restarts if it makes no more
+func (l *ipRateLimiter) usage(key string, now time.Time) (int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-		client, exists := clients[ip]
-		if !exists {
-			clients[ip] = &clientInfo{
-				lastRequest: now,
-				requests:    1,
-			}
+	client, exists := l.clients[key]
+	if !exists || now.Sub(client.lastRequest) > ipRateLimitWindow {
+		return 0, now.Add(ipRateLimitWindow)
+	}
+	return client.requests, client.lastRequest.Add(ipRateLimitWindow)
+}
+
+// ipRateLimit is how many requests per minute an anonymous client may make (increased
+// for better concurrent support)
+const ipRateLimit = 200
+
+// ipRateLimitBucket returns the limiter key of an anonymous request and how many
+// requests per minute it gets
+func ipRateLimitBucket(c *gin.Context, config *Config) (string, int) {
+	key, limit := c.ClientIP(), ipRateLimit
+
+	// Speed tests transfer large payloads, so they get their own smaller budget per IP
+	if strings.HasPrefix(c.Request.URL.Path, "/api/speedtest/") {
+		key = "speedtest:" + key
+		limit = config.SpeedTestRateLimit
+	}
+
+	// Clients with a high abuse score get a quarter of the budget
+	if c.GetBool(abuseThrottledContextKey) {
+		limit /= 4
+	}
+	return key, limit
+}
+
+// rateLimitMiddleware implements basic rate limiting
+func rateLimitMiddleware(config *Config, limiter *ipRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Skip rate limiting for streaming endpoints to allow unlimited concurrent streams
+		if strings.HasPrefix(c.Request.URL.Path, "/api/stream/") {
 			c.Next()
 			return
 		}
 
-		// Reset counter if more than a minute has passed
-		if now.Sub(client.lastRequest) > time.Minute {
-			client.requests = 1
-			client.lastRequest = now
+		// Requests authenticated with an API key are limited per key instead of per IP
+		if apiKeyFromContext(c) != nil {
 			c.Next()
 			return
 		}
 
-		// Rate limit: 200 requests per minute per IP (increased for better concurrent support)
-		if client.requests >= 200 {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded. Please try again later.",
-			})
-			c.Abort()
+		key, limit := ipRateLimitBucket(c, config)
+		if err := limiter.admit(key, limit); err != nil {
+			err.respond(c)
 			return
 		}
-
-		client.requests++
-		client.lastRequest = now
 		c.Next()
 	}
 }
 
+// admit counts a request of the client against limit, refusing it with 429 once its
+// budget for the window is spent
+func (l *ipRateLimiter) admit(key string, limit int) *apiError {
+	now := time.Now()
+	if l.allow(key, limit, now) {
+		return nil
+	}
+	_, resetsAt := l.usage(key, now)
+	return retryLaterError(http.StatusTooManyRequests, errorCodeRateLimited, resetsAt.Sub(now), gin.H{
+		"error": "Rate limit exceeded. Please try again later.",
+	})
+}
+
+// isBodyTooLarge reports whether a request body read failed because it exceeded the
+// limit of an http.MaxBytesReader, as opposed to the client disconnecting
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
 // timeoutMiddleware adds request timeout
 func timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.SpeedTestRateLimit = 2
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		// Requests with this header stand in for ones authenticated with an API key
+		if c.GetHeader("X-Test-Key") != "" {
+			c.Set(apiKeyContextKey, &APIKeyStorage{ID: "key-1"})
+		}
+		c.Next()
+	})
+	router.Use(rateLimitMiddleware(ts.config, ts.rateLimiter))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/api/limits", ok)
+	router.GET("/api/speedtest/download", ok)
+	router.GET("/api/stream/:id", ok)
+	request := func(path, remoteAddr string, withKey bool) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if withKey {
+			req.Header.Set("X-Test-Key", "1")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < ipRateLimit; i++ {
+		if code := request("/api/limits", "192.0.2.1:1000", false); code != http.StatusNoContent {
+			t.Fatalf("request %d: got %d", i+1, code)
+		}
+	}
+	if code := request("/api/limits", "192.0.2.1:1000", false); code != http.StatusTooManyRequests {
+		t.Errorf("over the per-IP limit: got %d, want 429", code)
+	}
+	if code := request("/api/limits", "192.0.2.2:1000", false); code != http.StatusNoContent {
+		t.Errorf("another client: got %d", code)
+	}
+	// Streams are exempt, and API keys are limited per key instead
+	if code := request("/api/stream/abc", "192.0.2.1:1000", false); code != http.StatusNoContent {
+		t.Errorf("stream: got %d", code)
+	}
+	if code := request("/api/limits", "192.0.2.1:1000", true); code != http.StatusNoContent {
+		t.Errorf("API key request: got %d", code)
+	}
+
+	// Speed tests have their own, smaller budget
+	for i := 0; i < 2; i++ {
+		if code := request("/api/speedtest/download", "192.0.2.1:1000", false); code != http.StatusNoContent {
+			t.Fatalf("speed test %d: got %d", i+1, code)
+		}
+	}
+	if code := request("/api/speedtest/download", "192.0.2.1:1000", false); code != http.StatusTooManyRequests {
+		t.Errorf("over the speed test limit: got %d, want 429", code)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// Uploads are typed by their extension, so a file named wrongly, or uploaded before a
+// type was known, can be previewed as something it isn't. The MIME check reads the
+// leading bytes of stored files, reports those whose content contradicts their type and,
+// when asked to, corrects the type to the sniffed one. Admins run it in batches over the
+// active files, oldest first, passing back next_offset until done.
+
+// MimeCheckRequest checks a batch of files. With FileIDs only those files are checked;
+// otherwise Limit files from Offset.
+type MimeCheckRequest struct {
+	FileIDs []string `json:"file_ids,omitempty"`
+	Offset  int      `json:"offset,omitempty"`
+	Limit   int      `json:"limit,omitempty"`
+	Apply   bool     `json:"apply,omitempty"` // Correct the mismatches found
+}
+
+// MimeMismatch is a file whose content contradicts its MIME type
+type MimeMismatch struct {
+	FileID      string `json:"file_id"`
+	Filename    string `json:"filename"`
+	MimeType    string `json:"mime_type"`
+	SniffedType string `json:"sniffed_type"`
+	Corrected   bool   `json:"corrected"`
+}
+
+// getMimeStats counts the active files and their bytes per MIME type
+//
+// @summary Count files per MIME type
+// @tags admin
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getMimeStats(c *gin.Context) {
+	stats, err := s.db.GetMimeTypeStats()
+	if err != nil {
+		log.Printf("Failed to count MIME types: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"types": stats})
+}
+
+// checkMimeTypes sniffs a batch of files and reports, and optionally corrects, the
+// types their content contradicts
+//
+// @summary Check the MIME types of files against their content
+// @tags admin
+// @body json MimeCheckRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) checkMimeTypes(c *gin.Context) {
+	var req MimeCheckRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must not be negative"})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 1000 {
+		req.Limit = 100
+	}
+
+	var batch []*FileStorage
+	var total int
+	if len(req.FileIDs) > 0 {
+		if len(req.FileIDs) > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At most 1000 file_ids can be checked at once"})
+			return
+		}
+		for _, fileID := range req.FileIDs {
+			file, err := s.db.GetFileMetadata(fileID)
+			if err != nil {
+				log.Printf("Failed to get file metadata: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if file != nil {
+				batch = append(batch, file)
+			}
+		}
+	} else {
+		var err error
+		batch, total, err = s.db.ListActiveFiles(FileListQuery{
+			SortBy:    "uploaded_at",
+			Ascending: true,
+			Limit:     req.Limit,
+			Offset:    req.Offset,
+		})
+		if err != nil {
+			log.Printf("Failed to list files: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	mismatches := make([]MimeMismatch, 0)
+	unreadable := 0
+	for _, file := range batch {
+		sniffed, err := s.sniffStoredFile(file)
+		if err != nil {
+			log.Printf("MIME check could not read %s: %v", file.ID, err)
+			unreadable++
+			continue
+		}
+		if !files.MimeMismatch(file.MimeType, sniffed) {
+			continue
+		}
+
+		mismatch := MimeMismatch{FileID: file.ID, Filename: file.Filename, MimeType: file.MimeType, SniffedType: sniffed}
+		if req.Apply {
+			if err := s.db.UpdateFileMimeType(file.ID, sniffed); err != nil {
+				log.Printf("Failed to correct the MIME type of %s: %v", file.ID, err)
+			} else {
+				mismatch.Corrected = true
+				s.redis.Del(context.Background(), "file:"+file.ID)
+				s.recordFileEvent(file.ID, FileEventMimeCorrected, gin.H{"from": file.MimeType, "to": sniffed}, c.ClientIP())
+			}
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+
+	response := gin.H{
+		"checked":    len(batch) - unreadable,
+		"unreadable": unreadable,
+		"mismatches": mismatches,
+	}
+	if len(req.FileIDs) == 0 {
+		response["total"] = total
+		response["next_offset"] = req.Offset + len(batch)
+		response["done"] = req.Offset+len(batch) >= total
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// sniffStoredFile sniffs the type of a file from its leading bytes
+func (s *FileService) sniffStoredFile(file *FileStorage) (string, error) {
+	reader, err := s.openTextContent(file)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	head := make([]byte, files.SniffLength)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return files.SniffMimeType(head[:n]), nil
+}
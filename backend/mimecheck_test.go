@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMimeCheck(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.AdminPassword = "secret"
+	saveTyped := func(id, filename, mimeType, content string) {
+		ts.saveTestFile(t, id, content, time.Hour)
+		file, _ := ts.store.GetFile(id)
+		file.Filename = filename
+		file.MimeType = mimeType
+		ts.store.SaveFile(file)
+		ts.clock.Advance(time.Minute)
+	}
+	saveTyped("notes", "notes.txt", "text/plain", "plain words")
+	saveTyped("photo", "photo.jpg", "image/jpeg", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	saveTyped("report", "report", "application/octet-stream", "%PDF-1.7\n")
+
+	check := func(body string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/mime/check", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := ts.serve(ts.checkMimeTypes, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("check: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	sniffed := func(resp map[string]interface{}) []string {
+		var found []string
+		for _, m := range resp["mismatches"].([]interface{}) {
+			mismatch := m.(map[string]interface{})
+			found = append(found, mismatch["file_id"].(string)+"="+mismatch["sniffed_type"].(string))
+		}
+		return found
+	}
+
+	resp := check(`{"limit":2}`)
+	if got := strings.Join(sniffed(resp), ","); got != "photo=image/png" || resp["next_offset"] != 2.0 || resp["done"] != false {
+		t.Errorf("first batch: %v, next_offset %v, done %v", got, resp["next_offset"], resp["done"])
+	}
+	resp = check(`{"offset":2}`)
+	if got := strings.Join(sniffed(resp), ","); got != "report=application/pdf" || resp["done"] != true {
+		t.Errorf("second batch: %v, done %v", got, resp["done"])
+	}
+	if file, _ := ts.store.GetFile("photo"); file.MimeType != "image/jpeg" {
+		t.Errorf("report-only check changed the type to %s", file.MimeType)
+	}
+
+	check(`{"file_ids":["photo"],"apply":true}`)
+	if file, _ := ts.store.GetFile("photo"); file.MimeType != "image/png" {
+		t.Errorf("corrected type = %s, want image/png", file.MimeType)
+	}
+	if file, _ := ts.store.GetFile("report"); file.MimeType != "application/octet-stream" {
+		t.Errorf("file outside file_ids corrected to %s", file.MimeType)
+	}
+	if len(ts.store.events) != 1 || ts.store.events[0].Type != FileEventMimeCorrected {
+		t.Errorf("events = %+v", ts.store.events)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/mime/stats", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(ts.getMimeStats, req)
+	var stats struct {
+		Types []MimeTypeStats `json:"types"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if len(stats.Types) != 3 || stats.Types[0].Files != 1 {
+		t.Errorf("stats = %+v", stats.Types)
+	}
+}
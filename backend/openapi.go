@@ -0,0 +1,57 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:generate go run ./cmd/openapi
+
+// openAPISpec is the OpenAPI description of the API, generated by cmd/openapi from the
+// router setup and the annotations of the handlers. TestOpenAPISpecUpToDate fails when
+// it no longer matches them.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// getOpenAPISpec serves the OpenAPI description of the API
+//
+// @summary Get the OpenAPI description of the API
+// @tags server
+// @success 200 json
+func (s *FileService) getOpenAPISpec(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+// apiDocsPage renders the description with the vendored Swagger UI
+const apiDocsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>ONE API</title>
+<link rel="stylesheet" href="/vendor/swagger-ui/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="/vendor/swagger-ui/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui", deepLinking: true});
+</script>
+</body>
+</html>
+`
+
+// serveAPIDocs serves interactive documentation of the API. Requests tried from it are
+// sent to this server with the credentials entered under Authorize.
+//
+// @summary Browse the API documentation
+// @tags server
+// @success 200 text/html
+func (s *FileService) serveAPIDocs(c *gin.Context) {
+	c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(apiDocsPage))
+}
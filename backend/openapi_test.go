@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"file-storage-service/internal/openapi"
+)
+
+func TestOpenAPISpecUpToDate(t *testing.T) {
+	doc, err := openapi.Generate(os.DirFS("."), ".", "setupRouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := doc.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(spec, openAPISpec) {
+		t.Error("openapi.json is out of date; run go generate")
+	}
+
+	client, err := openapi.GenerateClient(doc, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := os.ReadFile("client/client_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(client, generated) {
+		t.Error("client/client_gen.go is out of date; run go generate")
+	}
+}
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	ts := newTestService(t)
+	var doc openapi.Document
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range setupRouter(ts.FileService).Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") {
+			continue
+		}
+		path := route.Path
+		for _, segment := range strings.Split(path, "/") {
+			if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+				path = strings.Replace(path, segment, "{"+segment[1:]+"}", 1)
+			}
+		}
+		item := doc.Paths[path]
+		if item == nil || item.Operations()[strings.ToLower(route.Method)] == nil {
+			t.Errorf("%s %s is missing from the OpenAPI description", route.Method, route.Path)
+		}
+	}
+}
+
+func TestServeOpenAPISpec(t *testing.T) {
+	ts := newTestService(t)
+
+	w := ts.serve(ts.getOpenAPISpec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Paths["/api/upload"] == nil || doc.Paths["/api/upload"].Post.Summary == "" {
+		t.Error("the description lacks POST /api/upload")
+	}
+
+	w = ts.serve(ts.serveAPIDocs, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `url: "/api/openapi.json"`) {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// Org policies let an organization tighten the server's upload rules for its members: a
+// shorter retention for their files, a required download password and extra blocked
+// file types. They apply to uploads made with a member API key and never loosen the
+// server-wide configuration. A policy can also set how members' collections handle
+// duplicate filenames.
+
+// normalize validates the policy and puts its extensions in the form they are matched in
+func (p *OrgPolicy) normalize() error {
+	if p.MaxRetentionHours < 0 {
+		return fmt.Errorf("policy max_retention_hours must not be negative")
+	}
+	extensions := make([]string, 0, len(p.BlockedExtensions))
+	for _, extension := range p.BlockedExtensions {
+		extension = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(extension), "."))
+		if extension == "" {
+			continue
+		}
+		if strings.ContainsAny(extension, "/\\") {
+			return fmt.Errorf("policy blocked extension %q is invalid", extension)
+		}
+		extensions = append(extensions, extension)
+	}
+	p.BlockedExtensions = extensions
+
+	if p.NameConflict != "" {
+		policy, err := files.ParseCollisionPolicy(p.NameConflict, "")
+		if err != nil {
+			return fmt.Errorf("policy name_conflict: %v", err)
+		}
+		p.NameConflict = string(policy)
+	}
+	return nil
+}
+
+// retention returns how long a member's file is kept when the server keeps files for
+// serverRetention
+func (p *OrgPolicy) retention(serverRetention time.Duration) time.Duration {
+	if p.MaxRetentionHours <= 0 {
+		return serverRetention
+	}
+	if limit := time.Duration(p.MaxRetentionHours) * time.Hour; limit < serverRetention {
+		return limit
+	}
+	return serverRetention
+}
+
+// orgPolicyFor returns the policy of the org an API key belongs to, nil for keys outside
+// an org
+func (s *FileService) orgPolicyFor(key *APIKeyStorage) (*OrgPolicy, error) {
+	if key == nil || key.OrgID == nil {
+		return nil, nil
+	}
+	org, err := s.db.GetOrg(*key.OrgID)
+	if err != nil || org == nil {
+		return nil, err
+	}
+	return &org.Policy, nil
+}
+
+// checkOrgPolicy rejects uploads by org members that break their org's policy, writing
+// the error response and returning false
+func (s *FileService) checkOrgPolicy(c *gin.Context, filename string, hasDownloadPassword bool) bool {
+	if err := s.orgPolicyError(apiKeyFromContext(c), filename, hasDownloadPassword); err != nil {
+		err.respond(c)
+		return false
+	}
+	return true
+}
+
+// orgPolicyError refuses an upload with an API key that breaks the policy of its org
+func (s *FileService) orgPolicyError(key *APIKeyStorage, filename string, hasDownloadPassword bool) *apiError {
+	policy, err := s.orgPolicyFor(key)
+	if err != nil {
+		log.Printf("Failed to get org policy: %v", err)
+		return newAPIError(http.StatusInternalServerError, "Failed to check upload policy")
+	}
+	if policy == nil {
+		return nil
+	}
+
+	for _, extension := range policy.BlockedExtensions {
+		if matchesExtension(filename, extension) {
+			return &apiError{status: http.StatusUnsupportedMediaType, body: gin.H{
+				"error":              "File type not allowed",
+				"message":            "Your organization doesn't allow uploading files with this extension.",
+				"blocked_extensions": policy.BlockedExtensions,
+			}}
+		}
+	}
+	if policy.RequireDownloadPassword && !hasDownloadPassword {
+		return &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error":   "Download password required",
+			"message": "Your organization requires a download_password on every upload.",
+		}}
+	}
+	return nil
+}
+
+// retentionFor returns how long a file uploaded with an API key is kept: the server's
+// retention, shortened by the policy of the key's org
+func (s *FileService) retentionFor(key *APIKeyStorage) time.Duration {
+	policy, err := s.orgPolicyFor(key)
+	if err != nil {
+		log.Printf("Failed to get org policy, using the default retention: %v", err)
+	}
+	if policy == nil {
+		return s.config.FileRetention
+	}
+	return policy.retention(s.config.FileRetention)
+}
+
+// retentionForKeyID is retentionFor for background work that only knows the key's ID
+func (s *FileService) retentionForKeyID(keyID string) time.Duration {
+	if keyID == "" {
+		return s.config.FileRetention
+	}
+	key, err := s.db.GetAPIKey(keyID)
+	if err != nil {
+		log.Printf("Failed to get API key %s, using the default retention: %v", keyID, err)
+		return s.config.FileRetention
+	}
+	return s.retentionFor(key)
+}
+
+// fileRetention returns how long a stored file is kept when its expiry is renewed, by the
+// policy that applied to its upload
+func (s *FileService) fileRetention(file *FileStorage) time.Duration {
+	if file.APIKeyID == nil {
+		return s.config.FileRetention
+	}
+	return s.retentionForKeyID(*file.APIKeyID)
+}
+
+// updateOrgPolicy lets org admins change the rules for their members' uploads
+//
+// @summary Change the upload policy of the caller's org
+// @tags org
+// @body json OrgPolicy
+// @success 200 json
+// @auth apiKey
+func (s *FileService) updateOrgPolicy(c *gin.Context) {
+	_, org, ok := s.requireOrgMember(c, orgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var policy OrgPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if err := policy.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org.Policy = policy
+	if err := s.db.UpdateOrg(org); err != nil {
+		log.Printf("Failed to update org policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org": org})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrgPolicyNormalize(t *testing.T) {
+	policy := OrgPolicy{BlockedExtensions: []string{" .EXE", "", "bat"}}
+	if err := policy.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(policy.BlockedExtensions, ",") != "exe,bat" {
+		t.Errorf("blocked extensions = %v", policy.BlockedExtensions)
+	}
+
+	for _, invalid := range []OrgPolicy{{MaxRetentionHours: -1}, {BlockedExtensions: []string{"tar/gz"}}} {
+		if err := invalid.normalize(); err == nil {
+			t.Errorf("normalize(%+v) accepted an invalid policy", invalid)
+		}
+	}
+}
+
+func TestOrgPolicyRetention(t *testing.T) {
+	tests := []struct {
+		hours int
+		want  time.Duration
+	}{
+		{0, 24 * time.Hour},
+		{2, 2 * time.Hour},
+		{48, 24 * time.Hour}, // A policy never keeps files longer than the server
+	}
+	for _, tt := range tests {
+		policy := OrgPolicy{MaxRetentionHours: tt.hours}
+		if got := policy.retention(24 * time.Hour); got != tt.want {
+			t.Errorf("retention with max_retention_hours %d = %v, want %v", tt.hours, got, tt.want)
+		}
+	}
+}
+
+func TestOrgPolicyEnforcedOnUpload(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.FileRetention = 24 * time.Hour
+	ts.store.CreateOrg(&Org{ID: "org-1", Name: "Team", Policy: OrgPolicy{
+		MaxRetentionHours:       2,
+		RequireDownloadPassword: true,
+		BlockedExtensions:       []string{"exe"},
+	}})
+	member := orgTestKey("member", "org-1", orgRoleMember)
+	ts.store.CreateAPIKey(member)
+
+	upload := func(filename, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(Base64UploadRequest{
+			Filename:         filename,
+			Content:          base64.StdEncoding.EncodeToString([]byte("team report")),
+			DownloadPassword: password,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/upload/base64", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(asKey(member, ts.uploadBase64), req)
+	}
+
+	if w := upload("setup.exe", "secret"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("blocked extension: got %d, want 415", w.Code)
+	}
+	if w := upload("report.txt", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("missing download password: got %d, want 400", w.Code)
+	}
+
+	w := upload("report.txt", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload within the policy: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Metadata FileMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := ts.clock.Now().Add(2 * time.Hour); !resp.Metadata.ExpiresAt.Equal(want) {
+		t.Errorf("expires_at = %v, want %v", resp.Metadata.ExpiresAt, want)
+	}
+
+	// Uploads outside the org follow the server's rules
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/base64",
+		strings.NewReader(`{"filename":"setup.exe","content":"`+base64.StdEncoding.EncodeToString([]byte("x"))+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if w := ts.serve(ts.uploadBase64, req); w.Code != http.StatusOK {
+		t.Errorf("anonymous upload: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOrgPolicyRequiresOrgAdmin(t *testing.T) {
+	ts := newTestService(t)
+	ts.store.CreateOrg(&Org{ID: "org-1", Name: "Team"})
+
+	update := func(key *APIKeyStorage, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/org/policy", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(asKey(key, ts.updateOrgPolicy), req).Code
+	}
+
+	if code := update(orgTestKey("member", "org-1", orgRoleMember), `{"require_download_password":true}`); code != http.StatusForbidden {
+		t.Errorf("org member: got %d, want 403", code)
+	}
+	if code := update(orgTestKey("admin", "org-1", orgRoleAdmin), `{"max_retention_hours":-5}`); code != http.StatusBadRequest {
+		t.Errorf("invalid policy: got %d, want 400", code)
+	}
+	if code := update(orgTestKey("admin", "org-1", orgRoleAdmin), `{"require_download_password":true,"blocked_extensions":[".ISO"]}`); code != http.StatusOK {
+		t.Fatalf("org admin: got %d, want 200", code)
+	}
+	org, _ := ts.store.GetOrg("org-1")
+	if !org.Policy.RequireDownloadPassword || strings.Join(org.Policy.BlockedExtensions, ",") != "iso" {
+		t.Errorf("stored policy = %+v", org.Policy)
+	}
+}
@@ -0,0 +1,514 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Organizations turn API keys into team workspaces. A key can be a member of one org;
+// files uploaded with it are owned by the org, so every member key can list, delete and
+// append to them, and they count against the org's quotas on top of the key's own. Org
+// admins additionally see the org's audit log, set its branding, which is shown with the
+// org's files, and set the upload policy in orgpolicy.go.
+
+const (
+	orgRoleMember = "member"
+	orgRoleAdmin  = "admin"
+)
+
+// maxOrgFiles is the most files one org file listing returns
+const maxOrgFiles = 1000
+
+var accentColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// validate checks branding before it is shown on other people's downloads
+func (b *OrgBranding) validate() error {
+	if utf8.RuneCountInString(b.DisplayName) > 100 {
+		return fmt.Errorf("branding display_name is longer than 100 characters")
+	}
+	if b.LogoURL != "" {
+		logo, err := url.Parse(b.LogoURL)
+		if err != nil || logo.Scheme != "https" || logo.Host == "" {
+			return fmt.Errorf("branding logo_url must be an https URL")
+		}
+	}
+	if b.AccentColor != "" && !accentColorPattern.MatchString(b.AccentColor) {
+		return fmt.Errorf("branding accent_color must be a hex color like #1a73e8")
+	}
+	return nil
+}
+
+type OrgRequest struct {
+	Name       string       `json:"name"`
+	QuotaBytes *int64       `json:"quota_bytes,omitempty"`
+	QuotaFiles *int         `json:"quota_files,omitempty"`
+	Branding   *OrgBranding `json:"branding,omitempty"`
+	Policy     *OrgPolicy   `json:"policy,omitempty"`
+}
+
+// applyTo copies the optional settings of the request onto an org
+func (req *OrgRequest) applyTo(org *Org) error {
+	if req.Name != "" {
+		org.Name = req.Name
+	}
+	if req.QuotaBytes != nil {
+		if *req.QuotaBytes < 0 {
+			return fmt.Errorf("quota_bytes must not be negative")
+		}
+		org.QuotaBytes = *req.QuotaBytes
+	}
+	if req.QuotaFiles != nil {
+		if *req.QuotaFiles < 0 {
+			return fmt.Errorf("quota_files must not be negative")
+		}
+		org.QuotaFiles = *req.QuotaFiles
+	}
+	if req.Branding != nil {
+		if err := req.Branding.validate(); err != nil {
+			return err
+		}
+		org.Branding = *req.Branding
+	}
+	if req.Policy != nil {
+		if err := req.Policy.normalize(); err != nil {
+			return err
+		}
+		org.Policy = *req.Policy
+	}
+	return nil
+}
+
+// canManageFile reports whether an API key may manage a file without its delete password:
+// the key that uploaded it, or any key of the org owning it
+func canManageFile(key *APIKeyStorage, file *FileStorage) bool {
+	if key == nil {
+		return false
+	}
+	if file.APIKeyID != nil && *file.APIKeyID == key.ID {
+		return true
+	}
+	return key.OrgID != nil && file.OrgID != nil && *key.OrgID == *file.OrgID
+}
+
+// orgBranding returns the branding shown with a file, nil unless an org owns it
+func (s *FileService) orgBranding(file *FileStorage) *OrgBranding {
+	if file.OrgID == nil {
+		return nil
+	}
+	org, err := s.db.GetOrg(*file.OrgID)
+	if err != nil {
+		log.Printf("Failed to get org of file %s: %v", file.ID, err)
+		return nil
+	}
+	if org == nil {
+		return nil
+	}
+	branding := org.Branding
+	if branding.DisplayName == "" {
+		branding.DisplayName = org.Name
+	}
+	return &branding
+}
+
+// orgQuotaUsage returns the usage and limits of the org of the request's API key, nil when
+// the key isn't in an org or the org has no quota
+func (s *FileService) orgQuotaUsage(c *gin.Context) (*QuotaUsage, error) {
+	return s.orgQuotaUsageOf(apiKeyFromContext(c))
+}
+
+// orgQuotaUsageOf returns the usage and limits of the org of an API key
+func (s *FileService) orgQuotaUsageOf(key *APIKeyStorage) (*QuotaUsage, error) {
+	if key == nil || key.OrgID == nil {
+		return nil, nil
+	}
+	org, err := s.db.GetOrg(*key.OrgID)
+	if err != nil || org == nil || (org.QuotaFiles <= 0 && org.QuotaBytes <= 0) {
+		return nil, err
+	}
+	usage := &QuotaUsage{Subject: "org", QuotaFiles: org.QuotaFiles, QuotaBytes: org.QuotaBytes}
+	usage.UsedFiles, usage.UsedBytes, err = s.db.GetOrgUsage(org.ID)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// checkOrgQuota verifies that storing additionalBytes, in a new file when newFile is set,
+// stays within the quotas of the request's org. It returns the org's usage (nil without
+// an org quota), or writes the error response and returns false.
+func (s *FileService) checkOrgQuota(c *gin.Context, additionalBytes int64, newFile bool) (*QuotaUsage, bool) {
+	usage, err := s.orgQuotaError(apiKeyFromContext(c), additionalBytes, newFile)
+	if err != nil {
+		err.respond(c)
+		return nil, false
+	}
+	return usage, true
+}
+
+// orgQuotaError is checkOrgQuota for the org of an API key, returning the error instead
+// of writing it
+func (s *FileService) orgQuotaError(key *APIKeyStorage, additionalBytes int64, newFile bool) (*QuotaUsage, *apiError) {
+	usage, err := s.orgQuotaUsageOf(key)
+	if err != nil {
+		log.Printf("Failed to check org quota: %v", err)
+		return nil, newAPIError(http.StatusInternalServerError, "Failed to check quota")
+	}
+	if usage == nil {
+		return nil, nil
+	}
+
+	if newFile && usage.QuotaFiles > 0 && usage.UsedFiles >= usage.QuotaFiles {
+		return nil, retryLaterError(http.StatusTooManyRequests, errorCodeQuotaExceeded, retryAfterQuota, gin.H{
+			"error":           "Organization file quota exceeded",
+			"message":         "Your organization has reached its maximum number of stored files.",
+			"quota":           usage,
+			"remaining_files": 0,
+			"remaining_bytes": usage.RemainingBytes(),
+		})
+	}
+	if err := bytesExceededError(usage, additionalBytes); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// createOrg creates an org that API keys can be assigned to
+//
+// @summary Create an org
+// @tags admin
+// @body json OrgRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) createOrg(c *gin.Context) {
+	var req OrgRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	org := &Org{ID: generateID()}
+	if err := req.applyTo(org); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.CreateOrg(org); err != nil {
+		log.Printf("Failed to create org: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Organization created successfully",
+		"org":     org,
+	})
+}
+
+// listOrgs lists the orgs with their quotas and usage
+//
+// @summary List orgs
+// @tags admin
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) listOrgs(c *gin.Context) {
+	orgs, err := s.db.ListOrgs()
+	if err != nil {
+		log.Printf("Failed to list orgs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+		return
+	}
+
+	type orgWithUsage struct {
+		*Org
+		UsedFiles int   `json:"used_files"`
+		UsedBytes int64 `json:"used_bytes"`
+	}
+	listed := make([]orgWithUsage, 0, len(orgs))
+	for _, org := range orgs {
+		entry := orgWithUsage{Org: org}
+		if entry.UsedFiles, entry.UsedBytes, err = s.db.GetOrgUsage(org.ID); err != nil {
+			log.Printf("Failed to get org usage: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+			return
+		}
+		listed = append(listed, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(listed),
+		"orgs":  listed,
+	})
+}
+
+// updateOrg changes the name and quotas of an org
+//
+// @summary Change an org
+// @tags admin
+// @path id Org ID
+// @body json OrgRequest optional
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) updateOrg(c *gin.Context) {
+	var req OrgRequest
+	if !bindAdminRequest(c, &req) {
+		return
+	}
+
+	org, err := s.db.GetOrg(c.Param("id"))
+	if err != nil {
+		log.Printf("Failed to get org: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if org == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	if err := req.applyTo(org); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.db.UpdateOrg(org); err != nil {
+		log.Printf("Failed to update org: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Organization updated successfully",
+		"org":     org,
+	})
+}
+
+// deleteOrg deletes an org
+//
+// @summary Delete an org
+// @tags admin
+// @path id Org ID
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) deleteOrg(c *gin.Context) {
+	orgID := c.Param("id")
+
+	if err := s.db.DeleteOrg(orgID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Organization deleted successfully",
+		"id":      orgID,
+	})
+}
+
+// checkKeyOrg verifies that the org an API key is assigned to exists, writing the error
+// response and returning false when it doesn't
+func (s *FileService) checkKeyOrg(c *gin.Context, key *APIKeyStorage) bool {
+	if key.OrgID == nil {
+		return true
+	}
+	org, err := s.db.GetOrg(*key.OrgID)
+	if err != nil {
+		log.Printf("Failed to get org: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if org == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown org_id"})
+		return false
+	}
+	return true
+}
+
+// requireOrgMember loads the org of the request's API key, writing the error response
+// and returning false when the request isn't made by an org member with at least role
+func (s *FileService) requireOrgMember(c *gin.Context, role string) (*APIKeyStorage, *Org, bool) {
+	key := apiKeyFromContext(c)
+	if key == nil || key.OrgID == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "An API key of an organization is required"})
+		return nil, nil, false
+	}
+	if role == orgRoleAdmin && key.OrgRole != orgRoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Organization admin role required"})
+		return nil, nil, false
+	}
+
+	org, err := s.db.GetOrg(*key.OrgID)
+	if err != nil {
+		log.Printf("Failed to get org: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, nil, false
+	}
+	if org == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return nil, nil, false
+	}
+	return key, org, true
+}
+
+// getOrg describes the org of the request's API key, its usage and the key's role
+//
+// @summary Describe the caller's org
+// @tags org
+// @success 200 json
+// @auth apiKey
+func (s *FileService) getOrg(c *gin.Context) {
+	key, org, ok := s.requireOrgMember(c, orgRoleMember)
+	if !ok {
+		return
+	}
+
+	usage := &QuotaUsage{Subject: "org", QuotaFiles: org.QuotaFiles, QuotaBytes: org.QuotaBytes}
+	var err error
+	if usage.UsedFiles, usage.UsedBytes, err = s.db.GetOrgUsage(org.ID); err != nil {
+		log.Printf("Failed to get org usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"org":   org,
+		"role":  key.OrgRole,
+		"usage": usage,
+	})
+}
+
+// OrgFile is a file in an org's file listing
+type OrgFile struct {
+	FileMetadata
+	APIKeyID *string `json:"api_key_id"` // Member key that uploaded the file
+}
+
+// listOrgFiles lists the active files owned by the org of the request's API key
+//
+// @summary List the files of the caller's org
+// @tags org
+// @query limit integer Most files to list
+// @success 200 json
+// @auth apiKey
+func (s *FileService) listOrgFiles(c *gin.Context) {
+	_, org, ok := s.requireOrgMember(c, orgRoleMember)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > maxOrgFiles {
+		limit = 100
+	}
+
+	stored, err := s.db.ListOrgFiles(org.ID, limit)
+	if err != nil {
+		log.Printf("Failed to list org files: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	listed := make([]OrgFile, 0, len(stored))
+	for _, file := range stored {
+		listed = append(listed, OrgFile{FileMetadata: publicMetadata(file), APIKeyID: file.APIKeyID})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(listed),
+		"files": listed,
+	})
+}
+
+// listOrgEvents serves the file event log of an org's files to its admins, as the same
+// cursor feed as the admin event log
+//
+// @summary List the file events of the caller's org
+// @tags org
+// @query after integer Cursor returned as next_cursor
+// @query types string Comma-separated event types
+// @query limit integer Most events to list
+// @success 200 json
+// @auth apiKey
+func (s *FileService) listOrgEvents(c *gin.Context) {
+	_, org, ok := s.requireOrgMember(c, orgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	after, _ := strconv.ParseInt(c.Query("after"), 10, 64)
+	var types []string
+	if value := c.Query("types"); value != "" {
+		types = strings.Split(value, ",")
+	}
+	for _, eventType := range types {
+		if !isFileEventType(eventType) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown event type",
+				"types": fileEventTypes,
+			})
+			return
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	events, err := s.db.ListOrgFileEvents(org.ID, after, types, limit)
+	if err != nil {
+		log.Printf("Failed to list org file events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	nextCursor := after
+	if len(events) > 0 {
+		nextCursor = events[len(events)-1].ID
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"events":      events,
+		"next_cursor": nextCursor,
+		"has_more":    len(events) == limit,
+	})
+}
+
+// updateOrgBranding lets org admins change the branding shown with their files
+//
+// @summary Change the branding of the caller's org
+// @tags org
+// @body json OrgBranding
+// @success 200 json
+// @auth apiKey
+func (s *FileService) updateOrgBranding(c *gin.Context) {
+	_, org, ok := s.requireOrgMember(c, orgRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var branding OrgBranding
+	if err := c.ShouldBindJSON(&branding); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if err := branding.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org.Branding = branding
+	if err := s.db.UpdateOrg(org); err != nil {
+		log.Printf("Failed to update org branding: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update branding"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"org": org})
+}
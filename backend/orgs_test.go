@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// asKey runs handler as if the request had authenticated with key
+func asKey(key *APIKeyStorage, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiKeyContextKey, key)
+		handler(c)
+	}
+}
+
+func orgTestKey(id, orgID, role string) *APIKeyStorage {
+	return &APIKeyStorage{ID: id, OrgID: &orgID, OrgRole: role}
+}
+
+func TestCanManageFile(t *testing.T) {
+	uploader := "key-1"
+	orgID := "org-1"
+	file := &FileStorage{ID: "f", APIKeyID: &uploader, OrgID: &orgID}
+
+	tests := []struct {
+		name string
+		key  *APIKeyStorage
+		want bool
+	}{
+		{"anonymous", nil, false},
+		{"uploader", &APIKeyStorage{ID: "key-1"}, true},
+		{"org member", orgTestKey("key-2", "org-1", orgRoleMember), true},
+		{"other org", orgTestKey("key-3", "org-2", orgRoleAdmin), false},
+		{"no org", &APIKeyStorage{ID: "key-4"}, false},
+	}
+	for _, tt := range tests {
+		if got := canManageFile(tt.key, file); got != tt.want {
+			t.Errorf("%s: canManageFile = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if canManageFile(orgTestKey("key-2", "org-1", orgRoleMember), &FileStorage{ID: "g", APIKeyID: &uploader}) {
+		t.Error("an org member could manage a file not owned by the org")
+	}
+}
+
+func TestOrgMemberDeletesOrgFile(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "orgfile", "shared", time.Hour)
+	file, _ := ts.store.GetFile("orgfile")
+	orgID := "org-1"
+	file.OrgID = &orgID
+	ts.store.SaveFile(file)
+
+	param := gin.Param{Key: "id", Value: "orgfile"}
+	req := httptest.NewRequest(http.MethodDelete, "/api/file/orgfile", nil)
+	w := ts.serve(asKey(orgTestKey("outsider", "org-2", orgRoleAdmin), ts.deleteFile), req, param)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("key of another org: got %d, want 401", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/file/orgfile", nil)
+	w = ts.serve(asKey(orgTestKey("member", "org-1", orgRoleMember), ts.deleteFile), req, param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("org member: got %d: %s", w.Code, w.Body.String())
+	}
+	if stored, _ := ts.store.GetFile("orgfile"); stored != nil {
+		t.Error("file still stored after the org member deleted it")
+	}
+}
+
+func TestOrgQuota(t *testing.T) {
+	ts := newTestService(t)
+	ts.store.CreateOrg(&Org{ID: "org-1", Name: "Team", QuotaFiles: 1, QuotaBytes: 10})
+	ts.saveTestFile(t, "orgfile", "12345", time.Hour)
+	file, _ := ts.store.GetFile("orgfile")
+	orgID := "org-1"
+	file.OrgID = &orgID
+	ts.store.SaveFile(file)
+
+	check := func(key *APIKeyStorage, additionalBytes int64, newFile bool) (int, *QuotaUsage) {
+		var usage *QuotaUsage
+		w := ts.serve(asKey(key, func(c *gin.Context) {
+			var ok bool
+			if usage, ok = ts.checkOrgQuota(c, additionalBytes, newFile); ok {
+				c.Status(http.StatusOK)
+			}
+		}), httptest.NewRequest(http.MethodPost, "/api/upload", nil))
+		return w.Code, usage
+	}
+
+	member := orgTestKey("member", "org-1", orgRoleMember)
+	if code, _ := check(member, 1, true); code != http.StatusTooManyRequests {
+		t.Errorf("new file over the org file quota: got %d, want 429", code)
+	}
+	if code, _ := check(member, 6, false); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("append over the org byte quota: got %d, want 413", code)
+	}
+	code, usage := check(member, 5, false)
+	if code != http.StatusOK || usage == nil || usage.RemainingBytes() != 5 {
+		t.Errorf("append within the org quota: got %d, usage %+v", code, usage)
+	}
+	if code, usage := check(&APIKeyStorage{ID: "solo"}, 100, true); code != http.StatusOK || usage != nil {
+		t.Errorf("key without an org: got %d, usage %+v", code, usage)
+	}
+}
+
+func TestOrgBrandingValidation(t *testing.T) {
+	tests := []struct {
+		branding OrgBranding
+		valid    bool
+	}{
+		{OrgBranding{}, true},
+		{OrgBranding{DisplayName: "Acme", LogoURL: "https://acme.example/logo.png", AccentColor: "#1a73e8"}, true},
+		{OrgBranding{AccentColor: "#fff"}, true},
+		{OrgBranding{LogoURL: "javascript:alert(1)"}, false},
+		{OrgBranding{LogoURL: "http://acme.example/logo.png"}, false},
+		{OrgBranding{AccentColor: "red"}, false},
+		{OrgBranding{DisplayName: strings.Repeat("a", 101)}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.branding.validate(); (err == nil) != tt.valid {
+			t.Errorf("validate(%+v) = %v, want valid %v", tt.branding, err, tt.valid)
+		}
+	}
+}
+
+func TestOrgBrandingRoles(t *testing.T) {
+	ts := newTestService(t)
+	ts.store.CreateOrg(&Org{ID: "org-1", Name: "Team"})
+
+	update := func(key *APIKeyStorage) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/org/branding", strings.NewReader(`{"accent_color":"#123456"}`))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(asKey(key, ts.updateOrgBranding), req).Code
+	}
+
+	if code := update(nil); code != http.StatusForbidden {
+		t.Errorf("without an API key: got %d, want 403", code)
+	}
+	if code := update(orgTestKey("member", "org-1", orgRoleMember)); code != http.StatusForbidden {
+		t.Errorf("org member: got %d, want 403", code)
+	}
+	if code := update(orgTestKey("admin", "org-1", orgRoleAdmin)); code != http.StatusOK {
+		t.Fatalf("org admin: got %d, want 200", code)
+	}
+
+	orgID := "org-1"
+	branding := ts.orgBranding(&FileStorage{ID: "f", OrgID: &orgID})
+	if branding == nil || branding.AccentColor != "#123456" || branding.DisplayName != "Team" {
+		t.Errorf("file branding = %+v", branding)
+	}
+	if ts.orgBranding(&FileStorage{ID: "g"}) != nil {
+		t.Error("file without an org has branding")
+	}
+}
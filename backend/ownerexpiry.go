@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OwnerExpirationRequest moves the expiry of a file to ExpiresAt, or ExtendHours past
+// its current expiry
+type OwnerExpirationRequest struct {
+	ExpiresAt   string `json:"expires_at,omitempty"` // RFC3339
+	ExtendHours int    `json:"extend_hours,omitempty"`
+}
+
+// ownerExpiryLimit returns the latest expiry the owner of a file may set: OWNER_MAX_LIFETIME_HOURS
+// after the upload, or less when the org of the uploading key keeps files for less
+func (s *FileService) ownerExpiryLimit(file *FileStorage) time.Time {
+	lifetime := s.config.OwnerMaxLifetime
+	if retention := s.fileRetention(file); retention < s.config.FileRetention && retention < lifetime {
+		lifetime = retention
+	}
+	return file.UploadTime.Add(lifetime)
+}
+
+// updateOwnerExpiration lets the uploader of a file, proven by the delete password or an
+// API key that may manage it, change when it expires within the lifetime allowed by policy
+//
+// @summary Change when a file expires
+// @tags file
+// @path id File ID
+// @body json OwnerExpirationRequest
+// @success 200 json
+// @auth deletePassword apiKey
+func (s *FileService) updateOwnerExpiration(c *gin.Context) {
+	fileID := c.Param("id")
+
+	if s.config.OwnerMaxLifetime <= 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Owners can't change the expiration on this server"})
+		return
+	}
+
+	var req OwnerExpirationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if (req.ExpiresAt == "") == (req.ExtendHours == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Give either expires_at or extend_hours"})
+		return
+	}
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	now := s.clock.Now()
+	if fileStorage == nil || !fileStorage.ExpiresAt.After(now) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "Changing the expiration requires the file's delete password.",
+		})
+		return
+	}
+
+	expiresAt := fileStorage.ExpiresAt.Add(time.Duration(req.ExtendHours) * time.Hour)
+	if req.ExpiresAt != "" {
+		if expiresAt, err = time.Parse(time.RFC3339, req.ExpiresAt); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid expiration time format",
+				"message": "Please use RFC3339 format (e.g., 2023-12-31T23:59:59Z)",
+			})
+			return
+		}
+	}
+	if !expiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid expiration time",
+			"message": "Expiration time must be in the future",
+		})
+		return
+	}
+	if limit := s.ownerExpiryLimit(fileStorage); expiresAt.After(limit) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Expiration beyond the allowed lifetime",
+			"message":        "Files can't be kept longer than the server's policy allows.",
+			"max_expires_at": limit,
+		})
+		return
+	}
+
+	if err := s.db.UpdateFileExpiration(fileID, expiresAt); err != nil {
+		log.Printf("Failed to update expiration of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file expiration"})
+		return
+	}
+	s.redis.Del(context.Background(), "file:"+fileID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "File expiration updated successfully",
+		"file_id":        fileID,
+		"old_expires_at": fileStorage.ExpiresAt,
+		"new_expires_at": expiresAt,
+		"max_expires_at": s.ownerExpiryLimit(fileStorage),
+	})
+}
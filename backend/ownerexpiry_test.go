@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOwnerExtendsExpiration(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.OwnerMaxLifetime = 48 * time.Hour
+	ts.saveTestFile(t, "notes", "hello", 24*time.Hour)
+	uploaded := ts.clock.Now()
+	param := gin.Param{Key: "id", Value: "notes"}
+
+	extend := func(password, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/file/notes/expires", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if password != "" {
+			req.Header.Set("X-Delete-Password", password)
+		}
+		return ts.serve(ts.updateOwnerExpiration, req, param)
+	}
+
+	if w := extend("wrong", `{"extend_hours":12}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: got %d, want 401", w.Code)
+	}
+	if w := extend("delete-me", `{"extend_hours":12}`); w.Code != http.StatusOK {
+		t.Fatalf("extend: got %d: %s", w.Code, w.Body.String())
+	}
+	if file, _ := ts.store.GetFileMetadata("notes"); !file.ExpiresAt.Equal(uploaded.Add(36 * time.Hour)) {
+		t.Errorf("expires at %s, want 36h after the upload", file.ExpiresAt)
+	}
+
+	if w := extend("delete-me", `{"extend_hours":24}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "max_expires_at") {
+		t.Errorf("past the lifetime: got %d: %s", w.Code, w.Body.String())
+	}
+	past := uploaded.Add(-time.Hour).Format(time.RFC3339)
+	if w := extend("delete-me", `{"expires_at":"`+past+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("past time: got %d, want 400", w.Code)
+	}
+	limit := uploaded.Add(48 * time.Hour).Format(time.RFC3339)
+	if w := extend("delete-me", `{"expires_at":"`+limit+`"}`); w.Code != http.StatusOK {
+		t.Errorf("up to the lifetime: got %d: %s", w.Code, w.Body.String())
+	}
+
+	ts.config.OwnerMaxLifetime = 0
+	if w := extend("delete-me", `{"extend_hours":1}`); w.Code != http.StatusForbidden {
+		t.Errorf("disabled: got %d, want 403", w.Code)
+	}
+}
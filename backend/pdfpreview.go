@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PDF pages are rasterized by poppler's pdftoppm on first request and cached in Redis
+// until the file expires, so the frontend can page through a large PDF without
+// downloading all of it.
+
+// maxPDFPageSize is the longest side, in pixels, of a rendered page
+const maxPDFPageSize = 1600
+
+// parsePDFInfoPages reads the page count from pdfinfo output
+func parsePDFInfoPages(output []byte) (int, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found || key != "Pages" {
+			continue
+		}
+		pages, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || pages < 1 {
+			return 0, fmt.Errorf("invalid page count %q", strings.TrimSpace(value))
+		}
+		return pages, nil
+	}
+	return 0, fmt.Errorf("no page count in pdfinfo output")
+}
+
+// pdfPageCount returns the number of pages of a PDF, cached like the rendered pages
+func (s *FileService) pdfPageCount(fileStorage *FileStorage) (int, error) {
+	data, err := s.cachedMediaResult("pdf:pages:"+fileStorage.ID, fileStorage, func(path string) ([]byte, error) {
+		output, err := runMediaTool(s.config.MediaProcessTimeout, s.config.PDFInfoPath, path)
+		if err != nil {
+			return nil, err
+		}
+		pages, err := parsePDFInfoPages(output)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(pages)), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(data))
+}
+
+// pdfRenderingFailed writes the error response for a failed pdftoppm or pdfinfo run
+func pdfRenderingFailed(c *gin.Context, fileID string, err error) {
+	if errors.Is(err, errMediaToolsUnavailable) {
+		respondRetryLater(c, http.StatusServiceUnavailable, errorCodeNotConfigured, retryAfterNotConfigured, gin.H{
+			"error":   "PDF rendering unavailable",
+			"message": "poppler-utils is not installed on this server.",
+		})
+		return
+	}
+	log.Printf("PDF rendering of %s failed: %v", fileID, err)
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"error":   "Failed to render PDF",
+		"message": "The PDF could not be decoded. It may be damaged or encrypted.",
+	})
+}
+
+// getPDFPage serves one page of a PDF as a PNG, at most maxPDFPageSize on its longest side
+//
+// @summary Render a page of a PDF
+// @tags preview
+// @path id File ID
+// @path n Page number, from 1
+// @success 200 image/png
+// @success 304
+// @auth downloadPassword adminToken optional
+func (s *FileService) getPDFPage(c *gin.Context) {
+	page, err := strconv.Atoi(c.Param("n"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Page must be a positive number"})
+		return
+	}
+
+	fileStorage, err := s.lookupFile(c.Param("id"), false)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+	if !requireScanCleared(c, fileStorage) {
+		return
+	}
+
+	if fileStorage.MimeType != "application/pdf" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":     "Not a PDF file",
+			"mime_type": fileStorage.MimeType,
+		})
+		return
+	}
+
+	pageCount, err := s.pdfPageCount(fileStorage)
+	if err != nil {
+		pdfRenderingFailed(c, fileStorage.ID, err)
+		return
+	}
+	c.Header("X-Page-Count", strconv.Itoa(pageCount))
+	if page > pageCount {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":      "Page not found",
+			"page_count": pageCount,
+		})
+		return
+	}
+
+	etag := fmt.Sprintf("%s-%s-page-%d", fileStorage.ID, contentVersion(fileStorage), page)
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", etag))
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Trim(match, "\"") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	cacheKey := fmt.Sprintf("pdf:page:%s:%d", fileStorage.ID, page)
+	image, err := s.cachedMediaResult(cacheKey, fileStorage, func(path string) ([]byte, error) {
+		// Without an output root pdftoppm writes the single page to stdout
+		pageArg := strconv.Itoa(page)
+		image, err := runMediaTool(s.config.MediaProcessTimeout, s.config.PDFToPPMPath,
+			"-f", pageArg, "-l", pageArg, "-singlefile", "-png",
+			"-scale-to", strconv.Itoa(maxPDFPageSize),
+			path)
+		if err == nil && len(image) == 0 {
+			err = fmt.Errorf("no image rendered for page %d", page)
+		}
+		return image, err
+	})
+	if err != nil {
+		pdfRenderingFailed(c, fileStorage.ID, err)
+		return
+	}
+
+	c.Header("Content-Length", strconv.Itoa(len(image)))
+	c.Data(http.StatusOK, "image/png", image)
+}
+
+// pdfToolsAvailable reports whether pdftoppm and pdfinfo can be found
+func pdfToolsAvailable(config *Config) bool {
+	_, pdftoppmErr := exec.LookPath(config.PDFToPPMPath)
+	_, pdfinfoErr := exec.LookPath(config.PDFInfoPath)
+	return pdftoppmErr == nil && pdfinfoErr == nil
+}
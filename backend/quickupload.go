@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"file-storage-service/internal/files"
+)
+
+const (
+	// metadataStream queues file records waiting to be written to PostgreSQL
+	metadataStream = "metadata_writes"
+	// metadataGroup is the consumer group shared by the metadata writers of all instances
+	metadataGroup = "metadata_writers"
+	// metadataClaimIdle is how long a record may stay unacknowledged before another
+	// writer takes it over; a single INSERT never takes this long
+	metadataClaimIdle = time.Minute
+)
+
+// MetadataQueue persists file records asynchronously so tiny uploads can return
+// before the PostgreSQL write completes. Records are queued on a Redis stream and kept
+// under pending_file:<id> until written, so an acknowledged upload survives a restart
+// and stays readable through pendingFile in the meantime. While a record is queued the
+// file reports "processing" through the regular /api/file/:id/status endpoint.
+type MetadataQueue struct {
+	db       FileStore
+	redis    RedisClient
+	size     int
+	ttl      time.Duration
+	consumer string
+}
+
+func NewMetadataQueue(db FileStore, redisClient RedisClient, config *Config) *MetadataQueue {
+	hostname, _ := os.Hostname()
+	q := &MetadataQueue{
+		db:       db,
+		redis:    redisClient,
+		size:     config.MetadataQueueSize,
+		ttl:      config.FileRetention,
+		consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+
+	err := redisClient.XGroupCreateMkStream(context.Background(), metadataStream, metadataGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("Failed to create metadata consumer group: %v", err)
+	}
+
+	for i := 0; i < config.MetadataQueueWorkers; i++ {
+		go q.run()
+	}
+	go q.reclaimStale()
+	return q
+}
+
+// ErrMetadataQueueFull is returned by Enqueue when too many records are waiting
+var ErrMetadataQueueFull = errors.New("metadata queue is full")
+
+// Enqueue schedules a file record for saving
+func (q *MetadataQueue) Enqueue(file *FileStorage) error {
+	ctx := context.Background()
+	if length, err := q.redis.XLen(ctx, metadataStream).Result(); err == nil && q.size > 0 && length >= int64(q.size) {
+		return ErrMetadataQueueFull
+	}
+
+	record, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	statusJSON, _ := json.Marshal(map[string]interface{}{
+		"status":   "processing",
+		"filename": file.Filename,
+	})
+
+	pipe := q.redis.TxPipeline()
+	pipe.Set(ctx, "pending_file:"+file.ID, record, q.ttl)
+	pipe.Set(ctx, "processing:"+file.ID, statusJSON, time.Hour)
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: metadataStream,
+		Values: map[string]interface{}{"file_id": file.ID},
+	})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// pendingFile returns a queued record that hasn't been written to PostgreSQL yet
+func (q *MetadataQueue) pendingFile(fileID string) *FileStorage {
+	record, err := q.redis.Get(context.Background(), "pending_file:"+fileID).Bytes()
+	if err != nil {
+		return nil
+	}
+	var file FileStorage
+	if err := json.Unmarshal(record, &file); err != nil || time.Now().After(file.ExpiresAt) {
+		return nil
+	}
+	return &file
+}
+
+// Discard drops a queued record, e.g. when the file is deleted before it was written
+func (q *MetadataQueue) Discard(fileID string) {
+	q.redis.Del(context.Background(), "pending_file:"+fileID, "processing:"+fileID)
+}
+
+func (q *MetadataQueue) run() {
+	ctx := context.Background()
+	for {
+		streams, err := q.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    metadataGroup,
+			Consumer: q.consumer,
+			Streams:  []string{metadataStream, ">"},
+			Count:    1,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil {
+				log.Printf("Failed to read metadata queue: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				q.save(message)
+			}
+		}
+	}
+}
+
+// reclaimStale takes over records left unacknowledged by writers that died
+func (q *MetadataQueue) reclaimStale() {
+	ctx := context.Background()
+	ticker := time.NewTicker(metadataClaimIdle)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pending, err := q.redis.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: metadataStream,
+			Group:  metadataGroup,
+			Start:  "-",
+			End:    "+",
+			Count:  100,
+		}).Result()
+		if err != nil {
+			continue
+		}
+
+		var stale []string
+		for _, entry := range pending {
+			if entry.Idle >= metadataClaimIdle {
+				stale = append(stale, entry.ID)
+			}
+		}
+		if len(stale) == 0 {
+			continue
+		}
+
+		messages, err := q.redis.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   metadataStream,
+			Group:    metadataGroup,
+			Consumer: q.consumer,
+			MinIdle:  metadataClaimIdle,
+			Messages: stale,
+		}).Result()
+		if err != nil {
+			log.Printf("Failed to claim stale metadata records: %v", err)
+			continue
+		}
+		for _, message := range messages {
+			q.save(message)
+		}
+	}
+}
+
+// save writes one queued record to PostgreSQL and acknowledges it. A record that fails
+// to save stays pending and is retried by reclaimStale.
+func (q *MetadataQueue) save(message redis.XMessage) {
+	ctx := context.Background()
+	fileID, _ := message.Values["file_id"].(string)
+
+	file := q.pendingFile(fileID)
+	if file == nil {
+		// Discarded or expired before it was written
+		q.redis.XAck(ctx, metadataStream, metadataGroup, message.ID)
+		q.redis.XDel(ctx, metadataStream, message.ID)
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err = q.db.SaveFile(file); err == nil {
+			break
+		}
+		time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+	}
+
+	if err != nil {
+		log.Printf("Failed to save queued file %s: %v", file.ID, err)
+		return
+	}
+
+	// Acknowledge before dropping the record so it is never unreadable
+	q.redis.XAck(ctx, metadataStream, metadataGroup, message.ID)
+	q.redis.XDel(ctx, metadataStream, message.ID)
+	q.redis.Del(ctx, "pending_file:"+file.ID, "processing:"+file.ID)
+}
+
+// lookupFile returns a file record from PostgreSQL, falling back to a quick upload that
+// is still waiting in the metadata queue. withContent selects GetFile over GetFileMetadata.
+func (s *FileService) lookupFile(fileID string, withContent bool) (*FileStorage, error) {
+	var file *FileStorage
+	var err error
+	if withContent {
+		file, err = s.db.GetFile(fileID)
+	} else {
+		file, err = s.db.GetFileMetadata(fileID)
+	}
+	if err != nil || file != nil || s.metadataQueue == nil {
+		return file, err
+	}
+
+	file = s.metadataQueue.pendingFile(fileID)
+	if file != nil && !withContent {
+		file.FileContent = nil
+	}
+	return file, nil
+}
+
+// quickUpload is a low-latency upload path for tiny files such as screenshots. It skips
+// compression selection, defers the database write to the metadata queue and returns a
+// short URL immediately.
+//
+// @summary Upload a tiny file quickly
+// @tags upload
+// @form file file required The file to upload
+// @form download_password string Password required to download the file
+// @form storage_class string Storage class; only standard is accepted
+// @success 200 json
+// @auth apiKey optional
+func (s *FileService) quickUpload(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > s.config.QuickUploadMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large for quick upload",
+			"message":  "Use /api/upload for larger files",
+			"max_size": s.config.QuickUploadMaxSize,
+		})
+		return
+	}
+
+	if !checkExtensionPolicy(c, s.config, files.NormalizeName(header.Filename), header.Size) {
+		return
+	}
+	if !s.checkOrgPolicy(c, files.NormalizeName(header.Filename), c.PostForm("download_password") != "") {
+		return
+	}
+
+	// Quick uploads are always stored in PostgreSQL
+	if !requireStandardStorageClass(c, c.PostForm("storage_class")) {
+		return
+	}
+
+	apiKey := apiKeyFromContext(c)
+	if !s.checkUploadQuota(c, header.Size) {
+		return
+	}
+
+	content, err := io.ReadAll(io.LimitReader(file, s.config.QuickUploadMaxSize+1))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	if int64(len(content)) > s.config.QuickUploadMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large for quick upload",
+			"max_size": s.config.QuickUploadMaxSize,
+		})
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	contentHash := hex.EncodeToString(sum[:])
+
+	filename := files.NormalizeName(header.Filename)
+	scanResult, ok := s.scanUpload(c, filename, content)
+	if !ok {
+		return
+	}
+
+	fileID, ok := s.allocateFileID(c)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	now := s.clock.Now()
+	size := int64(len(content))
+	downloadPassword := c.PostForm("download_password")
+	clientIP := c.ClientIP()
+	retention := s.retentionFor(apiKey)
+
+	mimeType := files.MimeType(filename)
+	var imageInfo *ImageInfo
+	if files.IsImageFile(mimeType) {
+		imageInfo = extractImageInfo(content)
+	}
+
+	// Tiny files gain little from compression, so skip selection entirely
+	metadata := FileMetadata{
+		ID:                  fileID,
+		Filename:            filename,
+		Size:                size,
+		CompressedSize:      size,
+		MimeType:            mimeType,
+		Compression:         CompressionNone,
+		UploadTime:          now,
+		ExpiresAt:           now.Add(retention),
+		DeletePassword:      files.GeneratePassword(),
+		DownloadPassword:    downloadPassword,
+		HasDownloadPassword: downloadPassword != "",
+		Image:               imageInfo,
+		SHA256:              contentHash,
+		Scan:                scanResult,
+	}
+
+	fileStorage := &FileStorage{
+		ID:                  fileID,
+		Filename:            metadata.Filename,
+		OriginalSize:        size,
+		CompressedSize:      &metadata.CompressedSize,
+		MimeType:            metadata.MimeType,
+		CompressionType:     string(CompressionNone),
+		StorageType:         "postgresql",
+		FileContent:         content,
+		UploadTime:          now,
+		ExpiresAt:           metadata.ExpiresAt,
+		DeletePassword:      metadata.DeletePassword,
+		HasDownloadPassword: metadata.HasDownloadPassword,
+		UploaderIP:          &clientIP,
+		ContentHash:         &contentHash,
+		ImageInfo:           imageInfo,
+		ScanResult:          scanResult,
+	}
+
+	if downloadPassword != "" {
+		fileStorage.DownloadPassword = &downloadPassword
+	}
+
+	if apiKey != nil {
+		fileStorage.APIKeyID = &apiKey.ID
+	}
+
+	if err := s.metadataQueue.Enqueue(fileStorage); err != nil {
+		if err == ErrMetadataQueueFull {
+			respondRetryLater(c, http.StatusServiceUnavailable, errorCodeServerBusy, time.Second, gin.H{
+				"error": "Server busy, please try again later",
+			})
+			return
+		}
+
+		// Without the queue the record is written before responding
+		log.Printf("Failed to queue file %s, saving synchronously: %v", fileID, err)
+		if err := s.db.SaveFile(fileStorage); err != nil {
+			log.Printf("Failed to save file %s: %v", fileID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+			return
+		}
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err == nil {
+		s.redis.Set(ctx, "file:"+fileID, metadataJSON, retention)
+	}
+
+	shortCode := generateShortCode()
+	s.redis.Set(ctx, "short:"+shortCode, fileID, retention)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "File uploaded successfully",
+		"file_id":   fileID,
+		"metadata":  metadata,
+		"short_url": "/s/" + shortCode,
+	})
+}
+
+// generateShortCode returns a random 8-character code for short links
+func generateShortCode() string {
+	return files.GeneratePassword()[:8]
+}
+
+// resolveShortLink redirects a short link to the file page
+func (s *FileService) resolveShortLink(c *gin.Context) {
+	fileID, err := s.redis.Get(context.Background(), "short:"+c.Param("code")).Result()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found or expired"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/file/"+fileID)
+}
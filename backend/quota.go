@@ -0,0 +1,170 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaUsage describes the storage used by an uploader and the limits that apply to it
+type QuotaUsage struct {
+	Subject    string `json:"subject"` // "api_key", "ip" or "org"
+	UsedFiles  int    `json:"used_files"`
+	UsedBytes  int64  `json:"used_bytes"`
+	QuotaFiles int    `json:"quota_files"` // 0 = unlimited
+	QuotaBytes int64  `json:"quota_bytes"` // 0 = unlimited
+}
+
+// RemainingFiles returns how many more files may be stored, or -1 when unlimited
+func (q *QuotaUsage) RemainingFiles() int {
+	if q.QuotaFiles <= 0 {
+		return -1
+	}
+	if q.UsedFiles >= q.QuotaFiles {
+		return 0
+	}
+	return q.QuotaFiles - q.UsedFiles
+}
+
+// RemainingBytes returns how many more bytes may be stored, or -1 when unlimited
+func (q *QuotaUsage) RemainingBytes() int64 {
+	if q.QuotaBytes <= 0 {
+		return -1
+	}
+	if q.UsedBytes >= q.QuotaBytes {
+		return 0
+	}
+	return q.QuotaBytes - q.UsedBytes
+}
+
+// quotaUsage returns the usage and limits for the uploader of the request
+func (s *FileService) quotaUsage(c *gin.Context) (*QuotaUsage, error) {
+	return s.quotaUsageOf(callerFrom(c))
+}
+
+// quotaUsageOf returns the usage and limits for an uploader. API keys use their own
+// limits, where 0 means unlimited; anonymous uploads are tracked per client IP against
+// the per-user defaults.
+func (s *FileService) quotaUsageOf(who caller) (*QuotaUsage, error) {
+	usage := &QuotaUsage{}
+
+	var err error
+	if apiKey := who.apiKey; apiKey != nil {
+		usage.Subject = "api_key"
+		usage.QuotaFiles = apiKey.QuotaFiles
+		usage.QuotaBytes = apiKey.QuotaBytes
+		usage.UsedFiles, usage.UsedBytes, err = s.db.GetAPIKeyUsage(apiKey.ID)
+	} else {
+		usage.Subject = "ip"
+		usage.QuotaFiles = s.config.MaxFilesPerUser
+		usage.QuotaBytes = s.config.MaxBytesPerUser
+		usage.UsedFiles, usage.UsedBytes, err = s.db.GetUploaderIPUsage(who.clientIP)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// checkUploadQuota verifies that storing one more file of additionalBytes stays within
+// the uploader's quota. It writes the error response and returns false when it would not.
+func (s *FileService) checkUploadQuota(c *gin.Context, additionalBytes int64) bool {
+	if err := s.uploadQuotaError(callerFrom(c), additionalBytes); err != nil {
+		err.respond(c)
+		return false
+	}
+	return true
+}
+
+// uploadQuotaError refuses one more file of additionalBytes when it would take the
+// uploader over its quota
+func (s *FileService) uploadQuotaError(who caller, additionalBytes int64) *apiError {
+	if s.config.MaxFilesPerUser <= 0 && s.config.MaxBytesPerUser <= 0 && who.apiKey == nil {
+		return nil
+	}
+
+	usage, err := s.quotaUsageOf(who)
+	if err != nil {
+		log.Printf("Failed to check upload quota: %v", err)
+		return newAPIError(http.StatusInternalServerError, "Failed to check quota")
+	}
+
+	if usage.QuotaFiles > 0 && usage.UsedFiles >= usage.QuotaFiles {
+		return retryLaterError(http.StatusTooManyRequests, errorCodeQuotaExceeded, retryAfterQuota, gin.H{
+			"error":           "File quota exceeded",
+			"message":         "You have reached the maximum number of stored files. Delete files or wait for them to expire.",
+			"quota":           usage,
+			"remaining_files": 0,
+			"remaining_bytes": usage.RemainingBytes(),
+		})
+	}
+
+	if err := bytesExceededError(usage, additionalBytes); err != nil {
+		return err
+	}
+	_, apiErr := s.orgQuotaError(who.apiKey, additionalBytes, true)
+	return apiErr
+}
+
+// checkStorageQuota verifies that adding additionalBytes to an existing file stays within
+// the uploader's byte quota, returning the bytes still available (-1 when unlimited). It
+// writes the error response and returns false when the quota would be exceeded.
+func (s *FileService) checkStorageQuota(c *gin.Context, additionalBytes int64) (int64, bool) {
+	if s.config.MaxBytesPerUser <= 0 && apiKeyFromContext(c) == nil {
+		return -1, true
+	}
+
+	usage, err := s.quotaUsage(c)
+	if err != nil {
+		log.Printf("Failed to check storage quota: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+		return 0, false
+	}
+
+	if additionalBytes < 0 {
+		additionalBytes = 0 // Unknown length; the caller limits the body to the remainder
+	}
+	if !respondIfBytesExceeded(c, usage, additionalBytes) {
+		return 0, false
+	}
+	orgUsage, ok := s.checkOrgQuota(c, additionalBytes, false)
+	if !ok {
+		return 0, false
+	}
+
+	// The tighter of the key's and the org's byte quotas applies
+	remaining := usage.RemainingBytes()
+	if orgUsage != nil {
+		if orgRemaining := orgUsage.RemainingBytes(); orgRemaining >= 0 && (remaining < 0 || orgRemaining < remaining) {
+			remaining = orgRemaining
+		}
+	}
+	return remaining, true
+}
+
+// respondIfBytesExceeded writes a 413 and returns false when additionalBytes would take
+// the usage over its byte quota
+func respondIfBytesExceeded(c *gin.Context, usage *QuotaUsage, additionalBytes int64) bool {
+	if err := bytesExceededError(usage, additionalBytes); err != nil {
+		err.respond(c)
+		return false
+	}
+	return true
+}
+
+// bytesExceededError refuses additionalBytes with 413 when they would take the usage over
+// its byte quota
+func bytesExceededError(usage *QuotaUsage, additionalBytes int64) *apiError {
+	if usage.QuotaBytes > 0 && usage.UsedBytes+additionalBytes > usage.QuotaBytes {
+		return &apiError{status: http.StatusRequestEntityTooLarge, body: gin.H{
+			"error":           "Storage quota exceeded",
+			"message":         "This upload would exceed your storage quota.",
+			"quota":           usage,
+			"remaining_files": usage.RemainingFiles(),
+			"remaining_bytes": usage.RemainingBytes(),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadRequest builds a multipart upload of content
+func uploadRequest(t *testing.T, content string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "quota.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUploadQuotaPerIP(t *testing.T) {
+	ts := newTestService(t)
+	if ts.config.MaxFilesPerUser != 1000 {
+		t.Errorf("MaxFilesPerUser defaults to %d, want 1000", ts.config.MaxFilesPerUser)
+	}
+	ts.config.MaxFilesPerUser = 2
+	ts.config.MaxBytesPerUser = 0
+
+	for i := 0; i < 2; i++ {
+		if w := ts.serve(ts.uploadFile, uploadRequest(t, "data")); w.Code != http.StatusOK {
+			t.Fatalf("upload %d: got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	w := ts.serve(ts.uploadFile, uploadRequest(t, "data"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(errorCodeHeader) != errorCodeQuotaExceeded {
+		t.Errorf("over the file quota: got %d with code %q", w.Code, w.Header().Get(errorCodeHeader))
+	}
+
+	// Another client has its own quota, and 0 lifts the limit
+	other := uploadRequest(t, "data")
+	other.RemoteAddr = "198.51.100.9:4000"
+	if w := ts.serve(ts.uploadFile, other); w.Code != http.StatusOK {
+		t.Errorf("other client: got %d", w.Code)
+	}
+	ts.config.MaxFilesPerUser = 0
+	if w := ts.serve(ts.uploadFile, uploadRequest(t, "data")); w.Code != http.StatusOK {
+		t.Errorf("unlimited files: got %d", w.Code)
+	}
+
+	ts.config.MaxBytesPerUser = 14 // 12 bytes stored so far
+	if w := ts.serve(ts.uploadFile, uploadRequest(t, "12")); w.Code != http.StatusOK {
+		t.Errorf("within the byte quota: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := ts.serve(ts.uploadFile, uploadRequest(t, "x")); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over the byte quota: got %d, want 413", w.Code)
+	}
+}
+
+func TestUploadQuotaPerAPIKey(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.MaxFilesPerUser = 1
+	rawKey := generateAPIKey()
+	ts.store.CreateAPIKey(&APIKeyStorage{ID: "key-1", KeyHash: hashAPIKey(rawKey), RateLimit: 100, QuotaFiles: 3, QuotaBytes: 10})
+
+	router := gin.New()
+	router.Use(apiKeyMiddleware(ts.FileService))
+	router.POST("/api/upload", ts.uploadFile)
+	upload := func(content string) *httptest.ResponseRecorder {
+		req := uploadRequest(t, content)
+		req.Header.Set(apiKeyHeader, rawKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The key's quota applies instead of the per-IP default
+	for i := 0; i < 2; i++ {
+		if w := upload("abc"); w.Code != http.StatusOK {
+			t.Fatalf("upload %d: got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	if w := upload("abcde"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("over the key's byte quota: got %d, want 413", w.Code)
+	}
+	if w := upload("abc"); w.Code != http.StatusOK {
+		t.Fatalf("third file: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := upload("a"); w.Code != http.StatusTooManyRequests || w.Header().Get(errorCodeHeader) != errorCodeQuotaExceeded {
+		t.Errorf("over the key's file quota: got %d with code %q", w.Code, w.Header().Get(errorCodeHeader))
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// The file, preview and stream endpoints serve the same bytes and answer Range requests the
+// same way, so seeking behaves alike whichever URL a player was given.
+
+// fileETag is a strong validator for a file's content. Appends change the size and
+// replacing the content changes its hash, so both are part of it.
+func fileETag(fileStorage *FileStorage) string {
+	return fmt.Sprintf("\"%s-%s\"", fileStorage.ID, contentVersion(fileStorage))
+}
+
+// contentVersion identifies the current content of a file, for validators and caches of
+// what is derived from it: the size, followed by the start of the hash when there is one
+func contentVersion(fileStorage *FileStorage) string {
+	version := strconv.FormatInt(fileStorage.OriginalSize, 10)
+	if fileStorage.ContentHash != nil && len(*fileStorage.ContentHash) >= 12 {
+		version += "-" + (*fileStorage.ContentHash)[:12]
+	}
+	return version
+}
+
+// fileLastModified is when a file's content last changed
+func fileLastModified(fileStorage *FileStorage) time.Time {
+	if fileStorage.UpdatedAt.After(fileStorage.UploadTime) {
+		return fileStorage.UpdatedAt
+	}
+	return fileStorage.UploadTime
+}
+
+// setByteServingHeaders sets the validators and caching headers of a response carrying
+// a file's bytes. Nothing is cached past the file's expiry, and password-protected files
+// only by the browser.
+func (s *FileService) setByteServingHeaders(c *gin.Context, fileStorage *FileStorage) {
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("ETag", fileETag(fileStorage))
+	c.Header("Last-Modified", fileLastModified(fileStorage).UTC().Format(http.TimeFormat))
+	// Proxies such as the bundled nginx gzip text types, and ranges refer to the
+	// uncompressed bytes
+	c.Header("Vary", "Accept-Encoding")
+	maxAge := int64(fileStorage.ExpiresAt.Sub(s.clock.Now()).Seconds())
+	if maxAge > 3600 {
+		maxAge = 3600
+	} else if maxAge < 0 {
+		maxAge = 0
+	}
+	scope := "public"
+	if fileStorage.HasDownloadPassword {
+		scope = "private"
+	}
+	c.Header("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, maxAge))
+}
+
+// notModified answers a conditional request whose If-None-Match matches the file
+func notModified(c *gin.Context, fileStorage *FileStorage) bool {
+	match := c.GetHeader("If-None-Match")
+	if match == "" {
+		return false
+	}
+	etag := fileETag(fileStorage)
+	for _, candidate := range strings.Split(match, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches reports whether the Range header still applies: If-Range, when sent,
+// has to name the current strong ETag or the exact Last-Modified time
+func ifRangeMatches(c *gin.Context, fileStorage *FileStorage) bool {
+	ifRange := strings.TrimSpace(c.GetHeader("If-Range"))
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "\"") {
+		return ifRange == fileETag(fileStorage)
+	}
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+	when, err := http.ParseTime(ifRange)
+	return err == nil && fileLastModified(fileStorage).Truncate(time.Second).Equal(when)
+}
+
+// resolveRange decides how to answer a request for size bytes of fileStorage. With
+// partial set, the 206 headers are written and rangeSpec is the slice to send. Without
+// it the full content should be sent with 200: no Range, a malformed one, a stale
+// If-Range, or several ranges, which this server answers in full rather than as
+// multipart/byteranges. ok is false when a 416 has been written instead.
+func resolveRange(c *gin.Context, fileStorage *FileStorage, size int64) (rangeSpec files.Range, partial, ok bool) {
+	rangeHeader := c.GetHeader("Range")
+	if rangeHeader == "" || !ifRangeMatches(c, fileStorage) {
+		return files.Range{}, false, true
+	}
+
+	ranges, err := files.ParseRange(rangeHeader, size)
+	if errors.Is(err, files.ErrNotSatisfiable) {
+		// The full-size Content-Length set for a 200 doesn't describe the empty body
+		c.Writer.Header().Del("Content-Length")
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return files.Range{}, false, false
+	}
+	if err != nil || len(ranges) != 1 {
+		return files.Range{}, false, true
+	}
+
+	rangeSpec = ranges[0]
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeSpec.Start, rangeSpec.End, size))
+	c.Header("Content-Length", strconv.FormatInt(rangeSpec.End-rangeSpec.Start+1, 10))
+	c.Status(http.StatusPartialContent)
+	return rangeSpec, true, true
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Range conformance across the endpoints serving file bytes, following the requests
+// browsers send while playing and seeking media: Chrome opens with "bytes=0-" and seeks
+// with open-ended ranges, Safari probes with "bytes=0-1" before asking for the rest, and
+// resumed downloads add If-Range.
+
+const rangeTestSize = 4096
+
+func rangeTestContent() []byte {
+	content := make([]byte, rangeTestSize)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+	return content
+}
+
+// saveRangeTestFile stores content the way one of the storage paths keeps it
+func saveRangeTestFile(t *testing.T, ts *testService, id, storageType string, compression CompressionType, content []byte) *FileStorage {
+	t.Helper()
+	stored, err := ts.compressor.Compress(content, compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := ts.clock.Now()
+	compressedSize := int64(len(stored))
+	file := &FileStorage{
+		ID:              id,
+		Filename:        id + ".mp4",
+		OriginalSize:    int64(len(content)),
+		CompressedSize:  &compressedSize,
+		MimeType:        "video/mp4",
+		CompressionType: string(compression),
+		StorageType:     storageType,
+		UploadTime:      now,
+		ExpiresAt:       now.Add(24 * time.Hour),
+	}
+	if storageType == "disk" {
+		dir := filepath.Join(ts.config.TempDir, "files")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, id)
+		if err := os.WriteFile(path, stored, 0644); err != nil {
+			t.Fatal(err)
+		}
+		file.StoragePath = &path
+	} else {
+		file.FileContent = stored
+	}
+	if err := ts.store.SaveFile(file); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestRangeConformance(t *testing.T) {
+	content := rangeTestContent()
+	size := int64(len(content))
+	full := func(start, end int64) []byte { return content[start : end+1] }
+
+	ts := newTestService(t)
+	storages := []struct {
+		name        string
+		storageType string
+		compression CompressionType
+	}{
+		{"postgresql", "postgresql", CompressionNone},
+		{"disk", "disk", CompressionNone},
+		{"disk-gzip", "disk", CompressionGzip},
+	}
+	endpoints := []struct {
+		name    string
+		handler gin.HandlerFunc
+	}{
+		{"file", ts.getFile},
+		{"preview", ts.previewFile},
+		{"stream", ts.fastStreamFile},
+	}
+
+	for _, storage := range storages {
+		file := saveRangeTestFile(t, ts, "range-"+storage.name, storage.storageType, storage.compression, content)
+		etag := fileETag(file)
+		lastModified := file.UploadTime.UTC().Format(http.TimeFormat)
+
+		cases := []struct {
+			name         string
+			headers      map[string]string
+			status       int
+			contentRange string
+			body         []byte
+		}{
+			{"no range", nil, http.StatusOK, "", content},
+			{"chrome open", map[string]string{"Range": "bytes=0-"}, http.StatusPartialContent, fmt.Sprintf("bytes 0-%d/%d", size-1, size), content},
+			{"safari probe", map[string]string{"Range": "bytes=0-1"}, http.StatusPartialContent, fmt.Sprintf("bytes 0-1/%d", size), full(0, 1)},
+			{"seek", map[string]string{"Range": "bytes=1000-1999"}, http.StatusPartialContent, fmt.Sprintf("bytes 1000-1999/%d", size), full(1000, 1999)},
+			{"seek to end", map[string]string{"Range": "bytes=3000-"}, http.StatusPartialContent, fmt.Sprintf("bytes 3000-%d/%d", size-1, size), full(3000, size-1)},
+			{"moov atom at end", map[string]string{"Range": "bytes=-100"}, http.StatusPartialContent, fmt.Sprintf("bytes %d-%d/%d", size-100, size-1, size), full(size-100, size-1)},
+			{"end past size", map[string]string{"Range": "bytes=4000-99999"}, http.StatusPartialContent, fmt.Sprintf("bytes 4000-%d/%d", size-1, size), full(4000, size-1)},
+			{"last byte", map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", size-1, size-1)}, http.StatusPartialContent, fmt.Sprintf("bytes %d-%d/%d", size-1, size-1, size), full(size-1, size-1)},
+			{"start past end", map[string]string{"Range": fmt.Sprintf("bytes=%d-", size)}, http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("bytes */%d", size), nil},
+			{"malformed", map[string]string{"Range": "bytes=abc"}, http.StatusOK, "", content},
+			{"other unit", map[string]string{"Range": "items=0-1"}, http.StatusOK, "", content},
+			{"multiple ranges", map[string]string{"Range": "bytes=0-1,10-20"}, http.StatusOK, "", content},
+			{"if-range etag", map[string]string{"Range": "bytes=10-19", "If-Range": etag}, http.StatusPartialContent, fmt.Sprintf("bytes 10-19/%d", size), full(10, 19)},
+			{"if-range date", map[string]string{"Range": "bytes=10-19", "If-Range": lastModified}, http.StatusPartialContent, fmt.Sprintf("bytes 10-19/%d", size), full(10, 19)},
+			{"stale if-range", map[string]string{"Range": "bytes=10-19", "If-Range": "\"other\""}, http.StatusOK, "", content},
+			{"weak if-range", map[string]string{"Range": "bytes=10-19", "If-Range": "W/" + etag}, http.StatusOK, "", content},
+			{"if-none-match", map[string]string{"If-None-Match": etag}, http.StatusNotModified, "", nil},
+		}
+
+		for _, endpoint := range endpoints {
+			for _, tc := range cases {
+				name := storage.name + "/" + endpoint.name + "/" + tc.name
+				req := httptest.NewRequest(http.MethodGet, "/api/"+endpoint.name+"/"+file.ID, nil)
+				for key, value := range tc.headers {
+					req.Header.Set(key, value)
+				}
+				w := ts.serve(endpoint.handler, req, gin.Param{Key: "id", Value: file.ID})
+				resp := w.Result()
+
+				if resp.StatusCode != tc.status {
+					t.Errorf("%s: status %d, want %d", name, resp.StatusCode, tc.status)
+					continue
+				}
+				if got := resp.Header.Get("Content-Range"); got != tc.contentRange {
+					t.Errorf("%s: Content-Range %q, want %q", name, got, tc.contentRange)
+				}
+				if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+					t.Errorf("%s: Accept-Ranges %q, want bytes", name, got)
+				}
+				if got := resp.Header.Get("ETag"); got != etag {
+					t.Errorf("%s: ETag %q, want %q", name, got, etag)
+				}
+				if got := resp.Header.Get("Vary"); got == "" {
+					t.Errorf("%s: no Vary header", name)
+				}
+				if tc.status == http.StatusNotModified {
+					continue
+				}
+				if !bytes.Equal(w.Body.Bytes(), tc.body) {
+					t.Errorf("%s: body of %d bytes differs from the expected %d bytes", name, w.Body.Len(), len(tc.body))
+				}
+				if length := resp.Header.Get("Content-Length"); length != "" && length != strconv.Itoa(len(tc.body)) {
+					t.Errorf("%s: Content-Length %s for a body of %d bytes", name, length, len(tc.body))
+				}
+			}
+		}
+	}
+}
+
+func TestByteServingCacheControl(t *testing.T) {
+	ts := newTestService(t)
+	file := saveRangeTestFile(t, ts, "cached", "postgresql", CompressionNone, rangeTestContent())
+
+	w := ts.serve(ts.previewFile, httptest.NewRequest(http.MethodGet, "/api/preview/cached", nil), gin.Param{Key: "id", Value: file.ID})
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Cache-Control %q, want public, max-age=3600", got)
+	}
+
+	// Close to expiry the max-age shrinks so caches don't outlive the file
+	ts.clock.Advance(24*time.Hour - 10*time.Minute)
+	w = ts.serve(ts.previewFile, httptest.NewRequest(http.MethodGet, "/api/preview/cached", nil), gin.Param{Key: "id", Value: file.ID})
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=600" {
+		t.Errorf("near expiry: Cache-Control %q, want public, max-age=600", got)
+	}
+
+	password := "secret"
+	file.HasDownloadPassword = true
+	file.DownloadPassword = &password
+	if err := ts.store.SaveFile(file); err != nil {
+		t.Fatal(err)
+	}
+	w = ts.serve(ts.previewFile, httptest.NewRequest(http.MethodGet, "/api/preview/cached?password=secret", nil), gin.Param{Key: "id", Value: file.ID})
+	if got := w.Header().Get("Cache-Control"); got != "private, max-age=600" {
+		t.Errorf("protected: Cache-Control %q, want private, max-age=600", got)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"file-storage-service/internal/storage"
+)
+
+// Browsers can't play MKV or AVI files, but many of them hold H.264/AAC or VP9/Opus
+// streams that browsers play fine in another container. Such files are remuxed on
+// request: ffmpeg copies the streams into MP4 or WebM without re-encoding, which takes
+// seconds rather than the hours of a transcode. Remuxes are queued on a Redis stream and
+// run by job worker processes like HLS transcodes; the result is written next to the
+// original, as <id>.remux.mp4 or <id>.remux.webm, and removed by the periodic cleanup
+// once the file is gone.
+const (
+	remuxStream       = "media_remuxes"
+	remuxGroup        = "remuxers"
+	remuxQueuedPrefix = "remux_queued:" // Set while a remux is queued or running
+	remuxErrorPrefix  = "remux_error:"  // Last failure, kept for a day before a retry is allowed
+)
+
+// remuxSourceTypes are the containers browsers can't play that are worth remuxing
+var remuxSourceTypes = map[string]bool{
+	"video/x-matroska": true,
+	"video/x-msvideo":  true,
+	"video/avi":        true,
+}
+
+// MediaRemuxer consumes the remux queue
+type MediaRemuxer struct {
+	service  *FileService
+	consumer string
+}
+
+// NewMediaRemuxer returns a remuxer, or nil when REMUX_WORKERS is 0
+func NewMediaRemuxer(s *FileService) *MediaRemuxer {
+	if s.config.RemuxWorkers <= 0 {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	err := s.redis.XGroupCreateMkStream(context.Background(), remuxStream, remuxGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("Failed to create remux consumer group: %v", err)
+	}
+	return &MediaRemuxer{service: s, consumer: fmt.Sprintf("%s-%d", hostname, os.Getpid())}
+}
+
+// remuxTarget returns the container a file can be remuxed into for browser playback, mp4
+// or webm, or "" when it isn't an MKV or AVI file or its codecs need transcoding
+func remuxTarget(file *FileStorage, info *MediaInfo) string {
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if !remuxSourceTypes[file.MimeType] && ext != ".mkv" && ext != ".avi" {
+		return ""
+	}
+	if info.VideoCodec == "" {
+		return ""
+	}
+
+	switch info.VideoCodec {
+	case "h264":
+		switch info.AudioCodec {
+		case "", "aac", "mp3":
+			return "mp4"
+		}
+	case "vp8", "vp9", "av1":
+		switch info.AudioCodec {
+		case "", "opus", "vorbis":
+			return "webm"
+		}
+	}
+	return ""
+}
+
+// remuxPath returns where the remux of a file into format is stored
+func remuxPath(config *Config, file *FileStorage, format string) (string, error) {
+	return storageClassPath(config, StorageClass(file.StorageClass), file.ID+".remux."+format)
+}
+
+// Enqueue queues a remux unless one is already queued or running
+func (r *MediaRemuxer) Enqueue(fileID string) error {
+	ctx := context.Background()
+	queued, err := r.service.redis.SetNX(ctx, remuxQueuedPrefix+fileID, time.Now().Unix(), r.service.config.RemuxTimeout).Result()
+	if err != nil || !queued {
+		return err
+	}
+	return r.service.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: remuxStream,
+		Values: map[string]interface{}{"file_id": fileID},
+	}).Err()
+}
+
+// Run remuxes with the given number of concurrent workers until ctx is cancelled
+func (r *MediaRemuxer) Run(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go r.work(ctx)
+	}
+	<-ctx.Done()
+}
+
+func (r *MediaRemuxer) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		// Queued jobs wait in the stream while maintenance is deferred
+		if !r.service.awaitMaintenance(ctx, maintenanceRemux) {
+			return
+		}
+		streams, err := r.service.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    remuxGroup,
+			Consumer: r.consumer,
+			Streams:  []string{remuxStream, ">"},
+			Count:    1,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil && ctx.Err() == nil {
+				log.Printf("Failed to read remux stream: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				// A remux lost to a crash is queued again by the next request once its
+				// remux_queued key expires, so messages are acknowledged right away
+				r.service.redis.XAck(ctx, remuxStream, remuxGroup, message.ID)
+				fileID, _ := message.Values["file_id"].(string)
+				if fileID == "" {
+					continue
+				}
+				if err := r.remux(fileID); err != nil {
+					log.Printf("Remux of %s failed: %v", fileID, err)
+					r.service.redis.Set(ctx, remuxErrorPrefix+fileID, err.Error(), 24*time.Hour)
+				}
+				r.service.redis.Del(ctx, remuxQueuedPrefix+fileID)
+				r.service.maintenanceDone(maintenanceRemux)
+			}
+		}
+	}
+}
+
+// remux copies the streams of a file into a partial file and renames it into place when
+// ffmpeg is done, so an incomplete remux is never served
+func (r *MediaRemuxer) remux(fileID string) error {
+	s := r.service
+	file, err := s.db.GetFileMetadata(fileID)
+	if err != nil || file == nil {
+		return err
+	}
+
+	input, cleanup, err := s.mediaInputPath(file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	info, err := s.probeMedia(input)
+	if err != nil {
+		return err
+	}
+	format := remuxTarget(file, info)
+	if format == "" {
+		return fmt.Errorf("codecs %s/%s need transcoding", info.VideoCodec, info.AudioCodec)
+	}
+
+	path, err := remuxPath(s.config, file, format)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	partial := path + ".partial"
+
+	started := time.Now()
+	if _, err := runMediaTool(s.config.RemuxTimeout, s.config.FFmpegPath, remuxArgs(input, partial, format)...); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return err
+	}
+
+	s.redis.Del(context.Background(), remuxErrorPrefix+fileID)
+	log.Printf("Remuxed %s to %s in %s", fileID, format, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// remuxArgs builds the ffmpeg arguments copying the first video and audio stream of input
+// into format. AVI files often lack timestamps, which MP4 requires, so they are generated.
+func remuxArgs(input, output, format string) []string {
+	args := append([]string{"-v", "error", "-fflags", "+genpts"}, mediaInputArgs(input)...)
+	args = append(args,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-c", "copy",
+		"-sn", "-dn")
+	if format == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	return append(args, "-f", format, "-y", output)
+}
+
+// serveRemux serves the browser-playable remux of an MKV or AVI file. Until the remux is
+// done, it answers 202 and queues the remux if it isn't queued.
+//
+// @summary Get the browser-playable remux of a video
+// @tags media
+// @path id File ID
+// @success 200 video/mp4
+// @success 202 json The remux is still running
+// @auth downloadPassword adminToken optional
+func (s *FileService) serveRemux(c *gin.Context) {
+	file, ok := s.loadMediaFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if s.remuxer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Remuxing is not enabled"})
+		return
+	}
+
+	info, err := s.mediaInfo(file)
+	if err != nil {
+		mediaProcessingFailed(c, file.ID, err)
+		return
+	}
+	format := remuxTarget(file, info)
+	if format == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":       "File can't be remuxed for browser playback",
+			"message":     "Only MKV and AVI files with H.264/AAC or VP8, VP9, AV1/Opus streams are remuxed.",
+			"video_codec": info.VideoCodec,
+			"audio_codec": info.AudioCodec,
+		})
+		return
+	}
+
+	path, err := remuxPath(s.config, file, format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to locate remuxed file"})
+		return
+	}
+	f, err := openStoredFile(s.config, path, os.O_RDONLY)
+	if err != nil {
+		s.remuxNotReady(c, file)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read remuxed file"})
+		return
+	}
+
+	c.Header("Content-Type", "video/"+format)
+	c.Header("Cache-Control", "public, max-age=3600")
+	http.ServeContent(c.Writer, c.Request, filepath.Base(path), stat.ModTime(), f)
+}
+
+// remuxNotReady answers a request for a remux that hasn't finished
+func (s *FileService) remuxNotReady(c *gin.Context, file *FileStorage) {
+	ctx := context.Background()
+	if lastError, err := s.redis.Get(ctx, remuxErrorPrefix+file.ID).Result(); err == nil {
+		log.Printf("Remux of %s requested after a failed remux: %s", file.ID, lastError)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Remux failed",
+			"message":    "This video could not be remuxed. Download the original instead.",
+			"stream_url": "/api/stream/" + file.ID,
+		})
+		return
+	}
+
+	if err := s.remuxer.Enqueue(file.ID); err != nil {
+		log.Printf("Failed to queue remux of %s: %v", file.ID, err)
+	}
+	c.Header("Retry-After", "5")
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":     "processing",
+		"message":    "The video is being prepared for playback.",
+		"stream_url": "/api/stream/" + file.ID,
+	})
+}
+
+// cleanupRemuxes removes the remuxes of files that no longer exist and partial remuxes
+// abandoned by a crashed worker
+func (s *FileService) cleanupRemuxes() {
+	for _, dir := range s.config.storageDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			fileID, _, isRemux := strings.Cut(name, ".remux.")
+			if entry.IsDir() || !isRemux {
+				continue
+			}
+			path, err := storage.SafeJoin(dir, name)
+			if err != nil {
+				continue
+			}
+
+			if strings.HasSuffix(name, ".partial") {
+				if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > s.config.RemuxTimeout {
+					os.Remove(path)
+				}
+				continue
+			}
+			file, err := s.db.GetFileMetadata(fileID)
+			if err == nil && file == nil {
+				os.Remove(path)
+			}
+		}
+	}
+}
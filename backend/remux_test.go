@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRemuxTarget(t *testing.T) {
+	cases := []struct {
+		filename, mimeType string
+		video, audio       string
+		want               string
+	}{
+		{"movie.mkv", "video/x-matroska", "h264", "aac", "mp4"},
+		{"clip.avi", "application/octet-stream", "h264", "mp3", "mp4"},
+		{"talk.mkv", "video/x-matroska", "vp9", "opus", "webm"},
+		{"silent.mkv", "video/x-matroska", "av1", "", "webm"},
+		{"movie.mkv", "video/x-matroska", "h264", "ac3", ""},
+		{"old.avi", "video/x-msvideo", "mpeg4", "mp3", ""},
+		{"song.mkv", "video/x-matroska", "", "aac", ""},
+		{"movie.mp4", "video/mp4", "h264", "aac", ""},
+	}
+	for _, tc := range cases {
+		file := &FileStorage{Filename: tc.filename, MimeType: tc.mimeType}
+		info := &MediaInfo{VideoCodec: tc.video, AudioCodec: tc.audio}
+		if got := remuxTarget(file, info); got != tc.want {
+			t.Errorf("remuxTarget(%s, %s/%s) = %q, want %q", tc.filename, tc.video, tc.audio, got, tc.want)
+		}
+	}
+}
+
+func TestRemuxArgs(t *testing.T) {
+	args := strings.Join(remuxArgs("/in/movie", "/out/movie.remux.mp4.partial", "mp4"), " ")
+	for _, want := range []string{"-c copy", "-map 0:a:0?", "-movflags +faststart", "-f mp4 -y /out/movie.remux.mp4.partial", "-i file:/in/movie"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q lack %q", args, want)
+		}
+	}
+	if args := strings.Join(remuxArgs("/in/talk", "/out/talk.webm", "webm"), " "); strings.Contains(args, "faststart") {
+		t.Errorf("webm args %q use an MP4 flag", args)
+	}
+}
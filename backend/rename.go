@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// RenameRequest changes the name a file is served under
+type RenameRequest struct {
+	Filename string `json:"filename" binding:"required"`
+}
+
+// patchFile serves PATCH /api/file/:id, which appends to append-mode files when given an
+// offset and renames the file otherwise
+//
+// @summary Rename a file, or append to an append-mode file
+// @tags file
+// @path id File ID
+// @body json RenameRequest
+// @success 200 json
+// @auth deletePassword apiKey
+func (s *FileService) patchFile(c *gin.Context) {
+	if _, isAppend := c.GetQuery("offset"); isAppend {
+		s.appendToFile(c)
+		return
+	}
+	s.renameFile(c)
+}
+
+// renameFile lets the uploader of a file, proven by the delete password or an API key
+// that may manage it, change its stored filename. The name is normalized like uploaded
+// names and checked against the extension policies, since downloads and previews go by
+// it; the MIME type detected at upload is kept.
+func (s *FileService) renameFile(c *gin.Context) {
+	fileID := c.Param("id")
+
+	var req RenameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"message": "Give the new filename, or an offset query parameter to append.",
+		})
+		return
+	}
+	filename := files.NormalizeName(req.Filename)
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "Renaming requires the file's delete password.",
+		})
+		return
+	}
+
+	if filename == fileStorage.Filename {
+		c.JSON(http.StatusOK, gin.H{"message": "Filename unchanged", "file_id": fileID, "filename": filename})
+		return
+	}
+	if !checkExtensionPolicy(c, s.config, filename, fileStorage.OriginalSize) {
+		return
+	}
+	if !s.checkOrgPolicy(c, filename, fileStorage.HasDownloadPassword) {
+		return
+	}
+
+	if err := s.db.UpdateFileName(fileID, filename); err != nil {
+		log.Printf("Failed to rename %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename file"})
+		return
+	}
+	s.redis.Del(context.Background(), "file:"+fileID)
+	s.recordFileEvent(fileID, FileEventRenamed, gin.H{"from": fileStorage.Filename, "to": filename}, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "File renamed successfully",
+		"file_id":           fileID,
+		"filename":          filename,
+		"previous_filename": fileStorage.Filename,
+	})
+}
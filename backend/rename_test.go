@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenameFile(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.BlockedExtensions = []string{"exe"}
+	ts.saveTestFile(t, "draft", "hello", time.Hour)
+	param := gin.Param{Key: "id", Value: "draft"}
+
+	patch := func(query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/file/draft?delete_password=delete-me"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return ts.serve(ts.patchFile, req, param)
+	}
+
+	w := patch("", `{"filename":"../reports/Café ‮plan?.txt"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Filename         string `json:"filename"`
+		PreviousFilename string `json:"previous_filename"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Filename != "Café plan_.txt" || resp.PreviousFilename != "draft.txt" {
+		t.Errorf("renamed %q to %q", resp.PreviousFilename, resp.Filename)
+	}
+	if file, _ := ts.store.GetFileMetadata("draft"); file.Filename != "Café plan_.txt" {
+		t.Errorf("stored filename = %q", file.Filename)
+	}
+	if len(ts.store.events) != 1 || ts.store.events[0].Type != FileEventRenamed {
+		t.Errorf("events = %+v", ts.store.events)
+	}
+
+	if w := patch("", `{"filename":"setup.exe"}`); w.Code == http.StatusOK {
+		t.Error("renamed to a blocked extension")
+	}
+	req := httptest.NewRequest(http.MethodPatch, "/api/file/draft", strings.NewReader(`{"filename":"x.txt"}`))
+	if w := ts.serve(ts.patchFile, req, param); w.Code != http.StatusUnauthorized {
+		t.Errorf("without the delete password: got %d, want 401", w.Code)
+	}
+}
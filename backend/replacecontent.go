@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// replaceFileContent lets the uploader of a file, proven by the delete password or an API
+// key that may manage it, push a new version of its content under the same ID and URL.
+// The name, passwords, storage class and expiry are kept. The old content is kept as a
+// version for VERSION_RETENTION; everything derived from it, like posters, rendered pages
+// and HLS renditions, is discarded.
+//
+// @summary Upload a new version of a file
+// @tags file
+// @path id File ID
+// @form file file required The new content
+// @form file_hash string Expected SHA-256 of the content
+// @header X-Content-SHA256 Expected SHA-256 of the content, when file_hash isn't given
+// @success 200 json
+// @auth deletePassword apiKey
+func (s *FileService) replaceFileContent(c *gin.Context) {
+	release, ok := s.acquireUploadSlot(c)
+	if !ok {
+		return
+	}
+	defer release()
+
+	fileID := c.Param("id")
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "Replacing the content requires the file's delete password.",
+		})
+		return
+	}
+	if fileStorage.AppendState != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Append-mode files can't be replaced"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > s.config.ChunkThreshold || header.Size > s.config.maxFileSizeFor(fileStorage.Filename) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large to replace",
+			"message":  "Replacement content is limited to the size of a standard upload.",
+			"max_size": s.config.ChunkThreshold,
+		})
+		return
+	}
+	// Only growth counts against the storage quota
+	if growth := header.Size - fileStorage.OriginalSize; growth > 0 {
+		if _, ok := s.checkStorageQuota(c, growth); !ok {
+			return
+		}
+	}
+
+	hasher := sha256.New()
+	content, err := io.ReadAll(io.TeeReader(file, hasher))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	contentHash := hex.EncodeToString(hasher.Sum(nil))
+	expectedHash := c.PostForm("file_hash")
+	if expectedHash == "" {
+		expectedHash = c.GetHeader("X-Content-SHA256")
+	}
+	if !verifyContentHash(c, header.Filename, expectedHash, contentHash) {
+		return
+	}
+
+	scanResult, ok := s.scanUpload(c, fileStorage.Filename, content)
+	if !ok {
+		return
+	}
+
+	archived, err := s.archiveContent(fileStorage)
+	if err != nil {
+		log.Printf("Failed to keep the previous content of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to keep the previous version"})
+		return
+	}
+
+	replaced, ok := s.storeReplacementContent(c, fileStorage, content, contentHash, scanResult)
+	if !ok {
+		s.restoreContent(fileStorage, archived)
+		return
+	}
+
+	if archived != nil {
+		if err := s.db.SaveFileVersion(archived); err != nil {
+			log.Printf("Failed to save version %d of %s: %v", archived.Version, fileID, err)
+			if archived.StoragePath != nil {
+				s.removeVersionContent([]string{*archived.StoragePath})
+			}
+		}
+	} else if fileStorage.StoragePath != nil && (replaced.StoragePath == nil || *replaced.StoragePath != *fileStorage.StoragePath) {
+		// Drop the old content when it lived elsewhere than the new one
+		if err := removeStoredFile(s.config, *fileStorage.StoragePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete replaced content of %s: %v", fileID, err)
+		}
+	}
+	s.dropDerivedContent(fileStorage)
+	s.queueHLSTranscode(fileID, fileStorage.MimeType, replaced.OriginalSize)
+
+	previousHash := ""
+	if fileStorage.ContentHash != nil {
+		previousHash = *fileStorage.ContentHash
+	}
+	s.recordFileEvent(fileID, FileEventContentReplaced, gin.H{
+		"version":         replaced.Version,
+		"previous_size":   fileStorage.OriginalSize,
+		"previous_sha256": previousHash,
+		"size":            replaced.OriginalSize,
+		"sha256":          contentHash,
+	}, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "File content replaced successfully",
+		"file_id":         fileID,
+		"version":         replaced.Version,
+		"size":            replaced.OriginalSize,
+		"sha256":          contentHash,
+		"previous_size":   fileStorage.OriginalSize,
+		"previous_sha256": previousHash,
+		"expires_at":      fileStorage.ExpiresAt,
+	})
+}
+
+// storeReplacementContent compresses and stores new content for a file the way its
+// storage class stores uploads, writing disk content next to the final path and renaming
+// it into place so readers never see a partial file
+func (s *FileService) storeReplacementContent(c *gin.Context, fileStorage *FileStorage, content []byte, contentHash string, scanResult *ScanResult) (*FileStorage, bool) {
+	size := int64(len(content))
+	storageClass := StorageClass(fileStorage.StorageClass)
+	compressionType := compressionForClass(s.compressor, storageClass, fileStorage.Filename, size)
+	compressedContent, err := s.compressor.Compress(content, compressionType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compress file"})
+		return nil, false
+	}
+	compressedSize := int64(len(compressedContent))
+
+	replaced := *fileStorage
+	replaced.OriginalSize = size
+	replaced.CompressedSize = &compressedSize
+	replaced.CompressionType = string(compressionType)
+	replaced.ContentHash = &contentHash
+	replaced.Version = fileStorage.Version + 1
+	replaced.ScanResult = scanResult
+	replaced.ImageInfo = nil
+	if files.IsImageFile(fileStorage.MimeType) {
+		replaced.ImageInfo = extractImageInfo(content)
+	}
+
+	if storeOnDisk(storageClass, size) {
+		diskPath, err := storageClassPath(s.config, storageClass, fileStorage.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file to disk"})
+			return nil, false
+		}
+		partialPath := diskPath + ".replace"
+		if err := os.WriteFile(partialPath, compressedContent, 0644); err != nil {
+			os.Remove(partialPath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file to disk"})
+			return nil, false
+		}
+		if err := os.Rename(partialPath, diskPath); err != nil {
+			os.Remove(partialPath)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file to disk"})
+			return nil, false
+		}
+		replaced.StorageType = "disk"
+		replaced.StoragePath = &diskPath
+		replaced.FileContent = nil
+	} else {
+		replaced.StorageType = "postgresql"
+		replaced.StoragePath = nil
+		replaced.FileContent = compressedContent
+	}
+
+	if err := s.db.ReplaceFileContent(&replaced); err != nil {
+		log.Printf("Failed to replace content of %s: %v", fileStorage.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return nil, false
+	}
+	s.redis.Del(context.Background(), "file:"+fileStorage.ID)
+	return &replaced, true
+}
+
+// dropDerivedContent discards what was generated from a file's previous content: cached
+// posters, media info, rendered and oriented previews, segment plans, remuxes and HLS
+// renditions. They are generated again from the new content on the next request.
+func (s *FileService) dropDerivedContent(file *FileStorage) {
+	ctx := context.Background()
+	keys := []string{
+		"media:poster:" + file.ID,
+		"media:info:" + file.ID,
+		"preview:oriented:" + file.ID,
+		"pdf:pages:" + file.ID,
+		hlsQueuedPrefix + file.ID,
+		hlsErrorPrefix + file.ID,
+		remuxQueuedPrefix + file.ID,
+		remuxErrorPrefix + file.ID,
+	}
+	// Rendered pages and segment plans are cached per page and per segment size
+	for _, pattern := range []string{"pdf:page:" + file.ID + ":*", segmentPlanCachePrefix + file.ID + ":*"} {
+		if matched, err := s.redis.Keys(ctx, pattern).Result(); err == nil {
+			keys = append(keys, matched...)
+		}
+	}
+	s.redis.Del(ctx, keys...)
+
+	if dir, err := hlsDir(s.config, file); err == nil {
+		os.RemoveAll(dir)
+	}
+	for _, format := range []string{"mp4", "webm"} {
+		if path, err := remuxPath(s.config, file, format); err == nil {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReplaceFileContent(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "report", "first draft", time.Hour)
+	param := gin.Param{Key: "id", Value: "report"}
+
+	get := func() *httptest.ResponseRecorder {
+		return ts.serve(ts.getFile, httptest.NewRequest(http.MethodGet, "/api/file/report", nil), param)
+	}
+	put := func(query, content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", "report-v2.txt")
+		part.Write([]byte(content))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPut, "/api/file/report/content"+query, &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return ts.serve(ts.replaceFileContent, req, param)
+	}
+
+	before := get().Header().Get("ETag")
+	ts.redis.Set(context.Background(), segmentPlanCachePrefix+"report:4", "{}", 0)
+
+	if w := put("", "stolen"); w.Code != http.StatusUnauthorized {
+		t.Errorf("without the delete password: got %d, want 401", w.Code)
+	}
+
+	w := put("?delete_password=delete-me", "final version")
+	if w.Code != http.StatusOK {
+		t.Fatalf("replace: got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = get()
+	if w.Code != http.StatusOK || w.Body.String() != "final version" {
+		t.Fatalf("after replacing: got %d %q", w.Code, w.Body.String())
+	}
+	if etag := w.Header().Get("ETag"); etag == before {
+		t.Errorf("ETag %s didn't change with the content", etag)
+	}
+
+	file, _ := ts.store.GetFileMetadata("report")
+	sum := sha256.Sum256([]byte("final version"))
+	if file.ContentHash == nil || *file.ContentHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("content hash = %v", file.ContentHash)
+	}
+	if ts.redis.Exists(context.Background(), segmentPlanCachePrefix+"report:4").Val() != 0 {
+		t.Error("segment plan of the old content still cached")
+	}
+	if file.Filename != "report.txt" {
+		t.Errorf("filename = %q, want it kept", file.Filename)
+	}
+	if len(ts.store.events) != 1 || ts.store.events[0].Type != FileEventContentReplaced {
+		t.Errorf("events = %+v", ts.store.events)
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/storage"
+)
+
+// Replication copies files to a secondary database and storage directory for disaster
+// recovery. A trigger on files records every insert, update and delete in replication_log;
+// the instance holding replicationLockKey copies the current state of each changed file
+// to the secondary and removes the applied log entries.
+const (
+	replicationLockKey   = "replication_lock"
+	replicationErrorKey  = "replication:last_error"
+	replicationLockTTL   = 10 * time.Minute
+	replicationBatchSize = 100
+)
+
+// Replicator applies file changes from the primary database to the secondary
+type Replicator struct {
+	service *FileService
+	replica *Database
+}
+
+// NewReplicator connects to the secondary database and prepares its schema
+func NewReplicator(s *FileService) (*Replicator, error) {
+	replica, err := NewReplicaDatabase(s.config)
+	if err != nil {
+		return nil, err
+	}
+	if err := replica.EnsureSchema(); err != nil {
+		replica.Close()
+		return nil, err
+	}
+	if err := os.MkdirAll(s.config.ReplicaStorageDir, 0755); err != nil {
+		replica.Close()
+		return nil, err
+	}
+	return &Replicator{service: s, replica: replica}, nil
+}
+
+// Run replicates pending changes every ReplicationInterval
+func (r *Replicator) Run() {
+	ticker := time.NewTicker(r.service.config.ReplicationInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.service.runMaintenance(maintenanceReplication, func() {
+			if err := r.replicatePending(); err != nil {
+				log.Printf("Replication failed: %v", err)
+				r.service.redis.Set(context.Background(), replicationErrorKey, err.Error(), 24*time.Hour)
+			}
+		})
+	}
+}
+
+// replicatePending applies pending changes while this instance holds the replication
+// lock. A secondary seen for the first time gets every active file queued first.
+func (r *Replicator) replicatePending() error {
+	ctx := context.Background()
+	token := generateID()
+
+	acquired, err := r.service.redis.SetNX(ctx, replicationLockKey, token, replicationLockTTL).Result()
+	if err != nil || !acquired {
+		return err
+	}
+	defer releaseAppendLockScript.Run(ctx, r.service.redis, []string{replicationLockKey}, token)
+
+	state, err := r.replica.GetReplicationState()
+	if err != nil {
+		return err
+	}
+	if state.PromotedAt != nil {
+		return fmt.Errorf("secondary was promoted at %s, not replicating into it", state.PromotedAt.Format(time.RFC3339))
+	}
+	if state.SeededAt == nil {
+		queued, err := r.service.db.SeedReplicationLog()
+		if err != nil {
+			return err
+		}
+		if err := r.replica.MarkReplicationSeeded(); err != nil {
+			return err
+		}
+		log.Printf("Queued %d existing files for replication", queued)
+	}
+
+	// Stop well before the lock expires, so another instance never applies changes concurrently
+	started := time.Now()
+	for time.Since(started) < replicationLockTTL/2 {
+		changes, err := r.service.db.GetReplicationChanges(replicationBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		// Each file's current state is copied, so later changes to a file already copied
+		// in this batch are covered too
+		var lastApplied int64
+		copied := make(map[string]bool)
+		for _, change := range changes {
+			if !copied[change.FileID] {
+				if err := r.replicateFile(change.FileID); err != nil {
+					r.ack(lastApplied)
+					return fmt.Errorf("failed to replicate file %s: %v", change.FileID, err)
+				}
+				copied[change.FileID] = true
+			}
+			lastApplied = change.ID
+		}
+		if err := r.ack(lastApplied); err != nil {
+			return err
+		}
+		r.service.redis.Del(ctx, replicationErrorKey)
+	}
+	return nil
+}
+
+// ack removes the applied changes from the log and records the progress on the secondary
+func (r *Replicator) ack(lastApplied int64) error {
+	if lastApplied == 0 {
+		return nil
+	}
+	if err := r.service.db.AckReplicationChanges(lastApplied); err != nil {
+		return err
+	}
+	return r.replica.MarkReplicationApplied()
+}
+
+// replicateFile copies the current state of a file to the secondary, or removes it there
+// when it no longer exists on the primary
+func (r *Replicator) replicateFile(fileID string) error {
+	replicaPath, err := storage.SafeJoin(r.service.config.ReplicaStorageDir, fileID)
+	if err != nil {
+		return err
+	}
+
+	file, err := r.service.db.GetFileForReplication(fileID)
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		if err := r.replica.DeleteReplicatedFile(fileID); err != nil {
+			return err
+		}
+		if err := os.Remove(replicaPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	// Disk-stored content goes to the replica storage directory, which the secondary's
+	// row points at until it is promoted
+	if file.StoragePath != nil {
+		if err := r.copyStoredFile(*file.StoragePath, replicaPath); err != nil {
+			return err
+		}
+		file.StoragePath = &replicaPath
+	}
+
+	return r.replica.UpsertReplicatedFile(file)
+}
+
+// copyStoredFile copies a disk-stored file unless an up-to-date copy already exists, so
+// metadata changes such as a new expiration don't copy the content again
+func (r *Replicator) copyStoredFile(sourcePath, replicaPath string) error {
+	source, err := openStoredFile(r.service.config, sourcePath, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	sourceInfo, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	if replicaInfo, err := os.Stat(replicaPath); err == nil &&
+		replicaInfo.Size() == sourceInfo.Size() && !replicaInfo.ModTime().Before(sourceInfo.ModTime()) {
+		return nil
+	}
+
+	return copyFileAtomically(source, replicaPath)
+}
+
+// copyFileAtomically writes the content of source to a temporary file next to path and
+// renames it into place, so a partial copy is never visible at path
+func copyFileAtomically(source io.Reader, path string) error {
+	partialPath := path + ".partial"
+	partial, err := os.Create(partialPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(partial, source); err != nil {
+		partial.Close()
+		os.Remove(partialPath)
+		return err
+	}
+	if err := partial.Sync(); err != nil {
+		partial.Close()
+		os.Remove(partialPath)
+		return err
+	}
+	if err := partial.Close(); err != nil {
+		os.Remove(partialPath)
+		return err
+	}
+	return os.Rename(partialPath, path)
+}
+
+// moveFile moves a file, copying it when source and destination are on different filesystems
+func moveFile(sourcePath, destPath string) error {
+	if err := os.Rename(sourcePath, destPath); err == nil {
+		return nil
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := copyFileAtomically(source, destPath); err != nil {
+		return err
+	}
+	return os.Remove(sourcePath)
+}
+
+// promoteSecondary makes the secondary usable as the primary after the primary region is
+// lost: replicated files are moved from REPLICA_STORAGE_DIR into the storage class
+// directories of this configuration and replication into the secondary is stopped.
+// Afterwards, point DATABASE_URL at the former REPLICA_DATABASE_URL and start the service.
+func promoteSecondary(config *Config) error {
+	if config.ReplicaDatabaseURL == "" {
+		return fmt.Errorf("REPLICA_DATABASE_URL is not set")
+	}
+
+	replica, err := NewReplicaDatabase(config)
+	if err != nil {
+		return err
+	}
+	defer replica.Close()
+
+	if err := replica.EnsureSchema(); err != nil {
+		return err
+	}
+
+	state, err := replica.GetReplicationState()
+	if err != nil {
+		return err
+	}
+	if state.LastAppliedAt != nil {
+		log.Printf("Last change replicated at %s", state.LastAppliedAt.Format(time.RFC3339))
+	}
+
+	files, err := replica.ListDiskFilePaths()
+	if err != nil {
+		return err
+	}
+
+	moved, missing := 0, 0
+	for _, file := range files {
+		target, err := storageClassPath(config, StorageClass(file.StorageClass), file.ID)
+		if err != nil {
+			return err
+		}
+		if *file.StoragePath == target {
+			continue
+		}
+
+		source, err := storage.SafeJoin(config.ReplicaStorageDir, file.ID)
+		if err != nil {
+			return err
+		}
+		if err := moveFile(source, target); err != nil {
+			if os.IsNotExist(err) {
+				log.Printf("Content of file %s was not replicated, it will be unavailable", file.ID)
+				missing++
+				continue
+			}
+			return fmt.Errorf("failed to move file %s: %v", file.ID, err)
+		}
+		if err := replica.UpdateStoragePath(file.ID, target); err != nil {
+			return err
+		}
+		moved++
+	}
+
+	// The path updates above are local changes with nowhere to replicate to yet
+	if err := replica.ClearReplicationLog(); err != nil {
+		return err
+	}
+	if err := replica.MarkReplicaPromoted(); err != nil {
+		return err
+	}
+
+	log.Printf("Secondary promoted: moved %d files into storage, %d missing", moved, missing)
+	log.Printf("Set DATABASE_URL to the former REPLICA_DATABASE_URL and unset REPLICA_DATABASE_URL before starting the service")
+	return nil
+}
+
+// getReplicationStatus reports how far the secondary lags behind the primary
+//
+// @summary Get the replication status
+// @tags admin
+// @success 200 json
+// @auth adminToken adminPassword
+func (s *FileService) getReplicationStatus(c *gin.Context) {
+	if s.replicator == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	pending, oldest, err := s.db.GetReplicationBacklog()
+	if err != nil {
+		log.Printf("Failed to get replication backlog: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	state, err := s.replicator.replica.GetReplicationState()
+	if err != nil {
+		log.Printf("Failed to get replication state: %v", err)
+		respondRetryLater(c, http.StatusServiceUnavailable, errorCodeDependencyUnavailable, retryAfterDependency, gin.H{
+			"error": "Replica database unavailable",
+		})
+		return
+	}
+
+	// Lag is the age of the oldest change not yet copied; zero when caught up
+	var lagSeconds float64
+	if oldest != nil {
+		lagSeconds = time.Since(*oldest).Seconds()
+	}
+	lastError, _ := s.redis.Get(context.Background(), replicationErrorKey).Result()
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":           true,
+		"pending_changes":   pending,
+		"oldest_pending_at": oldest,
+		"lag_seconds":       lagSeconds,
+		"seeded_at":         state.SeededAt,
+		"last_applied_at":   state.LastAppliedAt,
+		"promoted_at":       state.PromotedAt,
+		"last_error":        lastError,
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes of responses telling the client to come back later. They are sent in the
+// error_code field and the X-Error-Code header along with Retry-After, so clients can
+// back off the same way whichever limit they ran into.
+const (
+	errorCodeRateLimited           = "rate_limited"
+	errorCodeQuotaExceeded         = "quota_exceeded"
+	errorCodeEgressQuotaExceeded   = "egress_quota_exceeded"
+	errorCodeEmailLimitExceeded    = "email_limit_exceeded"
+	errorCodeServerBusy            = "server_busy"
+	errorCodeDiskFull              = "disk_full"
+	errorCodeDependencyUnavailable = "dependency_unavailable"
+	errorCodeNotConfigured         = "not_configured"
+	errorCodeBlocked               = "blocked"
+	errorCodeScanPending           = "scan_pending"
+	errorCodeUnavailable           = "unavailable" // 503 without a more specific code
+)
+
+// errorCodeHeader carries the error code of responses with Retry-After
+const errorCodeHeader = "X-Error-Code"
+
+// Suggested backoffs where the server can't tell when the condition ends
+const (
+	retryAfterBusy          = 5 * time.Second  // A semaphore or queue is full
+	retryAfterDependency    = 10 * time.Second // Redis, the replica or the scanner failed
+	retryAfterQuota         = time.Hour        // Stored files free up as they expire
+	retryAfterNotConfigured = time.Hour        // Takes an operator to change
+)
+
+// retryAfterSeconds rounds a backoff up to whole seconds, at least one
+func retryAfterSeconds(delay time.Duration) int {
+	return max(int(math.Ceil(delay.Seconds())), 1)
+}
+
+// respondRetryLater answers a request the server can't take now, usually with 429 or
+// 503, telling the client how long to wait and why. The fields of body are sent along
+// with error_code and retry_after_seconds, and the request is aborted.
+func respondRetryLater(c *gin.Context, status int, code string, delay time.Duration, body gin.H) {
+	seconds := retryAfterSeconds(delay)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.Header(errorCodeHeader, code)
+	body["error_code"] = code
+	body["retry_after_seconds"] = seconds
+	c.AbortWithStatusJSON(status, body)
+}
+
+// retryAfterWriter adds Retry-After and an error code to 429 and 503 responses written
+// without them
+type retryAfterWriter struct {
+	gin.ResponseWriter
+}
+
+func (w *retryAfterWriter) WriteHeader(status int) {
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		header := w.Header()
+		if header.Get("Retry-After") == "" {
+			header.Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfterBusy)))
+		}
+		if header.Get(errorCodeHeader) == "" {
+			header.Set(errorCodeHeader, defaultRetryErrorCode(status))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// defaultRetryErrorCode is the error code of a 429 or 503 that was answered without one
+func defaultRetryErrorCode(status int) string {
+	if status == http.StatusTooManyRequests {
+		return errorCodeRateLimited
+	}
+	return errorCodeUnavailable
+}
+
+// Unwrap lets http.ResponseController reach the connection for flushes and deadlines
+func (w *retryAfterWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// retryAfterMiddleware makes sure every 429 and 503 tells the client when to retry, also
+// for responses written without respondRetryLater
+func retryAfterMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer = &retryAfterWriter{ResponseWriter: c.Writer}
+		c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondRetryLater(t *testing.T) {
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		respondRetryLater(c, http.StatusServiceUnavailable, errorCodeServerBusy, 1500*time.Millisecond, gin.H{
+			"error": "Server busy, please try again later",
+		})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" || w.Header().Get(errorCodeHeader) != "server_busy" {
+		t.Fatalf("got %d with Retry-After %q and code %q", w.Code, w.Header().Get("Retry-After"), w.Header().Get(errorCodeHeader))
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+	if body["error_code"] != "server_busy" || body["retry_after_seconds"] != 2.0 || body["error"] == nil {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestRetryAfterMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(retryAfterMiddleware())
+	router.GET("/unavailable", func(c *gin.Context) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unavailable"})
+	})
+	router.GET("/limited", func(c *gin.Context) {
+		c.Header("Retry-After", "30")
+		c.Status(http.StatusTooManyRequests)
+	})
+	router.GET("/ok", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for path, want := range map[string][2]string{
+		"/unavailable": {"5", "unavailable"},
+		"/limited":     {"30", "rate_limited"},
+		"/ok":          {"", ""},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := [2]string{w.Header().Get("Retry-After"), w.Header().Get(errorCodeHeader)}; got != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestCORSExposesBackoffHeaders(t *testing.T) {
+	router := gin.New()
+	router.Use(corsMiddleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	exposed := strings.Split(w.Header().Get("Access-Control-Expose-Headers"), ", ")
+	for _, header := range []string{"Retry-After", errorCodeHeader, "X-RateLimit-Limit", "X-RateLimit-Remaining", "Content-Range"} {
+		if !slices.Contains(exposed, header) {
+			t.Errorf("%s not exposed: %v", header, exposed)
+		}
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.SpeedTestRateLimit = 1
+	router := gin.New()
+	router.Use(rateLimitMiddleware(ts.config, ts.rateLimiter))
+	router.GET("/api/speedtest/ping", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/speedtest/ping", nil))
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(errorCodeHeader) != "rate_limited" {
+		t.Fatalf("got %d with code %q", w.Code, w.Header().Get(errorCodeHeader))
+	}
+	if seconds := w.Header().Get("Retry-After"); seconds != "60" {
+		t.Errorf("Retry-After = %q, want 60", seconds)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func isFontFile(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "font/")
+}
+
+func isModelFile(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "model/")
+}
+
+// maxSpecimenFontSize bounds the font embedded in a specimen, which is base64-encoded into it
+const maxSpecimenFontSize = 32 * 1024 * 1024
+
+// serveFontSpecimen renders a specimen image for a font. The font is embedded in an SVG
+// as a data URI so the specimen displays anywhere an image can, with no server-side rasterizer.
+func (s *FileService) serveFontSpecimen(c *gin.Context, fileStorage *FileStorage, metadata FileMetadata) {
+	etag := metadata.ID + "-" + contentVersion(fileStorage) + "-specimen"
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", etag))
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Trim(match, "\"") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if metadata.Size > maxSpecimenFontSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Font too large for a specimen preview"})
+		return
+	}
+
+	content, err := s.loadFileContent(fileStorage, metadata)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	fontURI := "data:" + metadata.MimeType + ";base64," + base64.StdEncoding.EncodeToString(content)
+	title := html.EscapeString(metadata.Filename)
+
+	var svg strings.Builder
+	svg.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="960" height="480" viewBox="0 0 960 480">`)
+	svg.WriteString(`<style>@font-face{font-family:"Specimen";src:url("` + fontURI + `");}`)
+	svg.WriteString(`.s{font-family:"Specimen",sans-serif;fill:#111}.l{font-family:sans-serif;font-size:14px;fill:#888}</style>`)
+	svg.WriteString(`<rect width="100%" height="100%" fill="#fff"/>`)
+	svg.WriteString(`<text x="32" y="40" class="l">` + title + `</text>`)
+	svg.WriteString(`<text x="32" y="140" class="s" font-size="96">Aa Bb Cc</text>`)
+	svg.WriteString(`<text x="32" y="230" class="s" font-size="40">ABCDEFGHIJKLMNOPQRSTUVWXYZ</text>`)
+	svg.WriteString(`<text x="32" y="290" class="s" font-size="40">abcdefghijklmnopqrstuvwxyz</text>`)
+	svg.WriteString(`<text x="32" y="350" class="s" font-size="40">0123456789 !?&amp;@#%</text>`)
+	svg.WriteString(`<text x="32" y="430" class="s" font-size="24">The quick brown fox jumps over the lazy dog.</text>`)
+	svg.WriteString(`</svg>`)
+
+	c.Data(http.StatusOK, "image/svg+xml", []byte(svg.String()))
+}
+
+var modelViewerTemplate = template.Must(template.New("viewer").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Filename}}</title>
+<style>html,body{margin:0;height:100%;background:#1e1e1e;overflow:hidden}#status{position:absolute;top:12px;left:12px;color:#ccc;font:14px sans-serif}</style>
+<script type="importmap">{"imports":{"three":"/vendor/three/build/three.module.js","three/addons/":"/vendor/three/examples/jsm/"}}</script>
+</head>
+<body>
+<div id="status">Loading {{.Filename}}…</div>
+<script type="module">
+import * as THREE from "three";
+import { OrbitControls } from "three/addons/controls/OrbitControls.js";
+import { GLTFLoader } from "three/addons/loaders/GLTFLoader.js";
+import { OBJLoader } from "three/addons/loaders/OBJLoader.js";
+import { STLLoader } from "three/addons/loaders/STLLoader.js";
+
+const modelURL = {{.ModelURL}};
+const mimeType = {{.MimeType}};
+const status = document.getElementById("status");
+
+const renderer = new THREE.WebGLRenderer({ antialias: true });
+renderer.setSize(window.innerWidth, window.innerHeight);
+renderer.domElement.setAttribute("role", "img");
+renderer.domElement.setAttribute("aria-label", {{.Label}});
+document.body.appendChild(renderer.domElement);
+
+const scene = new THREE.Scene();
+scene.add(new THREE.HemisphereLight(0xffffff, 0x444444, 2));
+const light = new THREE.DirectionalLight(0xffffff, 1.5);
+light.position.set(5, 10, 7);
+scene.add(light);
+
+const camera = new THREE.PerspectiveCamera(45, window.innerWidth / window.innerHeight, 0.01, 10000);
+const controls = new OrbitControls(camera, renderer.domElement);
+
+function show(object) {
+  scene.add(object);
+  const box = new THREE.Box3().setFromObject(object);
+  const size = box.getSize(new THREE.Vector3()).length() || 1;
+  const center = box.getCenter(new THREE.Vector3());
+  controls.target.copy(center);
+  camera.position.copy(center).add(new THREE.Vector3(size, size * 0.6, size));
+  camera.near = size / 100;
+  camera.far = size * 100;
+  camera.updateProjectionMatrix();
+  status.remove();
+}
+
+function fail(err) {
+  status.textContent = "Failed to load model: " + err;
+}
+
+if (mimeType === "model/obj") {
+  new OBJLoader().load(modelURL, show, undefined, fail);
+} else if (mimeType === "model/stl") {
+  new STLLoader().load(modelURL, (geometry) => {
+    show(new THREE.Mesh(geometry, new THREE.MeshStandardMaterial({ color: 0xbbbbbb })));
+  }, undefined, fail);
+} else {
+  new GLTFLoader().load(modelURL, (gltf) => show(gltf.scene), undefined, fail);
+}
+
+window.addEventListener("resize", () => {
+  camera.aspect = window.innerWidth / window.innerHeight;
+  camera.updateProjectionMatrix();
+  renderer.setSize(window.innerWidth, window.innerHeight);
+});
+
+renderer.setAnimationLoop(() => {
+  controls.update();
+  renderer.render(scene, camera);
+});
+</script>
+</body>
+</html>
+`))
+
+// serveModelViewer returns an embeddable page that renders a 3D model with three.js. The
+// model itself is fetched from the regular preview endpoint, so .gltf files must embed
+// their buffers (or use .glb) to render.
+func (s *FileService) serveModelViewer(c *gin.Context, fileID string, metadata FileMetadata) {
+	modelURL := "/api/preview/" + url.PathEscape(fileID)
+	query := url.Values{}
+	if password := c.Query("password"); password != "" {
+		query.Set("password", password)
+	}
+	if adminToken := c.Query("admin_token"); adminToken != "" {
+		query.Set("admin_token", adminToken)
+	}
+	if len(query) > 0 {
+		modelURL += "?" + query.Encode()
+	}
+
+	// The viewer loads the vendored three.js from /vendor and may be embedded by the frontend
+	c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data: blob:; connect-src 'self' blob:; frame-ancestors 'self'")
+	c.Header("X-Frame-Options", "SAMEORIGIN")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	// Screen readers announce the canvas by the uploader's description, or else the name
+	label := metadata.Accessibility.label()
+	if label == "" {
+		label = metadata.Filename
+	}
+
+	err := modelViewerTemplate.Execute(c.Writer, map[string]string{
+		"Filename": metadata.Filename,
+		"ModelURL": modelURL,
+		"MimeType": metadata.MimeType,
+		"Label":    label,
+	})
+	if err != nil {
+		log.Printf("serveModelViewer: failed to render viewer for %s: %v", fileID, err)
+	}
+}
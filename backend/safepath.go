@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+
+	"file-storage-service/internal/storage"
+)
+
+// fileStoragePath returns the disk path for a stored file
+func fileStoragePath(tempDir, fileID string) (string, error) {
+	return storage.SafeJoin(tempDir, "files", fileID)
+}
+
+// validateStoragePath checks that a storage path read from the database points inside
+// one of the storage directories before it is read or removed
+func validateStoragePath(config *Config, path string) error {
+	return storage.ValidatePath(config.storageDirs(), path)
+}
+
+// openStoredFile opens a file whose path came from the database after checking it with
+// validateStoragePath
+func openStoredFile(config *Config, path string, flag int) (*os.File, error) {
+	if err := validateStoragePath(config, path); err != nil {
+		return nil, err
+	}
+	injectDiskDelay()
+	return os.OpenFile(path, flag, 0644)
+}
+
+// readStoredFile reads a file whose path came from the database
+func readStoredFile(config *Config, path string) ([]byte, error) {
+	if err := validateStoragePath(config, path); err != nil {
+		return nil, err
+	}
+	injectDiskDelay()
+	return os.ReadFile(path)
+}
+
+// removeStoredFile removes a file whose path came from the database. A path outside the
+// storage directories is never removed, even if the database row was tampered with.
+func removeStoredFile(config *Config, path string) error {
+	if err := validateStoragePath(config, path); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-storage-service/internal/storage"
+)
+
+func TestValidateStoragePath(t *testing.T) {
+	tempDir := t.TempDir()
+	config := &Config{TempDir: tempDir, ArchiveStorageDir: t.TempDir()}
+	filesDir := filepath.Join(tempDir, "files")
+	if err := os.MkdirAll(filesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		filepath.Join(filesDir, "abc123"),
+		filepath.Join(config.ArchiveStorageDir, "abc123"),
+	} {
+		if err := validateStoragePath(config, path); err != nil {
+			t.Errorf("valid storage path %q rejected: %v", path, err)
+		}
+	}
+
+	for _, path := range []string{
+		filesDir,
+		tempDir,
+		config.ArchiveStorageDir,
+		"/etc/passwd",
+		filepath.Join(filesDir, "..", "secret"),
+		filepath.Join(tempDir, "files_other", "abc123"),
+	} {
+		if err := validateStoragePath(config, path); !errors.Is(err, storage.ErrUnsafePath) {
+			t.Errorf("validateStoragePath(%q) = %v, want storage.ErrUnsafePath", path, err)
+		}
+	}
+
+	link := filepath.Join(filesDir, "link")
+	if err := os.Symlink("/etc/passwd", link); err == nil {
+		if err := removeStoredFile(config, link); !errors.Is(err, storage.ErrUnsafePath) {
+			t.Errorf("removeStoredFile on a symlink: got %v, want storage.ErrUnsafePath", err)
+		}
+	}
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	linkedDir := filepath.Join(filesDir, "linked")
+	if err := os.Symlink(outside, linkedDir); err == nil {
+		if err := removeStoredFile(config, filepath.Join(linkedDir, "secret")); !errors.Is(err, storage.ErrUnsafePath) {
+			t.Errorf("removeStoredFile through a linked directory: got %v, want storage.ErrUnsafePath", err)
+		}
+	}
+
+	// A storage directory that is itself reached through a symlink stays valid
+	linkedStorage := filepath.Join(t.TempDir(), "storage")
+	if err := os.Symlink(config.ArchiveStorageDir, linkedStorage); err == nil {
+		linkedConfig := &Config{TempDir: tempDir, ArchiveStorageDir: linkedStorage}
+		if err := validateStoragePath(linkedConfig, filepath.Join(linkedStorage, "abc123")); err != nil {
+			t.Errorf("path in a linked storage directory rejected: %v", err)
+		}
+	}
+}
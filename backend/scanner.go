@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/storage"
+)
+
+// Scan verdicts stored with each file when virus scanning is enabled
+const (
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+	ScanStatusSkipped  = "skipped" // Larger than CLAMAV_MAX_SCAN_SIZE
+	ScanStatusError    = "error"   // clamd failed and CLAMAV_FAIL_OPEN let the file through
+)
+
+// ScanResult is the virus scan verdict for a file
+type ScanResult struct {
+	Status    string    `json:"status"`
+	Signature string    `json:"signature,omitempty"` // Malware name reported for infected files
+	Engine    string    `json:"engine"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// VirusScanner scans content with clamd over TCP using the INSTREAM command
+type VirusScanner struct {
+	addr    string
+	timeout time.Duration
+}
+
+// NewVirusScanner returns a scanner for the configured clamd, or nil when scanning is disabled
+func NewVirusScanner(config *Config) *VirusScanner {
+	if config.ClamAVAddr == "" {
+		return nil
+	}
+	return &VirusScanner{addr: config.ClamAVAddr, timeout: config.ClamAVTimeout}
+}
+
+// Scan streams r to clamd and returns its verdict. clamd's StreamMaxLength must be at
+// least CLAMAV_MAX_SCAN_SIZE, or larger streams are refused with an error.
+func (v *VirusScanner) Scan(r io.Reader) (*ScanResult, error) {
+	conn, err := net.DialTimeout("tcp", v.addr, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(v.timeout))
+
+	writer := bufio.NewWriterSize(conn, 64*1024)
+	if _, err := writer.WriteString("zINSTREAM\x00"); err != nil {
+		return nil, err
+	}
+
+	// Each chunk is sent with its length as a 4-byte big-endian prefix; a zero length ends the stream
+	chunk := make([]byte, 32*1024)
+	var length [4]byte
+	for {
+		n, readErr := r.Read(chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(length[:], uint32(n))
+			if _, err := writer.Write(length[:]); err != nil {
+				return nil, err
+			}
+			if _, err := writer.Write(chunk[:n]); err != nil {
+				return nil, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	binary.BigEndian.PutUint32(length[:], 0)
+	if _, err := writer.Write(length[:]); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to send content to clamd: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return nil, fmt.Errorf("failed to read clamd reply: %v", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply interprets replies such as "stream: OK" and "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (*ScanResult, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	verdict := strings.TrimPrefix(reply, "stream: ")
+
+	result := &ScanResult{Engine: "clamav", ScannedAt: time.Now()}
+	switch {
+	case verdict == "OK":
+		result.Status = ScanStatusClean
+	case strings.HasSuffix(verdict, " FOUND"):
+		result.Status = ScanStatusInfected
+		result.Signature = strings.TrimSuffix(verdict, " FOUND")
+	default:
+		return nil, fmt.Errorf("clamd error: %s", reply)
+	}
+	return result, nil
+}
+
+// scanContent scans content of the given size when scanning is enabled. It returns nil
+// when scanning is disabled, a pending verdict when only the scanner webhook is enabled,
+// a skipped verdict for content over the size limit and, with CLAMAV_FAIL_OPEN, an error
+// verdict instead of an error when clamd fails.
+func (s *FileService) scanContent(r io.Reader, size int64) (*ScanResult, error) {
+	if s.scanner == nil {
+		// An external scanner reports its verdict later through the scanner webhook
+		if s.config.ScanWebhookSecret != "" {
+			return &ScanResult{Status: ScanStatusPending, Engine: "external"}, nil
+		}
+		return nil, nil
+	}
+	if size > s.config.ClamAVMaxScanSize {
+		return &ScanResult{Status: ScanStatusSkipped, Engine: "clamav", ScannedAt: time.Now()}, nil
+	}
+
+	result, err := s.scanner.Scan(r)
+	if err != nil {
+		if s.config.ClamAVFailOpen {
+			log.Printf("Virus scan failed, storing file unscanned: %v", err)
+			return &ScanResult{Status: ScanStatusError, Engine: "clamav", ScannedAt: time.Now()}, nil
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// quarantinePath returns where an infected file is kept for inspection
+func (s *FileService) quarantinePath(fileID string) (string, error) {
+	dir := filepath.Join(s.config.TempDir, "quarantine")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return storage.SafeJoin(dir, fileID)
+}
+
+// scanUpload scans a fully received upload before it is stored. Infected content is
+// quarantined and rejected with 422, and a failed scan is refused with 503; in both cases
+// the error response is written and false returned.
+func (s *FileService) scanUpload(c *gin.Context, filename string, content []byte) (*ScanResult, bool) {
+	result, err := s.scanUploadedContent(filename, content, c.ClientIP())
+	if err != nil {
+		err.respond(c)
+		return nil, false
+	}
+	return result, true
+}
+
+// scanUploadedContent is scanUpload for an upload from clientIP, returning the error
+// instead of writing it
+func (s *FileService) scanUploadedContent(filename string, content []byte, clientIP string) (*ScanResult, *apiError) {
+	result, err := s.scanContent(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		log.Printf("Virus scan of %s failed: %v", filename, err)
+		return nil, retryLaterError(http.StatusServiceUnavailable, errorCodeDependencyUnavailable, retryAfterDependency, gin.H{
+			"error":   "Virus scanner unavailable",
+			"message": "The file could not be scanned. Please try again later.",
+		})
+	}
+
+	if result != nil && result.Status == ScanStatusInfected {
+		quarantineID := generateID()
+		if path, err := s.quarantinePath(quarantineID); err == nil {
+			if err := os.WriteFile(path, content, 0600); err != nil {
+				log.Printf("Failed to quarantine %s: %v", filename, err)
+			}
+		}
+		log.Printf("Rejected infected upload %s (%s), quarantined as %s", filename, result.Signature, quarantineID)
+		s.recordFileEvent(quarantineID, FileEventQuarantined, gin.H{
+			"filename":  filename,
+			"size":      len(content),
+			"signature": result.Signature,
+		}, clientIP)
+		return nil, &apiError{status: http.StatusUnprocessableEntity, body: gin.H{
+			"error":     "Malware detected",
+			"message":   "The file was rejected by the virus scanner.",
+			"signature": result.Signature,
+		}}
+	}
+
+	return result, nil
+}
+
+// cleanupQuarantine removes quarantined files older than the retention period
+func (s *FileService) cleanupQuarantine() {
+	dir := filepath.Join(s.config.TempDir, "quarantine")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-s.config.FileRetention)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if path, err := storage.SafeJoin(dir, entry.Name()); err == nil {
+			os.Remove(path)
+		}
+	}
+}
+
+// rejectInfectedUpload fails the processing job of an infected chunked upload for good,
+// moves the assembled file to quarantine and discards the upload session
+func (m *ChunkUploadManager) rejectInfectedUpload(job *ProcessingJob, upload *ChunkUpload, assembledFile *os.File, scanResult *ScanResult, fs *FileService) {
+	path, err := fs.quarantinePath(job.FileID)
+	if err == nil {
+		err = os.Rename(assembledFile.Name(), path)
+	}
+	if err != nil {
+		log.Printf("Failed to quarantine infected upload %s: %v", job.FileID, err)
+		os.Remove(assembledFile.Name())
+	}
+	log.Printf("Rejected infected upload %s (%s)", job.FileID, scanResult.Signature)
+	m.cleanupUpload(upload.UploadID)
+	fs.recordFileEvent(job.FileID, FileEventQuarantined, gin.H{
+		"filename":  upload.Filename,
+		"size":      upload.TotalSize,
+		"signature": scanResult.Signature,
+		"upload_id": upload.UploadID,
+	}, upload.ClientIP)
+
+	job.Status = "failed"
+	job.Error = "Malware detected: " + scanResult.Signature
+	job.NextAttemptAt = nil
+	job.UpdatedAt = time.Now()
+	m.updateJob(job)
+
+	errorJSON, _ := json.Marshal(map[string]interface{}{
+		"status":     "failed",
+		"error":      job.Error,
+		"error_code": "infected",
+		"message":    "The file was rejected by the virus scanner.",
+		"retryable":  false,
+		"signature":  scanResult.Signature,
+		"timestamp":  time.Now().Unix(),
+	})
+	m.redis.Set(context.Background(), "processing:"+job.FileID, string(errorJSON), 24*time.Hour)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// External scanners that work asynchronously (object-storage malware scanning, sandbox
+// detonation) report their verdicts to /api/scanner/verdict. Each delivery is signed with
+// SCAN_WEBHOOK_SECRET over "<timestamp>.<body>", so a captured delivery can't be replayed
+// after SCAN_WEBHOOK_TOLERANCE, and its id is remembered for twice that long so it can't
+// be replayed within it either. While the endpoint is enabled and clamd isn't, new uploads
+// are stored with a pending verdict until the scanner reports.
+
+const (
+	ScanStatusPending = "pending" // Awaiting the verdict of the external scanner
+
+	// Backoff suggested while a file awaits its verdict
+	retryAfterScanPending = time.Minute
+
+	scanWebhookSignatureHeader = "X-Scanner-Signature"
+	scanWebhookTimestampHeader = "X-Scanner-Timestamp"
+	scanDeliveryPrefix         = "scan_delivery:"
+)
+
+// requireScanCleared refuses the content of a file still awaiting the external scanner's
+// verdict with 423 and Retry-After, so nothing is served before it's cleared. It writes
+// the response and returns false when the file is pending.
+func requireScanCleared(c *gin.Context, file *FileStorage) bool {
+	if err := scanPendingError(file); err != nil {
+		err.respond(c)
+		return false
+	}
+	return true
+}
+
+// scanPendingError is requireScanCleared, returning the error instead of writing it
+func scanPendingError(file *FileStorage) *apiError {
+	if file.ScanResult == nil || file.ScanResult.Status != ScanStatusPending {
+		return nil
+	}
+	return retryLaterError(http.StatusLocked, errorCodeScanPending, retryAfterScanPending, gin.H{
+		"error":       "File is awaiting its virus scan",
+		"message":     "The file can be downloaded once the virus scanner has cleared it.",
+		"scan_status": ScanStatusPending,
+	})
+}
+
+// ScanVerdict is the body of a scanner webhook delivery
+type ScanVerdict struct {
+	ID        string `json:"id"` // Unique per delivery; retries of a delivery reuse it
+	FileID    string `json:"file_id"`
+	Status    string `json:"status"` // clean or infected
+	Signature string `json:"signature,omitempty"`
+	Engine    string `json:"engine,omitempty"`
+}
+
+// signScanVerdict returns the X-Scanner-Signature of a delivery
+func signScanVerdict(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyScanDelivery checks the signature and age of a delivery
+func (s *FileService) verifyScanDelivery(c *gin.Context, body []byte) bool {
+	timestamp := c.GetHeader(scanWebhookTimestampHeader)
+	signature := c.GetHeader(scanWebhookSignatureHeader)
+	expected := signScanVerdict(s.config.ScanWebhookSecret, timestamp, body)
+	if timestamp == "" || !hmac.Equal([]byte(signature), []byte(expected)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return false
+	}
+
+	sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+	age := s.clock.Now().Sub(time.Unix(sentAt, 0))
+	if err != nil || age > s.config.ScanWebhookTolerance || age < -s.config.ScanWebhookTolerance {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Delivery timestamp outside the allowed window"})
+		return false
+	}
+	return true
+}
+
+// receiveScanVerdict applies a signed verdict from the external scanner. Clean verdicts
+// are stored with the file; infected files are moved to quarantine and deleted.
+//
+// @summary Apply a verdict of the external scanner
+// @tags scanner
+// @header X-Scanner-Signature HMAC-SHA256 of the timestamp and body
+// @header X-Scanner-Timestamp Unix time of the delivery
+// @body json ScanVerdict
+// @success 200 json
+func (s *FileService) receiveScanVerdict(c *gin.Context) {
+	if s.config.ScanWebhookSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Scanner webhook is not enabled"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64*1024))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+	if !s.verifyScanDelivery(c, body) {
+		return
+	}
+
+	var verdict ScanVerdict
+	if err := json.Unmarshal(body, &verdict); err != nil || verdict.ID == "" || verdict.FileID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id and file_id are required"})
+		return
+	}
+	if verdict.Status != ScanStatusClean && verdict.Status != ScanStatusInfected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be clean or infected"})
+		return
+	}
+	if verdict.Engine == "" {
+		verdict.Engine = "external"
+	}
+
+	// A delivery is applied once; a retry of one already applied is acknowledged
+	ctx := context.Background()
+	deliveryKey := scanDeliveryPrefix + verdict.ID
+	first, err := s.redis.SetNX(ctx, deliveryKey, verdict.FileID, 2*s.config.ScanWebhookTolerance).Result()
+	if err != nil {
+		log.Printf("Failed to record scanner delivery %s: %v", verdict.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record delivery"})
+		return
+	}
+	if !first {
+		c.JSON(http.StatusOK, gin.H{"message": "Delivery already processed", "duplicate": true})
+		return
+	}
+
+	found, err := s.applyScanVerdict(&verdict, c.ClientIP())
+	if err != nil {
+		// Forget the delivery so the scanner's retry is applied
+		s.redis.Del(ctx, deliveryKey)
+		log.Printf("Failed to apply scan verdict %s for %s: %v", verdict.ID, verdict.FileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply verdict"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verdict applied", "file_id": verdict.FileID, "status": verdict.Status})
+}
+
+// applyScanVerdict stores a verdict, quarantining infected files. Files in the trash get
+// their verdict too, so an infected one is purged rather than left to be restored. It
+// reports false for files that no longer exist.
+func (s *FileService) applyScanVerdict(verdict *ScanVerdict, ipAddress string) (bool, error) {
+	fileStorage, err := s.db.GetFile(verdict.FileID)
+	if err != nil {
+		return false, err
+	}
+	if fileStorage == nil {
+		if fileStorage, err = s.db.GetTrashedFile(verdict.FileID); err != nil || fileStorage == nil {
+			return false, err
+		}
+		if fileStorage.StoragePath == nil {
+			if fileStorage.FileContent, err = s.db.GetTrashedFileContent(verdict.FileID); err != nil {
+				log.Printf("Failed to read trashed file %s for quarantine: %v", verdict.FileID, err)
+			}
+		}
+	}
+
+	result := &ScanResult{
+		Status:    verdict.Status,
+		Signature: verdict.Signature,
+		Engine:    verdict.Engine,
+		ScannedAt: s.clock.Now(),
+	}
+	details := gin.H{
+		"delivery_id": verdict.ID,
+		"engine":      verdict.Engine,
+		"source":      "webhook",
+	}
+
+	if verdict.Status == ScanStatusClean {
+		if err := s.db.UpdateFileScanResult(verdict.FileID, result); err != nil {
+			return false, err
+		}
+		s.redis.Del(context.Background(), "file:"+verdict.FileID)
+		s.recordFileEvent(verdict.FileID, FileEventScanned, details, ipAddress)
+		return true, nil
+	}
+
+	// Keep a copy for inspection, then take the file down
+	content, err := s.loadFileContent(fileStorage, FileMetadata{Compression: CompressionType(fileStorage.CompressionType)})
+	if err == nil {
+		var path string
+		if path, err = s.quarantinePath(verdict.FileID); err == nil {
+			err = os.WriteFile(path, content, 0600)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to quarantine %s: %v", verdict.FileID, err)
+	}
+
+	if err := s.db.DeleteFile(verdict.FileID); err != nil {
+		return false, err
+	}
+	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil {
+		if err := removeStoredFile(s.config, *fileStorage.StoragePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete infected file from disk: %v", err)
+		}
+	}
+	s.redis.Del(context.Background(), "file:"+verdict.FileID)
+
+	log.Printf("Quarantined %s (%s) on the verdict of %s", verdict.FileID, verdict.Signature, verdict.Engine)
+	details["filename"] = fileStorage.Filename
+	details["size"] = fileStorage.OriginalSize
+	details["signature"] = verdict.Signature
+	s.recordFileEvent(verdict.FileID, FileEventQuarantined, details, ipAddress)
+	return true, nil
+}
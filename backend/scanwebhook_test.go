@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestScanVerdictWebhook(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.ScanWebhookSecret = "scanner-secret"
+	ts.saveTestFile(t, "safe", "hello", time.Hour)
+	ts.saveTestFile(t, "evil", "X5O!P%@AP", time.Hour)
+
+	deliver := func(body string, sentAt time.Time, secret string) int {
+		timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/api/scanner/verdict", strings.NewReader(body))
+		req.Header.Set(scanWebhookTimestampHeader, timestamp)
+		req.Header.Set(scanWebhookSignatureHeader, signScanVerdict(secret, timestamp, []byte(body)))
+		return ts.serve(ts.receiveScanVerdict, req).Code
+	}
+	now := ts.clock.Now()
+
+	clean := `{"id":"d1","file_id":"safe","status":"clean","engine":"sandbox"}`
+	if code := deliver(clean, now, "wrong-secret"); code != http.StatusUnauthorized {
+		t.Errorf("bad signature: got %d, want 401", code)
+	}
+	if code := deliver(clean, now.Add(-10*time.Minute), "scanner-secret"); code != http.StatusUnauthorized {
+		t.Errorf("stale delivery: got %d, want 401", code)
+	}
+	if code := deliver(clean, now, "scanner-secret"); code != http.StatusOK {
+		t.Fatalf("clean verdict: got %d", code)
+	}
+	if file, _ := ts.store.GetFile("safe"); file.ScanResult == nil || file.ScanResult.Status != ScanStatusClean || file.ScanResult.Engine != "sandbox" {
+		t.Errorf("scan result = %+v", file.ScanResult)
+	}
+
+	infected := `{"id":"d2","file_id":"evil","status":"infected","signature":"Eicar-Test-Signature"}`
+	if code := deliver(infected, now, "scanner-secret"); code != http.StatusOK {
+		t.Fatalf("infected verdict: got %d", code)
+	}
+	if file, _ := ts.store.GetFile("evil"); file != nil {
+		t.Error("infected file still available")
+	}
+	path, _ := ts.quarantinePath("evil")
+	if content, err := os.ReadFile(path); err != nil || string(content) != "X5O!P%@AP" {
+		t.Errorf("quarantined copy = %q, %v", content, err)
+	}
+
+	// A replayed delivery is acknowledged without being applied again
+	ts.saveTestFile(t, "evil", "X5O!P%@AP", time.Hour)
+	if code := deliver(infected, now, "scanner-secret"); code != http.StatusOK {
+		t.Errorf("replay: got %d", code)
+	}
+	if file, _ := ts.store.GetFile("evil"); file == nil {
+		t.Error("replayed delivery was applied")
+	}
+
+	var types []string
+	for _, event := range ts.store.events {
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "scanned,quarantined" {
+		t.Errorf("events = %v", types)
+	}
+
+	if code := deliver(`{"id":"d3","file_id":"gone","status":"clean"}`, now, "scanner-secret"); code != http.StatusNotFound {
+		t.Errorf("unknown file: got %d, want 404", code)
+	}
+}
+
+func TestScanVerdictForTrashedFile(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.ScanWebhookSecret = "scanner-secret"
+	ts.config.TrashRetention = 24 * time.Hour
+	deliver := func(body string) int {
+		timestamp := strconv.FormatInt(ts.clock.Now().Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/api/scanner/verdict", strings.NewReader(body))
+		req.Header.Set(scanWebhookTimestampHeader, timestamp)
+		req.Header.Set(scanWebhookSignatureHeader, signScanVerdict("scanner-secret", timestamp, []byte(body)))
+		return ts.serve(ts.receiveScanVerdict, req).Code
+	}
+	restore := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/file/"+id+"/restore?delete_password=delete-me", nil)
+		return ts.serve(ts.restoreFile, req, gin.Param{Key: "id", Value: id})
+	}
+	for _, id := range []string{"evil", "safe"} {
+		ts.saveTestFile(t, id, "X5O!P%@AP "+id, time.Hour)
+		ts.store.UpdateFileScanResult(id, &ScanResult{Status: ScanStatusPending, Engine: "external"})
+		ts.store.TrashFile(id, ts.clock.Now())
+	}
+
+	w := restore("evil")
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("restore while pending: got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	if code := deliver(`{"id":"d1","file_id":"evil","status":"infected","signature":"Eicar"}`); code != http.StatusOK {
+		t.Fatalf("infected verdict for a trashed file: got %d", code)
+	}
+	if exists, _ := ts.store.FileIDExists("evil"); exists {
+		t.Error("infected file left in the trash")
+	}
+	path, _ := ts.quarantinePath("evil")
+	if content, err := os.ReadFile(path); err != nil || string(content) != "X5O!P%@AP evil" {
+		t.Errorf("quarantined copy = %q, %v", content, err)
+	}
+	if w := restore("evil"); w.Code != http.StatusNotFound {
+		t.Errorf("restore of a quarantined file: got %d, want 404", w.Code)
+	}
+
+	if code := deliver(`{"id":"d2","file_id":"safe","status":"clean"}`); code != http.StatusOK {
+		t.Fatalf("clean verdict for a trashed file: got %d", code)
+	}
+	if w := restore("safe"); w.Code != http.StatusOK {
+		t.Errorf("restore after a clean verdict: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPendingScanHoldsDownloads(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "waiting", "not yet scanned", time.Hour)
+	ts.store.UpdateFileScanResult("waiting", &ScanResult{Status: ScanStatusPending, Engine: "external"})
+
+	param := gin.Param{Key: "id", Value: "waiting"}
+	for name, handler := range map[string]gin.HandlerFunc{
+		"download": ts.getFile,
+		"preview":  ts.previewFile,
+		"stream":   ts.fastStreamFile,
+	} {
+		w := ts.serve(handler, httptest.NewRequest(http.MethodGet, "/api/file/waiting", nil), param)
+		if w.Code != http.StatusLocked || w.Header().Get("Retry-After") == "" || w.Header().Get(errorCodeHeader) != errorCodeScanPending {
+			t.Errorf("%s while pending: got %d, Retry-After %q", name, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+
+	ts.store.UpdateFileScanResult("waiting", &ScanResult{Status: ScanStatusClean, Engine: "external"})
+	if w := ts.serve(ts.getFile, httptest.NewRequest(http.MethodGet, "/api/file/waiting", nil), param); w.Code != http.StatusOK || w.Body.String() != "not yet scanned" {
+		t.Errorf("download after a clean verdict: got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -21,10 +21,78 @@ CREATE TABLE files (
     delete_password VARCHAR(255) NOT NULL,
     download_password VARCHAR(255),
     has_download_password BOOLEAN NOT NULL DEFAULT FALSE,
+    api_key_id VARCHAR(36), -- API key that uploaded the file (NULL for anonymous uploads)
+    append_state VARCHAR(20), -- 'open' or 'finalized' for files created in append mode (NULL otherwise)
+    uploader_ip VARCHAR(45), -- Client IP of the uploader, used for per-IP quotas
+    content_hash VARCHAR(64), -- SHA-256 of the original content, used for instant uploads
+    image_info JSONB, -- Dimensions, alpha and ICC profile info for images (NULL otherwise)
+    storage_class VARCHAR(20) NOT NULL DEFAULT 'standard', -- 'fast-ssd', 'standard' or 'archive'
+    scan_result JSONB, -- Virus scan verdict (NULL when scanning is disabled)
+    org_id VARCHAR(36), -- Organization owning the file (NULL otherwise); no foreign key, since files are replicated without orgs
+    version INTEGER NOT NULL DEFAULT 1, -- Content revision, incremented when the content is replaced
+    deleted_at TIMESTAMP WITH TIME ZONE, -- When the file was moved to the trash (NULL otherwise)
+    accessibility JSONB, -- Alt text, caption and description given by the uploader (NULL when none)
+    tags JSONB, -- Tags of the upload policy the file was uploaded with (NULL when none)
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
+-- File versions: Content of files before it was replaced, kept for VERSION_RETENTION
+CREATE TABLE file_versions (
+    file_id VARCHAR(36) NOT NULL, -- No foreign key: removed with their disk content by the cleanup job
+    version INTEGER NOT NULL,
+    original_size BIGINT NOT NULL,
+    compressed_size BIGINT,
+    compression_type VARCHAR(20) NOT NULL DEFAULT 'none',
+    storage_type VARCHAR(20) NOT NULL, -- 'postgresql' or 'disk'
+    storage_path TEXT, -- Disk-stored versions are moved next to the file's content
+    file_content BYTEA,
+    content_hash VARCHAR(64),
+    replaced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (file_id, version)
+);
+
+-- Vanity slugs: Custom names chosen at upload that /f/:slug resolves to files
+CREATE TABLE file_slugs (
+    slug VARCHAR(64) PRIMARY KEY, -- Lowercase letters, digits, '-' and '_'
+    file_id VARCHAR(36) NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Organizations: teams whose API keys share ownership of the files they upload
+CREATE TABLE orgs (
+    id VARCHAR(36) PRIMARY KEY,
+    name TEXT NOT NULL,
+    quota_bytes BIGINT NOT NULL DEFAULT 0, -- Maximum bytes stored by all members together (0 = unlimited)
+    quota_files INTEGER NOT NULL DEFAULT 0, -- Maximum active files of all members together (0 = unlimited)
+    branding JSONB NOT NULL DEFAULT '{}', -- Display name, logo URL and accent color shown with the org's files
+    policy JSONB NOT NULL DEFAULT '{}', -- Retention, download password and file type rules for members' uploads
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- API keys table: Credentials for programmatic clients
+CREATE TABLE api_keys (
+    id VARCHAR(36) PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL, -- First characters of the key, shown in listings
+    key_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 hash of the full key
+    rate_limit INTEGER NOT NULL DEFAULT 600, -- Requests per minute
+    quota_bytes BIGINT NOT NULL DEFAULT 0, -- Maximum stored bytes (0 = unlimited)
+    quota_files INTEGER NOT NULL DEFAULT 0, -- Maximum active files (0 = unlimited)
+    storage_classes TEXT NOT NULL DEFAULT '', -- Comma-separated storage classes the key may request ('' = all)
+    egress_quota_bytes BIGINT NOT NULL DEFAULT 0, -- Maximum bytes served per month (0 = unlimited)
+    client_cert_identity TEXT UNIQUE, -- Client certificate identity that authenticates as this key
+    org_id VARCHAR(36) REFERENCES orgs(id) ON DELETE SET NULL, -- Organization the key is a member of
+    org_role VARCHAR(20) NOT NULL DEFAULT 'member', -- 'member' or 'admin' within the organization
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
 -- Chunk uploads table: Track chunked upload sessions
 CREATE TABLE chunk_uploads (
     upload_id VARCHAR(36) PRIMARY KEY,
@@ -36,6 +104,9 @@ CREATE TABLE chunk_uploads (
     file_hash VARCHAR(64), -- SHA-256 hash
     download_password VARCHAR(255),
     has_download_password BOOLEAN NOT NULL DEFAULT FALSE,
+    api_key_id VARCHAR(36), -- API key that initiated the upload (NULL for anonymous uploads)
+    client_ip VARCHAR(45), -- Client IP of the uploader
+    storage_class VARCHAR(20) NOT NULL DEFAULT 'standard', -- Storage class requested at initiation
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     last_activity TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
@@ -45,12 +116,15 @@ CREATE TABLE chunk_uploads (
 -- Processing jobs table: Track background file processing jobs
 CREATE TABLE processing_jobs (
     job_id VARCHAR(36) PRIMARY KEY,
-    upload_id VARCHAR(36) REFERENCES chunk_uploads(upload_id) ON DELETE CASCADE,
+    upload_id VARCHAR(36), -- Chunk upload being processed (the session is deleted once processed)
     file_id VARCHAR(36), -- Will be set when file is created
     status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'processing', 'completed', 'failed'
     progress INTEGER NOT NULL DEFAULT 0, -- 0-100
     error_message TEXT,
     result_data JSONB, -- Store FileResult as JSON
+    attempts INTEGER NOT NULL DEFAULT 0, -- Failed attempts so far
+    next_attempt_at TIMESTAMP WITH TIME ZONE, -- When a retrying job is attempted again
+    dead_letter BOOLEAN NOT NULL DEFAULT FALSE, -- Failed for good after exhausting its attempts
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     completed_at TIMESTAMP WITH TIME ZONE
@@ -66,6 +140,54 @@ CREATE TABLE file_access_logs (
     access_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
+-- Bandwidth usage table: Bytes served per month to each file, API key and client IP
+CREATE TABLE bandwidth_usage (
+    period DATE NOT NULL, -- First day of the month
+    subject_type VARCHAR(10) NOT NULL, -- 'file', 'key' or 'ip'
+    subject_id VARCHAR(64) NOT NULL,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (period, subject_type, subject_id)
+);
+
+-- Usage records: Metered usage of each API key per hour, for invoicing
+CREATE TABLE usage_records (
+    hour TIMESTAMP WITH TIME ZONE NOT NULL, -- Start of the hour the usage happened in
+    api_key_id VARCHAR(36) NOT NULL,
+    org_id VARCHAR(36), -- Org of the key when the usage was recorded
+    metric VARCHAR(32) NOT NULL, -- 'storage_byte_hours', 'egress_bytes' or 'api_calls'
+    quantity BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hour, api_key_id, metric)
+);
+
+-- Replication log: File changes not yet copied to the secondary database
+CREATE TABLE replication_log (
+    id BIGSERIAL PRIMARY KEY,
+    file_id VARCHAR(36) NOT NULL,
+    operation VARCHAR(10) NOT NULL, -- 'upsert' or 'delete'
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Replication state: Kept on the secondary database, a single row
+CREATE TABLE replication_state (
+    id INTEGER PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    seeded_at TIMESTAMP WITH TIME ZONE, -- When the existing files were queued for the first copy
+    last_applied_at TIMESTAMP WITH TIME ZONE, -- When the last change was copied
+    promoted_at TIMESTAMP WITH TIME ZONE -- Set once the secondary has been promoted to primary
+);
+
+-- File events: Append-only log of file state transitions for external consumers
+CREATE TABLE file_events (
+    id BIGSERIAL PRIMARY KEY,
+    file_id VARCHAR(36) NOT NULL, -- No foreign key: events outlive the file
+    event_type VARCHAR(20) NOT NULL, -- 'uploaded', 'downloaded', 'expired', 'deleted', 'quarantined', 'expiry_changed', 'scanned', 'mime_corrected', 'password_changed', 'renamed', 'content_replaced', 'trashed' or 'restored'
+    details JSONB NOT NULL DEFAULT '{}',
+    ip_address VARCHAR(45),
+    org_id VARCHAR(36), -- Organization that owned the file, for the org audit log
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
 -- Function to update updated_at timestamp
 CREATE OR REPLACE FUNCTION update_updated_at_column()
 RETURNS TRIGGER AS $$
@@ -88,6 +210,74 @@ CREATE TRIGGER update_processing_jobs_updated_at
     BEFORE UPDATE ON processing_jobs 
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
 
+CREATE TRIGGER update_api_keys_updated_at 
+    BEFORE UPDATE ON api_keys 
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_orgs_updated_at
+    BEFORE UPDATE ON orgs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Function to record file changes for replication. Writes made by the replicator on the
+-- secondary set one.replicating and are not recorded.
+CREATE OR REPLACE FUNCTION log_file_replication()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF current_setting('one.replicating', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO replication_log (file_id, operation) VALUES (OLD.id, 'delete');
+    ELSE
+        INSERT INTO replication_log (file_id, operation) VALUES (NEW.id, 'upsert');
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER files_replication_log
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION log_file_replication();
+
+-- Function to record uploads, expiration changes, deletions and expirations of files in
+-- file_events. Downloads and quarantined uploads are recorded by the application.
+CREATE OR REPLACE FUNCTION record_file_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF current_setting('one.replicating', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO file_events (file_id, event_type, details, ip_address, org_id)
+        VALUES (NEW.id, 'uploaded', jsonb_build_object(
+            'filename', NEW.filename,
+            'size', NEW.original_size,
+            'mime_type', NEW.mime_type,
+            'storage_class', NEW.storage_class,
+            'api_key_id', NEW.api_key_id,
+            'expires_at', NEW.expires_at
+        ), NEW.uploader_ip, NEW.org_id);
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.expires_at IS DISTINCT FROM NEW.expires_at THEN
+            INSERT INTO file_events (file_id, event_type, details, org_id)
+            VALUES (NEW.id, 'expiry_changed', jsonb_build_object(
+                'old_expires_at', OLD.expires_at,
+                'new_expires_at', NEW.expires_at
+            ), NEW.org_id);
+        END IF;
+    ELSE
+        INSERT INTO file_events (file_id, event_type, details, org_id)
+        VALUES (OLD.id, CASE WHEN OLD.expires_at <= NOW() THEN 'expired' ELSE 'deleted' END,
+            jsonb_build_object('filename', OLD.filename, 'size', OLD.original_size), OLD.org_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER files_record_event
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION record_file_event();
+
 -- Function to cleanup expired files and uploads
 CREATE OR REPLACE FUNCTION cleanup_expired_data()
 RETURNS INTEGER AS $$
@@ -148,6 +338,11 @@ CREATE INDEX files_expires_at_idx ON files (expires_at);
 CREATE INDEX files_upload_time_idx ON files (upload_time);
 CREATE INDEX files_storage_type_idx ON files (storage_type);
 CREATE INDEX files_filename_idx ON files (filename);
+CREATE INDEX files_api_key_id_idx ON files (api_key_id);
+CREATE INDEX files_uploader_ip_idx ON files (uploader_ip);
+CREATE INDEX files_content_hash_idx ON files (content_hash, original_size);
+CREATE INDEX files_org_id_idx ON files (org_id);
+CREATE INDEX files_deleted_at_idx ON files (deleted_at) WHERE deleted_at IS NOT NULL;
 
 CREATE INDEX chunk_uploads_expires_at_idx ON chunk_uploads (expires_at);
 CREATE INDEX chunk_uploads_last_activity_idx ON chunk_uploads (last_activity);
@@ -156,6 +351,13 @@ CREATE INDEX chunk_uploads_status_idx ON chunk_uploads (status);
 CREATE INDEX processing_jobs_status_idx ON processing_jobs (status);
 CREATE INDEX processing_jobs_created_at_idx ON processing_jobs (created_at);
 CREATE INDEX processing_jobs_file_id_idx ON processing_jobs (file_id);
+CREATE INDEX processing_jobs_dead_letter_idx ON processing_jobs (updated_at) WHERE dead_letter;
+
+CREATE INDEX file_events_created_at_idx ON file_events (created_at);
+CREATE INDEX file_events_file_id_idx ON file_events (file_id);
+CREATE INDEX file_events_org_id_idx ON file_events (org_id, id);
+
+CREATE INDEX usage_records_org_id_idx ON usage_records (org_id, hour);
 
 CREATE INDEX file_access_logs_file_id_idx ON file_access_logs (file_id);
 CREATE INDEX file_access_logs_access_time_idx ON file_access_logs (access_time);
@@ -163,6 +365,8 @@ CREATE INDEX file_access_logs_access_type_idx ON file_access_logs (access_type);
 
 CREATE INDEX files_filename_trgm ON files USING gin (filename gin_trgm_ops);
 CREATE INDEX files_composite_lookup ON files (id, expires_at);
+CREATE INDEX file_versions_expires_at_idx ON file_versions (expires_at);
+CREATE INDEX file_slugs_file_id_idx ON file_slugs (file_id);
 CREATE INDEX chunk_uploads_active ON chunk_uploads (upload_id, status) WHERE status = 'active';
 
 -- Comments for documentation
@@ -170,6 +374,9 @@ COMMENT ON TABLE files IS 'Stores metadata for uploaded files with expiration an
 COMMENT ON TABLE chunk_uploads IS 'Tracks chunked upload sessions for large files';
 COMMENT ON TABLE processing_jobs IS 'Manages background processing jobs for file assembly and compression';
 COMMENT ON TABLE file_access_logs IS 'Optional logging table for file access analytics';
+COMMENT ON TABLE api_keys IS 'API keys for programmatic clients with per-key rate limits and quotas';
+COMMENT ON TABLE usage_records IS 'Hourly metered usage per API key for billing integrations';
+COMMENT ON TABLE orgs IS 'Organizations whose member API keys share ownership of their files';
 
 COMMENT ON COLUMN files.storage_type IS 'Indicates where file content is stored: postgresql (default), disk (for files > 1GB)';
 COMMENT ON COLUMN files.storage_path IS 'File system path for disk-stored files (only for very large files > 1GB)';
@@ -0,0 +1,226 @@
+-- Schema upgrades for databases created from an older schema.sql
+-- Runs on every startup, so every statement must be idempotent. New tables and columns
+-- are added to schema.sql for fresh databases and here for existing ones.
+
+-- API keys
+CREATE TABLE IF NOT EXISTS api_keys (
+    id VARCHAR(36) PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    rate_limit INTEGER NOT NULL DEFAULT 600,
+    quota_bytes BIGINT NOT NULL DEFAULT 0,
+    quota_files INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE OR REPLACE TRIGGER update_api_keys_updated_at
+    BEFORE UPDATE ON api_keys
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS api_key_id VARCHAR(36);
+CREATE INDEX IF NOT EXISTS files_api_key_id_idx ON files (api_key_id);
+
+-- Append-mode files
+ALTER TABLE files ADD COLUMN IF NOT EXISTS append_state VARCHAR(20);
+
+-- Per-IP quotas
+ALTER TABLE files ADD COLUMN IF NOT EXISTS uploader_ip VARCHAR(45);
+CREATE INDEX IF NOT EXISTS files_uploader_ip_idx ON files (uploader_ip);
+
+-- Instant uploads by content hash
+ALTER TABLE files ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+CREATE INDEX IF NOT EXISTS files_content_hash_idx ON files (content_hash, original_size);
+
+-- Image metadata
+ALTER TABLE files ADD COLUMN IF NOT EXISTS image_info JSONB;
+
+-- Resumable chunk uploads
+ALTER TABLE chunk_uploads ADD COLUMN IF NOT EXISTS api_key_id VARCHAR(36);
+ALTER TABLE chunk_uploads ADD COLUMN IF NOT EXISTS client_ip VARCHAR(45);
+
+-- Storage classes
+ALTER TABLE files ADD COLUMN IF NOT EXISTS storage_class VARCHAR(20) NOT NULL DEFAULT 'standard';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS storage_classes TEXT NOT NULL DEFAULT '';
+ALTER TABLE chunk_uploads ADD COLUMN IF NOT EXISTS storage_class VARCHAR(20) NOT NULL DEFAULT 'standard';
+
+-- Processing jobs outlive their chunk upload session
+ALTER TABLE processing_jobs DROP CONSTRAINT IF EXISTS processing_jobs_upload_id_fkey;
+
+-- Bandwidth accounting and egress quotas
+CREATE TABLE IF NOT EXISTS bandwidth_usage (
+    period DATE NOT NULL,
+    subject_type VARCHAR(10) NOT NULL,
+    subject_id VARCHAR(64) NOT NULL,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (period, subject_type, subject_id)
+);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS egress_quota_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- Client certificate authentication
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS client_cert_identity TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_client_cert_identity_idx ON api_keys (client_cert_identity);
+
+-- Job retries and dead letter
+ALTER TABLE processing_jobs ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE processing_jobs ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE processing_jobs ADD COLUMN IF NOT EXISTS dead_letter BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS processing_jobs_dead_letter_idx ON processing_jobs (updated_at) WHERE dead_letter;
+
+-- Virus scanning
+ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_result JSONB;
+
+-- Replication to a secondary database
+CREATE TABLE IF NOT EXISTS replication_log (
+    id BIGSERIAL PRIMARY KEY,
+    file_id VARCHAR(36) NOT NULL,
+    operation VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS replication_state (
+    id INTEGER PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    seeded_at TIMESTAMP WITH TIME ZONE,
+    last_applied_at TIMESTAMP WITH TIME ZONE,
+    promoted_at TIMESTAMP WITH TIME ZONE
+);
+CREATE OR REPLACE FUNCTION log_file_replication()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF current_setting('one.replicating', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO replication_log (file_id, operation) VALUES (OLD.id, 'delete');
+    ELSE
+        INSERT INTO replication_log (file_id, operation) VALUES (NEW.id, 'upsert');
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+DROP TRIGGER IF EXISTS files_replication_log ON files;
+CREATE TRIGGER files_replication_log
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION log_file_replication();
+
+-- File event log
+CREATE TABLE IF NOT EXISTS file_events (
+    id BIGSERIAL PRIMARY KEY,
+    file_id VARCHAR(36) NOT NULL,
+    event_type VARCHAR(20) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    ip_address VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS file_events_created_at_idx ON file_events (created_at);
+CREATE INDEX IF NOT EXISTS file_events_file_id_idx ON file_events (file_id);
+ALTER TABLE file_events ADD COLUMN IF NOT EXISTS org_id VARCHAR(36);
+CREATE INDEX IF NOT EXISTS file_events_org_id_idx ON file_events (org_id, id);
+
+-- Organizations
+CREATE TABLE IF NOT EXISTS orgs (
+    id VARCHAR(36) PRIMARY KEY,
+    name TEXT NOT NULL,
+    quota_bytes BIGINT NOT NULL DEFAULT 0,
+    quota_files INTEGER NOT NULL DEFAULT 0,
+    branding JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE OR REPLACE TRIGGER update_orgs_updated_at
+    BEFORE UPDATE ON orgs
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+ALTER TABLE orgs ADD COLUMN IF NOT EXISTS policy JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS org_id VARCHAR(36) REFERENCES orgs(id) ON DELETE SET NULL;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS org_role VARCHAR(20) NOT NULL DEFAULT 'member';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS org_id VARCHAR(36);
+CREATE INDEX IF NOT EXISTS files_org_id_idx ON files (org_id);
+
+CREATE OR REPLACE FUNCTION record_file_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF current_setting('one.replicating', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO file_events (file_id, event_type, details, ip_address, org_id)
+        VALUES (NEW.id, 'uploaded', jsonb_build_object(
+            'filename', NEW.filename,
+            'size', NEW.original_size,
+            'mime_type', NEW.mime_type,
+            'storage_class', NEW.storage_class,
+            'api_key_id', NEW.api_key_id,
+            'expires_at', NEW.expires_at
+        ), NEW.uploader_ip, NEW.org_id);
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.expires_at IS DISTINCT FROM NEW.expires_at THEN
+            INSERT INTO file_events (file_id, event_type, details, org_id)
+            VALUES (NEW.id, 'expiry_changed', jsonb_build_object(
+                'old_expires_at', OLD.expires_at,
+                'new_expires_at', NEW.expires_at
+            ), NEW.org_id);
+        END IF;
+    ELSE
+        INSERT INTO file_events (file_id, event_type, details, org_id)
+        VALUES (OLD.id, CASE WHEN OLD.expires_at <= NOW() THEN 'expired' ELSE 'deleted' END,
+            jsonb_build_object('filename', OLD.filename, 'size', OLD.original_size), OLD.org_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+DROP TRIGGER IF EXISTS files_record_event ON files;
+CREATE TRIGGER files_record_event
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION record_file_event();
+
+-- Usage metering
+CREATE TABLE IF NOT EXISTS usage_records (
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    api_key_id VARCHAR(36) NOT NULL,
+    org_id VARCHAR(36),
+    metric VARCHAR(32) NOT NULL,
+    quantity BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hour, api_key_id, metric)
+);
+CREATE INDEX IF NOT EXISTS usage_records_org_id_idx ON usage_records (org_id, hour);
+
+-- File versioning
+ALTER TABLE files ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+CREATE TABLE IF NOT EXISTS file_versions (
+    file_id VARCHAR(36) NOT NULL,
+    version INTEGER NOT NULL,
+    original_size BIGINT NOT NULL,
+    compressed_size BIGINT,
+    compression_type VARCHAR(20) NOT NULL DEFAULT 'none',
+    storage_type VARCHAR(20) NOT NULL,
+    storage_path TEXT,
+    file_content BYTEA,
+    content_hash VARCHAR(64),
+    replaced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (file_id, version)
+);
+CREATE INDEX IF NOT EXISTS file_versions_expires_at_idx ON file_versions (expires_at);
+
+-- Trash
+ALTER TABLE files ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS files_deleted_at_idx ON files (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Vanity slugs
+CREATE TABLE IF NOT EXISTS file_slugs (
+    slug VARCHAR(64) PRIMARY KEY,
+    file_id VARCHAR(36) NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS file_slugs_file_id_idx ON file_slugs (file_id);
+
+-- Accessibility metadata
+ALTER TABLE files ADD COLUMN IF NOT EXISTS accessibility JSONB;
+
+-- Tags of signed upload policies
+ALTER TABLE files ADD COLUMN IF NOT EXISTS tags JSONB;
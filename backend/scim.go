@@ -0,0 +1,724 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Identity providers such as Okta or Azure AD provision the people using the service over
+// SCIM 2.0 (RFC 7644). A SCIM user is an API key authenticated by a client certificate:
+// its userName is the key's client_cert_identity, so the user connects with a certificate
+// signed by CLIENT_CA and no key secret is ever handed out. Deactivating a user expires
+// its key and deleting it revokes the key, so departed employees lose access to their
+// files as soon as the directory drops them. SCIM groups are orgs, whose members are the
+// keys assigned to them. The endpoints under /scim/v2 are enabled by SCIM_TOKEN, which
+// the identity provider sends as a bearer token.
+
+const (
+	scimUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+const scimContentType = "application/scim+json"
+
+// scimMaxResults is the most resources one SCIM list response returns
+const scimMaxResults = 1000
+
+// Filters identity providers look resources up with before provisioning them; SCIM
+// attribute names are case-insensitive
+var (
+	scimUserNameFilter    = regexp.MustCompile(`(?i)^userName\s+eq\s+"([^"]*)"$`)
+	scimDisplayNameFilter = regexp.MustCompile(`(?i)^displayName\s+eq\s+"([^"]*)"$`)
+	scimMemberPath        = regexp.MustCompile(`(?i)^members\[value\s+eq\s+"([^"]*)"\]$`)
+)
+
+// SCIMMember refers to a member of a group, or a group of a user, by ID
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// SCIMMeta describes a SCIM resource
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// SCIMUser is a provisioned person, backed by the API key their client certificate
+// authenticates as
+type SCIMUser struct {
+	Schemas  []string     `json:"schemas"`
+	ID       string       `json:"id,omitempty"`
+	UserName string       `json:"userName"`
+	Active   *bool        `json:"active,omitempty"` // Defaults to true when provisioning
+	Groups   []SCIMMember `json:"groups,omitempty"`
+	Meta     *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMGroup is a provisioned group, backed by an org
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMPatchRequest changes attributes of a user or group
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation is one change of a SCIMPatchRequest
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// registerSCIMRoutes registers the SCIM endpoints identity providers provision with
+func registerSCIMRoutes(router *gin.Engine, service *FileService) {
+	scim := router.Group("/scim/v2", service.scimMiddleware())
+	scim.GET("/Users", service.listSCIMUsers)
+	scim.POST("/Users", service.createSCIMUser)
+	scim.GET("/Users/:id", service.getSCIMUser)
+	scim.PUT("/Users/:id", service.replaceSCIMUser)
+	scim.PATCH("/Users/:id", service.patchSCIMUser)
+	scim.DELETE("/Users/:id", service.deleteSCIMUser)
+	scim.GET("/Groups", service.listSCIMGroups)
+	scim.POST("/Groups", service.createSCIMGroup)
+	scim.GET("/Groups/:id", service.getSCIMGroup)
+	scim.PUT("/Groups/:id", service.replaceSCIMGroup)
+	scim.PATCH("/Groups/:id", service.patchSCIMGroup)
+	scim.DELETE("/Groups/:id", service.deleteSCIMGroup)
+}
+
+// scimMiddleware admits requests bearing SCIM_TOKEN
+func (s *FileService) scimMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := parseBearerToken(c.GetHeader("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.SCIMToken)) != 1 {
+			scimError(c, http.StatusUnauthorized, "", "Send SCIM_TOKEN as Authorization: Bearer")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// scimJSON writes a SCIM response
+func scimJSON(c *gin.Context, status int, body any) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+// scimError writes a SCIM error response; scimType is the RFC 7644 error type, if any
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{"schemas": []string{scimErrorSchema}, "status": strconv.Itoa(status), "detail": detail}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+// scimList writes a page of resources. The page starts at the 1-based startIndex query
+// parameter and holds up to count resources.
+func scimList[T any](c *gin.Context, resources []T) {
+	start, _ := strconv.Atoi(c.Query("startIndex"))
+	if start < 1 {
+		start = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count < 0 || count > scimMaxResults {
+		count = scimMaxResults
+	}
+
+	page := make([]T, 0)
+	if start <= len(resources) {
+		page = resources[start-1 : min(start-1+count, len(resources))]
+	}
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":      []string{scimListSchema},
+		"totalResults": len(resources),
+		"startIndex":   start,
+		"itemsPerPage": len(page),
+		"Resources":    page,
+	})
+}
+
+// scimFilterValue returns the value a filter query parameter compares an attribute with,
+// "" without a filter. It writes the error response and returns false for filters other
+// than pattern.
+func scimFilterValue(c *gin.Context, pattern *regexp.Regexp) (string, bool) {
+	filter := strings.TrimSpace(c.Query("filter"))
+	if filter == "" {
+		return "", true
+	}
+	match := pattern.FindStringSubmatch(filter)
+	if match == nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", "Unsupported filter "+strconv.Quote(filter))
+		return "", false
+	}
+	return match[1], true
+}
+
+// isSCIMUser reports whether an API key is a SCIM user: a key that isn't revoked and is
+// mapped to a client certificate
+func isSCIMUser(key *APIKeyStorage) bool {
+	return key != nil && key.RevokedAt == nil && key.ClientCertIdentity != nil
+}
+
+// scimUser describes the API key of a user
+func scimUser(key *APIKeyStorage) SCIMUser {
+	active := key.IsActive()
+	user := SCIMUser{
+		Schemas:  []string{scimUserSchema},
+		ID:       key.ID,
+		UserName: *key.ClientCertIdentity,
+		Active:   &active,
+		Meta:     &SCIMMeta{ResourceType: "User", Created: key.CreatedAt, LastModified: key.UpdatedAt},
+	}
+	if key.OrgID != nil {
+		user.Groups = []SCIMMember{{Value: *key.OrgID}}
+	}
+	return user
+}
+
+// scimGroup describes an org and its member keys
+func scimGroup(org *Org, keys []*APIKeyStorage) SCIMGroup {
+	group := SCIMGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          org.ID,
+		DisplayName: org.Name,
+		Members:     make([]SCIMMember, 0),
+		Meta:        &SCIMMeta{ResourceType: "Group", Created: org.CreatedAt, LastModified: org.UpdatedAt},
+	}
+	for _, key := range keys {
+		if isSCIMUser(key) && key.OrgID != nil && *key.OrgID == org.ID {
+			group.Members = append(group.Members, SCIMMember{Value: key.ID, Display: *key.ClientCertIdentity})
+		}
+	}
+	return group
+}
+
+// loadSCIMUser loads the API key of the user in the path, writing the error response and
+// returning nil when there is none
+func (s *FileService) loadSCIMUser(c *gin.Context) *APIKeyStorage {
+	key, err := s.db.GetAPIKey(c.Param("id"))
+	if err != nil {
+		log.Printf("Failed to get API key: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Database error")
+		return nil
+	}
+	if !isSCIMUser(key) {
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return nil
+	}
+	return key
+}
+
+// setSCIMUser gives the API key of a user a userName and, unless active is nil, activates
+// or deactivates it. Deactivating expires the key now; activating a deactivated key
+// removes its expiry. It writes the error response and returns false when the userName
+// is taken by another key.
+func (s *FileService) setSCIMUser(c *gin.Context, key *APIKeyStorage, userName string, active *bool) bool {
+	userName = strings.TrimSpace(userName)
+	if userName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return false
+	}
+	if key.ClientCertIdentity == nil || *key.ClientCertIdentity != userName {
+		existing, err := s.db.GetAPIKeyByCertIdentity([]string{userName})
+		if err != nil {
+			log.Printf("Failed to look up API key: %v", err)
+			scimError(c, http.StatusInternalServerError, "", "Database error")
+			return false
+		}
+		if existing != nil && existing.ID != key.ID {
+			scimError(c, http.StatusConflict, "uniqueness", "userName "+strconv.Quote(userName)+" is already provisioned")
+			return false
+		}
+		key.ClientCertIdentity = &userName
+	}
+	key.Name = userName
+
+	if active != nil && *active != key.IsActive() {
+		if *active {
+			key.ExpiresAt = nil
+		} else {
+			now := s.clock.Now()
+			key.ExpiresAt = &now
+		}
+	}
+	return true
+}
+
+// listSCIMUsers lists the users, or finds one with a userName filter
+func (s *FileService) listSCIMUsers(c *gin.Context) {
+	userName, ok := scimFilterValue(c, scimUserNameFilter)
+	if !ok {
+		return
+	}
+	keys, err := s.db.ListAPIKeys()
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+
+	users := make([]SCIMUser, 0)
+	for _, key := range keys {
+		if isSCIMUser(key) && (userName == "" || *key.ClientCertIdentity == userName) {
+			users = append(users, scimUser(key))
+		}
+	}
+	scimList(c, users)
+}
+
+// createSCIMUser provisions a user as an API key mapped to their client certificate
+func (s *FileService) createSCIMUser(c *gin.Context) {
+	var req SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+
+	// The secret is discarded: users authenticate with their certificate only
+	rawKey := generateAPIKey()
+	key := &APIKeyStorage{
+		ID:        generateID(),
+		KeyPrefix: rawKey[:8],
+		KeyHash:   hashAPIKey(rawKey),
+		RateLimit: s.config.APIKeyDefaultRateLimit,
+		OrgRole:   orgRoleMember,
+	}
+	if !s.setSCIMUser(c, key, req.UserName, req.Active) {
+		return
+	}
+
+	if err := s.db.CreateAPIKey(key); err != nil {
+		log.Printf("Failed to create API key: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Failed to provision user")
+		return
+	}
+	scimJSON(c, http.StatusCreated, scimUser(key))
+}
+
+// getSCIMUser describes a user
+func (s *FileService) getSCIMUser(c *gin.Context) {
+	if key := s.loadSCIMUser(c); key != nil {
+		scimJSON(c, http.StatusOK, scimUser(key))
+	}
+}
+
+// replaceSCIMUser sets the userName and active state of a user
+func (s *FileService) replaceSCIMUser(c *gin.Context) {
+	var req SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	key := s.loadSCIMUser(c)
+	if key == nil {
+		return
+	}
+
+	// A replaced user without active is active
+	active := req.Active == nil || *req.Active
+	if !s.setSCIMUser(c, key, req.UserName, &active) {
+		return
+	}
+	s.saveSCIMUser(c, key)
+}
+
+// patchSCIMUser changes the userName or active state of a user, the attributes identity
+// providers patch when people are renamed, suspended or leave
+func (s *FileService) patchSCIMUser(c *gin.Context) {
+	var req SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	key := s.loadSCIMUser(c)
+	if key == nil {
+		return
+	}
+
+	userName := *key.ClientCertIdentity
+	var active *bool
+	for _, op := range req.Operations {
+		if kind := strings.ToLower(op.Op); kind != "replace" && kind != "add" {
+			scimError(c, http.StatusBadRequest, "invalidValue", "Users support only add and replace operations")
+			return
+		}
+		// Without a path the value holds the attributes to set
+		values := map[string]json.RawMessage{op.Path: op.Value}
+		if op.Path == "" && json.Unmarshal(op.Value, &values) != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", "A patch without a path needs an object value")
+			return
+		}
+		for path, value := range values {
+			var err error
+			switch strings.ToLower(path) {
+			case "username":
+				err = json.Unmarshal(value, &userName)
+			case "active":
+				active, err = parseSCIMBool(value)
+			default:
+				continue // Attributes the service doesn't keep, such as names and emails
+			}
+			if err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", fmt.Sprintf("Invalid %s: %v", path, err))
+				return
+			}
+		}
+	}
+
+	if !s.setSCIMUser(c, key, userName, active) {
+		return
+	}
+	s.saveSCIMUser(c, key)
+}
+
+// parseSCIMBool parses a boolean value, which some identity providers send as a string
+func parseSCIMBool(value json.RawMessage) (*bool, error) {
+	var parsed bool
+	if err := json.Unmarshal(value, &parsed); err == nil {
+		return &parsed, nil
+	}
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return nil, fmt.Errorf("want a boolean")
+	}
+	parsed, err := strconv.ParseBool(text)
+	if err != nil {
+		return nil, fmt.Errorf("want a boolean")
+	}
+	return &parsed, nil
+}
+
+// saveSCIMUser stores a changed user and writes it as the response
+func (s *FileService) saveSCIMUser(c *gin.Context, key *APIKeyStorage) {
+	if err := s.db.UpdateAPIKey(key); err != nil {
+		log.Printf("Failed to update API key: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Failed to update user")
+		return
+	}
+	scimJSON(c, http.StatusOK, scimUser(key))
+}
+
+// deleteSCIMUser deprovisions a user by revoking their API key. The key's certificate
+// mapping is removed first, so the userName can be provisioned again.
+func (s *FileService) deleteSCIMUser(c *gin.Context) {
+	key := s.loadSCIMUser(c)
+	if key == nil {
+		return
+	}
+
+	key.ClientCertIdentity = nil
+	if err := s.db.UpdateAPIKey(key); err != nil {
+		log.Printf("Failed to update API key: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Failed to deprovision user")
+		return
+	}
+	if err := s.db.RevokeAPIKey(key.ID); err != nil {
+		log.Printf("Failed to revoke API key: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Failed to deprovision user")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// listSCIMGroups lists the groups with their members, or finds one with a displayName
+// filter
+func (s *FileService) listSCIMGroups(c *gin.Context) {
+	displayName, ok := scimFilterValue(c, scimDisplayNameFilter)
+	if !ok {
+		return
+	}
+	orgs, err := s.db.ListOrgs()
+	if err != nil {
+		log.Printf("Failed to list orgs: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+	keys, err := s.db.ListAPIKeys()
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+
+	groups := make([]SCIMGroup, 0)
+	for _, org := range orgs {
+		if displayName == "" || org.Name == displayName {
+			groups = append(groups, scimGroup(org, keys))
+		}
+	}
+	scimList(c, groups)
+}
+
+// loadSCIMGroup loads the org of the group in the path, writing the error response and
+// returning nil when there is none
+func (s *FileService) loadSCIMGroup(c *gin.Context) *Org {
+	org, err := s.db.GetOrg(c.Param("id"))
+	if err != nil {
+		log.Printf("Failed to get org: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Database error")
+		return nil
+	}
+	if org == nil {
+		scimError(c, http.StatusNotFound, "", "Group not found")
+		return nil
+	}
+	return org
+}
+
+// writeSCIMGroup writes a group with its current members as the response
+func (s *FileService) writeSCIMGroup(c *gin.Context, status int, org *Org) {
+	keys, err := s.db.ListAPIKeys()
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Database error")
+		return
+	}
+	scimJSON(c, status, scimGroup(org, keys))
+}
+
+// setSCIMGroupMembers adds users to an org and removes others from it. With replace set,
+// every other member is removed too. It writes the error response and returns false when
+// a user doesn't exist or can't be updated.
+func (s *FileService) setSCIMGroupMembers(c *gin.Context, org *Org, add, remove []string, replace bool) bool {
+	keys, err := s.db.ListAPIKeys()
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Database error")
+		return false
+	}
+	users := make(map[string]*APIKeyStorage)
+	for _, key := range keys {
+		if isSCIMUser(key) {
+			users[key.ID] = key
+		}
+	}
+
+	members := make(map[string]bool)
+	for _, id := range add {
+		if users[id] == nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", "Unknown member "+strconv.Quote(id))
+			return false
+		}
+		members[id] = true
+	}
+	removed := make(map[string]bool)
+	for _, id := range remove {
+		removed[id] = true
+	}
+
+	for _, key := range users {
+		inOrg := key.OrgID != nil && *key.OrgID == org.ID
+		switch {
+		case members[key.ID] && !inOrg:
+			key.OrgID = &org.ID
+		case inOrg && !members[key.ID] && (replace || removed[key.ID]):
+			key.OrgID = nil
+		default:
+			continue
+		}
+		if err := s.db.UpdateAPIKey(key); err != nil {
+			log.Printf("Failed to update API key: %v", err)
+			scimError(c, http.StatusInternalServerError, "", "Failed to update group members")
+			return false
+		}
+	}
+	return true
+}
+
+// memberIDs returns the IDs of members
+func memberIDs(members []SCIMMember) []string {
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.Value)
+	}
+	return ids
+}
+
+// createSCIMGroup provisions a group as an org with the given members
+func (s *FileService) createSCIMGroup(c *gin.Context) {
+	var req SCIMGroup
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.DisplayName) == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	org := &Org{ID: generateID(), Name: strings.TrimSpace(req.DisplayName)}
+	if err := s.db.CreateOrg(org); err != nil {
+		log.Printf("Failed to create org: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Failed to provision group")
+		return
+	}
+	if !s.setSCIMGroupMembers(c, org, memberIDs(req.Members), nil, false) {
+		return
+	}
+	s.writeSCIMGroup(c, http.StatusCreated, org)
+}
+
+// getSCIMGroup describes a group and its members
+func (s *FileService) getSCIMGroup(c *gin.Context) {
+	if org := s.loadSCIMGroup(c); org != nil {
+		s.writeSCIMGroup(c, http.StatusOK, org)
+	}
+}
+
+// replaceSCIMGroup sets the displayName and members of a group
+func (s *FileService) replaceSCIMGroup(c *gin.Context) {
+	var req SCIMGroup
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	org := s.loadSCIMGroup(c)
+	if org == nil {
+		return
+	}
+
+	if !s.renameSCIMGroup(c, org, req.DisplayName) {
+		return
+	}
+	if !s.setSCIMGroupMembers(c, org, memberIDs(req.Members), nil, true) {
+		return
+	}
+	s.writeSCIMGroup(c, http.StatusOK, org)
+}
+
+// renameSCIMGroup sets the name of the org of a group, writing the error response and
+// returning false when it can't
+func (s *FileService) renameSCIMGroup(c *gin.Context, org *Org, displayName string) bool {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return false
+	}
+	if displayName == org.Name {
+		return true
+	}
+	org.Name = displayName
+	if err := s.db.UpdateOrg(org); err != nil {
+		log.Printf("Failed to update org: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Failed to update group")
+		return false
+	}
+	return true
+}
+
+// patchSCIMGroup renames a group or adds, removes or replaces its members
+func (s *FileService) patchSCIMGroup(c *gin.Context) {
+	var req SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	org := s.loadSCIMGroup(c)
+	if org == nil {
+		return
+	}
+
+	for _, op := range req.Operations {
+		kind := strings.ToLower(op.Op)
+		path := strings.ToLower(op.Path)
+
+		// Without a path the value holds the attributes to set
+		var attributes SCIMGroup
+		if path == "" {
+			if kind == "remove" || json.Unmarshal(op.Value, &attributes) != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", "A patch without a path needs an object value")
+				return
+			}
+			if attributes.DisplayName != "" && !s.renameSCIMGroup(c, org, attributes.DisplayName) {
+				return
+			}
+			if attributes.Members != nil && !s.setSCIMGroupMembers(c, org, memberIDs(attributes.Members), nil, kind == "replace") {
+				return
+			}
+			continue
+		}
+
+		if path == "displayname" {
+			var displayName string
+			if kind == "remove" || json.Unmarshal(op.Value, &displayName) != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", "displayName must be a string")
+				return
+			}
+			if !s.renameSCIMGroup(c, org, displayName) {
+				return
+			}
+			continue
+		}
+
+		// members[value eq "id"] removes one member
+		if match := scimMemberPath.FindStringSubmatch(op.Path); match != nil && kind == "remove" {
+			if !s.setSCIMGroupMembers(c, org, nil, []string{match[1]}, false) {
+				return
+			}
+			continue
+		}
+		if path != "members" {
+			scimError(c, http.StatusBadRequest, "invalidPath", "Unsupported path "+strconv.Quote(op.Path))
+			return
+		}
+		var members []SCIMMember
+		if len(op.Value) > 0 && json.Unmarshal(op.Value, &members) != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", "members must be a list of members")
+			return
+		}
+		var ok bool
+		switch kind {
+		case "add":
+			ok = s.setSCIMGroupMembers(c, org, memberIDs(members), nil, false)
+		case "replace":
+			ok = s.setSCIMGroupMembers(c, org, memberIDs(members), nil, true)
+		case "remove":
+			// Removing members without a value removes all of them
+			ok = s.setSCIMGroupMembers(c, org, nil, memberIDs(members), len(op.Value) == 0)
+		default:
+			scimError(c, http.StatusBadRequest, "invalidValue", "Unknown operation "+strconv.Quote(op.Op))
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+	s.writeSCIMGroup(c, http.StatusOK, org)
+}
+
+// deleteSCIMGroup deprovisions a group by deleting its org. Its members keep their keys,
+// and the org's files stay with the keys that uploaded them.
+func (s *FileService) deleteSCIMGroup(c *gin.Context) {
+	org := s.loadSCIMGroup(c)
+	if org == nil {
+		return
+	}
+	if err := s.db.DeleteOrg(org.ID); err != nil {
+		log.Printf("Failed to delete org: %v", err)
+		scimError(c, http.StatusInternalServerError, "", "Failed to deprovision group")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
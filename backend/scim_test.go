@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scimRouter serves the SCIM endpoints of a test service with SCIM_TOKEN set
+func scimRouter(ts *testService) func(method, path, token, body string) *httptest.ResponseRecorder {
+	ts.config.SCIMToken = "scim-secret"
+	router := gin.New()
+	registerSCIMRoutes(router, ts.FileService)
+	return func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", scimContentType)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+}
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	ts := newTestService(t)
+	request := scimRouter(ts)
+	signsIn := func() bool {
+		key, err := ts.authenticateAPIKey("", []string{"alice@example.com"})
+		return err == nil && key != nil
+	}
+
+	if w := request(http.MethodGet, "/scim/v2/Users", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: got %d, want 401", w.Code)
+	}
+	if w := request(http.MethodGet, "/scim/v2/Users", "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: got %d, want 401", w.Code)
+	}
+
+	w := request(http.MethodPost, "/scim/v2/Users", "scim-secret", `{"schemas":["`+scimUserSchema+`"],"userName":"alice@example.com","name":{"givenName":"Alice"}}`)
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != scimContentType {
+		t.Fatalf("provision: got %d (%s): %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+	var user SCIMUser
+	json.Unmarshal(w.Body.Bytes(), &user)
+	if user.ID == "" || user.Active == nil || !*user.Active || !signsIn() {
+		t.Fatalf("provisioned user %+v does not sign in", user)
+	}
+	if w := request(http.MethodPost, "/scim/v2/Users", "scim-secret", `{"userName":"alice@example.com"}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate userName: got %d, want 409", w.Code)
+	}
+
+	w = request(http.MethodGet, `/scim/v2/Users?filter=userName+eq+"alice@example.com"`, "scim-secret", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"totalResults":1`) {
+		t.Errorf("filter by userName: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodGet, `/scim/v2/Users?filter=emails+co+"x"`, "scim-secret", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("unsupported filter: got %d, want 400", w.Code)
+	}
+
+	// Deactivating the departed user shuts their certificate out, and it can be undone
+	deactivate := `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"Replace","path":"active","value":"False"}]}`
+	if w := request(http.MethodPatch, "/scim/v2/Users/"+user.ID, "scim-secret", deactivate); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":false`) {
+		t.Fatalf("deactivate: got %d: %s", w.Code, w.Body.String())
+	}
+	if signsIn() {
+		t.Error("deactivated user still signs in")
+	}
+	if w := request(http.MethodPatch, "/scim/v2/Users/"+user.ID, "scim-secret", `{"Operations":[{"op":"replace","value":{"active":true}}]}`); w.Code != http.StatusOK {
+		t.Fatalf("reactivate: got %d: %s", w.Code, w.Body.String())
+	}
+	if !signsIn() {
+		t.Error("reactivated user does not sign in")
+	}
+
+	if w := request(http.MethodDelete, "/scim/v2/Users/"+user.ID, "scim-secret", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("deprovision: got %d: %s", w.Code, w.Body.String())
+	}
+	if signsIn() {
+		t.Error("deprovisioned user still signs in")
+	}
+	if key, _ := ts.store.GetAPIKey(user.ID); key == nil || key.RevokedAt == nil {
+		t.Error("deprovisioning did not revoke the key")
+	}
+	if w := request(http.MethodGet, "/scim/v2/Users/"+user.ID, "scim-secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("deprovisioned user: got %d, want 404", w.Code)
+	}
+	if w := request(http.MethodPost, "/scim/v2/Users", "scim-secret", `{"userName":"alice@example.com"}`); w.Code != http.StatusCreated || !signsIn() {
+		t.Errorf("provisioning again: got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSCIMGroupsAreOrgs(t *testing.T) {
+	ts := newTestService(t)
+	request := scimRouter(ts)
+	provision := func(userName string) string {
+		w := request(http.MethodPost, "/scim/v2/Users", "scim-secret", `{"userName":"`+userName+`"}`)
+		var user SCIMUser
+		json.Unmarshal(w.Body.Bytes(), &user)
+		return user.ID
+	}
+	alice, bob := provision("alice"), provision("bob")
+	orgOf := func(keyID string) string {
+		key, _ := ts.store.GetAPIKey(keyID)
+		if key.OrgID == nil {
+			return ""
+		}
+		return *key.OrgID
+	}
+
+	w := request(http.MethodPost, "/scim/v2/Groups", "scim-secret", `{"displayName":"Engineering","members":[{"value":"`+alice+`"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create group: got %d: %s", w.Code, w.Body.String())
+	}
+	var group SCIMGroup
+	json.Unmarshal(w.Body.Bytes(), &group)
+	if org, _ := ts.store.GetOrg(group.ID); org == nil || org.Name != "Engineering" || orgOf(alice) != group.ID {
+		t.Fatalf("group %+v is not an org with alice in it", group)
+	}
+	if w := request(http.MethodPost, "/scim/v2/Groups", "scim-secret", `{"displayName":"Ghosts","members":[{"value":"nobody"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown member: got %d, want 400", w.Code)
+	}
+
+	path := "/scim/v2/Groups/" + group.ID
+	patch := func(operations string) *httptest.ResponseRecorder {
+		return request(http.MethodPatch, path, "scim-secret", `{"Operations":[`+operations+`]}`)
+	}
+	if w := patch(`{"op":"add","path":"members","value":[{"value":"` + bob + `"}]}`); w.Code != http.StatusOK || orgOf(bob) != group.ID {
+		t.Errorf("add member: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := patch(`{"op":"remove","path":"members[value eq \"` + alice + `\"]"}`); w.Code != http.StatusOK || orgOf(alice) != "" || orgOf(bob) != group.ID {
+		t.Errorf("remove member: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := patch(`{"op":"replace","path":"displayName","value":"Platform"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"displayName":"Platform"`) {
+		t.Errorf("rename: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPut, path, "scim-secret", `{"displayName":"Platform","members":[{"value":"`+alice+`"}]}`); w.Code != http.StatusOK || orgOf(alice) != group.ID || orgOf(bob) != "" {
+		t.Errorf("replace: got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = request(http.MethodGet, `/scim/v2/Groups?filter=displayName+eq+"Platform"`, "scim-secret", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"totalResults":1`) || !strings.Contains(w.Body.String(), alice) {
+		t.Errorf("filter by displayName: got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := request(http.MethodDelete, path, "scim-secret", ""); w.Code != http.StatusNoContent || orgOf(alice) != "" {
+		t.Errorf("delete group: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodGet, path, "scim-secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("deleted group: got %d, want 404", w.Code)
+	}
+}
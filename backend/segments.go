@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Segmented downloads let clients fetch a file as several byte ranges in parallel, which
+// is much faster than one stream on high-latency links. The segment plan names the ranges
+// to request from /api/file/:id with their SHA-256, so each range can be verified, and
+// retried alone, before the client assembles the file.
+
+const (
+	defaultDownloadSegments = 4
+	maxDownloadSegments     = 64
+	// Segments are whole multiples of this, so no range is too small to be worth a request
+	downloadSegmentAlignment = 1024 * 1024
+	segmentPlanCachePrefix   = "segments:"
+	segmentPlanCacheTTL      = 24 * time.Hour
+)
+
+// DownloadSegment is one byte range of a segmented download
+type DownloadSegment struct {
+	Index  int    `json:"index"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Range  string `json:"range"` // Range header requesting the segment
+	SHA256 string `json:"sha256"`
+}
+
+// SegmentPlan is how to download a file in segments
+type SegmentPlan struct {
+	FileID      string            `json:"file_id"`
+	Filename    string            `json:"filename"`
+	URL         string            `json:"url"`
+	Size        int64             `json:"size"`
+	SHA256      string            `json:"sha256"`
+	SegmentSize int64             `json:"segment_size"`
+	Segments    []DownloadSegment `json:"segments"`
+}
+
+// segmentSize splits size bytes into at most count aligned segments
+func segmentSize(size int64, count int) int64 {
+	perSegment := (size + int64(count) - 1) / int64(count)
+	aligned := (perSegment + downloadSegmentAlignment - 1) / downloadSegmentAlignment * downloadSegmentAlignment
+	if aligned == 0 {
+		return downloadSegmentAlignment
+	}
+	return aligned
+}
+
+// planSegments returns the segments of a size-byte file, without their checksums
+func planSegments(size, segmentSize int64) []DownloadSegment {
+	segments := []DownloadSegment{}
+	for offset := int64(0); offset < size; offset += segmentSize {
+		length := min(segmentSize, size-offset)
+		segments = append(segments, DownloadSegment{
+			Index:  len(segments),
+			Offset: offset,
+			Length: length,
+			Range:  fmt.Sprintf("bytes=%d-%d", offset, offset+length-1),
+		})
+	}
+	return segments
+}
+
+// hashSegments reads the whole content once, filling in the checksum of every segment,
+// and returns the checksum of the content
+func hashSegments(r io.Reader, segments []DownloadSegment) (string, error) {
+	whole := sha256.New()
+	for i := range segments {
+		segment := sha256.New()
+		if _, err := io.CopyN(io.MultiWriter(whole, segment), r, segments[i].Length); err != nil {
+			return "", fmt.Errorf("failed to read segment %d: %v", i, err)
+		}
+		segments[i].SHA256 = hex.EncodeToString(segment.Sum(nil))
+	}
+	return hex.EncodeToString(whole.Sum(nil)), nil
+}
+
+// getSegmentPlan serves the segment plan of a file. Checksumming reads the whole file, so
+// plans are cached per segment size; files still being appended to are always read anew.
+//
+// @summary Get the checksummed segments of a file
+// @tags file
+// @path id File ID
+// @query segments integer Number of segments
+// @success 200 SegmentPlan
+// @auth downloadPassword adminToken optional
+func (s *FileService) getSegmentPlan(c *gin.Context) {
+	count := defaultDownloadSegments
+	if value := c.Query("segments"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDownloadSegments {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":        "segments must be between 1 and the maximum",
+				"max_segments": maxDownloadSegments,
+			})
+			return
+		}
+		count = n
+	}
+
+	fileStorage, err := s.lookupFile(c.Param("id"), false)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+
+	size := segmentSize(fileStorage.OriginalSize, count)
+	ctx := context.Background()
+	cacheKey := segmentPlanCachePrefix + fileStorage.ID + ":" + strconv.FormatInt(size, 10)
+	cacheable := fileStorage.AppendState == nil || *fileStorage.AppendState != AppendStateOpen
+	if cacheable {
+		if cached, err := s.redis.Get(ctx, cacheKey).Bytes(); err == nil {
+			var plan SegmentPlan
+			if json.Unmarshal(cached, &plan) == nil {
+				c.JSON(http.StatusOK, plan)
+				return
+			}
+		}
+	}
+
+	// Hashing reads as much as a download, so it takes a download slot
+	if err := s.downloadSem.Acquire(c.Request.Context(), 1); err != nil {
+		respondRetryLater(c, http.StatusServiceUnavailable, errorCodeServerBusy, retryAfterBusy, gin.H{
+			"error": "Server busy, please try again later",
+		})
+		return
+	}
+	defer s.downloadSem.Release(1)
+
+	content, err := s.openTextContent(fileStorage)
+	if err != nil {
+		log.Printf("Failed to open file %s for segmenting: %v", fileStorage.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer content.Close()
+
+	plan := SegmentPlan{
+		FileID:      fileStorage.ID,
+		Filename:    fileStorage.Filename,
+		URL:         "/api/file/" + fileStorage.ID,
+		Size:        fileStorage.OriginalSize,
+		SegmentSize: size,
+		Segments:    planSegments(fileStorage.OriginalSize, size),
+	}
+	if plan.SHA256, err = hashSegments(content, plan.Segments); err != nil {
+		log.Printf("Failed to checksum file %s: %v", fileStorage.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	if cacheable {
+		ttl := min(fileStorage.ExpiresAt.Sub(s.clock.Now()), segmentPlanCacheTTL)
+		if encoded, err := json.Marshal(plan); err == nil && ttl > 0 {
+			s.redis.Set(ctx, cacheKey, encoded, ttl)
+		}
+	}
+	c.JSON(http.StatusOK, plan)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPlanSegments(t *testing.T) {
+	const mib = downloadSegmentAlignment
+	tests := []struct {
+		size     int64
+		count    int
+		wantSize int64
+		wantN    int
+	}{
+		{0, 4, mib, 0},
+		{100, 4, mib, 1},
+		{10 * mib, 4, 3 * mib, 4},
+		{8 * mib, 4, 2 * mib, 4},
+		{8*mib + 1, 8, 2 * mib, 5},
+	}
+	for _, tt := range tests {
+		size := segmentSize(tt.size, tt.count)
+		segments := planSegments(tt.size, size)
+		if size != tt.wantSize || len(segments) != tt.wantN {
+			t.Errorf("%d bytes in %d: segment size %d with %d segments, want %d with %d", tt.size, tt.count, size, len(segments), tt.wantSize, tt.wantN)
+			continue
+		}
+		var total int64
+		for i, segment := range segments {
+			if segment.Index != i || segment.Offset != total {
+				t.Errorf("%d bytes: segment %+v out of place", tt.size, segment)
+			}
+			total += segment.Length
+		}
+		if total != tt.size {
+			t.Errorf("%d bytes: segments cover %d", tt.size, total)
+		}
+	}
+}
+
+func TestSegmentPlan(t *testing.T) {
+	ts := newTestService(t)
+	content := strings.Repeat("0123456789abcdef", downloadSegmentAlignment/16*5/2) // 2.5 MiB
+	ts.saveTestFile(t, "big", content, time.Hour)
+
+	param := gin.Param{Key: "id", Value: "big"}
+	get := func(query string) (int, SegmentPlan) {
+		w := ts.serve(ts.getSegmentPlan, httptest.NewRequest(http.MethodGet, "/api/file/big/segments"+query, nil), param)
+		var plan SegmentPlan
+		json.Unmarshal(w.Body.Bytes(), &plan)
+		return w.Code, plan
+	}
+
+	code, plan := get("?segments=4")
+	if code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if len(plan.Segments) != 3 || plan.SegmentSize != downloadSegmentAlignment {
+		t.Fatalf("plan = %d segments of %d bytes, want 3 of 1 MiB", len(plan.Segments), plan.SegmentSize)
+	}
+	for _, segment := range plan.Segments {
+		sum := sha256.Sum256([]byte(content[segment.Offset : segment.Offset+segment.Length]))
+		if segment.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("segment %d checksum mismatch", segment.Index)
+		}
+	}
+	if last := plan.Segments[2]; last.Range != "bytes=2097152-2621439" {
+		t.Errorf("last segment range = %q", last.Range)
+	}
+	whole := sha256.Sum256([]byte(content))
+	if plan.SHA256 != hex.EncodeToString(whole[:]) || plan.URL != "/api/file/big" {
+		t.Errorf("plan = %+v", plan)
+	}
+
+	// The plan is served from the cache once computed
+	cacheKey := segmentPlanCachePrefix + "big:1048576"
+	if _, ok := ts.redis.lookup(cacheKey); !ok {
+		t.Errorf("plan not cached under %s", cacheKey)
+	}
+
+	if code, _ := get("?segments=0"); code != http.StatusBadRequest {
+		t.Errorf("segments=0: got %d, want 400", code)
+	}
+	if code, _ := get("?segments=65"); code != http.StatusBadRequest {
+		t.Errorf("segments=65: got %d, want 400", code)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// testService wires a FileService to in-memory fakes
+type testService struct {
+	*FileService
+	clock *fakeClock
+	redis *fakeRedis
+	store *fakeStore
+}
+
+func newTestService(t *testing.T) *testService {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	config := LoadConfig()
+	config.TempDir = t.TempDir()
+	config.ArchiveStorageDir = t.TempDir()
+	config.ClamAVAddr = ""
+	config.HLSMinSize = 0
+	// The fakes don't implement streams, so no background consumers
+	config.MetadataQueueWorkers = 0
+
+	clock := newFakeClock()
+	redisClient := newFakeRedis(clock)
+	store := newFakeStore(clock)
+	return &testService{
+		FileService: newFileService(config, redisClient, store, clock),
+		clock:       clock,
+		redis:       redisClient,
+		store:       store,
+	}
+}
+
+// serve runs handler against a request with the given route parameters
+func (ts *testService) serve(handler gin.HandlerFunc, req *http.Request, params ...gin.Param) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Params = params
+	c.Set("fileService", ts.FileService)
+	handler(c)
+	// Like gin's engine, send a status set without a body
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+func (ts *testService) saveTestFile(t *testing.T, id, content string, retention time.Duration) {
+	t.Helper()
+	now := ts.clock.Now()
+	size := int64(len(content))
+	err := ts.store.SaveFile(&FileStorage{
+		ID:              id,
+		Filename:        id + ".txt",
+		OriginalSize:    size,
+		CompressedSize:  &size,
+		MimeType:        "text/plain",
+		CompressionType: string(CompressionNone),
+		StorageType:     "postgresql",
+		FileContent:     []byte(content),
+		UploadTime:      now,
+		ExpiresAt:       now.Add(retention),
+		DeletePassword:  "delete-me",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetFileExpires(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "abc123", "hello", time.Hour)
+	param := gin.Param{Key: "id", Value: "abc123"}
+
+	w := ts.serve(ts.getFile, httptest.NewRequest(http.MethodGet, "/api/file/abc123", nil), param)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("before expiry: got %d %q, want 200 \"hello\"", w.Code, w.Body.String())
+	}
+
+	ts.clock.Advance(time.Hour + time.Second)
+	w = ts.serve(ts.getFile, httptest.NewRequest(http.MethodGet, "/api/file/abc123", nil), param)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("after expiry: got %d, want 404", w.Code)
+	}
+}
+
+func TestDeleteFileRequiresPassword(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "abc123", "hello", time.Hour)
+	param := gin.Param{Key: "id", Value: "abc123"}
+
+	w := ts.serve(ts.deleteFile, httptest.NewRequest(http.MethodDelete, "/api/file/abc123?delete_password=wrong", nil), param)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: got %d, want 401", w.Code)
+	}
+
+	w = ts.serve(ts.deleteFile, httptest.NewRequest(http.MethodDelete, "/api/file/abc123?delete_password=delete-me", nil), param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("right password: got %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if file, _ := ts.store.GetFileMetadata("abc123"); file != nil {
+		t.Fatal("file still stored after delete")
+	}
+}
+
+func TestChunkUploadSessionExpires(t *testing.T) {
+	ts := newTestService(t)
+	manager := ts.chunkManager
+
+	body := `{"filename":"big.bin","total_size":3000,"chunk_size":1000}`
+	req := httptest.NewRequest(http.MethodPost, "/api/upload/chunk/init", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(manager.InitiateUpload, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("initiate: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		UploadID    string    `json:"upload_id"`
+		TotalChunks int       `json:"total_chunks"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalChunks != 3 {
+		t.Errorf("total_chunks = %d, want 3", resp.TotalChunks)
+	}
+	if want := ts.clock.Now().Add(ts.config.ChunkTimeout); !resp.ExpiresAt.Equal(want) {
+		t.Errorf("expires_at = %v, want %v", resp.ExpiresAt, want)
+	}
+
+	// Still inside the timeout: cleanup keeps the session
+	ts.clock.Advance(ts.config.ChunkTimeout / 2)
+	manager.cleanupExpiredUploads()
+	if _, ok := manager.uploads.Load(resp.UploadID); !ok {
+		t.Fatal("active session removed by cleanup")
+	}
+
+	ts.clock.Advance(ts.config.ChunkTimeout)
+	manager.cleanupExpiredUploads()
+	if _, err := ts.redis.Get(context.Background(), "chunk_upload:"+resp.UploadID).Result(); err != redis.Nil {
+		t.Errorf("session key not expired: %v", err)
+	}
+	if _, ok := manager.uploads.Load(resp.UploadID); ok {
+		t.Fatal("expired session not removed by cleanup")
+	}
+	if stored, _ := ts.store.GetChunkUpload(resp.UploadID); stored != nil {
+		t.Fatal("expired session still persisted")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+	"file-storage-service/internal/qr"
+)
+
+// A share summary is a one-page handout for recipients who'd rather not copy links: the
+// file's name, size and expiry, its link and a QR code of it, and a line to write the
+// download password on. It is rendered from metadata only, as HTML for the browser's
+// print dialog or as a PDF, and shows nothing /api/metadata/:id doesn't.
+
+// shareSummary is what a share summary shows
+type shareSummary struct {
+	Title             string
+	Filename          string
+	About             string // The uploader's caption or description
+	Size              string
+	ExpiresAt         string
+	URL               string
+	PasswordProtected bool
+	QR                *qr.Code
+}
+
+// buildShareSummary collects the summary of a file. The link points at the file page.
+func (s *FileService) buildShareSummary(c *gin.Context, file *FileStorage) (*shareSummary, error) {
+	summary := &shareSummary{
+		Title:             "A file has been shared with you",
+		Filename:          file.Filename,
+		Size:              formatSize(file.OriginalSize),
+		ExpiresAt:         file.ExpiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+		URL:               strings.TrimSuffix(s.publicBaseURL(c), "/") + "/f/" + file.ID,
+		PasswordProtected: file.HasDownloadPassword,
+	}
+	if file.Accessibility != nil {
+		summary.About = file.Accessibility.Caption
+		if summary.About == "" {
+			summary.About = file.Accessibility.Description
+		}
+	}
+	if branding := s.orgBranding(file); branding != nil && branding.DisplayName != "" {
+		summary.Title = branding.DisplayName + " has shared a file with you"
+	}
+
+	code, err := qr.Encode(summary.URL, qr.Medium)
+	if err != nil {
+		return nil, err
+	}
+	summary.QR = code
+	return summary, nil
+}
+
+// getShareSummary renders the share summary of a file, as HTML or, with format=pdf, as
+// a PDF
+//
+// @summary Render the share summary of a file
+// @tags file
+// @path id File ID
+// @query format string pdf for a PDF instead of HTML
+// @success 200 text/html application/pdf
+func (s *FileService) getShareSummary(c *gin.Context) {
+	format := c.DefaultQuery("format", "html")
+	if format != "html" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be html or pdf"})
+		return
+	}
+
+	fileID := c.Param("id")
+	fileStorage, err := s.lookupFile(fileID, false)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found or expired"})
+		return
+	}
+
+	summary, err := s.buildShareSummary(c, fileStorage)
+	if err != nil {
+		log.Printf("Failed to build share summary of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render summary"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	if format == "pdf" {
+		name := strings.TrimSuffix(fileStorage.Filename, ".") + " - share.pdf"
+		c.Header("Content-Disposition", files.ContentDisposition("inline", name))
+		c.Data(http.StatusOK, "application/pdf", renderShareSummaryPDF(summary))
+		return
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'self'")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	err = shareSummaryTemplate.Execute(c.Writer, map[string]interface{}{
+		"Summary": summary,
+		"QR":      template.HTML(summary.QR.SVG()),
+	})
+	if err != nil {
+		log.Printf("getShareSummary: failed to render %s: %v", fileID, err)
+	}
+}
+
+var shareSummaryTemplate = template.Must(template.New("summary").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Summary.Filename}}</title>
+<style>
+@page{size:A4;margin:20mm}
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif;max-width:170mm;margin:0 auto;padding:24px;color:#111;background:#fff}
+h1{font-size:22px;margin:0 0 24px}
+.name{font-size:18px;font-weight:600;word-break:break-all}
+.about{font-size:15px;margin:8px 0 0;white-space:pre-line}
+dl{display:grid;grid-template-columns:auto 1fr;gap:4px 16px;margin:12px 0 28px;font-size:15px}
+dt{color:#555}
+dd{margin:0}
+.qr{width:60mm;height:60mm;display:block;margin:0 auto 12px}
+.url{text-align:center;font:14px ui-monospace,monospace;word-break:break-all;margin-bottom:28px}
+.password{font-size:15px;margin-bottom:28px}
+.password span{display:inline-block;width:90mm;border-bottom:1px solid #111;margin-left:8px}
+.note{color:#555;font-size:13px;line-height:1.5}
+@media print{body{padding:0}}
+</style>
+</head>
+<body>
+<h1>{{.Summary.Title}}</h1>
+<div class="name">{{.Summary.Filename}}</div>
+{{if .Summary.About}}<p class="about">{{.Summary.About}}</p>
+{{end}}<dl>
+<dt>Size</dt><dd>{{.Summary.Size}}</dd>
+<dt>Available until</dt><dd>{{.Summary.ExpiresAt}}</dd>
+</dl>
+<div class="qr">{{.QR}}</div>
+<div class="url">{{.Summary.URL}}</div>
+{{if .Summary.PasswordProtected}}<div class="password">Password:<span>&nbsp;</span></div>
+{{end}}<p class="note">Scan the code with a phone camera, or type the address into a web browser, to download the file.{{if .Summary.PasswordProtected}} The file is protected by the password written above.{{end}} It is deleted after the date above.</p>
+</body>
+</html>
+`))
+
+// renderShareSummaryPDF lays the summary out on an A4 page. The PDF is written by hand:
+// one page of Helvetica text and the QR code drawn as filled squares.
+func renderShareSummaryPDF(summary *shareSummary) []byte {
+	const (
+		pageWidth = 595
+		margin    = 56
+		qrSize    = 200
+	)
+
+	var content bytes.Buffer
+	y := 780
+	text := func(font string, size int, x int, s string) {
+		fmt.Fprintf(&content, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+	}
+
+	text("F2", 20, margin, summary.Title)
+	y -= 40
+	for _, line := range wrapText(summary.Filename, 60) {
+		text("F2", 14, margin, line)
+		y -= 18
+	}
+	if summary.About != "" {
+		about := strings.Join(strings.Fields(summary.About), " ")
+		for i, line := range wrapText(about, 90) {
+			if i == 4 {
+				break // The summary is a single page
+			}
+			text("F1", 11, margin, line)
+			y -= 15
+		}
+	}
+	y -= 6
+	text("F1", 11, margin, "Size: "+summary.Size)
+	y -= 16
+	text("F1", 11, margin, "Available until: "+summary.ExpiresAt)
+	y -= 24
+
+	// The QR code with its quiet zone, centered
+	modules := summary.QR.Size + 2*qr.QuietZone
+	module := float64(qrSize) / float64(modules)
+	left := float64(pageWidth-qrSize) / 2
+	top := float64(y)
+	content.WriteString("0 g\n")
+	for row := 0; row < summary.QR.Size; row++ {
+		for col := 0; col < summary.QR.Size; col++ {
+			if summary.QR.Black(col, row) {
+				fmt.Fprintf(&content, "%.2f %.2f %.2f %.2f re\n",
+					left+float64(col+qr.QuietZone)*module, top-float64(row+qr.QuietZone+1)*module, module, module)
+			}
+		}
+	}
+	content.WriteString("f\n")
+	y -= qrSize + 10
+
+	for _, line := range wrapText(summary.URL, 80) {
+		text("F1", 10, margin, line)
+		y -= 14
+	}
+	y -= 16
+	if summary.PasswordProtected {
+		text("F1", 12, margin, "Password:")
+		fmt.Fprintf(&content, "0.75 w %d %d m %d %d l S\n", margin+62, y-2, pageWidth-margin, y-2)
+		y -= 32
+	}
+	note := "Scan the code with a phone camera, or type the address into a web browser, to download the file."
+	if summary.PasswordProtected {
+		note += " The file is protected by the password written above."
+	}
+	note += " It is deleted after the date above."
+	for _, line := range wrapText(note, 95) {
+		text("F1", 10, margin, line)
+		y -= 14
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d 842] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pageWidth),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R /Info << /Producer (ONE) /CreationDate (D:%s) >> >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, time.Now().UTC().Format("20060102150405Z"), xref)
+	return pdf.Bytes()
+}
+
+// pdfString escapes text for a PDF string in WinAnsiEncoding, which covers Latin-1;
+// other characters become '?'
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7F:
+			b.WriteRune(r)
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// wrapText breaks text into lines of at most width characters, at spaces where it can
+func wrapText(text string, width int) []string {
+	var lines []string
+	runes := []rune(text)
+	for len(runes) > width {
+		cut := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	return append(lines, string(runes))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShareSummary(t *testing.T) {
+	ts := newTestService(t)
+	ts.saveTestFile(t, "minutes", "meeting minutes", time.Hour)
+	summary := func(id, format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/file/"+id+"/summary?format="+format, nil)
+		return ts.serve(ts.getShareSummary, req, gin.Param{Key: "id", Value: id})
+	}
+
+	w := summary("minutes", "html")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("html: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{"minutes.txt", "/f/minutes", "<svg", "15 B"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("html doesn't contain %q", want)
+		}
+	}
+	if strings.Contains(body, "Password:") {
+		t.Error("html has a password line for an unprotected file")
+	}
+
+	w = summary("minutes", "pdf")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("pdf: got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	pdf := w.Body.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Errorf("pdf isn't framed as a PDF: %.20q ... %q", pdf, pdf[max(0, len(pdf)-10):])
+	}
+	if !bytes.Contains(pdf, []byte("(minutes.txt)")) || bytes.Contains(pdf, []byte("(Password:)")) {
+		t.Error("pdf doesn't show the filename, or shows a password line")
+	}
+
+	file, _ := ts.store.GetFileMetadata("minutes")
+	file.HasDownloadPassword = true
+	ts.store.SaveFile(file)
+	if w := summary("minutes", "html"); !strings.Contains(w.Body.String(), "Password:") {
+		t.Error("html has no password line for a protected file")
+	}
+	if w := summary("minutes", "pdf"); !bytes.Contains(w.Body.Bytes(), []byte("(Password:)")) {
+		t.Error("pdf has no password line for a protected file")
+	}
+
+	if w := summary("minutes", "docx"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: got %d, want 400", w.Code)
+	}
+	if w := summary("missing", "html"); w.Code != http.StatusNotFound {
+		t.Errorf("missing file: got %d, want 404", w.Code)
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	if got := pdfString(`Q3 (draft) \ café 報告`); got != `Q3 \(draft\) \\ caf\351 ??` {
+		t.Errorf("pdfString = %q", got)
+	}
+}
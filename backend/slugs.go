@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// An upload may choose a vanity slug, so its link reads /f/release-notes instead of
+// /f/<uuid>. Slugs are kept in file_slugs apart from file IDs and are unique among
+// unexpired files; the slug of a file that expired or was removed can be chosen again.
+// Since slugs share /f/ with the file page, they can't take the form of a UUID, and a
+// short file ID is resolved to its file before slugs are looked at.
+
+// slugPattern is 3 to 64 lowercase letters, digits, '-' and '_', starting and ending
+// with a letter or digit
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,62}[a-z0-9]$`)
+
+// slugFromRequest validates the slug an upload asked for, taken from the slug field or
+// its custom_id alias. Slugs are case-insensitive and stored lowercase. It writes the
+// error response and returns false when the slug is invalid or already taken.
+func (s *FileService) slugFromRequest(c *gin.Context, slug, customID string) (string, bool) {
+	slug, err := s.requestedSlug(slug, customID)
+	if err != nil {
+		err.respond(c)
+		return "", false
+	}
+	return slug, true
+}
+
+// requestedSlug is slugFromRequest, returning the error instead of writing it
+func (s *FileService) requestedSlug(slug, customID string) (string, *apiError) {
+	if slug == "" {
+		slug = customID
+	}
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if slug == "" {
+		return "", nil
+	}
+	if _, err := uuid.Parse(slug); err == nil || !slugPattern.MatchString(slug) {
+		return "", &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error":   "Invalid slug",
+			"message": "Slugs are 3 to 64 letters, digits, '-' and '_', starting and ending with a letter or digit.",
+		}}
+	}
+
+	// Checked up front so a taken slug fails before the content is stored
+	fileID, err := s.db.GetFileIDBySlug(slug)
+	if err != nil {
+		log.Printf("Failed to look up slug %s: %v", slug, err)
+		return "", newAPIError(http.StatusInternalServerError, "Database error")
+	}
+	if fileID != "" {
+		return "", &apiError{status: http.StatusConflict, body: gin.H{"error": "Slug already taken", "slug": slug}}
+	}
+	return slug, nil
+}
+
+// claimSlug points a slug at a file that was just stored. If another upload took the slug
+// in the meantime, the file is removed again and the error response written.
+func (s *FileService) claimSlug(c *gin.Context, slug string, fileStorage *FileStorage) bool {
+	if err := s.claimSlugFor(slug, fileStorage); err != nil {
+		err.respond(c)
+		return false
+	}
+	return true
+}
+
+// claimSlugFor is claimSlug, returning the error instead of writing it
+func (s *FileService) claimSlugFor(slug string, fileStorage *FileStorage) *apiError {
+	claimed, err := s.db.ClaimSlug(slug, fileStorage.ID)
+	if err == nil && claimed {
+		return nil
+	}
+
+	apiErr := &apiError{status: http.StatusConflict, body: gin.H{"error": "Slug already taken", "slug": slug}}
+	if err != nil {
+		log.Printf("Failed to claim slug %s for %s: %v", slug, fileStorage.ID, err)
+		apiErr = newAPIError(http.StatusInternalServerError, "Failed to save file")
+	}
+	if err := s.db.DeleteFile(fileStorage.ID); err != nil {
+		log.Printf("Failed to remove %s after its slug was refused: %v", fileStorage.ID, err)
+	}
+	if fileStorage.StoragePath != nil {
+		if err := removeStoredFile(s.config, *fileStorage.StoragePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete file from disk: %v", err)
+		}
+	}
+	s.redis.Del(context.Background(), "file:"+fileStorage.ID)
+	return apiErr
+}
+
+// resolveSlug redirects a vanity link to the file page. Anything else under /f/, like
+// the file page itself, is left to the frontend, with the file's link preview.
+func (s *FileService) resolveSlug(c *gin.Context) {
+	// Short file IDs can look like slugs once lowercased, and the file wins
+	if isShortFileID(s.config, c.Param("slug")) {
+		exists, err := s.db.FileIDExists(c.Param("slug"))
+		if err != nil {
+			log.Printf("Failed to look up file %s: %v", c.Param("slug"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if exists {
+			s.serveFilePage(c, c.Param("slug"))
+			return
+		}
+	}
+
+	slug := strings.ToLower(c.Param("slug"))
+	if _, err := uuid.Parse(slug); err != nil && slugPattern.MatchString(slug) {
+		fileID, err := s.db.GetFileIDBySlug(slug)
+		if err != nil {
+			log.Printf("Failed to look up slug %s: %v", slug, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if fileID != "" {
+			c.Redirect(http.StatusFound, "/f/"+fileID)
+			return
+		}
+	}
+	s.serveFilePage(c, c.Param("slug"))
+}
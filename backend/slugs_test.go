@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUploadWithSlug(t *testing.T) {
+	ts := newTestService(t)
+	upload := func(slug string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("slug", slug)
+		part, _ := writer.CreateFormFile("file", "notes.md")
+		part.Write([]byte("# Release notes"))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return ts.serve(ts.uploadFile, req)
+	}
+	resolve := func(slug string) *httptest.ResponseRecorder {
+		return ts.serve(ts.resolveSlug, httptest.NewRequest(http.MethodGet, "/f/"+slug, nil), gin.Param{Key: "slug", Value: slug})
+	}
+
+	w := upload("Release-Notes")
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		FileID  string `json:"file_id"`
+		Slug    string `json:"slug"`
+		SlugURL string `json:"slug_url"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Slug != "release-notes" || resp.SlugURL != "/f/release-notes" {
+		t.Errorf("slug = %q, slug_url = %q", resp.Slug, resp.SlugURL)
+	}
+
+	w = resolve("release-notes")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/f/"+resp.FileID {
+		t.Errorf("resolve: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	if w := upload("release-notes"); w.Code != http.StatusConflict {
+		t.Errorf("taken slug: got %d, want 409", w.Code)
+	}
+	if len(ts.store.files) != 1 {
+		t.Errorf("stored %d files, want 1", len(ts.store.files))
+	}
+	for _, slug := range []string{"ab", "-notes", "release notes", "notes/v2", "0b5e7a3c-1f2d-4e5f-8a9b-0c1d2e3f4a5b"} {
+		if w := upload(slug); w.Code != http.StatusBadRequest {
+			t.Errorf("slug %q: got %d, want 400", slug, w.Code)
+		}
+	}
+
+	// The slug of an expired file is free again
+	ts.clock.Advance(ts.config.FileRetention + time.Minute)
+	if w := resolve("release-notes"); w.Code == http.StatusFound {
+		t.Errorf("resolve after expiry redirected to %q", w.Header().Get("Location"))
+	}
+	if w := upload("release-notes"); w.Code != http.StatusOK {
+		t.Errorf("reuse after expiry: got %d: %s", w.Code, w.Body.String())
+	}
+}
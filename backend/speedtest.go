@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/rand"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// speedTestDownload streams random bytes so clients can measure download bandwidth
+//
+// @summary Measure download bandwidth
+// @tags speedtest
+// @query size integer Bytes to send
+// @success 200 application/octet-stream
+func (s *FileService) speedTestDownload(c *gin.Context) {
+	size := s.config.SpeedTestMaxSize
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		requested, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || requested <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size parameter"})
+			return
+		}
+		if requested < size {
+			size = requested
+		}
+	}
+
+	// Random data prevents proxies and the browser from compressing the payload
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Header("Cache-Control", "no-store, no-cache, must-revalidate")
+	c.Header("Content-Encoding", "identity")
+	c.Status(http.StatusOK)
+
+	buffer := make([]byte, 64*1024) // 64KB buffer
+	if _, err := rand.Read(buffer); err != nil {
+		log.Printf("Failed to generate speed test data: %v", err)
+		return
+	}
+
+	remaining := size
+	for remaining > 0 {
+		toWrite := int64(len(buffer))
+		if remaining < toWrite {
+			toWrite = remaining
+		}
+		n, err := c.Writer.Write(buffer[:toWrite])
+		if err != nil {
+			return
+		}
+		remaining -= int64(n)
+	}
+}
+
+// speedTestUpload discards the request body and reports how fast it was received
+//
+// @summary Measure upload bandwidth
+// @tags speedtest
+// @body raw
+// @success 200 json
+func (s *FileService) speedTestUpload(c *gin.Context) {
+	start := time.Now()
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, s.config.SpeedTestMaxSize)
+	received, err := io.Copy(io.Discard, body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "Speed test payload too large",
+				"max_size": s.config.SpeedTestMaxSize,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Speed test upload interrupted"})
+		return
+	}
+
+	elapsed := time.Since(start)
+	var bytesPerSecond int64
+	if elapsed > 0 {
+		bytesPerSecond = int64(float64(received) / elapsed.Seconds())
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"received_bytes":   received,
+		"duration_ms":      elapsed.Milliseconds(),
+		"bytes_per_second": bytesPerSecond,
+		"max_size":         s.config.SpeedTestMaxSize,
+		"chunk_size":       s.config.ChunkSize,
+	})
+}
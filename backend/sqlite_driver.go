@@ -0,0 +1,8 @@
+//go:build sqlite
+
+package main
+
+import _ "modernc.org/sqlite" // Registers the "sqlite" database/sql driver
+
+// sqliteDriver is the database/sql driver of the embedded mode; see sqlitestore.go
+const sqliteDriver = "sqlite"
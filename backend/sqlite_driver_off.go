@@ -0,0 +1,7 @@
+//go:build !sqlite
+
+package main
+
+// Without the sqlite build tag the SQLite driver isn't linked in, and DATABASE_DRIVER=sqlite
+// is rejected at startup; see sqlitestore.go
+const sqliteDriver = ""
@@ -0,0 +1,245 @@
+-- SQLite schema for the embedded single-binary mode (DATABASE_DRIVER=sqlite)
+-- Mirrors schema.sql without the PostgreSQL-only parts: replication and the statistics
+-- views. Runs on every startup, so every statement must be idempotent.
+-- Timestamps are UTC text in the fixed-width format of sqliteTimeFormat, so they compare
+-- in order; JSON columns are text.
+
+CREATE TABLE IF NOT EXISTS files (
+    id TEXT PRIMARY KEY,
+    filename TEXT NOT NULL,
+    original_size INTEGER NOT NULL,
+    compressed_size INTEGER,
+    mime_type TEXT NOT NULL,
+    compression_type TEXT DEFAULT 'none',
+    storage_type TEXT NOT NULL DEFAULT 'postgresql', -- 'postgresql' (content kept by the store under SQLITE_BLOB_DIR) or 'disk'
+    storage_path TEXT,
+    upload_time TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TEXT NOT NULL,
+    delete_password TEXT NOT NULL,
+    download_password TEXT,
+    has_download_password BOOLEAN NOT NULL DEFAULT FALSE,
+    api_key_id TEXT,
+    append_state TEXT,
+    uploader_ip TEXT,
+    content_hash TEXT,
+    image_info TEXT,
+    storage_class TEXT NOT NULL DEFAULT 'standard',
+    scan_result TEXT,
+    org_id TEXT,
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted_at TEXT,
+    accessibility TEXT,
+    tags TEXT,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+-- Content of versions the database would hold is kept under SQLITE_BLOB_DIR like that of files
+CREATE TABLE IF NOT EXISTS file_versions (
+    file_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    original_size INTEGER NOT NULL,
+    compressed_size INTEGER,
+    compression_type TEXT NOT NULL DEFAULT 'none',
+    storage_type TEXT NOT NULL,
+    storage_path TEXT,
+    content_hash TEXT,
+    replaced_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TEXT NOT NULL,
+    PRIMARY KEY (file_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS file_slugs (
+    slug TEXT PRIMARY KEY,
+    file_id TEXT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS orgs (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    quota_bytes INTEGER NOT NULL DEFAULT 0,
+    quota_files INTEGER NOT NULL DEFAULT 0,
+    branding TEXT NOT NULL DEFAULT '{}',
+    policy TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    rate_limit INTEGER NOT NULL DEFAULT 600,
+    quota_bytes INTEGER NOT NULL DEFAULT 0,
+    quota_files INTEGER NOT NULL DEFAULT 0,
+    storage_classes TEXT NOT NULL DEFAULT '',
+    egress_quota_bytes INTEGER NOT NULL DEFAULT 0,
+    client_cert_identity TEXT UNIQUE,
+    org_id TEXT REFERENCES orgs(id) ON DELETE SET NULL,
+    org_role TEXT NOT NULL DEFAULT 'member',
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    last_used_at TEXT,
+    expires_at TEXT,
+    revoked_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS chunk_uploads (
+    upload_id TEXT PRIMARY KEY,
+    filename TEXT NOT NULL,
+    total_size INTEGER NOT NULL,
+    total_chunks INTEGER NOT NULL,
+    chunk_size INTEGER NOT NULL,
+    received_chunks TEXT NOT NULL DEFAULT '[]',
+    file_hash TEXT,
+    download_password TEXT,
+    has_download_password BOOLEAN NOT NULL DEFAULT FALSE,
+    api_key_id TEXT,
+    client_ip TEXT,
+    storage_class TEXT NOT NULL DEFAULT 'standard',
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    last_activity TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    expires_at TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active'
+);
+
+CREATE TABLE IF NOT EXISTS processing_jobs (
+    job_id TEXT PRIMARY KEY,
+    upload_id TEXT,
+    file_id TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    progress INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    result_data TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TEXT,
+    dead_letter BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    completed_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS file_access_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id TEXT REFERENCES files(id) ON DELETE CASCADE,
+    access_type TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    access_time TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS bandwidth_usage (
+    period TEXT NOT NULL, -- First day of the month
+    subject_type TEXT NOT NULL,
+    subject_id TEXT NOT NULL,
+    bytes INTEGER NOT NULL DEFAULT 0,
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (period, subject_type, subject_id)
+);
+
+CREATE TABLE IF NOT EXISTS usage_records (
+    hour TEXT NOT NULL,
+    api_key_id TEXT NOT NULL,
+    org_id TEXT,
+    metric TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 0,
+    updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    PRIMARY KEY (hour, api_key_id, metric)
+);
+
+-- AUTOINCREMENT never reuses IDs, so event cursors stay valid after pruning
+CREATE TABLE IF NOT EXISTS file_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    file_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '{}',
+    ip_address TEXT,
+    org_id TEXT,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+-- Keep updated_at current when a statement doesn't set it
+CREATE TRIGGER IF NOT EXISTS update_files_updated_at
+    AFTER UPDATE ON files FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE files SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS update_chunk_uploads_updated_at
+    AFTER UPDATE ON chunk_uploads FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE chunk_uploads SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE upload_id = NEW.upload_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS update_api_keys_updated_at
+    AFTER UPDATE ON api_keys FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE api_keys SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS update_orgs_updated_at
+    AFTER UPDATE ON orgs FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE orgs SET updated_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') WHERE id = NEW.id;
+END;
+
+-- Record uploads, expiration changes, deletions and expirations in file_events, like
+-- record_file_event in schema.sql
+CREATE TRIGGER IF NOT EXISTS files_record_upload
+    AFTER INSERT ON files FOR EACH ROW
+BEGIN
+    INSERT INTO file_events (file_id, event_type, details, ip_address, org_id)
+    VALUES (NEW.id, 'uploaded', json_object(
+        'filename', NEW.filename,
+        'size', NEW.original_size,
+        'mime_type', NEW.mime_type,
+        'storage_class', NEW.storage_class,
+        'api_key_id', NEW.api_key_id,
+        'expires_at', NEW.expires_at
+    ), NEW.uploader_ip, NEW.org_id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_record_expiry_change
+    AFTER UPDATE OF expires_at ON files FOR EACH ROW WHEN OLD.expires_at IS NOT NEW.expires_at
+BEGIN
+    INSERT INTO file_events (file_id, event_type, details, org_id)
+    VALUES (NEW.id, 'expiry_changed', json_object(
+        'old_expires_at', OLD.expires_at,
+        'new_expires_at', NEW.expires_at
+    ), NEW.org_id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_record_delete
+    AFTER DELETE ON files FOR EACH ROW
+BEGIN
+    INSERT INTO file_events (file_id, event_type, details, org_id)
+    VALUES (OLD.id,
+        CASE WHEN OLD.expires_at <= strftime('%Y-%m-%d %H:%M:%f+00:00', 'now') THEN 'expired' ELSE 'deleted' END,
+        json_object('filename', OLD.filename, 'size', OLD.original_size), OLD.org_id);
+END;
+
+CREATE INDEX IF NOT EXISTS files_expires_at_idx ON files (expires_at);
+CREATE INDEX IF NOT EXISTS files_upload_time_idx ON files (upload_time);
+CREATE INDEX IF NOT EXISTS files_api_key_id_idx ON files (api_key_id);
+CREATE INDEX IF NOT EXISTS files_uploader_ip_idx ON files (uploader_ip);
+CREATE INDEX IF NOT EXISTS files_content_hash_idx ON files (content_hash, original_size);
+CREATE INDEX IF NOT EXISTS files_org_id_idx ON files (org_id);
+CREATE INDEX IF NOT EXISTS files_deleted_at_idx ON files (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS file_versions_expires_at_idx ON file_versions (expires_at);
+CREATE INDEX IF NOT EXISTS file_slugs_file_id_idx ON file_slugs (file_id);
+
+CREATE INDEX IF NOT EXISTS chunk_uploads_expires_at_idx ON chunk_uploads (expires_at);
+CREATE INDEX IF NOT EXISTS processing_jobs_created_at_idx ON processing_jobs (created_at);
+CREATE INDEX IF NOT EXISTS processing_jobs_dead_letter_idx ON processing_jobs (updated_at) WHERE dead_letter;
+
+CREATE INDEX IF NOT EXISTS file_events_created_at_idx ON file_events (created_at);
+CREATE INDEX IF NOT EXISTS file_events_file_id_idx ON file_events (file_id);
+CREATE INDEX IF NOT EXISTS file_events_org_id_idx ON file_events (org_id, id);
+
+CREATE INDEX IF NOT EXISTS usage_records_org_id_idx ON usage_records (org_id, hour);
+
+CREATE INDEX IF NOT EXISTS file_access_logs_file_id_idx ON file_access_logs (file_id);
+CREATE INDEX IF NOT EXISTS file_access_logs_access_time_idx ON file_access_logs (access_time);
@@ -0,0 +1,1921 @@
+package main
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"file-storage-service/internal/storage"
+)
+
+// Embedded mode keeps metadata in an SQLite file instead of PostgreSQL, so the service
+// needs no database server on a VPS or NAS. It replaces PostgreSQL only: caching, rate
+// limits, upload sessions and the job queue still live in Redis, which main connects to
+// before opening either store.
+//
+// Content the service hands to the database (storage type "postgresql") is kept in files
+// under SQLITE_BLOB_DIR rather than in the SQLite file, which stays small. SQLite takes
+// one writer at a time, so the store uses a single connection. Replication needs
+// PostgreSQL and is not available in this mode.
+//
+// The driver is only linked in with `go build -tags sqlite`; see sqlite_driver.go.
+
+//go:embed sqlite_schema.sql
+var sqliteSchema string
+
+// sqliteTimeFormat stores timestamps as fixed-width UTC text, so they compare in order.
+// sqliteNow is the current time in the same format, for use in queries.
+const (
+	sqliteTimeFormat = "2006-01-02 15:04:05.000-07:00"
+	sqliteNow        = "strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')"
+)
+
+var errSQLiteReplication = errors.New("replication requires PostgreSQL")
+
+// SQLiteStore implements FileStore with SQLite and content files on local disk
+type SQLiteStore struct {
+	db      *sql.DB
+	blobDir string
+}
+
+// NewSQLiteStore opens the SQLite database at SQLITE_PATH, creating it if needed
+func NewSQLiteStore(config *Config) (*SQLiteStore, error) {
+	if sqliteDriver == "" {
+		return nil, fmt.Errorf("this binary was built without SQLite support; build it with -tags sqlite")
+	}
+	if config.ReplicaDatabaseURL != "" {
+		return nil, errSQLiteReplication
+	}
+
+	blobDir := config.SQLiteBlobDir
+	if blobDir == "" {
+		blobDir = filepath.Join(filepath.Dir(config.SQLitePath), "blobs")
+	}
+	for _, dir := range []string{filepath.Dir(config.SQLitePath), blobDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	dsn := "file:" + config.SQLitePath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+
+	log.Printf("Using embedded SQLite database %s with content in %s", config.SQLitePath, blobDir)
+	return &SQLiteStore{db: db, blobDir: blobDir}, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() {
+	s.db.Close()
+}
+
+// EnsureSchema creates the tables of a new database. The statements are idempotent, so
+// this runs on every startup.
+func (s *SQLiteStore) EnsureSchema() error {
+	if _, err := s.db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("failed to execute SQLite schema: %v", err)
+	}
+	return nil
+}
+
+// sqliteTime formats a timestamp for storage
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteNullTime formats an optional timestamp for storage
+func sqliteNullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+// timeColumn scans a timestamp stored with sqliteTime, into dst or, when the column is
+// nullable, into nullable
+type timeColumn struct {
+	dst      *time.Time
+	nullable **time.Time
+}
+
+func scanTime(dst *time.Time) timeColumn      { return timeColumn{dst: dst} }
+func scanNullTime(dst **time.Time) timeColumn { return timeColumn{nullable: dst} }
+
+func (c timeColumn) Scan(value interface{}) error {
+	var t time.Time
+	switch v := value.(type) {
+	case nil:
+		if c.nullable == nil {
+			return fmt.Errorf("unexpected NULL timestamp")
+		}
+		*c.nullable = nil
+		return nil
+	case time.Time:
+		t = v
+	case string, []byte:
+		// Fractional seconds are accepted when parsing even though the layout omits them
+		var err error
+		if t, err = time.Parse("2006-01-02 15:04:05-07:00", fmt.Sprintf("%s", v)); err != nil {
+			return fmt.Errorf("invalid timestamp %q: %v", v, err)
+		}
+	default:
+		return fmt.Errorf("unsupported timestamp type %T", value)
+	}
+	if c.nullable != nil {
+		*c.nullable = &t
+	} else {
+		*c.dst = t
+	}
+	return nil
+}
+
+// sqlRow is a *sql.Row or *sql.Rows
+type sqlRow interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqliteInList returns "column IN (...)" binding values after the args already used,
+// or "1" when there are no values to restrict to
+func sqliteInList(column string, values []string, args []interface{}) (string, []interface{}) {
+	if len(values) == 0 {
+		return "1", args
+	}
+	placeholders := make([]string, len(values))
+	for i, value := range values {
+		args = append(args, value)
+		placeholders[i] = "?" + strconv.Itoa(len(args))
+	}
+	return column + " IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// blobPath is where the content of a file stored in the database is kept
+func (s *SQLiteStore) blobPath(fileID string) (string, error) {
+	return storage.SafeJoin(s.blobDir, fileID)
+}
+
+// writeBlob stores the content of a file, renaming it into place so readers never see a
+// partial file
+func (s *SQLiteStore) writeBlob(fileID string, content []byte) error {
+	path, err := s.blobPath(fileID)
+	if err != nil {
+		return err
+	}
+	partialPath := path + ".partial"
+	if err := os.WriteFile(partialPath, content, 0644); err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to write content: %v", err)
+	}
+	if err := os.Rename(partialPath, path); err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to write content: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) readBlob(fileID string) ([]byte, error) {
+	path, err := s.blobPath(fileID)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *SQLiteStore) removeBlob(fileID string) {
+	path, err := s.blobPath(fileID)
+	if err != nil {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to delete content of %s: %v", fileID, err)
+	}
+}
+
+const sqliteFileColumns = `id, filename, original_size, compressed_size, mime_type, compression_type,
+			   storage_type, storage_path, upload_time, expires_at, delete_password,
+			   download_password, has_download_password, api_key_id, append_state, uploader_ip,
+			   content_hash, image_info, storage_class, scan_result, org_id, version, deleted_at,
+			   accessibility, tags, created_at, updated_at`
+
+// scanSQLiteFile scans a row selected with sqliteFileColumns
+func scanSQLiteFile(row sqlRow) (*FileStorage, error) {
+	var file FileStorage
+	var imageInfoJSON, scanResultJSON, accessibilityJSON, tagsJSON []byte
+	err := row.Scan(
+		&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+		&file.MimeType, &file.CompressionType, &file.StorageType, &file.StoragePath,
+		scanTime(&file.UploadTime), scanTime(&file.ExpiresAt), &file.DeletePassword,
+		&file.DownloadPassword, &file.HasDownloadPassword, &file.APIKeyID, &file.AppendState,
+		&file.UploaderIP, &file.ContentHash, &imageInfoJSON, &file.StorageClass, &scanResultJSON,
+		&file.OrgID, &file.Version, scanNullTime(&file.DeletedAt), &accessibilityJSON, &tagsJSON,
+		scanTime(&file.CreatedAt), scanTime(&file.UpdatedAt),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(imageInfoJSON) > 0 {
+		var imageInfo ImageInfo
+		if err := json.Unmarshal(imageInfoJSON, &imageInfo); err == nil {
+			file.ImageInfo = &imageInfo
+		}
+	}
+	if len(scanResultJSON) > 0 {
+		var scanResult ScanResult
+		if err := json.Unmarshal(scanResultJSON, &scanResult); err == nil {
+			file.ScanResult = &scanResult
+		}
+	}
+	if len(accessibilityJSON) > 0 {
+		var accessibility Accessibility
+		if err := json.Unmarshal(accessibilityJSON, &accessibility); err == nil {
+			file.Accessibility = &accessibility
+		}
+	}
+	if len(tagsJSON) > 0 {
+		json.Unmarshal(tagsJSON, &file.Tags)
+	}
+	return &file, nil
+}
+
+// fileJSONColumns returns the image info and scan verdict of a file as JSON, or nil
+func fileJSONColumns(file *FileStorage) (imageInfo, scanResult interface{}) {
+	if file.ImageInfo != nil {
+		data, _ := json.Marshal(file.ImageInfo)
+		imageInfo = string(data)
+	}
+	if file.ScanResult != nil {
+		data, _ := json.Marshal(file.ScanResult)
+		scanResult = string(data)
+	}
+	return imageInfo, scanResult
+}
+
+// accessibilityColumn returns the accessibility text of a file as JSON, or nil
+func accessibilityColumn(accessibility *Accessibility) interface{} {
+	if accessibility == nil {
+		return nil
+	}
+	data, _ := json.Marshal(accessibility)
+	return string(data)
+}
+
+// tagsColumn returns the tags of a file as JSON, or nil
+func tagsColumn(tags map[string]string) interface{} {
+	if len(tags) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(tags)
+	return string(data)
+}
+
+// SaveFile saves file metadata, writing content kept by the database to its blob file.
+// The blob is written once the row is in, so a clashing ID can't overwrite the content
+// of the file that has it.
+func (s *SQLiteStore) SaveFile(file *FileStorage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	storageClass := file.StorageClass
+	if storageClass == "" {
+		storageClass = string(StorageClassStandard)
+	}
+	imageInfo, scanResult := fileJSONColumns(file)
+
+	_, err = tx.Exec(`
+		INSERT INTO files (
+			id, filename, original_size, compressed_size, mime_type, compression_type,
+			storage_type, storage_path, upload_time, expires_at, delete_password,
+			download_password, has_download_password, api_key_id, append_state, uploader_ip,
+			content_hash, image_info, storage_class, scan_result, org_id, accessibility, tags
+		) VALUES (
+			?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15, ?16, ?17, ?18, ?19, ?20,
+			COALESCE(?21, (SELECT org_id FROM api_keys WHERE id = ?14)), ?22, ?23
+		)
+	`,
+		file.ID, file.Filename, file.OriginalSize, file.CompressedSize,
+		file.MimeType, file.CompressionType, file.StorageType, file.StoragePath,
+		sqliteTime(file.UploadTime), sqliteTime(file.ExpiresAt), file.DeletePassword,
+		file.DownloadPassword, file.HasDownloadPassword, file.APIKeyID, file.AppendState,
+		file.UploaderIP, file.ContentHash, imageInfo, storageClass, scanResult, file.OrgID,
+		accessibilityColumn(file.Accessibility), tagsColumn(file.Tags),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save file metadata and content: %v", err)
+	}
+	if file.StoragePath == nil {
+		if err := s.writeBlob(file.ID, file.FileContent); err != nil {
+			return fmt.Errorf("failed to save file content: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		if file.StoragePath == nil {
+			s.removeBlob(file.ID)
+		}
+		return fmt.Errorf("failed to save file metadata and content: %v", err)
+	}
+	return nil
+}
+
+// GetFile retrieves file metadata and content, or nil when the file doesn't exist or expired
+func (s *SQLiteStore) GetFile(fileID string) (*FileStorage, error) {
+	file, err := s.GetFileMetadata(fileID)
+	if err != nil || file == nil {
+		return file, err
+	}
+	if file.StoragePath == nil {
+		if file.FileContent, err = s.readBlob(fileID); err != nil {
+			return nil, fmt.Errorf("failed to get file content: %v", err)
+		}
+	}
+	return file, nil
+}
+
+// GetFileMetadata retrieves file metadata without content, or nil when the file doesn't
+// exist or expired
+func (s *SQLiteStore) GetFileMetadata(fileID string) (*FileStorage, error) {
+	return s.getFileMetadataWhere("deleted_at IS NULL", fileID)
+}
+
+// GetTrashedFile retrieves the metadata of a file in the trash, or nil when the file
+// isn't in the trash or expired
+func (s *SQLiteStore) GetTrashedFile(fileID string) (*FileStorage, error) {
+	return s.getFileMetadataWhere("deleted_at IS NOT NULL", fileID)
+}
+
+// GetTrashedFileContent retrieves the content kept for a file in the trash
+func (s *SQLiteStore) GetTrashedFileContent(fileID string) ([]byte, error) {
+	var trashed bool
+	err := s.db.QueryRow(`SELECT deleted_at IS NOT NULL FROM files WHERE id = ?1`, fileID).Scan(&trashed)
+	if err == sql.ErrNoRows || (err == nil && !trashed) {
+		return nil, fmt.Errorf("file not found in trash")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file content: %v", err)
+	}
+	content, err := s.readBlob(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file content: %v", err)
+	}
+	return content, nil
+}
+
+// FileIDExists reports whether any file has the ID, including expired files and files in
+// the trash
+func (s *SQLiteStore) FileIDExists(fileID string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM files WHERE id = ?1)`, fileID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check file ID: %v", err)
+	}
+	return exists, nil
+}
+
+// getFileMetadataWhere retrieves the metadata of an unexpired file matching the condition
+func (s *SQLiteStore) getFileMetadataWhere(condition, fileID string) (*FileStorage, error) {
+	file, err := scanSQLiteFile(s.db.QueryRow(`
+		SELECT `+sqliteFileColumns+`
+		FROM files
+		WHERE id = ?1 AND expires_at > `+sqliteNow+` AND `+condition, fileID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file metadata: %v", err)
+	}
+	return file, nil
+}
+
+// ListActiveFiles returns a page of the metadata of unexpired files matching the query,
+// along with the number of files matching it in total
+func (s *SQLiteStore) ListActiveFiles(query FileListQuery) ([]*FileStorage, int, error) {
+	column, ok := fileListSortColumns[query.SortBy]
+	if !ok {
+		column = "upload_time"
+	}
+	direction := "DESC"
+	if query.Ascending {
+		direction = "ASC"
+	}
+	var search string
+	if query.Search != "" {
+		search = likePattern(query.Search)
+	}
+	filter := `
+		WHERE expires_at > ` + sqliteNow + ` AND deleted_at IS NULL
+		  AND (?1 = '' OR filename LIKE ?1 ESCAPE '\')
+		  AND (?2 = '' OR mime_type = ?2 OR (substr(?2, -1) = '/' AND substr(mime_type, 1, length(?2)) = ?2))
+		  AND (?3 = '' OR storage_type = ?3)
+		  AND (?4 = '' OR api_key_id = ?4)
+		  AND (?5 IS NULL OR expires_at < ?5)
+	`
+	args := []interface{}{search, query.MimeType, query.StorageType, query.APIKeyID, sqliteNullTime(query.ExpiresBefore)}
+
+	// The id breaks ties so pages don't overlap when sorting by a non-unique column
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
+			   storage_type, storage_path, upload_time, expires_at, has_download_password,
+			   COUNT(*) OVER ()
+		FROM files
+		%s
+		ORDER BY %s %s, id %s
+		LIMIT ?6 OFFSET ?7
+	`, filter, column, direction, direction), append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list files: %v", err)
+	}
+	defer rows.Close()
+
+	var files []*FileStorage
+	var total int
+	for rows.Next() {
+		var file FileStorage
+		if err := rows.Scan(&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+			&file.MimeType, &file.CompressionType, &file.StorageType, &file.StoragePath,
+			scanTime(&file.UploadTime), scanTime(&file.ExpiresAt), &file.HasDownloadPassword, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan file: %v", err)
+		}
+		files = append(files, &file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// A page past the end has no rows to carry the total
+	if len(files) == 0 && query.Offset > 0 {
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM files`+filter, args...).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("failed to count files: %v", err)
+		}
+	}
+	return files, total, nil
+}
+
+// FindFileByContentHash returns metadata of an active file kept by the database with the
+// given content hash and size uploaded by the same uploader; see Database.FindFileByContentHash
+func (s *SQLiteStore) FindFileByContentHash(contentHash string, size int64, apiKeyID *string, uploaderIP string) (*FileStorage, error) {
+	var file FileStorage
+	err := s.db.QueryRow(`
+		SELECT id, filename, original_size, compressed_size, mime_type, compression_type
+		FROM files
+		WHERE content_hash = ?1 AND original_size = ?2 AND expires_at > `+sqliteNow+` AND deleted_at IS NULL
+		  AND storage_type = 'postgresql' AND has_download_password = FALSE
+		  AND append_state IS NULL
+		  AND (api_key_id = ?3 OR (?3 IS NULL AND api_key_id IS NULL AND uploader_ip = ?4))
+		ORDER BY expires_at DESC
+		LIMIT 1
+	`, contentHash, size, apiKeyID, uploaderIP).Scan(
+		&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+		&file.MimeType, &file.CompressionType,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find file by content hash: %v", err)
+	}
+	return &file, nil
+}
+
+// CloneFile saves a new file record whose content is copied from an existing file
+func (s *SQLiteStore) CloneFile(sourceID string, file *FileStorage) error {
+	content, err := s.readBlob(sourceID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("source file not found")
+		}
+		return fmt.Errorf("failed to clone file: %v", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO files (
+			id, filename, original_size, compressed_size, mime_type, compression_type,
+			storage_type, upload_time, expires_at, delete_password,
+			download_password, has_download_password, api_key_id, uploader_ip, content_hash,
+			image_info, storage_class, scan_result, org_id, accessibility
+		)
+		SELECT ?2, ?3, original_size, compressed_size, ?4, compression_type,
+			   storage_type, ?5, ?6, ?7,
+			   ?8, ?9, ?10, ?11, content_hash,
+			   image_info, storage_class, scan_result,
+			   COALESCE(?12, (SELECT org_id FROM api_keys WHERE id = ?10)), ?13
+		FROM files
+		WHERE id = ?1 AND storage_path IS NULL AND expires_at > `+sqliteNow+` AND deleted_at IS NULL`,
+		sourceID, file.ID, file.Filename, file.MimeType, sqliteTime(file.UploadTime), sqliteTime(file.ExpiresAt),
+		file.DeletePassword, file.DownloadPassword, file.HasDownloadPassword,
+		file.APIKeyID, file.UploaderIP, file.OrgID, accessibilityColumn(file.Accessibility),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clone file: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("source file not found")
+	}
+	if err := s.writeBlob(file.ID, content); err != nil {
+		return fmt.Errorf("failed to clone file: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		s.removeBlob(file.ID)
+		return fmt.Errorf("failed to clone file: %v", err)
+	}
+	return nil
+}
+
+// DeleteFile removes a file and the content the database kept for it
+func (s *SQLiteStore) DeleteFile(fileID string) error {
+	var storagePath *string
+	err := s.db.QueryRow(`DELETE FROM files WHERE id = ?1 RETURNING storage_path`, fileID).Scan(&storagePath)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("file not found")
+		}
+		return fmt.Errorf("failed to delete file metadata: %v", err)
+	}
+	if storagePath == nil {
+		s.removeBlob(fileID)
+	}
+	return nil
+}
+
+// TrashFile moves a file to the trash; see Database.TrashFile
+func (s *SQLiteStore) TrashFile(fileID string, deletedAt time.Time) error {
+	return s.execFileUpdate("move file to trash", "file not found", `
+		UPDATE files SET deleted_at = ?2
+		WHERE id = ?1 AND expires_at > `+sqliteNow+` AND deleted_at IS NULL`, fileID, sqliteTime(deletedAt))
+}
+
+// RestoreFile takes a file out of the trash
+func (s *SQLiteStore) RestoreFile(fileID string) error {
+	return s.execFileUpdate("restore file", "file not found in trash", `
+		UPDATE files SET deleted_at = NULL
+		WHERE id = ?1 AND expires_at > `+sqliteNow+` AND deleted_at IS NOT NULL`, fileID)
+}
+
+// PurgeTrashedFiles deletes the files moved to the trash before the given time with the
+// content the database kept for them, and returns the storage paths of the disk-stored ones
+func (s *SQLiteStore) PurgeTrashedFiles(before time.Time) ([]string, error) {
+	rows, err := s.db.Query(`DELETE FROM files WHERE deleted_at < ?1 RETURNING id, storage_path`, sqliteTime(before))
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge trashed files: %v", err)
+	}
+	var paths, blobs []string
+	for rows.Next() {
+		var id string
+		var path *string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan storage path: %v", err)
+		}
+		if path != nil {
+			paths = append(paths, *path)
+		} else {
+			blobs = append(blobs, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		s.removeBlob(blob)
+	}
+	return paths, nil
+}
+
+// ClaimSlug points a vanity slug at a file; see Database.ClaimSlug
+func (s *SQLiteStore) ClaimSlug(slug, fileID string) (bool, error) {
+	result, err := s.db.Exec(`
+		INSERT INTO file_slugs (slug, file_id) VALUES (?1, ?2)
+		ON CONFLICT (slug) DO UPDATE SET file_id = excluded.file_id, created_at = `+sqliteNow+`
+		WHERE NOT EXISTS (
+			SELECT 1 FROM files f WHERE f.id = file_slugs.file_id AND f.expires_at > `+sqliteNow+`
+		)`, slug, fileID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim slug: %v", err)
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// GetFileIDBySlug returns the ID of the file a vanity slug points at, or ""
+func (s *SQLiteStore) GetFileIDBySlug(slug string) (string, error) {
+	var fileID string
+	err := s.db.QueryRow(`
+		SELECT f.id
+		FROM file_slugs s
+		JOIN files f ON f.id = s.file_id
+		WHERE s.slug = ?1 AND f.expires_at > `+sqliteNow+` AND f.deleted_at IS NULL`, slug).Scan(&fileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to look up slug: %v", err)
+	}
+	return fileID, nil
+}
+
+// execFileUpdate runs an UPDATE of one file, reporting a missing file as notFound
+func (s *SQLiteStore) execFileUpdate(action, notFound, query string, args ...interface{}) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %v", action, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New(notFound)
+	}
+	return nil
+}
+
+// UpdateFileExpiration updates the expiration time for a file
+func (s *SQLiteStore) UpdateFileExpiration(fileID string, expiresAt time.Time) error {
+	return s.execFileUpdate("update file expiration", "file not found",
+		`UPDATE files SET expires_at = ?2, updated_at = `+sqliteNow+` WHERE id = ?1`, fileID, sqliteTime(expiresAt))
+}
+
+// UpdateFileDownloadPassword sets the download password for a file, or removes it when empty
+func (s *SQLiteStore) UpdateFileDownloadPassword(fileID string, newPassword string) error {
+	if newPassword == "" {
+		return s.execFileUpdate("update download password", "file not found", `
+			UPDATE files SET download_password = NULL, has_download_password = FALSE, updated_at = `+sqliteNow+`
+			WHERE id = ?1`, fileID)
+	}
+	return s.execFileUpdate("update download password", "file not found", `
+		UPDATE files SET download_password = ?2, has_download_password = TRUE, updated_at = `+sqliteNow+`
+		WHERE id = ?1`, fileID, newPassword)
+}
+
+// UpdateFileDeletePassword updates the delete password for a file
+func (s *SQLiteStore) UpdateFileDeletePassword(fileID string, newPassword string) error {
+	return s.execFileUpdate("update delete password", "file not found",
+		`UPDATE files SET delete_password = ?2, updated_at = `+sqliteNow+` WHERE id = ?1`, fileID, newPassword)
+}
+
+// UpdateFileScanResult replaces the virus scan verdict of a file
+func (s *SQLiteStore) UpdateFileScanResult(fileID string, result *ScanResult) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan result: %v", err)
+	}
+	return s.execFileUpdate("update scan result", "file not found",
+		`UPDATE files SET scan_result = ?2, updated_at = `+sqliteNow+` WHERE id = ?1`, fileID, string(resultJSON))
+}
+
+// UpdateFileName changes the name a file is served under
+func (s *SQLiteStore) UpdateFileName(fileID, filename string) error {
+	return s.execFileUpdate("rename file", "file not found",
+		`UPDATE files SET filename = ?2, updated_at = `+sqliteNow+` WHERE id = ?1`, fileID, filename)
+}
+
+// UpdateFileAccessibility replaces the alt text, caption and description of a file, or
+// clears them when accessibility is nil
+func (s *SQLiteStore) UpdateFileAccessibility(fileID string, accessibility *Accessibility) error {
+	return s.execFileUpdate("update accessibility", "file not found",
+		`UPDATE files SET accessibility = ?2, updated_at = `+sqliteNow+` WHERE id = ?1`, fileID, accessibilityColumn(accessibility))
+}
+
+// ReplaceFileContent swaps the stored content of a file, and what describes it, for new
+// content
+func (s *SQLiteStore) ReplaceFileContent(file *FileStorage) error {
+	if file.StoragePath == nil {
+		if err := s.writeBlob(file.ID, file.FileContent); err != nil {
+			return fmt.Errorf("failed to replace file content: %v", err)
+		}
+	}
+	imageInfo, scanResult := fileJSONColumns(file)
+	err := s.execFileUpdate("replace file content", "file not found", `
+		UPDATE files SET
+			original_size = ?2, compressed_size = ?3, compression_type = ?4, storage_type = ?5,
+			storage_path = ?6, content_hash = ?7, image_info = ?8, scan_result = ?9,
+			version = ?10, updated_at = `+sqliteNow+`
+		WHERE id = ?1`,
+		file.ID, file.OriginalSize, file.CompressedSize, file.CompressionType, file.StorageType,
+		file.StoragePath, file.ContentHash, imageInfo, scanResult, file.Version,
+	)
+	if err == nil && file.StoragePath != nil {
+		// The content moved to disk
+		s.removeBlob(file.ID)
+	}
+	return err
+}
+
+// versionBlobID names the blob of a version kept by the database
+func versionBlobID(fileID string, version int) string {
+	return fileID + ".v" + strconv.Itoa(version)
+}
+
+// SaveFileVersion keeps the previous content of a file
+func (s *SQLiteStore) SaveFileVersion(version *FileVersion) error {
+	if version.StoragePath == nil {
+		if err := s.writeBlob(versionBlobID(version.FileID, version.Version), version.FileContent); err != nil {
+			return fmt.Errorf("failed to save file version: %v", err)
+		}
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO file_versions (
+			file_id, version, original_size, compressed_size, compression_type, storage_type,
+			storage_path, content_hash, replaced_at, expires_at
+		) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10)
+	`,
+		version.FileID, version.Version, version.OriginalSize, version.CompressedSize,
+		version.CompressionType, version.StorageType, version.StoragePath,
+		version.ContentHash, sqliteTime(version.ReplacedAt), sqliteTime(version.ExpiresAt),
+	)
+	if err != nil {
+		if version.StoragePath == nil {
+			s.removeBlob(versionBlobID(version.FileID, version.Version))
+		}
+		return fmt.Errorf("failed to save file version: %v", err)
+	}
+	return nil
+}
+
+const sqliteFileVersionColumns = `file_id, version, original_size, compressed_size, compression_type, storage_type,
+			   storage_path, content_hash, replaced_at, expires_at`
+
+func scanSQLiteFileVersion(row sqlRow) (*FileVersion, error) {
+	var v FileVersion
+	if err := row.Scan(&v.FileID, &v.Version, &v.OriginalSize, &v.CompressedSize, &v.CompressionType,
+		&v.StorageType, &v.StoragePath, &v.ContentHash, scanTime(&v.ReplacedAt), scanTime(&v.ExpiresAt)); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListFileVersions retrieves the kept previous versions of a file without content,
+// newest first
+func (s *SQLiteStore) ListFileVersions(fileID string) ([]*FileVersion, error) {
+	rows, err := s.db.Query(`
+		SELECT `+sqliteFileVersionColumns+`
+		FROM file_versions
+		WHERE file_id = ?1 AND expires_at > `+sqliteNow+`
+		ORDER BY version DESC
+	`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file versions: %v", err)
+	}
+	defer rows.Close()
+
+	versions := make([]*FileVersion, 0)
+	for rows.Next() {
+		v, err := scanSQLiteFileVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file version: %v", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetFileVersion retrieves a previous version of a file with its content, or nil when it
+// isn't kept
+func (s *SQLiteStore) GetFileVersion(fileID string, version int) (*FileVersion, error) {
+	v, err := scanSQLiteFileVersion(s.db.QueryRow(`
+		SELECT `+sqliteFileVersionColumns+`
+		FROM file_versions
+		WHERE file_id = ?1 AND version = ?2 AND expires_at > `+sqliteNow, fileID, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get file version: %v", err)
+	}
+	if v.StoragePath == nil {
+		if v.FileContent, err = s.readBlob(versionBlobID(fileID, version)); err != nil {
+			return nil, fmt.Errorf("failed to get file version content: %v", err)
+		}
+	}
+	return v, nil
+}
+
+// DeleteExpiredFileVersions deletes the versions past their retention and those of files
+// that expired or no longer exist with their blobs, and returns the storage paths of the disk-stored
+// ones
+func (s *SQLiteStore) DeleteExpiredFileVersions() ([]string, error) {
+	rows, err := s.db.Query(`
+		DELETE FROM file_versions
+		WHERE expires_at < ` + sqliteNow + `
+		   OR NOT EXISTS (SELECT 1 FROM files f WHERE f.id = file_versions.file_id AND f.expires_at > ` + sqliteNow + `)
+		RETURNING file_id, version, storage_path
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired file versions: %v", err)
+	}
+	var paths, blobs []string
+	for rows.Next() {
+		var fileID string
+		var version int
+		var path *string
+		if err := rows.Scan(&fileID, &version, &path); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan storage path: %v", err)
+		}
+		if path != nil {
+			paths = append(paths, *path)
+		} else {
+			blobs = append(blobs, versionBlobID(fileID, version))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		s.removeBlob(blob)
+	}
+	return paths, nil
+}
+
+// UpdateFileMimeType corrects the MIME type of a file
+func (s *SQLiteStore) UpdateFileMimeType(fileID, mimeType string) error {
+	return s.execFileUpdate("update MIME type", "file not found",
+		`UPDATE files SET mime_type = ?2, updated_at = `+sqliteNow+` WHERE id = ?1`, fileID, mimeType)
+}
+
+// GetMimeTypeStats counts the active files per MIME type, most common first
+func (s *SQLiteStore) GetMimeTypeStats() ([]MimeTypeStats, error) {
+	rows, err := s.db.Query(`
+		SELECT mime_type, COUNT(*), COALESCE(SUM(original_size), 0)
+		FROM files
+		WHERE expires_at > ` + sqliteNow + ` AND deleted_at IS NULL
+		GROUP BY mime_type
+		ORDER BY COUNT(*) DESC, mime_type
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count MIME types: %v", err)
+	}
+	defer rows.Close()
+
+	stats := make([]MimeTypeStats, 0)
+	for rows.Next() {
+		var entry MimeTypeStats
+		if err := rows.Scan(&entry.MimeType, &entry.Files, &entry.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan MIME type stats: %v", err)
+		}
+		stats = append(stats, entry)
+	}
+	return stats, rows.Err()
+}
+
+// UpdateAppendedFile records the new size of an append-mode file and extends its expiration
+func (s *SQLiteStore) UpdateAppendedFile(fileID string, newSize int64, expiresAt time.Time) error {
+	return s.execFileUpdate("update appended file", "file not found or not open for appending", `
+		UPDATE files SET original_size = ?2, compressed_size = ?2, expires_at = ?3
+		WHERE id = ?1 AND append_state = 'open'`, fileID, newSize, sqliteTime(expiresAt))
+}
+
+// FinalizeAppendedFile closes an append-mode file so normal expiry applies
+func (s *SQLiteStore) FinalizeAppendedFile(fileID string, expiresAt time.Time) error {
+	return s.execFileUpdate("finalize appended file", "file not found or not open for appending", `
+		UPDATE files SET append_state = 'finalized', expires_at = ?2
+		WHERE id = ?1 AND append_state = 'open'`, fileID, sqliteTime(expiresAt))
+}
+
+// DeleteExpiredDiskFiles deletes the records of expired disk-stored files and returns their
+// storage paths, so the caller can remove the files from disk
+func (s *SQLiteStore) DeleteExpiredDiskFiles() ([]string, error) {
+	rows, err := s.db.Query(`
+		DELETE FROM files
+		WHERE expires_at < ` + sqliteNow + ` AND storage_path IS NOT NULL
+		RETURNING storage_path
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired disk files: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan storage path: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+// CleanupExpiredData removes expired files with their content, expired upload sessions
+// and old jobs and access logs, like cleanup_expired_data in schema.sql
+func (s *SQLiteStore) CleanupExpiredData() error {
+	rows, err := s.db.Query(`DELETE FROM files WHERE expires_at < ` + sqliteNow + ` RETURNING id, storage_path IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup expired data: %v", err)
+	}
+	var blobs []string
+	deletedCount := 0
+	for rows.Next() {
+		var id string
+		var inDatabase bool
+		if err := rows.Scan(&id, &inDatabase); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to cleanup expired data: %v", err)
+		}
+		deletedCount++
+		if inDatabase {
+			blobs = append(blobs, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to cleanup expired data: %v", err)
+	}
+	for _, id := range blobs {
+		s.removeBlob(id)
+	}
+
+	now := time.Now()
+	for _, cleanup := range []struct {
+		query  string
+		cutoff time.Time
+	}{
+		{`DELETE FROM chunk_uploads WHERE expires_at < ?1`, now},
+		{`DELETE FROM processing_jobs WHERE created_at < ?1`, now.AddDate(0, 0, -7)},
+		{`DELETE FROM file_access_logs WHERE access_time < ?1`, now.AddDate(0, 0, -30)},
+	} {
+		if _, err := s.db.Exec(cleanup.query, sqliteTime(cleanup.cutoff)); err != nil {
+			return fmt.Errorf("failed to cleanup expired data: %v", err)
+		}
+	}
+
+	if deletedCount > 0 {
+		log.Printf("Cleaned up %d expired files from database", deletedCount)
+	}
+	return nil
+}
+
+// SaveChunkUpload saves a chunk upload session
+func (s *SQLiteStore) SaveChunkUpload(upload *ChunkUploadStorage) error {
+	receivedChunksJSON, err := json.Marshal(upload.ReceivedChunks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal received chunks: %v", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO chunk_uploads (
+			upload_id, filename, total_size, total_chunks, chunk_size,
+			received_chunks, file_hash, download_password, has_download_password,
+			api_key_id, client_ip, storage_class, last_activity, expires_at, status
+		) VALUES (
+			?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13, ?14, ?15
+		)
+		ON CONFLICT (upload_id) DO UPDATE SET
+			received_chunks = excluded.received_chunks,
+			last_activity = excluded.last_activity,
+			expires_at = excluded.expires_at,
+			status = excluded.status
+	`,
+		upload.UploadID, upload.Filename, upload.TotalSize, upload.TotalChunks,
+		upload.ChunkSize, string(receivedChunksJSON), upload.FileHash,
+		upload.DownloadPassword, upload.HasDownloadPassword,
+		upload.APIKeyID, upload.ClientIP, upload.StorageClass,
+		sqliteTime(upload.LastActivity), sqliteTime(upload.ExpiresAt), upload.Status,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save chunk upload: %v", err)
+	}
+	return nil
+}
+
+// scanSQLiteChunkUpload scans a row selected with chunkUploadColumns
+func scanSQLiteChunkUpload(row sqlRow) (*ChunkUploadStorage, error) {
+	var upload ChunkUploadStorage
+	var receivedChunksJSON []byte
+	err := row.Scan(
+		&upload.UploadID, &upload.Filename, &upload.TotalSize, &upload.TotalChunks,
+		&upload.ChunkSize, &receivedChunksJSON, &upload.FileHash,
+		&upload.DownloadPassword, &upload.HasDownloadPassword,
+		&upload.APIKeyID, &upload.ClientIP, &upload.StorageClass,
+		scanTime(&upload.CreatedAt), scanTime(&upload.LastActivity), scanTime(&upload.ExpiresAt), &upload.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(receivedChunksJSON, &upload.ReceivedChunks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal received chunks: %v", err)
+	}
+	return &upload, nil
+}
+
+// GetChunkUpload retrieves a chunk upload session, or nil when it doesn't exist or expired
+func (s *SQLiteStore) GetChunkUpload(uploadID string) (*ChunkUploadStorage, error) {
+	upload, err := scanSQLiteChunkUpload(s.db.QueryRow(`
+		SELECT `+chunkUploadColumns+`
+		FROM chunk_uploads
+		WHERE upload_id = ?1 AND expires_at > `+sqliteNow, uploadID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get chunk upload: %v", err)
+	}
+	return upload, nil
+}
+
+// ListActiveChunkUploads returns all unexpired chunk upload sessions that are still accepting chunks
+func (s *SQLiteStore) ListActiveChunkUploads() ([]*ChunkUploadStorage, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + chunkUploadColumns + `
+		FROM chunk_uploads
+		WHERE status = 'active' AND expires_at > ` + sqliteNow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunk uploads: %v", err)
+	}
+	defer rows.Close()
+
+	var uploads []*ChunkUploadStorage
+	for rows.Next() {
+		upload, err := scanSQLiteChunkUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chunk upload: %v", err)
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// DeleteChunkUpload removes a chunk upload session
+func (s *SQLiteStore) DeleteChunkUpload(uploadID string) error {
+	if _, err := s.db.Exec(`DELETE FROM chunk_uploads WHERE upload_id = ?1`, uploadID); err != nil {
+		return fmt.Errorf("failed to delete chunk upload: %v", err)
+	}
+	return nil
+}
+
+// SaveProcessingJob saves a processing job
+func (s *SQLiteStore) SaveProcessingJob(job *ProcessingJobStorage) error {
+	var resultData interface{}
+	if job.ResultData != nil {
+		resultData = string(job.ResultData)
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO processing_jobs (
+			job_id, upload_id, file_id, status, progress, error_message,
+			result_data, attempts, next_attempt_at, dead_letter, completed_at
+		) VALUES (
+			?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11
+		)
+		ON CONFLICT (job_id) DO UPDATE SET
+			file_id = excluded.file_id,
+			status = excluded.status,
+			progress = excluded.progress,
+			error_message = excluded.error_message,
+			result_data = excluded.result_data,
+			attempts = excluded.attempts,
+			next_attempt_at = excluded.next_attempt_at,
+			dead_letter = excluded.dead_letter,
+			completed_at = excluded.completed_at,
+			updated_at = `+sqliteNow,
+		job.JobID, job.UploadID, job.FileID, job.Status, job.Progress,
+		job.ErrorMessage, resultData, job.Attempts, sqliteNullTime(job.NextAttemptAt), job.DeadLetter,
+		sqliteNullTime(job.CompletedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save processing job: %v", err)
+	}
+	return nil
+}
+
+func scanSQLiteProcessingJob(row sqlRow) (*ProcessingJobStorage, error) {
+	var job ProcessingJobStorage
+	err := row.Scan(
+		&job.JobID, &job.UploadID, &job.FileID, &job.Status, &job.Progress,
+		&job.ErrorMessage, &job.ResultData, &job.Attempts, scanNullTime(&job.NextAttemptAt), &job.DeadLetter,
+		scanTime(&job.CreatedAt), scanTime(&job.UpdatedAt), scanNullTime(&job.CompletedAt),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetProcessingJob retrieves a processing job, or nil when it doesn't exist
+func (s *SQLiteStore) GetProcessingJob(jobID string) (*ProcessingJobStorage, error) {
+	job, err := scanSQLiteProcessingJob(s.db.QueryRow(`
+		SELECT `+processingJobColumns+` FROM processing_jobs WHERE job_id = ?1`, jobID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get processing job: %v", err)
+	}
+	return job, nil
+}
+
+// ListDeadLetterJobs returns the processing jobs that failed after exhausting their
+// retries, most recent first
+func (s *SQLiteStore) ListDeadLetterJobs(limit int) ([]*ProcessingJobStorage, error) {
+	rows, err := s.db.Query(`SELECT `+processingJobColumns+`
+		FROM processing_jobs
+		WHERE dead_letter
+		ORDER BY updated_at DESC
+		LIMIT ?1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead-letter jobs: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]*ProcessingJobStorage, 0)
+	for rows.Next() {
+		job, err := scanSQLiteProcessingJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan processing job: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func scanSQLiteAPIKey(row sqlRow) (*APIKeyStorage, error) {
+	var key APIKeyStorage
+	err := row.Scan(
+		&key.ID, &key.Name, &key.KeyPrefix, &key.KeyHash, &key.RateLimit,
+		&key.QuotaBytes, &key.QuotaFiles, &key.StorageClasses, &key.EgressQuotaBytes,
+		&key.ClientCertIdentity, &key.OrgID, &key.OrgRole, scanTime(&key.CreatedAt), scanTime(&key.UpdatedAt),
+		scanNullTime(&key.LastUsedAt), scanNullTime(&key.ExpiresAt), scanNullTime(&key.RevokedAt),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// getAPIKeyWhere retrieves the API key matching a condition, or nil when none does
+func (s *SQLiteStore) getAPIKeyWhere(condition string, args ...interface{}) (*APIKeyStorage, error) {
+	key, err := scanSQLiteAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE `+condition, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API key: %v", err)
+	}
+	return key, nil
+}
+
+// CreateAPIKey saves a new API key
+func (s *SQLiteStore) CreateAPIKey(key *APIKeyStorage) error {
+	_, err := s.db.Exec(`
+		INSERT INTO api_keys (
+			id, name, key_prefix, key_hash, rate_limit, quota_bytes, quota_files, storage_classes,
+			egress_quota_bytes, expires_at, client_cert_identity, org_id, org_role
+		) VALUES (
+			?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13
+		)
+	`,
+		key.ID, key.Name, key.KeyPrefix, key.KeyHash, key.RateLimit,
+		key.QuotaBytes, key.QuotaFiles, key.StorageClasses, key.EgressQuotaBytes, sqliteNullTime(key.ExpiresAt),
+		key.ClientCertIdentity, key.OrgID, key.OrgRole,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %v", err)
+	}
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (s *SQLiteStore) GetAPIKey(keyID string) (*APIKeyStorage, error) {
+	return s.getAPIKeyWhere(`id = ?1`, keyID)
+}
+
+// GetAPIKeyByHash retrieves an API key by the SHA-256 hash of its secret
+func (s *SQLiteStore) GetAPIKeyByHash(keyHash string) (*APIKeyStorage, error) {
+	return s.getAPIKeyWhere(`key_hash = ?1`, keyHash)
+}
+
+// GetAPIKeyByCertIdentity retrieves the API key mapped to any of a client certificate's
+// identities
+func (s *SQLiteStore) GetAPIKeyByCertIdentity(identities []string) (*APIKeyStorage, error) {
+	if len(identities) == 0 {
+		return nil, nil
+	}
+	condition, args := sqliteInList("client_cert_identity", identities, nil)
+	return s.getAPIKeyWhere(condition+` ORDER BY created_at LIMIT 1`, args...)
+}
+
+// ListAPIKeys retrieves all API keys, newest first
+func (s *SQLiteStore) ListAPIKeys() ([]*APIKeyStorage, error) {
+	rows, err := s.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := make([]*APIKeyStorage, 0)
+	for rows.Next() {
+		key, err := scanSQLiteAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// UpdateAPIKey updates the mutable settings of an API key
+func (s *SQLiteStore) UpdateAPIKey(key *APIKeyStorage) error {
+	return s.execFileUpdate("update API key", "API key not found", `
+		UPDATE api_keys
+		SET name = ?2, rate_limit = ?3, quota_bytes = ?4, quota_files = ?5, storage_classes = ?6,
+			egress_quota_bytes = ?7, expires_at = ?8, client_cert_identity = ?9, org_id = ?10,
+			org_role = ?11
+		WHERE id = ?1
+	`,
+		key.ID, key.Name, key.RateLimit, key.QuotaBytes, key.QuotaFiles, key.StorageClasses,
+		key.EgressQuotaBytes, sqliteNullTime(key.ExpiresAt), key.ClientCertIdentity, key.OrgID, key.OrgRole,
+	)
+}
+
+// TouchAPIKey records the last time an API key was used
+func (s *SQLiteStore) TouchAPIKey(keyID string) error {
+	if _, err := s.db.Exec(`UPDATE api_keys SET last_used_at = `+sqliteNow+` WHERE id = ?1`, keyID); err != nil {
+		return fmt.Errorf("failed to update API key usage: %v", err)
+	}
+	return nil
+}
+
+// RevokeAPIKey marks an API key as revoked
+func (s *SQLiteStore) RevokeAPIKey(keyID string) error {
+	return s.execFileUpdate("revoke API key", "API key not found",
+		`UPDATE api_keys SET revoked_at = `+sqliteNow+` WHERE id = ?1 AND revoked_at IS NULL`, keyID)
+}
+
+// countFilesWhere returns the number and original bytes of the active files matching a condition
+func (s *SQLiteStore) countFilesWhere(condition string, args ...interface{}) (int, int64, error) {
+	var fileCount int
+	var totalBytes int64
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(original_size), 0)
+		FROM files
+		WHERE `+condition+` AND expires_at > `+sqliteNow, args...).Scan(&fileCount, &totalBytes)
+	return fileCount, totalBytes, err
+}
+
+// GetAPIKeyUsage returns the number of active files and stored bytes for an API key
+func (s *SQLiteStore) GetAPIKeyUsage(keyID string) (int, int64, error) {
+	files, bytes, err := s.countFilesWhere(`api_key_id = ?1`, keyID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get API key usage: %v", err)
+	}
+	return files, bytes, nil
+}
+
+// GetUploaderIPUsage returns the number of active files and stored bytes uploaded anonymously from an IP
+func (s *SQLiteStore) GetUploaderIPUsage(ipAddress string) (int, int64, error) {
+	files, bytes, err := s.countFilesWhere(`uploader_ip = ?1 AND api_key_id IS NULL`, ipAddress)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get uploader usage: %v", err)
+	}
+	return files, bytes, nil
+}
+
+// GetOrgUsage returns the number of active files and stored bytes owned by an organization
+func (s *SQLiteStore) GetOrgUsage(orgID string) (int, int64, error) {
+	files, bytes, err := s.countFilesWhere(`org_id = ?1`, orgID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get org usage: %v", err)
+	}
+	return files, bytes, nil
+}
+
+func scanSQLiteOrg(row sqlRow) (*Org, error) {
+	var org Org
+	var branding, policy []byte
+	if err := row.Scan(&org.ID, &org.Name, &org.QuotaBytes, &org.QuotaFiles, &branding, &policy,
+		scanTime(&org.CreatedAt), scanTime(&org.UpdatedAt)); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(branding, &org.Branding); err != nil {
+		return nil, fmt.Errorf("invalid branding of org %s: %v", org.ID, err)
+	}
+	if err := json.Unmarshal(policy, &org.Policy); err != nil {
+		return nil, fmt.Errorf("invalid policy of org %s: %v", org.ID, err)
+	}
+	return &org, nil
+}
+
+// orgJSONColumns returns the branding and policy of an organization as JSON
+func orgJSONColumns(org *Org) (string, string, error) {
+	branding, err := json.Marshal(org.Branding)
+	if err != nil {
+		return "", "", err
+	}
+	policy, err := json.Marshal(org.Policy)
+	if err != nil {
+		return "", "", err
+	}
+	return string(branding), string(policy), nil
+}
+
+// CreateOrg saves a new organization
+func (s *SQLiteStore) CreateOrg(org *Org) error {
+	branding, policy, err := orgJSONColumns(org)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO orgs (id, name, quota_bytes, quota_files, branding, policy) VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+	`, org.ID, org.Name, org.QuotaBytes, org.QuotaFiles, branding, policy)
+	if err != nil {
+		return fmt.Errorf("failed to create org: %v", err)
+	}
+	return nil
+}
+
+// GetOrg retrieves an organization by ID, or nil when it doesn't exist
+func (s *SQLiteStore) GetOrg(orgID string) (*Org, error) {
+	org, err := scanSQLiteOrg(s.db.QueryRow(`SELECT `+orgColumns+` FROM orgs WHERE id = ?1`, orgID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get org: %v", err)
+	}
+	return org, nil
+}
+
+// ListOrgs retrieves all organizations by name
+func (s *SQLiteStore) ListOrgs() ([]*Org, error) {
+	rows, err := s.db.Query(`SELECT ` + orgColumns + ` FROM orgs ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orgs: %v", err)
+	}
+	defer rows.Close()
+
+	orgs := make([]*Org, 0)
+	for rows.Next() {
+		org, err := scanSQLiteOrg(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan org: %v", err)
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// UpdateOrg updates the name, quotas, branding and policy of an organization
+func (s *SQLiteStore) UpdateOrg(org *Org) error {
+	branding, policy, err := orgJSONColumns(org)
+	if err != nil {
+		return err
+	}
+	return s.execFileUpdate("update org", "org not found", `
+		UPDATE orgs SET name = ?2, quota_bytes = ?3, quota_files = ?4, branding = ?5, policy = ?6 WHERE id = ?1
+	`, org.ID, org.Name, org.QuotaBytes, org.QuotaFiles, branding, policy)
+}
+
+// DeleteOrg removes an organization. Its keys leave it and its files go back to being
+// owned by the keys that uploaded them.
+func (s *SQLiteStore) DeleteOrg(orgID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE files SET org_id = NULL WHERE org_id = ?1`, orgID); err != nil {
+		return fmt.Errorf("failed to release org files: %v", err)
+	}
+	// api_keys.org_id is cleared by its foreign key
+	result, err := tx.Exec(`DELETE FROM orgs WHERE id = ?1`, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete org: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("org not found")
+	}
+	return tx.Commit()
+}
+
+// ListOrgFiles retrieves the active files of an organization, newest first
+func (s *SQLiteStore) ListOrgFiles(orgID string, limit int) ([]*FileStorage, error) {
+	rows, err := s.db.Query(`
+		SELECT id, filename, original_size, compressed_size, mime_type, compression_type,
+			   upload_time, expires_at, has_download_password, api_key_id, storage_class, org_id
+		FROM files
+		WHERE org_id = ?1 AND expires_at > `+sqliteNow+` AND deleted_at IS NULL
+		ORDER BY upload_time DESC
+		LIMIT ?2
+	`, orgID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list org files: %v", err)
+	}
+	defer rows.Close()
+
+	files := make([]*FileStorage, 0)
+	for rows.Next() {
+		var file FileStorage
+		if err := rows.Scan(&file.ID, &file.Filename, &file.OriginalSize, &file.CompressedSize,
+			&file.MimeType, &file.CompressionType, scanTime(&file.UploadTime), scanTime(&file.ExpiresAt),
+			&file.HasDownloadPassword, &file.APIKeyID, &file.StorageClass, &file.OrgID); err != nil {
+			return nil, fmt.Errorf("failed to scan org file: %v", err)
+		}
+		files = append(files, &file)
+	}
+	return files, rows.Err()
+}
+
+// LogFileAccess logs file access for analytics
+func (s *SQLiteStore) LogFileAccess(fileID, accessType, ipAddress, userAgent string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO file_access_logs (file_id, access_type, ip_address, user_agent)
+		VALUES (?1, ?2, ?3, ?4)
+	`, fileID, accessType, ipAddress, userAgent)
+	if err != nil {
+		// Don't fail the request if logging fails, just log the error
+		log.Printf("Failed to log file access: %v", err)
+	}
+	return nil
+}
+
+// GetFileAccessCounts totals the logged accesses of a file
+func (s *SQLiteStore) GetFileAccessCounts(fileID string) (*FileAccessCounts, error) {
+	var counts FileAccessCounts
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE access_type = 'download'),
+		       COUNT(*) FILTER (WHERE access_type = 'preview'),
+		       COUNT(*) FILTER (WHERE access_type = 'stream'),
+		       COUNT(DISTINCT ip_address),
+		       MAX(access_time)
+		FROM file_access_logs
+		WHERE file_id = ?1
+	`, fileID).Scan(&counts.Downloads, &counts.Previews, &counts.Streams, &counts.UniqueIPs, scanNullTime(&counts.LastAccessAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count file accesses: %v", err)
+	}
+	return &counts, nil
+}
+
+// GetFileAccessDaily counts the logged accesses of a file per day, oldest first
+func (s *SQLiteStore) GetFileAccessDaily(fileID string) ([]DailyFileAccesses, error) {
+	rows, err := s.db.Query(`
+		SELECT substr(access_time, 1, 10) AS day,
+		       COUNT(*) FILTER (WHERE access_type = 'download'),
+		       COUNT(*) FILTER (WHERE access_type = 'preview'),
+		       COUNT(*) FILTER (WHERE access_type = 'stream')
+		FROM file_access_logs
+		WHERE file_id = ?1
+		GROUP BY day
+		ORDER BY day
+	`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count daily file accesses: %v", err)
+	}
+	defer rows.Close()
+
+	days := make([]DailyFileAccesses, 0)
+	for rows.Next() {
+		var day DailyFileAccesses
+		if err := rows.Scan(&day.Date, &day.Downloads, &day.Previews, &day.Streams); err != nil {
+			return nil, fmt.Errorf("failed to scan daily file accesses: %v", err)
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// ListFileAccesses returns the most recent logged accesses of a file, newest first
+func (s *SQLiteStore) ListFileAccesses(fileID string, limit int) ([]FileAccess, error) {
+	rows, err := s.db.Query(`
+		SELECT access_type, ip_address, user_agent, access_time
+		FROM file_access_logs
+		WHERE file_id = ?1
+		ORDER BY access_time DESC, id DESC
+		LIMIT ?2
+	`, fileID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file accesses: %v", err)
+	}
+	defer rows.Close()
+
+	accesses := make([]FileAccess, 0)
+	for rows.Next() {
+		var access FileAccess
+		if err := rows.Scan(&access.AccessType, &access.IPAddress, &access.UserAgent, scanTime(&access.AccessTime)); err != nil {
+			return nil, fmt.Errorf("failed to scan file access: %v", err)
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, rows.Err()
+}
+
+// AddFileEvent appends an event recorded by the application to the file event log
+func (s *SQLiteStore) AddFileEvent(fileID, eventType string, details interface{}, ipAddress string) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	var ip *string
+	if ipAddress != "" {
+		ip = &ipAddress
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO file_events (file_id, event_type, details, ip_address, org_id)
+		VALUES (?1, ?2, ?3, ?4, (SELECT org_id FROM files WHERE id = ?1))
+	`, fileID, eventType, string(detailsJSON), ip)
+	if err != nil {
+		return fmt.Errorf("failed to add file event: %v", err)
+	}
+	return nil
+}
+
+// queryFileEvents runs a query selecting the columns of file events
+func (s *SQLiteStore) queryFileEvents(query string, args ...interface{}) ([]FileEvent, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]FileEvent, 0)
+	for rows.Next() {
+		var event FileEvent
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.FileID, &event.Type, &details, &event.IPAddress, scanTime(&event.CreatedAt)); err != nil {
+			return nil, fmt.Errorf("failed to scan file event: %v", err)
+		}
+		event.Details = details
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ListFileEvents returns events after the cursor in order, optionally only of the given
+// types. SQLite commits one writer at a time, so unlike with PostgreSQL no recent events
+// need to be held back.
+func (s *SQLiteStore) ListFileEvents(after int64, eventTypes []string, limit int) ([]FileEvent, error) {
+	typeFilter, args := sqliteInList("event_type", eventTypes, []interface{}{after, limit})
+	events, err := s.queryFileEvents(`
+		SELECT id, file_id, event_type, details, ip_address, created_at
+		FROM file_events
+		WHERE id > ?1 AND `+typeFilter+`
+		ORDER BY id
+		LIMIT ?2
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list file events: %v", err)
+	}
+	return events, nil
+}
+
+// ListOrgFileEvents is ListFileEvents restricted to the files of one organization
+func (s *SQLiteStore) ListOrgFileEvents(orgID string, after int64, eventTypes []string, limit int) ([]FileEvent, error) {
+	typeFilter, args := sqliteInList("event_type", eventTypes, []interface{}{orgID, after, limit})
+	events, err := s.queryFileEvents(`
+		SELECT id, file_id, event_type, details, ip_address, created_at
+		FROM file_events
+		WHERE org_id = ?1 AND id > ?2 AND `+typeFilter+`
+		ORDER BY id
+		LIMIT ?3
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list org file events: %v", err)
+	}
+	return events, nil
+}
+
+// ListAPIKeyFileEvents retrieves the newest events of the existing files uploaded with
+// an API key, optionally only those of the given types
+func (s *SQLiteStore) ListAPIKeyFileEvents(keyID string, eventTypes []string, limit int) ([]FileEvent, error) {
+	typeFilter, args := sqliteInList("e.event_type", eventTypes, []interface{}{keyID, limit})
+	events, err := s.queryFileEvents(`
+		SELECT e.id, e.file_id, e.event_type, e.details, e.ip_address, e.created_at
+		FROM file_events e
+		JOIN files f ON f.id = e.file_id
+		WHERE f.api_key_id = ?1 AND `+typeFilter+`
+		ORDER BY e.id DESC
+		LIMIT ?2
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API key file events: %v", err)
+	}
+	return events, nil
+}
+
+// DeleteFileEventsBefore removes events older than the retention period
+func (s *SQLiteStore) DeleteFileEventsBefore(cutoff time.Time) error {
+	if _, err := s.db.Exec(`DELETE FROM file_events WHERE created_at < ?1`, sqliteTime(cutoff)); err != nil {
+		return fmt.Errorf("failed to delete old file events: %v", err)
+	}
+	return nil
+}
+
+// sqliteDate stores the first day of a bandwidth period
+func sqliteDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// AddBandwidthUsage adds served bytes to the monthly bandwidth counters
+func (s *SQLiteStore) AddBandwidthUsage(usage []BandwidthUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, u := range usage {
+		_, err := tx.Exec(`
+			INSERT INTO bandwidth_usage (period, subject_type, subject_id, bytes)
+			VALUES (?1, ?2, ?3, ?4)
+			ON CONFLICT (period, subject_type, subject_id)
+			DO UPDATE SET bytes = bandwidth_usage.bytes + excluded.bytes, updated_at = `+sqliteNow,
+			sqliteDate(u.Period), u.SubjectType, u.SubjectID, u.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to add bandwidth usage: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteUsageBefore removes the usage records and file bandwidth from before cutoff, and
+// folds the bandwidth of API keys and client IPs into an anonymous subject of each month
+func (s *SQLiteStore) DeleteUsageBefore(cutoff, ipCutoff time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for subjectType, before := range map[string]time.Time{"key": cutoff, "ip": ipCutoff} {
+		if _, err := tx.Exec(`
+			INSERT INTO bandwidth_usage (period, subject_type, subject_id, bytes)
+			SELECT period, ?1, '', SUM(bytes) FROM bandwidth_usage
+			WHERE subject_type = ?1 AND subject_id <> '' AND updated_at < ?2
+			GROUP BY period
+			ON CONFLICT (period, subject_type, subject_id)
+			DO UPDATE SET bytes = bandwidth_usage.bytes + excluded.bytes, updated_at = `+sqliteNow+`
+		`, subjectType, sqliteTime(before)); err != nil {
+			return fmt.Errorf("failed to fold %s bandwidth: %v", subjectType, err)
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM bandwidth_usage WHERE subject_type = ?1 AND subject_id <> '' AND updated_at < ?2
+		`, subjectType, sqliteTime(before)); err != nil {
+			return fmt.Errorf("failed to fold %s bandwidth: %v", subjectType, err)
+		}
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM bandwidth_usage WHERE subject_type = 'file' AND updated_at < ?1
+	`, sqliteTime(cutoff)); err != nil {
+		return fmt.Errorf("failed to delete old file bandwidth: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM usage_records WHERE hour < ?1`, sqliteTime(cutoff)); err != nil {
+		return fmt.Errorf("failed to delete old usage records: %v", err)
+	}
+	return tx.Commit()
+}
+
+// GetBandwidthUsage returns the total bytes served to one subject type in a month and
+// the subjects that used the most, leaving out the anonymous subject
+func (s *SQLiteStore) GetBandwidthUsage(period time.Time, subjectType string, limit int) (int64, []BandwidthUsage, error) {
+	var total int64
+	err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(bytes), 0) FROM bandwidth_usage
+		WHERE period = ?1 AND subject_type = ?2
+	`, sqliteDate(period), subjectType).Scan(&total)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get bandwidth total: %v", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT subject_id, bytes FROM bandwidth_usage
+		WHERE period = ?1 AND subject_type = ?2 AND subject_id <> ''
+		ORDER BY bytes DESC
+		LIMIT ?3
+	`, sqliteDate(period), subjectType, limit)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get bandwidth usage: %v", err)
+	}
+	defer rows.Close()
+
+	top := make([]BandwidthUsage, 0)
+	for rows.Next() {
+		u := BandwidthUsage{Period: period, SubjectType: subjectType}
+		if err := rows.Scan(&u.SubjectID, &u.Bytes); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan bandwidth usage: %v", err)
+		}
+		top = append(top, u)
+	}
+	return total, top, rows.Err()
+}
+
+// GetFileBandwidth returns the bytes served of a file per month, newest first
+func (s *SQLiteStore) GetFileBandwidth(fileID string) ([]MonthlyBandwidth, error) {
+	rows, err := s.db.Query(`
+		SELECT substr(period, 1, 7), bytes FROM bandwidth_usage
+		WHERE subject_type = 'file' AND subject_id = ?1
+		ORDER BY period DESC
+	`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file bandwidth: %v", err)
+	}
+	defer rows.Close()
+
+	months := make([]MonthlyBandwidth, 0)
+	for rows.Next() {
+		var month MonthlyBandwidth
+		if err := rows.Scan(&month.Period, &month.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan file bandwidth: %v", err)
+		}
+		months = append(months, month)
+	}
+	return months, rows.Err()
+}
+
+// GetServiceStats counts the active files and the bytes served since metering began
+func (s *SQLiteStore) GetServiceStats() (*ServiceStats, error) {
+	stats := &ServiceStats{}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM files WHERE expires_at > ` + sqliteNow + ` AND deleted_at IS NULL`).Scan(&stats.ActiveFiles); err != nil {
+		return nil, fmt.Errorf("failed to count active files: %v", err)
+	}
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(bytes), 0) FROM bandwidth_usage
+		WHERE subject_type IN ('key', 'ip')
+	`).Scan(&stats.BytesServed); err != nil {
+		return nil, fmt.Errorf("failed to sum bytes served: %v", err)
+	}
+	return stats, nil
+}
+
+// queryClassUsage runs a query selecting storage class, file count and bytes
+func (s *SQLiteStore) queryClassUsage(query string, args ...interface{}) ([]ClassUsage, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make([]ClassUsage, 0)
+	for rows.Next() {
+		var u ClassUsage
+		if err := rows.Scan(&u.StorageClass, &u.Files, &u.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan class usage: %v", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// GetEgressByClass returns the bytes served in a month per storage class of the file.
+// Files that no longer exist are reported with an empty storage class.
+func (s *SQLiteStore) GetEgressByClass(period time.Time) ([]ClassUsage, error) {
+	usage, err := s.queryClassUsage(`
+		SELECT COALESCE(f.storage_class, ''), COUNT(*), COALESCE(SUM(b.bytes), 0)
+		FROM bandwidth_usage b
+		LEFT JOIN files f ON f.id = b.subject_id
+		WHERE b.period = ?1 AND b.subject_type = 'file'
+		GROUP BY 1
+	`, sqliteDate(period))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get egress by class: %v", err)
+	}
+	return usage, nil
+}
+
+// GetStoredBytesByClass returns the active files and their stored (compressed) bytes per
+// storage class
+func (s *SQLiteStore) GetStoredBytesByClass() ([]ClassUsage, error) {
+	usage, err := s.queryClassUsage(`
+		SELECT storage_class, COUNT(*), COALESCE(SUM(COALESCE(compressed_size, original_size)), 0)
+		FROM files
+		WHERE expires_at > ` + sqliteNow + `
+		GROUP BY storage_class
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored bytes by class: %v", err)
+	}
+	return usage, nil
+}
+
+// AddUsageRecords adds metered usage to the hourly records, stamping each with the
+// current org of its key. The org is filled in on the records passed in.
+func (s *SQLiteStore) AddUsageRecords(records []UsageRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for i, r := range records {
+		err := tx.QueryRow(`
+			INSERT INTO usage_records (hour, api_key_id, org_id, metric, quantity)
+			VALUES (?1, ?2, (SELECT org_id FROM api_keys WHERE id = ?2), ?3, ?4)
+			ON CONFLICT (hour, api_key_id, metric)
+			DO UPDATE SET quantity = usage_records.quantity + excluded.quantity, updated_at = `+sqliteNow+`
+			RETURNING org_id
+		`, sqliteTime(r.Hour), r.APIKeyID, r.Metric, r.Quantity).Scan(&records[i].OrgID)
+		if err != nil {
+			return fmt.Errorf("failed to add usage record: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetStoredBytesByAPIKey returns the bytes currently stored by each API key
+func (s *SQLiteStore) GetStoredBytesByAPIKey() (map[string]int64, error) {
+	rows, err := s.db.Query(`
+		SELECT api_key_id, COALESCE(SUM(COALESCE(compressed_size, original_size)), 0)
+		FROM files
+		WHERE expires_at > ` + sqliteNow + ` AND api_key_id IS NOT NULL
+		GROUP BY api_key_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored bytes by API key: %v", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]int64)
+	for rows.Next() {
+		var keyID string
+		var bytes int64
+		if err := rows.Scan(&keyID, &bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan stored bytes: %v", err)
+		}
+		stored[keyID] = bytes
+	}
+	return stored, rows.Err()
+}
+
+// GetUsageRollup sums the usage records of a month per API key, or per org when
+// groupBy is "org"
+func (s *SQLiteStore) GetUsageRollup(period time.Time, groupBy string) ([]UsageRollup, error) {
+	account := "api_key_id"
+	if groupBy == "org" {
+		account = "org_id"
+	}
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT %[1]s,
+			   COALESCE(SUM(quantity) FILTER (WHERE metric = 'storage_byte_hours'), 0),
+			   COALESCE(SUM(quantity) FILTER (WHERE metric = 'egress_bytes'), 0),
+			   COALESCE(SUM(quantity) FILTER (WHERE metric = 'api_calls'), 0)
+		FROM usage_records
+		WHERE hour >= ?1 AND hour < ?2 AND %[1]s IS NOT NULL
+		GROUP BY %[1]s
+		ORDER BY %[1]s
+	`, account), sqliteTime(period), sqliteTime(period.AddDate(0, 1, 0)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage rollup: %v", err)
+	}
+	defer rows.Close()
+
+	rollups := make([]UsageRollup, 0)
+	for rows.Next() {
+		rollup := UsageRollup{AccountType: "key"}
+		if groupBy == "org" {
+			rollup.AccountType = "org"
+		}
+		if err := rows.Scan(&rollup.AccountID, &rollup.StorageByteHours, &rollup.EgressBytes, &rollup.APICalls); err != nil {
+			return nil, fmt.Errorf("failed to scan usage rollup: %v", err)
+		}
+		rollups = append(rollups, rollup)
+	}
+	return rollups, rows.Err()
+}
+
+// The replication log only exists with PostgreSQL. Without a secondary it is cleared
+// regularly, which has nothing to do here.
+
+func (s *SQLiteStore) SeedReplicationLog() (int64, error) { return 0, errSQLiteReplication }
+
+func (s *SQLiteStore) GetReplicationChanges(limit int) ([]ReplicationChange, error) {
+	return nil, errSQLiteReplication
+}
+
+func (s *SQLiteStore) AckReplicationChanges(lastID int64) error { return errSQLiteReplication }
+
+func (s *SQLiteStore) ClearReplicationLog() error { return nil }
+
+func (s *SQLiteStore) GetReplicationBacklog() (int64, *time.Time, error) {
+	return 0, nil, errSQLiteReplication
+}
+
+func (s *SQLiteStore) GetFileForReplication(fileID string) (*FileStorage, error) {
+	return nil, errSQLiteReplication
+}
@@ -0,0 +1,751 @@
+//go:build sqlite
+
+package main
+
+// Tests running the queries of the embedded mode against a real SQLite database:
+//
+//	go test -tags sqlite -run SQLiteStore .
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestSQLiteStore opens a fresh database with the schema applied
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := NewSQLiteStore(&Config{SQLitePath: filepath.Join(dir, "one.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+	// The schema is applied on every start, so it must apply twice
+	for i := 0; i < 2; i++ {
+		if err := store.EnsureSchema(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// sqliteTestFile returns a database-stored file uploaded a minute ago that expires in an hour
+func sqliteTestFile(id, content string) *FileStorage {
+	now := time.Now().Truncate(time.Millisecond)
+	size := int64(len(content))
+	return &FileStorage{
+		ID:              id,
+		Filename:        id + ".txt",
+		OriginalSize:    size,
+		CompressedSize:  &size,
+		MimeType:        "text/plain",
+		CompressionType: string(CompressionNone),
+		StorageType:     "postgresql",
+		FileContent:     []byte(content),
+		UploadTime:      now.Add(-time.Minute),
+		ExpiresAt:       now.Add(time.Hour),
+		DeletePassword:  "delete-me",
+	}
+}
+
+func mustSaveSQLiteFile(t *testing.T, store *SQLiteStore, file *FileStorage) {
+	t.Helper()
+	if err := store.SaveFile(file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteStoreFileRoundTrip(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	file := sqliteTestFile("round", "stored in a blob")
+	hash := "abc123"
+	ip := "203.0.113.7"
+	file.ContentHash = &hash
+	file.UploaderIP = &ip
+	file.ImageInfo = &ImageInfo{Width: 640, Height: 480}
+	file.ScanResult = &ScanResult{Status: ScanStatusClean, Engine: "test", ScannedAt: file.UploadTime.UTC()}
+	file.Accessibility = &Accessibility{AltText: "A test file"}
+	file.Tags = map[string]string{"user": "42"}
+	mustSaveSQLiteFile(t, store, file)
+
+	got, err := store.GetFile("round")
+	if err != nil || got == nil {
+		t.Fatalf("GetFile: %v, %v", got, err)
+	}
+	if string(got.FileContent) != "stored in a blob" || got.Filename != "round.txt" || got.StorageClass != string(StorageClassStandard) {
+		t.Errorf("file = %+v", got)
+	}
+	if !got.UploadTime.Equal(file.UploadTime) || !got.ExpiresAt.Equal(file.ExpiresAt) || got.Version != 1 {
+		t.Errorf("times = %v, %v, version %d", got.UploadTime, got.ExpiresAt, got.Version)
+	}
+	if got.ContentHash == nil || *got.ContentHash != hash || got.UploaderIP == nil || *got.UploaderIP != ip {
+		t.Errorf("hash = %v, ip = %v", got.ContentHash, got.UploaderIP)
+	}
+	if !reflect.DeepEqual(got.ImageInfo, file.ImageInfo) || !reflect.DeepEqual(got.Accessibility, file.Accessibility) ||
+		!reflect.DeepEqual(got.Tags, file.Tags) || got.ScanResult == nil || got.ScanResult.Status != ScanStatusClean {
+		t.Errorf("JSON columns = %+v, %+v, %v, %+v", got.ImageInfo, got.Accessibility, got.Tags, got.ScanResult)
+	}
+	if metadata, _ := store.GetFileMetadata("round"); metadata == nil || metadata.FileContent != nil {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	if err := store.SaveFile(sqliteTestFile("round", "again")); err == nil {
+		t.Error("saving a duplicate ID succeeded")
+	}
+	if got, _ := store.GetFile("round"); got == nil || string(got.FileContent) != "stored in a blob" {
+		t.Error("failed duplicate save replaced the content")
+	}
+
+	diskPath := "/data/standard/on-disk"
+	onDisk := sqliteTestFile("disk", "")
+	onDisk.StoragePath = &diskPath
+	onDisk.StorageType = "disk"
+	mustSaveSQLiteFile(t, store, onDisk)
+	if _, err := os.Stat(filepath.Join(store.blobDir, "disk")); !os.IsNotExist(err) {
+		t.Errorf("disk-stored file got a blob: %v", err)
+	}
+
+	expired := sqliteTestFile("expired", "old")
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	mustSaveSQLiteFile(t, store, expired)
+	if got, _ := store.GetFile("expired"); got != nil {
+		t.Error("expired file returned")
+	}
+	if exists, err := store.FileIDExists("expired"); err != nil || !exists {
+		t.Errorf("FileIDExists(expired) = %v, %v", exists, err)
+	}
+	if exists, _ := store.FileIDExists("missing"); exists {
+		t.Error("FileIDExists(missing) = true")
+	}
+
+	if err := store.DeleteFile("round"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store.blobDir, "round")); !os.IsNotExist(err) {
+		t.Errorf("blob left after delete: %v", err)
+	}
+	if err := store.DeleteFile("round"); err == nil {
+		t.Error("deleting a missing file succeeded")
+	}
+}
+
+func TestSQLiteStoreFileUpdates(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	mustSaveSQLiteFile(t, store, sqliteTestFile("edit", "content"))
+
+	expiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Millisecond)
+	updates := []error{
+		store.UpdateFileExpiration("edit", expiresAt),
+		store.UpdateFileDownloadPassword("edit", "secret"),
+		store.UpdateFileDeletePassword("edit", "new-delete"),
+		store.UpdateFileName("edit", "renamed.md"),
+		store.UpdateFileMimeType("edit", "text/markdown"),
+		store.UpdateFileScanResult("edit", &ScanResult{Status: ScanStatusInfected, Signature: "Eicar"}),
+		store.UpdateFileAccessibility("edit", &Accessibility{Caption: "Notes"}),
+	}
+	for i, err := range updates {
+		if err != nil {
+			t.Errorf("update %d: %v", i, err)
+		}
+	}
+	got, _ := store.GetFileMetadata("edit")
+	if got == nil || !got.ExpiresAt.Equal(expiresAt) || !got.HasDownloadPassword || *got.DownloadPassword != "secret" ||
+		got.DeletePassword != "new-delete" || got.Filename != "renamed.md" || got.MimeType != "text/markdown" ||
+		got.ScanResult.Signature != "Eicar" || got.Accessibility.Caption != "Notes" {
+		t.Fatalf("updated file = %+v", got)
+	}
+
+	if err := store.UpdateFileDownloadPassword("edit", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateFileAccessibility("edit", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetFileMetadata("edit"); got.HasDownloadPassword || got.DownloadPassword != nil || got.Accessibility != nil {
+		t.Errorf("cleared file = %+v", got)
+	}
+	if err := store.UpdateFileName("missing", "x"); err == nil || err.Error() != "file not found" {
+		t.Errorf("updating a missing file: %v", err)
+	}
+}
+
+func TestSQLiteStoreListActiveFiles(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	key := "lister"
+	store.CreateAPIKey(&APIKeyStorage{ID: key, Name: "Lister", KeyHash: "hash-lister"})
+	for i, name := range []string{"alpha", "beta", "gamma_1", "gamma%2"} {
+		file := sqliteTestFile(name, name)
+		file.UploadTime = file.UploadTime.Add(time.Duration(i) * time.Second)
+		if name == "beta" {
+			file.MimeType = "image/png"
+			file.APIKeyID = &key
+		}
+		mustSaveSQLiteFile(t, store, file)
+	}
+	trashed := sqliteTestFile("trashed", "x")
+	mustSaveSQLiteFile(t, store, trashed)
+	store.TrashFile("trashed", time.Now())
+
+	ids := func(files []*FileStorage) []string {
+		var ids []string
+		for _, file := range files {
+			ids = append(ids, file.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		query FileListQuery
+		want  []string
+		total int
+	}{
+		{FileListQuery{Limit: 2}, []string{"gamma%2", "gamma_1"}, 4},
+		{FileListQuery{Limit: 2, Offset: 2}, []string{"beta", "alpha"}, 4},
+		{FileListQuery{Limit: 2, Offset: 10}, nil, 4},
+		{FileListQuery{Limit: 10, SortBy: "filename", Ascending: true}, []string{"alpha", "beta", "gamma%2", "gamma_1"}, 4},
+		{FileListQuery{Limit: 10, Search: "GAMMA_"}, []string{"gamma_1"}, 1},
+		{FileListQuery{Limit: 10, Search: "%"}, []string{"gamma%2"}, 1},
+		{FileListQuery{Limit: 10, MimeType: "image/"}, []string{"beta"}, 1},
+		{FileListQuery{Limit: 10, MimeType: "text/plain", APIKeyID: key}, nil, 0},
+		{FileListQuery{Limit: 10, APIKeyID: key}, []string{"beta"}, 1},
+	} {
+		files, total, err := store.ListActiveFiles(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids(files), tc.want) || total != tc.total {
+			t.Errorf("%+v: got %v (%d), want %v (%d)", tc.query, ids(files), total, tc.want, tc.total)
+		}
+	}
+
+	stats, err := store.GetMimeTypeStats()
+	if err != nil || len(stats) != 2 || stats[0].MimeType != "text/plain" || stats[0].Files != 3 {
+		t.Errorf("MIME type stats = %+v, %v", stats, err)
+	}
+}
+
+func TestSQLiteStoreTrash(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	mustSaveSQLiteFile(t, store, sqliteTestFile("binned", "content"))
+	if claimed, err := store.ClaimSlug("my-slug", "binned"); err != nil || !claimed {
+		t.Fatalf("ClaimSlug = %v, %v", claimed, err)
+	}
+
+	deletedAt := time.Now().Add(-time.Hour)
+	if err := store.TrashFile("binned", deletedAt); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetFile("binned"); got != nil {
+		t.Error("trashed file returned by GetFile")
+	}
+	if id, _ := store.GetFileIDBySlug("my-slug"); id != "" {
+		t.Errorf("slug of a trashed file resolves to %q", id)
+	}
+	if got, _ := store.GetTrashedFile("binned"); got == nil || got.DeletedAt == nil {
+		t.Fatalf("trashed file = %+v", got)
+	}
+	if content, err := store.GetTrashedFileContent("binned"); err != nil || string(content) != "content" {
+		t.Errorf("trashed content = %q, %v", content, err)
+	}
+	if _, err := store.GetTrashedFileContent("missing"); err == nil {
+		t.Error("content of a file not in the trash returned")
+	}
+	if err := store.TrashFile("binned", deletedAt); err == nil {
+		t.Error("trashing a trashed file succeeded")
+	}
+	if err := store.RestoreFile("binned"); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := store.GetFileIDBySlug("my-slug"); id != "binned" {
+		t.Errorf("slug of a restored file resolves to %q", id)
+	}
+
+	store.TrashFile("binned", deletedAt)
+	if paths, err := store.PurgeTrashedFiles(time.Now()); err != nil || len(paths) != 0 {
+		t.Errorf("PurgeTrashedFiles = %v, %v", paths, err)
+	}
+	if exists, _ := store.FileIDExists("binned"); exists {
+		t.Error("purged file still exists")
+	}
+	if _, err := os.Stat(filepath.Join(store.blobDir, "binned")); !os.IsNotExist(err) {
+		t.Errorf("blob left after purge: %v", err)
+	}
+}
+
+func TestSQLiteStoreSlugs(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	mustSaveSQLiteFile(t, store, sqliteTestFile("first", "1"))
+	mustSaveSQLiteFile(t, store, sqliteTestFile("second", "2"))
+
+	if claimed, _ := store.ClaimSlug("shared", "first"); !claimed {
+		t.Fatal("first claim failed")
+	}
+	if claimed, _ := store.ClaimSlug("shared", "second"); claimed {
+		t.Error("slug of a live file taken over")
+	}
+	store.UpdateFileExpiration("first", time.Now().Add(-time.Second))
+	if claimed, _ := store.ClaimSlug("shared", "second"); !claimed {
+		t.Error("slug of an expired file not released")
+	}
+	if id, _ := store.GetFileIDBySlug("shared"); id != "second" {
+		t.Errorf("slug resolves to %q", id)
+	}
+}
+
+func TestSQLiteStoreCloneAndDedup(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	hash := "same-content"
+	ip := "198.51.100.1"
+	source := sqliteTestFile("source", "shared bytes")
+	source.ContentHash = &hash
+	source.UploaderIP = &ip
+	mustSaveSQLiteFile(t, store, source)
+
+	found, err := store.FindFileByContentHash(hash, source.OriginalSize, nil, ip)
+	if err != nil || found == nil || found.ID != "source" {
+		t.Fatalf("FindFileByContentHash = %+v, %v", found, err)
+	}
+	if found, _ := store.FindFileByContentHash(hash, source.OriginalSize, nil, "192.0.2.1"); found != nil {
+		t.Error("matched another uploader's file")
+	}
+
+	clone := sqliteTestFile("clone", "")
+	clone.Filename = "copy.txt"
+	if err := store.CloneFile("source", clone); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := store.GetFile("clone")
+	if got == nil || string(got.FileContent) != "shared bytes" || got.Filename != "copy.txt" ||
+		got.ContentHash == nil || *got.ContentHash != hash {
+		t.Errorf("clone = %+v", got)
+	}
+	if err := store.CloneFile("missing", sqliteTestFile("orphan", "")); err == nil {
+		t.Error("cloning a missing file succeeded")
+	}
+	if exists, _ := store.FileIDExists("orphan"); exists {
+		t.Error("failed clone left a record")
+	}
+}
+
+func TestSQLiteStoreVersions(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	file := sqliteTestFile("versioned", "first content")
+	mustSaveSQLiteFile(t, store, file)
+
+	now := time.Now().Truncate(time.Millisecond)
+	err := store.SaveFileVersion(&FileVersion{
+		FileID: "versioned", Version: 1, OriginalSize: file.OriginalSize, CompressionType: file.CompressionType,
+		StorageType: "postgresql", FileContent: file.FileContent, ReplacedAt: now, ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaced := sqliteTestFile("versioned", "second content")
+	replaced.Version = 2
+	if err := store.ReplaceFileContent(replaced); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := store.GetFile("versioned"); got == nil || string(got.FileContent) != "second content" || got.Version != 2 {
+		t.Errorf("current = %+v", got)
+	}
+	versions, err := store.ListFileVersions("versioned")
+	if err != nil || len(versions) != 1 || versions[0].Version != 1 || !versions[0].ReplacedAt.Equal(now) {
+		t.Fatalf("versions = %+v, %v", versions, err)
+	}
+	if v, _ := store.GetFileVersion("versioned", 1); v == nil || string(v.FileContent) != "first content" {
+		t.Errorf("version 1 = %+v", v)
+	}
+	if v, _ := store.GetFileVersion("versioned", 5); v != nil {
+		t.Errorf("version 5 = %+v", v)
+	}
+
+	expiredPath := "/data/standard/old-version"
+	store.SaveFileVersion(&FileVersion{
+		FileID: "versioned", Version: 0, StorageType: "disk", StoragePath: &expiredPath, CompressionType: file.CompressionType,
+		ReplacedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour),
+	})
+	paths, err := store.DeleteExpiredFileVersions()
+	if err != nil || !reflect.DeepEqual(paths, []string{expiredPath}) {
+		t.Errorf("DeleteExpiredFileVersions = %v, %v", paths, err)
+	}
+	if v, _ := store.GetFileVersion("versioned", 1); v == nil {
+		t.Error("unexpired version deleted")
+	}
+
+	// Versions go when their file expires, even within their own retention
+	store.UpdateFileExpiration("versioned", now.Add(-time.Minute))
+	if _, err := store.DeleteExpiredFileVersions(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := store.GetFileVersion("versioned", 1); v != nil {
+		t.Error("version of an expired file kept")
+	}
+}
+
+func TestSQLiteStoreAppendedFiles(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	open := "open"
+	path := "/data/standard/appended"
+	file := sqliteTestFile("log", "")
+	file.AppendState = &open
+	file.StorageType = "disk"
+	file.StoragePath = &path
+	mustSaveSQLiteFile(t, store, file)
+
+	expiresAt := time.Now().Add(2 * time.Hour).Truncate(time.Millisecond)
+	if err := store.UpdateAppendedFile("log", 42, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetFileMetadata("log"); got.OriginalSize != 42 || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("appended file = %+v", got)
+	}
+	if err := store.FinalizeAppendedFile("log", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateAppendedFile("log", 50, expiresAt); err == nil {
+		t.Error("appended to a finalized file")
+	}
+}
+
+func TestSQLiteStoreCleanup(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	diskPath := "/data/standard/expired-disk"
+	onDisk := sqliteTestFile("expired-disk", "")
+	onDisk.StorageType = "disk"
+	onDisk.StoragePath = &diskPath
+	onDisk.ExpiresAt = time.Now().Add(-time.Minute)
+	inDatabase := sqliteTestFile("expired-db", "old")
+	inDatabase.ExpiresAt = time.Now().Add(-time.Minute)
+	for _, file := range []*FileStorage{onDisk, inDatabase, sqliteTestFile("live", "new")} {
+		mustSaveSQLiteFile(t, store, file)
+	}
+	store.SaveChunkUpload(&ChunkUploadStorage{
+		UploadID: "stale", Filename: "big.bin", TotalChunks: 1, ReceivedChunks: []bool{false},
+		LastActivity: time.Now(), ExpiresAt: time.Now().Add(-time.Minute), Status: "active",
+	})
+
+	paths, err := store.DeleteExpiredDiskFiles()
+	if err != nil || !reflect.DeepEqual(paths, []string{diskPath}) {
+		t.Errorf("DeleteExpiredDiskFiles = %v, %v", paths, err)
+	}
+	if err := store.CleanupExpiredData(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := store.FileIDExists("expired-db"); exists {
+		t.Error("expired file kept")
+	}
+	if _, err := os.Stat(filepath.Join(store.blobDir, "expired-db")); !os.IsNotExist(err) {
+		t.Errorf("blob of an expired file kept: %v", err)
+	}
+	if got, _ := store.GetFile("live"); got == nil {
+		t.Error("live file deleted")
+	}
+	var uploads int
+	store.db.QueryRow(`SELECT COUNT(*) FROM chunk_uploads`).Scan(&uploads)
+	if uploads != 0 {
+		t.Errorf("%d expired upload sessions kept", uploads)
+	}
+}
+
+func TestSQLiteStoreChunkUploadsAndJobs(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	upload := &ChunkUploadStorage{
+		UploadID: "up", Filename: "big.bin", TotalSize: 20, TotalChunks: 2, ChunkSize: 10,
+		ReceivedChunks: []bool{true, false}, StorageClass: "standard",
+		LastActivity: time.Now(), ExpiresAt: time.Now().Add(time.Hour), Status: "active",
+	}
+	if err := store.SaveChunkUpload(upload); err != nil {
+		t.Fatal(err)
+	}
+	upload.ReceivedChunks = []bool{true, true}
+	upload.Status = "completed"
+	if err := store.SaveChunkUpload(upload); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetChunkUpload("up")
+	if err != nil || got == nil || !reflect.DeepEqual(got.ReceivedChunks, []bool{true, true}) || got.Status != "completed" {
+		t.Fatalf("upload = %+v, %v", got, err)
+	}
+	if active, _ := store.ListActiveChunkUploads(); len(active) != 0 {
+		t.Errorf("active uploads = %+v", active)
+	}
+	store.DeleteChunkUpload("up")
+	if got, _ := store.GetChunkUpload("up"); got != nil {
+		t.Error("deleted upload returned")
+	}
+
+	fileID := "result"
+	completedAt := time.Now().Truncate(time.Millisecond)
+	job := &ProcessingJobStorage{JobID: "job", UploadID: "up", Status: "processing"}
+	if err := store.SaveProcessingJob(job); err != nil {
+		t.Fatal(err)
+	}
+	job.Status, job.FileID, job.Progress, job.CompletedAt = "completed", &fileID, 100, &completedAt
+	job.ResultData = []byte(`{"ok":true}`)
+	if err := store.SaveProcessingJob(job); err != nil {
+		t.Fatal(err)
+	}
+	gotJob, err := store.GetProcessingJob("job")
+	if err != nil || gotJob == nil || gotJob.Status != "completed" || *gotJob.FileID != fileID ||
+		string(gotJob.ResultData) != `{"ok":true}` || !gotJob.CompletedAt.Equal(completedAt) {
+		t.Fatalf("job = %+v, %v", gotJob, err)
+	}
+
+	failed := &ProcessingJobStorage{JobID: "dead", UploadID: "up2", Status: "failed", Attempts: 5, DeadLetter: true}
+	store.SaveProcessingJob(failed)
+	if dead, err := store.ListDeadLetterJobs(10); err != nil || len(dead) != 1 || dead[0].JobID != "dead" {
+		t.Errorf("dead-letter jobs = %+v, %v", dead, err)
+	}
+}
+
+func TestSQLiteStoreAPIKeysAndOrgs(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	if err := store.CreateOrg(&Org{ID: "acme", Name: "Acme", QuotaBytes: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	orgID := "acme"
+	identity := "CN=uploader"
+	key := &APIKeyStorage{
+		ID: "k1", Name: "Uploader", KeyPrefix: "one_k1", KeyHash: "hash-1", RateLimit: 60,
+		ClientCertIdentity: &identity, OrgID: &orgID, OrgRole: "member",
+	}
+	if err := store.CreateAPIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAPIKey(&APIKeyStorage{ID: "k2", Name: "Other", KeyHash: "hash-2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := store.GetAPIKeyByHash("hash-1"); got == nil || got.ID != "k1" || *got.OrgID != "acme" || got.RateLimit != 60 {
+		t.Errorf("by hash = %+v", got)
+	}
+	if got, _ := store.GetAPIKeyByCertIdentity([]string{"CN=other", identity}); got == nil || got.ID != "k1" {
+		t.Errorf("by certificate = %+v", got)
+	}
+	if keys, _ := store.ListAPIKeys(); len(keys) != 2 {
+		t.Errorf("keys = %+v", keys)
+	}
+	key.Name, key.QuotaFiles = "Renamed", 5
+	if err := store.UpdateAPIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	store.TouchAPIKey("k1")
+	if got, _ := store.GetAPIKey("k1"); got.Name != "Renamed" || got.QuotaFiles != 5 || got.LastUsedAt == nil {
+		t.Errorf("updated key = %+v", got)
+	}
+	if err := store.RevokeAPIKey("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeAPIKey("k2"); err == nil {
+		t.Error("revoked a key twice")
+	}
+	if got, _ := store.GetAPIKey("k2"); got.RevokedAt == nil || got.IsActive() {
+		t.Errorf("revoked key = %+v", got)
+	}
+
+	// Files uploaded with a key in an org belong to the org
+	owned := sqliteTestFile("owned", "12345")
+	owned.APIKeyID = &key.ID
+	mustSaveSQLiteFile(t, store, owned)
+	ip := "192.0.2.9"
+	anonymous := sqliteTestFile("anonymous", "123")
+	anonymous.UploaderIP = &ip
+	mustSaveSQLiteFile(t, store, anonymous)
+
+	if files, bytes, _ := store.GetAPIKeyUsage("k1"); files != 1 || bytes != 5 {
+		t.Errorf("key usage = %d, %d", files, bytes)
+	}
+	if files, bytes, _ := store.GetOrgUsage("acme"); files != 1 || bytes != 5 {
+		t.Errorf("org usage = %d, %d", files, bytes)
+	}
+	if files, bytes, _ := store.GetUploaderIPUsage(ip); files != 1 || bytes != 3 {
+		t.Errorf("IP usage = %d, %d", files, bytes)
+	}
+	if files, _ := store.ListOrgFiles("acme", 10); len(files) != 1 || files[0].ID != "owned" {
+		t.Errorf("org files = %+v", files)
+	}
+	if stored, _ := store.GetStoredBytesByAPIKey(); stored["k1"] != 5 || len(stored) != 1 {
+		t.Errorf("stored bytes by key = %v", stored)
+	}
+
+	org, _ := store.GetOrg("acme")
+	org.Name = "Acme Corp"
+	org.Policy.RequireDownloadPassword = true
+	if err := store.UpdateOrg(org); err != nil {
+		t.Fatal(err)
+	}
+	if orgs, _ := store.ListOrgs(); len(orgs) != 1 || orgs[0].Name != "Acme Corp" || !orgs[0].Policy.RequireDownloadPassword {
+		t.Errorf("orgs = %+v", orgs)
+	}
+	if err := store.DeleteOrg("acme"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.GetAPIKey("k1"); got.OrgID != nil {
+		t.Errorf("key still in the deleted org: %v", *got.OrgID)
+	}
+	if got, _ := store.GetFileMetadata("owned"); got.OrgID != nil {
+		t.Errorf("file still owned by the deleted org: %v", *got.OrgID)
+	}
+	if err := store.DeleteOrg("acme"); err == nil {
+		t.Error("deleted a missing org")
+	}
+}
+
+func TestSQLiteStoreAccessesAndEvents(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	store.CreateOrg(&Org{ID: "acme", Name: "Acme"})
+	orgID := "acme"
+	keyID := "k1"
+	store.CreateAPIKey(&APIKeyStorage{ID: keyID, Name: "Key", KeyHash: "hash", OrgID: &orgID})
+	file := sqliteTestFile("watched", "content")
+	file.APIKeyID = &keyID
+	mustSaveSQLiteFile(t, store, file)
+
+	store.LogFileAccess("watched", "download", "192.0.2.1", "curl")
+	store.LogFileAccess("watched", "download", "192.0.2.2", "curl")
+	store.LogFileAccess("watched", "preview", "192.0.2.1", "browser")
+	counts, err := store.GetFileAccessCounts("watched")
+	if err != nil || counts.Downloads != 2 || counts.Previews != 1 || counts.UniqueIPs != 2 || counts.LastAccessAt == nil {
+		t.Errorf("access counts = %+v, %v", counts, err)
+	}
+	days, err := store.GetFileAccessDaily("watched")
+	if err != nil || len(days) != 1 || days[0].Downloads != 2 || days[0].Date != time.Now().UTC().Format("2006-01-02") {
+		t.Errorf("daily accesses = %+v, %v", days, err)
+	}
+	if accesses, _ := store.ListFileAccesses("watched", 2); len(accesses) != 2 || accesses[0].AccessType != "preview" {
+		t.Errorf("accesses = %+v", accesses)
+	}
+
+	// Uploads are recorded by a trigger
+	events, err := store.ListFileEvents(0, nil, 10)
+	if err != nil || len(events) != 1 || events[0].Type != "uploaded" || events[0].FileID != "watched" {
+		t.Fatalf("events after upload = %+v, %v", events, err)
+	}
+	uploaded := events[0].ID
+	for _, eventType := range []string{"renamed", "password_changed"} {
+		if err := store.AddFileEvent("watched", eventType, map[string]string{"by": "test"}, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err = store.ListFileEvents(uploaded, nil, 10)
+	if err != nil || len(events) != 2 || events[0].Type != "renamed" || string(events[0].Details) != `{"by":"test"}` ||
+		events[0].IPAddress == nil || *events[0].IPAddress != "192.0.2.1" {
+		t.Fatalf("events = %+v, %v", events, err)
+	}
+	if filtered, _ := store.ListFileEvents(0, []string{"password_changed"}, 10); len(filtered) != 1 || filtered[0].Type != "password_changed" {
+		t.Errorf("filtered events = %+v", filtered)
+	}
+	if orgEvents, _ := store.ListOrgFileEvents("acme", 0, []string{"uploaded", "renamed"}, 10); len(orgEvents) != 2 {
+		t.Errorf("org events = %+v", orgEvents)
+	}
+	if orgEvents, _ := store.ListOrgFileEvents("other", 0, nil, 10); len(orgEvents) != 0 {
+		t.Errorf("events of another org = %+v", orgEvents)
+	}
+	if keyEvents, _ := store.ListAPIKeyFileEvents(keyID, nil, 2); len(keyEvents) != 2 || keyEvents[0].Type != "password_changed" {
+		t.Errorf("key events = %+v", keyEvents)
+	}
+	if err := store.DeleteFileEventsBefore(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := store.ListFileEvents(0, nil, 10); len(events) != 0 {
+		t.Errorf("%d events left", len(events))
+	}
+}
+
+func TestSQLiteStoreUsage(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	store.CreateOrg(&Org{ID: "acme", Name: "Acme"})
+	orgID := "acme"
+	keyID := "k1"
+	store.CreateAPIKey(&APIKeyStorage{ID: keyID, Name: "Key", KeyHash: "hash", OrgID: &orgID})
+	file := sqliteTestFile("served", "content")
+	file.StorageClass = string(StorageClassArchive)
+	mustSaveSQLiteFile(t, store, file)
+
+	period := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	usage := []BandwidthUsage{
+		{Period: period, SubjectType: "file", SubjectID: "served", Bytes: 100},
+		{Period: period, SubjectType: "file", SubjectID: "gone", Bytes: 10},
+		{Period: period, SubjectType: "key", SubjectID: keyID, Bytes: 100},
+		{Period: period, SubjectType: "ip", SubjectID: "192.0.2.1", Bytes: 10},
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.AddBandwidthUsage(usage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total, top, err := store.GetBandwidthUsage(period, "file", 1)
+	if err != nil || total != 220 || len(top) != 1 || top[0].SubjectID != "served" || top[0].Bytes != 200 {
+		t.Errorf("file bandwidth = %d, %+v, %v", total, top, err)
+	}
+	if months, _ := store.GetFileBandwidth("served"); len(months) != 1 || months[0].Period != "2026-10" || months[0].Bytes != 200 {
+		t.Errorf("monthly bandwidth = %+v", months)
+	}
+	if stats, err := store.GetServiceStats(); err != nil || stats.ActiveFiles != 1 || stats.BytesServed != 220 {
+		t.Errorf("service stats = %+v, %v", stats, err)
+	}
+	egress, _ := store.GetEgressByClass(period)
+	byClass := map[string]int64{}
+	for _, u := range egress {
+		byClass[u.StorageClass] = u.Bytes
+	}
+	if byClass["archive"] != 200 || byClass[""] != 20 {
+		t.Errorf("egress by class = %+v", egress)
+	}
+	if stored, _ := store.GetStoredBytesByClass(); len(stored) != 1 || stored[0].StorageClass != "archive" || stored[0].Bytes != 7 {
+		t.Errorf("stored by class = %+v", stored)
+	}
+
+	hour := period.Add(5 * time.Hour)
+	records := []UsageRecord{
+		{Hour: hour, APIKeyID: keyID, Metric: meteringAPICalls, Quantity: 3},
+		{Hour: hour, APIKeyID: keyID, Metric: meteringEgressBytes, Quantity: 500},
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.AddUsageRecords(records); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if records[0].OrgID == nil || *records[0].OrgID != "acme" {
+		t.Errorf("record org = %v", records[0].OrgID)
+	}
+	for _, groupBy := range []string{"key", "org"} {
+		rollup, err := store.GetUsageRollup(period, groupBy)
+		if err != nil || len(rollup) != 1 || rollup[0].APICalls != 6 || rollup[0].EgressBytes != 1000 {
+			t.Errorf("%s rollup = %+v, %v", groupBy, rollup, err)
+		}
+	}
+	if rollup, _ := store.GetUsageRollup(period.AddDate(0, 1, 0), "key"); len(rollup) != 0 {
+		t.Errorf("next month's rollup = %+v", rollup)
+	}
+
+	// Client IPs go first, into the anonymous total of the month
+	if err := store.DeleteUsageBefore(time.Time{}, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if total, top, err := store.GetBandwidthUsage(period, "ip", 10); err != nil || total != 20 || len(top) != 0 {
+		t.Errorf("anonymized IP bandwidth = %d, %+v, %v", total, top, err)
+	}
+	if _, top, _ := store.GetBandwidthUsage(period, "key", 10); len(top) != 1 {
+		t.Errorf("key bandwidth before its retention = %+v", top)
+	}
+
+	store.AddBandwidthUsage([]BandwidthUsage{{Period: period, SubjectType: "ip", SubjectID: "192.0.2.2", Bytes: 5}})
+	if err := store.DeleteUsageBefore(time.Now().Add(time.Minute), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if months, _ := store.GetFileBandwidth("served"); len(months) != 0 {
+		t.Errorf("file bandwidth after its retention = %+v", months)
+	}
+	if total, top, _ := store.GetBandwidthUsage(period, "key", 10); total != 200 || len(top) != 0 {
+		t.Errorf("key bandwidth after its retention = %d, %+v", total, top)
+	}
+	if stats, _ := store.GetServiceStats(); stats.BytesServed != 225 {
+		t.Errorf("bytes served after the purge = %d, want 225", stats.BytesServed)
+	}
+	if rollup, _ := store.GetUsageRollup(period, "key"); len(rollup) != 0 {
+		t.Errorf("rollup after the purge = %+v", rollup)
+	}
+}
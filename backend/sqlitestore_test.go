@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLiteTimeRoundTrip(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*3600)
+	want := time.Date(2026, 3, 29, 1, 30, 15, 250e6, berlin)
+
+	var got time.Time
+	if err := scanTime(&got).Scan(sqliteTime(want)); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Text timestamps only compare in order if they're all UTC and the same width
+	if earlier := sqliteTime(want.Add(-time.Second)); earlier >= sqliteTime(want) {
+		t.Errorf("%s doesn't sort before %s", earlier, sqliteTime(want))
+	}
+
+	// Defaults written by SQLite itself
+	if err := scanTime(&got).Scan("2026-03-28 23:30:15.250+00:00"); err != nil || !got.Equal(want) {
+		t.Errorf("SQLite default: got %v, %v", got, err)
+	}
+
+	expiry := &want
+	if err := scanNullTime(&expiry).Scan(nil); err != nil || expiry != nil {
+		t.Errorf("NULL: got %v, %v", expiry, err)
+	}
+	if err := scanTime(&got).Scan(nil); err == nil {
+		t.Error("NULL into a NOT NULL column should fail")
+	}
+}
+
+func TestSQLiteInList(t *testing.T) {
+	filter, args := sqliteInList("event_type", []string{"uploaded", "deleted"}, []interface{}{int64(7), 50})
+	if filter != "event_type IN (?3, ?4)" {
+		t.Errorf("filter = %q", filter)
+	}
+	if want := []interface{}{int64(7), 50, "uploaded", "deleted"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	if filter, _ := sqliteInList("event_type", nil, nil); filter != "1" {
+		t.Errorf("no types: filter = %q", filter)
+	}
+}
+
+func TestOpenFileStoreUnknownDriver(t *testing.T) {
+	if _, err := openFileStore(&Config{DatabaseDriver: "mysql"}); err == nil {
+		t.Error("expected an error for an unknown driver")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// With PUBLIC_STATS_ENABLED the service publishes a few totals for community instances
+// to show on their landing pages. They are rounded to two significant figures and cached,
+// so they reveal nothing about individual uploads and polling them costs no queries.
+
+const (
+	publicStatsCacheKey = "public_stats"
+	publicStatsCacheTTL = 10 * time.Minute
+)
+
+// PublicStats are the rounded totals /api/stats publishes
+type PublicStats struct {
+	TotalFiles         int64 `json:"total_files"`
+	TotalBytesServed   int64 `json:"total_bytes_served"`
+	UptimeSeconds      int64 `json:"uptime_seconds"`
+	UpdatedAt          int64 `json:"updated_at"` // Unix time the totals were counted
+	CacheMaxAgeSeconds int64 `json:"cache_max_age_seconds"`
+}
+
+// roundStat rounds n down to two significant figures
+func roundStat(n int64) int64 {
+	if n < 100 {
+		return n
+	}
+	unit := int64(math.Pow10(int(math.Log10(float64(n))) - 1))
+	return n / unit * unit
+}
+
+// getPublicStats serves the public service totals. Uptime is this instance's, in whole hours.
+//
+// @summary Get the public service totals
+// @tags server
+// @success 200 PublicStats
+func (s *FileService) getPublicStats(c *gin.Context) {
+	if !s.config.PublicStatsEnabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Public statistics are disabled"})
+		return
+	}
+
+	ctx := context.Background()
+	var stats PublicStats
+	cached, err := s.redis.Get(ctx, publicStatsCacheKey).Bytes()
+	if err != nil || json.Unmarshal(cached, &stats) != nil {
+		totals, err := s.db.GetServiceStats()
+		if err != nil {
+			log.Printf("Failed to get service statistics: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statistics"})
+			return
+		}
+		stats = PublicStats{
+			TotalFiles:       roundStat(totals.ActiveFiles),
+			TotalBytesServed: roundStat(totals.BytesServed),
+			UpdatedAt:        s.clock.Now().Unix(),
+		}
+		if encoded, err := json.Marshal(stats); err == nil {
+			s.redis.Set(ctx, publicStatsCacheKey, encoded, publicStatsCacheTTL)
+		}
+	}
+
+	uptime := s.clock.Now().Sub(s.startedAt).Truncate(time.Hour)
+	stats.UptimeSeconds = int64(uptime.Seconds())
+	stats.CacheMaxAgeSeconds = int64(publicStatsCacheTTL.Seconds())
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRoundStat(t *testing.T) {
+	tests := map[int64]int64{0: 0, 7: 7, 99: 99, 123: 120, 4567: 4500, 1234567: 1200000}
+	for n, want := range tests {
+		if got := roundStat(n); got != want {
+			t.Errorf("roundStat(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestPublicStats(t *testing.T) {
+	ts := newTestService(t)
+	get := func() (int, PublicStats) {
+		w := ts.serve(ts.getPublicStats, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+		var stats PublicStats
+		json.Unmarshal(w.Body.Bytes(), &stats)
+		return w.Code, stats
+	}
+
+	if code, _ := get(); code != http.StatusNotFound {
+		t.Fatalf("disabled: got %d, want 404", code)
+	}
+
+	ts.config.PublicStatsEnabled = true
+	ts.saveTestFile(t, "one", "1", 24*time.Hour)
+	ts.saveTestFile(t, "two", "2", 24*time.Hour)
+	ts.store.AddBandwidthUsage([]BandwidthUsage{
+		{SubjectType: "ip", SubjectID: "192.0.2.1", Bytes: 12345},
+		{SubjectType: "key", SubjectID: "key-1", Bytes: 1000},
+		{SubjectType: "file", SubjectID: "one", Bytes: 13345},
+	})
+	ts.clock.Advance(3*time.Hour + 20*time.Minute)
+
+	code, stats := get()
+	if code != http.StatusOK {
+		t.Fatalf("enabled: got %d", code)
+	}
+	if stats.TotalFiles != 2 || stats.TotalBytesServed != 13000 || stats.UptimeSeconds != 3*3600 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Totals come from the cache until it expires
+	ts.saveTestFile(t, "three", "3", 24*time.Hour)
+	if _, stats := get(); stats.TotalFiles != 2 {
+		t.Errorf("cached total_files = %d, want 2", stats.TotalFiles)
+	}
+	ts.clock.Advance(publicStatsCacheTTL)
+	if _, stats := get(); stats.TotalFiles != 3 {
+		t.Errorf("total_files after the cache expired = %d, want 3", stats.TotalFiles)
+	}
+}
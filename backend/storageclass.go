@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/storage"
+)
+
+// StorageClass selects where and how an uploaded file is stored
+type StorageClass string
+
+const (
+	// StorageClassFastSSD stores files uncompressed on the fast-SSD directory so previews
+	// and range requests never need to decompress
+	StorageClassFastSSD StorageClass = "fast-ssd"
+	// StorageClassStandard keeps the size-based behavior: PostgreSQL, or disk for very large files
+	StorageClassStandard StorageClass = "standard"
+	// StorageClassArchive favors size over speed: strongest compression on the archive directory
+	StorageClassArchive StorageClass = "archive"
+)
+
+var storageClasses = []StorageClass{StorageClassFastSSD, StorageClassStandard, StorageClassArchive}
+
+// parseStorageClass validates a storage class name
+func parseStorageClass(name string) (StorageClass, bool) {
+	for _, class := range storageClasses {
+		if string(class) == name {
+			return class, true
+		}
+	}
+	return "", false
+}
+
+// parseStorageClassList parses a comma-separated list of storage classes, ignoring unknown names
+func parseStorageClassList(list string) []StorageClass {
+	var classes []StorageClass
+	for _, name := range strings.Split(list, ",") {
+		if class, ok := parseStorageClass(strings.TrimSpace(name)); ok {
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// storageClassDir returns the directory that holds disk-stored files of a class
+func (c *Config) storageClassDir(class StorageClass) string {
+	switch class {
+	case StorageClassFastSSD:
+		if c.FastSSDStorageDir != "" {
+			return c.FastSSDStorageDir
+		}
+	case StorageClassArchive:
+		if c.ArchiveStorageDir != "" {
+			return c.ArchiveStorageDir
+		}
+	}
+	return filepath.Join(c.TempDir, "files")
+}
+
+// storageDirs returns every directory disk-stored files may live in
+func (c *Config) storageDirs() []string {
+	dirs := []string{filepath.Join(c.TempDir, "files")}
+	for _, dir := range []string{c.FastSSDStorageDir, c.ArchiveStorageDir} {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// allowedStorageClasses returns the classes an uploader may request. API keys may be
+// limited to specific classes; anonymous uploads follow ANONYMOUS_STORAGE_CLASSES.
+func (s *FileService) allowedStorageClasses(apiKey *APIKeyStorage) []StorageClass {
+	if apiKey != nil {
+		if apiKey.StorageClasses == "" {
+			return storageClasses
+		}
+		return parseStorageClassList(apiKey.StorageClasses)
+	}
+	return parseStorageClassList(s.config.AnonymousStorageClasses)
+}
+
+// resolveStorageClass validates the requested storage class against the uploader's policy.
+// Without a request the default class is used, or the first allowed class if the default
+// isn't allowed for this uploader.
+func (s *FileService) resolveStorageClass(requested string, apiKey *APIKeyStorage) (StorageClass, error) {
+	allowed := s.allowedStorageClasses(apiKey)
+	isAllowed := func(class StorageClass) bool {
+		for _, candidate := range allowed {
+			if candidate == class {
+				return true
+			}
+		}
+		return false
+	}
+
+	if requested == "" {
+		class, ok := parseStorageClass(s.config.DefaultStorageClass)
+		if !ok {
+			class = StorageClassStandard
+		}
+		if !isAllowed(class) && len(allowed) > 0 {
+			class = allowed[0]
+		}
+		return class, nil
+	}
+
+	class, ok := parseStorageClass(requested)
+	if !ok {
+		return "", fmt.Errorf("unknown storage class %q", requested)
+	}
+	if !isAllowed(class) {
+		return "", fmt.Errorf("storage class %q is not allowed for this uploader", class)
+	}
+	return class, nil
+}
+
+// storageClassFromRequest resolves the storage class requested through the X-Storage-Class
+// header or the given value, writing an error response and returning false when it is refused
+func (s *FileService) storageClassFromRequest(c *gin.Context, requested string, apiKey *APIKeyStorage) (StorageClass, bool) {
+	if requested == "" {
+		requested = c.GetHeader("X-Storage-Class")
+	}
+
+	class, err := s.storageClassFor(requested, apiKey)
+	if err != nil {
+		err.respond(c)
+		return "", false
+	}
+	return class, true
+}
+
+// storageClassFor resolves a requested storage class, refusing it with 400 and the
+// classes the uploader may use
+func (s *FileService) storageClassFor(requested string, apiKey *APIKeyStorage) (StorageClass, *apiError) {
+	class, err := s.resolveStorageClass(requested, apiKey)
+	if err != nil {
+		return "", &apiError{status: http.StatusBadRequest, body: gin.H{
+			"error":           err.Error(),
+			"allowed_classes": s.allowedStorageClasses(apiKey),
+		}}
+	}
+	return class, nil
+}
+
+// requireStandardStorageClass refuses storage classes other than standard on upload paths
+// that always store content in PostgreSQL, writing an error response and returning false
+func requireStandardStorageClass(c *gin.Context, requested string) bool {
+	if requested == "" {
+		requested = c.GetHeader("X-Storage-Class")
+	}
+	if requested == "" || requested == string(StorageClassStandard) {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":           fmt.Sprintf("storage class %q is not supported by this endpoint", requested),
+		"allowed_classes": []StorageClass{StorageClassStandard},
+	})
+	return false
+}
+
+// compressionForClass adjusts the content-based compression choice for a storage class
+func compressionForClass(codec storage.Codec, class StorageClass, filename string, size int64) CompressionType {
+	compressionType := codec.SelectCompressionType(filename, size)
+	switch class {
+	case StorageClassFastSSD:
+		return CompressionNone
+	case StorageClassArchive:
+		// Use the strongest codec wherever the content is worth compressing at all
+		if compressionType != CompressionNone {
+			return CompressionZstd
+		}
+	}
+	return compressionType
+}
+
+// storeOnDisk reports whether a file of the given class and stored size goes to disk
+// rather than PostgreSQL
+func storeOnDisk(class StorageClass, size int64) bool {
+	return class == StorageClassFastSSD || class == StorageClassArchive || size > 1024*1024*1024
+}
+
+// storageClassPath returns the disk path for a file of a storage class, creating the
+// class directory if needed
+func storageClassPath(config *Config, class StorageClass, fileID string) (string, error) {
+	dir := config.storageClassDir(class)
+	if err := storage.RejectSymlinkDir(dir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return storage.SafeJoin(dir, fileID)
+}
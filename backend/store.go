@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// FileService and ChunkUploadManager depend on these interfaces rather than on
+// *Database, *redis.Client and time.Now directly, so handlers can be unit-tested with
+// in-memory fakes and a fixed clock.
+
+// RedisClient is the Redis API the services use. *redis.Client implements it.
+type RedisClient = redis.UniversalClient
+
+// ChunkStore persists chunked upload sessions and their processing jobs
+type ChunkStore interface {
+	SaveChunkUpload(upload *ChunkUploadStorage) error
+	GetChunkUpload(uploadID string) (*ChunkUploadStorage, error)
+	DeleteChunkUpload(uploadID string) error
+	ListActiveChunkUploads() ([]*ChunkUploadStorage, error)
+	SaveProcessingJob(job *ProcessingJobStorage) error
+	GetProcessingJob(jobID string) (*ProcessingJobStorage, error)
+	SaveFile(file *FileStorage) error
+	FileIDExists(fileID string) (bool, error)
+}
+
+// FileStore is everything FileService reads and writes in the primary database.
+// *Database implements it with PostgreSQL and *SQLiteStore with SQLite.
+type FileStore interface {
+	ChunkStore
+
+	GetFile(fileID string) (*FileStorage, error)
+	GetFileMetadata(fileID string) (*FileStorage, error)
+	ListActiveFiles(query FileListQuery) ([]*FileStorage, int, error)
+	FindFileByContentHash(contentHash string, size int64, apiKeyID *string, uploaderIP string) (*FileStorage, error)
+	CloneFile(sourceID string, file *FileStorage) error
+	DeleteFile(fileID string) error
+	TrashFile(fileID string, deletedAt time.Time) error
+	GetTrashedFile(fileID string) (*FileStorage, error)
+	GetTrashedFileContent(fileID string) ([]byte, error)
+	RestoreFile(fileID string) error
+	PurgeTrashedFiles(before time.Time) ([]string, error)
+	ClaimSlug(slug, fileID string) (bool, error)
+	GetFileIDBySlug(slug string) (string, error)
+	UpdateFileExpiration(fileID string, expiresAt time.Time) error
+	UpdateFileDownloadPassword(fileID string, newPassword string) error
+	UpdateFileDeletePassword(fileID string, newPassword string) error
+	UpdateFileScanResult(fileID string, result *ScanResult) error
+	UpdateFileName(fileID, filename string) error
+	UpdateFileAccessibility(fileID string, accessibility *Accessibility) error
+	ReplaceFileContent(file *FileStorage) error
+	SaveFileVersion(version *FileVersion) error
+	ListFileVersions(fileID string) ([]*FileVersion, error)
+	GetFileVersion(fileID string, version int) (*FileVersion, error)
+	DeleteExpiredFileVersions() ([]string, error)
+	UpdateFileMimeType(fileID, mimeType string) error
+	GetMimeTypeStats() ([]MimeTypeStats, error)
+	UpdateAppendedFile(fileID string, newSize int64, expiresAt time.Time) error
+	FinalizeAppendedFile(fileID string, expiresAt time.Time) error
+	DeleteExpiredDiskFiles() ([]string, error)
+	CleanupExpiredData() error
+
+	CreateAPIKey(key *APIKeyStorage) error
+	GetAPIKey(keyID string) (*APIKeyStorage, error)
+	GetAPIKeyByHash(keyHash string) (*APIKeyStorage, error)
+	GetAPIKeyByCertIdentity(identities []string) (*APIKeyStorage, error)
+	ListAPIKeys() ([]*APIKeyStorage, error)
+	UpdateAPIKey(key *APIKeyStorage) error
+	TouchAPIKey(keyID string) error
+	RevokeAPIKey(keyID string) error
+	GetAPIKeyUsage(keyID string) (int, int64, error)
+	GetUploaderIPUsage(ipAddress string) (int, int64, error)
+
+	CreateOrg(org *Org) error
+	GetOrg(orgID string) (*Org, error)
+	ListOrgs() ([]*Org, error)
+	UpdateOrg(org *Org) error
+	DeleteOrg(orgID string) error
+	GetOrgUsage(orgID string) (int, int64, error)
+	ListOrgFiles(orgID string, limit int) ([]*FileStorage, error)
+
+	LogFileAccess(fileID, accessType, ipAddress, userAgent string) error
+	GetFileAccessCounts(fileID string) (*FileAccessCounts, error)
+	GetFileAccessDaily(fileID string) ([]DailyFileAccesses, error)
+	ListFileAccesses(fileID string, limit int) ([]FileAccess, error)
+
+	AddFileEvent(fileID, eventType string, details interface{}, ipAddress string) error
+	ListFileEvents(after int64, eventTypes []string, limit int) ([]FileEvent, error)
+	ListOrgFileEvents(orgID string, after int64, eventTypes []string, limit int) ([]FileEvent, error)
+	ListAPIKeyFileEvents(keyID string, eventTypes []string, limit int) ([]FileEvent, error)
+	DeleteFileEventsBefore(cutoff time.Time) error
+
+	AddBandwidthUsage(usage []BandwidthUsage) error
+	DeleteUsageBefore(cutoff, ipCutoff time.Time) error
+	GetBandwidthUsage(period time.Time, subjectType string, limit int) (int64, []BandwidthUsage, error)
+	GetFileBandwidth(fileID string) ([]MonthlyBandwidth, error)
+	GetServiceStats() (*ServiceStats, error)
+	GetEgressByClass(period time.Time) ([]ClassUsage, error)
+	GetStoredBytesByClass() ([]ClassUsage, error)
+	AddUsageRecords(records []UsageRecord) error
+	GetStoredBytesByAPIKey() (map[string]int64, error)
+	GetUsageRollup(period time.Time, groupBy string) ([]UsageRollup, error)
+	ListDeadLetterJobs(limit int) ([]*ProcessingJobStorage, error)
+
+	SeedReplicationLog() (int64, error)
+	GetReplicationChanges(limit int) ([]ReplicationChange, error)
+	AckReplicationChanges(lastID int64) error
+	ClearReplicationLog() error
+	GetReplicationBacklog() (int64, *time.Time, error)
+	GetFileForReplication(fileID string) (*FileStorage, error)
+}
+
+// Clock tells the time. Expiry, retention and session timeouts read it instead of
+// calling time.Now so tests can move time forward.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FileStoreBackend is a FileStore the service can be started on
+type FileStoreBackend interface {
+	FileStore
+	EnsureSchema() error
+	Close()
+}
+
+// openFileStore connects to the database selected by DATABASE_DRIVER: PostgreSQL, or
+// SQLite for the embedded mode
+func openFileStore(config *Config) (FileStoreBackend, error) {
+	switch config.DatabaseDriver {
+	case "", "postgres":
+		database, err := NewDatabase(config)
+		if err != nil {
+			return nil, err
+		}
+		return database, nil
+	case "sqlite":
+		store, err := NewSQLiteStore(config)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown DATABASE_DRIVER %q, expected postgres or sqlite", config.DatabaseDriver)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamWriteChunk is the most written to the client under one write deadline
+const streamWriteChunk = 256 * 1024
+
+// streamWriter sends a long response body to the client. Writes block while the client's
+// TCP window is full, so a fast disk can't run ahead of a slow client; each chunk gets its
+// own write deadline, so a client that stops reading is dropped instead of pinning the
+// goroutine and its buffers. Data is flushed at most every flush interval, so players get
+// the first bytes before a proxy or the server's own buffer fills up.
+type streamWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	interval   time.Duration
+	timeout    time.Duration
+	lastFlush  time.Time
+	// deadlines is false once the writer turned out not to support write deadlines
+	deadlines bool
+}
+
+// newStreamWriter prepares c's response for streaming. Media responses use the shorter
+// MEDIA_FLUSH_INTERVAL so playback starts sooner.
+func (s *FileService) newStreamWriter(c *gin.Context, media bool) *streamWriter {
+	interval := s.config.StreamFlushInterval
+	if media {
+		interval = s.config.MediaFlushInterval
+	}
+	// Ask nginx and similar proxies not to buffer the whole body
+	c.Header("X-Accel-Buffering", "no")
+	return &streamWriter{
+		w:          c.Writer,
+		controller: http.NewResponseController(c.Writer),
+		interval:   interval,
+		timeout:    s.config.StreamWriteTimeout,
+		lastFlush:  time.Now(),
+		deadlines:  s.config.StreamWriteTimeout > 0,
+	}
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > streamWriteChunk {
+			chunk = chunk[:streamWriteChunk]
+		}
+
+		if sw.deadlines {
+			if err := sw.controller.SetWriteDeadline(time.Now().Add(sw.timeout)); err != nil {
+				if !errors.Is(err, http.ErrNotSupported) {
+					return written, err
+				}
+				sw.deadlines = false
+			}
+		}
+		n, err := sw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+
+		if time.Since(sw.lastFlush) >= sw.interval {
+			if err := sw.Flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Flush sends buffered data to the client
+func (sw *streamWriter) Flush() error {
+	sw.lastFlush = time.Now()
+	if err := sw.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// Close flushes what is left and clears the write deadline, so the connection can be
+// reused for keep-alive requests
+func (sw *streamWriter) Close() error {
+	err := sw.Flush()
+	if sw.deadlines {
+		sw.controller.SetWriteDeadline(time.Time{})
+	}
+	return err
+}
+
+// streamTo copies r to the client through a stream writer, using buffer for reads
+func (s *FileService) streamTo(c *gin.Context, r io.Reader, buffer []byte, media bool) (int64, error) {
+	sw := s.newStreamWriter(c, media)
+	defer sw.Close()
+	// Hide WriterTo so reads go through buffer instead of one write of the whole source
+	return io.CopyBuffer(sw, struct{ io.Reader }{r}, buffer)
+}
+
+// streamBytes writes data to the client through a stream writer
+func (s *FileService) streamBytes(c *gin.Context, data []byte, media bool) error {
+	sw := s.newStreamWriter(c, media)
+	defer sw.Close()
+	_, err := sw.Write(data)
+	return err
+}
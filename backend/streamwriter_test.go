@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deadlineRecorder records the write deadlines and flushes a stream writer asks for
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+	flushes   int
+}
+
+func (r *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	r.deadlines = append(r.deadlines, deadline)
+	return nil
+}
+
+func (r *deadlineRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func newStreamTestContext(t *testing.T, flushInterval time.Duration) (*FileService, *gin.Context, *deadlineRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(recorder)
+	config := &Config{
+		StreamFlushInterval: flushInterval,
+		MediaFlushInterval:  flushInterval,
+		StreamWriteTimeout:  30 * time.Second,
+	}
+	return &FileService{config: config}, c, recorder
+}
+
+func TestStreamToChunksWritesUnderDeadlines(t *testing.T) {
+	s, c, recorder := newStreamTestContext(t, 0)
+	data := bytes.Repeat([]byte("x"), 2*streamWriteChunk+10)
+
+	n, err := s.streamTo(c, bytes.NewReader(data), make([]byte, 4*streamWriteChunk), true)
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("streamTo = %d, %v; want %d, nil", n, err, len(data))
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), data) {
+		t.Fatal("body differs from source")
+	}
+
+	// One deadline per chunk, then the deadline is cleared for keep-alive
+	if len(recorder.deadlines) != 4 {
+		t.Fatalf("got %d deadline calls, want 4", len(recorder.deadlines))
+	}
+	for _, deadline := range recorder.deadlines[:3] {
+		if deadline.IsZero() {
+			t.Error("chunk written without a deadline")
+		}
+	}
+	if !recorder.deadlines[3].IsZero() {
+		t.Error("deadline not cleared after the stream")
+	}
+	// A zero interval flushes after every chunk, plus once on close
+	if recorder.flushes != 4 {
+		t.Errorf("got %d flushes, want 4", recorder.flushes)
+	}
+	if c.Writer.Header().Get("X-Accel-Buffering") != "no" {
+		t.Error("proxy buffering not disabled")
+	}
+}
+
+func TestStreamWriterFlushInterval(t *testing.T) {
+	s, c, recorder := newStreamTestContext(t, time.Hour)
+
+	if err := s.streamBytes(c, bytes.Repeat([]byte("x"), 3*streamWriteChunk), false); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is due within the interval, so only the final flush happens
+	if recorder.flushes != 1 {
+		t.Errorf("got %d flushes, want 1", recorder.flushes)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The table preview parses CSV and TSV files into rows a page at a time. Like the text
+// preview it streams uncompressed files from disk and stops reading after the page.
+
+const (
+	defaultTableRows = 100
+	maxTableRows     = 1000
+	// maxTableCellBytes cuts long cells so one page stays small
+	maxTableCellBytes = 1024
+	// tableSniffSize is how much of the file the delimiter is guessed from
+	tableSniffSize = 64 * 1024
+	// tableSniffRows is how many records header detection looks at
+	tableSniffRows = 20
+)
+
+// tableDelimiters are the delimiters sniffDelimiter chooses from, most likely first
+var tableDelimiters = []byte{',', '\t', ';', '|'}
+
+func isTableFile(mimeType, filename string) bool {
+	switch mimeType {
+	case "text/csv", "application/csv", "text/tab-separated-values":
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".tsv", ".tab":
+		return true
+	}
+	return false
+}
+
+// countOutsideQuotes counts delim in line, ignoring occurrences inside double quotes
+func countOutsideQuotes(line []byte, delim byte) int {
+	count := 0
+	quoted := false
+	for _, b := range line {
+		switch {
+		case b == '"':
+			quoted = !quoted
+		case b == delim && !quoted:
+			count++
+		}
+	}
+	return count
+}
+
+// sniffDelimiter guesses the delimiter of a CSV sample. A delimiter that appears the same
+// number of times on every line wins over one that doesn't; among equals, the one that
+// splits lines into more fields wins.
+func sniffDelimiter(sample []byte, filename string) byte {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".tsv" || ext == ".tab" {
+		return '\t'
+	}
+
+	lines := bytes.Split(sample, []byte("\n"))
+	if len(lines) > 1 && len(sample) == tableSniffSize {
+		// The last line was probably cut by the sample size
+		lines = lines[:len(lines)-1]
+	}
+	var nonEmpty [][]byte
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) > 0 {
+			nonEmpty = append(nonEmpty, line)
+		}
+		if len(nonEmpty) == tableSniffRows {
+			break
+		}
+	}
+
+	best, bestConsistent, bestCount := byte(','), false, 0
+	for _, delim := range tableDelimiters {
+		consistent := true
+		minCount := -1
+		for i, line := range nonEmpty {
+			count := countOutsideQuotes(line, delim)
+			if i > 0 && count != minCount {
+				consistent = false
+			}
+			if minCount < 0 || count < minCount {
+				minCount = count
+			}
+		}
+		if minCount <= 0 {
+			continue
+		}
+		if (consistent && !bestConsistent) || (consistent == bestConsistent && minCount > bestCount) {
+			best, bestConsistent, bestCount = delim, consistent, minCount
+		}
+	}
+	return best
+}
+
+func isNumericCell(cell string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+	return err == nil
+}
+
+// detectHeader guesses whether the first record is a header. It has to be made of
+// distinct, non-empty, non-numeric names, and at least one column has to look different
+// below it: numbers under a name, or values of one fixed length under a name of another.
+func detectHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return false
+	}
+	first := records[0]
+	seen := make(map[string]bool, len(first))
+	for _, cell := range first {
+		name := strings.TrimSpace(cell)
+		if name == "" || seen[name] || isNumericCell(name) {
+			return false
+		}
+		seen[name] = true
+	}
+
+	for column, name := range first {
+		numeric, length := true, -1
+		for _, record := range records[1:] {
+			if column >= len(record) {
+				numeric, length = false, -2
+				break
+			}
+			if !isNumericCell(record[column]) {
+				numeric = false
+			}
+			switch {
+			case length == -1:
+				length = len(record[column])
+			case length != len(record[column]):
+				length = -2
+			}
+		}
+		if numeric || (length >= 0 && length != len(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateCells cuts cells to maxTableCellBytes on a UTF-8 boundary and reports whether
+// any were cut
+func truncateCells(record []string) bool {
+	truncated := false
+	for i, cell := range record {
+		if len(cell) <= maxTableCellBytes {
+			continue
+		}
+		cut := maxTableCellBytes
+		for cut > 0 && !utf8RuneStartsComplete([]byte(cell[:cut])) {
+			cut--
+		}
+		record[i] = cell[:cut]
+		truncated = true
+	}
+	return truncated
+}
+
+// getTablePreview returns rows offset..offset+limit-1 of a CSV or TSV file, counted after
+// the header. The delimiter and header are detected unless ?delimiter= or ?header= is given.
+//
+// @summary Preview rows of a CSV or TSV file
+// @tags preview
+// @path id File ID
+// @query offset integer First row after the header
+// @query limit integer Number of rows
+// @query delimiter string Field delimiter
+// @query header string true or false, whether the first row is a header
+// @success 200 json
+// @auth downloadPassword adminToken optional
+func (s *FileService) getTablePreview(c *gin.Context) {
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be zero or a positive number"})
+			return
+		}
+		offset = n
+	}
+	limit := defaultTableRows
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTableRows {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    "limit must be between 1 and the maximum",
+				"max_rows": maxTableRows,
+			})
+			return
+		}
+		limit = n
+	}
+
+	var delimiter byte
+	switch value := c.Query("delimiter"); value {
+	case "":
+	case "tab", "\t":
+		delimiter = '\t'
+	default:
+		if len(value) != 1 || value == "\"" || value == "\n" || value == "\r" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "delimiter must be a single character or \"tab\""})
+			return
+		}
+		delimiter = value[0]
+	}
+	headerParam := c.Query("header")
+	if headerParam != "" && headerParam != "true" && headerParam != "false" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "header must be true or false"})
+		return
+	}
+
+	fileStorage, err := s.lookupFile(c.Param("id"), false)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+	if !requireScanCleared(c, fileStorage) {
+		return
+	}
+
+	if !isTableFile(fileStorage.MimeType, fileStorage.Filename) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":     "Not a CSV or TSV file",
+			"mime_type": fileStorage.MimeType,
+		})
+		return
+	}
+
+	if CompressionType(fileStorage.CompressionType) != CompressionNone && fileStorage.OriginalSize > maxRenderSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large to preview",
+			"max_size": maxRenderSize,
+		})
+		return
+	}
+
+	content, err := s.openTextContent(fileStorage)
+	if err != nil {
+		log.Printf("Failed to open %s for table preview: %v", fileStorage.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer content.Close()
+
+	reader := bufio.NewReaderSize(content, tableSniffSize)
+	if bom, _ := reader.Peek(3); bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		reader.Discard(3)
+	}
+	if delimiter == 0 {
+		sample, _ := reader.Peek(tableSniffSize)
+		delimiter = sniffDelimiter(sample, fileStorage.Filename)
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma = rune(delimiter)
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+
+	// Records are read ahead for header detection, then replayed
+	var buffered [][]string
+	var readErr error
+	for len(buffered) < tableSniffRows {
+		record, err := csvReader.Read()
+		if err != nil {
+			readErr = err
+			break
+		}
+		buffered = append(buffered, record)
+	}
+	next := func() ([]string, error) {
+		if len(buffered) > 0 {
+			record := buffered[0]
+			buffered = buffered[1:]
+			return record, nil
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		return csvReader.Read()
+	}
+
+	hasHeader := headerParam == "true" || (headerParam == "" && detectHeader(buffered))
+	var columns []string
+	if hasHeader && len(buffered) > 0 {
+		columns, _ = next()
+		truncateCells(columns)
+	}
+
+	var (
+		rows          = make([][]string, 0, min(limit, tableSniffRows))
+		truncatedRows []int
+		hasMore       bool
+		totalRows     = -1
+	)
+	for index := 0; ; index++ {
+		record, err := next()
+		if err == io.EOF {
+			totalRows = index
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":   "Failed to parse file",
+					"message": parseErr.Error(),
+					"line":    parseErr.Line,
+				})
+				return
+			}
+			log.Printf("Failed to read %s for table preview: %v", fileStorage.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return
+		}
+		if index < offset {
+			continue
+		}
+		if index >= offset+limit {
+			hasMore = true
+			break
+		}
+		if truncateCells(record) {
+			truncatedRows = append(truncatedRows, index)
+		}
+		rows = append(rows, record)
+	}
+
+	response := gin.H{
+		"file_id":    fileStorage.ID,
+		"filename":   fileStorage.Filename,
+		"delimiter":  string(delimiter),
+		"has_header": hasHeader,
+		"columns":    columns,
+		"offset":     offset,
+		"limit":      limit,
+		"rows":       rows,
+		"has_more":   hasMore,
+	}
+	if hasMore {
+		response["next_offset"] = offset + len(rows)
+	}
+	if totalRows >= 0 {
+		response["total_rows"] = totalRows
+	}
+	if len(truncatedRows) > 0 {
+		response["truncated_rows"] = truncatedRows
+		response["max_cell_bytes"] = maxTableCellBytes
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSniffDelimiter(t *testing.T) {
+	cases := []struct {
+		name, filename, sample string
+		want                   byte
+	}{
+		{"comma", "data.csv", "name,age\nalice,30\nbob,41\n", ','},
+		{"semicolon", "data.csv", "name;price\nwidget;1,50\ngadget;2,75\n", ';'},
+		{"tab", "data.csv", "name\tage\nalice\t30\n", '\t'},
+		{"pipe", "data.txt", "a|b|c\n1|2|3\n", '|'},
+		{"quoted commas", "data.csv", "\"last, first\";city\n\"doe, jane\";paris\n", ';'},
+		{"tsv extension", "data.tsv", "a,b,c\n1,2,3\n", '\t'},
+		{"single column", "data.csv", "name\nalice\nbob\n", ','},
+		{"empty", "data.csv", "", ','},
+	}
+	for _, tc := range cases {
+		if got := sniffDelimiter([]byte(tc.sample), tc.filename); got != tc.want {
+			t.Errorf("%s: sniffDelimiter = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDetectHeader(t *testing.T) {
+	cases := []struct {
+		name    string
+		records [][]string
+		want    bool
+	}{
+		{"numeric column", [][]string{{"name", "age"}, {"alice", "30"}, {"bob", "41"}}, true},
+		{"fixed length codes", [][]string{{"country", "name"}, {"JP", "Japan"}, {"FR", "France"}}, true},
+		{"all data", [][]string{{"alice", "30"}, {"bob", "41"}}, false},
+		{"numeric first row", [][]string{{"2023", "10"}, {"2024", "12"}}, false},
+		{"duplicate names", [][]string{{"x", "x"}, {"1", "2"}}, false},
+		{"empty name", [][]string{{"name", ""}, {"alice", "30"}}, false},
+		{"one record", [][]string{{"name", "age"}}, false},
+		{"indistinguishable", [][]string{{"alpha", "beta"}, {"gamma", "delta"}, {"ab", "c"}}, false},
+	}
+	for _, tc := range cases {
+		if got := detectHeader(tc.records); got != tc.want {
+			t.Errorf("%s: detectHeader = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTruncateCells(t *testing.T) {
+	long := strings.Repeat("あ", maxTableCellBytes)
+	record := []string{"short", long}
+	if !truncateCells(record) {
+		t.Fatal("long cell was not truncated")
+	}
+	if record[0] != "short" {
+		t.Errorf("short cell changed to %q", record[0])
+	}
+	if len(record[1]) > maxTableCellBytes || !strings.HasPrefix(long, record[1]) || len(record[1])%3 != 0 {
+		t.Errorf("cell cut to %d bytes, not on a character boundary", len(record[1]))
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tailFile streams bytes appended to an append-mode file as Server-Sent Events.
+// Each "data" event carries a JSON object with the byte offset and the new text, or the
+// bytes base64-encoded with "encoding": "base64" when they aren't valid UTF-8; a final
+// "finalized" event is sent once the uploader finalizes the file.
+//
+// @summary Follow an append-mode file
+// @tags append
+// @path id File ID
+// @query from string end to start at the current end of the file
+// @query offset integer Byte offset to start at
+// @success 200 text/event-stream Server-Sent Events
+// @auth downloadPassword adminToken optional
+func (s *FileService) tailFile(c *gin.Context) {
+	fileID := c.Param("id")
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	// Check download password if required (bypass for admin)
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+
+	if fileStorage.AppendState == nil || fileStorage.StoragePath == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File was not uploaded in append mode"})
+		return
+	}
+
+	// Start from the requested offset, or from the end when ?from=end
+	var offset int64
+	if c.Query("from") == "end" {
+		offset = fileStorage.OriginalSize
+	} else if offsetStr := c.Query("offset"); offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset parameter"})
+			return
+		}
+	}
+
+	diskFile, err := openStoredFile(s.config, *fileStorage.StoragePath, os.O_RDONLY)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file on disk"})
+		return
+	}
+	defer diskFile.Close()
+
+	// Subscribe before reading so appends between the read and the wait are not missed
+	ctx := c.Request.Context()
+	pubsub := s.redis.Subscribe(context.Background(), "append:"+fileID)
+	defer pubsub.Close()
+	notifications := pubsub.Channel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering for live updates
+	c.Status(http.StatusOK)
+
+	finalized := *fileStorage.AppendState == AppendStateFinalized
+	buffer := make([]byte, 64*1024) // 64KB per event
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+	// Fallbacks in case a notification is lost: new data is picked up from disk, and
+	// finalization is checked in the database only occasionally
+	poll := time.NewTicker(2 * time.Second)
+	defer poll.Stop()
+	stateCheck := time.NewTicker(time.Minute)
+	defer stateCheck.Stop()
+
+	for {
+		// Send everything written since the last offset
+		for {
+			n, err := diskFile.ReadAt(buffer, offset)
+			if err != nil && err != io.EOF {
+				log.Printf("Error reading appended file %s: %v", fileID, err)
+				return
+			}
+
+			// Hold back a rune split across appends until the rest of it arrives
+			chunk := buffer[:n]
+			if !finalized {
+				chunk = chunk[:completeUTF8Prefix(chunk)]
+			}
+			if len(chunk) > 0 {
+				c.SSEvent("data", tailEvent(offset, chunk))
+				offset += int64(len(chunk))
+			}
+			if err == io.EOF || n < len(buffer) {
+				break
+			}
+		}
+		c.Writer.Flush()
+
+		if finalized {
+			c.SSEvent("finalized", gin.H{"size": offset})
+			c.Writer.Flush()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if msg.Payload != "" && containsFinalizedEvent(msg.Payload) {
+				finalized = true
+			}
+		case <-poll.C:
+		case <-stateCheck.C:
+			current, err := s.db.GetFileMetadata(fileID)
+			if err != nil || current == nil {
+				return
+			}
+			if current.AppendState != nil && *current.AppendState == AppendStateFinalized {
+				finalized = true
+			}
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+// tailEvent builds the payload of a "data" event, base64-encoding binary content
+func tailEvent(offset int64, chunk []byte) gin.H {
+	if utf8.Valid(chunk) {
+		return gin.H{"offset": offset, "data": string(chunk)}
+	}
+	return gin.H{"offset": offset, "data": base64.StdEncoding.EncodeToString(chunk), "encoding": "base64"}
+}
+
+// completeUTF8Prefix returns the length of b without a trailing incomplete UTF-8 sequence
+func completeUTF8Prefix(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
+
+// containsFinalizedEvent reports whether a published append notification marks finalization
+func containsFinalizedEvent(payload string) bool {
+	var event struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return false
+	}
+	return event.Event == "finalized"
+}
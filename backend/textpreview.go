@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/highlight"
+)
+
+// The text preview returns a window of lines instead of the whole file, so large logs and
+// sources open instantly. Uncompressed files on disk are read only up to the end of the
+// window; compressed content has to be decompressed in memory first.
+
+const (
+	defaultTextPreviewLines = 200
+	maxTextPreviewLines     = 2000
+	// maxTextPreviewLineBytes cuts minified or binary-ish lines down to a displayable size
+	maxTextPreviewLineBytes = 4096
+)
+
+// textMimeTypes are non-text/* types that are still readable as text
+var textMimeTypes = map[string]bool{
+	"application/json":         true,
+	"application/xml":          true,
+	"application/javascript":   true,
+	"application/x-ipynb+json": true,
+	"application/geo+json":     true,
+	"application/x-sh":         true,
+	"application/x-yaml":       true,
+	"application/yaml":         true,
+	"application/toml":         true,
+	"application/sql":          true,
+	"model/gltf+json":          true,
+	"model/obj":                true,
+}
+
+func isTextFile(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || textMimeTypes[mimeType]
+}
+
+// openTextContent returns a reader over a file's decompressed content
+func (s *FileService) openTextContent(fileStorage *FileStorage) (io.ReadCloser, error) {
+	compression := CompressionType(fileStorage.CompressionType)
+	if fileStorage.StorageType == "disk" && fileStorage.StoragePath != nil && compression == CompressionNone {
+		return openStoredFile(s.config, *fileStorage.StoragePath, os.O_RDONLY)
+	}
+
+	if fileStorage.StorageType != "disk" && fileStorage.FileContent == nil {
+		withContent, err := s.lookupFile(fileStorage.ID, true)
+		if err != nil {
+			return nil, err
+		}
+		if withContent == nil {
+			return nil, os.ErrNotExist
+		}
+		fileStorage = withContent
+	}
+	content, err := s.loadFileContent(fileStorage, FileMetadata{Compression: compression})
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// readTextLine reads one line without its line ending, keeping at most
+// maxTextPreviewLineBytes of it. It returns io.EOF only when no line was left.
+func readTextLine(reader *bufio.Reader) (line string, truncated bool, err error) {
+	var buf []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if room := maxTextPreviewLineBytes - len(buf); room > 0 {
+			if len(chunk) > room {
+				buf = append(buf, chunk[:room]...)
+				truncated = true
+			} else {
+				buf = append(buf, chunk...)
+			}
+		} else if len(chunk) > 0 {
+			truncated = true
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(buf) > 0 {
+			err = nil
+		}
+		if truncated {
+			// Don't leave half a UTF-8 sequence at the cut
+			for len(buf) > 0 && !utf8RuneStartsComplete(buf) {
+				buf = buf[:len(buf)-1]
+			}
+		}
+		line = strings.TrimRight(string(buf), "\r\n")
+		return strings.ToValidUTF8(line, "�"), truncated, err
+	}
+}
+
+// utf8RuneStartsComplete reports whether buf doesn't end inside a UTF-8 sequence
+func utf8RuneStartsComplete(buf []byte) bool {
+	for i := len(buf) - 1; i >= 0 && i >= len(buf)-4; i-- {
+		b := buf[i]
+		if b < 0x80 {
+			return true
+		}
+		if b >= 0xC0 {
+			size := 2
+			if b >= 0xF0 {
+				size = 4
+			} else if b >= 0xE0 {
+				size = 3
+			}
+			return len(buf)-i >= size
+		}
+	}
+	return true
+}
+
+// getTextPreview returns lines from..from+lines-1 (1-based) of a text file with its
+// detected language, and with ?highlight=true syntax highlighting tokens for each line
+//
+// @summary Preview lines of a text file
+// @tags preview
+// @path id File ID
+// @query from integer First line, from 1
+// @query lines integer Number of lines
+// @query highlight boolean Include syntax highlighting tokens
+// @success 200 json
+// @auth downloadPassword adminToken optional
+func (s *FileService) getTextPreview(c *gin.Context) {
+	from := 1
+	if value := c.Query("from"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a positive line number"})
+			return
+		}
+		from = n
+	}
+	count := defaultTextPreviewLines
+	if value := c.Query("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTextPreviewLines {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":     "lines must be between 1 and the maximum",
+				"max_lines": maxTextPreviewLines,
+			})
+			return
+		}
+		count = n
+	}
+	withTokens := c.Query("highlight") == "true"
+
+	fileStorage, err := s.lookupFile(c.Param("id"), false)
+	if err != nil {
+		log.Printf("Failed to get file from database: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+	if !requireScanCleared(c, fileStorage) {
+		return
+	}
+
+	if !isTextFile(fileStorage.MimeType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":     "Not a text file",
+			"mime_type": fileStorage.MimeType,
+		})
+		return
+	}
+
+	if CompressionType(fileStorage.CompressionType) != CompressionNone && fileStorage.OriginalSize > maxRenderSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large to preview",
+			"max_size": maxRenderSize,
+		})
+		return
+	}
+
+	content, err := s.openTextContent(fileStorage)
+	if err != nil {
+		log.Printf("Failed to open %s for text preview: %v", fileStorage.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer content.Close()
+	reader := bufio.NewReader(content)
+
+	var (
+		language       string
+		highlighter    *highlight.Highlighter
+		lines          = make([]string, 0, count)
+		tokens         [][]highlight.Token
+		truncatedLines []int
+		hasMore        bool
+	)
+	for lineNumber := 1; ; lineNumber++ {
+		line, truncated, err := readTextLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Failed to read %s for text preview: %v", fileStorage.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return
+		}
+
+		if lineNumber == 1 {
+			language = highlight.Detect(fileStorage.Filename, line)
+			if withTokens {
+				highlighter = highlight.New(language)
+			}
+		}
+		if lineNumber >= from+count {
+			hasMore = true
+			break
+		}
+
+		// Lines before the window are still tokenized so comments and strings opened
+		// there are highlighted correctly inside it
+		var lineTokens []highlight.Token
+		if highlighter != nil {
+			lineTokens = highlighter.Line(line)
+		}
+		if lineNumber < from {
+			continue
+		}
+
+		lines = append(lines, line)
+		if highlighter != nil {
+			tokens = append(tokens, lineTokens)
+		}
+		if truncated {
+			truncatedLines = append(truncatedLines, lineNumber)
+		}
+	}
+	if language == "" {
+		language = highlight.Detect(fileStorage.Filename, "")
+	}
+
+	response := gin.H{
+		"file_id":  fileStorage.ID,
+		"filename": fileStorage.Filename,
+		"language": language,
+		"from":     from,
+		"lines":    lines,
+		"has_more": hasMore,
+	}
+	if hasMore {
+		response["next_from"] = from + len(lines)
+	}
+	if withTokens {
+		response["tokens"] = tokens
+	}
+	if len(truncatedLines) > 0 {
+		response["truncated_lines"] = truncatedLines
+		response["max_line_bytes"] = maxTextPreviewLineBytes
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deleting a file moves it to the trash for TRASH_RETENTION instead of removing it, so an
+// accidental deletion of a large upload can be undone. Trashed files are hidden from
+// downloads, listings and deduplication as if they were gone, but still count toward
+// quotas. The cleanup job purges them once the retention is over; a file that expires
+// while in the trash is removed like any other expired file.
+
+// restorableUntil is when a file moved to the trash at deletedAt is purged, or expires
+// if that comes first
+func (s *FileService) restorableUntil(fileStorage *FileStorage, deletedAt time.Time) time.Time {
+	until := deletedAt.Add(s.config.TrashRetention)
+	if fileStorage.ExpiresAt.Before(until) {
+		return fileStorage.ExpiresAt
+	}
+	return until
+}
+
+// trashFile moves a deleted file to the trash, returning until when it can be restored
+func (s *FileService) trashFile(fileStorage *FileStorage, ipAddress string) (time.Time, *apiError) {
+	fileID := fileStorage.ID
+	now := s.clock.Now()
+	if err := s.db.TrashFile(fileID, now); err != nil {
+		log.Printf("Failed to move %s to trash: %v", fileID, err)
+		return time.Time{}, newAPIError(http.StatusInternalServerError, "Failed to delete file from database")
+	}
+
+	s.redis.Del(context.Background(), "file:"+fileID)
+	s.metadataQueue.Discard(fileID)
+
+	until := s.restorableUntil(fileStorage, now)
+	s.recordFileEvent(fileID, FileEventTrashed, gin.H{"restorable_until": until}, ipAddress)
+	return until, nil
+}
+
+// fileDeletedMessage confirms the deletion of a file
+const fileDeletedMessage = "File deleted successfully"
+
+// deletedResponse is the answer to the deletion of a file, telling how to restore it when
+// it went to the trash
+func deletedResponse(fileID string, restorableUntil *time.Time) gin.H {
+	response := gin.H{"message": fileDeletedMessage}
+	if restorableUntil != nil {
+		response["restorable_until"] = *restorableUntil
+		response["restore_url"] = "/api/file/" + fileID + "/restore"
+	}
+	return response
+}
+
+// restoreFile takes a deleted file out of the trash. Like deletion, it takes the delete
+// password, an API key that may manage the file, or an admin token.
+//
+// @summary Restore a deleted file
+// @tags file
+// @path id File ID
+// @success 200 json
+// @auth deletePassword apiKey adminToken
+func (s *FileService) restoreFile(c *gin.Context) {
+	fileID := c.Param("id")
+	fileStorage, err := s.db.GetTrashedFile(fileID)
+	if err != nil {
+		log.Printf("Failed to get trashed file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	// Files past the trash retention are gone even before the cleanup job purges them
+	if fileStorage == nil || !s.clock.Now().Before(s.restorableUntil(fileStorage, *fileStorage.DeletedAt)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found in trash"})
+		return
+	}
+
+	adminToken := adminTokenFrom(c)
+	isAdminAccess := adminToken != "" && s.adminTokens.ValidToken(adminToken)
+	if !isAdminAccess && !s.isFileOwner(c, fileStorage) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid delete password",
+			"message": "The provided delete password is incorrect.",
+		})
+		return
+	}
+
+	// A file awaiting its verdict stays deleted; infected files are purged when their
+	// verdict arrives. Skipped and failed scans were served before deletion, so they restore.
+	if result := fileStorage.ScanResult; result != nil && (result.Status == ScanStatusPending || result.Status == ScanStatusInfected) {
+		if result.Status == ScanStatusPending {
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfterScanPending)))
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       "File can't be restored",
+			"message":     "The file hasn't been cleared by the virus scanner.",
+			"scan_status": result.Status,
+		})
+		return
+	}
+
+	if err := s.db.RestoreFile(fileID); err != nil {
+		log.Printf("Failed to restore %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore file"})
+		return
+	}
+	s.recordFileEvent(fileID, FileEventRestored, nil, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "File restored successfully",
+		"file_id":    fileID,
+		"expires_at": fileStorage.ExpiresAt,
+	})
+}
+
+// purgeTrashedFiles removes the files that have been in the trash for TRASH_RETENTION,
+// or every trashed file once the trash is disabled
+func (s *FileService) purgeTrashedFiles() error {
+	paths, err := s.db.PurgeTrashedFiles(s.clock.Now().Add(-s.config.TrashRetention))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := removeStoredFile(s.config, path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete trashed file %s from disk: %v", path, err)
+		}
+	}
+	return nil
+}
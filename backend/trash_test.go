@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTrashAndRestore(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.TrashRetention = 24 * time.Hour
+	ts.saveTestFile(t, "render", "frames", 7*24*time.Hour)
+	param := gin.Param{Key: "id", Value: "render"}
+	restore := func(password string) *httptest.ResponseRecorder {
+		return ts.serve(ts.restoreFile, httptest.NewRequest(http.MethodPost, "/api/file/render/restore?delete_password="+password, nil), param)
+	}
+
+	w := ts.serve(ts.deleteFile, httptest.NewRequest(http.MethodDelete, "/api/file/render?delete_password=delete-me", nil), param)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+	if file, _ := ts.store.GetFileMetadata("render"); file != nil {
+		t.Fatal("trashed file still visible")
+	}
+	if w := ts.serve(ts.getFile, httptest.NewRequest(http.MethodGet, "/api/file/render", nil), param); w.Code != http.StatusNotFound {
+		t.Fatalf("download of trashed file: got %d, want 404", w.Code)
+	}
+
+	if w := restore("wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: got %d, want 401", w.Code)
+	}
+	if w := restore("delete-me"); w.Code != http.StatusOK {
+		t.Fatalf("restore: got %d: %s", w.Code, w.Body.String())
+	}
+	if w := ts.serve(ts.getFile, httptest.NewRequest(http.MethodGet, "/api/file/render", nil), param); w.Code != http.StatusOK || w.Body.String() != "frames" {
+		t.Fatalf("download after restore: got %d %q", w.Code, w.Body.String())
+	}
+	if w := restore("delete-me"); w.Code != http.StatusNotFound {
+		t.Fatalf("restore of a file not in the trash: got %d, want 404", w.Code)
+	}
+
+	var events []string
+	for _, event := range ts.store.events {
+		events = append(events, event.Type)
+	}
+	if len(events) != 2 || events[0] != FileEventTrashed || events[1] != FileEventRestored {
+		t.Errorf("events = %v", events)
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.TrashRetention = 24 * time.Hour
+	ts.saveTestFile(t, "render", "frames", 7*24*time.Hour)
+	param := gin.Param{Key: "id", Value: "render"}
+
+	ts.serve(ts.deleteFile, httptest.NewRequest(http.MethodDelete, "/api/file/render?delete_password=delete-me", nil), param)
+	ts.clock.Advance(23 * time.Hour)
+	if err := ts.purgeTrashedFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ts.store.files["render"]; !ok {
+		t.Fatal("purged before the trash retention")
+	}
+
+	ts.clock.Advance(time.Hour + time.Minute)
+	w := ts.serve(ts.restoreFile, httptest.NewRequest(http.MethodPost, "/api/file/render/restore?delete_password=delete-me", nil), param)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("restore after the retention: got %d, want 404", w.Code)
+	}
+	if err := ts.purgeTrashedFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ts.store.files["render"]; ok {
+		t.Fatal("not purged after the trash retention")
+	}
+}
+
+func TestTrashDisabled(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.TrashRetention = 0
+	ts.saveTestFile(t, "render", "frames", time.Hour)
+
+	w := ts.serve(ts.deleteFile, httptest.NewRequest(http.MethodDelete, "/api/file/render?delete_password=delete-me", nil), gin.Param{Key: "id", Value: "render"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: got %d: %s", w.Code, w.Body.String())
+	}
+	if _, ok := ts.store.files["render"]; ok {
+		t.Fatal("file kept with the trash disabled")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/net/websocket"
+)
+
+// UploadEvent is a message sent over the upload status WebSocket. "status" describes the
+// session on connect, "chunk" acknowledges a received chunk, "job" reports processing
+// progress, and "completed", "failed" or "cancelled" end the stream.
+type UploadEvent struct {
+	Type           string         `json:"type"`
+	UploadID       string         `json:"upload_id"`
+	ChunkIndex     *int           `json:"chunk_index,omitempty"`
+	ReceivedChunks int            `json:"received_chunks"`
+	TotalChunks    int            `json:"total_chunks"`
+	Job            *ProcessingJob `json:"job,omitempty"`
+}
+
+// publishUploadEvent notifies WebSocket subscribers of an upload on any instance
+func (m *ChunkUploadManager) publishUploadEvent(event UploadEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if err := m.redis.Publish(context.Background(), "upload_events:"+event.UploadID, payload).Err(); err != nil {
+		log.Printf("Failed to publish upload event for %s: %v", event.UploadID, err)
+	}
+}
+
+// publishChunkReceived acknowledges a stored chunk to WebSocket subscribers
+func (m *ChunkUploadManager) publishChunkReceived(upload *ChunkUpload, chunkIndex int) {
+	m.publishUploadEvent(UploadEvent{
+		Type:           "chunk",
+		UploadID:       upload.UploadID,
+		ChunkIndex:     &chunkIndex,
+		ReceivedChunks: upload.receivedCount(),
+		TotalChunks:    upload.TotalChunks,
+	})
+}
+
+// publishJobUpdate forwards a processing job change to the upload's WebSocket subscribers
+func (m *ChunkUploadManager) publishJobUpdate(job *ProcessingJob) {
+	if job.UploadID == "" {
+		return
+	}
+	eventType := "job"
+	if job.Status == "completed" || job.Status == "failed" {
+		eventType = job.Status
+	}
+	m.publishUploadEvent(UploadEvent{Type: eventType, UploadID: job.UploadID, Job: job})
+}
+
+// UploadStatusSocket serves a WebSocket that multiplexes chunk acknowledgements, assembly
+// progress and the final file result for one upload, so clients can drive progress bars
+// for very large uploads without polling.
+//
+// @summary Follow a chunked upload over a WebSocket
+// @tags chunk
+// @path upload_id Upload ID
+// @success 101 Switching to the WebSocket protocol
+func (m *ChunkUploadManager) UploadStatusSocket(c *gin.Context) {
+	uploadID := c.Param("upload_id")
+
+	// Subscribe before reading the current state so no event is missed in between
+	pubsub := m.redis.Subscribe(context.Background(), "upload_events:"+uploadID)
+	defer pubsub.Close()
+
+	upload, err := m.loadUpload(uploadID)
+	if err != nil {
+		log.Printf("Failed to load upload session %s: %v", uploadID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse upload session"})
+		return
+	}
+
+	// Once processing starts the session is cleaned up; the job carries on from there
+	var job *ProcessingJob
+	if jobID, err := m.redis.Get(context.Background(), "upload_job:"+uploadID).Result(); err == nil {
+		job, _ = m.loadJob(jobID)
+	}
+
+	if upload == nil && job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload session not found"})
+		return
+	}
+
+	server := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			m.streamUploadEvents(ws, uploadID, upload, job, pubsub.Channel())
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// streamUploadEvents sends the current state and then every published event until the
+// job finishes or the client disconnects
+func (m *ChunkUploadManager) streamUploadEvents(ws *websocket.Conn, uploadID string, upload *ChunkUpload, job *ProcessingJob, notifications <-chan *redis.Message) {
+	status := UploadEvent{Type: "status", UploadID: uploadID, Job: job}
+	if upload != nil {
+		status.ReceivedChunks = upload.receivedCount()
+		status.TotalChunks = upload.TotalChunks
+	}
+	if err := websocket.JSON.Send(ws, status); err != nil {
+		return
+	}
+	if job != nil && (job.Status == "completed" || job.Status == "failed") {
+		return
+	}
+
+	// The client isn't expected to send anything; reading detects when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case msg, ok := <-notifications:
+			if !ok {
+				return
+			}
+			var event UploadEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("Invalid upload event for %s: %v", uploadID, err)
+				continue
+			}
+			if err := websocket.JSON.Send(ws, event); err != nil {
+				return
+			}
+			if event.Type == "completed" || event.Type == "failed" || event.Type == "cancelled" {
+				return
+			}
+		case <-heartbeat.C:
+			if err := websocket.JSON.Send(ws, UploadEvent{Type: "keepalive", UploadID: uploadID}); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/semaphore"
+)
+
+// uploadLanes bounds concurrent uploads. Every upload takes a slot of the main lane
+// when one is free; when all are held, uploads smaller than smallSize wait for the fast
+// lane instead, so screenshot-sized uploads aren't queued behind multi-GB transfers.
+type uploadLanes struct {
+	main      *semaphore.Weighted
+	small     *semaphore.Weighted // nil when the fast lane is disabled
+	smallSize int64
+
+	capacity      int64
+	smallCapacity int64
+	inMain        atomic.Int64 // Slots of the main lane held
+}
+
+// newUploadLanes sizes the lanes from MAX_CONCURRENT_UPLOADS and SMALL_UPLOAD_CONCURRENCY
+func newUploadLanes(config *Config) *uploadLanes {
+	lanes := &uploadLanes{
+		main:      semaphore.NewWeighted(int64(config.MaxConcurrentUploads)),
+		smallSize: config.SmallUploadMaxSize,
+		capacity:  int64(config.MaxConcurrentUploads),
+	}
+	if config.SmallUploadConcurrency > 0 && config.SmallUploadMaxSize > 0 {
+		lanes.small = semaphore.NewWeighted(int64(config.SmallUploadConcurrency))
+		lanes.smallCapacity = int64(config.SmallUploadConcurrency)
+	}
+	return lanes
+}
+
+// acquire waits for an upload slot for a request of size bytes (-1 when unknown) and
+// returns the function releasing it
+func (l *uploadLanes) acquire(ctx context.Context, size int64) (func(), error) {
+	lane := l.main
+	if l.small != nil && size >= 0 && size < l.smallSize {
+		if l.main.TryAcquire(1) {
+			return l.holdMain(), nil
+		}
+		lane = l.small
+	}
+	if err := lane.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	if lane == l.main {
+		return l.holdMain(), nil
+	}
+	return func() { lane.Release(1) }, nil
+}
+
+// holdMain counts an acquired main lane slot and returns the function releasing it
+func (l *uploadLanes) holdMain() func() {
+	l.inMain.Add(1)
+	return func() {
+		l.inMain.Add(-1)
+		l.main.Release(1)
+	}
+}
+
+// saturated reports whether every slot of the main lane is held
+func (l *uploadLanes) saturated() bool {
+	return l.inMain.Load() >= l.capacity
+}
+
+// state describes the lanes and where a new upload would go
+func (l *uploadLanes) state() UploadConcurrency {
+	state := UploadConcurrency{
+		Class:                "main",
+		MaxConcurrentUploads: int(l.capacity),
+		ActiveUploads:        l.inMain.Load(),
+	}
+	if l.small != nil {
+		state.SmallUploadMaxSize = l.smallSize
+		state.SmallUploadConcurrency = int(l.smallCapacity)
+	}
+	if l.saturated() {
+		state.Class = "queued"
+		if l.small != nil {
+			state.Class = "fast_lane"
+		}
+	}
+	return state
+}
+
+// acquireUploadSlot takes an upload slot for the request, sized by its Content-Length,
+// answering 503 when the client gives up waiting
+func (s *FileService) acquireUploadSlot(c *gin.Context) (func(), bool) {
+	release, err := s.uploadSlot(c.Request.Context(), c.Request.ContentLength)
+	if err != nil {
+		err.respond(c)
+		return nil, false
+	}
+	return release, true
+}
+
+// uploadSlot takes an upload slot for an upload of size bytes, refusing it with 503 when
+// ctx ends first
+func (s *FileService) uploadSlot(ctx context.Context, size int64) (func(), *apiError) {
+	release, err := s.uploadLanes.acquire(ctx, size)
+	if err != nil {
+		return nil, retryLaterError(http.StatusServiceUnavailable, errorCodeServerBusy, retryAfterBusy, gin.H{
+			"error": "Server busy, please try again later",
+		})
+	}
+	return release, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSmallUploadsUseFastLane(t *testing.T) {
+	lanes := newUploadLanes(&Config{MaxConcurrentUploads: 1, SmallUploadMaxSize: 1024, SmallUploadConcurrency: 1})
+	busy := func(size int64) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		release, err := lanes.acquire(ctx, size)
+		if err != nil {
+			return true
+		}
+		release()
+		return false
+	}
+
+	releaseLarge, err := lanes.acquire(context.Background(), 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !busy(1 << 30) {
+		t.Error("a second large upload got a slot")
+	}
+	if !lanes.saturated() {
+		t.Error("the main lane isn't reported saturated")
+	}
+	if !busy(-1) {
+		t.Error("an upload of unknown size got a fast lane slot")
+	}
+
+	releaseSmall, err := lanes.acquire(context.Background(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !busy(100) {
+		t.Error("the fast lane took more uploads than its concurrency")
+	}
+	releaseSmall()
+	if busy(100) {
+		t.Error("a small upload waited behind a large one")
+	}
+
+	releaseLarge()
+	if lanes.saturated() {
+		t.Error("the main lane is still reported saturated")
+	}
+	if busy(1 << 30) {
+		t.Error("the main lane wasn't released")
+	}
+}
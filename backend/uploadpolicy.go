@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// Upload policies let a third-party site have its users upload straight from the browser
+// without handing out its API key. The site's backend mints a policy with its key, naming
+// the largest file, the accepted types, when the policy expires and tags to attach, and
+// the browser sends the signed policy in the policy field of its /api/upload form. Files
+// uploaded under a policy belong to the key that minted it, count against its quotas and
+// carry the tags. A policy can be used until it expires, and stops working as soon as its
+// key is revoked.
+
+// uploadPolicyContextKey is the gin context key holding the *UploadPolicy of an upload
+const uploadPolicyContextKey = "uploadPolicy"
+
+// defaultUploadPolicyLifetime is how long a policy is valid when the request doesn't say
+const defaultUploadPolicyLifetime = time.Hour
+
+// Most tags a policy may attach, and the longest tag name or value in characters
+const (
+	maxUploadPolicyTags      = 20
+	maxUploadPolicyTagLength = 256
+)
+
+// UploadPolicyRequest asks for a policy. Zero values take the defaults.
+type UploadPolicyRequest struct {
+	MaxSize      int64             `json:"max_size,omitempty"`      // Bytes; defaults to the largest simple upload
+	AllowedTypes []string          `json:"allowed_types,omitempty"` // MIME types, or families like "image/*"; any when empty
+	ExpiresIn    int               `json:"expires_in,omitempty"`    // Seconds the policy is valid; defaults to an hour
+	Tags         map[string]string `json:"tags,omitempty"`          // Attached to every file uploaded under the policy
+}
+
+// UploadPolicy is what a signed policy allows
+type UploadPolicy struct {
+	KeyID        string            `json:"key_id"`
+	MaxSize      int64             `json:"max_size"`
+	AllowedTypes []string          `json:"allowed_types,omitempty"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// UploadPolicyResponse is a minted policy
+type UploadPolicyResponse struct {
+	UploadPolicy
+	Policy    string `json:"policy"`     // Send as the policy field of the upload form
+	UploadURL string `json:"upload_url"` // Where the browser posts the form
+}
+
+// newUploadPolicySecret returns the key policies are signed with
+func newUploadPolicySecret(config *Config) []byte {
+	if config.UploadPolicySecret != "" {
+		return []byte(config.UploadPolicySecret)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	log.Printf("UPLOAD_POLICY_SECRET is not set: upload policies are signed with a random secret and only valid on this instance until it restarts")
+	return secret
+}
+
+// createUploadPolicy mints a signed policy for browser uploads under the request's API key
+//
+// @summary Create a signed upload policy
+// @tags upload
+// @body json UploadPolicyRequest
+// @success 200 UploadPolicyResponse
+// @auth apiKey
+func (s *FileService) createUploadPolicy(c *gin.Context) {
+	apiKey := apiKeyFromContext(c)
+	if apiKey == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "An API key is required to create upload policies"})
+		return
+	}
+
+	var req UploadPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	policy, err := s.newUploadPolicy(apiKey, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, UploadPolicyResponse{
+		UploadPolicy: *policy,
+		Policy:       s.signUploadPolicy(policy),
+		UploadURL:    s.publicBaseURL(c) + "/api/upload",
+	})
+}
+
+// newUploadPolicy validates a request and turns it into the policy to sign
+func (s *FileService) newUploadPolicy(apiKey *APIKeyStorage, req *UploadPolicyRequest) (*UploadPolicy, error) {
+	sizeLimit := min(s.config.MaxFileSize, s.config.ChunkThreshold)
+	maxSize := req.MaxSize
+	switch {
+	case maxSize < 0:
+		return nil, fmt.Errorf("max_size must not be negative")
+	case maxSize == 0:
+		maxSize = sizeLimit
+	case maxSize > sizeLimit:
+		return nil, fmt.Errorf("max_size must not exceed %d bytes, the largest simple upload", sizeLimit)
+	}
+
+	lifetime := time.Duration(req.ExpiresIn) * time.Second
+	switch {
+	case req.ExpiresIn < 0:
+		return nil, fmt.Errorf("expires_in must not be negative")
+	case req.ExpiresIn == 0:
+		lifetime = min(defaultUploadPolicyLifetime, s.config.UploadPolicyMaxLifetime)
+	case lifetime > s.config.UploadPolicyMaxLifetime:
+		return nil, fmt.Errorf("expires_in must not exceed %d seconds", int(s.config.UploadPolicyMaxLifetime.Seconds()))
+	}
+
+	allowedTypes := make([]string, 0, len(req.AllowedTypes))
+	for _, allowed := range req.AllowedTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		family, subtype, ok := strings.Cut(allowed, "/")
+		if !ok || family == "" || family == "*" || subtype == "" || strings.Contains(subtype, "/") ||
+			(strings.Contains(subtype, "*") && subtype != "*") {
+			return nil, fmt.Errorf("allowed type %q must be a MIME type like image/png or a family like image/*", allowed)
+		}
+		allowedTypes = append(allowedTypes, allowed)
+	}
+
+	if len(req.Tags) > maxUploadPolicyTags {
+		return nil, fmt.Errorf("a policy may attach at most %d tags", maxUploadPolicyTags)
+	}
+	for name, value := range req.Tags {
+		for _, text := range []string{name, value} {
+			if !utf8.ValidString(text) || strings.IndexFunc(text, isDisallowedTextRune) >= 0 ||
+				utf8.RuneCountInString(text) > maxUploadPolicyTagLength {
+				return nil, fmt.Errorf("tag %q must be plain text of at most %d characters", name, maxUploadPolicyTagLength)
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("tag names must not be empty")
+		}
+	}
+
+	return &UploadPolicy{
+		KeyID:        apiKey.ID,
+		MaxSize:      maxSize,
+		AllowedTypes: allowedTypes,
+		ExpiresAt:    s.clock.Now().Add(lifetime).UTC().Truncate(time.Second),
+		Tags:         req.Tags,
+	}, nil
+}
+
+// signUploadPolicy encodes a policy as its base64url JSON and HMAC-SHA256, joined by a dot
+func (s *FileService) signUploadPolicy(policy *UploadPolicy) string {
+	payload, _ := json.Marshal(policy)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, s.policySecret)
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Why a policy is refused
+var (
+	errUploadPolicyInvalid = errors.New("the policy is malformed or its signature doesn't match")
+	errUploadPolicyExpired = errors.New("the policy has expired")
+)
+
+// parseUploadPolicy verifies the signature and expiry of a signed policy
+func (s *FileService) parseUploadPolicy(signed string) (*UploadPolicy, error) {
+	encoded, signature, ok := strings.Cut(signed, ".")
+	if !ok {
+		return nil, errUploadPolicyInvalid
+	}
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, errUploadPolicyInvalid
+	}
+	mac := hmac.New(sha256.New, s.policySecret)
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return nil, errUploadPolicyInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errUploadPolicyInvalid
+	}
+	var policy UploadPolicy
+	if err := json.Unmarshal(payload, &policy); err != nil || policy.KeyID == "" {
+		return nil, errUploadPolicyInvalid
+	}
+	if !s.clock.Now().Before(policy.ExpiresAt) {
+		return nil, errUploadPolicyExpired
+	}
+	return &policy, nil
+}
+
+// applyUploadPolicy checks the policy sent with an upload form, if any, and makes the
+// upload one by the key that minted it. It writes the error response and returns false
+// when the policy is refused.
+func (s *FileService) applyUploadPolicy(c *gin.Context) (*UploadPolicy, bool) {
+	signed := c.PostForm("policy")
+	if signed == "" {
+		return nil, true
+	}
+	if apiKeyFromContext(c) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send either an API key or an upload policy, not both"})
+		return nil, false
+	}
+
+	policy, err := s.parseUploadPolicy(signed)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Upload policy refused", "message": err.Error()})
+		return nil, false
+	}
+	key, err := s.db.GetAPIKey(policy.KeyID)
+	if err != nil {
+		log.Printf("Failed to look up the API key of an upload policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate upload policy"})
+		return nil, false
+	}
+	if key == nil || !key.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Upload policy refused",
+			"message": "The API key that created the policy is expired or revoked",
+		})
+		return nil, false
+	}
+
+	// Policy uploads count against the key's rate limit like the key's own requests
+	if !s.admitAPIKey(c, key) {
+		return nil, false
+	}
+	c.Set(uploadPolicyContextKey, policy)
+	return policy, true
+}
+
+// uploadPolicyFromContext returns the policy an upload was made under, nil if none
+func uploadPolicyFromContext(c *gin.Context) *UploadPolicy {
+	value, exists := c.Get(uploadPolicyContextKey)
+	if !exists {
+		return nil
+	}
+	policy, _ := value.(*UploadPolicy)
+	return policy
+}
+
+// uploadPolicyTags returns the tags the upload policy of the request gives its files
+func uploadPolicyTags(c *gin.Context) map[string]string {
+	if policy := uploadPolicyFromContext(c); policy != nil {
+		return policy.Tags
+	}
+	return nil
+}
+
+// allowsType reports whether the policy accepts files of a MIME type
+func (p *UploadPolicy) allowsType(mimeType string) bool {
+	if len(p.AllowedTypes) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedTypes {
+		if allowed == mimeType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFile rejects a file the policy doesn't allow by its name and declared size,
+// writing the error response and returning false
+func (p *UploadPolicy) checkFile(c *gin.Context, filename string, size int64) bool {
+	if size > p.MaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":    "File too large for the upload policy",
+			"max_size": p.MaxSize,
+		})
+		return false
+	}
+	if mimeType := files.MimeType(filename); !p.allowsType(mimeType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":         "File type not allowed by the upload policy",
+			"mime_type":     mimeType,
+			"allowed_types": p.AllowedTypes,
+		})
+		return false
+	}
+	return true
+}
+
+// checkContent rejects content whose leading bytes contradict the type its name gives,
+// so a policy for images can't be used for a renamed executable
+func (p *UploadPolicy) checkContent(c *gin.Context, filename string, content []byte) bool {
+	if len(p.AllowedTypes) == 0 {
+		return true
+	}
+	declared := files.MimeType(filename)
+	sniffed := files.SniffMimeType(content)
+	if files.MimeMismatch(declared, sniffed) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":        "File content doesn't match its type",
+			"mime_type":    declared,
+			"sniffed_type": sniffed,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestPolicy(t *testing.T, ts *testService, key *APIKeyStorage, body string) (*httptest.ResponseRecorder, UploadPolicyResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload-policies", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := ts.serve(asKey(key, ts.createUploadPolicy), req)
+	var resp UploadPolicyResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func uploadWithPolicy(ts *testService, policy, filename string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("policy", policy)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write(content)
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return ts.serve(ts.uploadFile, req)
+}
+
+func TestUploadPolicy(t *testing.T) {
+	ts := newTestService(t)
+	key := &APIKeyStorage{ID: "site", Name: "Site", KeyHash: hashAPIKey("one_site"), RateLimit: 100}
+	ts.store.CreateAPIKey(key)
+
+	w, minted := createTestPolicy(t, ts, key, `{"max_size":100,"allowed_types":["text/*"],"expires_in":600,"tags":{"user":"42"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body.String())
+	}
+	if minted.KeyID != "site" || minted.MaxSize != 100 || !minted.ExpiresAt.Equal(ts.clock.Now().Add(10*time.Minute)) ||
+		!strings.HasSuffix(minted.UploadURL, "/api/upload") {
+		t.Errorf("policy = %+v", minted)
+	}
+
+	w = uploadWithPolicy(ts, minted.Policy, "note.txt", []byte("hello from a browser"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: got %d: %s", w.Code, w.Body.String())
+	}
+	var uploaded UploadResponse
+	json.Unmarshal(w.Body.Bytes(), &uploaded)
+	stored, _ := ts.store.GetFile(uploaded.FileID)
+	if stored == nil || stored.APIKeyID == nil || *stored.APIKeyID != "site" || stored.Tags["user"] != "42" {
+		t.Errorf("stored = %+v", stored)
+	}
+	if uploaded.Metadata.Tags["user"] != "42" {
+		t.Errorf("metadata tags = %v", uploaded.Metadata.Tags)
+	}
+
+	if w := uploadWithPolicy(ts, minted.Policy, "big.txt", bytes.Repeat([]byte("x"), 101)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("file over max_size: got %d, want 413", w.Code)
+	}
+	if w := uploadWithPolicy(ts, minted.Policy, "photo.png", []byte("not text")); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("type outside allowed_types: got %d, want 415", w.Code)
+	}
+	if w := uploadWithPolicy(ts, minted.Policy, "page.txt", []byte("\x89PNG\r\n\x1a\n renamed image")); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("content contradicting its name: got %d, want 415", w.Code)
+	}
+
+	payload, signature, _ := strings.Cut(minted.Policy, ".")
+	if w := uploadWithPolicy(ts, payload+"x."+signature, "note.txt", []byte("hi")); w.Code != http.StatusForbidden {
+		t.Errorf("tampered policy: got %d, want 403", w.Code)
+	}
+
+	ts.clock.Advance(11 * time.Minute)
+	if w := uploadWithPolicy(ts, minted.Policy, "note.txt", []byte("hi")); w.Code != http.StatusForbidden {
+		t.Errorf("expired policy: got %d, want 403", w.Code)
+	}
+}
+
+func TestUploadPolicyRevokedKey(t *testing.T) {
+	ts := newTestService(t)
+	key := &APIKeyStorage{ID: "site", Name: "Site", KeyHash: hashAPIKey("one_site"), RateLimit: 100}
+	ts.store.CreateAPIKey(key)
+	_, minted := createTestPolicy(t, ts, key, `{}`)
+
+	revokedAt := time.Now()
+	key.RevokedAt = &revokedAt
+	ts.store.CreateAPIKey(key)
+	if w := uploadWithPolicy(ts, minted.Policy, "note.txt", []byte("hi")); w.Code != http.StatusForbidden {
+		t.Errorf("policy of a revoked key: got %d, want 403", w.Code)
+	}
+}
+
+func TestUploadPolicyRateLimit(t *testing.T) {
+	ts := newTestService(t)
+	key := &APIKeyStorage{ID: "site", Name: "Site", KeyHash: hashAPIKey("one_site"), RateLimit: 2}
+	ts.store.CreateAPIKey(key)
+	_, minted := createTestPolicy(t, ts, key, `{}`)
+
+	for i := 0; i < 2; i++ {
+		if w := uploadWithPolicy(ts, minted.Policy, "note.txt", []byte("hi")); w.Code != http.StatusOK {
+			t.Fatalf("upload %d: got %d: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	w := uploadWithPolicy(ts, minted.Policy, "note.txt", []byte("hi"))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("upload over the key's rate limit: got %d, X-RateLimit-Remaining %q", w.Code, w.Header().Get("X-RateLimit-Remaining"))
+	}
+}
+
+func TestCreateUploadPolicyValidation(t *testing.T) {
+	ts := newTestService(t)
+	key := &APIKeyStorage{ID: "site", Name: "Site", KeyHash: hashAPIKey("one_site"), RateLimit: 100}
+	ts.store.CreateAPIKey(key)
+
+	for _, body := range []string{
+		`{"max_size":-1}`,
+		`{"max_size":999999999999}`,
+		`{"expires_in":99999999}`,
+		`{"allowed_types":["image"]}`,
+		`{"allowed_types":["*/*"]}`,
+		`{"allowed_types":["image/p*"]}`,
+		`{"tags":{"":"empty name"}}`,
+		`{"tags":{"user":"` + strings.Repeat("a", maxUploadPolicyTagLength+1) + `"}}`,
+	} {
+		if w, _ := createTestPolicy(t, ts, key, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload-policies", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	if w := ts.serve(ts.createUploadPolicy, req); w.Code != http.StatusUnauthorized {
+		t.Errorf("without an API key: got %d, want 401", w.Code)
+	}
+}
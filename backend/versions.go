@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"file-storage-service/internal/files"
+)
+
+// When the content of a file is replaced, the previous content is kept as a version for
+// VERSION_RETENTION. Disk-stored content is moved next to the file's content instead of
+// being copied; content stored in the database is copied into file_versions. Versions
+// are removed by the cleanup job once they expire or their file is gone.
+
+// archiveContent sets the current content of a file aside as a version before it is
+// replaced. It returns nil when versions aren't kept.
+func (s *FileService) archiveContent(file *FileStorage) (*FileVersion, error) {
+	if s.config.VersionRetention <= 0 {
+		return nil, nil
+	}
+
+	now := s.clock.Now()
+	version := &FileVersion{
+		FileID:          file.ID,
+		Version:         file.Version,
+		OriginalSize:    file.OriginalSize,
+		CompressedSize:  file.CompressedSize,
+		CompressionType: file.CompressionType,
+		StorageType:     file.StorageType,
+		ContentHash:     file.ContentHash,
+		ReplacedAt:      now,
+		ExpiresAt:       now.Add(s.config.VersionRetention),
+	}
+	// A version never outlives its file
+	if file.ExpiresAt.Before(version.ExpiresAt) {
+		version.ExpiresAt = file.ExpiresAt
+	}
+
+	if file.StoragePath != nil {
+		if err := validateStoragePath(s.config, *file.StoragePath); err != nil {
+			return nil, err
+		}
+		versionPath := fmt.Sprintf("%s.v%d", *file.StoragePath, file.Version)
+		if err := os.Rename(*file.StoragePath, versionPath); err != nil {
+			return nil, err
+		}
+		version.StoragePath = &versionPath
+		return version, nil
+	}
+
+	stored, err := s.db.GetFile(file.ID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("file not found")
+	}
+	version.FileContent = stored.FileContent
+	return version, nil
+}
+
+// restoreContent puts content set aside by archiveContent back when replacing it failed
+func (s *FileService) restoreContent(file *FileStorage, version *FileVersion) {
+	if version == nil || version.StoragePath == nil {
+		return
+	}
+	if err := os.Rename(*version.StoragePath, *file.StoragePath); err != nil {
+		log.Printf("Failed to restore content of %s: %v", file.ID, err)
+	}
+}
+
+// removeVersionContent deletes the disk content of versions
+func (s *FileService) removeVersionContent(paths []string) {
+	for _, path := range paths {
+		if err := removeStoredFile(s.config, path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete file version %s from disk: %v", path, err)
+		}
+	}
+}
+
+// cleanupFileVersions removes the versions past their retention and those of files that
+// no longer exist
+func (s *FileService) cleanupFileVersions() error {
+	paths, err := s.db.DeleteExpiredFileVersions()
+	if err != nil {
+		return err
+	}
+	s.removeVersionContent(paths)
+	return nil
+}
+
+// listFileVersions lists the current content of a file and the previous versions still
+// kept, newest first. Anyone who may download the file may list and download them.
+//
+// @summary List the versions of a file
+// @tags file
+// @path id File ID
+// @success 200 json
+// @auth downloadPassword adminToken optional
+func (s *FileService) listFileVersions(c *gin.Context) {
+	fileID := c.Param("id")
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+
+	previous, err := s.db.ListFileVersions(fileID)
+	if err != nil {
+		log.Printf("Failed to list versions of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	current := gin.H{
+		"version":      fileStorage.Version,
+		"current":      true,
+		"size":         fileStorage.OriginalSize,
+		"updated_at":   fileStorage.UpdatedAt,
+		"download_url": "/api/file/" + fileID,
+	}
+	if fileStorage.ContentHash != nil {
+		current["sha256"] = *fileStorage.ContentHash
+	}
+	versions := []gin.H{current}
+	for _, v := range previous {
+		version := gin.H{
+			"version":      v.Version,
+			"current":      false,
+			"size":         v.OriginalSize,
+			"replaced_at":  v.ReplacedAt,
+			"expires_at":   v.ExpiresAt,
+			"download_url": fmt.Sprintf("/api/file/%s/versions/%d", fileID, v.Version),
+		}
+		if v.ContentHash != nil {
+			version["sha256"] = *v.ContentHash
+		}
+		versions = append(versions, version)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":           fileID,
+		"current_version":   fileStorage.Version,
+		"versions":          versions,
+		"retention_seconds": int64(s.config.VersionRetention.Seconds()),
+	})
+}
+
+// getFileVersion downloads a previous version of a file under the file's name. The
+// current version is served like /api/file/:id.
+//
+// @summary Download a previous version of a file
+// @tags file
+// @path id File ID
+// @path version Version number
+// @success 200 application/octet-stream
+// @auth downloadPassword adminToken optional
+func (s *FileService) getFileVersion(c *gin.Context) {
+	fileID := c.Param("id")
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version"})
+		return
+	}
+
+	fileStorage, err := s.db.GetFileMetadata(fileID)
+	if err != nil {
+		log.Printf("Failed to get file metadata: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fileStorage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if number == fileStorage.Version {
+		s.getFile(c)
+		return
+	}
+	if !s.requireDownloadAccess(c, fileStorage.HasDownloadPassword, fileStorage.DownloadPassword) {
+		return
+	}
+	// Versions have no verdict of their own, so they are held back with their file
+	if !requireScanCleared(c, fileStorage) {
+		return
+	}
+
+	if err := s.downloadSem.Acquire(c.Request.Context(), 1); err != nil {
+		respondRetryLater(c, http.StatusServiceUnavailable, errorCodeServerBusy, retryAfterBusy, gin.H{
+			"error": "Server busy, please try again later",
+		})
+		return
+	}
+	defer s.downloadSem.Release(1)
+
+	version, err := s.db.GetFileVersion(fileID, number)
+	if err != nil {
+		log.Printf("Failed to get version %d of %s: %v", number, fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if version == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		return
+	}
+
+	stored := version.FileContent
+	if version.StoragePath != nil {
+		if stored, err = readStoredFile(s.config, *version.StoragePath); err != nil {
+			log.Printf("Failed to read version %d of %s: %v", number, fileID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from disk"})
+			return
+		}
+	}
+	content, err := s.compressor.Decompress(stored, CompressionType(version.CompressionType))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decompress file"})
+		return
+	}
+	s.logFileAccess(c, fileID, accessDownload)
+
+	c.Header("Content-Disposition", files.ContentDisposition("attachment", fileStorage.Filename))
+	c.Header("X-File-Version", strconv.Itoa(version.Version))
+	c.Header("Cache-Control", "private")
+	c.Data(http.StatusOK, fileStorage.MimeType, content)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFileVersions(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.VersionRetention = 24 * time.Hour
+	ts.saveTestFile(t, "notes", "draft one", 7*24*time.Hour)
+	param := gin.Param{Key: "id", Value: "notes"}
+
+	replace := func(content string) {
+		t.Helper()
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", "notes.txt")
+		part.Write([]byte(content))
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPut, "/api/file/notes/content?delete_password=delete-me", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if w := ts.serve(ts.replaceFileContent, req, param); w.Code != http.StatusOK {
+			t.Fatalf("replace: got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	list := func() (int, []map[string]interface{}) {
+		t.Helper()
+		w := ts.serve(ts.listFileVersions, httptest.NewRequest(http.MethodGet, "/api/file/notes/versions", nil), param)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list: got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			CurrentVersion int                      `json:"current_version"`
+			Versions       []map[string]interface{} `json:"versions"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.CurrentVersion, resp.Versions
+	}
+	download := func(version string) *httptest.ResponseRecorder {
+		return ts.serve(ts.getFileVersion, httptest.NewRequest(http.MethodGet, "/api/file/notes/versions/"+version, nil),
+			param, gin.Param{Key: "version", Value: version})
+	}
+
+	replace("draft two")
+	ts.clock.Advance(time.Hour)
+	replace("final")
+
+	current, versions := list()
+	if current != 3 || len(versions) != 3 {
+		t.Fatalf("current %d, versions %v", current, versions)
+	}
+	for i, want := range []float64{3, 2, 1} {
+		if versions[i]["version"] != want {
+			t.Errorf("versions[%d] = %v, want version %v", i, versions[i]["version"], want)
+		}
+	}
+
+	for version, want := range map[string]string{"1": "draft one", "2": "draft two", "3": "final"} {
+		if w := download(version); w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("version %s: got %d %q, want %q", version, w.Code, w.Body.String(), want)
+		}
+	}
+	if w := download("4"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown version: got %d, want 404", w.Code)
+	}
+
+	// Version 1 was replaced an hour before version 2
+	ts.clock.Advance(23*time.Hour + time.Minute)
+	if err := ts.cleanupFileVersions(); err != nil {
+		t.Fatal(err)
+	}
+	if _, versions := list(); len(versions) != 2 || versions[1]["version"] != float64(2) {
+		t.Errorf("after version 1 expired: %v", versions)
+	}
+	if w := download("1"); w.Code != http.StatusNotFound {
+		t.Errorf("expired version: got %d, want 404", w.Code)
+	}
+
+	ts.store.DeleteFile("notes")
+	if err := ts.cleanupFileVersions(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.store.versions["notes"]) != 0 {
+		t.Errorf("versions of a deleted file kept: %v", ts.store.versions["notes"])
+	}
+}
+
+func TestFileVersionsDisabled(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.VersionRetention = 0
+	ts.saveTestFile(t, "notes", "draft one", time.Hour)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("draft two"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPut, "/api/file/notes/content?delete_password=delete-me", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if w := ts.serve(ts.replaceFileContent, req, gin.Param{Key: "id", Value: "notes"}); w.Code != http.StatusOK {
+		t.Fatalf("replace: got %d: %s", w.Code, w.Body.String())
+	}
+
+	if len(ts.store.versions["notes"]) != 0 {
+		t.Errorf("kept versions with retention disabled: %v", ts.store.versions["notes"])
+	}
+	if file, _ := ts.store.GetFileMetadata("notes"); file.Version != 2 {
+		t.Errorf("version = %d, want 2", file.Version)
+	}
+}
+
+func TestFileVersionsExpireWithFile(t *testing.T) {
+	ts := newTestService(t)
+	ts.config.VersionRetention = 7 * 24 * time.Hour
+	ts.saveTestFile(t, "notes", "draft one", 24*time.Hour)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("draft two"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPut, "/api/file/notes/content?delete_password=delete-me", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if w := ts.serve(ts.replaceFileContent, req, gin.Param{Key: "id", Value: "notes"}); w.Code != http.StatusOK {
+		t.Fatalf("replace: got %d: %s", w.Code, w.Body.String())
+	}
+
+	versions := ts.store.versions["notes"]
+	if len(versions) != 1 || !versions[0].ExpiresAt.Equal(ts.clock.Now().Add(24*time.Hour)) {
+		t.Fatalf("version should expire with its file: %+v", versions)
+	}
+
+	// Shortening the file's expiry takes its versions with it
+	ts.store.UpdateFileExpiration("notes", ts.clock.Now().Add(time.Hour))
+	ts.clock.Advance(time.Hour + time.Minute)
+	if err := ts.cleanupFileVersions(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ts.store.versions["notes"]) != 0 {
+		t.Errorf("versions of an expired file kept: %v", ts.store.versions["notes"])
+	}
+}
@@ -6,6 +6,7 @@ import {
 	getFilePreview,
 	getFilePreviewWithProgress,
 	getZipContents,
+	isArchiveFilename,
 	getZipFilePreview,
 } from '../utils/api';
 import { formatSize, formatDate } from '../utils/format';
@@ -36,7 +37,7 @@ const FilePreview: React.FC<FilePreviewProps> = ({ fileId, metadata, password, a
 
 	useEffect(() => {
 		loadPreview();
-		if (metadata.filename.toLowerCase().endsWith('.zip')) {
+		if (isArchiveFilename(metadata.filename)) {
 			loadZipContents();
 		}
 
@@ -255,7 +256,7 @@ const FilePreview: React.FC<FilePreviewProps> = ({ fileId, metadata, password, a
 		const currentIndex = previewableFiles.findIndex((f) => f.name === file.name);
 
 		try {
-			const { blob, contentType } = await getZipFilePreview(fileId, file.name);
+			const { blob, contentType } = await getZipFilePreview(fileId, file.index);
 
 			if (zipFilePreview?.previewUrl) {
 				URL.revokeObjectURL(zipFilePreview.previewUrl);
@@ -300,7 +301,7 @@ const FilePreview: React.FC<FilePreviewProps> = ({ fileId, metadata, password, a
 		if (!nextFile) return;
 
 		try {
-			const { blob, contentType } = await getZipFilePreview(fileId, nextFile.name);
+			const { blob, contentType } = await getZipFilePreview(fileId, nextFile.index);
 
 			URL.revokeObjectURL(zipFilePreview.previewUrl);
 
@@ -356,23 +357,37 @@ const FilePreview: React.FC<FilePreviewProps> = ({ fileId, metadata, password, a
 		}
 
 		const { mime_type } = metadata;
+		const accessibility = metadata.accessibility;
+		const descriptionId = `file-description-${fileId}`;
+		// The uploader's caption and description, shown under media and read out with it
+		const description =
+			accessibility?.caption || accessibility?.description ? (
+				<div id={descriptionId} className='mt-3 text-sm text-gray-700 text-center whitespace-pre-line'>
+					{accessibility?.caption && <p className='font-medium'>{accessibility.caption}</p>}
+					{accessibility?.description && <p className='mt-1'>{accessibility.description}</p>}
+				</div>
+			) : null;
 
 		if (mime_type.startsWith('image/')) {
 			const isLargeImage = metadata.size > 1 * 1024 * 1024; // 1MB threshold
 
 			return (
-				<img
-					src={previewUrl}
-					alt={metadata.filename}
-					className='max-w-full max-h-[80vh] object-contain mx-auto'
-					loading={isLargeImage ? 'lazy' : 'eager'}
-					onLoad={() => setIsLoading(false)}
-					onError={() => setError('Failed to load image')}
-					style={{
-						transition: 'opacity 0.3s ease',
-						opacity: isLoading ? 0.7 : 1,
-					}}
-				/>
+				<figure>
+					<img
+						src={previewUrl}
+						alt={accessibility?.alt_text || metadata.filename}
+						aria-describedby={description ? descriptionId : undefined}
+						className='max-w-full max-h-[80vh] object-contain mx-auto'
+						loading={isLargeImage ? 'lazy' : 'eager'}
+						onLoad={() => setIsLoading(false)}
+						onError={() => setError('Failed to load image')}
+						style={{
+							transition: 'opacity 0.3s ease',
+							opacity: isLoading ? 0.7 : 1,
+						}}
+					/>
+					{description && <figcaption>{description}</figcaption>}
+				</figure>
 			);
 		}
 
@@ -401,12 +416,14 @@ const FilePreview: React.FC<FilePreviewProps> = ({ fileId, metadata, password, a
 						preload={isLargeVideo ? 'metadata' : 'auto'}
 						crossOrigin='anonymous'
 						tabIndex={0}
+						aria-describedby={description ? descriptionId : undefined}
 					>
 						Your browser does not support the video tag.
 					</video>
 					<div className='text-center text-sm text-gray-500 mt-2'>
 						Press ← → to skip 10s, Space to play/pause
 					</div>
+					{description}
 				</div>
 			);
 		}
@@ -427,8 +444,9 @@ const FilePreview: React.FC<FilePreviewProps> = ({ fileId, metadata, password, a
 			}
 
 			return (
-				<div className='flex justify-center w-full'>
+				<div className='flex flex-col items-center w-full'>
 					<AudioPlayer src={streamUrl} mimeType={mime_type} className='w-full max-w-lg' />
+					{description}
 				</div>
 			);
 		}
@@ -524,7 +542,7 @@ const FilePreview: React.FC<FilePreviewProps> = ({ fileId, metadata, password, a
 		);
 	};
 
-	const isZipFile = metadata.filename.toLowerCase().endsWith('.zip');
+	const isZipFile = isArchiveFilename(metadata.filename);
 
 	return (
 		<div>
@@ -12,6 +12,9 @@ import {
 	Eye,
 	Lock,
 	Key,
+	Search,
+	ChevronLeft,
+	ChevronRight,
 } from 'lucide-react';
 import Footer from '../components/Footer';
 import Button from '../components/Button';
@@ -35,18 +38,85 @@ interface FileData {
 interface AdminResponse {
 	message: string;
 	count: number;
+	total: number;
+	limit: number;
+	offset: number;
+	has_more: boolean;
 	files: FileData[];
 }
 
+type SortField = 'uploaded_at' | 'expires_at' | 'filename' | 'size';
+
+interface FileListQuery {
+	search: string;
+	sort: SortField;
+	order: 'asc' | 'desc';
+	offset: number;
+}
+
+const PAGE_SIZE = 50;
+
+const defaultQuery: FileListQuery = {
+	search: '',
+	sort: 'uploaded_at',
+	order: 'desc',
+	offset: 0,
+};
+
+const selectClassName =
+	'border border-gray-300 bg-white text-gray-900 px-3 py-2 text-sm focus:outline-none focus:border-primary-500 focus:ring-1 focus:ring-primary-500';
+
 const AdminPage: React.FC = () => {
 	const [isAuthenticated, setIsAuthenticated] = useState(false);
 	const [password, setPassword] = useState('');
-	const [adminPassword, setAdminPassword] = useState('');
 	const [files, setFiles] = useState<FileData[]>([]);
 	const [loading, setLoading] = useState(false);
 	const [error, setError] = useState('');
 	const [message, setMessage] = useState('');
 	const [adminToken, setAdminToken] = useState('');
+	const [query, setQuery] = useState<FileListQuery>(defaultQuery);
+	const [searchInput, setSearchInput] = useState('');
+	const [total, setTotal] = useState(0);
+	const [hasMore, setHasMore] = useState(false);
+
+	// Admin requests after sign-in authenticate with the token instead of the password
+	const adminHeaders = (token: string = adminToken) => ({
+		'Content-Type': 'application/json',
+		Authorization: `Bearer ${token}`,
+	});
+
+	// fetchFiles loads one page of the file list and reports whether it succeeded
+	const fetchFiles = async (token: string, listQuery: FileListQuery): Promise<boolean> => {
+		const response = await fetch('/api/admin/files', {
+			method: 'POST',
+			headers: adminHeaders(token),
+			body: JSON.stringify({
+				search: listQuery.search || undefined,
+				sort: listQuery.sort,
+				order: listQuery.order,
+				limit: PAGE_SIZE,
+				offset: listQuery.offset,
+			}),
+		});
+
+		if (!response.ok) {
+			const errorData = await response.json();
+			setError(errorData.error || 'Failed to fetch files');
+			return false;
+		}
+
+		const data: AdminResponse = await response.json();
+		// Step back when the page emptied, e.g. after deleting its last file
+		if (data.files.length === 0 && listQuery.offset > 0) {
+			return fetchFiles(token, { ...listQuery, offset: Math.max(0, listQuery.offset - PAGE_SIZE) });
+		}
+		setFiles(data.files);
+		setTotal(data.total);
+		setHasMore(data.has_more);
+		setQuery(listQuery);
+		setMessage(`${data.total} files found`);
+		return true;
+	};
 
 	const authenticate = async (e: React.FormEvent) => {
 		e.preventDefault();
@@ -68,27 +138,10 @@ const AdminPage: React.FC = () => {
 			if (authResponse.ok) {
 				const authData = await authResponse.json();
 				setAdminToken(authData.token);
-				setAdminPassword(password);
-
-				// Then get files list
-				const filesResponse = await fetch('/api/admin/files', {
-					method: 'POST',
-					headers: {
-						'Content-Type': 'application/json',
-					},
-					body: JSON.stringify({
-						admin_password: password,
-					}),
-				});
-
-				if (filesResponse.ok) {
-					const filesData: AdminResponse = await filesResponse.json();
+
+				// Then get the first page of files
+				if (await fetchFiles(authData.token, defaultQuery)) {
 					setIsAuthenticated(true);
-					setFiles(filesData.files);
-					setMessage(`${filesData.count} files found`);
-				} else {
-					const errorData = await filesResponse.json();
-					setError(errorData.error || 'Failed to fetch files');
 				}
 			} else {
 				const errorData = await authResponse.json();
@@ -101,29 +154,12 @@ const AdminPage: React.FC = () => {
 		}
 	};
 
-	const refreshFileList = async () => {
+	const loadFiles = async (listQuery: FileListQuery) => {
 		setLoading(true);
 		setError('');
 
 		try {
-			const response = await fetch('/api/admin/files', {
-				method: 'POST',
-				headers: {
-					'Content-Type': 'application/json',
-				},
-				body: JSON.stringify({
-					admin_password: adminPassword,
-				}),
-			});
-
-			if (response.ok) {
-				const data: AdminResponse = await response.json();
-				setFiles(data.files);
-				setMessage(`${data.count} files found`);
-			} else {
-				const errorData = await response.json();
-				setError(errorData.error || 'Failed to refresh file list');
-			}
+			await fetchFiles(adminToken, listQuery);
 		} catch {
 			setError('Network error occurred');
 		} finally {
@@ -131,6 +167,22 @@ const AdminPage: React.FC = () => {
 		}
 	};
 
+	const refreshFileList = () => loadFiles(query);
+
+	// Changing the search or sort starts again from the first page
+	const applySearch = (e: React.FormEvent) => {
+		e.preventDefault();
+		loadFiles({ ...query, search: searchInput.trim(), offset: 0 });
+	};
+
+	const changeSort = (sort: SortField) => loadFiles({ ...query, sort, offset: 0 });
+
+	const changeOrder = (order: 'asc' | 'desc') => loadFiles({ ...query, order, offset: 0 });
+
+	const previousPage = () => loadFiles({ ...query, offset: Math.max(0, query.offset - PAGE_SIZE) });
+
+	const nextPage = () => loadFiles({ ...query, offset: query.offset + PAGE_SIZE });
+
 	const deleteFile = async (fileId: string, filename: string) => {
 		if (!confirm(`Are you sure you want to delete "${filename}"?`)) {
 			return;
@@ -142,12 +194,7 @@ const AdminPage: React.FC = () => {
 		try {
 			const response = await fetch(`/api/admin/file/${fileId}`, {
 				method: 'DELETE',
-				headers: {
-					'Content-Type': 'application/json',
-				},
-				body: JSON.stringify({
-					admin_password: adminPassword,
-				}),
+				headers: adminHeaders(),
 			});
 
 			if (response.ok) {
@@ -181,11 +228,8 @@ const AdminPage: React.FC = () => {
 		try {
 			const response = await fetch(`/api/admin/file/${fileId}/expires`, {
 				method: 'PUT',
-				headers: {
-					'Content-Type': 'application/json',
-				},
+				headers: adminHeaders(),
 				body: JSON.stringify({
-					admin_password: adminPassword,
 					expires_at: expirationDate,
 				}),
 			});
@@ -249,11 +293,8 @@ const AdminPage: React.FC = () => {
 		try {
 			const response = await fetch('/api/admin/file/password', {
 				method: 'PUT',
-				headers: {
-					'Content-Type': 'application/json',
-				},
+				headers: adminHeaders(),
 				body: JSON.stringify({
-					admin_password: adminPassword,
 					file_id: fileId,
 					new_password: newPassword,
 					password_type: passwordType,
@@ -279,11 +320,16 @@ const AdminPage: React.FC = () => {
 	};
 
 	const logout = () => {
+		// Revoke the token so it can't be reused; signing out locally doesn't wait for it
+		fetch('/api/admin/logout', { method: 'POST', headers: adminHeaders() }).catch(() => {});
 		setIsAuthenticated(false);
 		setPassword('');
-		setAdminPassword('');
 		setAdminToken('');
 		setFiles([]);
+		setQuery(defaultQuery);
+		setSearchInput('');
+		setTotal(0);
+		setHasMore(false);
 		setError('');
 		setMessage('');
 	};
@@ -406,15 +452,57 @@ const AdminPage: React.FC = () => {
 				{/* Files Section */}
 				<div className='bg-white border border-gray-200'>
 					<div className='px-6 py-4 border-b border-gray-200'>
-						<h3 className='text-lg font-medium text-gray-900'>Uploaded Files ({files.length})</h3>
+						<h3 className='text-lg font-medium text-gray-900'>Uploaded Files ({total})</h3>
 						<p className='mt-1 text-sm text-gray-600'>Manage and monitor all uploaded files</p>
 					</div>
 
+					{/* Search and sort */}
+					<div className='px-6 py-4 border-b border-gray-200 flex flex-wrap items-center gap-3'>
+						<form className='flex flex-1 min-w-[16rem] items-center gap-2' onSubmit={applySearch}>
+							<Input
+								type='search'
+								value={searchInput}
+								onChange={(e) => setSearchInput(e.target.value)}
+								placeholder='Search by filename'
+								icon={Search}
+								inputSize='sm'
+								containerClassName='flex-1'
+							/>
+							<Button type='submit' disabled={loading} variant='secondary' size='sm'>
+								Search
+							</Button>
+						</form>
+						<select
+							value={query.sort}
+							onChange={(e) => changeSort(e.target.value as SortField)}
+							disabled={loading}
+							className={selectClassName}
+							aria-label='Sort by'
+						>
+							<option value='uploaded_at'>Uploaded</option>
+							<option value='expires_at'>Expires</option>
+							<option value='filename'>Filename</option>
+							<option value='size'>Size</option>
+						</select>
+						<select
+							value={query.order}
+							onChange={(e) => changeOrder(e.target.value as 'asc' | 'desc')}
+							disabled={loading}
+							className={selectClassName}
+							aria-label='Sort order'
+						>
+							<option value='desc'>Descending</option>
+							<option value='asc'>Ascending</option>
+						</select>
+					</div>
+
 					{files.length === 0 ? (
 						<div className='text-center py-16'>
 							<Database className='w-12 h-12 text-gray-400 mx-auto mb-4' />
 							<p className='text-gray-500 text-lg'>No files found</p>
-							<p className='text-gray-400 text-sm'>Upload some files to see them here</p>
+							<p className='text-gray-400 text-sm'>
+								{query.search ? 'Try a different search' : 'Upload some files to see them here'}
+							</p>
 						</div>
 					) : (
 						<div className='overflow-x-auto'>
@@ -574,6 +662,36 @@ const AdminPage: React.FC = () => {
 							</table>
 						</div>
 					)}
+
+					{/* Paging */}
+					{total > 0 && (
+						<div className='px-6 py-4 border-t border-gray-200 flex items-center justify-between'>
+							<p className='text-sm text-gray-600'>
+								{query.offset + 1}–{query.offset + files.length} of {total}
+							</p>
+							<div className='flex items-center gap-2'>
+								<Button
+									onClick={previousPage}
+									disabled={loading || query.offset === 0}
+									variant='secondary'
+									size='sm'
+									icon={ChevronLeft}
+								>
+									Previous
+								</Button>
+								<Button
+									onClick={nextPage}
+									disabled={loading || !hasMore}
+									variant='secondary'
+									size='sm'
+									icon={ChevronRight}
+									iconPosition='right'
+								>
+									Next
+								</Button>
+							</div>
+						</div>
+					)}
 				</div>
 			</main>
 			<Footer />
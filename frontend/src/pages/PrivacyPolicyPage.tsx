@@ -136,7 +136,9 @@ const PrivacyPolicyPage: React.FC = () => {
 									<h3 className='text-lg font-medium text-gray-900 mb-2'>5.1 File Data</h3>
 									<p className='text-gray-700 leading-relaxed'>
 										All uploaded files are automatically and permanently deleted after 24 hours.
-										This is a core feature of our service designed to protect your privacy.
+										Earlier versions of a file whose content was replaced are deleted with it, if
+										not sooner. This is a core feature of our service designed to protect your
+										privacy.
 									</p>
 								</div>
 
@@ -8,6 +8,14 @@ export interface FileMetadata {
   upload_time: string;
   expires_at: string;
   has_download_password: boolean;
+  accessibility?: Accessibility;
+  tags?: Record<string, string>;
+}
+
+export interface Accessibility {
+  alt_text?: string;
+  caption?: string;
+  description?: string;
 }
 
 export interface UploadResult {
@@ -20,6 +28,7 @@ export interface UploadResult {
 }
 
 export interface ZipFile {
+  index: number;
   name: string;
   size: number;
   compressed: number;
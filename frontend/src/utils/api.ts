@@ -252,8 +252,12 @@ export const getFilePreviewWithProgress = async (
 	return { blob, contentType };
 };
 
+// Archive formats the backend can list and extract from
+export const isArchiveFilename = (filename: string): boolean =>
+	/\.(zip|tar|tar\.gz|tgz|tar\.zst|tzst)$/i.test(filename);
+
 export const getZipContents = async (fileId: string): Promise<ZipContents> => {
-	const response = await fetch(`/api/zip/${fileId}`);
+	const response = await fetch(`/api/archive/${fileId}`);
 	const data = await response.json();
 
 	if (!response.ok) {
@@ -265,10 +269,11 @@ export const getZipContents = async (fileId: string): Promise<ZipContents> => {
 
 export const getZipFilePreview = async (
 	fileId: string,
-	fileName: string
+	entryIndex: number
 ): Promise<{ blob: Blob; contentType: string }> => {
-	const url = new URL(`/api/zip/${fileId}/extract`, window.location.origin);
-	url.searchParams.append('filename', fileName);
+	const url = new URL(`/api/archive/${fileId}/extract`, window.location.origin);
+	// Entries are addressed by position, so duplicate or undecodable names still work
+	url.searchParams.append('index', String(entryIndex));
 	
 	const response = await fetch(url.toString());
 	